@@ -2,13 +2,19 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
+	"github.com/TicketsBot/subscriptions-app/internal/app"
 	"github.com/TicketsBot/subscriptions-app/internal/config"
-	"github.com/TicketsBot/subscriptions-app/internal/server"
-	"github.com/TicketsBot/subscriptions-app/pkg/patreon"
+	"github.com/TicketsBot/subscriptions-app/internal/demo"
+	"github.com/TicketsBot/subscriptions-app/internal/logging"
+	"github.com/TicketsBot/subscriptions-app/internal/secrets"
+	"github.com/TicketsBot/subscriptions-app/internal/tracing"
 	"github.com/getsentry/sentry-go"
 	"github.com/jackc/pgx"
 	"github.com/jackc/pgx/v4/pgxpool"
@@ -18,15 +24,19 @@ import (
 	_ "github.com/joho/godotenv/autoload"
 )
 
-func DbConn(conf config.Config, logger *zap.Logger) *pgxpool.Pool {
-	cfg, err := pgxpool.ParseConfig(fmt.Sprintf(
+func dbConnString(conf config.Config) string {
+	return fmt.Sprintf(
 		"postgres://%s:%s@%s/%s?pool_max_conns=%d",
 		conf.Database.Username,
 		conf.Database.Password,
 		conf.Database.Host,
 		conf.Database.Database,
 		conf.Database.Threads,
-	))
+	)
+}
+
+func DbConn(conf config.Config, logger *zap.Logger) *pgxpool.Pool {
+	cfg, err := pgxpool.ParseConfig(dbConnString(conf))
 
 	if err != nil {
 		logger.Fatal("Failed to parse database config", zap.Error(err))
@@ -36,6 +46,12 @@ func DbConn(conf config.Config, logger *zap.Logger) *pgxpool.Pool {
 	// TODO: Sentry
 	cfg.ConnConfig.LogLevel = pgx.LogLevelWarn
 
+	// Queries are only logged at the info level, which the tracing logger uses to create spans
+	if tracing.Enabled(conf) {
+		cfg.ConnConfig.Logger = tracing.PgxLogger{}
+		cfg.ConnConfig.LogLevel = pgx.LogLevelInfo
+	}
+
 	pool, err := pgxpool.ConnectConfig(context.Background(), cfg)
 	if err != nil {
 		logger.Fatal("Failed to connect to database", zap.Error(err))
@@ -45,17 +61,64 @@ func DbConn(conf config.Config, logger *zap.Logger) *pgxpool.Pool {
 	return pool
 }
 
+var (
+	configPath     = flag.String("config", "", "Path to a JSON, YAML or TOML config file")
+	validateConfig = flag.Bool("validate-config", false, "Check the config, database and Patreon credentials, then exit")
+	demoMode       = flag.Bool("demo", false, "Serve generated patrons instead of syncing with Patreon, for training and screenshots. Postgres is still required")
+	once           = flag.Bool("once", false, "Fetch the patrons from Patreon a single time, write them to -output, then exit")
+	output         = flag.String("output", "", "Path to write the patrons fetched with -once to, or stdout if unset")
+)
+
 func main() {
-	conf, err := config.LoadConfig()
+	flag.Parse()
+
+	conf, err := loadConfig()
 	if err != nil {
 		panic(err)
 	}
 
+	if err := conf.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid config:\n%s\n", err)
+		os.Exit(1)
+	}
+
+	if flag.Arg(0) == "migrate" {
+		if err := migrate(conf, flag.Args()[1:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Migration failed: %s\n", err)
+			os.Exit(1)
+		}
+
+		return
+	}
+
+	if flag.Arg(0) == "protect-emails" {
+		if err := protectEmails(conf); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to hash stored emails: %s\n", err)
+			os.Exit(1)
+		}
+
+		return
+	}
+
+	if *validateConfig {
+		if err := preflight(conf); err != nil {
+			fmt.Fprintf(os.Stderr, "Pre-flight checks failed:\n%s\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Println("Config is valid")
+		return
+	}
+
+	redactor := logging.NewRedactor(conf)
+
 	var logger *zap.Logger
 	if conf.ProductionMode {
 		if conf.SentryDsn != nil {
 			if err := sentry.Init(sentry.ClientOptions{
-				Dsn: *conf.SentryDsn,
+				Dsn:              *conf.SentryDsn,
+				EnableTracing:    conf.SentryTracesSampleRate > 0,
+				TracesSampleRate: conf.SentryTracesSampleRate,
 			}); err != nil {
 				panic(err)
 			}
@@ -63,104 +126,96 @@ func main() {
 			defer sentry.Flush(time.Second * 2)
 
 			logger, err = zap.NewProduction(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
-				return zapcore.RegisterHooks(core, func(entry zapcore.Entry) error {
-					if entry.Level == zapcore.ErrorLevel {
-						hostname, _ := os.Hostname()
-
-						sentry.CaptureEvent(&sentry.Event{
-							Extra: map[string]any{
-								"caller": entry.Caller.String(),
-								"stack":  entry.Stack,
-							},
-							Level:      sentry.LevelError,
-							Message:    entry.Message,
-							ServerName: hostname,
-							Timestamp:  entry.Time,
-							Logger:     entry.LoggerName,
-						})
-					}
-
-					return nil
-				})
+				return zapcore.NewTee(redactor.Wrap(core), redactor.Wrap(&sentryCore{}))
 			}))
 		} else {
-			logger, err = zap.NewProduction()
+			logger, err = zap.NewProduction(zap.WrapCore(redactor.Wrap))
 		}
 	} else {
-		logger, err = zap.NewDevelopment()
+		logger, err = zap.NewDevelopment(zap.WrapCore(redactor.Wrap))
 	}
 
 	if err != nil {
 		panic(err)
 	}
 
-	dbConn := DbConn(conf, logger)
-
-	patreonClient := patreon.NewClient(conf, logger.With(zap.String("component", "patreon_client")), dbConn)
+	shutdownTracing, err := tracing.Setup(context.Background(), conf)
+	if err != nil {
+		logger.Fatal("Failed to set up tracing", zap.Error(err))
+		return
+	}
 
-	pledgeCh := make(chan map[string]patreon.Patron)
-	go startPatreonLoop(context.Background(), logger, patreonClient, pledgeCh)
+	defer shutdownTracing(context.Background())
 
-	server := server.NewServer(conf, logger.With(zap.String("component", "server")))
+	dbConn := DbConn(conf, logger)
 
-	go func() {
-		for pledges := range pledgeCh {
-			server.UpdatePledges(pledges)
+	if *once {
+		if err := fetchOnce(conf, logger, dbConn); err != nil {
+			logger.Fatal("Failed to fetch patrons", zap.Error(err))
 		}
-	}()
 
-	if err := server.Run(); err != nil {
-		panic(err)
+		return
 	}
-}
 
-func startPatreonLoop(ctx context.Context, logger *zap.Logger, patreonClient *patreon.Client, ch chan map[string]patreon.Patron) {
-	for {
-		fetchPledges(ctx, logger, patreonClient, ch)
-		time.Sleep(time.Minute)
-	}
-}
+	// Cancelled on SIGTERM or an interrupt, which stops the server and waits for components, such as a running sync, to
+	// stop before exiting
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
 
-func fetchPledges(
-	ctx context.Context,
-	logger *zap.Logger,
-	patreonClient *patreon.Client,
-	ch chan map[string]patreon.Patron,
-) {
-	if patreonClient.Tokens.ExpiresAt.Before(time.Now()) {
-		logger.Fatal(
-			"Refresh token has already expired (expired at %s)",
-			zap.Time("expires_at", patreonClient.Tokens.ExpiresAt),
-		)
+	application, err := app.New(ctx, conf, logger, dbConn, app.Options{
+		Demo:       *demoMode,
+		LoadConfig: loadConfig,
+	})
+	if err != nil {
+		logger.Fatal("Failed to start", zap.Error(err))
 		return
 	}
 
-	if time.Until(patreonClient.Tokens.ExpiresAt) < time.Hour*24*3 {
-		logger.Info(
-			"Token expires in less than 3 days, refreshing",
-			zap.Time("expires_at", patreonClient.Tokens.ExpiresAt),
-		)
+	go reloadOnSignal(logger, application.Reload)
 
-		ctx, cancel := context.WithTimeout(ctx, time.Second*30)
-		defer cancel()
+	if err := application.Run(ctx); err != nil {
+		panic(err)
+	}
 
-		if err := patreonClient.RefreshCredentials(ctx); err != nil {
-			logger.Error("Failed to refresh token", zap.Error(err))
-		} else {
-			logger.Info("Tokens refreshed successfully")
-		}
+	dbConn.Close()
+	logger.Info("Shut down gracefully")
+}
 
-		cancel()
+func loadConfig() (config.Config, error) {
+	var conf config.Config
+	var err error
+	if *configPath != "" {
+		conf, err = config.LoadConfigFrom(*configPath)
+	} else {
+		conf, err = config.LoadConfig()
 	}
 
-	ctx, cancel := context.WithTimeout(ctx, time.Hour)
+	if err != nil {
+		return config.Config{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
 	defer cancel()
 
-	pledges, err := patreonClient.FetchPledges(ctx)
-	if err != nil {
-		logger.Error("Failed to fetch pledges", zap.Error(err))
-		return
+	if err := secrets.ResolveConfig(ctx, &conf); err != nil {
+		return config.Config{}, err
 	}
 
-	ch <- pledges
+	if *demoMode {
+		demo.Configure(&conf)
+	}
+
+	return conf, nil
+}
+
+// reloadOnSignal reloads the config whenever SIGHUP is received
+func reloadOnSignal(logger *zap.Logger, reload func() (config.Config, error)) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+
+	for range ch {
+		if _, err := reload(); err != nil {
+			logger.Error("Failed to reload config", zap.Error(err))
+		}
+	}
 }
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/TicketsBot/subscriptions-app/internal/config"
+	"github.com/TicketsBot/subscriptions-app/internal/database"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const migrateUsage = "usage: migrate up|down|status"
+
+// migrate applies, reverts or lists the schema migrations. Replicas that run it at the same time wait for each other,
+// as the migration lock is held throughout.
+func migrate(conf config.Config, args []string) error {
+	if len(args) != 1 {
+		return errors.New(migrateUsage)
+	}
+
+	ctx := context.Background()
+
+	pool, err := pgxpool.Connect(ctx, dbConnString(conf))
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	defer pool.Close()
+
+	db := database.NewDatabase(pool)
+
+	switch args[0] {
+	case "up":
+		applied, err := db.MigrateUp(ctx)
+		for _, migration := range applied {
+			fmt.Printf("Applied %d_%s\n", migration.Version, migration.Name)
+		}
+
+		if err == nil && len(applied) == 0 {
+			fmt.Println("No migrations to apply")
+		}
+
+		return err
+	case "down":
+		reverted, ok, err := db.MigrateDown(ctx)
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			fmt.Printf("Reverted %d_%s\n", reverted.Version, reverted.Name)
+		} else {
+			fmt.Println("No migrations to revert")
+		}
+
+		return nil
+	case "status":
+		statuses, err := db.MigrationStatuses(ctx)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = status.AppliedAt.Format(time.RFC3339)
+			}
+
+			fmt.Fprintf(w, "%d\t%s\t%s\n", status.Version, status.Name, applied)
+		}
+
+		return w.Flush()
+	default:
+		return errors.New(migrateUsage)
+	}
+}
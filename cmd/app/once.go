@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	"github.com/TicketsBot/subscriptions-app/internal/app"
+	"github.com/TicketsBot/subscriptions-app/internal/config"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"go.uber.org/zap"
+)
+
+// fetchOnce fetches the patrons a single time and writes them as JSON, keyed by normalized email, to -output
+func fetchOnce(conf config.Config, logger *zap.Logger, pool *pgxpool.Pool) error {
+	defer pool.Close()
+
+	patrons, err := app.FetchOnce(context.Background(), conf, logger, pool, app.Options{Demo: *demoMode})
+	if err != nil {
+		return err
+	}
+
+	encoded, err := json.MarshalIndent(patrons, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	encoded = append(encoded, '\n')
+
+	if *output == "" {
+		_, err = os.Stdout.Write(encoded)
+		return err
+	}
+
+	// The file holds patrons' emails, so is only readable by its owner
+	if err := os.WriteFile(*output, encoded, 0600); err != nil {
+		return err
+	}
+
+	logger.Info("Wrote patrons", zap.Int("count", len(patrons)), zap.String("path", *output))
+	return nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/TicketsBot/subscriptions-app/internal/clock"
+	"github.com/TicketsBot/subscriptions-app/internal/config"
+	"github.com/TicketsBot/subscriptions-app/internal/database"
+	"github.com/TicketsBot/subscriptions-app/internal/store"
+	"github.com/TicketsBot/subscriptions-app/pkg/patreon"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"go.uber.org/zap"
+)
+
+const preflightTimeout = time.Second * 30
+
+// preflight checks that the app can connect to the database and Patreon with the config, for use before a deploy. The
+// config itself, including the Discord public key, has already been validated.
+func preflight(conf config.Config) error {
+	ctx, cancel := context.WithTimeout(context.Background(), preflightTimeout)
+	defer cancel()
+
+	pool, err := pgxpool.Connect(ctx, dbConnString(conf))
+	if err == nil {
+		defer pool.Close()
+		err = pool.Ping(ctx)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	// NewClient logs why the tokens couldn't be read
+	logger, err := zap.NewDevelopment(zap.IncreaseLevel(zap.WarnLevel))
+	if err != nil {
+		return err
+	}
+
+	patreonClient := patreon.NewClient(conf, logger, store.NewPostgres(database.NewDatabase(pool)), nil, clock.Real)
+	if patreonClient == nil {
+		return errors.New("failed to read Patreon tokens from the database")
+	}
+
+	if err := patreonClient.VerifyCampaign(ctx); err != nil {
+		return fmt.Errorf("failed to verify Patreon credentials: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/TicketsBot/subscriptions-app/internal/config"
+	"github.com/TicketsBot/subscriptions-app/internal/database"
+	"github.com/TicketsBot/subscriptions-app/internal/privacy"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// protectEmails hashes the plaintext emails stored before hashed emails were enabled, so that lookups, which hash the
+// entered email, match them again. Emails that are already hashed are left unchanged, so it can be run again.
+func protectEmails(conf config.Config) error {
+	if !conf.Privacy.HashEmails {
+		return errors.New("hashed emails are not enabled, set PRIVACY_HASH_EMAILS=true first")
+	}
+
+	ctx := context.Background()
+
+	pool, err := pgxpool.Connect(ctx, dbConnString(conf))
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	defer pool.Close()
+
+	updated, err := database.NewDatabase(pool).ProtectEmails(ctx, privacy.NewEmails(conf).Protect)
+	if err != nil {
+		return err
+	}
+
+	tables := make([]string, 0, len(updated))
+	for table := range updated {
+		tables = append(tables, table)
+	}
+
+	sort.Strings(tables)
+
+	for _, table := range tables {
+		fmt.Printf("Hashed the emails of %d rows in %s\n", updated[table], table)
+	}
+
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+
+	"github.com/getsentry/sentry-go"
+	"go.uber.org/zap/zapcore"
+)
+
+// sentryCore reports error level log entries to Sentry. Unlike a hook, a core receives the entry's fields, so that
+// they can be attached to the event: the request ID is set as a tag, and the remaining fields as extra data.
+type sentryCore struct {
+	fields []zapcore.Field
+}
+
+var _ zapcore.Core = (*sentryCore)(nil)
+
+func (c *sentryCore) Enabled(level zapcore.Level) bool {
+	return level == zapcore.ErrorLevel
+}
+
+func (c *sentryCore) With(fields []zapcore.Field) zapcore.Core {
+	combined := make([]zapcore.Field, 0, len(c.fields)+len(fields))
+	combined = append(combined, c.fields...)
+	combined = append(combined, fields...)
+
+	return &sentryCore{fields: combined}
+}
+
+func (c *sentryCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+
+	return checked
+}
+
+func (c *sentryCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	encoder := zapcore.NewMapObjectEncoder()
+	for _, field := range c.fields {
+		field.AddTo(encoder)
+	}
+
+	for _, field := range fields {
+		field.AddTo(encoder)
+	}
+
+	extra := encoder.Fields
+	extra["caller"] = entry.Caller.String()
+	extra["stack"] = entry.Stack
+
+	tags := make(map[string]string)
+	if requestId, ok := extra["request_id"].(string); ok {
+		tags["request_id"] = requestId
+		delete(extra, "request_id")
+	}
+
+	hostname, _ := os.Hostname()
+
+	sentry.CaptureEvent(&sentry.Event{
+		Extra:      extra,
+		Tags:       tags,
+		Level:      sentry.LevelError,
+		Message:    entry.Message,
+		ServerName: hostname,
+		Timestamp:  entry.Time,
+		Logger:     entry.LoggerName,
+	})
+
+	return nil
+}
+
+func (c *sentryCore) Sync() error {
+	return nil
+}
@@ -4,35 +4,78 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"strconv"
+	"strings"
 
-	"github.com/TicketsBot-cloud/gdl/objects/interaction"
 	"github.com/TicketsBot-cloud/gdl/rest"
+	"github.com/TicketsBot/subscriptions-app/internal/server"
 )
 
-var commands = []rest.CreateCommandData{
-	{
-		Name:        "lookup",
-		Description: "Look up information about a user's subscription",
-		Options: []interaction.ApplicationCommandOption{
-			{
-				Type:        interaction.OptionTypeString,
-				Name:        "email",
-				Description: "The Patreon email address of the user to lookup",
-				Required:    false,
-			},
-			{
-				Type:        interaction.OptionTypeUser,
-				Name:        "user",
-				Description: "The Discord Id of the user to lookup",
-				Required:    false,
-			},
-		},
-		Type: interaction.ApplicationCommandTypeChatInput,
-	},
+const permissionManageGuild uint64 = 1 << 5
+
+const (
+	integrationTypeGuildInstall = 0
+	integrationTypeUserInstall  = 1
+
+	contextGuild          = 0
+	contextBotDm          = 1
+	contextPrivateChannel = 2
+)
+
+// command adds the permission and installation fields that rest.CreateCommandData lacks
+type command struct {
+	rest.CreateCommandData
+	DefaultMemberPermissions *string `json:"default_member_permissions"` // A bitset encoded as a string, nil for everyone
+	DmPermission             *bool   `json:"dm_permission,omitempty"`
+	IntegrationTypes         []int   `json:"integration_types,omitempty"`
+	Contexts                 []int   `json:"contexts,omitempty"`
+}
+
+// withPermissions sets the default permissions, installation types and contexts of each command. Staff commands are
+// only visible to members with the Manage Server permission, until server admins override them in the Integrations
+// settings. Commands that are not user installable can't be used in DMs, as they either act on the server or are
+// restricted to allowed guilds. Guild commands can only be used in their guild, so are never user installable.
+func withPermissions(commands []server.RegisteredCommand, guild bool) []command {
+	withPermissions := make([]command, len(commands))
+	for i, data := range commands {
+		withPermissions[i] = command{
+			CreateCommandData: data.CreateCommandData,
+			DmPermission:      ptr(false),
+			IntegrationTypes:  []int{integrationTypeGuildInstall},
+			Contexts:          []int{contextGuild},
+		}
+
+		if data.StaffOnly {
+			withPermissions[i].DefaultMemberPermissions = ptr(strconv.FormatUint(permissionManageGuild, 10))
+		}
+
+		// Discord only accepts installation types and contexts for global commands
+		if guild {
+			withPermissions[i].DmPermission = nil
+			withPermissions[i].IntegrationTypes = nil
+			withPermissions[i].Contexts = nil
+			continue
+		}
+
+		if data.UserInstallable {
+			withPermissions[i].DmPermission = ptr(true)
+			withPermissions[i].IntegrationTypes = append(withPermissions[i].IntegrationTypes, integrationTypeUserInstall)
+			withPermissions[i].Contexts = append(withPermissions[i].Contexts, contextBotDm, contextPrivateChannel)
+		}
+	}
+
+	return withPermissions
+}
+
+func ptr[T any](value T) *T {
+	return &value
 }
 
 var (
-	token = flag.String("token", "", "Bot token")
+	token       = flag.String("token", "", "Bot token")
+	guilds      = flag.String("guild", "", "Comma separated IDs of guilds to register the commands to, instead of globally")
+	deleteStale = flag.Bool("delete", false, "Delete registered commands that are no longer defined")
+	diff        = flag.Bool("diff", false, "Print what would change, without changing anything")
 )
 
 func main() {
@@ -47,9 +90,67 @@ func main() {
 		panic(err)
 	}
 
-	if _, err := rest.ModifyGlobalCommands(context.Background(), *token, nil, self.Id, commands); err != nil {
+	scopes, err := parseScopes(self.Id, *guilds)
+	if err != nil {
 		panic(err)
 	}
 
-	fmt.Println("Commands created successfully")
+	for _, s := range scopes {
+		if err := register(context.Background(), s); err != nil {
+			panic(fmt.Errorf("failed to register %s: %w", s, err))
+		}
+	}
+}
+
+// register creates and updates the commands of the scope that differ from those registered, deleting stale commands if
+// -delete is set
+func register(ctx context.Context, s scope) error {
+	commands := withPermissions(server.RegisteredCommands(), s.guildId != 0)
+
+	registered, err := s.commands(ctx, *token)
+	if err != nil {
+		return err
+	}
+
+	p, err := newPlan(commands, registered)
+	if err != nil {
+		return err
+	}
+
+	p.print(s, *deleteStale)
+	if *diff || p.empty(*deleteStale) {
+		return nil
+	}
+
+	// Overwriting replaces every command in a single request, which deletes those not given
+	if *deleteStale {
+		return s.overwrite(ctx, *token, commands)
+	}
+
+	for _, cmd := range append(p.create, p.update...) {
+		if err := s.upsert(ctx, *token, cmd); err != nil {
+			return fmt.Errorf("failed to register %s: %w", cmd.Name, err)
+		}
+	}
+
+	fmt.Printf("Registered %s\n", s)
+	return nil
+}
+
+func parseScopes(applicationId uint64, guilds string) ([]scope, error) {
+	if guilds == "" {
+		return []scope{{applicationId: applicationId}}, nil
+	}
+
+	var scopes []scope
+	for _, raw := range strings.Split(guilds, ",") {
+		guildId, err := strconv.ParseUint(strings.TrimSpace(raw), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid guild ID %q", raw)
+		}
+
+		scopes = append(scopes, scope{applicationId: applicationId, guildId: guildId})
+	}
+
+	return scopes, nil
 }
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/TicketsBot-cloud/gdl/rest/ratelimit"
+	"github.com/TicketsBot-cloud/gdl/rest/request"
+)
+
+// scope is where commands are registered: globally, or to a single guild, where changes are available instantly
+type scope struct {
+	applicationId uint64
+	guildId       uint64 // Zero for global commands
+}
+
+func (s scope) String() string {
+	if s.guildId == 0 {
+		return "global commands"
+	}
+
+	return fmt.Sprintf("commands of guild %d", s.guildId)
+}
+
+// endpoint returns the commands endpoint of the scope, rate limited by the guild or global route
+func (s scope) endpoint(requestType request.RequestType, guildRoute, globalRoute ratelimit.RouteId) request.Endpoint {
+	endpoint := request.Endpoint{
+		RequestType: requestType,
+		ContentType: request.ApplicationJson,
+		Endpoint:    fmt.Sprintf("/applications/%d/commands", s.applicationId),
+		Route:       ratelimit.NewApplicationRoute(globalRoute, s.applicationId),
+	}
+
+	if s.guildId != 0 {
+		endpoint.Endpoint = fmt.Sprintf("/applications/%d/guilds/%d/commands", s.applicationId, s.guildId)
+		endpoint.Route = ratelimit.NewGuildRoute(guildRoute, s.guildId)
+	}
+
+	if requestType == request.GET {
+		endpoint.ContentType = request.Nil
+	}
+
+	return endpoint
+}
+
+// commands returns the registered commands, decoded loosely so that fields missing from gdl's types can be compared
+func (s scope) commands(ctx context.Context, token string) ([]map[string]any, error) {
+	endpoint := s.endpoint(request.GET, ratelimit.RouteGetGuildCommands, ratelimit.RouteGetGlobalCommands)
+
+	var registered []map[string]any
+	if err, _ := endpoint.Request(ctx, token, nil, &registered); err != nil {
+		return nil, err
+	}
+
+	return registered, nil
+}
+
+// upsert creates the command, or replaces the registered command with the same name, leaving other commands alone
+func (s scope) upsert(ctx context.Context, token string, cmd command) error {
+	endpoint := s.endpoint(request.POST, ratelimit.RouteCreateGuildCommand, ratelimit.RouteCreateGlobalCommand)
+	err, _ := endpoint.Request(ctx, token, cmd, nil)
+	return err
+}
+
+// overwrite replaces every registered command with the given commands, deleting any that aren't given.
+// rest.ModifyGlobalCommands only accepts rest.CreateCommandData, so the same request is made with the permissions set.
+func (s scope) overwrite(ctx context.Context, token string, commands []command) error {
+	endpoint := s.endpoint(request.PUT, ratelimit.RouteModifyGuildCommands, ratelimit.RouteModifyGlobalCommands)
+	err, _ := endpoint.Request(ctx, token, commands, nil)
+	return err
+}
+
+// plan is what registering the commands would change
+type plan struct {
+	create  []command
+	update  []command
+	changes map[string][]string // The fields that differ, keyed by the name of each updated command
+	stale   []string            // Registered commands that are no longer defined
+}
+
+func (p plan) empty(deleteStale bool) bool {
+	return len(p.create) == 0 && len(p.update) == 0 && (!deleteStale || len(p.stale) == 0)
+}
+
+func newPlan(commands []command, registered []map[string]any) (plan, error) {
+	p := plan{
+		changes: make(map[string][]string),
+	}
+
+	byName := make(map[string]map[string]any, len(registered))
+	for _, cmd := range registered {
+		name, _ := cmd["name"].(string)
+		byName[name] = cmd
+	}
+
+	for _, cmd := range commands {
+		existing, ok := byName[cmd.Name]
+		if !ok {
+			p.create = append(p.create, cmd)
+			continue
+		}
+
+		delete(byName, cmd.Name)
+
+		want, err := toMap(cmd)
+		if err != nil {
+			return plan{}, err
+		}
+
+		if fields := differences(want, existing); len(fields) > 0 {
+			p.update = append(p.update, cmd)
+			p.changes[cmd.Name] = fields
+		}
+	}
+
+	for name := range byName {
+		p.stale = append(p.stale, name)
+	}
+
+	sort.Strings(p.stale)
+	return p, nil
+}
+
+func (p plan) print(s scope, deleteStale bool) {
+	if len(p.create) == 0 && len(p.update) == 0 && len(p.stale) == 0 {
+		fmt.Printf("%s are up to date\n", s)
+		return
+	}
+
+	fmt.Printf("%s:\n", s)
+	for _, cmd := range p.create {
+		fmt.Printf("  + %s\n", cmd.Name)
+	}
+
+	for _, cmd := range p.update {
+		fmt.Printf("  ~ %s (%s changed)\n", cmd.Name, strings.Join(p.changes[cmd.Name], ", "))
+	}
+
+	for _, name := range p.stale {
+		if deleteStale {
+			fmt.Printf("  - %s\n", name)
+		} else {
+			fmt.Printf("  ! %s is no longer defined, pass -delete to remove it\n", name)
+		}
+	}
+}
+
+func toMap(cmd command) (map[string]any, error) {
+	encoded, err := json.Marshal(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	var decoded map[string]any
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		return nil, err
+	}
+
+	return decoded, nil
+}
+
+// differences returns the top level fields of the wanted command that differ from the registered command. Fields that
+// Discord adds, such as IDs and versions, are ignored.
+func differences(want, registered map[string]any) []string {
+	var fields []string
+	for key, value := range want {
+		if !equivalent(value, registered[key]) {
+			fields = append(fields, key)
+		}
+	}
+
+	slices.Sort(fields)
+	return fields
+}
+
+// equivalent compares decoded JSON values. Discord omits fields that are false or empty, so zero values are equivalent
+// to missing ones, and only the fields of wanted objects are compared.
+func equivalent(want, registered any) bool {
+	if isZero(want) {
+		return isZero(registered)
+	}
+
+	switch want := want.(type) {
+	case map[string]any:
+		registered, ok := registered.(map[string]any)
+		return ok && len(differences(want, registered)) == 0
+	case []any:
+		registered, _ := registered.([]any)
+		if len(want) != len(registered) {
+			return false
+		}
+
+		for i := range want {
+			if !equivalent(want[i], registered[i]) {
+				return false
+			}
+		}
+
+		return true
+	default:
+		return want == registered
+	}
+}
+
+func isZero(value any) bool {
+	switch value := value.(type) {
+	case nil:
+		return true
+	case bool:
+		return !value
+	case string:
+		return value == ""
+	case float64:
+		return value == 0
+	case []any:
+		return len(value) == 0
+	default:
+		return false
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/TicketsBot/subscriptions-app/internal/config"
+	"github.com/TicketsBot/subscriptions-app/internal/database"
+	"github.com/TicketsBot/subscriptions-app/internal/legacy"
+	"github.com/TicketsBot/subscriptions-app/internal/privacy"
+	"github.com/TicketsBot/subscriptions-app/internal/store"
+	"github.com/jackc/pgx/v4/pgxpool"
+
+	_ "github.com/joho/godotenv/autoload"
+)
+
+var (
+	file = flag.String("file", "", "Path to the legacy premium key CSV dump")
+)
+
+func main() {
+	flag.Parse()
+
+	if file == nil || *file == "" {
+		panic("no file provided")
+	}
+
+	conf, err := config.LoadConfig()
+	if err != nil {
+		panic(err)
+	}
+
+	pool, err := pgxpool.Connect(context.Background(), fmt.Sprintf(
+		"postgres://%s:%s@%s/%s",
+		conf.Database.Username,
+		conf.Database.Password,
+		conf.Database.Host,
+		conf.Database.Database,
+	))
+	if err != nil {
+		panic(err)
+	}
+
+	defer pool.Close()
+
+	db := database.NewDatabase(pool)
+	if err := db.CreateTables(context.Background()); err != nil {
+		panic(err)
+	}
+
+	f, err := os.Open(*file)
+	if err != nil {
+		panic(err)
+	}
+
+	defer f.Close()
+
+	imported, err := legacy.Import(context.Background(), store.NewPostgres(db), privacy.NewEmails(conf), f)
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("Imported %d legacy keys\n", imported)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/TicketsBot/subscriptions-app/internal/config"
+	"github.com/TicketsBot/subscriptions-app/internal/database"
+	"github.com/TicketsBot/subscriptions-app/internal/patreonexport"
+	"github.com/TicketsBot/subscriptions-app/internal/privacy"
+	"github.com/TicketsBot/subscriptions-app/internal/store"
+	"github.com/TicketsBot/subscriptions-app/internal/tiers"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"go.uber.org/zap"
+
+	_ "github.com/joho/godotenv/autoload"
+)
+
+var (
+	file     = flag.String("file", "", "Path to the members CSV exported from Patreon")
+	snapshot = flag.Bool("snapshot", false, "Also replace the stored Patreon snapshot with the export, before the app has synced")
+	dryRun   = flag.Bool("dry-run", false, "Parse the export and report what would be imported, without storing anything")
+)
+
+func main() {
+	flag.Parse()
+
+	if file == nil || *file == "" {
+		panic("no file provided")
+	}
+
+	conf, err := config.LoadConfig()
+	if err != nil {
+		panic(err)
+	}
+
+	pool, err := pgxpool.Connect(context.Background(), fmt.Sprintf(
+		"postgres://%s:%s@%s/%s",
+		conf.Database.Username,
+		conf.Database.Password,
+		conf.Database.Host,
+		conf.Database.Database,
+	))
+	if err != nil {
+		panic(err)
+	}
+
+	defer pool.Close()
+
+	db := database.NewDatabase(pool)
+	if err := db.CreateTables(context.Background()); err != nil {
+		panic(err)
+	}
+
+	// Tier mappings made with /tiers map are used to resolve tier names, as well as the configured tiers
+	registry := tiers.NewRegistry(conf, db, zap.NewNop())
+	if err := registry.Load(context.Background()); err != nil {
+		panic(err)
+	}
+
+	f, err := os.Open(*file)
+	if err != nil {
+		panic(err)
+	}
+
+	defer f.Close()
+
+	members, err := patreonexport.ParseCSV(f)
+	if err != nil {
+		panic(err)
+	}
+
+	emails := privacy.NewEmails(conf)
+
+	result, err := patreonexport.Import(context.Background(), db, registry, emails, members, *dryRun)
+	if err != nil {
+		panic(err)
+	}
+
+	verb := "Imported"
+	if *dryRun {
+		verb = "Would import"
+	}
+
+	fmt.Printf(
+		"%s %d history events for %d members, skipping %d members that already have history\n",
+		verb, result.Events, result.Members-result.Skipped, result.Skipped,
+	)
+
+	if result.UnknownTiers > 0 {
+		fmt.Printf("%d members have a tier whose name doesn't match a known tier, so their events have no tier\n", result.UnknownTiers)
+	}
+
+	if *snapshot {
+		patrons := patreonexport.Snapshot(registry, emails, members, conf.Patreon.CanonicalizeGmail)
+		if !*dryRun {
+			if err := store.NewPostgres(db).ReplaceSnapshot(context.Background(), patrons); err != nil {
+				panic(err)
+			}
+		}
+
+		fmt.Printf("%s a snapshot of %d members\n", verb, len(patrons))
+	}
+}
@@ -0,0 +1,261 @@
+// Command loadtest sends signed interactions and entitlement API requests to a running instance at a fixed rate, and
+// reports latency percentiles for each. The instance must be configured with the public key printed by -generate-key,
+// and an API key passed with -api-key, for those requests to be authenticated.
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TicketsBot/subscriptions-app/internal/server/interactiontest"
+)
+
+var (
+	baseUrl     = flag.String("url", "http://localhost:8080", "Base URL of the instance")
+	requestRate = flag.Float64("rate", 50, "Requests to start per second, across both kinds")
+	duration    = flag.Duration("duration", time.Minute, "How long to send requests for")
+	concurrency = flag.Int("concurrency", 100, "Maximum requests in flight. Requests due while at the limit are dropped.")
+	timeout     = flag.Duration("timeout", time.Second*10, "Timeout of each request")
+
+	privateKey  = flag.String("private-key", os.Getenv("LOADTEST_PRIVATE_KEY"), "Hex encoded Ed25519 seed used to sign interactions. Interactions are not sent if unset.")
+	generateKey = flag.Bool("generate-key", false, "Print a new key pair and exit")
+	command     = flag.String("command", "", "Slash command to invoke, as an administrator. Pings are sent if unset.")
+	option      = flag.String("option", "", "String option passed to -command, as name=value")
+
+	apiKey   = flag.String("api-key", os.Getenv("LOADTEST_API_KEY"), "API key used to look up entitlements. Entitlements are not looked up if unset.")
+	email    = flag.String("email", "loadtest@example.com", "Email to look up entitlements for")
+	apiRatio = flag.Float64("api-ratio", 0.5, "Fraction of requests that look up entitlements, if both kinds are enabled")
+)
+
+func main() {
+	flag.Parse()
+
+	if *generateKey {
+		publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			panic(err)
+		}
+
+		fmt.Printf("Public key (DISCORD_PUBLIC_KEY): %s\n", hex.EncodeToString(publicKey))
+		fmt.Printf("Private key (-private-key):      %s\n", hex.EncodeToString(privateKey.Seed()))
+		return
+	}
+
+	targets, err := buildTargets()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	fmt.Printf("Sending %.1f requests/s to %s for %s\n", *requestRate, *baseUrl, *duration)
+	results := run(ctx, targets)
+
+	for _, target := range targets {
+		results[target.name].print(target.name)
+	}
+}
+
+// target is a kind of request to send
+type target struct {
+	name   string
+	weight float64 // Fraction of requests of this kind
+	build  func() (*http.Request, error)
+}
+
+func buildTargets() ([]target, error) {
+	if *requestRate <= 0 || *concurrency <= 0 || *duration <= 0 {
+		return nil, errors.New("-rate, -concurrency and -duration must be positive")
+	}
+
+	var targets []target
+	if *privateKey != "" {
+		seed, err := hex.DecodeString(*privateKey)
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return nil, fmt.Errorf("-private-key must be a hex encoded %d byte seed", ed25519.SeedSize)
+		}
+
+		i := interactiontest.Ping()
+		if *command != "" {
+			var options []interactiontest.Option
+			if *option != "" {
+				name, value, ok := strings.Cut(*option, "=")
+				if !ok {
+					return nil, errors.New("-option must be in the form name=value")
+				}
+
+				options = append(options, interactiontest.String(name, value))
+			}
+
+			i = interactiontest.Command(*command, options...).
+				As(interactiontest.DefaultUserId, interactiontest.PermissionAdministrator)
+		}
+
+		harness := interactiontest.NewWithKey(ed25519.NewKeyFromSeed(seed))
+		targets = append(targets, target{
+			name:   "interaction",
+			weight: 1,
+			build: func() (*http.Request, error) {
+				// Each interaction is encoded and signed when sent, as the signature includes the timestamp
+				body := harness.Encode(i)
+				timestamp, signature := harness.Sign(body)
+
+				req, err := http.NewRequest(http.MethodPost, *baseUrl+"/interaction", bytes.NewReader(body))
+				if err != nil {
+					return nil, err
+				}
+
+				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set("X-Signature-Timestamp", timestamp)
+				req.Header.Set("X-Signature-Ed25519", signature)
+				return req, nil
+			},
+		})
+	}
+
+	if *apiKey != "" {
+		if *apiRatio < 0 || *apiRatio > 1 {
+			return nil, errors.New("-api-ratio must be between 0 and 1")
+		}
+
+		weight := 1.0
+		if len(targets) > 0 {
+			weight = *apiRatio
+			targets[0].weight = 1 - weight
+		}
+
+		entitlementsUrl := *baseUrl + "/api/entitlements?email=" + url.QueryEscape(*email)
+		targets = append(targets, target{
+			name:   "entitlements",
+			weight: weight,
+			build: func() (*http.Request, error) {
+				req, err := http.NewRequest(http.MethodGet, entitlementsUrl, nil)
+				if err != nil {
+					return nil, err
+				}
+
+				req.Header.Set("Authorization", "Bearer "+*apiKey)
+				return req, nil
+			},
+		})
+	}
+
+	if len(targets) == 0 {
+		return nil, errors.New("set -private-key, -api-key or both")
+	}
+
+	return targets, nil
+}
+
+// run starts requests on a fixed schedule, rather than waiting for each to complete, so that a slow server is not
+// sent less traffic and latency is not under-reported. Requests are interleaved according to the weight of each
+// target.
+func run(ctx context.Context, targets []target) map[string]*results {
+	client := &http.Client{
+		Timeout: *timeout,
+		Transport: &http.Transport{
+			MaxIdleConnsPerHost: *concurrency,
+		},
+	}
+
+	all := make(map[string]*results, len(targets))
+	for _, target := range targets {
+		all[target.name] = &results{}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, *duration)
+	defer cancel()
+
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / *requestRate))
+	defer ticker.Stop()
+
+	inFlight := make(chan struct{}, *concurrency)
+	credit := make([]float64, len(targets))
+
+	var wg sync.WaitGroup
+	for {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return all
+		case <-ticker.C:
+		}
+
+		target := next(targets, credit)
+		res := all[target.name]
+
+		select {
+		case inFlight <- struct{}{}:
+		default:
+			res.drop()
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-inFlight }()
+
+			res.record(send(client, target))
+		}()
+	}
+}
+
+// next picks the target that is furthest behind its share of requests, so that targets are interleaved evenly
+func next(targets []target, credit []float64) target {
+	best := 0
+	for i, target := range targets {
+		credit[i] += target.weight
+		if credit[i] > credit[best] {
+			best = i
+		}
+	}
+
+	credit[best]--
+	return targets[best]
+}
+
+func send(client *http.Client, target target) (time.Duration, error) {
+	req, err := target.build()
+	if err != nil {
+		return 0, err
+	}
+
+	start := time.Now()
+	res, err := client.Do(req)
+	if err != nil {
+		return time.Since(start), err
+	}
+
+	defer res.Body.Close()
+
+	// Latency includes reading the body, as the response is not useful until then
+	_, err = io.Copy(io.Discard, res.Body)
+	took := time.Since(start)
+
+	if err != nil {
+		return took, err
+	}
+
+	if res.StatusCode >= 300 {
+		return took, fmt.Errorf("%d status code", res.StatusCode)
+	}
+
+	return took, nil
+}
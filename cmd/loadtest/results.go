@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+// results collects the outcome of each request of a target
+type results struct {
+	mu        sync.Mutex
+	latencies []time.Duration // Of successful requests
+	errors    map[string]int  // Keyed by message
+	dropped   int
+}
+
+func (r *results) record(took time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err != nil {
+		if r.errors == nil {
+			r.errors = make(map[string]int)
+		}
+
+		r.errors[err.Error()]++
+		return
+	}
+
+	r.latencies = append(r.latencies, took)
+}
+
+// drop counts a request that was due while too many were in flight
+func (r *results) drop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.dropped++
+}
+
+func (r *results) print(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	failed := 0
+	for _, count := range r.errors {
+		failed += count
+	}
+
+	fmt.Printf("\n%s: %d succeeded, %d failed, %d dropped\n", name, len(r.latencies), failed, r.dropped)
+
+	if len(r.latencies) > 0 {
+		slices.Sort(r.latencies)
+
+		for _, p := range []float64{50, 90, 95, 99, 99.9} {
+			fmt.Printf("  p%-5g %s\n", p, percentile(r.latencies, p).Round(time.Microsecond))
+		}
+
+		fmt.Printf("  max    %s\n", r.latencies[len(r.latencies)-1].Round(time.Microsecond))
+	}
+
+	for message, count := range r.errors {
+		fmt.Printf("  error: %s (%d)\n", message, count)
+	}
+}
+
+// percentile returns the nearest-rank percentile of sorted latencies
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[max(rank-1, 0)]
+}
@@ -0,0 +1,207 @@
+// Command replaywebhook posts saved webhook payloads to a running instance, signed as the provider would sign them, so
+// that bugs in webhook handling can be reproduced. Payloads are sent byte for byte, in the order given, with files in
+// directories sent in name order.
+//
+//	replaywebhook -provider paddle -secret <secret> cmd/replaywebhook/testdata/paddle
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/TicketsBot/subscriptions-app/internal/server/interactiontest"
+	"github.com/TicketsBot/subscriptions-app/pkg/lemonsqueezy"
+	"github.com/TicketsBot/subscriptions-app/pkg/paddle"
+
+	_ "github.com/joho/godotenv/autoload"
+)
+
+var (
+	baseUrl    = flag.String("url", "http://localhost:8080", "Base URL of the instance")
+	provider   = flag.String("provider", "", "Provider that sent the payloads: paddle, lemonsqueezy or discord")
+	secret     = flag.String("secret", "", "Webhook secret, defaulting to PADDLE_WEBHOOK_SECRET or LEMONSQUEEZY_WEBHOOK_SECRET")
+	privateKey = flag.String("private-key", os.Getenv("SIMULATE_PRIVATE_KEY"), "Hex encoded Ed25519 seed used to sign Discord payloads, as with simulate")
+	delay      = flag.Duration("delay", 0, "Time to wait between payloads")
+	keepGoing  = flag.Bool("continue", false, "Send the remaining payloads after one is rejected")
+)
+
+const usage = `Usage: replaywebhook -provider <provider> [flags] <file or directory> ...
+
+Flags:
+`
+
+// signer sets the headers that authenticate the body
+type signer func(req *http.Request, body []byte)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	path, sign, err := newSigner(*provider)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n\n", err)
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	files, err := payloadFiles(flag.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	failed := 0
+	for i, file := range files {
+		if i > 0 && *delay > 0 {
+			time.Sleep(*delay)
+		}
+
+		status, err := send(*baseUrl+path, file, sign)
+		if err != nil {
+			failed++
+			fmt.Printf("FAIL %s: %s\n", file, err)
+
+			if !*keepGoing {
+				break
+			}
+
+			continue
+		}
+
+		fmt.Printf("ok   %s (%d)\n", file, status)
+	}
+
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// newSigner returns the webhook route of the provider, and how its payloads are signed
+func newSigner(provider string) (string, signer, error) {
+	switch provider {
+	case "paddle":
+		key := secretOrEnv("PADDLE_WEBHOOK_SECRET")
+		if key == "" {
+			return "", nil, errors.New("-secret or PADDLE_WEBHOOK_SECRET must be set")
+		}
+
+		// Signed now, rather than when the payload was saved, so that it is within the signature tolerance
+		return "/webhook/paddle", func(req *http.Request, body []byte) {
+			req.Header.Set("Paddle-Signature", paddle.Sign(key, time.Now(), body))
+		}, nil
+	case "lemonsqueezy":
+		key := secretOrEnv("LEMONSQUEEZY_WEBHOOK_SECRET")
+		if key == "" {
+			return "", nil, errors.New("-secret or LEMONSQUEEZY_WEBHOOK_SECRET must be set")
+		}
+
+		return "/webhook/lemonsqueezy", func(req *http.Request, body []byte) {
+			req.Header.Set("X-Signature", lemonsqueezy.Sign(key, body))
+		}, nil
+	case "discord":
+		seed, err := hex.DecodeString(*privateKey)
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return "", nil, fmt.Errorf("-private-key must be a hex encoded %d byte seed", ed25519.SeedSize)
+		}
+
+		harness := interactiontest.NewWithKey(ed25519.NewKeyFromSeed(seed))
+		return "/webhook/discord", func(req *http.Request, body []byte) {
+			timestamp, signature := harness.Sign(body)
+			req.Header.Set("X-Signature-Timestamp", timestamp)
+			req.Header.Set("X-Signature-Ed25519", signature)
+		}, nil
+	case "patreon", "stripe", "kofi":
+		return "", nil, fmt.Errorf("%s webhooks are not received by this app", provider)
+	default:
+		return "", nil, fmt.Errorf("-provider must be paddle, lemonsqueezy or discord, got %q", provider)
+	}
+}
+
+func secretOrEnv(name string) string {
+	if *secret != "" {
+		return *secret
+	}
+
+	return os.Getenv(name)
+}
+
+// payloadFiles expands directories into the .json files they contain, sorted by name
+func payloadFiles(args []string) ([]string, error) {
+	var files []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+
+		if !info.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+
+		matches, err := filepath.Glob(filepath.Join(arg, "*.json"))
+		if err != nil {
+			return nil, err
+		}
+
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("%s contains no .json files", arg)
+		}
+
+		sort.Strings(matches)
+		files = append(files, matches...)
+	}
+
+	return files, nil
+}
+
+// send posts the payload, returning the status code if it was accepted
+func send(url, file string, sign signer) (int, error) {
+	body, err := os.ReadFile(file)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	sign(req, body)
+
+	client := &http.Client{Timeout: time.Second * 30}
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		content, _ := io.ReadAll(res.Body)
+		return 0, fmt.Errorf("returned %d status code: %s", res.StatusCode, strings.TrimSpace(string(content)))
+	}
+
+	return res.StatusCode, nil
+}
@@ -0,0 +1,211 @@
+// Command simulate sends a single signed slash command to a running instance and prints the response, so that commands
+// can be exercised without a Discord application. The instance must be configured with the public key printed by
+// -generate-key.
+//
+//	simulate -private-key <seed> -guild <id> subscription lookup email=someone@example.com
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TicketsBot/subscriptions-app/internal/server/interactiontest"
+)
+
+var (
+	baseUrl     = flag.String("url", "http://localhost:8080", "Base URL of the instance")
+	privateKey  = flag.String("private-key", os.Getenv("SIMULATE_PRIVATE_KEY"), "Hex encoded Ed25519 seed used to sign the interaction")
+	generateKey = flag.Bool("generate-key", false, "Print a new key pair and exit")
+
+	guildId     = flag.Uint64("guild", interactiontest.DefaultGuildId, "ID of the guild to send the command from, which must be allowed by the instance")
+	dm          = flag.Bool("dm", false, "Send the command from a DM instead of a guild")
+	userId      = flag.Uint64("user", interactiontest.DefaultUserId, "ID of the user sending the command")
+	permissions = flag.Uint64("permissions", interactiontest.PermissionAdministrator, "Permissions of the member sending the command, as a bitset")
+	roles       = flag.String("roles", "", "Comma separated IDs of the member's roles")
+)
+
+const usage = `Usage: simulate [flags] <command> [subcommand group] [subcommand] [name[:type]=value ...]
+
+Options are strings unless a type is given, which may be string, int, bool or user, such as months:int=12.
+
+Flags:
+`
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if *generateKey {
+		publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			panic(err)
+		}
+
+		fmt.Printf("Public key (DISCORD_PUBLIC_KEY): %s\n", hex.EncodeToString(publicKey))
+		fmt.Printf("Private key (-private-key):      %s\n", hex.EncodeToString(privateKey.Seed()))
+		return
+	}
+
+	i, err := buildInteraction(flag.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n\n", err)
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	seed, err := hex.DecodeString(*privateKey)
+	if err != nil || len(seed) != ed25519.SeedSize {
+		fmt.Fprintf(os.Stderr, "-private-key must be a hex encoded %d byte seed\n", ed25519.SeedSize)
+		os.Exit(2)
+	}
+
+	if err := send(interactiontest.NewWithKey(ed25519.NewKeyFromSeed(seed)), i); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// buildInteraction parses the command path and options, and applies the guild, user and roles
+func buildInteraction(args []string) (interactiontest.Interaction, error) {
+	var path []string
+	var options []interactiontest.Option
+	for _, arg := range args {
+		if !strings.Contains(arg, "=") {
+			if len(options) > 0 {
+				return interactiontest.Interaction{}, fmt.Errorf("%q must come before the options", arg)
+			}
+
+			path = append(path, arg)
+			continue
+		}
+
+		option, err := parseOption(arg)
+		if err != nil {
+			return interactiontest.Interaction{}, err
+		}
+
+		options = append(options, option)
+	}
+
+	if len(path) == 0 || len(path) > 3 {
+		return interactiontest.Interaction{}, errors.New("a command, with up to a subcommand group and subcommand, is required")
+	}
+
+	// Options belong to the innermost subcommand, which belongs to the group, if any
+	if len(path) > 1 {
+		options = []interactiontest.Option{interactiontest.Subcommand(path[len(path)-1], options...)}
+		if len(path) == 3 {
+			options = []interactiontest.Option{interactiontest.SubcommandGroup(path[1], options...)}
+		}
+	}
+
+	i := interactiontest.Command(path[0], options...).As(*userId, *permissions)
+	if *dm {
+		i = i.InDM()
+	} else {
+		i = i.InGuild(*guildId)
+	}
+
+	if *roles != "" {
+		for _, raw := range strings.Split(*roles, ",") {
+			roleId, err := strconv.ParseUint(strings.TrimSpace(raw), 10, 64)
+			if err != nil {
+				return interactiontest.Interaction{}, fmt.Errorf("invalid role ID %q", raw)
+			}
+
+			i.Roles = append(i.Roles, roleId)
+		}
+	}
+
+	return i, nil
+}
+
+// parseOption parses an option in the form name[:type]=value
+func parseOption(arg string) (interactiontest.Option, error) {
+	key, value, _ := strings.Cut(arg, "=")
+	name, optionType, _ := strings.Cut(key, ":")
+
+	switch optionType {
+	case "", "string":
+		return interactiontest.String(name, value), nil
+	case "int":
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return interactiontest.Option{}, fmt.Errorf("option %s must be an integer", name)
+		}
+
+		return interactiontest.Integer(name, parsed), nil
+	case "bool":
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return interactiontest.Option{}, fmt.Errorf("option %s must be true or false", name)
+		}
+
+		return interactiontest.Boolean(name, parsed), nil
+	case "user":
+		parsed, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return interactiontest.Option{}, fmt.Errorf("option %s must be a user ID", name)
+		}
+
+		return interactiontest.User(name, parsed), nil
+	default:
+		return interactiontest.Option{}, fmt.Errorf("option %s has unknown type %q", name, optionType)
+	}
+}
+
+// send signs and posts the interaction, then prints the response
+func send(harness *interactiontest.Harness, i interactiontest.Interaction) error {
+	body := harness.Encode(i)
+	timestamp, signature := harness.Sign(body)
+
+	req, err := http.NewRequest(http.MethodPost, *baseUrl+"/interaction", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Signature-Timestamp", timestamp)
+	req.Header.Set("X-Signature-Ed25519", signature)
+
+	client := &http.Client{Timeout: time.Second * 30}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	content, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("interaction returned %d status code: %s", res.StatusCode, content)
+	}
+
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, content, "", "  "); err != nil {
+		return fmt.Errorf("response is not JSON: %s", content)
+	}
+
+	fmt.Println(indented.String())
+	return nil
+}
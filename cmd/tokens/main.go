@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/TicketsBot/subscriptions-app/internal/clock"
+	"github.com/TicketsBot/subscriptions-app/internal/config"
+	"github.com/TicketsBot/subscriptions-app/internal/database"
+	"github.com/TicketsBot/subscriptions-app/internal/secrets"
+	"github.com/TicketsBot/subscriptions-app/internal/store"
+	"github.com/TicketsBot/subscriptions-app/pkg/patreon"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"go.uber.org/zap"
+
+	_ "github.com/joho/godotenv/autoload"
+)
+
+// consentTimeout is how long to wait for the creator to consent before giving up
+const consentTimeout = time.Minute * 10
+
+const usage = `Usage: tokens <command> [flags]
+
+Commands:
+  bootstrap  Run the Patreon OAuth flow and store the resulting tokens
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	switch os.Args[1] {
+	case "bootstrap":
+		if err := bootstrap(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to bootstrap tokens: %s\n", err)
+			os.Exit(1)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+}
+
+// bootstrap prints the consent URL, waits for Patreon to redirect back to a temporary local server with a code, then
+// exchanges the code for tokens and stores them in patreon_keys, replacing any tokens already stored for the client
+func bootstrap(args []string) error {
+	flags := flag.NewFlagSet("bootstrap", flag.ExitOnError)
+	port := flags.Int("port", 8085, "Local port to receive the callback on. The redirect URI must be registered with the Patreon client.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	conf, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), consentTimeout)
+	defer cancel()
+
+	pool, err := pgxpool.Connect(ctx, fmt.Sprintf(
+		"postgres://%s:%s@%s/%s",
+		conf.Database.Username,
+		conf.Database.Password,
+		conf.Database.Host,
+		conf.Database.Database,
+	))
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	defer pool.Close()
+
+	db := database.NewDatabase(pool)
+	if err := db.CreateTables(ctx); err != nil {
+		return err
+	}
+
+	logger, err := zap.NewDevelopment(zap.IncreaseLevel(zap.WarnLevel))
+	if err != nil {
+		return err
+	}
+
+	client := patreon.NewClient(conf, logger, store.NewPostgres(db), nil, clock.Real)
+	if client == nil {
+		return errors.New("failed to read Patreon tokens from the database")
+	}
+
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", *port))
+	if err != nil {
+		return err
+	}
+
+	state, err := randomState()
+	if err != nil {
+		return err
+	}
+
+	redirectUri := fmt.Sprintf("http://localhost:%d/callback", *port)
+	callbacks := make(chan callback, 1)
+
+	server := &http.Server{
+		Handler:           callbackHandler(state, callbacks),
+		ReadHeaderTimeout: time.Second * 10,
+	}
+
+	go server.Serve(listener)
+	defer server.Close()
+
+	fmt.Printf("Make sure %s is a redirect URI of the Patreon client, then open this URL as the campaign's creator:\n\n%s\n\n", redirectUri, patreon.AuthorizeUrl(conf, redirectUri, state))
+
+	var result callback
+	select {
+	case result = <-callbacks:
+	case <-ctx.Done():
+		return errors.New("timed out waiting for consent")
+	}
+
+	if result.err != nil {
+		return result.err
+	}
+
+	if err := client.ExchangeCode(ctx, result.code, redirectUri); err != nil {
+		return err
+	}
+
+	fmt.Printf("Stored tokens for client %s, which expire at %s\n", conf.Patreon.ClientId, client.Tokens().ExpiresAt.Format(time.RFC3339))
+	return nil
+}
+
+// callback is the outcome of consenting: either a code, or why consent failed
+type callback struct {
+	code string
+	err  error
+}
+
+// callbackHandler receives the redirect from the consent page. Only the first callback is sent, as the code can only be
+// exchanged once.
+func callbackHandler(state string, callbacks chan<- callback) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /callback", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		// The state is checked so that only the redirect from our consent URL is accepted
+		if query.Get("state") != state {
+			http.Error(w, "Invalid state", http.StatusBadRequest)
+			return
+		}
+
+		if reason := query.Get("error"); reason != "" {
+			http.Error(w, "Consent was not given, check the terminal", http.StatusBadRequest)
+			trySend(callbacks, callback{err: fmt.Errorf("consent was not given: %s", reason)})
+			return
+		}
+
+		code := query.Get("code")
+		if code == "" {
+			http.Error(w, "Missing code", http.StatusBadRequest)
+			return
+		}
+
+		fmt.Fprintln(w, "Consent received, you can close this tab and return to the terminal")
+		trySend(callbacks, callback{code: code})
+	})
+
+	return mux
+}
+
+func trySend(callbacks chan<- callback, result callback) {
+	select {
+	case callbacks <- result:
+	default:
+	}
+}
+
+func randomState() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(buf), nil
+}
+
+func loadConfig() (config.Config, error) {
+	conf, err := config.LoadConfig()
+	if err != nil {
+		return config.Config{}, err
+	}
+
+	// The client secret may be a reference to a secret manager
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	if err := secrets.ResolveConfig(ctx, &conf); err != nil {
+		return config.Config{}, err
+	}
+
+	return conf, nil
+}
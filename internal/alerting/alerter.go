@@ -0,0 +1,207 @@
+package alerting
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/TicketsBot-cloud/gdl/objects/channel/embed"
+	"github.com/TicketsBot/subscriptions-app/internal/clock"
+	"github.com/TicketsBot/subscriptions-app/internal/config"
+	"go.uber.org/zap"
+)
+
+const (
+	red    = 0xeb4034
+	orange = 0xf5a442
+	green  = 0x42f55a
+)
+
+// Alerter posts to a Discord webhook when the Patreon sync needs attention. Each condition is only alerted once until
+// it clears, so that a persistent failure does not post every minute.
+type Alerter struct {
+	config     config.Config
+	logger     *zap.Logger
+	clock      clock.Clock
+	httpClient *http.Client
+
+	mu                  sync.Mutex
+	consecutiveFailures int
+	failureAlerted      bool
+	expiryAlertedFor    time.Time
+	expiredAlertedFor   time.Time
+}
+
+func NewAlerter(config config.Config, logger *zap.Logger, clk clock.Clock) *Alerter {
+	return &Alerter{
+		config:     config,
+		logger:     logger,
+		clock:      clk,
+		httpClient: &http.Client{Timeout: time.Second * 10},
+	}
+}
+
+func (a *Alerter) Enabled() bool {
+	return a.config.Alerting.WebhookUrl != ""
+}
+
+// SyncFailed records a failed sync, alerting once the configured number of consecutive failures is reached
+func (a *Alerter) SyncFailed(ctx context.Context, err error) {
+	a.mu.Lock()
+	a.consecutiveFailures++
+	failures := a.consecutiveFailures
+	shouldAlert := !a.failureAlerted && failures >= a.failureThreshold()
+	if shouldAlert {
+		a.failureAlerted = true
+	}
+	a.mu.Unlock()
+
+	if shouldAlert {
+		a.send(ctx, &embed.Embed{
+			Title:       "Patreon Sync Failing",
+			Description: fmt.Sprintf("The last %d syncs have failed. Pledge data will be stale until this is resolved.\n```%s```", failures, err.Error()),
+			Color:       red,
+		})
+	}
+}
+
+// SyncSucceeded resets the failure count, posting a recovery message if a failure alert had been sent
+func (a *Alerter) SyncSucceeded(ctx context.Context) {
+	a.mu.Lock()
+	recovered := a.failureAlerted
+	failures := a.consecutiveFailures
+	a.consecutiveFailures = 0
+	a.failureAlerted = false
+	a.mu.Unlock()
+
+	if recovered {
+		a.send(ctx, &embed.Embed{
+			Title:       "Patreon Sync Recovered",
+			Description: fmt.Sprintf("Pledges synced successfully after %d failed attempts.", failures),
+			Color:       green,
+		})
+	}
+}
+
+// TokenExpiring alerts if the refresh token expires within the next 24 hours, meaning that refreshing it has not
+// succeeded
+func (a *Alerter) TokenExpiring(ctx context.Context, expiresAt time.Time) {
+	if clock.Until(a.clock, expiresAt) > time.Hour*24 {
+		return
+	}
+
+	a.mu.Lock()
+	shouldAlert := !a.expiryAlertedFor.Equal(expiresAt)
+	a.expiryAlertedFor = expiresAt
+	a.mu.Unlock()
+
+	if shouldAlert {
+		a.send(ctx, &embed.Embed{
+			Title:       "Patreon Token Expiring",
+			Description: fmt.Sprintf("The Patreon refresh token expires <t:%d:R> and could not be refreshed. Syncing will stop once it expires.", expiresAt.Unix()),
+			Color:       orange,
+		})
+	}
+}
+
+// TokenExpired alerts that the refresh token has expired, returning whether this is the first time it was reported
+func (a *Alerter) TokenExpired(ctx context.Context, expiredAt time.Time) bool {
+	a.mu.Lock()
+	shouldAlert := !a.expiredAlertedFor.Equal(expiredAt)
+	a.expiredAlertedFor = expiredAt
+	a.mu.Unlock()
+
+	if shouldAlert {
+		// Mentions @here, as syncing is stopped until someone replaces the token
+		a.post(ctx, "@here", &embed.Embed{
+			Title:       "Patreon Token Expired",
+			Description: fmt.Sprintf("The Patreon refresh token expired <t:%d:R>. The app is degraded, serving the last synced pledges, and pledges will not be synced until new credentials are stored with `go run ./cmd/tokens bootstrap`. They are picked up on the next sync, without a restart.", expiredAt.Unix()),
+			Color:       red,
+		})
+	}
+
+	return shouldAlert
+}
+
+// TokenRecovered posts that tokens stored after the refresh token expired have been picked up, and syncing has resumed
+func (a *Alerter) TokenRecovered(ctx context.Context, expiresAt time.Time) {
+	a.mu.Lock()
+	a.expiredAlertedFor = time.Time{}
+	a.mu.Unlock()
+
+	a.send(ctx, &embed.Embed{
+		Title:       "Patreon Token Recovered",
+		Description: fmt.Sprintf("New Patreon credentials were found in the database, expiring <t:%d:R>. Pledges are syncing again.", expiresAt.Unix()),
+		Color:       green,
+	})
+}
+
+func (a *Alerter) failureThreshold() int {
+	if a.config.Alerting.FailureThreshold <= 0 {
+		return 3
+	}
+
+	return a.config.Alerting.FailureThreshold
+}
+
+func (a *Alerter) send(ctx context.Context, e *embed.Embed) {
+	a.post(ctx, "", e)
+}
+
+// post sends the embed with a message, which may mention @here
+func (a *Alerter) post(ctx context.Context, content string, e *embed.Embed) {
+	if !a.Enabled() {
+		return
+	}
+
+	e.Timestamp = ptr(a.clock.Now())
+
+	payload := map[string]any{
+		"username": "Subscriptions App",
+		"embeds":   []*embed.Embed{e},
+	}
+
+	if content != "" {
+		payload["content"] = content
+		payload["allowed_mentions"] = map[string]any{"parse": []string{"everyone"}}
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		a.logger.Error("Failed to encode alert", zap.Error(err))
+		return
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.config.Alerting.WebhookUrl, bytes.NewReader(body))
+	if err != nil {
+		a.logger.Error("Failed to create alert request", zap.Error(err))
+		return
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := a.httpClient.Do(req)
+	if err != nil {
+		a.logger.Error("Failed to send alert", zap.String("title", e.Title), zap.Error(err))
+		return
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		body, _ := io.ReadAll(res.Body)
+		a.logger.Error("Alert webhook returned error", zap.String("title", e.Title), zap.Int("status_code", res.StatusCode), zap.String("body", string(body)))
+		return
+	}
+
+	a.logger.Info("Alert sent", zap.String("title", e.Title))
+}
+
+func ptr[T any](value T) *T {
+	return &value
+}
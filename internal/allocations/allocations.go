@@ -0,0 +1,162 @@
+package allocations
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/TicketsBot/subscriptions-app/internal/database"
+	"github.com/TicketsBot/subscriptions-app/internal/entitlements"
+)
+
+var ErrNotEntitled = errors.New("user has no active entitlements")
+
+// Entitlements looks up a user's entitlements from every provider
+type Entitlements interface {
+	ByDiscordId(ctx context.Context, discordId uint64) ([]entitlements.Entitlement, error)
+}
+
+// Service lets users allocate their premium to Discord guilds, up to the limit of their best active tier
+type Service struct {
+	db           *database.Database
+	entitlements Entitlements
+}
+
+// GuildStatus is the premium status of a guild
+type GuildStatus struct {
+	GuildId   uint64     `json:"guild_id,string"`
+	Premium   bool       `json:"premium"`
+	Tiers     []string   `json:"tiers"`      // The active tiers of the users that allocated the guild
+	ExpiresAt *time.Time `json:"expires_at"` // The latest premium_expires_at of those tiers, unset if one doesn't expire
+}
+
+func NewService(db *database.Database, entitlements Entitlements) *Service {
+	return &Service{
+		db:           db,
+		entitlements: entitlements,
+	}
+}
+
+// Limit returns how many guilds the user can allocate premium to, which is 0 if they have no active entitlements
+func (s *Service) Limit(ctx context.Context, discordId uint64) (int, error) {
+	active, err := s.activeEntitlements(ctx, discordId)
+	if err != nil {
+		return 0, err
+	}
+
+	return limitOf(active), nil
+}
+
+func limitOf(active []entitlements.Entitlement) int {
+	limit := 0
+	for _, entitlement := range active {
+		limit = max(limit, entitlement.MaxGuilds)
+	}
+
+	return limit
+}
+
+// Assign allocates the user's premium to the guild, returning the user's limit
+func (s *Service) Assign(ctx context.Context, discordId, guildId uint64) (int, error) {
+	limit, err := s.Limit(ctx, discordId)
+	if err != nil {
+		return 0, err
+	}
+
+	if limit == 0 {
+		return 0, ErrNotEntitled
+	}
+
+	return limit, s.db.GuildAllocations.Allocate(ctx, guildId, discordId, limit)
+}
+
+// Remove deallocates the user's premium from the guild, returning false if it was not allocated
+func (s *Service) Remove(ctx context.Context, discordId, guildId uint64) (bool, error) {
+	return s.db.GuildAllocations.Remove(ctx, guildId, discordId)
+}
+
+// Status returns whether the guild has premium. Each allocating user's allocations only count up to their current
+// limit, oldest first, so a user who downgrades keeps premium in the guilds they allocated first.
+func (s *Service) Status(ctx context.Context, guildId uint64) (GuildStatus, error) {
+	status := GuildStatus{
+		GuildId: guildId,
+		Tiers:   []string{},
+	}
+
+	allocations, err := s.db.GuildAllocations.GetByGuild(ctx, guildId)
+	if err != nil {
+		return GuildStatus{}, err
+	}
+
+	seenTiers := make(map[string]struct{})
+	var latestExpiry *time.Time
+	var neverExpires bool
+	for _, allocation := range allocations {
+		active, err := s.activeEntitlements(ctx, allocation.DiscordId)
+		if err != nil {
+			return GuildStatus{}, err
+		}
+
+		if counted, err := s.isWithinLimit(ctx, allocation, limitOf(active)); err != nil {
+			return GuildStatus{}, err
+		} else if !counted {
+			continue
+		}
+
+		for _, entitlement := range active {
+			if _, ok := seenTiers[entitlement.Tier]; !ok {
+				seenTiers[entitlement.Tier] = struct{}{}
+				status.Tiers = append(status.Tiers, entitlement.Tier)
+			}
+
+			if entitlement.PremiumExpiresAt == nil {
+				neverExpires = true
+			} else if latestExpiry == nil || entitlement.PremiumExpiresAt.After(*latestExpiry) {
+				latestExpiry = entitlement.PremiumExpiresAt
+			}
+
+			status.Premium = true
+		}
+	}
+
+	if !neverExpires {
+		status.ExpiresAt = latestExpiry
+	}
+
+	return status, nil
+}
+
+func (s *Service) isWithinLimit(ctx context.Context, allocation database.GuildAllocation, limit int) (bool, error) {
+	if limit == 0 {
+		return false, nil
+	}
+
+	userAllocations, err := s.db.GuildAllocations.GetByUser(ctx, allocation.DiscordId)
+	if err != nil {
+		return false, err
+	}
+
+	for i, userAllocation := range userAllocations {
+		if userAllocation.GuildId == allocation.GuildId {
+			return i < limit, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (s *Service) activeEntitlements(ctx context.Context, discordId uint64) ([]entitlements.Entitlement, error) {
+	all, err := s.entitlements.ByDiscordId(ctx, discordId)
+	if err != nil {
+		return nil, err
+	}
+
+	var active []entitlements.Entitlement
+	for _, entitlement := range all {
+		if entitlement.Active {
+			active = append(active, entitlement)
+		}
+	}
+
+	return active, nil
+}
@@ -0,0 +1,231 @@
+package analytics
+
+import (
+	"context"
+	"time"
+
+	"github.com/TicketsBot/subscriptions-app/internal/config"
+	"github.com/TicketsBot/subscriptions-app/internal/database"
+	"github.com/TicketsBot/subscriptions-app/internal/events"
+	"github.com/TicketsBot/subscriptions-app/pkg/patreon"
+)
+
+const monthFormat = "2006-01"
+
+// Patrons provides the current Patreon snapshot
+type Patrons interface {
+	Loaded() bool
+	ActivePatrons() int
+	ActivePledges() []patreon.Patron
+}
+
+// TierRegistry provides the tier metadata used to name and value tiers
+type TierRegistry interface {
+	Tier(tierId uint64) (config.Tier, bool)
+}
+
+// Converter converts amounts pledged in other currencies to the currency that revenue is reported in
+type Converter interface {
+	ToBase(cents int, currency string) int
+}
+
+// Service computes reports over the patron history table
+type Service struct {
+	db        *database.Database
+	patrons   Patrons
+	tiers     TierRegistry
+	converter Converter
+}
+
+// ChurnReport covers the calendar months (UTC) up to and including the current one
+type ChurnReport struct {
+	GeneratedAt   time.Time      `json:"generated_at"`
+	ActivePatrons int            `json:"active_patrons"`
+	Months        []MonthlyChurn `json:"months"`
+	Cohorts       []Cohort       `json:"cohorts"`
+
+	// The average time between a patron pledging and cancelling, of the patrons that did both within the report. Unset
+	// if there are no such patrons.
+	AverageLifetimeDays *float64 `json:"average_lifetime_days"`
+}
+
+type MonthlyChurn struct {
+	Month         string  `json:"month"`
+	ActiveAtStart int     `json:"active_at_start"`
+	New           int     `json:"new"`
+	Cancelled     int     `json:"cancelled"`
+	ChurnRate     float64 `json:"churn_rate"` // Cancelled / ActiveAtStart
+}
+
+// Cohort is the patrons that first pledged in a month
+type Cohort struct {
+	Month string `json:"month"`
+	Size  int    `json:"size"`
+
+	// The fraction of the cohort still pledging at the end of each month, starting with the month they joined. Only
+	// months that have ended are included.
+	Retention []float64 `json:"retention"`
+}
+
+func NewService(db *database.Database, patrons Patrons, tiers TierRegistry, converter Converter) *Service {
+	return &Service{
+		db:        db,
+		patrons:   patrons,
+		tiers:     tiers,
+		converter: converter,
+	}
+}
+
+// Churn builds a report over the given number of months. History is only kept for the retention period, so older
+// months are incomplete.
+func (s *Service) Churn(ctx context.Context, months int) (ChurnReport, error) {
+	now := time.Now().UTC()
+	start := monthStart(now).AddDate(0, 1-months, 0)
+
+	entries, err := s.db.PatronHistory.GetByEvents(ctx, []string{string(events.TypeNew), string(events.TypeCancel)}, start)
+	if err != nil {
+		return ChurnReport{}, err
+	}
+
+	return churnReport(entries, s.patrons.ActivePatrons(), start, now), nil
+}
+
+type membership struct {
+	patronId    uint64
+	joinedAt    time.Time
+	cancelledAt *time.Time
+}
+
+// churnReport expects entries to be ordered by when they took effect
+func churnReport(entries []database.PatronHistoryEntry, active int, start, now time.Time) ChurnReport {
+	report := ChurnReport{
+		GeneratedAt:   now,
+		ActivePatrons: active,
+	}
+
+	index := make(map[string]int)
+	for month := start; !month.After(now); month = month.AddDate(0, 1, 0) {
+		index[month.Format(monthFormat)] = len(report.Months)
+		report.Months = append(report.Months, MonthlyChurn{Month: month.Format(monthFormat)})
+	}
+
+	// A patron that cancels and pledges again starts a new membership, but stays in the cohort of their first pledge
+	var memberships []membership
+	open := make(map[uint64]int)
+
+	for _, entry := range entries {
+		effectiveAt := effectiveAt(entry)
+		i, ok := index[effectiveAt.Format(monthFormat)]
+		if !ok {
+			continue
+		}
+
+		switch events.Type(entry.Event) {
+		case events.TypeNew:
+			report.Months[i].New++
+
+			if _, ok := open[entry.PatronId]; !ok {
+				open[entry.PatronId] = len(memberships)
+				memberships = append(memberships, membership{patronId: entry.PatronId, joinedAt: effectiveAt})
+			}
+		case events.TypeCancel:
+			report.Months[i].Cancelled++
+
+			if m, ok := open[entry.PatronId]; ok {
+				memberships[m].cancelledAt = &effectiveAt
+				delete(open, entry.PatronId)
+			}
+		}
+	}
+
+	// Work backwards from the current snapshot to find how many patrons were active at the start of each month
+	activeAtEnd := active
+	for i := len(report.Months) - 1; i >= 0; i-- {
+		month := &report.Months[i]
+		month.ActiveAtStart = max(activeAtEnd-month.New+month.Cancelled, 0)
+		if month.ActiveAtStart > 0 {
+			month.ChurnRate = float64(month.Cancelled) / float64(month.ActiveAtStart)
+		}
+
+		activeAtEnd = month.ActiveAtStart
+	}
+
+	report.AverageLifetimeDays = averageLifetimeDays(memberships)
+	report.Cohorts = buildCohorts(report.Months, memberships, now)
+
+	return report
+}
+
+func averageLifetimeDays(memberships []membership) *float64 {
+	var total time.Duration
+	var count int
+	for _, m := range memberships {
+		if m.cancelledAt != nil {
+			total += m.cancelledAt.Sub(m.joinedAt)
+			count++
+		}
+	}
+
+	if count == 0 {
+		return nil
+	}
+
+	days := total.Hours() / 24 / float64(count)
+	return &days
+}
+
+// buildCohorts expects memberships to be ordered by when they started
+func buildCohorts(months []MonthlyChurn, memberships []membership, now time.Time) []Cohort {
+	// Only the first membership of each patron counts towards their cohort's retention
+	seen := make(map[uint64]bool)
+	members := make(map[string][]membership)
+	for _, m := range memberships {
+		if !seen[m.patronId] {
+			seen[m.patronId] = true
+			month := m.joinedAt.Format(monthFormat)
+			members[month] = append(members[month], m)
+		}
+	}
+
+	cohorts := make([]Cohort, 0, len(months))
+	for _, month := range months {
+		cohort := Cohort{
+			Month:     month.Month,
+			Size:      len(members[month.Month]),
+			Retention: []float64{},
+		}
+
+		if cohort.Size == 0 {
+			cohorts = append(cohorts, cohort)
+			continue
+		}
+
+		start, _ := time.Parse(monthFormat, month.Month)
+		for end := start.AddDate(0, 1, 0); !end.After(now); end = end.AddDate(0, 1, 0) {
+			retained := 0
+			for _, m := range members[month.Month] {
+				if m.cancelledAt == nil || !m.cancelledAt.Before(end) {
+					retained++
+				}
+			}
+
+			cohort.Retention = append(cohort.Retention, float64(retained)/float64(cohort.Size))
+		}
+
+		cohorts = append(cohorts, cohort)
+	}
+
+	return cohorts
+}
+
+func effectiveAt(entry database.PatronHistoryEntry) time.Time {
+	if entry.EffectiveAt != nil {
+		return entry.EffectiveAt.UTC()
+	}
+
+	return entry.CreatedAt.UTC()
+}
+
+func monthStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
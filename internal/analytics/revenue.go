@@ -0,0 +1,226 @@
+package analytics
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/TicketsBot/subscriptions-app/internal/database"
+	"github.com/TicketsBot/subscriptions-app/internal/events"
+	"github.com/TicketsBot/subscriptions-app/pkg/patreon"
+	"github.com/pkg/errors"
+)
+
+// RevenueReport is the monthly recurring revenue (MRR) from Patreon, in Currency
+type RevenueReport struct {
+	GeneratedAt time.Time        `json:"generated_at"`
+	Currency    string           `json:"currency"`
+	MrrCents    int              `json:"mrr_cents"`
+	ByTier      []TierRevenue    `json:"by_tier"`
+	Months      []MonthlyRevenue `json:"months"`
+}
+
+type TierRevenue struct {
+	TierId   uint64 `json:"tier_id,string"`
+	Name     string `json:"name"`
+	Patrons  int    `json:"patrons"`
+	MrrCents int    `json:"mrr_cents"`
+}
+
+// MonthlyRevenue breaks down how MRR moved during a month
+type MonthlyRevenue struct {
+	Month            string  `json:"month"`
+	StartMrrCents    int     `json:"start_mrr_cents"`
+	NewCents         int     `json:"new_cents"`         // From patrons that pledged
+	ExpansionCents   int     `json:"expansion_cents"`   // From patrons that moved to tiers worth more
+	ContractionCents int     `json:"contraction_cents"` // From patrons that moved to tiers worth less
+	ChurnedCents     int     `json:"churned_cents"`     // From patrons that cancelled
+	EndMrrCents      int     `json:"end_mrr_cents"`
+	ChangeRate       float64 `json:"change_rate"` // (EndMrrCents - StartMrrCents) / StartMrrCents
+}
+
+// Revenue builds a report over the given number of months. The current MRR and revenue by tier come from the Patreon
+// snapshot, and the MRR of previous months is worked out backwards from the patron events.
+func (s *Service) Revenue(ctx context.Context, months int, currency string) (RevenueReport, error) {
+	now := time.Now().UTC()
+	start := monthStart(now).AddDate(0, 1-months, 0)
+
+	types := append([]string{string(events.TypeNew), string(events.TypeCancel)}, events.TierChangeTypes()...)
+	entries, err := s.db.PatronHistory.GetByEvents(ctx, types, start)
+	if err != nil {
+		return RevenueReport{}, err
+	}
+
+	return s.revenueReport(entries, s.patrons.ActivePledges(), start, now, currency)
+}
+
+func (s *Service) revenueReport(
+	entries []database.PatronHistoryEntry,
+	pledges []patreon.Patron,
+	start, now time.Time,
+	currency string,
+) (RevenueReport, error) {
+	report := RevenueReport{
+		GeneratedAt: now,
+		Currency:    currency,
+	}
+
+	byTier := make(map[uint64]*TierRevenue)
+	for _, patron := range pledges {
+		amount := s.amountCents(patron.CurrentlyEntitledAmountCents, patron.Currency, patron.Tiers)
+		report.MrrCents += amount
+
+		for tierId, share := range s.splitByTier(amount, patron.Tiers) {
+			revenue, ok := byTier[tierId]
+			if !ok {
+				revenue = &TierRevenue{TierId: tierId}
+				if tier, ok := s.tiers.Tier(tierId); ok {
+					revenue.Name = tier.Name
+				}
+
+				byTier[tierId] = revenue
+			}
+
+			revenue.Patrons++
+			revenue.MrrCents += share
+		}
+	}
+
+	report.ByTier = make([]TierRevenue, 0, len(byTier))
+	for _, revenue := range byTier {
+		report.ByTier = append(report.ByTier, *revenue)
+	}
+
+	slices.SortFunc(report.ByTier, func(a, b TierRevenue) int {
+		return b.MrrCents - a.MrrCents
+	})
+
+	index := make(map[string]int)
+	for month := start; !month.After(now); month = month.AddDate(0, 1, 0) {
+		index[month.Format(monthFormat)] = len(report.Months)
+		report.Months = append(report.Months, MonthlyRevenue{Month: month.Format(monthFormat)})
+	}
+
+	for _, entry := range entries {
+		i, ok := index[effectiveAt(entry).Format(monthFormat)]
+		if !ok {
+			continue
+		}
+
+		previous, current, err := s.eventAmounts(entry)
+		if err != nil {
+			return RevenueReport{}, err
+		}
+
+		month := &report.Months[i]
+		switch events.Type(entry.Event) {
+		case events.TypeNew:
+			month.NewCents += current
+		case events.TypeCancel:
+			month.ChurnedCents += previous
+		default:
+			if current > previous {
+				month.ExpansionCents += current - previous
+			} else {
+				month.ContractionCents += previous - current
+			}
+		}
+	}
+
+	// Work backwards from the current snapshot to find the MRR at the start of each month
+	endMrr := report.MrrCents
+	for i := len(report.Months) - 1; i >= 0; i-- {
+		month := &report.Months[i]
+		month.EndMrrCents = endMrr
+		month.StartMrrCents = max(endMrr-month.NewCents-month.ExpansionCents+month.ContractionCents+month.ChurnedCents, 0)
+		if month.StartMrrCents > 0 {
+			month.ChangeRate = float64(month.EndMrrCents-month.StartMrrCents) / float64(month.StartMrrCents)
+		}
+
+		endMrr = month.StartMrrCents
+	}
+
+	return report, nil
+}
+
+// eventAmounts returns the amounts the patron was pledging before and after the event
+func (s *Service) eventAmounts(entry database.PatronHistoryEntry) (previous, current int, err error) {
+	var event events.Event
+	if err := json.Unmarshal(entry.Details, &event); err != nil {
+		return 0, 0, errors.Wrapf(err, "failed to decode patron history entry %d", entry.Id)
+	}
+
+	return s.amountCents(event.PreviousAmountCents, event.Currency, event.PreviousTiers), s.amountCents(event.AmountCents, event.Currency, event.Tiers), nil
+}
+
+// amountCents converts the amount from the patron's currency to the campaign currency. It falls back to the prices of
+// the tiers if Patreon didn't report the amount, such as for events recorded before amounts were tracked.
+func (s *Service) amountCents(amount int, currency string, tierIds []uint64) int {
+	if amount > 0 {
+		return s.converter.ToBase(amount, currency)
+	}
+
+	total := 0
+	for _, tierId := range tierIds {
+		tier, _ := s.tiers.Tier(tierId)
+		total += tier.PriceCents
+	}
+
+	return total
+}
+
+// splitByTier divides a patron's amount between their tiers in proportion to the tier prices, or evenly if the prices
+// aren't configured
+func (s *Service) splitByTier(amount int, tierIds []uint64) map[uint64]int {
+	prices := make(map[uint64]int, len(tierIds))
+	total := 0
+	for _, tierId := range tierIds {
+		tier, _ := s.tiers.Tier(tierId)
+		prices[tierId] = tier.PriceCents
+		total += tier.PriceCents
+	}
+
+	shares := make(map[uint64]int, len(prices))
+	for tierId, price := range prices {
+		if total > 0 {
+			shares[tierId] = amount * price / total
+		} else {
+			shares[tierId] = amount / len(prices)
+		}
+	}
+
+	return shares
+}
+
+// Convert returns a copy of the report with every amount multiplied by rate, the units of currency per unit of the
+// report's currency
+func (r RevenueReport) Convert(currency string, rate float64) RevenueReport {
+	convert := func(cents int) int {
+		return int(math.Round(float64(cents) * rate))
+	}
+
+	converted := r
+	converted.Currency = currency
+	converted.MrrCents = convert(r.MrrCents)
+
+	converted.ByTier = make([]TierRevenue, len(r.ByTier))
+	for i, tier := range r.ByTier {
+		tier.MrrCents = convert(tier.MrrCents)
+		converted.ByTier[i] = tier
+	}
+
+	converted.Months = make([]MonthlyRevenue, len(r.Months))
+	for i, month := range r.Months {
+		month.StartMrrCents = convert(month.StartMrrCents)
+		month.NewCents = convert(month.NewCents)
+		month.ExpansionCents = convert(month.ExpansionCents)
+		month.ContractionCents = convert(month.ContractionCents)
+		month.ChurnedCents = convert(month.ChurnedCents)
+		month.EndMrrCents = convert(month.EndMrrCents)
+		converted.Months[i] = month
+	}
+
+	return converted
+}
@@ -0,0 +1,80 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/TicketsBot/subscriptions-app/internal/events"
+	"github.com/TicketsBot/subscriptions-app/pkg/patreon"
+)
+
+var ErrNotLoaded = errors.New("the Patreon snapshot has not been loaded yet")
+
+// Summary is the activity over a period, for digests
+type Summary struct {
+	Start         time.Time
+	End           time.Time
+	New           int
+	Cancelled     int
+	StartMrrCents int
+	EndMrrCents   int
+
+	// Declined is the active patrons whose last charge was declined, who may need following up on before Patreon
+	// removes their tiers
+	Declined []patreon.Patron
+}
+
+// Summary summarises the period from start to end, which should not be in the future
+func (s *Service) Summary(ctx context.Context, start, end time.Time) (Summary, error) {
+	if !s.patrons.Loaded() {
+		return Summary{}, ErrNotLoaded
+	}
+
+	types := append([]string{string(events.TypeNew), string(events.TypeCancel)}, events.TierChangeTypes()...)
+	entries, err := s.db.PatronHistory.GetByEvents(ctx, types, start)
+	if err != nil {
+		return Summary{}, err
+	}
+
+	summary := Summary{
+		Start: start,
+		End:   end,
+	}
+
+	currentMrr := 0
+	for _, patron := range s.patrons.ActivePledges() {
+		currentMrr += s.amountCents(patron.CurrentlyEntitledAmountCents, patron.Currency, patron.Tiers)
+
+		if patron.LastChargeStatus == "Declined" {
+			summary.Declined = append(summary.Declined, patron)
+		}
+	}
+
+	// Work backwards from the current MRR, undoing the changes since the start and end of the period
+	summary.StartMrrCents, summary.EndMrrCents = currentMrr, currentMrr
+	for _, entry := range entries {
+		previous, current, err := s.eventAmounts(entry)
+		if err != nil {
+			return Summary{}, err
+		}
+
+		summary.StartMrrCents -= current - previous
+
+		if effectiveAt(entry).Before(end) {
+			switch events.Type(entry.Event) {
+			case events.TypeNew:
+				summary.New++
+			case events.TypeCancel:
+				summary.Cancelled++
+			}
+		} else {
+			summary.EndMrrCents -= current - previous
+		}
+	}
+
+	summary.StartMrrCents = max(summary.StartMrrCents, 0)
+	summary.EndMrrCents = max(summary.EndMrrCents, 0)
+
+	return summary, nil
+}
@@ -0,0 +1,450 @@
+// Package app wires the subsystems together. Each subsystem is built by its own constructor and depends on the others
+// through interfaces, so that it can be composed differently, for example serving generated patrons in demo mode, and
+// tested in isolation. Background components can be disabled through config.
+package app
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/TicketsBot/subscriptions-app/internal/alerting"
+	"github.com/TicketsBot/subscriptions-app/internal/allocations"
+	"github.com/TicketsBot/subscriptions-app/internal/analytics"
+	"github.com/TicketsBot/subscriptions-app/internal/bridge"
+	"github.com/TicketsBot/subscriptions-app/internal/broadcast"
+	"github.com/TicketsBot/subscriptions-app/internal/clock"
+	"github.com/TicketsBot/subscriptions-app/internal/config"
+	"github.com/TicketsBot/subscriptions-app/internal/currency"
+	"github.com/TicketsBot/subscriptions-app/internal/database"
+	"github.com/TicketsBot/subscriptions-app/internal/demo"
+	"github.com/TicketsBot/subscriptions-app/internal/digest"
+	"github.com/TicketsBot/subscriptions-app/internal/entitlements"
+	"github.com/TicketsBot/subscriptions-app/internal/events"
+	"github.com/TicketsBot/subscriptions-app/internal/eventstream"
+	"github.com/TicketsBot/subscriptions-app/internal/guildsettings"
+	"github.com/TicketsBot/subscriptions-app/internal/privacy"
+	"github.com/TicketsBot/subscriptions-app/internal/reconciliation"
+	"github.com/TicketsBot/subscriptions-app/internal/reminders"
+	"github.com/TicketsBot/subscriptions-app/internal/retention"
+	"github.com/TicketsBot/subscriptions-app/internal/roles"
+	"github.com/TicketsBot/subscriptions-app/internal/server"
+	"github.com/TicketsBot/subscriptions-app/internal/sources"
+	"github.com/TicketsBot/subscriptions-app/internal/store"
+	"github.com/TicketsBot/subscriptions-app/internal/syncstatus"
+	"github.com/TicketsBot/subscriptions-app/internal/tiers"
+	"github.com/TicketsBot/subscriptions-app/internal/usage"
+	"github.com/TicketsBot/subscriptions-app/internal/usernames"
+	"github.com/TicketsBot/subscriptions-app/internal/vouchers"
+	"github.com/TicketsBot/subscriptions-app/internal/welcome"
+	"github.com/TicketsBot/subscriptions-app/pkg/patreon"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"go.uber.org/zap"
+)
+
+type Options struct {
+	// Demo serves generated patrons instead of syncing with Patreon, and never records or persists them. The database is
+	// shared with production, so nothing that changes it, or posts to Discord, is started.
+	Demo bool
+
+	// LoadConfig re-reads the config when it is reloaded
+	LoadConfig func() (config.Config, error)
+
+	// Clock defaults to the system clock
+	Clock clock.Clock
+
+	// Store holds Patreon tokens, the snapshot, subscriptions from other sources, vouchers and the audit log. Defaults
+	// to the database, or to memory in demo mode.
+	Store store.Store
+}
+
+// App holds every subsystem of the running application
+type App struct {
+	conf       config.Config
+	logger     *zap.Logger
+	loadConfig func() (config.Config, error)
+	demo       bool
+
+	db             *database.Database
+	store          store.Store
+	tiers          *tiers.Registry
+	converter      *currency.Converter
+	entitlements   *entitlements.Engine
+	usernames      *usernames.Directory
+	usage          *usage.Recorder
+	patreonClient  *patreon.Client // Unset in demo mode
+	providers      server.Providers
+	events         *events.Bus
+	syncer         *Syncer
+	retention      *retention.Job
+	digest         *digest.Scheduler
+	reconciliation *reconciliation.Job
+	reminders      *reminders.Notifier
+	welcome        *welcome.Greeter
+	roles          *roles.Manager
+	broadcast      *broadcast.Publisher
+	eventStream    *eventstream.Streamer
+	server         *server.Server
+	bridgePool     *pgxpool.Pool // Unset unless entitlements are exported to the bot database
+
+	components sync.WaitGroup // The components started by Run
+}
+
+// New builds every subsystem, creating the database tables and loading the state that is restored on startup. No
+// background work is started until Run.
+func New(ctx context.Context, conf config.Config, logger *zap.Logger, pool *pgxpool.Pool, opts Options) (*App, error) {
+	clk := opts.Clock
+	if clk == nil {
+		clk = clock.Real
+	}
+
+	a := &App{
+		conf:       conf,
+		logger:     logger,
+		loadConfig: opts.LoadConfig,
+		demo:       opts.Demo,
+		db:         database.NewDatabase(pool),
+		store:      opts.Store,
+	}
+
+	// In demo mode, vouchers and overrides are kept in memory, so that staff can practice granting them, and real
+	// subscriptions aren't merged into the generated patrons
+	if a.store == nil && opts.Demo {
+		a.store = store.NewMemory(clk)
+	} else if a.store == nil {
+		a.store = store.NewPostgres(a.db)
+	}
+
+	if err := a.db.CreateTables(ctx); err != nil {
+		return nil, fmt.Errorf("failed to create database tables: %w", err)
+	}
+
+	a.tiers = tiers.NewRegistry(conf, a.db, a.component("tiers"))
+	if err := a.tiers.Load(ctx); err != nil {
+		return nil, fmt.Errorf("failed to load tier mappings: %w", err)
+	}
+
+	a.retention = retention.NewJob(conf, a.component("retention"), clk, a.db.Prunables())
+
+	a.converter = currency.NewConverter(conf, a.component("exchange_rates"))
+
+	pledgeSources := a.newPledgeSources()
+	a.entitlements = entitlements.NewEngine(conf, a.tiers, pledgeSources, clk, a.converter)
+
+	// Only changes since the last charge matter for proration, and patrons are charged at least monthly
+	tierChanges, err := a.db.PatronHistory.LatestByPatron(ctx, events.TierChangeTypes(), clk.Now().AddDate(0, -1, -7))
+	if err == nil {
+		err = a.entitlements.RestoreTierChanges(tierChanges)
+	}
+
+	if err != nil {
+		logger.Error("Failed to restore tier changes, proration data will be incomplete", zap.Error(err))
+	}
+
+	if conf.Patreon.FormerPatronDays > 0 {
+		formerPatrons, err := a.db.FormerPatrons.EndedSince(ctx, clk.Now().AddDate(0, 0, -conf.Patreon.FormerPatronDays))
+		if err != nil {
+			logger.Error("Failed to restore former patrons, patrons who cancelled before starting won't be found", zap.Error(err))
+		} else {
+			a.entitlements.RestoreFormerPatrons(formerPatrons)
+		}
+	}
+
+	analyticsService := analytics.NewService(a.db, a.entitlements, a.tiers, a.converter)
+	a.digest = digest.NewScheduler(conf, a.component("digest"), analyticsService)
+
+	allocationService := allocations.NewService(a.db, a.entitlements)
+	a.reconciliation = reconciliation.NewJob(conf, a.component("reconciliation"), a.db, a.store, allocationService, a.entitlements)
+
+	a.usernames = usernames.NewDirectory(conf, a.component("usernames"), a.entitlements)
+
+	guildSettings := guildsettings.NewStore(a.db)
+	if err := guildSettings.Load(ctx); err != nil {
+		return nil, fmt.Errorf("failed to load guild settings: %w", err)
+	}
+
+	a.usage = usage.NewRecorder(a.db, a.component("command_usage"))
+
+	a.server = server.NewServer(
+		conf,
+		a.component("server"),
+		a.db,
+		a.store,
+		a.tiers,
+		vouchers.NewService(a.store, a.tiers, a.component("vouchers")),
+		allocationService,
+		analyticsService,
+		a.converter,
+		a.usernames,
+		guildSettings,
+		a.usage,
+		a.entitlements,
+		a.reconciliation,
+		a.providers,
+	)
+
+	a.server.SetReloadFunc(a.Reload)
+
+	syncStatus := syncstatus.NewTracker()
+	a.server.SetSyncStatus(syncStatus)
+
+	// Subsystems such as outgoing webhooks and streams subscribe to the bus
+	a.events = events.NewBus(func(event events.Event) {
+		logger.Warn("Dropped patron event for slow subscriber", zap.String("type", string(event.Type)), zap.Uint64("patron_id", event.PatronId))
+	})
+
+	a.reminders = reminders.NewNotifier(conf, a.component("decline_reminders"), a.db, a.events, a.tiers, clk)
+	a.welcome = welcome.NewGreeter(conf, a.component("welcome"), a.events, a.tiers)
+	a.roles = roles.NewManager(conf, a.component("roles"), a.db, a.events, a.tiers, a.entitlements, clk)
+	a.broadcast = broadcast.NewPublisher(conf, a.component("broadcast"), a.db, a.events, a.entitlements)
+	a.eventStream = eventstream.NewStreamer(conf, a.component("event_stream"), a.db)
+
+	alerter := alerting.NewAlerter(conf, a.component("alerting"), clk)
+
+	if opts.Demo {
+		logger.Warn("Running in demo mode, serving generated patrons instead of syncing with Patreon")
+
+		if conf.Bridge.DatabaseUrl != "" {
+			logger.Warn("Entitlements are not exported to the bot database in demo mode")
+		}
+
+		// Generated patrons are not recorded or exported, so that they never mix with real history or premium
+		source := protectEmails(conf, demo.NewSource(conf, demo.DefaultPatronCount, clk.Now()))
+		a.syncer = NewSyncer(conf, a.component("patreon_sync"), clk, source, alerter, a.entitlements, nil, nil)
+		a.server.SetDemo()
+	} else {
+		a.patreonClient = patreon.NewClient(conf, a.component("patreon_client"), a.store, a.tiers, clk)
+		if a.patreonClient == nil {
+			return nil, fmt.Errorf("failed to create Patreon client")
+		}
+
+		// Tiers are discovered before the first sync, so that patrons of tiers missing from the config aren't reported
+		// as unknown
+		if conf.Patreon.DiscoverTiers {
+			discoverCtx, cancel := context.WithTimeout(ctx, time.Minute)
+			if err := a.tiers.Discover(discoverCtx, a.patreonClient); err != nil {
+				logger.Error("Failed to discover campaign tiers, falling back to the configured tiers", zap.Error(err))
+			}
+			cancel()
+		}
+
+		hostname, err := os.Hostname()
+		if err != nil {
+			logger.Warn("Failed to get hostname, token refreshes will be recorded without it", zap.Error(err))
+		}
+
+		a.patreonClient.SetProgressFunc(syncStatus.Progressed)
+
+		patreonSource := newPatreonSource(a.patreonClient, alerter, a.db.TokenRefreshes, hostname, clk, a.component("patreon_sync"))
+		source := protectEmails(conf, withPatronLinks(patreonSource, a.db.PatronLinks))
+		a.server.SetDegradedFunc(patreonSource.Degraded)
+		recorder := events.NewRecorder(conf, a.db, a.events, a.tiers, a.component("events"), clk)
+		a.syncer = NewSyncer(conf, a.component("patreon_sync"), clk, source, alerter, a.entitlements, recorder, a.store)
+
+		if conf.Bridge.DatabaseUrl != "" {
+			a.bridgePool, err = pgxpool.Connect(ctx, conf.Bridge.DatabaseUrl)
+			if err != nil {
+				return nil, fmt.Errorf("failed to connect to the bridge database: %w", err)
+			}
+
+			a.syncer.SetExporter(bridge.NewWriter(conf, a.component("bridge"), a.bridgePool, a.entitlements))
+		}
+	}
+
+	a.syncer.SetStatusTracker(syncStatus)
+
+	// Triggered syncs are started by the syncer's loop, which doesn't run if the component is disabled
+	if conf.ComponentEnabled(config.ComponentPatreonSync) {
+		a.server.SetSyncTrigger(a.syncer.Trigger)
+	}
+
+	return a, nil
+}
+
+// newPledgeSources builds the sources queried for entitlements alongside the Patreon snapshot. Providers are only
+// built if configured, and not in demo mode, where their webhooks would store real subscriptions.
+func (a *App) newPledgeSources() []sources.PledgeSource {
+	pledgeSources := []sources.PledgeSource{
+		sources.NewManualSource(a.store),
+		sources.NewLegacySource(a.store),
+	}
+
+	if a.demo {
+		return pledgeSources
+	}
+
+	if a.conf.Paddle.WebhookSecret != "" {
+		a.providers.Paddle = sources.NewPaddleSource(a.conf, a.component("paddle"), a.db, a.store)
+		pledgeSources = append(pledgeSources, a.providers.Paddle)
+	}
+
+	if a.conf.LemonSqueezy.WebhookSecret != "" {
+		a.providers.LemonSqueezy = sources.NewLemonSqueezySource(a.conf, a.component("lemonsqueezy"), a.db, a.store)
+		pledgeSources = append(pledgeSources, a.providers.LemonSqueezy)
+	}
+
+	if a.conf.HasSkus() {
+		a.providers.Discord = sources.NewDiscordSource(a.conf, a.component("discord_entitlements"), a.db, a.store)
+		pledgeSources = append(pledgeSources, a.providers.Discord)
+	}
+
+	return pledgeSources
+}
+
+// protectEmails hashes the emails fetched by the source, if configured
+func protectEmails(conf config.Config, source PatronSource) PatronSource {
+	emails := privacy.NewEmails(conf)
+	if !emails.Enabled() {
+		return source
+	}
+
+	return protectedSource{PatronSource: source, emails: emails}
+}
+
+func (a *App) component(name string) *zap.Logger {
+	return a.logger.With(zap.String("component", name))
+}
+
+// Events returns the bus that patron events are published to
+func (a *App) Events() *events.Bus {
+	return a.events
+}
+
+// Run starts every component that has not been disabled, then serves requests until the server stops or the context is
+// cancelled. The components are then stopped, and waited for, so that work in progress such as a sync can finish, before
+// the connection to the bridge database is closed.
+func (a *App) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	a.start(ctx, config.ComponentPatreonSync, a.syncer.Run)
+	a.start(ctx, config.ComponentRetention, a.retention.Run)
+	a.start(ctx, config.ComponentDigest, a.digest.Run)
+	a.start(ctx, config.ComponentDeclineReminders, a.reminders.Run)
+	a.start(ctx, config.ComponentWelcome, a.welcome.Run)
+	a.start(ctx, config.ComponentRoles, a.roles.Run)
+	a.start(ctx, config.ComponentBroadcast, a.broadcast.Run)
+	a.start(ctx, config.ComponentEventStream, a.eventStream.Run)
+	a.start(ctx, config.ComponentReconciliation, a.reconciliation.Run)
+
+	if a.patreonClient != nil && a.conf.Patreon.DiscoverTiers {
+		interval := time.Duration(a.conf.Patreon.TierDiscoveryIntervalMinutes) * time.Minute
+		a.start(ctx, config.ComponentTierDiscovery, func(ctx context.Context) {
+			a.tiers.RunDiscovery(ctx, a.patreonClient, interval)
+		})
+	}
+
+	if a.conf.Revenue.RatesUrl != "" {
+		interval := time.Duration(a.conf.Revenue.RatesRefreshMinutes) * time.Minute
+		a.start(ctx, config.ComponentExchangeRates, func(ctx context.Context) {
+			a.converter.Run(ctx, interval)
+		})
+	}
+
+	if a.conf.Discord.BotToken != "" {
+		a.start(ctx, config.ComponentUsernames, a.usernames.Run)
+	}
+
+	a.start(ctx, config.ComponentCommandUsage, a.usage.Run)
+
+	if a.providers.LemonSqueezy != nil && a.conf.LemonSqueezy.ApiKey != "" {
+		a.start(ctx, config.ComponentProviderReconcile, a.providers.LemonSqueezy.StartReconcileLoop)
+	}
+
+	if a.providers.Discord != nil && a.conf.Discord.BotToken != "" {
+		a.start(ctx, config.ComponentProviderReconcile, a.providers.Discord.StartReconcileLoop)
+	}
+
+	if a.conf.DebugAddr != "" {
+		a.start(ctx, config.ComponentDebugServer, func(ctx context.Context) {
+			if err := a.server.RunDebug(ctx); err != nil {
+				a.logger.Error("Debug server stopped", zap.Error(err))
+			}
+		})
+	}
+
+	err := a.server.Run(ctx)
+
+	cancel()
+	a.components.Wait()
+	a.logger.Info("Stopped every component")
+
+	// Closed once the syncer has stopped, as it may be exporting until then
+	if a.bridgePool != nil {
+		a.bridgePool.Close()
+	}
+
+	return err
+}
+
+// demoDisabledComponents change the database, which demo mode shares with production, or post to Discord and other
+// services, so are never started in demo mode
+var demoDisabledComponents = []string{
+	config.ComponentRetention,
+	config.ComponentDigest,
+	config.ComponentDeclineReminders,
+	config.ComponentWelcome,
+	config.ComponentRoles,
+	config.ComponentBroadcast,
+	config.ComponentEventStream,
+	config.ComponentReconciliation,
+	config.ComponentCommandUsage,
+	config.ComponentProviderReconcile,
+}
+
+func (a *App) start(ctx context.Context, component string, run func(ctx context.Context)) {
+	if !a.conf.ComponentEnabled(component) {
+		a.logger.Info("Component is disabled", zap.String("disabled_component", component))
+		return
+	}
+
+	if a.demo && slices.Contains(demoDisabledComponents, component) {
+		a.logger.Info("Component is disabled in demo mode", zap.String("disabled_component", component))
+		return
+	}
+
+	a.components.Add(1)
+	go func() {
+		defer a.components.Done()
+		run(ctx)
+	}()
+}
+
+// Reload re-reads the config and swaps it into the tier registry, currency converter, entitlement engine, server and
+// Patreon client. The config is only applied if it is valid. Settings used at startup, such as addresses, credentials
+// for the database, which pledge sources are enabled and which components are disabled, still require a restart.
+func (a *App) Reload() (config.Config, error) {
+	if a.loadConfig == nil {
+		return config.Config{}, fmt.Errorf("reloading is not supported")
+	}
+
+	conf, err := a.loadConfig()
+	if err == nil {
+		err = conf.Validate()
+	}
+
+	if err != nil {
+		return config.Config{}, err
+	}
+
+	a.tiers.UpdateConfig(conf)
+	a.converter.UpdateConfig(conf)
+	a.entitlements.UpdateConfig(conf)
+	a.server.UpdateConfig(conf)
+
+	if a.patreonClient != nil {
+		a.patreonClient.UpdateConfig(conf)
+	}
+
+	a.logger.Info(
+		"Config reloaded",
+		zap.Int("tiers", len(conf.Tiers)),
+		zap.Uint64s("allowed_guilds", conf.Discord.AllowedGuilds),
+		zap.Int("requests_per_minute", conf.Patreon.RequestsPerMinute),
+	)
+
+	return conf, nil
+}
@@ -0,0 +1,64 @@
+package app
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/TicketsBot/subscriptions-app/pkg/patreon"
+)
+
+// PatronLinkStore provides the Discord accounts that patrons linked through the link page
+type PatronLinkStore interface {
+	GetAll(ctx context.Context) (map[uint64]uint64, error)
+}
+
+// linkedSource applies the links made through the link page to the patrons fetched by a source. A link takes precedence
+// over the Discord account connected in Patreon, as it was made more deliberately.
+type linkedSource struct {
+	PatronSource
+	links PatronLinkStore
+}
+
+func withPatronLinks(source PatronSource, links PatronLinkStore) PatronSource {
+	return linkedSource{PatronSource: source, links: links}
+}
+
+func (l linkedSource) FetchPledges(ctx context.Context) (map[string]patreon.Patron, error) {
+	pledges, err := l.PatronSource.FetchPledges(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Syncing without the links would unlink every patron who relies on one
+	links, err := l.links.GetAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch patron links: %w", err)
+	}
+
+	if len(links) == 0 {
+		return pledges, nil
+	}
+
+	for key, patron := range pledges {
+		pledges[key] = applyLink(patron, links)
+	}
+
+	return pledges, nil
+}
+
+func applyLink(patron patreon.Patron, links map[uint64]uint64) patreon.Patron {
+	if discordId, ok := links[patron.Id]; ok {
+		patron.DiscordId = &discordId
+	}
+
+	if len(patron.Duplicates) > 0 {
+		duplicates := make([]patreon.Patron, len(patron.Duplicates))
+		for i, duplicate := range patron.Duplicates {
+			duplicates[i] = applyLink(duplicate, links)
+		}
+
+		patron.Duplicates = duplicates
+	}
+
+	return patron
+}
@@ -0,0 +1,69 @@
+package app
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/TicketsBot/subscriptions-app/internal/clock"
+	"github.com/TicketsBot/subscriptions-app/internal/config"
+	"github.com/TicketsBot/subscriptions-app/internal/database"
+	"github.com/TicketsBot/subscriptions-app/internal/demo"
+	"github.com/TicketsBot/subscriptions-app/internal/store"
+	"github.com/TicketsBot/subscriptions-app/internal/tiers"
+	"github.com/TicketsBot/subscriptions-app/pkg/patreon"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"go.uber.org/zap"
+)
+
+// FetchOnce fetches the patrons from the source that the app would sync from, without starting any components, for
+// audits and debugging campaign data. Tokens are not refreshed, and nothing is recorded or persisted.
+func FetchOnce(
+	ctx context.Context,
+	conf config.Config,
+	logger *zap.Logger,
+	pool *pgxpool.Pool,
+	opts Options,
+) (map[string]patreon.Patron, error) {
+	clk := opts.Clock
+	if clk == nil {
+		clk = clock.Real
+	}
+
+	if opts.Demo {
+		return protectEmails(conf, demo.NewSource(conf, demo.DefaultPatronCount, clk.Now())).FetchPledges(ctx)
+	}
+
+	db := database.NewDatabase(pool)
+	if err := db.CreateTables(ctx); err != nil {
+		return nil, fmt.Errorf("failed to create database tables: %w", err)
+	}
+
+	tokenStore := opts.Store
+	if tokenStore == nil {
+		tokenStore = store.NewPostgres(db)
+	}
+
+	// Tier mappings are needed to resolve the tiers of each patron
+	registry := tiers.NewRegistry(conf, db, logger.With(zap.String("component", "tiers")))
+	if err := registry.Load(ctx); err != nil {
+		return nil, fmt.Errorf("failed to load tier mappings: %w", err)
+	}
+
+	client := patreon.NewClient(conf, logger.With(zap.String("component", "patreon_client")), tokenStore, registry, clk)
+	if client == nil {
+		return nil, fmt.Errorf("failed to create Patreon client")
+	}
+
+	if client.TokenExpired() {
+		return nil, fmt.Errorf("refresh token expired at %s", client.Tokens().ExpiresAt)
+	}
+
+	// Otherwise patrons of tiers missing from the config would be reported as unknown
+	if conf.Patreon.DiscoverTiers {
+		if err := registry.Discover(ctx, client); err != nil {
+			logger.Warn("Failed to discover campaign tiers, falling back to the configured tiers", zap.Error(err))
+		}
+	}
+
+	return protectEmails(conf, withPatronLinks(client, db.PatronLinks)).FetchPledges(ctx)
+}
@@ -0,0 +1,155 @@
+package app
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/TicketsBot/subscriptions-app/internal/clock"
+	"github.com/TicketsBot/subscriptions-app/internal/database"
+	"github.com/TicketsBot/subscriptions-app/internal/metrics"
+	"github.com/TicketsBot/subscriptions-app/pkg/patreon"
+	"go.uber.org/zap"
+)
+
+// TokenNotifier alerts staff when the Patreon refresh token is about to expire, or has, as it can only be replaced
+// manually
+type TokenNotifier interface {
+	TokenExpiring(ctx context.Context, expiresAt time.Time)
+	TokenExpired(ctx context.Context, expiredAt time.Time) bool
+	TokenRecovered(ctx context.Context, expiresAt time.Time)
+}
+
+// RefreshRecorder records the outcome of each attempt to refresh the tokens
+type RefreshRecorder interface {
+	Create(ctx context.Context, refresh database.TokenRefresh) error
+}
+
+// patreonSource fetches pledges with the Patreon client, refreshing its tokens before they expire
+type patreonSource struct {
+	client    *patreon.Client
+	notifier  TokenNotifier
+	refreshes RefreshRecorder
+	hostname  string
+	clock     clock.Clock
+	logger    *zap.Logger
+
+	degraded atomic.Bool // Set while the refresh token has expired, and the last synced pledges are served
+}
+
+func newPatreonSource(
+	client *patreon.Client,
+	notifier TokenNotifier,
+	refreshes RefreshRecorder,
+	hostname string,
+	clk clock.Clock,
+	logger *zap.Logger,
+) *patreonSource {
+	return &patreonSource{
+		client:    client,
+		notifier:  notifier,
+		refreshes: refreshes,
+		hostname:  hostname,
+		clock:     clk,
+		logger:    logger,
+	}
+}
+
+func (p *patreonSource) FetchPledges(ctx context.Context) (map[string]patreon.Patron, error) {
+	// Keep serving the last synced pledges rather than exiting, until new tokens are stored with `tokens bootstrap`
+	if p.client.TokenExpired() && !p.recoverTokens(ctx) {
+		p.setDegraded(true)
+
+		if p.notifier.TokenExpired(ctx, p.client.Tokens().ExpiresAt) {
+			p.logger.Error(
+				"Refresh token has already expired, pledges will not be synced until new tokens are stored",
+				zap.Time("expires_at", p.client.Tokens().ExpiresAt),
+			)
+		}
+
+		return nil, errSyncSkipped
+	}
+
+	if p.client.TokenExpiresIn() < time.Hour*24*3 {
+		p.logger.Info(
+			"Token expires in less than 3 days, refreshing",
+			zap.Time("expires_at", p.client.Tokens().ExpiresAt),
+		)
+
+		refreshCtx, cancel := context.WithTimeout(ctx, time.Second*30)
+		err := p.client.RefreshCredentials(refreshCtx)
+		if err != nil {
+			p.logger.Error("Failed to refresh token", zap.Error(err))
+		} else {
+			p.logger.Info("Tokens refreshed successfully")
+		}
+
+		cancel()
+		p.recordRefresh(ctx, err)
+	}
+
+	// If refreshing has been failing, warn before the token expires
+	p.notifier.TokenExpiring(ctx, p.client.Tokens().ExpiresAt)
+
+	return p.client.FetchPledges(ctx)
+}
+
+// recoverTokens picks up tokens stored since the refresh token expired, returning whether they haven't expired
+func (p *patreonSource) recoverTokens(ctx context.Context) bool {
+	reloaded, err := p.client.ReloadTokens(ctx)
+	if err != nil {
+		p.logger.Error("Failed to reload Patreon tokens from the database", zap.Error(err))
+		return false
+	}
+
+	if !reloaded || p.client.TokenExpired() {
+		return false
+	}
+
+	p.logger.Info("Recovered from expired refresh token with stored tokens", zap.Time("expires_at", p.client.Tokens().ExpiresAt))
+	p.setDegraded(false)
+	p.notifier.TokenRecovered(ctx, p.client.Tokens().ExpiresAt)
+	return true
+}
+
+// tokenExpiredReason is reported while the refresh token has expired
+const tokenExpiredReason = "patreon_token_expired"
+
+func (p *patreonSource) setDegraded(degraded bool) {
+	p.degraded.Store(degraded)
+
+	if degraded {
+		metrics.Degraded.WithLabelValues(tokenExpiredReason).Set(1)
+	} else {
+		metrics.Degraded.WithLabelValues(tokenExpiredReason).Set(0)
+	}
+}
+
+// Degraded returns why the instance is degraded, if it is
+func (p *patreonSource) Degraded() []string {
+	if p.degraded.Load() {
+		return []string{tokenExpiredReason}
+	}
+
+	return nil
+}
+
+// recordRefresh records the outcome of a refresh, with when the tokens now expire, which is unchanged if it failed
+func (p *patreonSource) recordRefresh(ctx context.Context, refreshErr error) {
+	expiresAt := p.client.Tokens().ExpiresAt
+	refresh := database.TokenRefresh{
+		AttemptedAt: p.clock.Now(),
+		Success:     refreshErr == nil,
+		ExpiresAt:   &expiresAt,
+		Hostname:    p.hostname,
+	}
+
+	if refreshErr != nil {
+		message := refreshErr.Error()
+		refresh.Error = &message
+	}
+
+	if err := p.refreshes.Create(ctx, refresh); err != nil {
+		p.logger.Error("Failed to record token refresh", zap.Error(err))
+	}
+}
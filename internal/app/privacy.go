@@ -0,0 +1,44 @@
+package app
+
+import (
+	"context"
+
+	"github.com/TicketsBot/subscriptions-app/internal/privacy"
+	"github.com/TicketsBot/subscriptions-app/pkg/patreon"
+)
+
+// protectedSource hashes the emails of the patrons fetched by a source, before they are held in memory or stored
+type protectedSource struct {
+	PatronSource
+	emails *privacy.Emails
+}
+
+func (p protectedSource) FetchPledges(ctx context.Context) (map[string]patreon.Patron, error) {
+	pledges, err := p.PatronSource.FetchPledges(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keys are normalized emails, which are hashed to the same value as the patrons' emails
+	protected := make(map[string]patreon.Patron, len(pledges))
+	for key, patron := range pledges {
+		protected[p.emails.Protect(key)] = p.protect(patron)
+	}
+
+	return protected, nil
+}
+
+func (p protectedSource) protect(patron patreon.Patron) patreon.Patron {
+	patron.Email = p.emails.Protect(patron.Email)
+
+	if len(patron.Duplicates) > 0 {
+		duplicates := make([]patreon.Patron, len(patron.Duplicates))
+		for i, duplicate := range patron.Duplicates {
+			duplicates[i] = p.protect(duplicate)
+		}
+
+		patron.Duplicates = duplicates
+	}
+
+	return patron
+}
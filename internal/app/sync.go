@@ -0,0 +1,307 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/TicketsBot/subscriptions-app/internal/bridge"
+	"github.com/TicketsBot/subscriptions-app/internal/clock"
+	"github.com/TicketsBot/subscriptions-app/internal/config"
+	"github.com/TicketsBot/subscriptions-app/internal/database"
+	"github.com/TicketsBot/subscriptions-app/internal/events"
+	"github.com/TicketsBot/subscriptions-app/internal/metrics"
+	"github.com/TicketsBot/subscriptions-app/internal/syncstatus"
+	"github.com/TicketsBot/subscriptions-app/pkg/patreon"
+	"github.com/getsentry/sentry-go"
+	"go.uber.org/zap"
+)
+
+// PatronSource fetches the full snapshot of patrons, keyed by normalized email
+type PatronSource interface {
+	FetchPledges(ctx context.Context) (map[string]patreon.Patron, error)
+}
+
+// errSyncSkipped is returned by a PatronSource that can't sync, and has already reported why
+var errSyncSkipped = errors.New("sync skipped")
+
+// Notifier is told the outcome of each sync, to alert staff when syncs keep failing
+type Notifier interface {
+	SyncFailed(ctx context.Context, err error)
+	SyncSucceeded(ctx context.Context)
+}
+
+// PatronStore serves entitlements from the latest snapshot
+type PatronStore interface {
+	UpdatePatrons(patrons map[string]patreon.Patron) patreon.SnapshotDiff
+	ApplyEvents(patronEvents []events.Event)
+}
+
+// EventRecorder records the events in each change to the snapshot
+type EventRecorder interface {
+	Record(ctx context.Context, diff patreon.SnapshotDiff) ([]events.Event, error)
+}
+
+// SnapshotPersister stores the full snapshot, replacing the last one
+type SnapshotPersister interface {
+	ReplaceSnapshot(ctx context.Context, patrons []database.SnapshotPatron) error
+}
+
+// EntitlementExporter is given the entitlements after each sync, such as to write them to the bot's database
+type EntitlementExporter interface {
+	Export(ctx context.Context) (bridge.Diff, error)
+}
+
+// Syncer periodically fetches the snapshot from a source and applies it to the store. Changes are recorded and the
+// snapshot persisted only if a recorder and persister are set, so that generated patrons are never stored.
+type Syncer struct {
+	interval, jitter time.Duration
+	timeout          time.Duration // The deadline of each sync, after which it is abandoned
+	logger           *zap.Logger
+	clock            clock.Clock
+
+	source    PatronSource
+	notifier  Notifier
+	store     PatronStore
+	recorder  EventRecorder       // May be nil
+	persister SnapshotPersister   // May be nil
+	exporter  EntitlementExporter // May be nil
+	status    *syncstatus.Tracker // May be nil
+
+	persisted bool          // Whether a snapshot has been persisted since starting
+	running   atomic.Bool   // Set while a sync is running
+	trigger   chan struct{} // Starts a sync without waiting for the interval. Holds at most one pending request.
+}
+
+func NewSyncer(
+	conf config.Config,
+	logger *zap.Logger,
+	clk clock.Clock,
+	source PatronSource,
+	notifier Notifier,
+	store PatronStore,
+	recorder EventRecorder,
+	persister SnapshotPersister,
+) *Syncer {
+	interval := time.Duration(conf.Patreon.SyncIntervalSeconds) * time.Second
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	timeout := time.Duration(conf.Patreon.SyncTimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = time.Hour
+	}
+
+	return &Syncer{
+		interval:  interval,
+		jitter:    time.Duration(conf.Patreon.SyncJitterSeconds) * time.Second,
+		timeout:   timeout,
+		logger:    logger,
+		clock:     clk,
+		source:    source,
+		notifier:  notifier,
+		store:     store,
+		recorder:  recorder,
+		persister: persister,
+		trigger:   make(chan struct{}, 1),
+	}
+}
+
+// SetExporter sets the exporter given the entitlements after each sync
+func (s *Syncer) SetExporter(exporter EntitlementExporter) {
+	s.exporter = exporter
+}
+
+// SetStatusTracker sets the tracker told the outcome of each sync
+func (s *Syncer) SetStatusTracker(status *syncstatus.Tracker) {
+	s.status = status
+}
+
+// Run starts a sync every interval, or when triggered, until the context is cancelled. Syncs are started on a schedule
+// rather than back to back, so a sync that overruns the interval causes the next tick to be skipped, rather than syncs
+// piling up. A triggered sync restarts the interval. Run returns once the running sync, if any, has stopped.
+func (s *Syncer) Run(ctx context.Context) {
+	var syncs sync.WaitGroup
+	defer syncs.Wait()
+
+	for {
+		if s.running.CompareAndSwap(false, true) {
+			syncs.Add(1)
+			go func() {
+				defer syncs.Done()
+				defer s.running.Store(false)
+				s.syncWithRecover(ctx)
+			}()
+		} else {
+			s.logger.Warn("Previous sync is still running, skipping")
+			metrics.SyncsSkipped.Inc()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.clock.After(withJitter(s.interval, s.jitter)):
+		case <-s.trigger:
+			s.logger.Info("Sync triggered on demand")
+		}
+	}
+}
+
+// Trigger starts a sync without waiting for the interval, returning false if a sync is already running or pending. The
+// sync is started by Run, so nothing happens if the component is disabled.
+func (s *Syncer) Trigger() bool {
+	if s.running.Load() {
+		return false
+	}
+
+	select {
+	case s.trigger <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// withJitter returns the interval offset by a random amount of up to jitter in either direction
+func withJitter(interval, jitter time.Duration) time.Duration {
+	if jitter <= 0 {
+		return interval
+	}
+
+	offset := time.Duration(rand.Int64N(int64(2*jitter))) - jitter
+	return max(interval+offset, time.Second)
+}
+
+// syncWithRecover reports panics during a sync to Sentry, which would otherwise crash the process without being
+// reported, and allows the next sync to be attempted
+func (s *Syncer) syncWithRecover(ctx context.Context) {
+	hub := sentry.CurrentHub().Clone()
+	hub.Scope().SetTag("component", "patreon_sync")
+
+	defer func() {
+		if err := recover(); err != nil {
+			hub.RecoverWithContext(ctx, err)
+			hub.Flush(time.Second * 2)
+			s.logger.Error("Recovered from panic while syncing pledges", zap.Any("panic", err), zap.Stack("stack"))
+			s.syncFailed(ctx, fmt.Errorf("panic: %v", err))
+		}
+	}()
+
+	s.Sync(ctx)
+}
+
+// Sync fetches the snapshot and applies it. Syncs must not run concurrently.
+func (s *Syncer) Sync(ctx context.Context) {
+	fetchCtx, cancel := context.WithTimeoutCause(ctx, s.timeout, patreon.SyncTimeout(s.timeout))
+	defer cancel()
+
+	start := time.Now()
+	pledges, err := s.source.FetchPledges(fetchCtx)
+	err = patreon.WithDeadlineCause(fetchCtx, err)
+	if errors.Is(err, errSyncSkipped) {
+		return
+	} else if err != nil && ctx.Err() != nil {
+		// Stopped by shutting down, which isn't a failure worth alerting on
+		s.logger.Info("Sync stopped by shutdown", zap.Error(err))
+		return
+	} else if err != nil {
+		metrics.SyncDuration.WithLabelValues("failure").Observe(time.Since(start).Seconds())
+		s.logger.Error("Failed to fetch pledges", zap.Error(err))
+		s.syncFailed(ctx, err)
+		return
+	}
+
+	s.notifier.SyncSucceeded(ctx)
+
+	duration := time.Since(start)
+	fetchedAt := s.clock.Now()
+	metrics.SyncDuration.WithLabelValues("success").Observe(duration.Seconds())
+	metrics.LastSync.SetToCurrentTime()
+
+	s.apply(ctx, pledges)
+
+	// Recorded once applied, so that lookups never claim to be fresher than the data they are served from
+	if s.status != nil {
+		s.status.Succeeded(fetchedAt, duration, len(pledges))
+	}
+}
+
+// syncFailed reports a failed sync to the notifier and the status tracker
+func (s *Syncer) syncFailed(ctx context.Context, err error) {
+	s.notifier.SyncFailed(ctx, err)
+
+	if s.status != nil {
+		s.status.Failed(s.clock.Now(), err)
+	}
+}
+
+func (s *Syncer) apply(ctx context.Context, pledges map[string]patreon.Patron) {
+	diff := s.store.UpdatePatrons(pledges)
+
+	// Once fetched, the snapshot is recorded and persisted even if shutting down, so that its changes aren't lost
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Minute)
+	defer cancel()
+
+	if s.recorder != nil {
+		if patronEvents, err := s.recorder.Record(ctx, diff); err != nil {
+			s.logger.Error("Failed to record patron events", zap.Error(err))
+		} else {
+			s.store.ApplyEvents(patronEvents)
+		}
+	}
+
+	// The first sync is compared against nothing, so it is always persisted
+	if s.persister != nil && (!s.persisted || !diff.Empty()) {
+		if err := s.persist(ctx, pledges); err != nil {
+			s.logger.Error("Failed to persist Patreon snapshot", zap.Error(err))
+		} else {
+			s.persisted = true
+		}
+	}
+
+	if s.exporter != nil {
+		if _, err := s.exporter.Export(ctx); err != nil {
+			s.logger.Error("Failed to export entitlements", zap.Error(err))
+		}
+	}
+}
+
+func (s *Syncer) persist(ctx context.Context, pledges map[string]patreon.Patron) error {
+	start := time.Now()
+
+	patrons := make([]database.SnapshotPatron, 0, len(pledges))
+	for _, patron := range pledges {
+		patrons = append(patrons, database.SnapshotPatron{
+			Email:                        patron.Email,
+			PatronId:                     patron.Id,
+			DiscordId:                    patron.DiscordId,
+			Tiers:                        patron.Tiers,
+			PatronStatus:                 patron.PatronStatus,
+			LastChargeStatus:             patron.LastChargeStatus,
+			LastChargeDate:               nonZero(patron.LastChargeDate),
+			PledgeRelationshipStart:      nonZero(patron.PledgeRelationshipStart),
+			CurrentlyEntitledAmountCents: patron.CurrentlyEntitledAmountCents,
+			LifetimeSupportCents:         patron.LifetimeSupportCents,
+		})
+	}
+
+	if err := s.persister.ReplaceSnapshot(ctx, patrons); err != nil {
+		return err
+	}
+
+	s.logger.Debug("Persisted Patreon snapshot", zap.Int("patrons", len(patrons)), zap.Duration("took", time.Since(start)))
+	return nil
+}
+
+func nonZero(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
@@ -0,0 +1,154 @@
+package app
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/TicketsBot/subscriptions-app/internal/clock"
+	"github.com/TicketsBot/subscriptions-app/internal/config"
+	"github.com/TicketsBot/subscriptions-app/internal/events"
+	"github.com/TicketsBot/subscriptions-app/pkg/patreon"
+	"go.uber.org/zap"
+)
+
+// blockingSource blocks each fetch until the context is cancelled, then takes a moment to stop
+type blockingSource struct {
+	started  chan struct{}
+	finished atomic.Bool
+}
+
+func (s *blockingSource) FetchPledges(ctx context.Context) (map[string]patreon.Patron, error) {
+	close(s.started)
+	<-ctx.Done()
+
+	time.Sleep(50 * time.Millisecond)
+	s.finished.Store(true)
+	return nil, ctx.Err()
+}
+
+type countingNotifier struct {
+	failures atomic.Int32
+}
+
+func (n *countingNotifier) SyncFailed(context.Context, error) {
+	n.failures.Add(1)
+}
+
+func (n *countingNotifier) SyncSucceeded(context.Context) {}
+
+type discardStore struct{}
+
+func (discardStore) UpdatePatrons(map[string]patreon.Patron) patreon.SnapshotDiff {
+	return patreon.SnapshotDiff{}
+}
+
+func (discardStore) ApplyEvents([]events.Event) {}
+
+func TestSyncerRunWaitsForSync(t *testing.T) {
+	var conf config.Config
+	conf.Patreon.SyncIntervalSeconds = 3600
+
+	source := &blockingSource{started: make(chan struct{})}
+	notifier := &countingNotifier{}
+	syncer := NewSyncer(conf, zap.NewNop(), clock.Real, source, notifier, discardStore{}, nil, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		syncer.Run(ctx)
+		close(stopped)
+	}()
+
+	<-source.started
+	cancel()
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run didn't return after the context was cancelled")
+	}
+
+	if !source.finished.Load() {
+		t.Error("Run returned before the running sync stopped")
+	}
+
+	if failures := notifier.failures.Load(); failures != 0 {
+		t.Errorf("expected a sync stopped by shutdown not to be reported as failed, got %d failures", failures)
+	}
+}
+
+// countingSource returns no patrons, sending on fetched each time it is called
+type countingSource struct {
+	fetched chan struct{}
+}
+
+func (s *countingSource) FetchPledges(context.Context) (map[string]patreon.Patron, error) {
+	s.fetched <- struct{}{}
+	return map[string]patreon.Patron{}, nil
+}
+
+func TestSyncerWaitsForInterval(t *testing.T) {
+	var conf config.Config
+	conf.Patreon.SyncIntervalSeconds = 600
+
+	clk := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	source := &countingSource{fetched: make(chan struct{}, 10)}
+	syncer := NewSyncer(conf, zap.NewNop(), clk, source, &countingNotifier{}, discardStore{}, nil, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		syncer.Run(ctx)
+		close(stopped)
+	}()
+
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+
+	expectSync := func(expected bool) {
+		t.Helper()
+
+		select {
+		case <-source.fetched:
+			if !expected {
+				t.Fatal("synced before the interval had passed")
+			}
+		case <-time.After(100 * time.Millisecond):
+			if expected {
+				t.Fatal("expected a sync")
+			}
+		}
+	}
+
+	// awaitWaiting waits for Run to start waiting for the interval, so that the clock isn't advanced before it does
+	awaitWaiting := func() {
+		t.Helper()
+
+		deadline := time.Now().Add(5 * time.Second)
+		for clk.Waiters() == 0 {
+			if time.Now().After(deadline) {
+				t.Fatal("Run didn't wait for the interval")
+			}
+
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// The first sync starts immediately
+	expectSync(true)
+	awaitWaiting()
+
+	clk.Advance(599 * time.Second)
+	expectSync(false)
+
+	clk.Advance(time.Second)
+	expectSync(true)
+	awaitWaiting()
+
+	clk.Advance(600 * time.Second)
+	expectSync(true)
+}
@@ -0,0 +1,257 @@
+// Package bridge writes the entitlements of linked patrons into the main bot's database after each sync, so that the bot
+// reads premium from its own tables instead of polling this app. Only rows tagged with the configured source are read
+// or changed, so the table can be shared with other writers.
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/TicketsBot/subscriptions-app/internal/config"
+	"github.com/TicketsBot/subscriptions-app/internal/entitlements"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"go.uber.org/zap"
+)
+
+// EntitlementSource provides the entitlements to export
+type EntitlementSource interface {
+	Loaded() bool
+	LinkedEntitlements() []entitlements.Entitlement
+}
+
+// Row is an entitlement as stored in the bot's table
+type Row struct {
+	UserId    uint64
+	SkuId     uint64
+	ExpiresAt *time.Time // Unset if it doesn't expire
+}
+
+type rowKey struct {
+	userId, skuId uint64
+}
+
+func (r Row) key() rowKey {
+	return rowKey{userId: r.UserId, skuId: r.SkuId}
+}
+
+// Diff is what exporting would change in the bot's table
+type Diff struct {
+	Added   []Row
+	Updated []Row // With the new expiry
+	Removed []Row
+}
+
+func (d Diff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Updated) == 0 && len(d.Removed) == 0
+}
+
+// Writer exports entitlements to the bot's database
+type Writer struct {
+	logger       *zap.Logger
+	pool         *pgxpool.Pool
+	entitlements EntitlementSource
+
+	table  string // Quoted
+	source string
+	dryRun bool
+}
+
+func NewWriter(conf config.Config, logger *zap.Logger, pool *pgxpool.Pool, entitlements EntitlementSource) *Writer {
+	return &Writer{
+		logger:       logger,
+		pool:         pool,
+		entitlements: entitlements,
+		table:        pgx.Identifier(strings.Split(conf.Bridge.Table, ".")).Sanitize(),
+		source:       conf.Bridge.Source,
+		dryRun:       conf.Bridge.DryRun,
+	}
+}
+
+// Export brings the bot's table in line with the current entitlements, logging each change. In a dry run, the changes
+// are only logged.
+func (w *Writer) Export(ctx context.Context) (Diff, error) {
+	// An empty snapshot would remove every row
+	if !w.entitlements.Loaded() {
+		return Diff{}, nil
+	}
+
+	existing, err := w.rows(ctx)
+	if err != nil {
+		return Diff{}, fmt.Errorf("failed to read exported entitlements: %w", err)
+	}
+
+	diff := newDiff(existing, desiredRows(w.entitlements.LinkedEntitlements()))
+	w.log(diff)
+
+	if w.dryRun || diff.Empty() {
+		return diff, nil
+	}
+
+	if err := w.apply(ctx, diff); err != nil {
+		return Diff{}, fmt.Errorf("failed to write entitlements: %w", err)
+	}
+
+	return diff, nil
+}
+
+// desiredRows returns a row per user and SKU. If several entitlements grant the same SKU, such as through duplicate
+// patrons, the one that expires last is kept.
+func desiredRows(linked []entitlements.Entitlement) map[rowKey]Row {
+	rows := make(map[rowKey]Row)
+	for _, entitlement := range linked {
+		if entitlement.DiscordId == nil || entitlement.Sku == 0 {
+			continue
+		}
+
+		row := Row{
+			UserId:    *entitlement.DiscordId,
+			SkuId:     entitlement.Sku,
+			ExpiresAt: entitlement.PremiumExpiresAt,
+		}
+
+		if current, ok := rows[row.key()]; !ok || expiresAfter(row.ExpiresAt, current.ExpiresAt) {
+			rows[row.key()] = row
+		}
+	}
+
+	return rows
+}
+
+// expiresAfter returns whether a expires after b, where unset never expires
+func expiresAfter(a, b *time.Time) bool {
+	if b == nil {
+		return false
+	}
+
+	return a == nil || a.After(*b)
+}
+
+func newDiff(existing, desired map[rowKey]Row) Diff {
+	var diff Diff
+	for key, row := range desired {
+		current, ok := existing[key]
+		if !ok {
+			diff.Added = append(diff.Added, row)
+		} else if !sameExpiry(current.ExpiresAt, row.ExpiresAt) {
+			diff.Updated = append(diff.Updated, row)
+		}
+	}
+
+	for key, row := range existing {
+		if _, ok := desired[key]; !ok {
+			diff.Removed = append(diff.Removed, row)
+		}
+	}
+
+	for _, rows := range [][]Row{diff.Added, diff.Updated, diff.Removed} {
+		sort.Slice(rows, func(i, j int) bool {
+			if rows[i].UserId != rows[j].UserId {
+				return rows[i].UserId < rows[j].UserId
+			}
+
+			return rows[i].SkuId < rows[j].SkuId
+		})
+	}
+
+	return diff
+}
+
+// sameExpiry compares expiries to the microsecond, which is the precision Postgres stores
+func sameExpiry(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	return a.Truncate(time.Microsecond).Equal(b.Truncate(time.Microsecond))
+}
+
+func (w *Writer) rows(ctx context.Context) (map[rowKey]Row, error) {
+	query := fmt.Sprintf(`SELECT "user_id", "sku_id", "expires_at" FROM %s WHERE "source" = $1;`, w.table)
+
+	rows, err := w.pool.Query(ctx, query, w.source)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	existing := make(map[rowKey]Row)
+	for rows.Next() {
+		var row Row
+		if err := rows.Scan(&row.UserId, &row.SkuId, &row.ExpiresAt); err != nil {
+			return nil, err
+		}
+
+		existing[row.key()] = row
+	}
+
+	return existing, rows.Err()
+}
+
+// apply writes the diff in a single transaction, so that the bot never sees a partial export
+func (w *Writer) apply(ctx context.Context, diff Diff) error {
+	tx, err := w.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(ctx)
+
+	batch := &pgx.Batch{}
+	for _, row := range diff.Removed {
+		batch.Queue(fmt.Sprintf(`DELETE FROM %s WHERE "user_id" = $1 AND "sku_id" = $2 AND "source" = $3;`, w.table), row.UserId, row.SkuId, w.source)
+	}
+
+	for _, row := range diff.Updated {
+		batch.Queue(fmt.Sprintf(`UPDATE %s SET "expires_at" = $1 WHERE "user_id" = $2 AND "sku_id" = $3 AND "source" = $4;`, w.table), row.ExpiresAt, row.UserId, row.SkuId, w.source)
+	}
+
+	for _, row := range diff.Added {
+		batch.Queue(fmt.Sprintf(`INSERT INTO %s("user_id", "sku_id", "expires_at", "source") VALUES ($1, $2, $3, $4);`, w.table), row.UserId, row.SkuId, row.ExpiresAt, w.source)
+	}
+
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (w *Writer) log(diff Diff) {
+	if diff.Empty() {
+		w.logger.Debug("Exported entitlements are up to date")
+		return
+	}
+
+	// Each change is only logged at info level in a dry run, which is when they are reviewed
+	level := zap.DebugLevel
+	if w.dryRun {
+		level = zap.InfoLevel
+	}
+
+	for _, change := range []struct {
+		action string
+		rows   []Row
+	}{{"add", diff.Added}, {"update", diff.Updated}, {"remove", diff.Removed}} {
+		for _, row := range change.rows {
+			w.logger.Log(level, "Entitlement export change",
+				zap.String("action", change.action),
+				zap.Uint64("user_id", row.UserId),
+				zap.Uint64("sku_id", row.SkuId),
+				zap.Timep("expires_at", row.ExpiresAt),
+				zap.Bool("dry_run", w.dryRun),
+			)
+		}
+	}
+
+	w.logger.Info("Exported entitlements to the bot database",
+		zap.Int("added", len(diff.Added)),
+		zap.Int("updated", len(diff.Updated)),
+		zap.Int("removed", len(diff.Removed)),
+		zap.Bool("dry_run", w.dryRun),
+	)
+}
@@ -0,0 +1,194 @@
+// Package broadcast publishes the patron events of linked patrons to a Redis channel that the bot's shards subscribe
+// to, so that premium is refreshed within seconds of a pledge changing rather than at the bot's next poll
+package broadcast
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/TicketsBot/subscriptions-app/internal/config"
+	"github.com/TicketsBot/subscriptions-app/internal/database"
+	"github.com/TicketsBot/subscriptions-app/internal/entitlements"
+	"github.com/TicketsBot/subscriptions-app/internal/events"
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// eventBuffer is the number of events that can wait while a message is being published
+const eventBuffer = 1000
+
+// EntitlementSource provides the entitlements of the user after the change
+type EntitlementSource interface {
+	ByDiscordId(ctx context.Context, discordId uint64) ([]entitlements.Entitlement, error)
+}
+
+// Message is published for each change to a linked patron. It carries the user's premium after the change, so that
+// the bot can apply it without querying this app.
+type Message struct {
+	Type        events.Type `json:"type"`
+	UserId      uint64      `json:"user_id,string"`
+	GuildIds    []string    `json:"guild_ids"` // The guilds the user has assigned premium to
+	Premium     bool        `json:"premium"`   // Whether the user has any active entitlement, from any source
+	Skus        []string    `json:"skus"`      // The SKUs of the user's active entitlements
+	EffectiveAt time.Time   `json:"effective_at"`
+
+	// ExpiresAt is when the last of the user's active entitlements expires. Unset if one never expires, or if the user
+	// has none.
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// Publisher publishes a message for each patron event published to the bus
+type Publisher struct {
+	config       config.Config
+	logger       *zap.Logger
+	db           *database.Database
+	bus          *events.Bus
+	entitlements EntitlementSource
+	redis        *redis.Client // Unset if disabled
+}
+
+func NewPublisher(
+	config config.Config,
+	logger *zap.Logger,
+	db *database.Database,
+	bus *events.Bus,
+	entitlements EntitlementSource,
+) *Publisher {
+	p := &Publisher{
+		config:       config,
+		logger:       logger,
+		db:           db,
+		bus:          bus,
+		entitlements: entitlements,
+	}
+
+	if p.Enabled() {
+		p.redis = redis.NewClient(&redis.Options{
+			Addr:     config.Broadcast.RedisAddr,
+			Password: config.Broadcast.RedisPassword,
+			DB:       config.Broadcast.RedisDb,
+		})
+	}
+
+	return p
+}
+
+func (p *Publisher) Enabled() bool {
+	return p.config.Broadcast.RedisAddr != ""
+}
+
+// Run publishes the events of linked patrons until the context is cancelled. Unlinked patrons are skipped, as the bot
+// can't tell who they are.
+func (p *Publisher) Run(ctx context.Context) {
+	if !p.Enabled() {
+		p.logger.Info("Redis address not configured, entitlement changes are not broadcast")
+		return
+	}
+
+	defer p.redis.Close()
+
+	// The bot still polls, so an unreachable Redis only delays changes
+	if err := p.redis.Ping(ctx).Err(); err != nil {
+		p.logger.Warn("Failed to reach Redis, broadcasts will fail until it is reachable", zap.Error(err))
+	}
+
+	patronEvents := p.bus.Subscribe(eventBuffer)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-patronEvents:
+			if event.DiscordId == nil {
+				continue
+			}
+
+			if err := p.Publish(ctx, event); err != nil {
+				p.logger.Warn("Failed to broadcast entitlement change", zap.Uint64("patron_id", event.PatronId), zap.Error(err))
+			}
+		}
+	}
+}
+
+// Publish publishes the message for an event of a linked patron
+func (p *Publisher) Publish(ctx context.Context, event events.Event) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	message, err := p.message(ctx, event)
+	if err != nil {
+		return err
+	}
+
+	encoded, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	if err := p.redis.Publish(ctx, p.config.Broadcast.Channel, encoded).Err(); err != nil {
+		return errors.Wrap(err, "failed to publish to Redis")
+	}
+
+	p.logger.Debug(
+		"Broadcast entitlement change",
+		zap.String("type", string(event.Type)),
+		zap.Uint64("discord_id", message.UserId),
+		zap.Int("guilds", len(message.GuildIds)),
+	)
+
+	return nil
+}
+
+func (p *Publisher) message(ctx context.Context, event events.Event) (Message, error) {
+	message := Message{
+		Type:        event.Type,
+		UserId:      *event.DiscordId,
+		GuildIds:    []string{},
+		Skus:        []string{},
+		EffectiveAt: event.EffectiveAt,
+	}
+
+	allocations, err := p.db.GuildAllocations.GetByUser(ctx, message.UserId)
+	if err != nil {
+		return Message{}, errors.Wrap(err, "failed to fetch guild allocations")
+	}
+
+	for _, allocation := range allocations {
+		message.GuildIds = append(message.GuildIds, strconv.FormatUint(allocation.GuildId, 10))
+	}
+
+	// Entitlements from other sources are still included if one of them fails
+	active, err := p.entitlements.ByDiscordId(ctx, message.UserId)
+	if err != nil {
+		p.logger.Warn("Failed to fetch entitlements from some sources", zap.Error(err))
+	}
+
+	var expiresAt *time.Time
+	neverExpires := false
+	for _, entitlement := range active {
+		if !entitlement.Active {
+			continue
+		}
+
+		message.Premium = true
+
+		if sku := strconv.FormatUint(entitlement.Sku, 10); entitlement.Sku != 0 && !slices.Contains(message.Skus, sku) {
+			message.Skus = append(message.Skus, sku)
+		}
+
+		if entitlement.PremiumExpiresAt == nil {
+			neverExpires = true
+		} else if expiresAt == nil || entitlement.PremiumExpiresAt.After(*expiresAt) {
+			expiresAt = entitlement.PremiumExpiresAt
+		}
+	}
+
+	if !neverExpires {
+		message.ExpiresAt = expiresAt
+	}
+
+	return message, nil
+}
@@ -0,0 +1,28 @@
+// Package clock abstracts the current time, so that code which depends on it, such as token expiry and grace periods,
+// can be tested by controlling time with a Fake.
+package clock
+
+import "time"
+
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// Real is the system clock
+var Real Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// Until returns the duration until t, according to the clock
+func Until(c Clock, t time.Time) time.Duration {
+	return t.Sub(c.Now())
+}
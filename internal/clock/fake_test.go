@@ -0,0 +1,54 @@
+package clock
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFakeAdvanceConcurrently(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := NewFake(start)
+
+	var wg sync.WaitGroup
+	for range 100 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			clk.Advance(time.Second)
+		}()
+	}
+
+	wg.Wait()
+
+	if got, want := clk.Now(), start.Add(100*time.Second); !got.Equal(want) {
+		t.Errorf("expected every advance to apply, reaching %s, got %s", want, got)
+	}
+}
+
+func TestFakeAfter(t *testing.T) {
+	clk := NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	ch := clk.After(time.Minute)
+
+	clk.Advance(59 * time.Second)
+	select {
+	case <-ch:
+		t.Fatal("fired before the duration had passed")
+	default:
+	}
+
+	if waiters := clk.Waiters(); waiters != 1 {
+		t.Errorf("expected 1 waiter, got %d", waiters)
+	}
+
+	clk.Advance(time.Second)
+	select {
+	case <-ch:
+	default:
+		t.Fatal("didn't fire once the duration had passed")
+	}
+
+	if waiters := clk.Waiters(); waiters != 0 {
+		t.Errorf("expected no waiters, got %d", waiters)
+	}
+}
@@ -0,0 +1,7 @@
+package config
+
+// HasApiCredentials returns whether any API keys or service token public keys are set, without which the /api routes
+// can't be authenticated
+func (c Config) HasApiCredentials() bool {
+	return len(c.ApiKeys) > 0 || len(c.ServiceTokens.PublicKeys) > 0
+}
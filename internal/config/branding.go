@@ -0,0 +1,20 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Color is an embed color, written as a hex string such as "#4287f5"
+type Color int
+
+func (c *Color) UnmarshalText(text []byte) error {
+	value, err := strconv.ParseUint(strings.TrimPrefix(string(text), "#"), 16, 32)
+	if err != nil || value > 0xffffff {
+		return fmt.Errorf("invalid color %q, expected a hex color such as #4287f5", text)
+	}
+
+	*c = Color(value)
+	return nil
+}
@@ -0,0 +1,46 @@
+package config
+
+import "slices"
+
+// The background components that can be disabled with DisabledComponents, for example to run a read-only replica or
+// to isolate a subsystem while debugging
+const (
+	ComponentPatreonSync       = "patreon_sync"
+	ComponentRetention         = "retention"
+	ComponentDigest            = "digest"
+	ComponentDeclineReminders  = "decline_reminders"
+	ComponentWelcome           = "welcome"
+	ComponentRoles             = "roles"
+	ComponentBroadcast         = "broadcast"
+	ComponentEventStream       = "event_stream"
+	ComponentReconciliation    = "reconciliation"
+	ComponentTierDiscovery     = "tier_discovery"
+	ComponentExchangeRates     = "exchange_rates"
+	ComponentUsernames         = "usernames"
+	ComponentCommandUsage      = "command_usage"      // Writing the commands run to the database
+	ComponentProviderReconcile = "provider_reconcile" // Polling Lemon Squeezy and Discord for missed webhooks
+	ComponentDebugServer       = "debug_server"
+)
+
+var Components = []string{
+	ComponentPatreonSync,
+	ComponentRetention,
+	ComponentDigest,
+	ComponentDeclineReminders,
+	ComponentWelcome,
+	ComponentRoles,
+	ComponentBroadcast,
+	ComponentEventStream,
+	ComponentReconciliation,
+	ComponentTierDiscovery,
+	ComponentExchangeRates,
+	ComponentUsernames,
+	ComponentCommandUsage,
+	ComponentProviderReconcile,
+	ComponentDebugServer,
+}
+
+// ComponentEnabled returns whether the component has not been disabled
+func (c Config) ComponentEnabled(component string) bool {
+	return !slices.Contains(c.DisabledComponents, component)
+}
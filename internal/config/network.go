@@ -0,0 +1,35 @@
+package config
+
+import (
+	"net/netip"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ParseNetworks parses CIDR ranges, such as 10.0.0.0/8, treating a single IP address as a range containing only itself
+func ParseNetworks(values []string) ([]netip.Prefix, error) {
+	networks := make([]netip.Prefix, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+
+		if !strings.Contains(value, "/") {
+			addr, err := netip.ParseAddr(value)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid network %q", value)
+			}
+
+			networks = append(networks, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+
+		network, err := netip.ParsePrefix(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid network %q", value)
+		}
+
+		networks = append(networks, network.Masked())
+	}
+
+	return networks, nil
+}
@@ -0,0 +1,84 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"github.com/caarlos0/env/v9"
+)
+
+// Tier holds the metadata for a Patreon tier. In config files, a tier can be given either as an object, or as just its
+// name. TIERS env var entries only set the name.
+type Tier struct {
+	Name       string   `json:"name"`
+	PriceCents int      `json:"price_cents"`
+	Sku        uint64   `json:"sku"`     // Discord SKU granting the same tier, if any
+	RoleId     uint64   `json:"role_id"` // Discord role granted to members of the tier, if any
+	Perks      []string `json:"perks"`
+	MaxGuilds  int      `json:"max_guilds"` // How many guilds members can allocate premium to, defaults to 1
+
+	// GracePeriodDays overrides how long the tier is kept after a pledge lapses
+	GracePeriodDays *int `json:"grace_period_days"`
+
+	// WelcomeMessage and WelcomeChannelMessage override the messages sent to new patrons of the tier
+	WelcomeMessage        string `json:"welcome_message"`
+	WelcomeChannelMessage string `json:"welcome_channel_message"`
+}
+
+func (t *Tier) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*t = Tier{Name: name}
+		return nil
+	}
+
+	type tier Tier // Avoid recursing into UnmarshalJSON
+	return json.Unmarshal(data, (*tier)(t))
+}
+
+func (t Tier) HasPerk(perk string) bool {
+	for _, p := range t.Perks {
+		if p == perk {
+			return true
+		}
+	}
+
+	return false
+}
+
+// TierNameBySku returns the name of the tier granted by a Discord SKU, either from DISCORD_SKUS, or from the SKU set on a
+// tier
+func (c Config) TierNameBySku(sku uint64) (string, bool) {
+	if name, ok := c.Discord.Skus[sku]; ok {
+		return name, true
+	}
+
+	for _, tier := range c.Tiers {
+		if tier.Sku != 0 && tier.Sku == sku {
+			return tier.Name, true
+		}
+	}
+
+	return "", false
+}
+
+// HasSkus returns whether any Discord SKUs are mapped to tiers
+func (c Config) HasSkus() bool {
+	if len(c.Discord.Skus) > 0 {
+		return true
+	}
+
+	for _, tier := range c.Tiers {
+		if tier.Sku != 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+var envParsers = map[reflect.Type]env.ParserFunc{
+	reflect.TypeOf(Tier{}): func(value string) (interface{}, error) {
+		return Tier{Name: value}, nil
+	},
+}
@@ -0,0 +1,426 @@
+package config
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/TicketsBot/subscriptions-app/internal/rbac"
+)
+
+// bridgeTablePattern matches the names of tables that the bridge can write to, as the name is part of its queries
+var bridgeTablePattern = regexp.MustCompile(`^([a-z_][a-z0-9_]*\.)?[a-z_][a-z0-9_]*$`)
+
+// Validate checks the config for problems that would otherwise only surface later as obscure runtime errors. Every
+// problem is returned, rather than just the first.
+func (c Config) Validate() error {
+	var problems []error
+	problem := func(format string, args ...any) {
+		problems = append(problems, fmt.Errorf(format, args...))
+	}
+
+	if c.ServerAddr == "" {
+		problem("server address must be set")
+	}
+
+	if err := validateHost(c.Database.Host); err != nil {
+		problem("database host %q is invalid: %v", c.Database.Host, err)
+	}
+
+	for _, component := range c.DisabledComponents {
+		if !slices.Contains(Components, component) {
+			problem("unknown component %q cannot be disabled, must be one of %s", component, strings.Join(Components, ", "))
+		}
+	}
+
+	if c.Database.Database == "" {
+		problem("database name must be set")
+	}
+
+	if c.Database.Threads <= 0 {
+		problem("database threads must be positive, got %d", c.Database.Threads)
+	}
+
+	if key, err := hex.DecodeString(c.Discord.PublicKey); err != nil {
+		problem("Discord public key must be hex encoded: %v", err)
+	} else if len(key) != 32 {
+		problem("Discord public key must be 32 bytes (64 hex characters), got %d bytes", len(key))
+	}
+
+	if len(c.Discord.AllowedGuilds) == 0 {
+		problem("at least one allowed guild must be set")
+	}
+
+	for key, permissions := range c.Rbac.ApiKeys {
+		if _, err := rbac.ParseSet(permissions); err != nil {
+			problem("permissions of an RBAC API key: %v", err)
+		}
+
+		if !slices.Contains(c.ApiKeys, key) {
+			problem("an RBAC API key is not one of the API keys")
+		}
+	}
+
+	for roleId, permissions := range c.Rbac.Roles {
+		if _, err := rbac.ParseSet(permissions); err != nil {
+			problem("permissions of RBAC role %d: %v", roleId, err)
+		}
+	}
+
+	for _, encoded := range c.ServiceTokens.PublicKeys {
+		if key, err := hex.DecodeString(encoded); err != nil {
+			problem("service token public key must be hex encoded: %v", err)
+		} else if len(key) != 32 {
+			problem("service token public key must be 32 bytes (64 hex characters), got %d bytes", len(key))
+		}
+	}
+
+	if len(c.ServiceTokens.PublicKeys) > 0 {
+		if c.ServiceTokens.Audience == "" {
+			problem("service token audience must be set")
+		}
+
+		if c.ServiceTokens.LeewaySeconds < 0 {
+			problem("service token leeway must not be negative, got %d", c.ServiceTokens.LeewaySeconds)
+		}
+
+		if c.ServiceTokens.MaxLifetimeSeconds < 0 {
+			problem("service token max lifetime must not be negative, got %d", c.ServiceTokens.MaxLifetimeSeconds)
+		}
+	}
+
+	if c.LogRedaction.Key != "" && len(c.LogRedaction.Key) < 16 {
+		problem("log redaction key must be at least 16 characters, got %d", len(c.LogRedaction.Key))
+	}
+
+	if c.Privacy.HashEmails && len(c.Privacy.EmailSalt) < 16 {
+		problem("email salt must be at least 16 characters when hashing emails, got %d", len(c.Privacy.EmailSalt))
+	}
+
+	if c.InternalApi.Addr != "" {
+		if c.InternalApi.CertFile == "" || c.InternalApi.KeyFile == "" || c.InternalApi.ClientCaFile == "" {
+			problem("internal API listener requires a certificate, key and client CA file")
+		}
+
+		if c.InternalApi.Addr == c.ServerAddr {
+			problem("internal API listener must use a different address to the server, got %q", c.InternalApi.Addr)
+		}
+	}
+
+	if _, err := ParseNetworks(c.Network.InteractionAllowlist); err != nil {
+		problem("interaction allowlist: %v", err)
+	}
+
+	if _, err := ParseNetworks(c.Network.ApiAllowlist); err != nil {
+		problem("API allowlist: %v", err)
+	}
+
+	if _, err := ParseNetworks(c.Network.TrustedProxies); err != nil {
+		problem("trusted proxies: %v", err)
+	}
+
+	if c.Discord.SignatureMaxAgeSeconds < 0 {
+		problem("Discord signature max age cannot be negative, got %d", c.Discord.SignatureMaxAgeSeconds)
+	} else if c.Discord.RejectReplays && c.Discord.SignatureMaxAgeSeconds == 0 {
+		problem("rejecting replayed interactions requires a Discord signature max age, so that seen signatures can expire")
+	}
+
+	if c.Patreon.ClientId == "" || c.Patreon.ClientSecret == "" {
+		problem("Patreon client ID and secret must be set")
+	}
+
+	if c.Patreon.CampaignId <= 0 {
+		problem("Patreon campaign ID must be positive, got %d", c.Patreon.CampaignId)
+	}
+
+	if c.Patreon.RequestsPerMinute <= 0 {
+		problem("Patreon requests per minute must be positive, got %d", c.Patreon.RequestsPerMinute)
+	}
+
+	if c.Patreon.PageSize < 1 || c.Patreon.PageSize > 1000 {
+		problem("Patreon page size must be between 1 and 1000, got %d", c.Patreon.PageSize)
+	}
+
+	if c.Patreon.SyncTimeoutSeconds <= 0 || c.Patreon.PageTimeoutSeconds <= 0 || c.Patreon.RetryBudgetSeconds <= 0 {
+		problem("Patreon sync timeout, page timeout and retry budget must be positive")
+	} else if c.Patreon.PageTimeoutSeconds > c.Patreon.SyncTimeoutSeconds {
+		problem("Patreon page timeout (%ds) cannot be longer than the sync timeout (%ds)", c.Patreon.PageTimeoutSeconds, c.Patreon.SyncTimeoutSeconds)
+	}
+
+	if c.Patreon.RequestTimeoutSeconds <= 0 {
+		problem("Patreon request timeout must be positive, got %d", c.Patreon.RequestTimeoutSeconds)
+	}
+
+	if c.Patreon.MaxIdleConns < 0 || c.Patreon.IdleConnTimeoutSeconds < 0 {
+		problem("Patreon idle connection limits cannot be negative")
+	}
+
+	if c.Patreon.RecordDir != "" && c.Patreon.ReplayDir != "" {
+		problem("Patreon responses cannot be recorded and replayed at the same time")
+	}
+
+	if c.Patreon.SyncIntervalSeconds < 0 || c.Patreon.SyncJitterSeconds < 0 {
+		problem("Patreon sync interval and jitter cannot be negative")
+	}
+
+	if c.Patreon.DiscoverTiers && c.Patreon.TierDiscoveryIntervalMinutes <= 0 {
+		problem("tier discovery interval must be positive, got %d", c.Patreon.TierDiscoveryIntervalMinutes)
+	}
+
+	if c.Patreon.FormerPatronDays < 0 {
+		problem("former patron days cannot be negative, got %d", c.Patreon.FormerPatronDays)
+	}
+
+	// Discovered tiers are named by Patreon, so configured tiers only need a name if discovery is disabled, or if they
+	// grant a Discord SKU, which is resolved to a tier name from the config alone
+	if len(c.Tiers) == 0 && !c.Patreon.DiscoverTiers {
+		problem("at least one tier must be set, unless tiers are discovered")
+	}
+
+	for id, tier := range c.Tiers {
+		if strings.TrimSpace(tier.Name) == "" && (!c.Patreon.DiscoverTiers || tier.Sku != 0) {
+			problem("tier %d has an empty name", id)
+		}
+
+		if tier.MaxGuilds < 0 {
+			problem("tier %d has a negative guild limit", id)
+		}
+
+		if tier.PriceCents < 0 {
+			problem("tier %d has a negative price", id)
+		}
+
+		if tier.GracePeriodDays != nil && *tier.GracePeriodDays < 0 {
+			problem("tier %d has a negative grace period", id)
+		}
+	}
+
+	if c.GracePeriodDays < 0 {
+		problem("grace period must not be negative")
+	}
+
+	if c.Retention.Days < 0 {
+		problem("retention days cannot be negative, got %d", c.Retention.Days)
+	}
+
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		problem("tracing sample ratio must be between 0 and 1, got %g", c.Tracing.SampleRatio)
+	}
+
+	if c.SentryTracesSampleRate < 0 || c.SentryTracesSampleRate > 1 {
+		problem("Sentry traces sample rate must be between 0 and 1, got %g", c.SentryTracesSampleRate)
+	}
+
+	if c.Revenue.Currency == "" {
+		problem("revenue currency must be set")
+	}
+
+	for currency, rate := range c.Revenue.ExchangeRates {
+		if rate <= 0 {
+			problem("exchange rate for %s must be positive, got %g", currency, rate)
+		}
+	}
+
+	if c.Revenue.RatesUrl != "" {
+		if parsed, err := url.Parse(c.Revenue.RatesUrl); err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+			problem("exchange rates URL must be an absolute http or https URL")
+		}
+
+		if c.Revenue.RatesRefreshMinutes <= 0 {
+			problem("exchange rates refresh interval must be positive, got %d", c.Revenue.RatesRefreshMinutes)
+		}
+	}
+
+	if c.Digest.ChannelId != 0 {
+		if c.Discord.BotToken == "" {
+			problem("Discord bot token must be set to post digests")
+		}
+
+		if c.Digest.Period != "weekly" && c.Digest.Period != "monthly" {
+			problem("digest period must be weekly or monthly, got %q", c.Digest.Period)
+		}
+
+		if c.Digest.Hour < 0 || c.Digest.Hour > 23 {
+			problem("digest hour must be between 0 and 23, got %d", c.Digest.Hour)
+		}
+	}
+
+	if c.DeclineReminders.Enabled {
+		if c.Discord.BotToken == "" {
+			problem("Discord bot token must be set to send decline reminders")
+		}
+
+		if strings.TrimSpace(c.DeclineReminders.Message) == "" {
+			problem("decline reminder message must be set")
+		}
+
+		if c.DeclineReminders.CooldownDays < 1 {
+			problem("decline reminder cooldown must be at least 1 day, got %d", c.DeclineReminders.CooldownDays)
+		}
+	}
+
+	if c.Welcome.Enabled {
+		if c.Discord.BotToken == "" {
+			problem("Discord bot token must be set to send welcome messages")
+		}
+
+		if strings.TrimSpace(c.Welcome.Message) == "" {
+			problem("welcome message must be set")
+		}
+
+		if c.Welcome.ChannelId != 0 && strings.TrimSpace(c.Welcome.ChannelMessage) == "" {
+			problem("welcome channel message must be set to post in the welcome channel")
+		}
+	}
+
+	if c.Roles.GuildId != 0 {
+		if c.Discord.BotToken == "" {
+			problem("Discord bot token must be set to manage tier roles")
+		}
+
+		if c.Roles.RemovalGraceHours < 0 {
+			problem("role removal grace period must not be negative, got %d", c.Roles.RemovalGraceHours)
+		}
+
+		if c.Roles.IntervalMinutes < 1 {
+			problem("role removal interval must be at least 1 minute, got %d", c.Roles.IntervalMinutes)
+		}
+	}
+
+	if c.Discord.BotToken != "" && c.Discord.UsernameRefreshMinutes < 1 {
+		problem("username refresh interval must be at least 1 minute, got %d", c.Discord.UsernameRefreshMinutes)
+	}
+
+	if c.Reconciliation.ChannelId != 0 && c.Discord.BotToken == "" {
+		problem("Discord bot token must be set to post reconciliation reports")
+	}
+
+	if c.Bridge.DatabaseUrl != "" {
+		if !bridgeTablePattern.MatchString(c.Bridge.Table) {
+			problem("bridge table must be a table name, optionally qualified by a schema, got %q", c.Bridge.Table)
+		}
+
+		if strings.TrimSpace(c.Bridge.Source) == "" {
+			problem("bridge source must be set, so that only the rows written by this app are changed")
+		}
+	}
+
+	if c.Broadcast.RedisAddr != "" {
+		if err := validateHost(c.Broadcast.RedisAddr); err != nil {
+			problem("broadcast Redis address: %v", err)
+		}
+
+		if strings.TrimSpace(c.Broadcast.Channel) == "" {
+			problem("broadcast channel must be set")
+		}
+
+		if c.Broadcast.RedisDb < 0 {
+			problem("broadcast Redis database must not be negative, got %d", c.Broadcast.RedisDb)
+		}
+	}
+
+	if c.EventStream.Driver != "" {
+		if c.EventStream.Driver != EventStreamNats && c.EventStream.Driver != EventStreamKafka {
+			problem("event stream driver must be %s or %s, got %q", EventStreamNats, EventStreamKafka, c.EventStream.Driver)
+		}
+
+		if c.EventStream.Url == "" {
+			problem("event stream URL must be set")
+		} else if c.EventStream.Driver == EventStreamKafka {
+			for _, broker := range strings.Split(c.EventStream.Url, ",") {
+				if _, _, err := net.SplitHostPort(strings.TrimSpace(broker)); err != nil {
+					problem("event stream URL must be a comma-separated list of Kafka brokers as host:port, got %q", broker)
+				}
+			}
+		}
+
+		if strings.TrimSpace(c.EventStream.Subject) == "" {
+			problem("event stream subject must be set")
+		}
+
+		if c.EventStream.IntervalSeconds < 1 {
+			problem("event stream interval must be at least 1 second, got %d", c.EventStream.IntervalSeconds)
+		}
+	}
+
+	if c.LinkPage.PublicUrl != "" {
+		if parsed, err := url.Parse(c.LinkPage.PublicUrl); err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+			problem("link page public URL must be an absolute http or https URL, got %q", c.LinkPage.PublicUrl)
+		}
+
+		if c.Discord.ApplicationId == 0 {
+			problem("the link page requires the Discord application ID, to sign in with Discord")
+		}
+
+		if c.LinkPage.DiscordClientSecret == "" {
+			problem("the link page requires the Discord client secret")
+		}
+
+		if len(c.LinkPage.SessionSecret) < 32 {
+			problem("link page session secret must be at least 32 characters")
+		}
+	}
+
+	if strings.TrimSpace(c.Whitelabel.Perk) == "" {
+		problem("whitelabel perk must be set")
+	}
+
+	if c.Whitelabel.OwnerUrl != "" {
+		if strings.Count(c.Whitelabel.OwnerUrl, "%") != 1 || !strings.Contains(c.Whitelabel.OwnerUrl, "%d") {
+			problem("whitelabel owner URL must contain a single %%d for the bot ID")
+		}
+
+		if c.Whitelabel.CacheSeconds < 0 {
+			problem("whitelabel cache duration must not be negative, got %d", c.Whitelabel.CacheSeconds)
+		}
+	}
+
+	if strings.Count(c.Branding.PatronUrl, "%") != 1 || !strings.Contains(c.Branding.PatronUrl, "%d") {
+		problem("branding patron URL must contain a single %%d for the Patreon user ID")
+	}
+
+	if c.DebugAddr != "" && !c.HasApiCredentials() {
+		problem("the debug server requires at least one API key or service token public key")
+	}
+
+	if c.HasSkus() && c.Discord.ApplicationId == 0 {
+		problem("Discord application ID must be set to track SKU entitlements")
+	}
+
+	if c.LemonSqueezy.WebhookSecret != "" && c.LemonSqueezy.StoreId == 0 {
+		problem("Lemon Squeezy store ID must be set")
+	}
+
+	return errors.Join(problems...)
+}
+
+// validateHost checks that the host is in the format host or host:port
+func validateHost(host string) error {
+	if host == "" {
+		return errors.New("must be set")
+	}
+
+	if strings.Contains(host, "/") {
+		return errors.New("must be a host or host:port, not a URL")
+	}
+
+	if h, port, err := net.SplitHostPort(host); err == nil {
+		if h == "" {
+			return errors.New("missing host")
+		}
+
+		if n, err := strconv.Atoi(port); err != nil || n <= 0 || n > 65535 {
+			return fmt.Errorf("invalid port %q", port)
+		}
+	} else if strings.Count(host, ":") == 1 {
+		return err
+	}
+
+	return nil
+}
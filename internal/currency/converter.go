@@ -0,0 +1,213 @@
+// Package currency converts amounts pledged in other currencies to the base currency that revenue is reported in
+package currency
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TicketsBot/subscriptions-app/internal/config"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// Converter converts amounts between the base currency, Revenue.Currency, and other currencies. Rates come from the
+// config, and from the rates API if one is configured, which takes precedence.
+type Converter struct {
+	logger     *zap.Logger
+	httpClient *http.Client
+	ratesUrl   string // From config on startup
+
+	mu         sync.RWMutex
+	base       string
+	configured map[string]float64 // Currency -> units per unit of base, from config. Replaced when config is reloaded.
+	fetched    map[string]float64 // Currency -> units per unit of base, from the rates API
+	warned     map[string]bool    // Currencies without a rate that have been logged
+}
+
+func NewConverter(config config.Config, logger *zap.Logger) *Converter {
+	c := &Converter{
+		logger:     logger,
+		httpClient: &http.Client{Timeout: time.Second * 10},
+		ratesUrl:   config.Revenue.RatesUrl,
+		warned:     make(map[string]bool),
+	}
+
+	c.UpdateConfig(config)
+	return c
+}
+
+// UpdateConfig replaces the base currency and the configured rates
+func (c *Converter) UpdateConfig(config config.Config) {
+	configured := make(map[string]float64, len(config.Revenue.ExchangeRates))
+	for currency, rate := range config.Revenue.ExchangeRates {
+		configured[strings.ToUpper(currency)] = rate
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.base = strings.ToUpper(config.Revenue.Currency)
+	c.configured = configured
+}
+
+// Base returns the currency that amounts are converted to
+func (c *Converter) Base() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.base
+}
+
+// Rate returns the units of the currency per unit of the base currency
+func (c *Converter) Rate(currency string) (float64, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.rate(strings.ToUpper(currency))
+}
+
+// rate must be called with the lock held
+func (c *Converter) rate(currency string) (float64, bool) {
+	if currency == c.base {
+		return 1, true
+	}
+
+	if rate, ok := c.fetched[currency]; ok {
+		return rate, true
+	}
+
+	rate, ok := c.configured[currency]
+	return rate, ok
+}
+
+// ToBase converts an amount in the currency to the base currency. An empty currency is taken to be the base currency.
+// Amounts in currencies without a rate are returned unchanged, and a warning is logged the first time each is seen.
+func (c *Converter) ToBase(cents int, currency string) int {
+	converted, ok := c.Convert(cents, currency)
+	if ok {
+		return converted
+	}
+
+	currency = strings.ToUpper(currency)
+
+	c.mu.Lock()
+	warned := c.warned[currency]
+	c.warned[currency] = true
+	c.mu.Unlock()
+
+	if !warned {
+		c.logger.Warn("No exchange rate for currency, reporting its amounts unconverted", zap.String("currency", currency))
+	}
+
+	return cents
+}
+
+// Convert converts an amount in the currency to the base currency, returning false if there is no rate for it. An
+// empty currency is taken to be the base currency.
+func (c *Converter) Convert(cents int, currency string) (int, bool) {
+	if currency == "" {
+		return cents, true
+	}
+
+	rate, ok := c.Rate(currency)
+	if !ok {
+		return cents, false
+	}
+
+	return int(math.Round(float64(cents) / rate)), true
+}
+
+// Refresh fetches the rates from the rates API. Rates returned relative to a different base are converted using the
+// rate of the configured base, which must be included.
+func (c *Converter) Refresh(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.ratesUrl, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed to fetch exchange rates")
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+		return fmt.Errorf("exchange rates API returned %d status code: %s", res.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var body struct {
+		Base  string             `json:"base"`
+		Rates map[string]float64 `json:"rates"`
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return errors.Wrap(err, "failed to decode exchange rates")
+	}
+
+	c.mu.RLock()
+	base := c.base
+	c.mu.RUnlock()
+
+	rates := make(map[string]float64, len(body.Rates))
+	for currency, rate := range body.Rates {
+		if rate > 0 {
+			rates[strings.ToUpper(currency)] = rate
+		}
+	}
+
+	// Rebase rates given per unit of another currency onto the configured base
+	if apiBase := strings.ToUpper(body.Base); apiBase != "" && apiBase != base {
+		baseRate, ok := rates[base]
+		if !ok {
+			return fmt.Errorf("exchange rates are relative to %s and don't include %s", apiBase, base)
+		}
+
+		rates[apiBase] = 1
+		for currency, rate := range rates {
+			rates[currency] = rate / baseRate
+		}
+	}
+
+	delete(rates, base)
+
+	c.mu.Lock()
+	c.fetched = rates
+	c.mu.Unlock()
+
+	c.logger.Info("Fetched exchange rates", zap.Int("currencies", len(rates)))
+	return nil
+}
+
+// Run fetches the rates from the rates API on startup and every interval until the context is cancelled. Nothing is
+// fetched if no rates API is configured. The last rates fetched are kept if fetching fails.
+func (c *Converter) Run(ctx context.Context, interval time.Duration) {
+	if c.ratesUrl == "" {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		refreshCtx, cancel := context.WithTimeout(ctx, time.Minute)
+		if err := c.Refresh(refreshCtx); err != nil {
+			c.logger.Error("Failed to refresh exchange rates, using the last rates fetched", zap.Error(err))
+		}
+		cancel()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
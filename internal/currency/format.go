@@ -0,0 +1,14 @@
+package currency
+
+import "fmt"
+
+// Format formats an amount in cents with its currency, such as 5.50 USD, or -5.50 USD for negative amounts
+func Format(cents int, currency string) string {
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+
+	return fmt.Sprintf("%s%d.%02d %s", sign, cents/100, cents%100, currency)
+}
@@ -0,0 +1,23 @@
+package currency
+
+import "testing"
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		cents int
+		want  string
+	}{
+		{0, "0.00 USD"},
+		{5, "0.05 USD"},
+		{550, "5.50 USD"},
+		{123456, "1234.56 USD"},
+		{-5, "-0.05 USD"},
+		{-550, "-5.50 USD"},
+	}
+
+	for _, test := range tests {
+		if got := Format(test.cents, "USD"); got != test.want {
+			t.Errorf("expected %d cents to format as %q, got %q", test.cents, test.want, got)
+		}
+	}
+}
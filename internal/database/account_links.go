@@ -0,0 +1,75 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// AccountLinksTable stores verified email -> Discord account links, created through the /link flow. Links apply to
+// every provider persisted in external_subscriptions.
+type AccountLinksTable struct {
+	pool *pgxpool.Pool
+}
+
+func newAccountLinksTable(pool *pgxpool.Pool) *AccountLinksTable {
+	return &AccountLinksTable{
+		pool: pool,
+	}
+}
+
+func (t *AccountLinksTable) Schema() string {
+	return `
+CREATE TABLE IF NOT EXISTS account_links(
+	"email" varchar(320) NOT NULL,
+	"discord_id" int8 NOT NULL,
+	"linked_at" timestamptz NOT NULL,
+	PRIMARY KEY("email")
+);
+CREATE INDEX IF NOT EXISTS account_links_discord_id ON account_links("discord_id");
+`
+}
+
+// GetDiscordId returns the Discord account linked to the email, if any
+func (t *AccountLinksTable) GetDiscordId(ctx context.Context, email string) (*uint64, error) {
+	var discordId uint64
+	if err := t.pool.QueryRow(ctx, `SELECT "discord_id" FROM account_links WHERE "email" = $1;`, strings.ToLower(email)).Scan(&discordId); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return &discordId, nil
+}
+
+// Link links the email to the Discord account, and applies the link to any existing external subscriptions
+func (t *AccountLinksTable) Link(ctx context.Context, email string, discordId uint64) error {
+	email = strings.ToLower(email)
+
+	tx, err := t.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(ctx)
+
+	query := `
+INSERT INTO account_links("email", "discord_id", "linked_at")
+VALUES ($1, $2, NOW())
+ON CONFLICT("email") DO UPDATE SET "discord_id" = EXCLUDED."discord_id", "linked_at" = EXCLUDED."linked_at";`
+
+	if _, err := tx.Exec(ctx, query, email, discordId); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE external_subscriptions SET "discord_id" = $2 WHERE LOWER("email") = $1;`, email, discordId); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
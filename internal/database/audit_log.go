@@ -0,0 +1,91 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type AuditLogTable struct {
+	pool *pgxpool.Pool
+}
+
+type AuditLogEntry struct {
+	Id        int64
+	ActorId   uint64
+	Action    string
+	Details   json.RawMessage
+	CreatedAt time.Time
+}
+
+func newAuditLogTable(pool *pgxpool.Pool) *AuditLogTable {
+	return &AuditLogTable{
+		pool: pool,
+	}
+}
+
+func (t *AuditLogTable) Schema() string {
+	return `
+CREATE TABLE IF NOT EXISTS audit_log(
+	"id" SERIAL8 NOT NULL,
+	"actor_id" int8 NOT NULL,
+	"action" varchar(64) NOT NULL,
+	"details" jsonb NOT NULL,
+	"created_at" timestamptz NOT NULL,
+	PRIMARY KEY("id")
+);
+CREATE INDEX IF NOT EXISTS audit_log_created_at ON audit_log("created_at");
+`
+}
+
+// Create records an action. details is marshalled to JSON.
+func (t *AuditLogTable) Create(ctx context.Context, actorId uint64, action string, details any) error {
+	return createAuditLogEntry(ctx, t.pool, actorId, action, details)
+}
+
+func createAuditLogEntry(ctx context.Context, exec executor, actorId uint64, action string, details any) error {
+	encoded, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO audit_log("actor_id", "action", "details", "created_at") VALUES ($1, $2, $3, NOW());`
+	_, err = exec.Exec(ctx, query, actorId, action, encoded)
+	return err
+}
+
+// Recent returns the latest entries, newest first
+func (t *AuditLogTable) Recent(ctx context.Context, limit int) ([]AuditLogEntry, error) {
+	query := `SELECT "id", "actor_id", "action", "details", "created_at" FROM audit_log ORDER BY "id" DESC LIMIT $1;`
+
+	// Postgres rejects a negative limit
+	rows, err := t.pool.Query(ctx, query, max(limit, 0))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var entries []AuditLogEntry
+	for rows.Next() {
+		var entry AuditLogEntry
+		if err := rows.Scan(&entry.Id, &entry.ActorId, &entry.Action, &entry.Details, &entry.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+func (t *AuditLogTable) Prune(ctx context.Context, before time.Time) (int64, error) {
+	res, err := t.pool.Exec(ctx, `DELETE FROM audit_log WHERE "created_at" < $1;`, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected(), nil
+}
@@ -0,0 +1,157 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// CommandUsageTable records each command run, with who ran it and how long the response took to build, so that the
+// support tools that are used, and how fast they respond, can be reported by /subscription stats usage
+type CommandUsageTable struct {
+	pool *pgxpool.Pool
+}
+
+type CommandUse struct {
+	Command  string // The command's path, such as "subscription lookup"
+	UserId   uint64
+	GuildId  uint64 // Zero for commands run in DMs
+	Duration time.Duration
+	UsedAt   time.Time
+}
+
+// CommandUsage summarises the uses of a command
+type CommandUsage struct {
+	Command  string
+	Uses     int
+	Users    int
+	MedianMs float64 // The median time taken to respond
+	P95Ms    float64 // The 95th percentile of the time taken to respond
+}
+
+// UserUsage summarises the commands run by a user
+type UserUsage struct {
+	UserId   uint64
+	Uses     int
+	MostUsed string // The command the user ran most often
+}
+
+func newCommandUsageTable(pool *pgxpool.Pool) *CommandUsageTable {
+	return &CommandUsageTable{
+		pool: pool,
+	}
+}
+
+func (t *CommandUsageTable) Schema() string {
+	return `
+CREATE TABLE IF NOT EXISTS command_usage(
+	"id" SERIAL8 NOT NULL,
+	"command" varchar(100) NOT NULL,
+	"user_id" int8 NOT NULL,
+	"guild_id" int8 NULL,
+	"duration_ms" int4 NOT NULL,
+	"used_at" timestamptz NOT NULL,
+	PRIMARY KEY("id")
+);
+CREATE INDEX IF NOT EXISTS command_usage_used_at ON command_usage("used_at");
+`
+}
+
+var commandUsageColumns = []string{"command", "user_id", "guild_id", "duration_ms", "used_at"}
+
+// CreateMany records the uses in a single round trip
+func (t *CommandUsageTable) CreateMany(ctx context.Context, uses []CommandUse) error {
+	rows := pgx.CopyFromSlice(len(uses), func(i int) ([]any, error) {
+		use := uses[i]
+
+		var guildId *uint64
+		if use.GuildId != 0 {
+			guildId = &use.GuildId
+		}
+
+		return []any{use.Command, use.UserId, guildId, use.Duration.Milliseconds(), use.UsedAt}, nil
+	})
+
+	_, err := t.pool.CopyFrom(ctx, pgx.Identifier{"command_usage"}, commandUsageColumns, rows)
+	return err
+}
+
+// ByCommand summarises the uses of each command since the time, most used first
+func (t *CommandUsageTable) ByCommand(ctx context.Context, since time.Time) ([]CommandUsage, error) {
+	query := `
+SELECT
+	"command",
+	COUNT(*),
+	COUNT(DISTINCT "user_id"),
+	PERCENTILE_CONT(0.5) WITHIN GROUP (ORDER BY "duration_ms"),
+	PERCENTILE_CONT(0.95) WITHIN GROUP (ORDER BY "duration_ms")
+FROM command_usage
+WHERE "used_at" >= $1
+GROUP BY "command"
+ORDER BY COUNT(*) DESC, "command";`
+
+	rows, err := t.pool.Query(ctx, query, since)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var usage []CommandUsage
+	for rows.Next() {
+		var command CommandUsage
+		if err := rows.Scan(&command.Command, &command.Uses, &command.Users, &command.MedianMs, &command.P95Ms); err != nil {
+			return nil, err
+		}
+
+		usage = append(usage, command)
+	}
+
+	return usage, rows.Err()
+}
+
+// ByUser summarises the commands run by the users who ran the most since the time, most uses first
+func (t *CommandUsageTable) ByUser(ctx context.Context, since time.Time, limit int) ([]UserUsage, error) {
+	query := `
+SELECT "user_id", SUM("uses")::int8, (ARRAY_AGG("command" ORDER BY "uses" DESC, "command"))[1]
+FROM (
+	SELECT "user_id", "command", COUNT(*) AS "uses"
+	FROM command_usage
+	WHERE "used_at" >= $1
+	GROUP BY "user_id", "command"
+) AS per_command
+GROUP BY "user_id"
+ORDER BY SUM("uses") DESC, "user_id"
+LIMIT $2;`
+
+	rows, err := t.pool.Query(ctx, query, since, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var usage []UserUsage
+	for rows.Next() {
+		var user UserUsage
+		if err := rows.Scan(&user.UserId, &user.Uses, &user.MostUsed); err != nil {
+			return nil, err
+		}
+
+		usage = append(usage, user)
+	}
+
+	return usage, rows.Err()
+}
+
+// Prune deletes uses recorded before the given time
+func (t *CommandUsageTable) Prune(ctx context.Context, before time.Time) (int64, error) {
+	res, err := t.pool.Exec(ctx, `DELETE FROM command_usage WHERE "used_at" < $1;`, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected(), nil
+}
@@ -0,0 +1,161 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/pkg/errors"
+)
+
+type Database struct {
+	pool *pgxpool.Pool
+
+	AccountLinks          *AccountLinksTable
+	AuditLog              *AuditLogTable
+	CommandUsage          *CommandUsageTable
+	DeclineReminders      *DeclineRemindersTable
+	EventCursors          *EventCursorsTable
+	ExternalSubscriptions *ExternalSubscriptionsTable
+	FormerPatrons         *FormerPatronsTable
+	GuildAllocations      *GuildAllocationsTable
+	GuildSettings         *GuildSettingsTable
+	PatreonKeys           *PatreonKeysTable
+	PatronHistory         *PatronHistoryTable
+	PatronLinks           *PatronLinksTable
+	PatronSnapshot        *PatronSnapshotTable
+	ReconciliationCounts  *ReconciliationCountsTable
+	RoleRemovals          *RoleRemovalsTable
+	TokenRefreshes        *TokenRefreshesTable
+	UnknownTiers          *UnknownTiersTable
+	TierMappings          *TierMappingsTable
+	Vouchers              *VouchersTable
+}
+
+type table interface {
+	Schema() string
+}
+
+// executor is satisfied by both *pgxpool.Pool and pgx.Tx, so that queries can be shared between standalone calls and
+// transactions
+type executor interface {
+	Exec(ctx context.Context, sql string, arguments ...interface{}) (pgconn.CommandTag, error)
+}
+
+// Prunable is implemented by tables holding data that is subject to the retention window
+type Prunable interface {
+	// Prune deletes rows older than before, returning the number of rows deleted
+	Prune(ctx context.Context, before time.Time) (int64, error)
+}
+
+func NewDatabase(pool *pgxpool.Pool) *Database {
+	return &Database{
+		pool:                  pool,
+		AccountLinks:          newAccountLinksTable(pool),
+		AuditLog:              newAuditLogTable(pool),
+		CommandUsage:          newCommandUsageTable(pool),
+		DeclineReminders:      newDeclineRemindersTable(pool),
+		EventCursors:          newEventCursorsTable(pool),
+		ExternalSubscriptions: newExternalSubscriptionsTable(pool),
+		FormerPatrons:         newFormerPatronsTable(pool),
+		GuildAllocations:      newGuildAllocationsTable(pool),
+		GuildSettings:         newGuildSettingsTable(pool),
+		PatreonKeys:           newPatreonKeysTable(pool),
+		PatronHistory:         newPatronHistoryTable(pool),
+		PatronLinks:           newPatronLinksTable(pool),
+		PatronSnapshot:        newPatronSnapshotTable(pool),
+		ReconciliationCounts:  newReconciliationCountsTable(pool),
+		RoleRemovals:          newRoleRemovalsTable(pool),
+		TokenRefreshes:        newTokenRefreshesTable(pool),
+		UnknownTiers:          newUnknownTiersTable(pool),
+		TierMappings:          newTierMappingsTable(pool),
+		Vouchers:              newVouchersTable(pool),
+	}
+}
+
+// CreateTables brings the schema up to date on startup, by applying and recording every migration that hasn't been
+// applied, as migrate up does. A new database is created from the baseline, which already has the changes of the later
+// migrations, so they are applied as no-ops. The migration lock is held, so that replicas starting at the same time
+// don't race to create the same tables.
+func (d *Database) CreateTables(ctx context.Context) error {
+	return d.withMigrationLock(ctx, func(conn *pgxpool.Conn) error {
+		_, err := d.migrateUp(ctx, conn)
+		return err
+	})
+}
+
+// baselineSchema is the schema of every table owned by the app
+func (d *Database) baselineSchema() string {
+	tables := []table{
+		d.AuditLog,
+		d.CommandUsage,
+		d.DeclineReminders,
+		d.EventCursors,
+		d.ExternalSubscriptions,
+		d.AccountLinks,
+		d.FormerPatrons,
+		d.GuildAllocations,
+		d.GuildSettings,
+		d.PatreonKeys,
+		d.PatronHistory,
+		d.PatronLinks,
+		d.PatronSnapshot,
+		d.ReconciliationCounts,
+		d.RoleRemovals,
+		d.TokenRefreshes,
+		d.UnknownTiers,
+		d.TierMappings,
+		d.Vouchers,
+	}
+
+	var schema strings.Builder
+	for _, table := range tables {
+		schema.WriteString(table.Schema())
+	}
+
+	return schema.String()
+}
+
+// Prunables returns the tables that should be pruned by the retention job, keyed by table name
+func (d *Database) Prunables() map[string]Prunable {
+	return map[string]Prunable{
+		"audit_log":         d.AuditLog,
+		"command_usage":     d.CommandUsage,
+		"decline_reminders": d.DeclineReminders,
+		"former_patrons":    d.FormerPatrons,
+		"patron_history":    d.PatronHistory,
+		"token_refreshes":   d.TokenRefreshes,
+	}
+}
+
+// MapTier stores a tier name mapping, removes the tier from the unknown tiers list and records the change in the
+// audit log, in a single transaction
+func (d *Database) MapTier(ctx context.Context, tierId uint64, name string, mappedBy uint64) error {
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+
+	defer tx.Rollback(ctx)
+
+	if err := setTierMapping(ctx, tx, tierId, name, mappedBy); err != nil {
+		return errors.Wrap(err, "failed to store tier mapping")
+	}
+
+	if err := deleteUnknownTier(ctx, tx, tierId); err != nil {
+		return errors.Wrap(err, "failed to remove unknown tier")
+	}
+
+	details := map[string]any{
+		"tier_id": tierId,
+		"name":    name,
+	}
+
+	if err := createAuditLogEntry(ctx, tx, mappedBy, "tier_mapped", details); err != nil {
+		return errors.Wrap(err, "failed to write audit log entry")
+	}
+
+	return tx.Commit(ctx)
+}
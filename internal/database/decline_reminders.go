@@ -0,0 +1,66 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// DeclineRemindersTable records when each patron was last sent a reminder about a declined charge, so that reminders
+// respect their cooldown across restarts
+type DeclineRemindersTable struct {
+	pool *pgxpool.Pool
+}
+
+func newDeclineRemindersTable(pool *pgxpool.Pool) *DeclineRemindersTable {
+	return &DeclineRemindersTable{
+		pool: pool,
+	}
+}
+
+func (t *DeclineRemindersTable) Schema() string {
+	return `
+CREATE TABLE IF NOT EXISTS decline_reminders(
+	"patron_id" int8 NOT NULL,
+	"sent_at" timestamptz NOT NULL,
+	PRIMARY KEY("patron_id")
+);
+`
+}
+
+// LastSent returns when the patron was last sent a reminder, if ever
+func (t *DeclineRemindersTable) LastSent(ctx context.Context, patronId uint64) (time.Time, bool, error) {
+	var sentAt time.Time
+	if err := t.pool.QueryRow(ctx, `SELECT "sent_at" FROM decline_reminders WHERE "patron_id" = $1;`, patronId).Scan(&sentAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return time.Time{}, false, nil
+		}
+
+		return time.Time{}, false, err
+	}
+
+	return sentAt, true, nil
+}
+
+func (t *DeclineRemindersTable) Record(ctx context.Context, patronId uint64, sentAt time.Time) error {
+	query := `
+INSERT INTO decline_reminders("patron_id", "sent_at")
+VALUES ($1, $2)
+ON CONFLICT("patron_id") DO UPDATE SET "sent_at" = EXCLUDED."sent_at";`
+
+	_, err := t.pool.Exec(ctx, query, patronId, sentAt)
+	return err
+}
+
+// Prune deletes reminders sent before the retention window, which are long past any cooldown
+func (t *DeclineRemindersTable) Prune(ctx context.Context, before time.Time) (int64, error) {
+	res, err := t.pool.Exec(ctx, `DELETE FROM decline_reminders WHERE "sent_at" < $1;`, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected(), nil
+}
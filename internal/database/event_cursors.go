@@ -0,0 +1,54 @@
+package database
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// EventCursorsTable stores how far each consumer has read the patron history, so that consumers resume where they
+// left off after a restart
+type EventCursorsTable struct {
+	pool *pgxpool.Pool
+}
+
+func newEventCursorsTable(pool *pgxpool.Pool) *EventCursorsTable {
+	return &EventCursorsTable{
+		pool: pool,
+	}
+}
+
+func (t *EventCursorsTable) Schema() string {
+	return `
+CREATE TABLE IF NOT EXISTS event_cursors(
+	"name" varchar(64) NOT NULL,
+	"last_id" int8 NOT NULL,
+	"updated_at" timestamptz NOT NULL,
+	PRIMARY KEY("name")
+);
+`
+}
+
+// Get returns the ID of the last patron history entry the consumer has read, or 0 if it hasn't read any
+func (t *EventCursorsTable) Get(ctx context.Context, name string) (int64, error) {
+	var lastId int64
+	err := t.pool.QueryRow(ctx, `SELECT "last_id" FROM event_cursors WHERE "name" = $1;`, name).Scan(&lastId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+
+	return lastId, err
+}
+
+// Set moves the consumer's cursor to lastId
+func (t *EventCursorsTable) Set(ctx context.Context, name string, lastId int64) error {
+	query := `
+INSERT INTO event_cursors("name", "last_id", "updated_at")
+VALUES ($1, $2, NOW())
+ON CONFLICT("name") DO UPDATE SET "last_id" = $2, "updated_at" = NOW();`
+
+	_, err := t.pool.Exec(ctx, query, name, lastId)
+	return err
+}
@@ -0,0 +1,159 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// ExternalSubscriptionsTable stores subscriptions from providers other than Patreon, which notify us via webhooks
+// rather than being synced into memory
+type ExternalSubscriptionsTable struct {
+	pool *pgxpool.Pool
+}
+
+const (
+	// SourceManual is used for entitlements granted by staff, rather than purchased through a provider
+	SourceManual = "manual"
+	// SourceLegacy is used for premium keys imported from the legacy key system
+	SourceLegacy = "legacy"
+)
+
+type ExternalSubscription struct {
+	Source    string
+	Reference string // The provider's ID for the subscription
+	Email     *string
+	DiscordId *uint64
+	Tier      string
+	Status    string
+	StartedAt *time.Time
+	ExpiresAt *time.Time
+	UpdatedAt time.Time
+}
+
+func newExternalSubscriptionsTable(pool *pgxpool.Pool) *ExternalSubscriptionsTable {
+	return &ExternalSubscriptionsTable{
+		pool: pool,
+	}
+}
+
+func (t *ExternalSubscriptionsTable) Schema() string {
+	return `
+CREATE TABLE IF NOT EXISTS external_subscriptions(
+	"source" varchar(32) NOT NULL,
+	"reference" varchar(255) NOT NULL,
+	"email" varchar(320) NULL,
+	"discord_id" int8 NULL,
+	"tier" varchar(100) NOT NULL,
+	"status" varchar(32) NOT NULL,
+	"started_at" timestamptz NULL,
+	"expires_at" timestamptz NULL,
+	"updated_at" timestamptz NOT NULL,
+	PRIMARY KEY("source", "reference")
+);
+CREATE INDEX IF NOT EXISTS external_subscriptions_email ON external_subscriptions(LOWER("email"));
+CREATE INDEX IF NOT EXISTS external_subscriptions_discord_id ON external_subscriptions("discord_id");
+`
+}
+
+const externalSubscriptionColumns = `"source", "reference", "email", "discord_id", "tier", "status", "started_at", "expires_at", "updated_at"`
+
+func (t *ExternalSubscriptionsTable) GetByEmail(ctx context.Context, source, email string) ([]ExternalSubscription, error) {
+	query := `SELECT ` + externalSubscriptionColumns + ` FROM external_subscriptions WHERE "source" = $1 AND LOWER("email") = LOWER($2);`
+	return t.query(ctx, query, source, email)
+}
+
+func (t *ExternalSubscriptionsTable) GetByDiscordId(ctx context.Context, source string, discordId uint64) ([]ExternalSubscription, error) {
+	query := `SELECT ` + externalSubscriptionColumns + ` FROM external_subscriptions WHERE "source" = $1 AND "discord_id" = $2;`
+	return t.query(ctx, query, source, discordId)
+}
+
+func (t *ExternalSubscriptionsTable) GetBySource(ctx context.Context, source string) ([]ExternalSubscription, error) {
+	query := `SELECT ` + externalSubscriptionColumns + ` FROM external_subscriptions WHERE "source" = $1;`
+	return t.query(ctx, query, source)
+}
+
+func (t *ExternalSubscriptionsTable) query(ctx context.Context, query string, args ...interface{}) ([]ExternalSubscription, error) {
+	rows, err := t.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var subscriptions []ExternalSubscription
+	for rows.Next() {
+		var sub ExternalSubscription
+		if err := rows.Scan(
+			&sub.Source,
+			&sub.Reference,
+			&sub.Email,
+			&sub.DiscordId,
+			&sub.Tier,
+			&sub.Status,
+			&sub.StartedAt,
+			&sub.ExpiresAt,
+			&sub.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+
+		subscriptions = append(subscriptions, sub)
+	}
+
+	return subscriptions, rows.Err()
+}
+
+// Upsert stores the subscription, unless a newer update for the same subscription has already been stored. Webhooks
+// are not guaranteed to be delivered in order.
+func (t *ExternalSubscriptionsTable) Upsert(ctx context.Context, sub ExternalSubscription) error {
+	return upsertExternalSubscription(ctx, t.pool, sub)
+}
+
+// UpsertMany stores the subscriptions in a single transaction, so that a failed import leaves no partial state
+func (t *ExternalSubscriptionsTable) UpsertMany(ctx context.Context, subs []ExternalSubscription) error {
+	tx, err := t.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(ctx)
+
+	for _, sub := range subs {
+		if err := upsertExternalSubscription(ctx, tx, sub); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+func upsertExternalSubscription(ctx context.Context, exec executor, sub ExternalSubscription) error {
+	query := `
+INSERT INTO external_subscriptions(` + externalSubscriptionColumns + `)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+ON CONFLICT("source", "reference") DO UPDATE SET
+	"email" = COALESCE(EXCLUDED."email", external_subscriptions."email"),
+	"discord_id" = COALESCE(EXCLUDED."discord_id", external_subscriptions."discord_id"),
+	"tier" = EXCLUDED."tier",
+	"status" = EXCLUDED."status",
+	"started_at" = EXCLUDED."started_at",
+	"expires_at" = EXCLUDED."expires_at",
+	"updated_at" = EXCLUDED."updated_at"
+WHERE external_subscriptions."updated_at" <= EXCLUDED."updated_at";`
+
+	_, err := exec.Exec(ctx, query,
+		sub.Source,
+		sub.Reference,
+		sub.Email,
+		sub.DiscordId,
+		sub.Tier,
+		sub.Status,
+		sub.StartedAt,
+		sub.ExpiresAt,
+		sub.UpdatedAt,
+	)
+
+	return err
+}
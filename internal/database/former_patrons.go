@@ -0,0 +1,112 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// FormerPatronsTable records patrons whose pledge ended, with their last tiers, so that they can still be looked up for
+// a while after Patreon stops listing them
+type FormerPatronsTable struct {
+	pool *pgxpool.Pool
+}
+
+type FormerPatron struct {
+	PatronId  uint64
+	Email     string
+	DiscordId *uint64
+	LastTiers []uint64
+	EndedAt   time.Time
+}
+
+func newFormerPatronsTable(pool *pgxpool.Pool) *FormerPatronsTable {
+	return &FormerPatronsTable{
+		pool: pool,
+	}
+}
+
+func (t *FormerPatronsTable) Schema() string {
+	return `
+CREATE TABLE IF NOT EXISTS former_patrons(
+	"patron_id" int8 NOT NULL,
+	"email" varchar(320) NOT NULL,
+	"discord_id" int8 NULL,
+	"last_tiers" int8[] NOT NULL,
+	"ended_at" timestamptz NOT NULL,
+	PRIMARY KEY("patron_id")
+);
+CREATE INDEX IF NOT EXISTS former_patrons_ended_at ON former_patrons("ended_at");
+`
+}
+
+// Set records that the patron's pledge ended, replacing any earlier record of theirs
+func (t *FormerPatronsTable) Set(ctx context.Context, patron FormerPatron) error {
+	// pgx doesn't encode []uint64 as an int8 array
+	lastTiers := make([]int64, len(patron.LastTiers))
+	for i, tierId := range patron.LastTiers {
+		lastTiers[i] = int64(tierId)
+	}
+
+	query := `
+INSERT INTO former_patrons("patron_id", "email", "discord_id", "last_tiers", "ended_at")
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT("patron_id") DO UPDATE SET
+	"email" = EXCLUDED."email",
+	"discord_id" = EXCLUDED."discord_id",
+	"last_tiers" = EXCLUDED."last_tiers",
+	"ended_at" = EXCLUDED."ended_at";`
+
+	_, err := t.pool.Exec(ctx, query, patron.PatronId, patron.Email, patron.DiscordId, lastTiers, patron.EndedAt)
+	return err
+}
+
+// Delete removes the record of the patron, such as when they pledge again
+func (t *FormerPatronsTable) Delete(ctx context.Context, patronId uint64) error {
+	_, err := t.pool.Exec(ctx, `DELETE FROM former_patrons WHERE "patron_id" = $1;`, patronId)
+	return err
+}
+
+// EndedSince returns the former patrons whose pledge ended after the given time
+func (t *FormerPatronsTable) EndedSince(ctx context.Context, since time.Time) ([]FormerPatron, error) {
+	query := `
+SELECT "patron_id", "email", "discord_id", "last_tiers", "ended_at"
+FROM former_patrons
+WHERE "ended_at" > $1;`
+
+	rows, err := t.pool.Query(ctx, query, since)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var patrons []FormerPatron
+	for rows.Next() {
+		var patron FormerPatron
+		var lastTiers []int64
+		if err := rows.Scan(&patron.PatronId, &patron.Email, &patron.DiscordId, &lastTiers, &patron.EndedAt); err != nil {
+			return nil, err
+		}
+
+		patron.LastTiers = make([]uint64, len(lastTiers))
+		for i, tierId := range lastTiers {
+			patron.LastTiers[i] = uint64(tierId)
+		}
+
+		patrons = append(patrons, patron)
+	}
+
+	return patrons, rows.Err()
+}
+
+// Prune deletes former patrons whose pledge ended before the given time, removing their email and Discord ID
+func (t *FormerPatronsTable) Prune(ctx context.Context, before time.Time) (int64, error) {
+	res, err := t.pool.Exec(ctx, `DELETE FROM former_patrons WHERE "ended_at" < $1;`, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected(), nil
+}
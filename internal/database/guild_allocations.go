@@ -0,0 +1,145 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+var (
+	ErrAlreadyAllocated = errors.New("guild is already allocated by this user")
+	ErrAllocationLimit  = errors.New("user has no allocations remaining")
+)
+
+// GuildAllocationsTable stores the guilds that users have allocated their premium to, through /premium assign. A guild
+// may be allocated by several users, and is premium while any of them is entitled.
+type GuildAllocationsTable struct {
+	pool *pgxpool.Pool
+}
+
+type GuildAllocation struct {
+	GuildId     uint64
+	DiscordId   uint64
+	AllocatedAt time.Time
+}
+
+func newGuildAllocationsTable(pool *pgxpool.Pool) *GuildAllocationsTable {
+	return &GuildAllocationsTable{
+		pool: pool,
+	}
+}
+
+func (t *GuildAllocationsTable) Schema() string {
+	return `
+CREATE TABLE IF NOT EXISTS guild_allocations(
+	"guild_id" int8 NOT NULL,
+	"discord_id" int8 NOT NULL,
+	"allocated_at" timestamptz NOT NULL,
+	PRIMARY KEY("guild_id", "discord_id")
+);
+CREATE INDEX IF NOT EXISTS guild_allocations_discord_id ON guild_allocations("discord_id");
+`
+}
+
+func (t *GuildAllocationsTable) GetByGuild(ctx context.Context, guildId uint64) ([]GuildAllocation, error) {
+	return t.query(ctx, `SELECT "guild_id", "discord_id", "allocated_at" FROM guild_allocations WHERE "guild_id" = $1 ORDER BY "allocated_at";`, guildId)
+}
+
+// GetByUser returns the user's allocations, oldest first
+func (t *GuildAllocationsTable) GetByUser(ctx context.Context, discordId uint64) ([]GuildAllocation, error) {
+	return t.query(ctx, `SELECT "guild_id", "discord_id", "allocated_at" FROM guild_allocations WHERE "discord_id" = $1 ORDER BY "allocated_at";`, discordId)
+}
+
+// GetAll returns every allocation, ordered by guild and then oldest first
+func (t *GuildAllocationsTable) GetAll(ctx context.Context) ([]GuildAllocation, error) {
+	return t.query(ctx, `SELECT "guild_id", "discord_id", "allocated_at" FROM guild_allocations ORDER BY "guild_id", "allocated_at";`)
+}
+
+func (t *GuildAllocationsTable) query(ctx context.Context, query string, args ...any) ([]GuildAllocation, error) {
+	rows, err := t.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var allocations []GuildAllocation
+	for rows.Next() {
+		var allocation GuildAllocation
+		if err := rows.Scan(&allocation.GuildId, &allocation.DiscordId, &allocation.AllocatedAt); err != nil {
+			return nil, err
+		}
+
+		allocations = append(allocations, allocation)
+	}
+
+	return allocations, rows.Err()
+}
+
+// Allocate allocates the guild to the user and records it in the audit log, unless the user already has limit
+// allocations. The user's allocations are locked for the transaction, so that concurrent requests can't exceed the
+// limit.
+func (t *GuildAllocationsTable) Allocate(ctx context.Context, guildId, discordId uint64, limit int) error {
+	tx, err := t.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1);`, int64(discordId)); err != nil {
+		return err
+	}
+
+	var count int
+	var alreadyAllocated bool
+	query := `SELECT COUNT(*), COALESCE(BOOL_OR("guild_id" = $2), false) FROM guild_allocations WHERE "discord_id" = $1;`
+	if err := tx.QueryRow(ctx, query, discordId, guildId).Scan(&count, &alreadyAllocated); err != nil {
+		return err
+	}
+
+	if alreadyAllocated {
+		return ErrAlreadyAllocated
+	}
+
+	if count >= limit {
+		return ErrAllocationLimit
+	}
+
+	if _, err := tx.Exec(ctx, `INSERT INTO guild_allocations("guild_id", "discord_id", "allocated_at") VALUES ($1, $2, NOW());`, guildId, discordId); err != nil {
+		return err
+	}
+
+	if err := createAuditLogEntry(ctx, tx, discordId, "guild_allocated", map[string]any{"guild_id": guildId}); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Remove deallocates the guild from the user, returning false if it was not allocated
+func (t *GuildAllocationsTable) Remove(ctx context.Context, guildId, discordId uint64) (bool, error) {
+	tx, err := t.pool.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `DELETE FROM guild_allocations WHERE "guild_id" = $1 AND "discord_id" = $2;`, guildId, discordId)
+	if err != nil {
+		return false, err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return false, nil
+	}
+
+	if err := createAuditLogEntry(ctx, tx, discordId, "guild_deallocated", map[string]any{"guild_id": guildId}); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit(ctx)
+}
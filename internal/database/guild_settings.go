@@ -0,0 +1,146 @@
+package database
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// GuildSettingsTable stores the settings of allowed guilds that override the global config, set through
+// /admin settings. Guilds without a row use the global config.
+type GuildSettingsTable struct {
+	pool *pgxpool.Pool
+}
+
+// GuildSettings are the settings of a guild. Branding left unset falls back to the global config.
+type GuildSettings struct {
+	GuildId          uint64
+	DisabledCommands []string // Paths of the commands that can't be run in the guild, such as "subscription stats mrr"
+	HiddenTiers      []uint64 // Tiers left out of lookups and /tiers list in the guild
+	PrimaryColor     *int
+	ErrorColor       *int
+	FooterText       *string
+	Ephemeral        bool // Responses to commands are only shown to the member who ran the command
+	UpdatedBy        uint64
+	UpdatedAt        time.Time
+}
+
+// CommandEnabled returns whether the command with the path can be run in the guild
+func (s GuildSettings) CommandEnabled(path string) bool {
+	return !slices.Contains(s.DisabledCommands, path)
+}
+
+// TierVisible returns whether the tier is shown in the guild
+func (s GuildSettings) TierVisible(tierId uint64) bool {
+	return !slices.Contains(s.HiddenTiers, tierId)
+}
+
+func newGuildSettingsTable(pool *pgxpool.Pool) *GuildSettingsTable {
+	return &GuildSettingsTable{
+		pool: pool,
+	}
+}
+
+func (t *GuildSettingsTable) Schema() string {
+	return `
+CREATE TABLE IF NOT EXISTS guild_settings(
+	"guild_id" int8 NOT NULL,
+	"disabled_commands" text[] NOT NULL DEFAULT '{}',
+	"hidden_tiers" int8[] NOT NULL DEFAULT '{}',
+	"primary_color" int4,
+	"error_color" int4,
+	"footer_text" varchar(2048),
+	"ephemeral" bool NOT NULL DEFAULT false,
+	"updated_by" int8 NOT NULL,
+	"updated_at" timestamptz NOT NULL,
+	PRIMARY KEY("guild_id")
+);
+`
+}
+
+// GetAll returns the settings of every guild that has any, by guild ID
+func (t *GuildSettingsTable) GetAll(ctx context.Context) (map[uint64]GuildSettings, error) {
+	query := `
+SELECT "guild_id", "disabled_commands", "hidden_tiers", "primary_color", "error_color", "footer_text", "ephemeral", "updated_by", "updated_at"
+FROM guild_settings;`
+
+	rows, err := t.pool.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	settings := make(map[uint64]GuildSettings)
+	for rows.Next() {
+		var s GuildSettings
+		if err := rows.Scan(
+			&s.GuildId, &s.DisabledCommands, &s.HiddenTiers, &s.PrimaryColor, &s.ErrorColor, &s.FooterText, &s.Ephemeral,
+			&s.UpdatedBy, &s.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+
+		settings[s.GuildId] = s
+	}
+
+	return settings, rows.Err()
+}
+
+// Set replaces the settings of the guild, and records the change in the audit log
+func (t *GuildSettingsTable) Set(ctx context.Context, settings GuildSettings) error {
+	tx, err := t.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(ctx)
+
+	query := `
+INSERT INTO guild_settings("guild_id", "disabled_commands", "hidden_tiers", "primary_color", "error_color", "footer_text", "ephemeral", "updated_by", "updated_at")
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+ON CONFLICT("guild_id") DO UPDATE SET
+	"disabled_commands" = EXCLUDED."disabled_commands",
+	"hidden_tiers" = EXCLUDED."hidden_tiers",
+	"primary_color" = EXCLUDED."primary_color",
+	"error_color" = EXCLUDED."error_color",
+	"footer_text" = EXCLUDED."footer_text",
+	"ephemeral" = EXCLUDED."ephemeral",
+	"updated_by" = EXCLUDED."updated_by",
+	"updated_at" = EXCLUDED."updated_at";`
+
+	// Empty arrays are stored rather than NULL, as the columns can't be NULL
+	disabledCommands, hiddenTiers := settings.DisabledCommands, settings.HiddenTiers
+	if disabledCommands == nil {
+		disabledCommands = []string{}
+	}
+
+	if hiddenTiers == nil {
+		hiddenTiers = []uint64{}
+	}
+
+	if _, err := tx.Exec(
+		ctx, query, settings.GuildId, disabledCommands, hiddenTiers, settings.PrimaryColor, settings.ErrorColor,
+		settings.FooterText, settings.Ephemeral, settings.UpdatedBy, settings.UpdatedAt,
+	); err != nil {
+		return err
+	}
+
+	details := map[string]any{
+		"guild_id":          settings.GuildId,
+		"disabled_commands": disabledCommands,
+		"hidden_tiers":      hiddenTiers,
+		"primary_color":     settings.PrimaryColor,
+		"error_color":       settings.ErrorColor,
+		"footer_text":       settings.FooterText,
+		"ephemeral":         settings.Ephemeral,
+	}
+
+	if err := createAuditLogEntry(ctx, tx, settings.UpdatedBy, "guild_settings_updated", details); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
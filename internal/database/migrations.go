@@ -0,0 +1,289 @@
+package database
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/pkg/errors"
+)
+
+// migrationFiles are the schema changes made after the baseline, named as described in migrations/README.md
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// migrationLockId is the key of the advisory lock held while changing the schema, so that replicas rolling out at the
+// same time apply each migration once
+const migrationLockId int64 = 0x7375627363726962 // "subscrib"
+
+// baselineVersion is the version of the migration that creates every table, which can't be reverted
+const baselineVersion = 1
+
+type Migration struct {
+	Version int
+	Name    string
+	up      string
+	down    string // Empty if the migration can't be reverted
+}
+
+// MigrationStatus is a migration, and when it was applied, if it has been
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Migrations returns every migration in order, starting with the baseline
+func (d *Database) Migrations() ([]Migration, error) {
+	byVersion := map[int]*Migration{
+		baselineVersion: {
+			Version: baselineVersion,
+			Name:    "baseline",
+			up:      d.baselineSchema(),
+		},
+	}
+
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+
+		match := migrationFilePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %s", entry.Name())
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		if version <= baselineVersion {
+			return nil, fmt.Errorf("migration %s must have a version after the baseline", entry.Name())
+		}
+
+		contents, err := migrationFiles.ReadFile("migrations/" + entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has files with different names", version)
+		}
+
+		if match[3] == "up" {
+			migration.up = string(contents)
+		} else {
+			migration.down = string(contents)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.up == "" {
+			return nil, fmt.Errorf("migration %d has no up file", migration.Version)
+		}
+
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// MigrationStatuses returns every migration, with when each was applied
+func (d *Database) MigrationStatuses(ctx context.Context) ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+	err := d.withMigrationLock(ctx, func(conn *pgxpool.Conn) error {
+		var err error
+		statuses, err = d.migrationStatuses(ctx, conn)
+		return err
+	})
+
+	return statuses, err
+}
+
+// MigrateUp applies every migration that hasn't been applied, in order, returning those applied
+func (d *Database) MigrateUp(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+	err := d.withMigrationLock(ctx, func(conn *pgxpool.Conn) error {
+		var err error
+		applied, err = d.migrateUp(ctx, conn)
+		return err
+	})
+
+	return applied, err
+}
+
+// migrateUp applies every migration that hasn't been applied. The caller must hold the migration lock.
+func (d *Database) migrateUp(ctx context.Context, conn *pgxpool.Conn) ([]Migration, error) {
+	statuses, err := d.migrationStatuses(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	for _, status := range statuses {
+		if status.AppliedAt != nil {
+			continue
+		}
+
+		if err := applyMigration(ctx, conn, status.Migration, status.up, func(tx pgx.Tx) error {
+			_, err := tx.Exec(ctx, `INSERT INTO schema_migrations("version", "name", "applied_at") VALUES ($1, $2, NOW());`, status.Version, status.Name)
+			return err
+		}); err != nil {
+			return applied, err
+		}
+
+		applied = append(applied, status.Migration)
+	}
+
+	return applied, nil
+}
+
+// MigrateDown reverts the latest applied migration, returning it, or false if none have been applied
+func (d *Database) MigrateDown(ctx context.Context) (Migration, bool, error) {
+	var reverted Migration
+	var ok bool
+	err := d.withMigrationLock(ctx, func(conn *pgxpool.Conn) error {
+		statuses, err := d.migrationStatuses(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(statuses) - 1; i >= 0; i-- {
+			if statuses[i].AppliedAt == nil {
+				continue
+			}
+
+			migration := statuses[i].Migration
+			if migration.down == "" {
+				return fmt.Errorf("migration %d_%s can't be reverted", migration.Version, migration.Name)
+			}
+
+			if err := applyMigration(ctx, conn, migration, migration.down, func(tx pgx.Tx) error {
+				_, err := tx.Exec(ctx, `DELETE FROM schema_migrations WHERE "version" = $1;`, migration.Version)
+				return err
+			}); err != nil {
+				return err
+			}
+
+			reverted, ok = migration, true
+			return nil
+		}
+
+		return nil
+	})
+
+	return reverted, ok, err
+}
+
+func (d *Database) migrationStatuses(ctx context.Context, conn *pgxpool.Conn) ([]MigrationStatus, error) {
+	migrations, err := d.Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+CREATE TABLE IF NOT EXISTS schema_migrations(
+	"version" int4 NOT NULL,
+	"name" varchar(255) NOT NULL,
+	"applied_at" timestamptz NOT NULL,
+	PRIMARY KEY("version")
+);`
+
+	if _, err := conn.Exec(ctx, query); err != nil {
+		return nil, errors.Wrap(err, "failed to create schema_migrations table")
+	}
+
+	rows, err := conn.Query(ctx, `SELECT "version", "applied_at" FROM schema_migrations;`)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	appliedAt := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+
+		appliedAt[version] = at
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, len(migrations))
+	for i, migration := range migrations {
+		statuses[i] = MigrationStatus{Migration: migration}
+		if at, ok := appliedAt[migration.Version]; ok {
+			statuses[i].AppliedAt = &at
+		}
+	}
+
+	return statuses, nil
+}
+
+// applyMigration runs the SQL and records the change in a single transaction, so that a failed migration leaves
+// nothing behind
+func applyMigration(ctx context.Context, conn *pgxpool.Conn, migration Migration, sql string, record func(tx pgx.Tx) error) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, sql); err != nil {
+		return errors.Wrapf(err, "migration %d_%s failed", migration.Version, migration.Name)
+	}
+
+	if err := record(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// withMigrationLock runs fn on a connection holding the migration lock, waiting for other replicas to release it.
+// Advisory locks belong to the session, so the lock is taken and released on the same connection.
+func (d *Database) withMigrationLock(ctx context.Context, fn func(conn *pgxpool.Conn) error) error {
+	conn, err := d.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1);`, migrationLockId); err != nil {
+		return errors.Wrap(err, "failed to take migration lock")
+	}
+
+	// The lock is released with a fresh context, as ctx may be why fn returned
+	defer conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1);`, migrationLockId)
+
+	return fn(conn)
+}
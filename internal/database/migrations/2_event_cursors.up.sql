@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS event_cursors(
+	"name" varchar(64) NOT NULL,
+	"last_id" int8 NOT NULL,
+	"updated_at" timestamptz NOT NULL,
+	PRIMARY KEY("name")
+);
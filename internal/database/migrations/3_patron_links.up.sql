@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS patron_links(
+	"patron_id" int8 NOT NULL,
+	"discord_id" int8 NOT NULL,
+	"linked_at" timestamptz NOT NULL,
+	PRIMARY KEY("patron_id")
+);
+CREATE INDEX IF NOT EXISTS patron_links_discord_id ON patron_links("discord_id");
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS former_patrons(
+	"patron_id" int8 NOT NULL,
+	"email" varchar(320) NOT NULL,
+	"discord_id" int8 NULL,
+	"last_tiers" int8[] NOT NULL,
+	"ended_at" timestamptz NOT NULL,
+	PRIMARY KEY("patron_id")
+);
+CREATE INDEX IF NOT EXISTS former_patrons_ended_at ON former_patrons("ended_at");
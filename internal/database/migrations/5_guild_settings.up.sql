@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS guild_settings(
+	"guild_id" int8 NOT NULL,
+	"disabled_commands" text[] NOT NULL DEFAULT '{}',
+	"hidden_tiers" int8[] NOT NULL DEFAULT '{}',
+	"primary_color" int4,
+	"error_color" int4,
+	"footer_text" varchar(2048),
+	"ephemeral" bool NOT NULL DEFAULT false,
+	"updated_by" int8 NOT NULL,
+	"updated_at" timestamptz NOT NULL,
+	PRIMARY KEY("guild_id")
+);
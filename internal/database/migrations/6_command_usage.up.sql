@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS command_usage(
+	"id" SERIAL8 NOT NULL,
+	"command" varchar(100) NOT NULL,
+	"user_id" int8 NOT NULL,
+	"guild_id" int8 NULL,
+	"duration_ms" int4 NOT NULL,
+	"used_at" timestamptz NOT NULL,
+	PRIMARY KEY("id")
+);
+CREATE INDEX IF NOT EXISTS command_usage_used_at ON command_usage("used_at");
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS reconciliation_counts(
+	"kind" varchar(32) NOT NULL,
+	"count" int4 NOT NULL,
+	"updated_at" timestamptz NOT NULL,
+	PRIMARY KEY("kind")
+);
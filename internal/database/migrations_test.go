@@ -0,0 +1,139 @@
+package database
+
+import (
+	"context"
+	"os"
+	"regexp"
+	"testing"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// destructiveStatement matches statements that would lose data if a migration is applied to a table that already has
+// its change
+var destructiveStatement = regexp.MustCompile(`(?i)\b(DROP\s+(TABLE|COLUMN)|TRUNCATE)\b`)
+
+func TestUpMigrationsKeepData(t *testing.T) {
+	migrations, err := NewDatabase(nil).Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, migration := range migrations {
+		if destructiveStatement.MatchString(migration.up) {
+			t.Errorf("migration %d_%s drops data when applied", migration.Version, migration.Name)
+		}
+	}
+}
+
+// testDatabase connects to the Postgres database in TEST_DATABASE_URL, skipping the test if it isn't set. Every table
+// is dropped before and after the test, so the database must not be used for anything else.
+func testDatabase(t *testing.T) *Database {
+	t.Helper()
+
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	ctx := context.Background()
+	pool, err := pgxpool.Connect(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dropSchema := func() {
+		if _, err := pool.Exec(ctx, `DROP SCHEMA public CASCADE; CREATE SCHEMA public;`); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dropSchema()
+	t.Cleanup(func() {
+		dropSchema()
+		pool.Close()
+	})
+
+	return NewDatabase(pool)
+}
+
+func TestMigrateUpAfterCreateTables(t *testing.T) {
+	ctx := context.Background()
+	db := testDatabase(t)
+
+	if err := db.CreateTables(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	statuses, err := db.MigrationStatuses(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			t.Errorf("expected migration %d_%s to be recorded as applied on startup", status.Version, status.Name)
+		}
+	}
+
+	if err := db.EventCursors.Set(ctx, "nats", 42); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.PatronLinks.Link(ctx, 1234, 5678); err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err := db.MigrateUp(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(applied) != 0 {
+		t.Errorf("expected no migrations to apply after startup, applied %d", len(applied))
+	}
+
+	// A restart applies nothing either
+	if err := db.CreateTables(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if lastId, err := db.EventCursors.Get(ctx, "nats"); err != nil || lastId != 42 {
+		t.Errorf("expected the event cursor to survive, got %d and %v", lastId, err)
+	}
+
+	if links, err := db.PatronLinks.GetAll(ctx); err != nil || links[1234] != 5678 {
+		t.Errorf("expected the patron link to survive, got %v and %v", links, err)
+	}
+}
+
+func TestCreateTablesAppliesPendingMigrations(t *testing.T) {
+	ctx := context.Background()
+	db := testDatabase(t)
+
+	// A database created by startup before migrations were recorded, with every table but no migrations recorded
+	if _, err := db.pool.Exec(ctx, db.baselineSchema()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.EventCursors.Set(ctx, "nats", 42); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.CreateTables(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err := db.MigrateUp(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(applied) != 0 {
+		t.Errorf("expected startup to apply every migration, %d were left", len(applied))
+	}
+
+	if lastId, err := db.EventCursors.Get(ctx, "nats"); err != nil || lastId != 42 {
+		t.Errorf("expected the event cursor to survive, got %d and %v", lastId, err)
+	}
+}
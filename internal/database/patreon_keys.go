@@ -0,0 +1,69 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// PatreonKeysTable stores the Patreon OAuth tokens of each client. Rows are added when credentials are first set up,
+// either by the tokens bootstrap command or by hand.
+type PatreonKeysTable struct {
+	pool *pgxpool.Pool
+}
+
+type PatreonKeys struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresAt    time.Time
+}
+
+func newPatreonKeysTable(pool *pgxpool.Pool) *PatreonKeysTable {
+	return &PatreonKeysTable{
+		pool: pool,
+	}
+}
+
+func (t *PatreonKeysTable) Schema() string {
+	return `
+CREATE TABLE IF NOT EXISTS patreon_keys(
+	"client_id" varchar(255) NOT NULL,
+	"access_token" text NOT NULL,
+	"refresh_token" text NOT NULL,
+	"expires" timestamptz NOT NULL,
+	PRIMARY KEY("client_id")
+);
+`
+}
+
+// Get returns the tokens of the client, and whether any are stored
+func (t *PatreonKeysTable) Get(ctx context.Context, clientId string) (PatreonKeys, bool, error) {
+	query := `SELECT "access_token", "refresh_token", "expires" FROM patreon_keys WHERE "client_id" = $1;`
+
+	var keys PatreonKeys
+	if err := t.pool.QueryRow(ctx, query, clientId).Scan(&keys.AccessToken, &keys.RefreshToken, &keys.ExpiresAt); err != nil {
+		if err == pgx.ErrNoRows {
+			return PatreonKeys{}, false, nil
+		}
+
+		return PatreonKeys{}, false, err
+	}
+
+	return keys, true, nil
+}
+
+// Set replaces the tokens of a client, adding a row if it has none. Tables created by hand may not have a primary key,
+// so the row is updated before falling back to inserting it, rather than relying on ON CONFLICT.
+func (t *PatreonKeysTable) Set(ctx context.Context, clientId string, keys PatreonKeys) error {
+	query := `UPDATE patreon_keys SET "access_token" = $1, "refresh_token" = $2, "expires" = $3 WHERE "client_id" = $4;`
+	res, err := t.pool.Exec(ctx, query, keys.AccessToken, keys.RefreshToken, keys.ExpiresAt, clientId)
+	if err != nil || res.RowsAffected() > 0 {
+		return err
+	}
+
+	query = `INSERT INTO patreon_keys("client_id", "access_token", "refresh_token", "expires") VALUES ($1, $2, $3, $4);`
+	_, err = t.pool.Exec(ctx, query, clientId, keys.AccessToken, keys.RefreshToken, keys.ExpiresAt)
+	return err
+}
@@ -0,0 +1,173 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// PatronHistoryTable stores the events detected between Patreon snapshots
+type PatronHistoryTable struct {
+	pool *pgxpool.Pool
+}
+
+type PatronHistoryEntry struct {
+	Id          int64
+	PatronId    uint64
+	Event       string
+	Details     json.RawMessage
+	EffectiveAt *time.Time // When the event took effect, which may be before it was recorded
+	CreatedAt   time.Time
+}
+
+func newPatronHistoryTable(pool *pgxpool.Pool) *PatronHistoryTable {
+	return &PatronHistoryTable{
+		pool: pool,
+	}
+}
+
+func (t *PatronHistoryTable) Schema() string {
+	return `
+CREATE TABLE IF NOT EXISTS patron_history(
+	"id" SERIAL8 NOT NULL,
+	"patron_id" int8 NOT NULL,
+	"event" varchar(32) NOT NULL,
+	"details" jsonb NOT NULL,
+	"created_at" timestamptz NOT NULL,
+	PRIMARY KEY("id")
+);
+CREATE INDEX IF NOT EXISTS patron_history_patron_id ON patron_history("patron_id");
+CREATE INDEX IF NOT EXISTS patron_history_created_at ON patron_history("created_at");
+ALTER TABLE patron_history ADD COLUMN IF NOT EXISTS "effective_at" timestamptz NULL;
+`
+}
+
+// InsertMany stores the entries in a single transaction. The ID and creation time of the entries are ignored.
+func (t *PatronHistoryTable) InsertMany(ctx context.Context, entries []PatronHistoryEntry) error {
+	tx, err := t.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(ctx)
+
+	query := `
+INSERT INTO patron_history("patron_id", "event", "details", "effective_at", "created_at")
+VALUES ($1, $2, $3, $4, NOW());`
+
+	for _, entry := range entries {
+		if _, err := tx.Exec(ctx, query, entry.PatronId, entry.Event, entry.Details, entry.EffectiveAt); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetByEvents returns the entries with one of the events that took effect after since, oldest first. Entries recorded
+// before effective dates were tracked are dated by when they were recorded.
+func (t *PatronHistoryTable) GetByEvents(ctx context.Context, events []string, since time.Time) ([]PatronHistoryEntry, error) {
+	query := `
+SELECT "id", "patron_id", "event", "details", COALESCE("effective_at", "created_at"), "created_at"
+FROM patron_history
+WHERE "event" = ANY($1) AND COALESCE("effective_at", "created_at") > $2
+ORDER BY COALESCE("effective_at", "created_at"), "id";`
+
+	return t.query(ctx, query, events, since)
+}
+
+// LatestByPatron returns the most recent entry with one of the events for each patron, if it took effect after since
+func (t *PatronHistoryTable) LatestByPatron(ctx context.Context, events []string, since time.Time) ([]PatronHistoryEntry, error) {
+	query := `
+SELECT DISTINCT ON ("patron_id") "id", "patron_id", "event", "details", "effective_at", "created_at"
+FROM patron_history
+WHERE "event" = ANY($1) AND "effective_at" > $2
+ORDER BY "patron_id", "effective_at" DESC;`
+
+	return t.query(ctx, query, events, since)
+}
+
+// After returns up to limit entries recorded after the entry with the ID, in the order they were recorded
+func (t *PatronHistoryTable) After(ctx context.Context, id int64, limit int) ([]PatronHistoryEntry, error) {
+	query := `
+SELECT "id", "patron_id", "event", "details", COALESCE("effective_at", "created_at"), "created_at"
+FROM patron_history
+WHERE "id" > $1
+ORDER BY "id"
+LIMIT $2;`
+
+	return t.query(ctx, query, id, limit)
+}
+
+// ByPatron returns the entries of a patron, newest first, skipping the first offset entries
+func (t *PatronHistoryTable) ByPatron(ctx context.Context, patronId uint64, limit, offset int) ([]PatronHistoryEntry, error) {
+	query := `
+SELECT "id", "patron_id", "event", "details", COALESCE("effective_at", "created_at"), "created_at"
+FROM patron_history
+WHERE "patron_id" = $1
+ORDER BY COALESCE("effective_at", "created_at") DESC, "id" DESC
+LIMIT $2 OFFSET $3;`
+
+	return t.query(ctx, query, patronId, limit, offset)
+}
+
+// CountByPatron returns the number of entries recorded for a patron
+func (t *PatronHistoryTable) CountByPatron(ctx context.Context, patronId uint64) (int, error) {
+	var count int
+	err := t.pool.QueryRow(ctx, `SELECT COUNT(*) FROM patron_history WHERE "patron_id" = $1;`, patronId).Scan(&count)
+	return count, err
+}
+
+// PatronIds returns the IDs of every patron with at least one entry
+func (t *PatronHistoryTable) PatronIds(ctx context.Context) (map[uint64]struct{}, error) {
+	rows, err := t.pool.Query(ctx, `SELECT DISTINCT "patron_id" FROM patron_history;`)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	patronIds := make(map[uint64]struct{})
+	for rows.Next() {
+		var patronId uint64
+		if err := rows.Scan(&patronId); err != nil {
+			return nil, err
+		}
+
+		patronIds[patronId] = struct{}{}
+	}
+
+	return patronIds, rows.Err()
+}
+
+func (t *PatronHistoryTable) query(ctx context.Context, query string, args ...any) ([]PatronHistoryEntry, error) {
+	rows, err := t.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var entries []PatronHistoryEntry
+	for rows.Next() {
+		var entry PatronHistoryEntry
+		if err := rows.Scan(&entry.Id, &entry.PatronId, &entry.Event, &entry.Details, &entry.EffectiveAt, &entry.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+func (t *PatronHistoryTable) Prune(ctx context.Context, before time.Time) (int64, error) {
+	res, err := t.pool.Exec(ctx, `DELETE FROM patron_history WHERE "created_at" < $1;`, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected(), nil
+}
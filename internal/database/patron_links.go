@@ -0,0 +1,78 @@
+package database
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// PatronLinksTable stores Patreon user -> Discord account links verified through the link page, for patrons who haven't
+// connected Discord in Patreon's settings
+type PatronLinksTable struct {
+	pool *pgxpool.Pool
+}
+
+func newPatronLinksTable(pool *pgxpool.Pool) *PatronLinksTable {
+	return &PatronLinksTable{
+		pool: pool,
+	}
+}
+
+func (t *PatronLinksTable) Schema() string {
+	return `
+CREATE TABLE IF NOT EXISTS patron_links(
+	"patron_id" int8 NOT NULL,
+	"discord_id" int8 NOT NULL,
+	"linked_at" timestamptz NOT NULL,
+	PRIMARY KEY("patron_id")
+);
+CREATE INDEX IF NOT EXISTS patron_links_discord_id ON patron_links("discord_id");
+`
+}
+
+// GetAll returns the Discord account linked to each patron
+func (t *PatronLinksTable) GetAll(ctx context.Context) (map[uint64]uint64, error) {
+	rows, err := t.pool.Query(ctx, `SELECT "patron_id", "discord_id" FROM patron_links;`)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	links := make(map[uint64]uint64)
+	for rows.Next() {
+		var patronId, discordId uint64
+		if err := rows.Scan(&patronId, &discordId); err != nil {
+			return nil, err
+		}
+
+		links[patronId] = discordId
+	}
+
+	return links, rows.Err()
+}
+
+// Link links the patron to the Discord account, replacing any previous link, and records it in the audit log
+func (t *PatronLinksTable) Link(ctx context.Context, patronId, discordId uint64) error {
+	tx, err := t.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(ctx)
+
+	query := `
+INSERT INTO patron_links("patron_id", "discord_id", "linked_at")
+VALUES ($1, $2, NOW())
+ON CONFLICT("patron_id") DO UPDATE SET "discord_id" = EXCLUDED."discord_id", "linked_at" = EXCLUDED."linked_at";`
+
+	if _, err := tx.Exec(ctx, query, patronId, discordId); err != nil {
+		return err
+	}
+
+	if err := createAuditLogEntry(ctx, tx, discordId, "patron_linked", map[string]any{"patron_id": patronId}); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,145 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// PatronSnapshotTable stores the latest Patreon snapshot, so that it can be queried outside the app
+type PatronSnapshotTable struct {
+	pool *pgxpool.Pool
+}
+
+type SnapshotPatron struct {
+	Email                        string
+	PatronId                     uint64
+	DiscordId                    *uint64
+	Tiers                        []uint64
+	PatronStatus                 string
+	LastChargeStatus             string
+	LastChargeDate               *time.Time
+	PledgeRelationshipStart      *time.Time
+	CurrentlyEntitledAmountCents int
+	LifetimeSupportCents         int
+}
+
+var snapshotColumns = []string{
+	"email",
+	"patron_id",
+	"discord_id",
+	"tiers",
+	"patron_status",
+	"last_charge_status",
+	"last_charge_date",
+	"pledge_relationship_start",
+	"currently_entitled_amount_cents",
+	"lifetime_support_cents",
+}
+
+func newPatronSnapshotTable(pool *pgxpool.Pool) *PatronSnapshotTable {
+	return &PatronSnapshotTable{
+		pool: pool,
+	}
+}
+
+func (t *PatronSnapshotTable) Schema() string {
+	return `
+CREATE TABLE IF NOT EXISTS patron_snapshot(
+	"email" text NOT NULL,
+	"patron_id" int8 NOT NULL,
+	"discord_id" int8,
+	"tiers" int8[] NOT NULL,
+	"patron_status" text NOT NULL,
+	"last_charge_status" text NOT NULL,
+	"last_charge_date" timestamptz,
+	"pledge_relationship_start" timestamptz,
+	"currently_entitled_amount_cents" int4 NOT NULL,
+	"lifetime_support_cents" int4 NOT NULL,
+	"updated_at" timestamptz NOT NULL DEFAULT NOW(),
+	PRIMARY KEY("email")
+);
+CREATE INDEX IF NOT EXISTS patron_snapshot_discord_id ON patron_snapshot("discord_id");
+`
+}
+
+// Replace replaces the stored snapshot with the patrons. Rather than upserting each row, the patrons are copied into a
+// staging table, which is merged into the snapshot with a single statement. Rows that haven't changed are left alone.
+func (t *PatronSnapshotTable) Replace(ctx context.Context, patrons []SnapshotPatron) error {
+	tx, err := t.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `
+CREATE TEMPORARY TABLE patron_snapshot_staging (LIKE patron_snapshot INCLUDING DEFAULTS) ON COMMIT DROP;`); err != nil {
+		return err
+	}
+
+	rows := pgx.CopyFromSlice(len(patrons), func(i int) ([]any, error) {
+		patron := patrons[i]
+
+		// pgx doesn't encode []uint64 as an int8 array
+		tiers := make([]int64, len(patron.Tiers))
+		for j, tierId := range patron.Tiers {
+			tiers[j] = int64(tierId)
+		}
+
+		return []any{
+			patron.Email,
+			patron.PatronId,
+			patron.DiscordId,
+			tiers,
+			patron.PatronStatus,
+			patron.LastChargeStatus,
+			patron.LastChargeDate,
+			patron.PledgeRelationshipStart,
+			patron.CurrentlyEntitledAmountCents,
+			patron.LifetimeSupportCents,
+		}, nil
+	})
+
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{"patron_snapshot_staging"}, snapshotColumns, rows); err != nil {
+		return err
+	}
+
+	query := `
+WITH removed AS (
+	DELETE FROM patron_snapshot
+	WHERE NOT EXISTS (SELECT 1 FROM patron_snapshot_staging WHERE patron_snapshot_staging."email" = patron_snapshot."email")
+)
+INSERT INTO patron_snapshot("email", "patron_id", "discord_id", "tiers", "patron_status", "last_charge_status",
+	"last_charge_date", "pledge_relationship_start", "currently_entitled_amount_cents", "lifetime_support_cents")
+SELECT "email", "patron_id", "discord_id", "tiers", "patron_status", "last_charge_status", "last_charge_date",
+	"pledge_relationship_start", "currently_entitled_amount_cents", "lifetime_support_cents"
+FROM patron_snapshot_staging
+ON CONFLICT("email") DO UPDATE SET
+	"patron_id" = EXCLUDED."patron_id",
+	"discord_id" = EXCLUDED."discord_id",
+	"tiers" = EXCLUDED."tiers",
+	"patron_status" = EXCLUDED."patron_status",
+	"last_charge_status" = EXCLUDED."last_charge_status",
+	"last_charge_date" = EXCLUDED."last_charge_date",
+	"pledge_relationship_start" = EXCLUDED."pledge_relationship_start",
+	"currently_entitled_amount_cents" = EXCLUDED."currently_entitled_amount_cents",
+	"lifetime_support_cents" = EXCLUDED."lifetime_support_cents",
+	"updated_at" = NOW()
+WHERE (patron_snapshot."patron_id", patron_snapshot."discord_id", patron_snapshot."tiers",
+	patron_snapshot."patron_status", patron_snapshot."last_charge_status", patron_snapshot."last_charge_date",
+	patron_snapshot."pledge_relationship_start", patron_snapshot."currently_entitled_amount_cents",
+	patron_snapshot."lifetime_support_cents")
+	IS DISTINCT FROM
+	(EXCLUDED."patron_id", EXCLUDED."discord_id", EXCLUDED."tiers", EXCLUDED."patron_status",
+	EXCLUDED."last_charge_status", EXCLUDED."last_charge_date", EXCLUDED."pledge_relationship_start",
+	EXCLUDED."currently_entitled_amount_cents", EXCLUDED."lifetime_support_cents");`
+
+	if _, err := tx.Exec(ctx, query); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
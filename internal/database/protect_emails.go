@@ -0,0 +1,100 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// emailColumn is a column that holds emails, which may be a key of a JSON column
+type emailColumn struct {
+	table string
+	value string // Expression that reads the email
+	set   string // Assignment that replaces the email with $2
+	key   bool   // Whether the email is the primary key, so a row with the protected email may already exist
+}
+
+var emailColumns = []emailColumn{
+	{table: "account_links", value: `"email"`, set: `"email" = $2`, key: true},
+	{table: "external_subscriptions", value: `"email"`, set: `"email" = $2`},
+	{table: "former_patrons", value: `"email"`, set: `"email" = $2`},
+	{table: "patron_snapshot", value: `"email"`, set: `"email" = $2`, key: true},
+	{table: "patron_history", value: `"details"->>'email'`, set: `"details" = jsonb_set("details", '{email}', to_jsonb($2::text))`},
+	{table: "audit_log", value: `"details"->>'email'`, set: `"details" = jsonb_set("details", '{email}', to_jsonb($2::text))`},
+}
+
+// ProtectEmails replaces every stored email with protect(email), in a single transaction, returning the number of rows
+// updated in each table. Emails that protect returns unchanged are skipped, so it can be run again safely. Where the
+// email is the primary key, and a row with the protected email has been stored since, the older row is deleted.
+func (d *Database) ProtectEmails(ctx context.Context, protect func(email string) string) (map[string]int64, error) {
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	updated := make(map[string]int64, len(emailColumns))
+	for _, column := range emailColumns {
+		count, err := protectColumn(ctx, tx, column, protect)
+		if err != nil {
+			return nil, fmt.Errorf("failed to protect emails in %s: %w", column.table, err)
+		}
+
+		updated[column.table] = count
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+func protectColumn(ctx context.Context, tx pgx.Tx, column emailColumn, protect func(email string) string) (int64, error) {
+	rows, err := tx.Query(ctx, fmt.Sprintf(`SELECT DISTINCT %s FROM %s WHERE %s IS NOT NULL;`, column.value, column.table, column.value))
+	if err != nil {
+		return 0, err
+	}
+
+	var emails []string
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		emails = append(emails, email)
+	}
+
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	var updated int64
+	for _, email := range emails {
+		protected := protect(email)
+		if protected == email || protected == "" {
+			continue
+		}
+
+		if column.key {
+			query := fmt.Sprintf(`DELETE FROM %s WHERE "email" = $1 AND EXISTS (SELECT 1 FROM %s WHERE "email" = $2);`, column.table, column.table)
+			if _, err := tx.Exec(ctx, query, email, protected); err != nil {
+				return 0, err
+			}
+		}
+
+		tag, err := tx.Exec(ctx, fmt.Sprintf(`UPDATE %s SET %s WHERE %s = $1;`, column.table, column.set, column.value), email, protected)
+		if err != nil {
+			return 0, err
+		}
+
+		updated += tag.RowsAffected()
+	}
+
+	return updated, nil
+}
@@ -0,0 +1,79 @@
+package database
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// ReconciliationCountsTable stores the number of discrepancies of each kind found by the last reconciliation run, so
+// that a report is only posted again once they change, including after a restart
+type ReconciliationCountsTable struct {
+	pool *pgxpool.Pool
+}
+
+func newReconciliationCountsTable(pool *pgxpool.Pool) *ReconciliationCountsTable {
+	return &ReconciliationCountsTable{
+		pool: pool,
+	}
+}
+
+func (t *ReconciliationCountsTable) Schema() string {
+	return `
+CREATE TABLE IF NOT EXISTS reconciliation_counts(
+	"kind" varchar(32) NOT NULL,
+	"count" int4 NOT NULL,
+	"updated_at" timestamptz NOT NULL,
+	PRIMARY KEY("kind")
+);
+`
+}
+
+// Get returns the number of discrepancies of each kind found by the last run. Kinds without any are left out.
+func (t *ReconciliationCountsTable) Get(ctx context.Context) (map[string]int, error) {
+	rows, err := t.pool.Query(ctx, `SELECT "kind", "count" FROM reconciliation_counts;`)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var kind string
+		var count int
+		if err := rows.Scan(&kind, &count); err != nil {
+			return nil, err
+		}
+
+		counts[kind] = count
+	}
+
+	return counts, rows.Err()
+}
+
+// Set replaces the stored counts with those of the latest run, in a single transaction
+func (t *ReconciliationCountsTable) Set(ctx context.Context, counts map[string]int) error {
+	tx, err := t.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM reconciliation_counts;`); err != nil {
+		return err
+	}
+
+	for kind, count := range counts {
+		if count == 0 {
+			continue
+		}
+
+		if _, err := tx.Exec(ctx, `INSERT INTO reconciliation_counts("kind", "count", "updated_at") VALUES ($1, $2, NOW());`, kind, count); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,120 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// RoleRemovalsTable holds the tier roles waiting to be removed from members who lost the tier, until their grace
+// window ends
+type RoleRemovalsTable struct {
+	pool *pgxpool.Pool
+}
+
+type RoleRemoval struct {
+	DiscordId   uint64
+	RoleId      uint64
+	PatronId    uint64
+	ScheduledAt time.Time
+	RemoveAfter time.Time
+}
+
+func newRoleRemovalsTable(pool *pgxpool.Pool) *RoleRemovalsTable {
+	return &RoleRemovalsTable{
+		pool: pool,
+	}
+}
+
+func (t *RoleRemovalsTable) Schema() string {
+	return `
+CREATE TABLE IF NOT EXISTS role_removals(
+	"discord_id" int8 NOT NULL,
+	"role_id" int8 NOT NULL,
+	"patron_id" int8 NOT NULL,
+	"scheduled_at" timestamptz NOT NULL,
+	"remove_after" timestamptz NOT NULL,
+	PRIMARY KEY("discord_id", "role_id")
+);
+CREATE INDEX IF NOT EXISTS role_removals_remove_after ON role_removals("remove_after");
+`
+}
+
+// Schedule stores the removal, unless the role is already waiting to be removed from the member, so that further
+// changes during the grace window don't extend it
+func (t *RoleRemovalsTable) Schedule(ctx context.Context, removal RoleRemoval) error {
+	query := `
+INSERT INTO role_removals("discord_id", "role_id", "patron_id", "scheduled_at", "remove_after")
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT("discord_id", "role_id") DO NOTHING;`
+
+	_, err := t.pool.Exec(ctx, query, removal.DiscordId, removal.RoleId, removal.PatronId, removal.ScheduledAt, removal.RemoveAfter)
+	return err
+}
+
+// Cancel deletes the pending removal of the role from the member, returning false if there was none
+func (t *RoleRemovalsTable) Cancel(ctx context.Context, discordId, roleId uint64) (bool, error) {
+	tag, err := t.pool.Exec(ctx, `DELETE FROM role_removals WHERE "discord_id" = $1 AND "role_id" = $2;`, discordId, roleId)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// Due returns the removals whose grace window ended before now, oldest first
+func (t *RoleRemovalsTable) Due(ctx context.Context, now time.Time) ([]RoleRemoval, error) {
+	query := `
+SELECT "discord_id", "role_id", "patron_id", "scheduled_at", "remove_after"
+FROM role_removals
+WHERE "remove_after" <= $1
+ORDER BY "remove_after";`
+
+	rows, err := t.pool.Query(ctx, query, now)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var removals []RoleRemoval
+	for rows.Next() {
+		var removal RoleRemoval
+		if err := rows.Scan(&removal.DiscordId, &removal.RoleId, &removal.PatronId, &removal.ScheduledAt, &removal.RemoveAfter); err != nil {
+			return nil, err
+		}
+
+		removals = append(removals, removal)
+	}
+
+	return removals, rows.Err()
+}
+
+// Complete deletes the removal once the role has been removed or is no longer to be removed, and records the outcome
+// in the audit log against the member
+func (t *RoleRemovalsTable) Complete(ctx context.Context, removal RoleRemoval, action string) error {
+	tx, err := t.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(ctx)
+
+	query := `DELETE FROM role_removals WHERE "discord_id" = $1 AND "role_id" = $2;`
+	if _, err := tx.Exec(ctx, query, removal.DiscordId, removal.RoleId); err != nil {
+		return err
+	}
+
+	details := map[string]any{
+		"role_id":      removal.RoleId,
+		"patron_id":    removal.PatronId,
+		"scheduled_at": removal.ScheduledAt,
+	}
+
+	if err := createAuditLogEntry(ctx, tx, removal.DiscordId, action, details); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,66 @@
+package database
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type TierMappingsTable struct {
+	pool *pgxpool.Pool
+}
+
+func newTierMappingsTable(pool *pgxpool.Pool) *TierMappingsTable {
+	return &TierMappingsTable{
+		pool: pool,
+	}
+}
+
+func (t *TierMappingsTable) Schema() string {
+	return `
+CREATE TABLE IF NOT EXISTS tier_mappings(
+	"tier_id" int8 NOT NULL,
+	"name" varchar(100) NOT NULL,
+	"mapped_by" int8 NOT NULL,
+	"mapped_at" timestamptz NOT NULL,
+	PRIMARY KEY("tier_id")
+);
+`
+}
+
+// GetAll returns a map of tier ID -> tier name
+func (t *TierMappingsTable) GetAll(ctx context.Context) (map[uint64]string, error) {
+	rows, err := t.pool.Query(ctx, `SELECT "tier_id", "name" FROM tier_mappings;`)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	mappings := make(map[uint64]string)
+	for rows.Next() {
+		var tierId uint64
+		var name string
+		if err := rows.Scan(&tierId, &name); err != nil {
+			return nil, err
+		}
+
+		mappings[tierId] = name
+	}
+
+	return mappings, rows.Err()
+}
+
+func (t *TierMappingsTable) Set(ctx context.Context, tierId uint64, name string, mappedBy uint64) error {
+	return setTierMapping(ctx, t.pool, tierId, name, mappedBy)
+}
+
+func setTierMapping(ctx context.Context, exec executor, tierId uint64, name string, mappedBy uint64) error {
+	query := `
+INSERT INTO tier_mappings("tier_id", "name", "mapped_by", "mapped_at")
+VALUES ($1, $2, $3, NOW())
+ON CONFLICT("tier_id") DO UPDATE SET "name" = EXCLUDED."name", "mapped_by" = EXCLUDED."mapped_by", "mapped_at" = EXCLUDED."mapped_at";`
+
+	_, err := exec.Exec(ctx, query, tierId, name, mappedBy)
+	return err
+}
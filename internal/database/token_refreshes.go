@@ -0,0 +1,129 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// TokenRefreshesTable records every attempt to refresh the Patreon tokens, from every instance, to diagnose refresh
+// tokens expiring
+type TokenRefreshesTable struct {
+	pool *pgxpool.Pool
+}
+
+type TokenRefresh struct {
+	Id          int64      `json:"-"`
+	AttemptedAt time.Time  `json:"attempted_at"`
+	Success     bool       `json:"success"`
+	Error       *string    `json:"error,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"` // When the tokens expire after the attempt
+	Hostname    string     `json:"hostname"`
+}
+
+// TokenRefreshStatus summarises the recorded refreshes
+type TokenRefreshStatus struct {
+	Latest              *TokenRefresh `json:"latest"`
+	LatestSuccess       *TokenRefresh `json:"latest_success"`
+	ConsecutiveFailures int           `json:"consecutive_failures"` // Failed attempts since the latest success
+}
+
+func newTokenRefreshesTable(pool *pgxpool.Pool) *TokenRefreshesTable {
+	return &TokenRefreshesTable{
+		pool: pool,
+	}
+}
+
+func (t *TokenRefreshesTable) Schema() string {
+	return `
+CREATE TABLE IF NOT EXISTS token_refreshes(
+	"id" SERIAL8 NOT NULL,
+	"attempted_at" timestamptz NOT NULL,
+	"success" bool NOT NULL,
+	"error" text NULL,
+	"expires_at" timestamptz NULL,
+	"hostname" varchar(255) NOT NULL,
+	PRIMARY KEY("id")
+);
+CREATE INDEX IF NOT EXISTS token_refreshes_attempted_at ON token_refreshes("attempted_at");
+`
+}
+
+func (t *TokenRefreshesTable) Create(ctx context.Context, refresh TokenRefresh) error {
+	query := `
+INSERT INTO token_refreshes("attempted_at", "success", "error", "expires_at", "hostname")
+VALUES ($1, $2, $3, $4, $5);`
+
+	_, err := t.pool.Exec(ctx, query, refresh.AttemptedAt, refresh.Success, refresh.Error, refresh.ExpiresAt, refresh.Hostname)
+	return err
+}
+
+// Status returns the latest attempt, the latest successful attempt, and the number of failures since then
+func (t *TokenRefreshesTable) Status(ctx context.Context) (TokenRefreshStatus, error) {
+	var status TokenRefreshStatus
+
+	latest, ok, err := t.latest(ctx, `SELECT "id", "attempted_at", "success", "error", "expires_at", "hostname" FROM token_refreshes ORDER BY "id" DESC LIMIT 1;`)
+	if err != nil {
+		return TokenRefreshStatus{}, err
+	} else if ok {
+		status.Latest = &latest
+	}
+
+	latestSuccess, ok, err := t.latest(ctx, `SELECT "id", "attempted_at", "success", "error", "expires_at", "hostname" FROM token_refreshes WHERE "success" ORDER BY "id" DESC LIMIT 1;`)
+	if err != nil {
+		return TokenRefreshStatus{}, err
+	} else if ok {
+		status.LatestSuccess = &latestSuccess
+	}
+
+	var after int64
+	if status.LatestSuccess != nil {
+		after = status.LatestSuccess.Id
+	}
+
+	query := `SELECT COUNT(*) FROM token_refreshes WHERE NOT "success" AND "id" > $1;`
+	if err := t.pool.QueryRow(ctx, query, after).Scan(&status.ConsecutiveFailures); err != nil {
+		return TokenRefreshStatus{}, err
+	}
+
+	return status, nil
+}
+
+func (t *TokenRefreshesTable) latest(ctx context.Context, query string) (TokenRefresh, bool, error) {
+	var refresh TokenRefresh
+	err := t.pool.QueryRow(ctx, query).Scan(
+		&refresh.Id,
+		&refresh.AttemptedAt,
+		&refresh.Success,
+		&refresh.Error,
+		&refresh.ExpiresAt,
+		&refresh.Hostname,
+	)
+
+	if err == pgx.ErrNoRows {
+		return TokenRefresh{}, false, nil
+	} else if err != nil {
+		return TokenRefresh{}, false, err
+	}
+
+	return refresh, true, nil
+}
+
+// Prune deletes attempts made before the given time, except the latest attempt and the latest successful attempt, so
+// that the status can still be reported
+func (t *TokenRefreshesTable) Prune(ctx context.Context, before time.Time) (int64, error) {
+	query := `
+DELETE FROM token_refreshes
+WHERE "attempted_at" < $1
+	AND "id" <> (SELECT MAX("id") FROM token_refreshes)
+	AND "id" <> COALESCE((SELECT MAX("id") FROM token_refreshes WHERE "success"), 0);`
+
+	res, err := t.pool.Exec(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected(), nil
+}
@@ -0,0 +1,78 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type UnknownTiersTable struct {
+	pool *pgxpool.Pool
+}
+
+type UnknownTier struct {
+	TierId         uint64
+	FirstSeen      time.Time
+	SamplePatronId uint64
+}
+
+func newUnknownTiersTable(pool *pgxpool.Pool) *UnknownTiersTable {
+	return &UnknownTiersTable{
+		pool: pool,
+	}
+}
+
+func (t *UnknownTiersTable) Schema() string {
+	return `
+CREATE TABLE IF NOT EXISTS unknown_tiers(
+	"tier_id" int8 NOT NULL,
+	"first_seen" timestamptz NOT NULL,
+	"sample_patron_id" int8 NOT NULL,
+	PRIMARY KEY("tier_id")
+);
+`
+}
+
+func (t *UnknownTiersTable) GetAll(ctx context.Context) ([]UnknownTier, error) {
+	query := `SELECT "tier_id", "first_seen", "sample_patron_id" FROM unknown_tiers ORDER BY "first_seen";`
+
+	rows, err := t.pool.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var tiers []UnknownTier
+	for rows.Next() {
+		var tier UnknownTier
+		if err := rows.Scan(&tier.TierId, &tier.FirstSeen, &tier.SamplePatronId); err != nil {
+			return nil, err
+		}
+
+		tiers = append(tiers, tier)
+	}
+
+	return tiers, rows.Err()
+}
+
+// Record stores the tier if it has not been seen before. The first-seen time and sample patron are never overwritten.
+func (t *UnknownTiersTable) Record(ctx context.Context, tierId, samplePatronId uint64) error {
+	query := `
+INSERT INTO unknown_tiers("tier_id", "first_seen", "sample_patron_id")
+VALUES ($1, NOW(), $2)
+ON CONFLICT("tier_id") DO NOTHING;`
+
+	_, err := t.pool.Exec(ctx, query, tierId, samplePatronId)
+	return err
+}
+
+func (t *UnknownTiersTable) Delete(ctx context.Context, tierId uint64) error {
+	return deleteUnknownTier(ctx, t.pool, tierId)
+}
+
+func deleteUnknownTier(ctx context.Context, exec executor, tierId uint64) error {
+	_, err := exec.Exec(ctx, `DELETE FROM unknown_tiers WHERE "tier_id" = $1;`, tierId)
+	return err
+}
@@ -0,0 +1,201 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type VouchersTable struct {
+	pool *pgxpool.Pool
+}
+
+type Voucher struct {
+	Code         string
+	Tier         string
+	DurationDays int
+	CreatedBy    uint64
+	CreatedAt    time.Time
+	RedeemedBy   *uint64
+	RedeemedAt   *time.Time
+}
+
+var ErrVoucherUnavailable = errors.New("voucher does not exist or has already been redeemed")
+
+func newVouchersTable(pool *pgxpool.Pool) *VouchersTable {
+	return &VouchersTable{
+		pool: pool,
+	}
+}
+
+func (t *VouchersTable) Schema() string {
+	return `
+CREATE TABLE IF NOT EXISTS vouchers(
+	"code" varchar(32) NOT NULL,
+	"tier" varchar(100) NOT NULL,
+	"duration_days" int4 NOT NULL,
+	"created_by" int8 NOT NULL,
+	"created_at" timestamptz NOT NULL,
+	"redeemed_by" int8 NULL,
+	"redeemed_at" timestamptz NULL,
+	PRIMARY KEY("code")
+);
+`
+}
+
+// Create stores new vouchers and records their creation in the audit log, in a single transaction
+func (t *VouchersTable) Create(ctx context.Context, vouchers []Voucher, details map[string]any) error {
+	tx, err := t.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(ctx)
+
+	query := `
+INSERT INTO vouchers("code", "tier", "duration_days", "created_by", "created_at")
+VALUES ($1, $2, $3, $4, $5);`
+
+	for _, voucher := range vouchers {
+		if _, err := tx.Exec(ctx, query, voucher.Code, voucher.Tier, voucher.DurationDays, voucher.CreatedBy, voucher.CreatedAt); err != nil {
+			return err
+		}
+
+		entry := map[string]any{
+			"code":          voucher.Code,
+			"tier":          voucher.Tier,
+			"duration_days": voucher.DurationDays,
+		}
+
+		for k, v := range details {
+			entry[k] = v
+		}
+
+		if err := createAuditLogEntry(ctx, tx, voucher.CreatedBy, "voucher_created", entry); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Revoke deletes a voucher that hasn't been redeemed, so that it can no longer be, and records the revocation in the
+// audit log, in a single transaction. ErrVoucherUnavailable is returned if the code does not exist or has already been
+// used.
+func (t *VouchersTable) Revoke(ctx context.Context, code string, revokedBy uint64, details map[string]any) (Voucher, error) {
+	tx, err := t.pool.Begin(ctx)
+	if err != nil {
+		return Voucher{}, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	query := `
+DELETE FROM vouchers
+WHERE "code" = $1 AND "redeemed_by" IS NULL
+RETURNING "code", "tier", "duration_days", "created_by", "created_at";`
+
+	var voucher Voucher
+	if err := tx.QueryRow(ctx, query, code).Scan(
+		&voucher.Code,
+		&voucher.Tier,
+		&voucher.DurationDays,
+		&voucher.CreatedBy,
+		&voucher.CreatedAt,
+	); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Voucher{}, ErrVoucherUnavailable
+		}
+
+		return Voucher{}, err
+	}
+
+	entry := map[string]any{
+		"code":          voucher.Code,
+		"tier":          voucher.Tier,
+		"duration_days": voucher.DurationDays,
+	}
+
+	for k, v := range details {
+		entry[k] = v
+	}
+
+	if err := createAuditLogEntry(ctx, tx, revokedBy, "voucher_revoked", entry); err != nil {
+		return Voucher{}, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return Voucher{}, err
+	}
+
+	return voucher, nil
+}
+
+// Redeem marks the voucher as redeemed, grants the corresponding time-limited manual entitlement and records the
+// redemption in the audit log, in a single transaction. ErrVoucherUnavailable is returned if the code does not exist
+// or has already been used.
+func (t *VouchersTable) Redeem(ctx context.Context, code string, discordId uint64) (Voucher, time.Time, error) {
+	tx, err := t.pool.Begin(ctx)
+	if err != nil {
+		return Voucher{}, time.Time{}, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	query := `
+UPDATE vouchers SET "redeemed_by" = $2, "redeemed_at" = NOW()
+WHERE "code" = $1 AND "redeemed_by" IS NULL
+RETURNING "code", "tier", "duration_days", "created_by", "created_at", "redeemed_by", "redeemed_at";`
+
+	var voucher Voucher
+	if err := tx.QueryRow(ctx, query, code, discordId).Scan(
+		&voucher.Code,
+		&voucher.Tier,
+		&voucher.DurationDays,
+		&voucher.CreatedBy,
+		&voucher.CreatedAt,
+		&voucher.RedeemedBy,
+		&voucher.RedeemedAt,
+	); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Voucher{}, time.Time{}, ErrVoucherUnavailable
+		}
+
+		return Voucher{}, time.Time{}, err
+	}
+
+	startedAt := *voucher.RedeemedAt
+	expiresAt := startedAt.Add(time.Duration(voucher.DurationDays) * time.Hour * 24)
+
+	if err := upsertExternalSubscription(ctx, tx, ExternalSubscription{
+		Source:    SourceManual,
+		Reference: "voucher:" + voucher.Code,
+		DiscordId: &discordId,
+		Tier:      voucher.Tier,
+		Status:    "active",
+		StartedAt: &startedAt,
+		ExpiresAt: &expiresAt,
+		UpdatedAt: startedAt,
+	}); err != nil {
+		return Voucher{}, time.Time{}, err
+	}
+
+	details := map[string]any{
+		"code":       voucher.Code,
+		"tier":       voucher.Tier,
+		"expires_at": expiresAt,
+	}
+
+	if err := createAuditLogEntry(ctx, tx, discordId, "voucher_redeemed", details); err != nil {
+		return Voucher{}, time.Time{}, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return Voucher{}, time.Time{}, err
+	}
+
+	return voucher, expiresAt, nil
+}
@@ -0,0 +1,136 @@
+// Package demo generates fake patrons, so that the app can be run without a Patreon campaign for training staff and
+// recording documentation screenshots. Generated emails use the reserved example.com domain, and Discord IDs are
+// random, so no real person's data is shown.
+package demo
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	"github.com/TicketsBot/subscriptions-app/internal/config"
+	"github.com/TicketsBot/subscriptions-app/pkg/patreon"
+)
+
+// DefaultPatronCount is the number of patrons generated by the --demo flag
+const DefaultPatronCount = 300
+
+// seed is fixed so that every run generates the same patrons, and documentation can refer to them
+const seed = 0x7469636b657473
+
+var firstNames = []string{
+	"alex", "sam", "jordan", "taylor", "morgan", "casey", "riley", "jamie", "avery", "quinn", "rowan", "skyler",
+}
+
+var lastNames = []string{
+	"smith", "jones", "garcia", "chen", "patel", "kowalski", "nguyen", "silva", "murphy", "okafor", "larsen", "kim",
+}
+
+// Configure fills in the Patreon credentials that Validate requires, as demo mode never contacts Patreon
+func Configure(conf *config.Config) {
+	if conf.Patreon.ClientId == "" {
+		conf.Patreon.ClientId = "demo"
+	}
+
+	if conf.Patreon.ClientSecret == "" {
+		conf.Patreon.ClientSecret = "demo"
+	}
+
+	if conf.Patreon.CampaignId <= 0 {
+		conf.Patreon.CampaignId = 1
+	}
+}
+
+// Patrons generates count patrons pledged to the configured tiers, keyed by normalized email like the result of
+// patreon.Client.FetchPledges. Most are active, with the rest declined or former patrons, and a quarter have not
+// linked their Discord account.
+func Patrons(conf config.Config, count int, now time.Time) map[string]patreon.Patron {
+	r := rand.New(rand.NewPCG(seed, seed))
+
+	tierIds := make([]uint64, 0, len(conf.Tiers))
+	for tierId := range conf.Tiers {
+		tierIds = append(tierIds, tierId)
+	}
+
+	// Map iteration order is random, so sort for the patrons to be reproducible
+	slices.Sort(tierIds)
+
+	patrons := make(map[string]patreon.Patron, count)
+	for i := range count {
+		patron := patreon.Patron{
+			Id: 90000000 + uint64(i),
+		}
+
+		patron.Email = fmt.Sprintf(
+			"%s.%s%d@example.com",
+			firstNames[r.IntN(len(firstNames))], lastNames[r.IntN(len(lastNames))], i,
+		)
+
+		if r.IntN(4) != 0 {
+			patron.DiscordId = ptr(uint64(1<<60) + r.Uint64N(1<<59))
+		}
+
+		var tier config.Tier
+		if len(tierIds) > 0 {
+			tierId := tierIds[r.IntN(len(tierIds))]
+			patron.Tiers = []uint64{tierId}
+			tier = conf.Tiers[tierId]
+		}
+
+		months := 1 + r.IntN(36)
+		patron.PledgeRelationshipStart = now.AddDate(0, -months, -r.IntN(28))
+		patron.LifetimeSupportCents = months * tier.PriceCents
+
+		switch roll := r.IntN(20); {
+		case roll < 15:
+			patron.PatronStatus = "active_patron"
+			patron.LastChargeStatus = "Paid"
+			patron.PledgeCadence = 1
+			if r.IntN(10) == 0 {
+				patron.PledgeCadence = 12 // Some patrons pledge annually
+			}
+
+			patron.IsGifted = r.IntN(25) == 0 // A few memberships are gifts
+
+			patron.LastChargeDate = now.AddDate(0, 0, -r.IntN(30*patron.PledgeCadence))
+			patron.NextChargeDate = patreon.Date{Time: patron.LastChargeDate.AddDate(0, patron.PledgeCadence, 0)}
+			patron.CurrentlyEntitledAmountCents = tier.PriceCents
+		case roll < 17:
+			patron.PatronStatus = "declined_patron"
+			patron.LastChargeStatus = "Declined"
+			patron.LastChargeDate = now.AddDate(0, 0, -r.IntN(7))
+			patron.CurrentlyEntitledAmountCents = tier.PriceCents
+		default:
+			// Former patrons are no longer entitled to a tier
+			patron.PatronStatus = "former_patron"
+			patron.LastChargeStatus = "Paid"
+			patron.LastChargeDate = now.AddDate(0, -1-r.IntN(6), 0)
+			patron.Tiers = nil
+		}
+
+		patrons[patreon.NormalizeEmail(patron.Email, conf.Patreon.CanonicalizeGmail)] = patron
+	}
+
+	return patrons
+}
+
+func ptr[T any](value T) *T {
+	return &value
+}
+
+// Source serves the same generated patrons on every sync, in place of the Patreon client
+type Source struct {
+	patrons map[string]patreon.Patron
+}
+
+func NewSource(conf config.Config, count int, now time.Time) *Source {
+	return &Source{
+		patrons: Patrons(conf, count, now),
+	}
+}
+
+func (s *Source) FetchPledges(context.Context) (map[string]patreon.Patron, error) {
+	return s.patrons, nil
+}
@@ -0,0 +1,206 @@
+package digest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/TicketsBot-cloud/gdl/objects/channel/embed"
+	"github.com/TicketsBot-cloud/gdl/rest"
+	"github.com/TicketsBot/subscriptions-app/internal/analytics"
+	"github.com/TicketsBot/subscriptions-app/internal/config"
+	"github.com/TicketsBot/subscriptions-app/internal/currency"
+	"go.uber.org/zap"
+)
+
+// maxFieldLength is the longest an embed field value can be, leaving room for the count of patrons not listed
+const maxFieldLength = 1000
+
+// Scheduler posts a digest of patron activity to a Discord channel every week or month
+type Scheduler struct {
+	config    config.Config
+	logger    *zap.Logger
+	analytics *analytics.Service
+}
+
+func NewScheduler(config config.Config, logger *zap.Logger, analytics *analytics.Service) *Scheduler {
+	return &Scheduler{
+		config:    config,
+		logger:    logger,
+		analytics: analytics,
+	}
+}
+
+func (s *Scheduler) Enabled() bool {
+	return s.config.Digest.ChannelId != 0
+}
+
+// Run posts a digest at the end of each period until the context is cancelled. A digest that is due while the process
+// is not running is skipped.
+func (s *Scheduler) Run(ctx context.Context) {
+	if !s.Enabled() {
+		s.logger.Info("Digest channel not configured, digests are disabled")
+		return
+	}
+
+	for {
+		end := s.nextRun(time.Now().UTC())
+		s.logger.Info("Scheduled next digest", zap.Time("at", end))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(end)):
+		}
+
+		if err := s.postWhenLoaded(ctx, s.periodStart(end), end); err != nil {
+			s.logger.Error("Failed to post digest", zap.Error(err))
+		}
+	}
+}
+
+// postWhenLoaded waits for the Patreon snapshot to load, in case the digest is due just after starting
+func (s *Scheduler) postWhenLoaded(ctx context.Context, start, end time.Time) error {
+	for attempt := 0; ; attempt++ {
+		err := s.Post(ctx, start, end)
+		if !errors.Is(err, analytics.ErrNotLoaded) || attempt >= 30 {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Minute):
+		}
+	}
+}
+
+// Post posts the digest for the period from start to end
+func (s *Scheduler) Post(ctx context.Context, start, end time.Time) error {
+	queryCtx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	summary, err := s.analytics.Summary(queryCtx, start, end)
+	if err != nil {
+		return err
+	}
+
+	_, err = rest.CreateMessage(ctx, s.config.Discord.BotToken, nil, s.config.Digest.ChannelId, rest.CreateMessageData{
+		Embeds: []*embed.Embed{s.buildEmbed(summary)},
+	})
+	if err != nil {
+		return err
+	}
+
+	s.logger.Info("Posted digest", zap.Time("start", start), zap.Time("end", end))
+	return nil
+}
+
+func (s *Scheduler) buildEmbed(summary analytics.Summary) *embed.Embed {
+	baseCurrency := s.config.Revenue.Currency
+	change := summary.EndMrrCents - summary.StartMrrCents
+
+	mrr := fmt.Sprintf("%s → %s", currency.Format(summary.StartMrrCents, baseCurrency), currency.Format(summary.EndMrrCents, baseCurrency))
+	if summary.StartMrrCents > 0 {
+		mrr += fmt.Sprintf(" (%+.1f%%)", float64(change)/float64(summary.StartMrrCents)*100)
+	}
+
+	declined := "None"
+	if len(summary.Declined) > 0 {
+		var lines []string
+		length := 0
+		for i, patron := range summary.Declined {
+			line := fmt.Sprintf("[Patron %d](%s), declined <t:%d:R>", patron.Id, fmt.Sprintf(s.config.Branding.PatronUrl, patron.Id), patron.LastChargeDate.Unix())
+			if patron.DiscordId != nil {
+				line += fmt.Sprintf(" (<@%d>)", *patron.DiscordId)
+			}
+
+			if length += len(line) + 1; length > maxFieldLength {
+				lines = append(lines, fmt.Sprintf("…and %d more", len(summary.Declined)-i))
+				break
+			}
+
+			lines = append(lines, line)
+		}
+
+		declined = strings.Join(lines, "\n")
+	}
+
+	e := &embed.Embed{
+		Title:       fmt.Sprintf("%s Digest", titleCase(s.config.Digest.Period)),
+		Description: fmt.Sprintf("<t:%d:D> to <t:%d:D>", summary.Start.Unix(), summary.End.Add(-time.Second).Unix()),
+		Fields: []*embed.EmbedField{
+			{
+				Name:   "New Patrons",
+				Value:  fmt.Sprint(summary.New),
+				Inline: true,
+			},
+			{
+				Name:   "Cancellations",
+				Value:  fmt.Sprint(summary.Cancelled),
+				Inline: true,
+			},
+			{
+				Name:   "MRR",
+				Value:  mrr,
+				Inline: false,
+			},
+			{
+				Name:   fmt.Sprintf("Declined Payments (%d)", len(summary.Declined)),
+				Value:  declined,
+				Inline: false,
+			},
+		},
+		Timestamp: &summary.End,
+		Color:     int(s.config.Branding.PrimaryColor),
+	}
+
+	if s.config.Branding.FooterText != "" {
+		e.Footer = &embed.EmbedFooter{
+			Text:    s.config.Branding.FooterText,
+			IconUrl: s.config.Branding.FooterIconUrl,
+		}
+	}
+
+	return e
+}
+
+// nextRun returns the next time a digest is due after now: the configured hour on the next Monday for weekly digests,
+// or on the 1st of the month for monthly digests
+func (s *Scheduler) nextRun(now time.Time) time.Time {
+	hour := s.config.Digest.Hour
+	if s.config.Digest.Period == "monthly" {
+		next := time.Date(now.Year(), now.Month(), 1, hour, 0, 0, 0, time.UTC)
+		if !next.After(now) {
+			next = next.AddDate(0, 1, 0)
+		}
+
+		return next
+	}
+
+	daysUntilMonday := (int(time.Monday) - int(now.Weekday()) + 7) % 7
+	next := time.Date(now.Year(), now.Month(), now.Day()+daysUntilMonday, hour, 0, 0, 0, time.UTC)
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 7)
+	}
+
+	return next
+}
+
+func (s *Scheduler) periodStart(end time.Time) time.Time {
+	if s.config.Digest.Period == "monthly" {
+		return end.AddDate(0, -1, 0)
+	}
+
+	return end.AddDate(0, 0, -7)
+}
+
+func titleCase(s string) string {
+	if s == "" {
+		return s
+	}
+
+	return strings.ToUpper(s[:1]) + s[1:]
+}
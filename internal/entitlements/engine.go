@@ -0,0 +1,597 @@
+package entitlements
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/TicketsBot/subscriptions-app/internal/clock"
+	"github.com/TicketsBot/subscriptions-app/internal/config"
+	"github.com/TicketsBot/subscriptions-app/internal/database"
+	"github.com/TicketsBot/subscriptions-app/internal/events"
+	"github.com/TicketsBot/subscriptions-app/internal/metrics"
+	"github.com/TicketsBot/subscriptions-app/internal/privacy"
+	"github.com/TicketsBot/subscriptions-app/internal/sources"
+	"github.com/TicketsBot/subscriptions-app/pkg/patreon"
+)
+
+// TierRegistry resolves tier IDs and names to their metadata
+type TierRegistry interface {
+	Tier(tierId uint64) (config.Tier, bool)
+	ByName(name string) (config.Tier, bool)
+}
+
+// Converter converts amounts pledged in other currencies to the campaign currency, which entitlements report amounts in
+type Converter interface {
+	ToBase(cents int, currency string) int
+}
+
+// Engine converts the data from every provider into entitlements. It holds the latest Patreon snapshot, and queries
+// the other pledge sources on demand.
+type Engine struct {
+	tiers     TierRegistry
+	sources   []sources.PledgeSource
+	clock     clock.Clock // Entitlements are resolved, and grace periods checked, at the clock's current time
+	converter Converter
+
+	gracePeriodDays int // From config, replaced when config is reloaded
+	configMu        sync.RWMutex
+
+	// From config, replaced when config is reloaded, which rekeys the snapshot and former patrons. Only read while
+	// holding updateMu.
+	canonicalizeGmail bool
+	updateMu          sync.Mutex // Held while the snapshot is replaced, so that a sync and a rekey don't race
+
+	emails *privacy.Emails // From config on startup, as stored emails are hashed in the form they had then
+
+	patrons       *patronStore            // Unset until the first sync. Replaced, rather than modified, by each sync.
+	interner      *interner               // Only used by UpdatePatrons
+	tierChanges   map[uint64]events.Event // Patron ID -> latest tier change
+	formerPatrons *formerPatrons
+	mu            sync.RWMutex
+
+	formerPatronWindow time.Duration // From config on startup. Former patrons aren't kept if 0.
+}
+
+// PatreonSource is the source of entitlements converted from the Patreon snapshot
+const PatreonSource = "Patreon"
+
+func NewEngine(
+	config config.Config,
+	tiers TierRegistry,
+	pledgeSources []sources.PledgeSource,
+	clk clock.Clock,
+	converter Converter,
+) *Engine {
+	return &Engine{
+		tiers:              tiers,
+		sources:            pledgeSources,
+		clock:              clk,
+		converter:          converter,
+		gracePeriodDays:    config.GracePeriodDays,
+		canonicalizeGmail:  config.Patreon.CanonicalizeGmail,
+		emails:             privacy.NewEmails(config),
+		interner:           newInterner(),
+		tierChanges:        make(map[uint64]events.Event),
+		formerPatrons:      newFormerPatrons(config.Patreon.CanonicalizeGmail),
+		formerPatronWindow: time.Duration(config.Patreon.FormerPatronDays) * time.Hour * 24,
+	}
+}
+
+func (e *Engine) UpdateConfig(config config.Config) {
+	e.configMu.Lock()
+	e.gracePeriodDays = config.GracePeriodDays
+	e.configMu.Unlock()
+
+	e.setCanonicalizeGmail(config.Patreon.CanonicalizeGmail)
+}
+
+// setCanonicalizeGmail rekeys the snapshot and former patrons by their emails normalized with or without Gmail
+// canonicalization, regrouping the members that share an email as the Patreon client does, so that lookups and the
+// diff against the next sync match the client's keys
+func (e *Engine) setCanonicalizeGmail(canonicalizeGmail bool) {
+	e.updateMu.Lock()
+	defer e.updateMu.Unlock()
+
+	if canonicalizeGmail == e.canonicalizeGmail {
+		return
+	}
+
+	e.canonicalizeGmail = canonicalizeGmail
+
+	e.mu.RLock()
+	previous := e.patrons
+	e.mu.RUnlock()
+
+	var next *patronStore
+	if previous != nil {
+		next = buildPatronStore(regroup(previous.patrons, canonicalizeGmail), canonicalizeGmail)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if next != nil {
+		e.patrons = next
+	}
+
+	e.formerPatrons = e.formerPatrons.rekeyed(canonicalizeGmail)
+}
+
+// UpdatePatrons applies the difference between the Patreon snapshot and the result of the latest sync, returning the
+// difference. The first sync after starting is loaded as the baseline, so nothing is returned for it. The updated
+// snapshot and its indexes are built without blocking lookups, then swapped in.
+func (e *Engine) UpdatePatrons(patrons map[string]patreon.Patron) patreon.SnapshotDiff {
+	// Only this method and setCanonicalizeGmail replace the snapshot, so while holding updateMu, the interner and the
+	// previous store can be used without the lock
+	e.updateMu.Lock()
+	defer e.updateMu.Unlock()
+
+	e.mu.RLock()
+	previous := e.patrons
+	e.mu.RUnlock()
+
+	var next *patronStore
+	var diff patreon.SnapshotDiff
+	if previous == nil {
+		interned := make([]patreon.Patron, 0, len(patrons))
+		for _, patron := range patrons {
+			interned = append(interned, e.interner.patron(patron))
+		}
+
+		next = buildPatronStore(interned, e.canonicalizeGmail)
+	} else {
+		if diff = previous.diff(patrons); diff.Empty() {
+			return diff
+		}
+
+		next = previous.apply(diff, e.interner)
+	}
+
+	e.mu.Lock()
+	e.patrons = next
+	e.mu.Unlock()
+
+	metrics.Pledges.Set(float64(next.count()))
+	return diff
+}
+
+// snapshot returns the current Patreon snapshot, which is empty until the first sync. It can be read without the lock.
+func (e *Engine) snapshot() *patronStore {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if e.patrons == nil {
+		return emptyPatronStore
+	}
+
+	return e.patrons
+}
+
+var emptyPatronStore = buildPatronStore(nil, false)
+
+// ApplyEvents tracks tier changes for proration. A new pledge or a cancellation clears the patron's last change, while
+// the outcome of a charge doesn't affect it. Patrons who cancel are kept as former patrons for the window, until they
+// pledge again.
+func (e *Engine) ApplyEvents(patronEvents []events.Event) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, event := range patronEvents {
+		if event.IsTierChange() {
+			e.tierChanges[event.PatronId] = event
+		} else if event.Type != events.TypeRenew && event.Type != events.TypeDecline {
+			delete(e.tierChanges, event.PatronId)
+		}
+
+		switch event.Type {
+		case events.TypeCancel:
+			if e.formerPatronWindow > 0 {
+				e.formerPatrons.add(database.FormerPatron{
+					PatronId:  event.PatronId,
+					Email:     event.Email,
+					DiscordId: event.DiscordId,
+					LastTiers: event.PreviousTiers,
+					EndedAt:   event.EffectiveAt,
+				})
+			}
+		case events.TypeNew:
+			e.formerPatrons.remove(event.PatronId)
+		}
+	}
+
+	e.formerPatrons.removeEndedBefore(e.clock.Now().Add(-e.formerPatronWindow))
+}
+
+// RestoreTierChanges loads the latest tier change of each patron from the patron history, so that proration data
+// survives restarts
+func (e *Engine) RestoreTierChanges(entries []database.PatronHistoryEntry) error {
+	restored := make([]events.Event, len(entries))
+	for i, entry := range entries {
+		if err := json.Unmarshal(entry.Details, &restored[i]); err != nil {
+			return fmt.Errorf("failed to decode patron history entry %d: %w", entry.Id, err)
+		}
+	}
+
+	e.ApplyEvents(restored)
+	return nil
+}
+
+// Loaded returns whether the first Patreon sync has completed
+func (e *Engine) Loaded() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.patrons != nil
+}
+
+// ActivePatrons returns the number of patrons in the snapshot who are entitled to at least one tier
+func (e *Engine) ActivePatrons() int {
+	count := 0
+	for _, patron := range e.snapshot().patrons {
+		if len(patron.Tiers) > 0 {
+			count++
+		}
+	}
+
+	return count
+}
+
+// ActivePledges returns the patrons in the snapshot who are entitled to at least one tier
+func (e *Engine) ActivePledges() []patreon.Patron {
+	var pledges []patreon.Patron
+	for _, patron := range e.snapshot().patrons {
+		if len(patron.Tiers) > 0 {
+			pledges = append(pledges, patron)
+		}
+	}
+
+	return pledges
+}
+
+// LinkedEntitlements returns the active Patreon entitlements of the patrons in the snapshot who have linked a Discord
+// account
+func (e *Engine) LinkedEntitlements() []Entitlement {
+	now := e.clock.Now()
+
+	var linked []Entitlement
+	for _, patron := range e.snapshot().patrons {
+		if patron.DiscordId == nil || len(patron.Tiers) == 0 {
+			continue
+		}
+
+		for _, entitlement := range e.fromPatron(patron, now) {
+			if entitlement.Active {
+				linked = append(linked, entitlement)
+			}
+		}
+	}
+
+	return linked
+}
+
+// LinkedDiscordIds returns the Discord IDs of the patrons in the snapshot who have linked a Discord account
+func (e *Engine) LinkedDiscordIds() []uint64 {
+	snapshot := e.snapshot()
+
+	discordIds := make([]uint64, 0, snapshot.linked())
+	for discordId := range snapshot.byDiscordId {
+		discordIds = append(discordIds, discordId)
+	}
+
+	return discordIds
+}
+
+// TierCounts returns the number of active patrons in the snapshot entitled to each tier. Members sharing an email are
+// counted once, as a single patron, for each tier that any of their active memberships is entitled to.
+func (e *Engine) TierCounts() map[uint64]int {
+	counts := make(map[uint64]int)
+	for _, patron := range e.snapshot().patrons {
+		tierIds := make(map[uint64]struct{})
+		for _, member := range append([]patreon.Patron{patron}, patron.Duplicates...) {
+			if member.PatronStatus != "active_patron" {
+				continue
+			}
+
+			for _, tierId := range member.Tiers {
+				tierIds[tierId] = struct{}{}
+			}
+		}
+
+		for tierId := range tierIds {
+			counts[tierId]++
+		}
+	}
+
+	return counts
+}
+
+// PatronCounts returns the number of patrons in the snapshot, and how many of them have linked a Discord account
+func (e *Engine) PatronCounts() (patrons, linked int) {
+	snapshot := e.snapshot()
+	return snapshot.count(), snapshot.linked()
+}
+
+// ByEmail returns the entitlements from every provider for the email, which is normalized before looking up the
+// Patreon snapshot, and hashed first if emails are stored hashed. Sources that fail are skipped, and their errors are
+// returned alongside the entitlements from the other sources.
+func (e *Engine) ByEmail(ctx context.Context, email string) ([]Entitlement, error) {
+	email = e.emails.Protect(email)
+	patron, ok := e.snapshot().get(email)
+	former, isFormer := e.formerPatron(func(f *formerPatrons) (database.FormerPatron, bool) {
+		return f.get(email)
+	})
+
+	return e.collect(e.patreonEntitlements(ok, patron, isFormer, former), func(source sources.PledgeSource) ([]sources.Entitlement, error) {
+		return source.ByEmail(ctx, email)
+	})
+}
+
+// ByDiscordId returns the entitlements from every provider for the Discord user, in the same way as ByEmail
+func (e *Engine) ByDiscordId(ctx context.Context, discordId uint64) ([]Entitlement, error) {
+	patron, ok := e.snapshot().getByDiscordId(discordId)
+	former, isFormer := e.formerPatron(func(f *formerPatrons) (database.FormerPatron, bool) {
+		return f.getByDiscordId(discordId)
+	})
+
+	return e.collect(e.patreonEntitlements(ok, patron, isFormer, former), func(source sources.PledgeSource) ([]sources.Entitlement, error) {
+		return source.ByDiscordId(ctx, discordId)
+	})
+}
+
+// ByPatronId returns the Patreon entitlements of the patron. Only the Patreon snapshot is searched, as other providers
+// don't know the patron ID.
+func (e *Engine) ByPatronId(patronId uint64) []Entitlement {
+	patron, ok := e.snapshot().getByPatronId(patronId)
+	former, isFormer := e.formerPatron(func(f *formerPatrons) (database.FormerPatron, bool) {
+		return f.getByPatronId(patronId)
+	})
+
+	return e.patreonEntitlements(ok, patron, isFormer, former)
+}
+
+// patreonEntitlements returns the entitlements of the patron, if they are in the snapshot, or otherwise of the former
+// patron, if their pledge ended within the window
+func (e *Engine) patreonEntitlements(hasPatron bool, patron patreon.Patron, isFormer bool, former database.FormerPatron) []Entitlement {
+	switch {
+	case hasPatron:
+		return e.fromPatron(patron, e.clock.Now())
+	case isFormer:
+		return []Entitlement{e.fromFormerPatron(former)}
+	default:
+		return nil
+	}
+}
+
+// PatronsByDiscordId returns every patron in the Patreon snapshot linked to the Discord user. Several patrons can be
+// linked to the same account, in which case ByDiscordId only returns the entitlements of one of them.
+func (e *Engine) PatronsByDiscordId(discordId uint64) []patreon.Patron {
+	return e.snapshot().getAllByDiscordId(discordId)
+}
+
+// PatronsByEmail returns the patrons in the Patreon snapshot that an email lookup may refer to. If a patron has the
+// email, it is returned first, followed by any other members with the same email. Otherwise, up to limit patrons whose
+// email contains the query are returned. If emails are stored hashed, only the masked part of each email is searched.
+func (e *Engine) PatronsByEmail(query string, limit int) []patreon.Patron {
+	snapshot := e.snapshot()
+	if patron, ok := snapshot.get(e.emails.Protect(query)); ok {
+		patrons := append([]patreon.Patron{patron}, patron.Duplicates...)
+		for i := range patrons {
+			patrons[i].Duplicates = nil
+		}
+
+		return patrons
+	}
+
+	return snapshot.search(query, limit)
+}
+
+// PatronsByDomain returns the members in the Patreon snapshot whose email is at the domain or one of its subdomains
+func (e *Engine) PatronsByDomain(domain string) []patreon.Patron {
+	return e.snapshot().byDomain(domain)
+}
+
+// collect returns the Patreon entitlements followed by those of every other source
+func (e *Engine) collect(
+	entitlements []Entitlement,
+	lookup func(source sources.PledgeSource) ([]sources.Entitlement, error),
+) ([]Entitlement, error) {
+	now := e.clock.Now()
+
+	var errs []error
+	for _, source := range e.sources {
+		res, err := lookup(source)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", source.Name(), err))
+			continue
+		}
+
+		for _, entitlement := range res {
+			entitlements = append(entitlements, e.fromSource(entitlement, now))
+		}
+	}
+
+	return entitlements, errors.Join(errs...)
+}
+
+// fromPatron produces an entitlement per tier. Patrons without any entitled tiers produce a single inactive
+// entitlement with no tier, so that their account can still be found, describing how their pledge ended if it ended
+// within the former patron window.
+func (e *Engine) fromPatron(patron patreon.Patron, now time.Time) []Entitlement {
+	base := Entitlement{
+		Source:           PatreonSource,
+		Reference:        strconv.FormatUint(patron.Id, 10),
+		Email:            ptr(patron.Email),
+		DiscordId:        patron.DiscordId,
+		Status:           patron.PatronStatus,
+		StartsAt:         nonZero(patron.PledgeRelationshipStart),
+		LastChargeAt:     nonZero(patron.LastChargeDate),
+		LastChargeStatus: patron.LastChargeStatus,
+		MaxGuilds:        defaultMaxGuilds,
+
+		AmountCents:       e.converter.ToBase(patron.CurrentlyEntitledAmountCents, patron.Currency),
+		LifetimePaidCents: e.converter.ToBase(patron.LifetimeSupportCents, patron.Currency),
+		PledgeCurrency:    patron.Currency,
+		CadenceMonths:     patron.PledgeCadence,
+		NextChargeAt:      nonZero(patron.NextChargeDate.Time),
+		Gifted:            patron.IsGifted,
+	}
+
+	for _, duplicate := range patron.Duplicates {
+		base.DuplicateReferences = append(base.DuplicateReferences, strconv.FormatUint(duplicate.Id, 10))
+	}
+
+	e.mu.RLock()
+	change, changed := e.tierChanges[patron.Id]
+	e.mu.RUnlock()
+
+	// Changes made before the last charge are already reflected in it
+	if changed && (base.LastChargeAt == nil || change.EffectiveAt.After(*base.LastChargeAt)) {
+		base.Proration = e.proration(change, base.LastChargeAt, patron.CadenceMonths())
+	}
+
+	if len(patron.Tiers) == 0 {
+		base.PremiumExpiresAt = patronExpiry(patron, e.gracePeriod(config.Tier{}))
+
+		if former, ok := e.formerPatron(func(f *formerPatrons) (database.FormerPatron, bool) {
+			return f.getByPatronId(patron.Id)
+		}); ok {
+			base.Former = e.formerPledge(former)
+		}
+
+		return []Entitlement{base}
+	}
+
+	entitlements := make([]Entitlement, len(patron.Tiers))
+	for i, tierId := range patron.Tiers {
+		entitlement := base
+		entitlement.TierId = tierId
+
+		tier, ok := e.tiers.Tier(tierId)
+		if ok {
+			entitlement.applyTier(tier)
+		} else {
+			entitlement.Tier = fmt.Sprintf("Unknown (ID: %d)", tierId)
+		}
+
+		// A declined patron lapsed at the charge that failed
+		grace := e.gracePeriod(tier)
+		entitlement.resolve(now, entitlement.LastChargeAt, grace)
+		entitlement.PremiumExpiresAt = patronExpiry(patron, grace)
+		entitlements[i] = entitlement
+	}
+
+	return entitlements
+}
+
+func (e *Engine) fromSource(source sources.Entitlement, now time.Time) Entitlement {
+	entitlement := Entitlement{
+		Source:    source.Source,
+		Reference: source.Reference,
+		Email:     source.Email,
+		DiscordId: source.DiscordId,
+		Tier:      source.Tier,
+		Status:    source.Status,
+		StartsAt:  source.StartedAt,
+		EndsAt:    source.ExpiresAt,
+		MaxGuilds: defaultMaxGuilds,
+	}
+
+	tier, ok := e.tiers.ByName(source.Tier)
+	if ok {
+		entitlement.applyTier(tier)
+	}
+
+	// Other providers don't report when a payment failed, only when the period it paid for ends
+	entitlement.resolve(now, source.ExpiresAt, e.gracePeriod(tier))
+
+	entitlement.PremiumExpiresAt = entitlement.EndsAt
+	if entitlement.GraceEndsAt != nil {
+		entitlement.PremiumExpiresAt = entitlement.GraceEndsAt
+	}
+
+	return entitlement
+}
+
+func (e *Engine) proration(change events.Event, cycleStartedAt *time.Time, cadenceMonths int) *Proration {
+	proration := &Proration{
+		PreviousTiers:       make([]string, len(change.PreviousTiers)),
+		ChangedAt:           change.EffectiveAt,
+		PreviousAmountCents: e.converter.ToBase(change.PreviousAmountCents, change.Currency),
+		AmountCents:         e.converter.ToBase(change.AmountCents, change.Currency),
+		CycleStartedAt:      cycleStartedAt,
+	}
+
+	for i, tierId := range change.PreviousTiers {
+		if tier, ok := e.tiers.Tier(tierId); ok {
+			proration.PreviousTiers[i] = tier.Name
+		} else {
+			proration.PreviousTiers[i] = fmt.Sprintf("Unknown (ID: %d)", tierId)
+		}
+	}
+
+	if cycleStartedAt != nil {
+		cycleEndsAt := cycleStartedAt.AddDate(0, cadenceMonths, 0)
+		remaining := float64(cycleEndsAt.Sub(change.EffectiveAt)) / float64(cycleEndsAt.Sub(*cycleStartedAt))
+		remaining = min(max(remaining, 0), 1)
+
+		proration.ProratedAmountCents = ptr(int(math.Round(float64(proration.AmountCents-proration.PreviousAmountCents) * remaining)))
+	}
+
+	return proration
+}
+
+// patronExpiry returns when a patron's access ends, unless they are charged again. Patreon only reports the latest
+// charge attempt: a paid charge covers the billing period until the next charge, a year for annual pledges, while any
+// other outcome ends the previous one.
+func patronExpiry(patron patreon.Patron, grace time.Duration) *time.Time {
+	if patron.LastChargeDate.IsZero() {
+		return nil
+	}
+
+	expiresAt := patron.LastChargeDate
+	if patron.LastChargeStatus == "Paid" {
+		if patron.NextChargeDate.After(expiresAt) {
+			expiresAt = patron.NextChargeDate.Time
+		} else {
+			expiresAt = expiresAt.AddDate(0, patron.CadenceMonths(), 0)
+		}
+	}
+
+	return ptr(expiresAt.Add(grace))
+}
+
+func (e *Entitlement) applyTier(tier config.Tier) {
+	e.Tier = tier.Name
+	e.Sku = tier.Sku
+	e.RoleId = tier.RoleId
+
+	if tier.MaxGuilds > 0 {
+		e.MaxGuilds = tier.MaxGuilds
+	}
+}
+
+// gracePeriod returns the tier's grace period override, or the configured default
+func (e *Engine) gracePeriod(tier config.Tier) time.Duration {
+	if tier.GracePeriodDays != nil {
+		return time.Duration(*tier.GracePeriodDays) * time.Hour * 24
+	}
+
+	e.configMu.RLock()
+	defer e.configMu.RUnlock()
+
+	return time.Duration(e.gracePeriodDays) * time.Hour * 24
+}
+
+func nonZero(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
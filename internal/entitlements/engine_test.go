@@ -0,0 +1,142 @@
+package entitlements
+
+import (
+	"testing"
+	"time"
+
+	"github.com/TicketsBot/subscriptions-app/internal/clock"
+	"github.com/TicketsBot/subscriptions-app/internal/config"
+	"github.com/TicketsBot/subscriptions-app/pkg/patreon"
+)
+
+// testTiers knows a single tier
+type testTiers struct{}
+
+func (testTiers) Tier(tierId uint64) (config.Tier, bool) {
+	return config.Tier{Name: "Premium"}, tierId == 1001
+}
+
+func (testTiers) ByName(name string) (config.Tier, bool) {
+	return config.Tier{Name: "Premium"}, name == "Premium"
+}
+
+// identityConverter treats every amount as in the campaign currency
+type identityConverter struct{}
+
+func (identityConverter) ToBase(cents int, _ string) int {
+	return cents
+}
+
+func TestGracePeriod(t *testing.T) {
+	declinedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(declinedAt)
+
+	var conf config.Config
+	conf.GracePeriodDays = 3
+
+	engine := NewEngine(conf, testTiers{}, nil, clk, identityConverter{})
+	engine.UpdatePatrons(map[string]patreon.Patron{
+		"patron@example.com": {
+			Attributes: patreon.Attributes{
+				Email:            "patron@example.com",
+				PatronStatus:     "declined_patron",
+				LastChargeStatus: "Declined",
+				LastChargeDate:   declinedAt,
+			},
+			Id:    1,
+			Tiers: []uint64{1001},
+		},
+	})
+
+	active := func() bool {
+		t.Helper()
+
+		entitlements := engine.ByPatronId(1)
+		if len(entitlements) != 1 {
+			t.Fatalf("expected 1 entitlement, got %d", len(entitlements))
+		}
+
+		if want := declinedAt.Add(3 * 24 * time.Hour); entitlements[0].GraceEndsAt == nil || !entitlements[0].GraceEndsAt.Equal(want) {
+			t.Errorf("expected the grace period to end at %s, got %v", want, entitlements[0].GraceEndsAt)
+		}
+
+		return entitlements[0].Active
+	}
+
+	if !active() {
+		t.Error("expected a declined patron to keep their entitlement during the grace period")
+	}
+
+	clk.Advance(3*24*time.Hour - time.Second)
+	if !active() {
+		t.Error("expected the entitlement to be active until the grace period ends")
+	}
+
+	clk.Advance(time.Second)
+	if active() {
+		t.Error("expected the entitlement to be inactive once the grace period has ended")
+	}
+
+	// Reloaded config applies to lookups straight away
+	conf.GracePeriodDays = 7
+	engine.UpdateConfig(conf)
+
+	entitlements := engine.ByPatronId(1)
+	if !entitlements[0].Active {
+		t.Error("expected a longer grace period to restore the entitlement")
+	}
+}
+
+func TestTierCounts(t *testing.T) {
+	member := func(id uint64, status string, tierIds ...uint64) patreon.Patron {
+		return patreon.Patron{Attributes: patreon.Attributes{PatronStatus: status}, Id: id, Tiers: tierIds}
+	}
+
+	shared := member(1, "active_patron", 1001)
+	shared.Duplicates = []patreon.Patron{member(2, "active_patron", 1001, 1002), member(3, "declined_patron", 1003)}
+
+	engine := NewEngine(config.Config{}, testTiers{}, nil, clock.Real, identityConverter{})
+	engine.UpdatePatrons(map[string]patreon.Patron{
+		"shared@example.com":   shared,
+		"declined@example.com": member(4, "declined_patron", 1001),
+		"active@example.com":   member(5, "active_patron", 1001),
+	})
+
+	counts := engine.TierCounts()
+
+	// The members sharing an email count once for each tier, and declined memberships aren't counted
+	if counts[1001] != 2 || counts[1002] != 1 || counts[1003] != 0 {
+		t.Errorf("expected counts of 2, 1 and 0, got %d, %d and %d", counts[1001], counts[1002], counts[1003])
+	}
+}
+
+func TestReloadCanonicalizeGmail(t *testing.T) {
+	engine := NewEngine(config.Config{}, testTiers{}, nil, clock.Real, identityConverter{})
+	engine.UpdatePatrons(map[string]patreon.Patron{
+		"foo.bar@gmail.com": {Attributes: patreon.Attributes{Email: "foo.bar@gmail.com", PatronStatus: "active_patron"}, Id: 1, Tiers: []uint64{1001}},
+		"foobar@gmail.com":  {Attributes: patreon.Attributes{Email: "foobar@gmail.com", PatronStatus: "former_patron"}, Id: 2},
+	})
+
+	if patrons := engine.PatronsByEmail("foobar@gmail.com", 10); len(patrons) != 1 || patrons[0].Id != 2 {
+		t.Fatalf("expected only the exact email to match before canonicalizing, got %+v", patrons)
+	}
+
+	var conf config.Config
+	conf.Patreon.CanonicalizeGmail = true
+	engine.UpdateConfig(conf)
+
+	// The members now share an email, so are regrouped with the entitled member preferred
+	patrons := engine.PatronsByEmail("foobar+patreon@gmail.com", 10)
+	if len(patrons) != 2 || patrons[0].Id != 1 || patrons[1].Id != 2 {
+		t.Fatalf("expected both members, preferring the entitled one, got %+v", patrons)
+	}
+
+	if count, _ := engine.PatronCounts(); count != 1 {
+		t.Errorf("expected the members to be counted as 1 patron, got %d", count)
+	}
+
+	engine.UpdateConfig(config.Config{})
+	if count, _ := engine.PatronCounts(); count != 2 {
+		t.Errorf("expected the members to be split again, got %d patrons", count)
+	}
+}
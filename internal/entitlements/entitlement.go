@@ -0,0 +1,108 @@
+package entitlements
+
+import "time"
+
+// Entitlement is a canonical product entitlement, converted from a provider's raw data. Patreon patrons produce one
+// entitlement per tier.
+type Entitlement struct {
+	Source    string  `json:"source"`
+	Reference string  `json:"reference"` // The provider's ID for the subscription, or the patron ID for Patreon
+	Email     *string `json:"email"`
+	DiscordId *uint64 `json:"discord_id,string"`
+
+	TierId uint64 `json:"tier_id,string,omitempty"` // Patreon tier ID, unset for other sources
+	Tier   string `json:"tier"`
+	Sku    uint64 `json:"sku,string,omitempty"`     // From the tier metadata, unset if the tier has no SKU
+	RoleId uint64 `json:"role_id,string,omitempty"` // From the tier metadata, unset if the tier grants no role
+
+	MaxGuilds int `json:"max_guilds"` // How many guilds the user can allocate premium to through this entitlement
+
+	Status      string     `json:"status"` // As reported by the provider
+	Active      bool       `json:"active"`
+	StartsAt    *time.Time `json:"starts_at"`
+	EndsAt      *time.Time `json:"ends_at"`
+	GraceEndsAt *time.Time `json:"grace_ends_at"` // Set if the subscription has lapsed, but access is kept until then
+
+	// PremiumExpiresAt is when access ends if nothing changes, including the grace period, so consumers can cache the
+	// entitlement until then. Unset if it doesn't expire.
+	PremiumExpiresAt *time.Time `json:"premium_expires_at"`
+
+	// Patreon only
+	LastChargeAt      *time.Time    `json:"last_charge_at,omitempty"`
+	LastChargeStatus  string        `json:"last_charge_status,omitempty"`
+	AmountCents       int           `json:"amount_cents,omitempty"`        // The amount the patron currently pledges
+	LifetimePaidCents int           `json:"lifetime_paid_cents,omitempty"` // The total the patron has paid the campaign
+	PledgeCurrency    string        `json:"pledge_currency,omitempty"`     // If known. Amounts are in the campaign currency.
+	CadenceMonths     int           `json:"cadence_months,omitempty"`      // Months paid for by each charge, 12 if annual
+	NextChargeAt      *time.Time    `json:"next_charge_at,omitempty"`
+	Gifted            bool          `json:"gifted,omitempty"`    // Set if someone else paid for the membership
+	Proration         *Proration    `json:"proration,omitempty"` // Set if the tiers changed mid-cycle
+	Former            *FormerPledge `json:"former,omitempty"`    // Set if the patron's pledge ended within the window
+
+	// DuplicateReferences are the patron IDs of other members with the same email, which weren't preferred
+	DuplicateReferences []string `json:"duplicate_references,omitempty"`
+}
+
+// FormerPledge describes the pledge of a patron without any tiers, whose pledge ended within the former patron window
+type FormerPledge struct {
+	LastTiers []string  `json:"last_tiers"`
+	EndedAt   time.Time `json:"ended_at"` // When the pledge was seen to have ended
+}
+
+// Proration describes a tier change since the patron was last charged, for billing reconciliation
+type Proration struct {
+	PreviousTiers       []string   `json:"previous_tiers"`
+	ChangedAt           time.Time  `json:"changed_at"`
+	PreviousAmountCents int        `json:"previous_amount_cents"`
+	AmountCents         int        `json:"amount_cents"`
+	CycleStartedAt      *time.Time `json:"cycle_started_at"`
+
+	// ProratedAmountCents is the difference between the amounts for the rest of the billing cycle after the change,
+	// negative for downgrades. Unset if the cycle start is unknown, which is told apart from a difference of zero.
+	ProratedAmountCents *int `json:"prorated_amount_cents,omitempty"`
+}
+
+const defaultMaxGuilds = 1
+
+type statusKind int
+
+const (
+	statusInactive statusKind = iota
+	statusActive
+	statusLapsed    // Payment failed, access is kept for the grace period
+	statusCancelled // Cancelled, but access is kept until the end of the paid period
+)
+
+// statusKinds groups the statuses of every provider. Statuses that aren't listed are inactive.
+var statusKinds = map[string]statusKind{
+	"active":          statusActive,
+	"active_patron":   statusActive,
+	"trialing":        statusActive,
+	"on_trial":        statusActive,
+	"past_due":        statusLapsed,
+	"unpaid":          statusLapsed,
+	"declined_patron": statusLapsed,
+	"cancelled":       statusCancelled, // Lemon Squeezy, whereas Paddle's "canceled" has already ended
+}
+
+// resolve sets whether the entitlement is active, applying the grace period to lapsed subscriptions. lapsedAt is when
+// the subscription lapsed, if known.
+func (e *Entitlement) resolve(now time.Time, lapsedAt *time.Time, grace time.Duration) {
+	switch statusKinds[e.Status] {
+	case statusActive:
+		e.Active = e.EndsAt == nil || now.Before(*e.EndsAt)
+	case statusLapsed:
+		if lapsedAt != nil {
+			e.GraceEndsAt = ptr(lapsedAt.Add(grace))
+			e.Active = now.Before(*e.GraceEndsAt)
+		}
+	case statusCancelled:
+		e.Active = e.EndsAt != nil && now.Before(*e.EndsAt)
+	default:
+		e.Active = false
+	}
+}
+
+func ptr[T any](value T) *T {
+	return &value
+}
@@ -0,0 +1,168 @@
+package entitlements
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/TicketsBot/subscriptions-app/internal/database"
+	"github.com/TicketsBot/subscriptions-app/pkg/patreon"
+)
+
+// formerPatrons holds the patrons whose pledge ended, so that they can still be found once Patreon stops listing them.
+// Emails are indexed by their normalized form. Unlike the snapshot, it is modified in place, under the engine's lock.
+type formerPatrons struct {
+	byPatronId  map[uint64]database.FormerPatron
+	byEmail     map[string]uint64 // Normalized email -> patron ID
+	byDiscordId map[uint64]uint64 // Discord ID -> patron ID
+
+	canonicalizeGmail bool
+}
+
+func newFormerPatrons(canonicalizeGmail bool) *formerPatrons {
+	return &formerPatrons{
+		byPatronId:        make(map[uint64]database.FormerPatron),
+		byEmail:           make(map[string]uint64),
+		byDiscordId:       make(map[uint64]uint64),
+		canonicalizeGmail: canonicalizeGmail,
+	}
+}
+
+// rekeyed returns the former patrons indexed by their emails normalized with or without Gmail canonicalization
+func (f *formerPatrons) rekeyed(canonicalizeGmail bool) *formerPatrons {
+	rekeyed := newFormerPatrons(canonicalizeGmail)
+	for _, patron := range f.byPatronId {
+		rekeyed.add(patron)
+	}
+
+	return rekeyed
+}
+
+func (f *formerPatrons) key(email string) string {
+	return patreon.NormalizeEmail(email, f.canonicalizeGmail)
+}
+
+// add records the patron, replacing any earlier record of theirs
+func (f *formerPatrons) add(patron database.FormerPatron) {
+	f.remove(patron.PatronId)
+
+	f.byPatronId[patron.PatronId] = patron
+	f.byEmail[f.key(patron.Email)] = patron.PatronId
+	if patron.DiscordId != nil {
+		f.byDiscordId[*patron.DiscordId] = patron.PatronId
+	}
+}
+
+func (f *formerPatrons) remove(patronId uint64) {
+	patron, ok := f.byPatronId[patronId]
+	if !ok {
+		return
+	}
+
+	delete(f.byPatronId, patronId)
+
+	// The indexes may point at another patron that has since taken the email or Discord account
+	if key := f.key(patron.Email); f.byEmail[key] == patronId {
+		delete(f.byEmail, key)
+	}
+
+	if patron.DiscordId != nil && f.byDiscordId[*patron.DiscordId] == patronId {
+		delete(f.byDiscordId, *patron.DiscordId)
+	}
+}
+
+// removeEndedBefore removes the patrons whose pledge ended before the time, as they are no longer served
+func (f *formerPatrons) removeEndedBefore(before time.Time) {
+	for patronId, patron := range f.byPatronId {
+		if patron.EndedAt.Before(before) {
+			f.remove(patronId)
+		}
+	}
+}
+
+func (f *formerPatrons) get(email string) (database.FormerPatron, bool) {
+	patronId, ok := f.byEmail[f.key(email)]
+	if !ok {
+		return database.FormerPatron{}, false
+	}
+
+	return f.getByPatronId(patronId)
+}
+
+func (f *formerPatrons) getByDiscordId(discordId uint64) (database.FormerPatron, bool) {
+	patronId, ok := f.byDiscordId[discordId]
+	if !ok {
+		return database.FormerPatron{}, false
+	}
+
+	return f.getByPatronId(patronId)
+}
+
+func (f *formerPatrons) getByPatronId(patronId uint64) (database.FormerPatron, bool) {
+	patron, ok := f.byPatronId[patronId]
+	return patron, ok
+}
+
+// RestoreFormerPatrons loads the patrons whose pledge ended within the former patron window, so that they can be found
+// across restarts
+func (e *Engine) RestoreFormerPatrons(patrons []database.FormerPatron) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, patron := range patrons {
+		e.formerPatrons.add(patron)
+	}
+}
+
+// formerPatron looks up a former patron whose pledge ended within the window
+func (e *Engine) formerPatron(lookup func(f *formerPatrons) (database.FormerPatron, bool)) (database.FormerPatron, bool) {
+	if e.formerPatronWindow <= 0 {
+		return database.FormerPatron{}, false
+	}
+
+	e.mu.RLock()
+	patron, ok := lookup(e.formerPatrons)
+	e.mu.RUnlock()
+
+	if !ok || patron.EndedAt.Before(e.clock.Now().Add(-e.formerPatronWindow)) {
+		return database.FormerPatron{}, false
+	}
+
+	return patron, true
+}
+
+// formerPledge describes how the former patron's pledge ended, naming their last tiers
+func (e *Engine) formerPledge(patron database.FormerPatron) *FormerPledge {
+	pledge := &FormerPledge{
+		LastTiers: make([]string, len(patron.LastTiers)),
+		EndedAt:   patron.EndedAt,
+	}
+
+	for i, tierId := range patron.LastTiers {
+		if tier, ok := e.tiers.Tier(tierId); ok {
+			pledge.LastTiers[i] = tier.Name
+		} else {
+			pledge.LastTiers[i] = fmt.Sprintf("Unknown (ID: %d)", tierId)
+		}
+	}
+
+	return pledge
+}
+
+// fromFormerPatron produces a single inactive entitlement for a former patron who is no longer in the snapshot
+func (e *Engine) fromFormerPatron(patron database.FormerPatron) Entitlement {
+	return Entitlement{
+		Source:    PatreonSource,
+		Reference: strconv.FormatUint(patron.PatronId, 10),
+		Email:     ptr(patron.Email),
+		DiscordId: patron.DiscordId,
+		Status:    formerPatronStatus,
+		EndsAt:    ptr(patron.EndedAt),
+		Former:    e.formerPledge(patron),
+
+		PremiumExpiresAt: ptr(patron.EndedAt),
+	}
+}
+
+// formerPatronStatus is the status Patreon gives members who no longer pledge
+const formerPatronStatus = "former_patron"
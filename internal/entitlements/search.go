@@ -0,0 +1,64 @@
+package entitlements
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/TicketsBot/subscriptions-app/pkg/patreon"
+)
+
+// PatronSearch holds the criteria of a search of the Patreon snapshot. Criteria that are unset match every patron.
+type PatronSearch struct {
+	Status       string // Patreon's status of the patron, such as active_patron
+	TierId       uint64 // A tier the patron is entitled to
+	JoinedAfter  *time.Time
+	JoinedBefore *time.Time
+	ChargeStatus string // The status of the patron's last charge, such as Declined
+}
+
+// matches returns whether the member meets every criterion. Statuses are compared ignoring case.
+func (s PatronSearch) matches(patron patreon.Patron) bool {
+	if s.Status != "" && !strings.EqualFold(patron.PatronStatus, s.Status) {
+		return false
+	}
+
+	if s.TierId != 0 && !slices.Contains(patron.Tiers, s.TierId) {
+		return false
+	}
+
+	if s.JoinedAfter != nil && !patron.PledgeRelationshipStart.After(*s.JoinedAfter) {
+		return false
+	}
+
+	if s.JoinedBefore != nil && !patron.PledgeRelationshipStart.Before(*s.JoinedBefore) {
+		return false
+	}
+
+	if s.ChargeStatus != "" && !strings.EqualFold(patron.LastChargeStatus, s.ChargeStatus) {
+		return false
+	}
+
+	return true
+}
+
+// SearchPatrons returns the members in the Patreon snapshot, including members sharing an email with another patron,
+// that match the search, ordered by when they joined, most recent first
+func (e *Engine) SearchPatrons(search PatronSearch) []patreon.Patron {
+	var matches []patreon.Patron
+	for _, patron := range e.snapshot().patrons {
+		for _, member := range append([]patreon.Patron{patron}, patron.Duplicates...) {
+			if search.matches(member) {
+				member.Duplicates = nil
+				matches = append(matches, member)
+			}
+		}
+	}
+
+	slices.SortFunc(matches, func(a, b patreon.Patron) int {
+		return cmp.Or(b.PledgeRelationshipStart.Compare(a.PledgeRelationshipStart), cmp.Compare(a.Id, b.Id))
+	})
+
+	return matches
+}
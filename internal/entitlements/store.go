@@ -0,0 +1,347 @@
+package entitlements
+
+import (
+	"cmp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/TicketsBot/subscriptions-app/internal/privacy"
+	"github.com/TicketsBot/subscriptions-app/pkg/patreon"
+)
+
+// patronStore holds a Patreon snapshot. Each patron is stored once, in a slice, and looked up through maps of indexes
+// into it. Emails are indexed by their normalized form, while patrons keep the original for display. A store is not
+// modified once built, so it can be read without holding a lock; updates build a new store to swap in.
+type patronStore struct {
+	patrons     []patreon.Patron
+	byEmail     map[string]int32 // Keyed by normalized email
+	byDiscordId map[uint64]int32
+	byPatronId  map[uint64]int32 // Members sharing an email are indexed to the patron they were merged into
+
+	// sharedDiscordIds holds every patron linked to a Discord account that more than one patron is linked to
+	sharedDiscordIds map[uint64][]int32
+
+	canonicalizeGmail bool
+}
+
+// buildPatronStore indexes the patrons, building each index in parallel
+func buildPatronStore(patrons []patreon.Patron, canonicalizeGmail bool) *patronStore {
+	s := &patronStore{
+		patrons:           patrons,
+		byEmail:           make(map[string]int32, len(patrons)),
+		byDiscordId:       make(map[uint64]int32, len(patrons)),
+		byPatronId:        make(map[uint64]int32, len(patrons)),
+		sharedDiscordIds:  make(map[uint64][]int32),
+		canonicalizeGmail: canonicalizeGmail,
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+
+	go func() {
+		defer wg.Done()
+
+		for i, patron := range patrons {
+			s.byEmail[s.key(patron.Email)] = int32(i)
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+
+		for i, patron := range patrons {
+			if patron.DiscordId == nil {
+				continue
+			}
+
+			if existing, ok := s.byDiscordId[*patron.DiscordId]; ok {
+				if _, shared := s.sharedDiscordIds[*patron.DiscordId]; !shared {
+					s.sharedDiscordIds[*patron.DiscordId] = []int32{existing}
+				}
+
+				s.sharedDiscordIds[*patron.DiscordId] = append(s.sharedDiscordIds[*patron.DiscordId], int32(i))
+			}
+
+			s.byDiscordId[*patron.DiscordId] = int32(i)
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+
+		for i, patron := range patrons {
+			s.byPatronId[patron.Id] = int32(i)
+
+			for _, duplicate := range patron.Duplicates {
+				s.byPatronId[duplicate.Id] = int32(i)
+			}
+		}
+	}()
+
+	wg.Wait()
+	return s
+}
+
+// regroup groups the patrons' members, including their duplicates, by their emails normalized with or without Gmail
+// canonicalization, in the same way as the Patreon client groups the members it fetches
+func regroup(patrons []patreon.Patron, canonicalizeGmail bool) []patreon.Patron {
+	byKey := make(map[string]patreon.Patron, len(patrons))
+	order := make([]string, 0, len(patrons))
+	for _, patron := range patrons {
+		for _, member := range append([]patreon.Patron{patron}, patron.Duplicates...) {
+			member.Duplicates = nil
+
+			key := patreon.NormalizeEmail(member.Email, canonicalizeGmail)
+			if existing, ok := byKey[key]; ok {
+				member = patreon.MergeDuplicate(existing, member)
+			} else {
+				order = append(order, key)
+			}
+
+			byKey[key] = member
+		}
+	}
+
+	regrouped := make([]patreon.Patron, len(order))
+	for i, key := range order {
+		regrouped[i] = byKey[key]
+	}
+
+	return regrouped
+}
+
+func (s *patronStore) count() int {
+	return len(s.patrons)
+}
+
+func (s *patronStore) linked() int {
+	return len(s.byDiscordId)
+}
+
+func (s *patronStore) key(email string) string {
+	return patreon.NormalizeEmail(email, s.canonicalizeGmail)
+}
+
+// get returns the patron with the email, which is normalized first
+func (s *patronStore) get(email string) (patreon.Patron, bool) {
+	i, ok := s.byEmail[s.key(email)]
+	return s.at(i, ok)
+}
+
+func (s *patronStore) getByDiscordId(discordId uint64) (patreon.Patron, bool) {
+	i, ok := s.byDiscordId[discordId]
+	return s.at(i, ok)
+}
+
+// getByPatronId returns the member with the patron ID, including members that were merged into another patron because
+// they share its email
+func (s *patronStore) getByPatronId(patronId uint64) (patreon.Patron, bool) {
+	i, ok := s.byPatronId[patronId]
+	patron, ok := s.at(i, ok)
+	if !ok || patron.Id == patronId {
+		return patron, ok
+	}
+
+	for _, duplicate := range patron.Duplicates {
+		if duplicate.Id == patronId {
+			return duplicate, true
+		}
+	}
+
+	return patreon.Patron{}, false
+}
+
+// getAllByDiscordId returns every patron linked to the Discord account
+func (s *patronStore) getAllByDiscordId(discordId uint64) []patreon.Patron {
+	if shared, ok := s.sharedDiscordIds[discordId]; ok {
+		patrons := make([]patreon.Patron, len(shared))
+		for j, i := range shared {
+			patrons[j] = s.patrons[i]
+		}
+
+		return patrons
+	}
+
+	if patron, ok := s.getByDiscordId(discordId); ok {
+		return []patreon.Patron{patron}
+	}
+
+	return nil
+}
+
+// search returns up to limit patrons whose email contains the query, ignoring case, ordered by email. Only the masked
+// part of hashed emails is searched, so that queries don't match their hashes.
+func (s *patronStore) search(query string, limit int) []patreon.Patron {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return nil
+	}
+
+	var matches []patreon.Patron
+	for _, patron := range s.patrons {
+		if strings.Contains(strings.ToLower(privacy.Masked(patron.Email)), query) {
+			matches = append(matches, patron)
+		}
+	}
+
+	slices.SortFunc(matches, func(a, b patreon.Patron) int {
+		return strings.Compare(privacy.Masked(a.Email), privacy.Masked(b.Email))
+	})
+
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	return matches
+}
+
+func (s *patronStore) at(i int32, ok bool) (patreon.Patron, bool) {
+	if !ok {
+		return patreon.Patron{}, false
+	}
+
+	return s.patrons[i], true
+}
+
+// byDomain returns the patrons, including members sharing an email with another patron, whose email is at the domain
+// or one of its subdomains, ignoring case, ordered by email
+func (s *patronStore) byDomain(domain string) []patreon.Patron {
+	domain = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(domain), "@"))
+	if domain == "" {
+		return nil
+	}
+
+	var matches []patreon.Patron
+	for _, patron := range s.patrons {
+		for _, member := range append([]patreon.Patron{patron}, patron.Duplicates...) {
+			if emailDomainMatches(member.Email, domain) {
+				member.Duplicates = nil
+				matches = append(matches, member)
+			}
+		}
+	}
+
+	slices.SortFunc(matches, func(a, b patreon.Patron) int {
+		return cmp.Or(strings.Compare(a.Email, b.Email), cmp.Compare(a.Id, b.Id))
+	})
+
+	return matches
+}
+
+func emailDomainMatches(email, domain string) bool {
+	at := strings.LastIndexByte(email, '@')
+	if at == -1 {
+		return false
+	}
+
+	emailDomain := strings.ToLower(email[at+1:])
+	return emailDomain == domain || strings.HasSuffix(emailDomain, "."+domain)
+}
+
+// diff compares the store with a result of FetchPledges, which is keyed by normalized email
+func (s *patronStore) diff(current map[string]patreon.Patron) patreon.SnapshotDiff {
+	var diff patreon.SnapshotDiff
+	for email, patron := range current {
+		old, ok := s.get(email)
+		if !ok {
+			diff.Added = append(diff.Added, patron)
+		} else if !old.Equal(patron) {
+			diff.Changed = append(diff.Changed, patreon.PatronChange{Previous: old, Current: patron})
+		}
+	}
+
+	for _, old := range s.patrons {
+		if _, ok := current[s.key(old.Email)]; !ok {
+			diff.Removed = append(diff.Removed, old)
+		}
+	}
+
+	return diff
+}
+
+// apply builds a new store with the difference applied. Patrons that haven't changed are copied from this store, so
+// keep their interned strings.
+func (s *patronStore) apply(diff patreon.SnapshotDiff, interner *interner) *patronStore {
+	replaced := make(map[string]patreon.Patron, len(diff.Changed))
+	for _, change := range diff.Changed {
+		replaced[s.key(change.Current.Email)] = interner.patron(change.Current)
+	}
+
+	removed := make(map[string]struct{}, len(diff.Removed))
+	for _, patron := range diff.Removed {
+		removed[s.key(patron.Email)] = struct{}{}
+	}
+
+	patrons := make([]patreon.Patron, 0, len(s.patrons)-len(diff.Removed)+len(diff.Added))
+	for _, patron := range s.patrons {
+		key := s.key(patron.Email)
+		if _, ok := removed[key]; ok {
+			continue
+		}
+
+		if current, ok := replaced[key]; ok {
+			patron = current
+		}
+
+		patrons = append(patrons, patron)
+	}
+
+	for _, patron := range diff.Added {
+		patrons = append(patrons, interner.patron(patron))
+	}
+
+	return buildPatronStore(patrons, s.canonicalizeGmail)
+}
+
+// interner keeps a single copy of the strings and tier lists that many patrons share, such as statuses. It is not
+// safe for concurrent use.
+type interner struct {
+	strings map[string]string
+	tiers   map[string][]uint64 // Keyed by the comma separated tier IDs
+	keyBuf  []byte
+}
+
+func newInterner() *interner {
+	return &interner{
+		strings: make(map[string]string),
+		tiers:   make(map[string][]uint64),
+	}
+}
+
+func (i *interner) patron(patron patreon.Patron) patreon.Patron {
+	patron.LastChargeStatus = i.string(patron.LastChargeStatus)
+	patron.PatronStatus = i.string(patron.PatronStatus)
+	patron.Tiers = i.tierList(patron.Tiers)
+	return patron
+}
+
+func (i *interner) string(str string) string {
+	if interned, ok := i.strings[str]; ok {
+		return interned
+	}
+
+	i.strings[str] = str
+	return str
+}
+
+func (i *interner) tierList(tiers []uint64) []uint64 {
+	if len(tiers) == 0 {
+		return nil
+	}
+
+	i.keyBuf = i.keyBuf[:0]
+	for _, tierId := range tiers {
+		i.keyBuf = strconv.AppendUint(i.keyBuf, tierId, 10)
+		i.keyBuf = append(i.keyBuf, ',')
+	}
+
+	// The conversion in the lookup doesn't allocate
+	if interned, ok := i.tiers[string(i.keyBuf)]; ok {
+		return interned
+	}
+
+	i.tiers[string(i.keyBuf)] = tiers
+	return tiers
+}
@@ -0,0 +1,108 @@
+package entitlements
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TicketsBot/subscriptions-app/pkg/patreon"
+)
+
+const benchmarkPatrons = 100_000
+
+// benchmarkSnapshot builds a sync result of linked patrons. Statuses and tier lists are copied for each patron, as they
+// are when decoded from Patreon's responses.
+func benchmarkSnapshot() map[string]patreon.Patron {
+	statuses := []string{"active_patron", "declined_patron", "former_patron"}
+	chargeStatuses := []string{"Paid", "Declined", "Pending"}
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	patrons := make(map[string]patreon.Patron, benchmarkPatrons)
+	for i := range benchmarkPatrons {
+		email := fmt.Sprintf("patron%d@example.com", i)
+		discordId := uint64(100000000000000000 + i)
+
+		patrons[email] = patreon.Patron{
+			Attributes: patreon.Attributes{
+				Email:                   email,
+				LastChargeDate:          start.Add(time.Duration(i) * time.Minute),
+				LastChargeStatus:        strings.Clone(chargeStatuses[i%len(chargeStatuses)]),
+				PatronStatus:            strings.Clone(statuses[i%len(statuses)]),
+				PledgeRelationshipStart: start,
+			},
+			Id:        uint64(i + 1),
+			Tiers:     []uint64{1001 + uint64(i%3)},
+			DiscordId: &discordId,
+		}
+	}
+
+	return patrons
+}
+
+// buildTwoMaps builds the layout the store replaced, which held a copy of every patron in a map by email and another in
+// a map by Discord ID
+func buildTwoMaps(patrons map[string]patreon.Patron) any {
+	byEmail := make(map[string]patreon.Patron, len(patrons))
+	byDiscordId := make(map[uint64]patreon.Patron, len(patrons))
+	for email, patron := range patrons {
+		byEmail[email] = patron
+		if patron.DiscordId != nil {
+			byDiscordId[*patron.DiscordId] = patron
+		}
+	}
+
+	return []any{byEmail, byDiscordId}
+}
+
+// buildStore builds the store the way Engine.UpdatePatrons does on the first sync
+func buildStore(patrons map[string]patreon.Patron) any {
+	interner := newInterner()
+
+	interned := make([]patreon.Patron, 0, len(patrons))
+	for _, patron := range patrons {
+		interned = append(interned, interner.patron(patron))
+	}
+
+	return buildPatronStore(interned, false)
+}
+
+// BenchmarkBuildStore compares the store with the two maps it replaced, reporting the heap retained by each once built
+// as retained-MB, alongside the allocations made building it. The sync result is dropped after building, as it is
+// by the engine, so only the memory held by the snapshot is counted.
+func BenchmarkBuildStore(b *testing.B) {
+	for _, layout := range []struct {
+		name  string
+		build func(map[string]patreon.Patron) any
+	}{
+		{"two_maps", buildTwoMaps},
+		{"store", buildStore},
+	} {
+		b.Run(layout.name, func(b *testing.B) {
+			b.ReportAllocs()
+
+			var retained int64
+			for range b.N {
+				b.StopTimer()
+				runtime.GC()
+				var before runtime.MemStats
+				runtime.ReadMemStats(&before)
+				patrons := benchmarkSnapshot()
+				b.StartTimer()
+
+				built := layout.build(patrons)
+
+				b.StopTimer()
+				runtime.GC()
+				var after runtime.MemStats
+				runtime.ReadMemStats(&after)
+				runtime.KeepAlive(built)
+				retained += int64(after.HeapAlloc) - int64(before.HeapAlloc)
+				b.StartTimer()
+			}
+
+			b.ReportMetric(float64(retained)/float64(b.N)/(1<<20), "retained-MB")
+		})
+	}
+}
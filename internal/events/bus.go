@@ -0,0 +1,46 @@
+package events
+
+import "sync"
+
+// Bus fans events out to in-process subscribers, such as outgoing webhooks and streams
+type Bus struct {
+	subscribers []chan Event
+	dropped     func(Event)
+	mu          sync.RWMutex
+}
+
+// NewBus creates a bus. dropped is called for each event that a subscriber was too slow to receive.
+func NewBus(dropped func(Event)) *Bus {
+	return &Bus{
+		dropped: dropped,
+	}
+}
+
+// Subscribe returns a channel receiving every event published from now on. Events are dropped rather than blocking the
+// publisher once buffer events are waiting.
+func (b *Bus) Subscribe(buffer int) <-chan Event {
+	ch := make(chan Event, buffer)
+
+	b.mu.Lock()
+	b.subscribers = append(b.subscribers, ch)
+	b.mu.Unlock()
+
+	return ch
+}
+
+func (b *Bus) Publish(events ...Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, event := range events {
+		for _, ch := range b.subscribers {
+			select {
+			case ch <- event:
+			default:
+				if b.dropped != nil {
+					b.dropped(event)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package events
+
+import (
+	"slices"
+	"time"
+
+	"github.com/TicketsBot/subscriptions-app/pkg/patreon"
+)
+
+type Type string
+
+const (
+	TypeNew       Type = "new"       // A patron pledged to a tier for the first time
+	TypeUpgrade   Type = "upgrade"   // A patron moved to tiers worth more
+	TypeDowngrade Type = "downgrade" // A patron moved to tiers worth less
+	TypeChange    Type = "change"    // A patron moved to different tiers of the same value
+	TypeCancel    Type = "cancel"    // A patron is no longer entitled to any tier
+	TypeRenew     Type = "renew"     // A patron was charged successfully again
+	TypeDecline   Type = "decline"   // A patron's charge was declined, after the previous one succeeded
+)
+
+// Event is a change to a patron, detected by comparing consecutive Patreon snapshots
+type Event struct {
+	Type          Type      `json:"type"`
+	PatronId      uint64    `json:"patron_id,string"`
+	Email         string    `json:"email"`
+	DiscordId     *uint64   `json:"discord_id,string"`
+	PreviousTiers []uint64  `json:"previous_tiers"`
+	Tiers         []uint64  `json:"tiers"`
+	EffectiveAt   time.Time `json:"effective_at"` // When the change took effect, which may be before it was detected
+
+	// The amount the patron was pledging before and after the event, in Currency
+	PreviousAmountCents int `json:"previous_amount_cents"`
+	AmountCents         int `json:"amount_cents"`
+
+	// Currency is the currency the patron pledges in. Unset if it isn't known, in which case amounts are in the campaign
+	// currency.
+	Currency string `json:"currency,omitempty"`
+}
+
+// IsTierChange returns whether the event moved a patron between tiers, rather than starting or ending their pledge
+func (e Event) IsTierChange() bool {
+	return slices.Contains(TierChangeTypes(), string(e.Type))
+}
+
+// CurrencyOr returns the currency the patron pledges in, or fallback, the campaign currency, if it isn't known
+func (e Event) CurrencyOr(fallback string) string {
+	if e.Currency != "" {
+		return e.Currency
+	}
+
+	return fallback
+}
+
+// TierChangeTypes returns the event types that move a patron between tiers
+func TierChangeTypes() []string {
+	return []string{string(TypeUpgrade), string(TypeDowngrade), string(TypeChange)}
+}
+
+// Diff detects the events in the difference between two Patreon snapshots. value returns the monthly value of a tier in
+// cents, used to tell upgrades and downgrades apart. now is used as the effective date of changes that Patreon doesn't
+// date.
+func Diff(diff patreon.SnapshotDiff, value func(tierId uint64) int, now time.Time) []Event {
+	var events []Event
+
+	for _, patron := range diff.Added {
+		if event, ok := detect(nil, patron, value, now); ok {
+			events = append(events, event)
+		}
+	}
+
+	for _, change := range diff.Changed {
+		if event, ok := detect(&change.Previous, change.Current, value, now); ok {
+			events = append(events, event)
+		}
+	}
+
+	// Patrons who are no longer members at all have cancelled
+	for _, old := range diff.Removed {
+		if len(old.Tiers) == 0 {
+			continue
+		}
+
+		events = append(events, Event{
+			Type:                TypeCancel,
+			PatronId:            old.Id,
+			Email:               old.Email,
+			DiscordId:           old.DiscordId,
+			PreviousTiers:       old.Tiers,
+			EffectiveAt:         now,
+			PreviousAmountCents: old.CurrentlyEntitledAmountCents,
+			Currency:            old.Currency,
+		})
+	}
+
+	return events
+}
+
+// detect returns the event for a patron that was added, if old is nil, or changed
+func detect(old *patreon.Patron, patron patreon.Patron, value func(tierId uint64) int, now time.Time) (Event, bool) {
+	event := Event{
+		PatronId:    patron.Id,
+		Email:       patron.Email,
+		DiscordId:   patron.DiscordId,
+		Tiers:       patron.Tiers,
+		AmountCents: patron.CurrentlyEntitledAmountCents,
+		Currency:    patron.Currency,
+	}
+
+	if old != nil {
+		event.PreviousTiers = old.Tiers
+		event.PreviousAmountCents = old.CurrentlyEntitledAmountCents
+	}
+
+	switch {
+	case len(event.PreviousTiers) == 0 && len(patron.Tiers) > 0:
+		event.Type = TypeNew
+		event.EffectiveAt = now
+
+		// Patreon dates the start of the member's current pledge
+		if !patron.PledgeRelationshipStart.IsZero() {
+			event.EffectiveAt = patron.PledgeRelationshipStart
+		}
+	case len(event.PreviousTiers) > 0 && len(patron.Tiers) == 0:
+		event.Type = TypeCancel
+		event.EffectiveAt = now
+	case !sameTiers(event.PreviousTiers, patron.Tiers):
+		event.Type = compareValue(event.PreviousTiers, patron.Tiers, value)
+		event.EffectiveAt = now
+	case old != nil && patron.LastChargeStatus == "Paid" && patron.LastChargeDate.After(old.LastChargeDate):
+		event.Type = TypeRenew
+		event.EffectiveAt = patron.LastChargeDate
+	case old != nil && patron.LastChargeStatus == "Declined" && old.LastChargeStatus != "Declined":
+		event.Type = TypeDecline
+		event.EffectiveAt = now
+
+		// Patreon retries declined charges, so the charge date is that of the latest attempt
+		if !patron.LastChargeDate.IsZero() {
+			event.EffectiveAt = patron.LastChargeDate
+		}
+	default:
+		return Event{}, false
+	}
+
+	return event, true
+}
+
+func compareValue(previous, current []uint64, value func(tierId uint64) int) Type {
+	total := func(tiers []uint64) (sum int) {
+		for _, tier := range tiers {
+			sum += value(tier)
+		}
+
+		return
+	}
+
+	switch previousValue, currentValue := total(previous), total(current); {
+	case currentValue > previousValue:
+		return TypeUpgrade
+	case currentValue < previousValue:
+		return TypeDowngrade
+	default:
+		return TypeChange
+	}
+}
+
+func sameTiers(a, b []uint64) bool {
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(a, b)
+}
@@ -0,0 +1,136 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"time"
+
+	"github.com/TicketsBot/subscriptions-app/internal/clock"
+	"github.com/TicketsBot/subscriptions-app/internal/config"
+	"github.com/TicketsBot/subscriptions-app/internal/database"
+	"github.com/TicketsBot/subscriptions-app/internal/metrics"
+	"github.com/TicketsBot/subscriptions-app/pkg/patreon"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// maxPendingEvents is the most events kept to retry after failing to store them, beyond which the oldest are dropped,
+// so that an outage of the database doesn't grow the memory held without bound
+const maxPendingEvents = 10000
+
+// TierRegistry provides the tier metadata used to value tiers
+type TierRegistry interface {
+	Tier(tierId uint64) (config.Tier, bool)
+}
+
+// Recorder detects events in the differences between consecutive Patreon snapshots, stores them in the patron history
+// and publishes them to the bus. It is not safe for concurrent use, as differences must be recorded in order.
+type Recorder struct {
+	db     *database.Database
+	bus    *Bus
+	tiers  TierRegistry
+	logger *zap.Logger
+	clock  clock.Clock // Events are detected, and former patrons pruned, at the clock's current time
+
+	formerPatronWindow time.Duration // Patrons who cancel are recorded as former patrons for this long, unless 0
+
+	pending []Event // Events that failed to be stored, which are retried with the next difference, up to maxPendingEvents
+}
+
+func NewRecorder(config config.Config, db *database.Database, bus *Bus, tiers TierRegistry, logger *zap.Logger, clk clock.Clock) *Recorder {
+	return &Recorder{
+		db:                 db,
+		bus:                bus,
+		tiers:              tiers,
+		logger:             logger,
+		clock:              clk,
+		formerPatronWindow: time.Duration(config.Patreon.FormerPatronDays) * time.Hour * 24,
+	}
+}
+
+// Record detects the events in the difference between two snapshots, returning them once they are stored. If they can't
+// be stored, they are kept and stored along with the events of the next difference, dropping the oldest events if more
+// than maxPendingEvents are waiting.
+func (r *Recorder) Record(ctx context.Context, diff patreon.SnapshotDiff) ([]Event, error) {
+	events := append(r.pending, Diff(diff, r.tierValue, r.clock.Now())...)
+	r.pending = nil
+
+	if len(events) > 0 {
+		entries := make([]database.PatronHistoryEntry, len(events))
+		for i, event := range events {
+			details, err := json.Marshal(event)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to encode event")
+			}
+
+			entries[i] = database.PatronHistoryEntry{
+				PatronId:    event.PatronId,
+				Event:       string(event.Type),
+				Details:     details,
+				EffectiveAt: &event.EffectiveAt,
+			}
+		}
+
+		if err := r.db.PatronHistory.InsertMany(ctx, entries); err != nil {
+			if dropped := len(events) - maxPendingEvents; dropped > 0 {
+				r.logger.Error("Too many patron events waiting to be stored, dropping the oldest", zap.Int("dropped", dropped))
+				metrics.PatronEventsDropped.Add(float64(dropped))
+				events = slices.Clone(events[dropped:])
+			}
+
+			r.pending = events
+			return nil, errors.Wrap(err, "failed to store events")
+		}
+
+		r.bus.Publish(events...)
+		r.logger.Info("Recorded patron events", zap.Int("count", len(events)))
+
+		// The events are stored, so failing to update the former patrons only affects lookups, and isn't retried
+		if err := r.recordFormerPatrons(ctx, events); err != nil {
+			r.logger.Error("Failed to record former patrons", zap.Error(err))
+		}
+	}
+
+	return events, nil
+}
+
+// recordFormerPatrons records the patrons who cancelled, with their last tiers, and removes those who pledged again.
+// Former patrons whose pledge ended before the window are deleted.
+func (r *Recorder) recordFormerPatrons(ctx context.Context, events []Event) error {
+	if r.formerPatronWindow <= 0 {
+		return nil
+	}
+
+	for _, event := range events {
+		switch event.Type {
+		case TypeCancel:
+			formerPatron := database.FormerPatron{
+				PatronId:  event.PatronId,
+				Email:     event.Email,
+				DiscordId: event.DiscordId,
+				LastTiers: event.PreviousTiers,
+				EndedAt:   event.EffectiveAt,
+			}
+
+			if err := r.db.FormerPatrons.Set(ctx, formerPatron); err != nil {
+				return errors.Wrapf(err, "failed to record former patron %d", event.PatronId)
+			}
+		case TypeNew:
+			if err := r.db.FormerPatrons.Delete(ctx, event.PatronId); err != nil {
+				return errors.Wrapf(err, "failed to remove former patron %d", event.PatronId)
+			}
+		}
+	}
+
+	if _, err := r.db.FormerPatrons.Prune(ctx, r.clock.Now().Add(-r.formerPatronWindow)); err != nil {
+		return errors.Wrap(err, "failed to prune former patrons")
+	}
+
+	return nil
+}
+
+func (r *Recorder) tierValue(tierId uint64) int {
+	tier, _ := r.tiers.Tier(tierId)
+	return tier.PriceCents
+}
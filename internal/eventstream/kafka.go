@@ -0,0 +1,72 @@
+package eventstream
+
+import (
+	"context"
+	"crypto/tls"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TicketsBot/subscriptions-app/internal/config"
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl/plain"
+)
+
+// kafkaPublisher publishes to a Kafka topic over the Kafka protocol. Messages are keyed by patron ID, so that the
+// events of each patron are stored in the same partition, in order, and are only acknowledged once every in-sync
+// replica has them.
+type kafkaPublisher struct {
+	writer *kafka.Writer
+}
+
+func newKafkaPublisher(conf config.Config) *kafkaPublisher {
+	transport := &kafka.Transport{
+		DialTimeout: time.Second * 10,
+	}
+
+	if conf.EventStream.Tls {
+		transport.TLS = &tls.Config{}
+	}
+
+	if conf.EventStream.Username != "" {
+		transport.SASL = plain.Mechanism{
+			Username: conf.EventStream.Username,
+			Password: conf.EventStream.Password,
+		}
+	}
+
+	return &kafkaPublisher{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(kafkaBrokers(conf.EventStream.Url)...),
+			Topic:        conf.EventStream.Subject,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+			BatchSize:    1, // Messages are published one at a time, so a batch would only delay them
+			MaxAttempts:  1, // Failed messages are retried from the cursor on the next interval
+			Transport:    transport,
+		},
+	}
+}
+
+// kafkaBrokers splits a comma-separated list of brokers, such as host1:9092,host2:9092
+func kafkaBrokers(url string) []string {
+	var brokers []string
+	for _, broker := range strings.Split(url, ",") {
+		if broker = strings.TrimSpace(broker); broker != "" {
+			brokers = append(brokers, broker)
+		}
+	}
+
+	return brokers
+}
+
+func (p *kafkaPublisher) Publish(ctx context.Context, message Message, body []byte) error {
+	return p.writer.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(strconv.FormatUint(message.PatronId, 10)),
+		Value: body,
+	})
+}
+
+func (p *kafkaPublisher) Close() error {
+	return p.writer.Close()
+}
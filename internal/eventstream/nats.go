@@ -0,0 +1,106 @@
+package eventstream
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/TicketsBot/subscriptions-app/internal/config"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/pkg/errors"
+)
+
+// natsPublisher publishes to a JetStream stream, with each message's history ID as its Nats-Msg-Id, so that the stream
+// drops messages published again after a failure within its duplicate window. The connection is opened on first use,
+// and the client reconnects by itself after it is lost.
+type natsPublisher struct {
+	url                string
+	subject            string
+	username, password string
+
+	mu   sync.Mutex
+	conn *nats.Conn
+	js   jetstream.JetStream
+}
+
+func newNatsPublisher(conf config.Config) *natsPublisher {
+	return &natsPublisher{
+		url:      conf.EventStream.Url,
+		subject:  conf.EventStream.Subject,
+		username: conf.EventStream.Username,
+		password: conf.EventStream.Password,
+	}
+}
+
+// Publish publishes the message to the subject ending with its type, such as subscriptions.events.upgrade, and waits
+// for the stream to acknowledge it
+func (p *natsPublisher) Publish(ctx context.Context, message Message, body []byte) error {
+	js, err := p.jetStream()
+	if err != nil {
+		return errors.Wrap(err, "failed to connect to NATS")
+	}
+
+	msg := nats.NewMsg(fmt.Sprintf("%s.%s", p.subject, message.Type))
+	msg.Header.Set(jetstream.MsgIDHeader, strconv.FormatInt(message.Id, 10))
+	msg.Data = body
+
+	if _, err := js.PublishMsg(ctx, msg); err != nil {
+		if errors.Is(err, jetstream.ErrNoStreamResponse) {
+			return fmt.Errorf("no acknowledgement from JetStream, check that a stream captures %s: %w", msg.Subject, err)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (p *natsPublisher) jetStream() (jetstream.JetStream, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.js != nil {
+		return p.js, nil
+	}
+
+	options := []nats.Option{
+		nats.Name("subscriptions-app"),
+		nats.Timeout(time.Second * 10),
+		nats.MaxReconnects(-1), // Events wait in the patron history while NATS is unreachable
+	}
+
+	if p.username != "" {
+		options = append(options, nats.UserInfo(p.username, p.password))
+	} else if p.password != "" {
+		options = append(options, nats.Token(p.password))
+	}
+
+	conn, err := nats.Connect(p.url, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	p.conn, p.js = conn, js
+	return js, nil
+}
+
+func (p *natsPublisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conn != nil {
+		p.conn.Close()
+		p.conn, p.js = nil, nil
+	}
+
+	return nil
+}
@@ -0,0 +1,174 @@
+// Package eventstream publishes patron events to a message broker for the data pipeline. Events are read from the
+// patron history in the order they were recorded, and a cursor is only moved past an event once the broker has
+// acknowledged it, so events are delivered at least once and in order, even across restarts and broker outages.
+package eventstream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/TicketsBot/subscriptions-app/internal/config"
+	"github.com/TicketsBot/subscriptions-app/internal/database"
+	"github.com/TicketsBot/subscriptions-app/internal/events"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// cursorName is the name of the stream's cursor in the event_cursors table
+const cursorName = "event_stream"
+
+// batchSize is the number of events read from the patron history at a time
+const batchSize = 100
+
+// Message is the body of each published event. Emails are left out, so that the pipeline doesn't hold them.
+type Message struct {
+	Id                  int64       `json:"id"` // The ID of the patron history entry, which consumers can deduplicate by
+	Type                events.Type `json:"type"`
+	PatronId            uint64      `json:"patron_id,string"`
+	DiscordId           *uint64     `json:"discord_id,string"`
+	PreviousTiers       []uint64    `json:"previous_tiers"`
+	Tiers               []uint64    `json:"tiers"`
+	PreviousAmountCents int         `json:"previous_amount_cents"`
+	AmountCents         int         `json:"amount_cents"`
+	Currency            string      `json:"currency,omitempty"` // Of the amounts, if the patron's currency is known
+	EffectiveAt         time.Time   `json:"effective_at"`
+	RecordedAt          time.Time   `json:"recorded_at"`
+}
+
+// Publisher delivers messages to a broker, returning once the broker has stored the message
+type Publisher interface {
+	Publish(ctx context.Context, message Message, body []byte) error
+	Close() error
+}
+
+// Streamer publishes the events recorded in the patron history
+type Streamer struct {
+	config    config.Config
+	logger    *zap.Logger
+	db        *database.Database
+	publisher Publisher // Unset if disabled
+}
+
+func NewStreamer(conf config.Config, logger *zap.Logger, db *database.Database) *Streamer {
+	s := &Streamer{
+		config: conf,
+		logger: logger,
+		db:     db,
+	}
+
+	switch conf.EventStream.Driver {
+	case config.EventStreamNats:
+		s.publisher = newNatsPublisher(conf)
+	case config.EventStreamKafka:
+		s.publisher = newKafkaPublisher(conf)
+	}
+
+	return s
+}
+
+func (s *Streamer) Enabled() bool {
+	return s.publisher != nil
+}
+
+// Run publishes new events every interval until the context is cancelled
+func (s *Streamer) Run(ctx context.Context) {
+	if !s.Enabled() {
+		s.logger.Info("Event stream driver not configured, patron events are not streamed")
+		return
+	}
+
+	defer s.publisher.Close()
+
+	ticker := time.NewTicker(time.Duration(s.config.EventStream.IntervalSeconds) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		if err := s.PublishPending(ctx); err != nil {
+			s.logger.Warn("Failed to stream patron events, retrying next interval", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PublishPending publishes every event recorded since the last one published. Publishing stops at the first event the
+// broker doesn't acknowledge, so that events are never published out of order.
+func (s *Streamer) PublishPending(ctx context.Context) error {
+	cursor, err := s.db.EventCursors.Get(ctx, cursorName)
+	if err != nil {
+		return errors.Wrap(err, "failed to read cursor")
+	}
+
+	published := 0
+	defer func() {
+		if published > 0 {
+			s.logger.Info("Streamed patron events", zap.Int("count", published), zap.Int64("cursor", cursor))
+		}
+	}()
+
+	for {
+		entries, err := s.db.PatronHistory.After(ctx, cursor, batchSize)
+		if err != nil {
+			return errors.Wrap(err, "failed to read patron history")
+		}
+
+		for _, entry := range entries {
+			if err := s.publish(ctx, entry); err != nil {
+				return errors.Wrapf(err, "failed to publish event %d", entry.Id)
+			}
+
+			cursor = entry.Id
+			published++
+
+			if err := s.db.EventCursors.Set(ctx, cursorName, cursor); err != nil {
+				return errors.Wrap(err, "failed to move cursor")
+			}
+		}
+
+		if len(entries) < batchSize {
+			return nil
+		}
+	}
+}
+
+func (s *Streamer) publish(ctx context.Context, entry database.PatronHistoryEntry) error {
+	var event events.Event
+	if err := json.Unmarshal(entry.Details, &event); err != nil {
+		return fmt.Errorf("failed to decode event: %w", err)
+	}
+
+	message := Message{
+		Id:                  entry.Id,
+		Type:                event.Type,
+		PatronId:            entry.PatronId,
+		DiscordId:           event.DiscordId,
+		PreviousTiers:       event.PreviousTiers,
+		Tiers:               event.Tiers,
+		PreviousAmountCents: event.PreviousAmountCents,
+		AmountCents:         event.AmountCents,
+		Currency:            event.Currency,
+		EffectiveAt:         event.EffectiveAt,
+		RecordedAt:          entry.CreatedAt,
+	}
+
+	// Events recorded before effective dates were tracked are dated by when they were recorded
+	if message.EffectiveAt.IsZero() && entry.EffectiveAt != nil {
+		message.EffectiveAt = *entry.EffectiveAt
+	}
+
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*30)
+	defer cancel()
+
+	return s.publisher.Publish(ctx, message, body)
+}
@@ -0,0 +1,71 @@
+// Package guildsettings holds the settings of each allowed guild, which override the global config for commands run in
+// that guild
+package guildsettings
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/TicketsBot/subscriptions-app/internal/database"
+	"github.com/pkg/errors"
+)
+
+// Store caches the settings of every guild. Settings are loaded on startup and changed through Set, so changes made
+// by another replica are only seen after a restart.
+type Store struct {
+	db *database.Database
+
+	mu       sync.RWMutex
+	settings map[uint64]database.GuildSettings // Guild ID -> settings
+}
+
+func NewStore(db *database.Database) *Store {
+	return &Store{
+		db:       db,
+		settings: make(map[uint64]database.GuildSettings),
+	}
+}
+
+// Load fetches the settings of every guild from the database
+func (s *Store) Load(ctx context.Context) error {
+	settings, err := s.db.GuildSettings.GetAll(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to load guild settings")
+	}
+
+	s.mu.Lock()
+	s.settings = settings
+	s.mu.Unlock()
+
+	return nil
+}
+
+// Get returns the settings of the guild, which are empty if none have been set, so that the global config applies
+func (s *Store) Get(guildId uint64) database.GuildSettings {
+	s.mu.RLock()
+	settings, ok := s.settings[guildId]
+	s.mu.RUnlock()
+
+	if !ok {
+		return database.GuildSettings{GuildId: guildId}
+	}
+
+	// The slices are cloned, so that callers can change them without changing the cached settings
+	settings.DisabledCommands = slices.Clone(settings.DisabledCommands)
+	settings.HiddenTiers = slices.Clone(settings.HiddenTiers)
+	return settings
+}
+
+// Set stores the settings of the guild
+func (s *Store) Set(ctx context.Context, settings database.GuildSettings) error {
+	if err := s.db.GuildSettings.Set(ctx, settings); err != nil {
+		return errors.Wrap(err, "failed to store guild settings")
+	}
+
+	s.mu.Lock()
+	s.settings[settings.GuildId] = settings
+	s.mu.Unlock()
+
+	return nil
+}
@@ -0,0 +1,148 @@
+package legacy
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TicketsBot/subscriptions-app/internal/database"
+	"github.com/TicketsBot/subscriptions-app/internal/privacy"
+	"github.com/pkg/errors"
+)
+
+// The columns of the legacy key dump. Only key and tier are required, and columns may appear in any order.
+const (
+	columnKey       = "key"
+	columnTier      = "tier"
+	columnEmail     = "email"
+	columnDiscordId = "discord_id"
+	columnExpiresAt = "expires_at"
+)
+
+// ParseCSV reads a legacy premium key dump. The first row must be a header row.
+func ParseCSV(r io.Reader, importedAt time.Time) ([]database.ExternalSubscription, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read header row")
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	for _, required := range []string{columnKey, columnTier} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("missing required column %s", required)
+		}
+	}
+
+	var keys []database.ExternalSubscription
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.Wrapf(err, "failed to read line %d", line)
+		}
+
+		key, err := parseRecord(record, columns, importedAt)
+		if err != nil {
+			return nil, errors.Wrapf(err, "line %d", line)
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+func parseRecord(record []string, columns map[string]int, importedAt time.Time) (database.ExternalSubscription, error) {
+	get := func(column string) string {
+		if i, ok := columns[column]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+
+		return ""
+	}
+
+	key := database.ExternalSubscription{
+		Source:    database.SourceLegacy,
+		Reference: get(columnKey),
+		Tier:      get(columnTier),
+		Status:    "active",
+		UpdatedAt: importedAt,
+	}
+
+	if key.Reference == "" {
+		return database.ExternalSubscription{}, errors.New("key is empty")
+	}
+
+	if key.Tier == "" {
+		return database.ExternalSubscription{}, errors.New("tier is empty")
+	}
+
+	if email := get(columnEmail); email != "" {
+		key.Email = &email
+	}
+
+	if raw := get(columnDiscordId); raw != "" {
+		discordId, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return database.ExternalSubscription{}, errors.Wrap(err, "invalid discord_id")
+		}
+
+		key.DiscordId = &discordId
+	}
+
+	if raw := get(columnExpiresAt); raw != "" {
+		expiresAt, err := parseTime(raw)
+		if err != nil {
+			return database.ExternalSubscription{}, errors.Wrap(err, "invalid expires_at")
+		}
+
+		key.ExpiresAt = &expiresAt
+	}
+
+	return key, nil
+}
+
+// parseTime accepts either an RFC 3339 timestamp or a plain date
+func parseTime(raw string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+
+	return time.Parse(time.DateOnly, raw)
+}
+
+// Store persists imported keys as subscriptions
+type Store interface {
+	UpsertSubscriptions(ctx context.Context, subs []database.ExternalSubscription) error
+}
+
+// Import parses the dump and stores every key, with their emails protected. Keys that were imported previously are
+// overwritten, so the same dump can be imported again safely.
+func Import(ctx context.Context, store Store, emails *privacy.Emails, r io.Reader) (int, error) {
+	keys, err := ParseCSV(r, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range keys {
+		keys[i].Email = emails.ProtectPtr(keys[i].Email)
+	}
+
+	if err := store.UpsertSubscriptions(ctx, keys); err != nil {
+		return 0, errors.Wrap(err, "failed to store keys")
+	}
+
+	return len(keys), nil
+}
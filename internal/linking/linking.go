@@ -0,0 +1,97 @@
+// Package linking verifies which Discord account and which Patreon account a patron owns through OAuth, for the link
+// page. Each account is proven by signing in to it, so a patron can only link accounts they control.
+package linking
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/TicketsBot-cloud/gdl/rest"
+	"github.com/TicketsBot/subscriptions-app/internal/config"
+	"github.com/TicketsBot/subscriptions-app/internal/database"
+	"github.com/TicketsBot/subscriptions-app/pkg/patreon"
+)
+
+const discordAuthorizeUrl = "https://discord.com/oauth2/authorize"
+
+const (
+	DiscordCallbackPath = "/link/discord/callback"
+	PatreonCallbackPath = "/link/patreon/callback"
+)
+
+type Service struct {
+	config     config.Config
+	db         *database.Database
+	httpClient *http.Client
+}
+
+func NewService(conf config.Config, db *database.Database) *Service {
+	return &Service{
+		config:     conf,
+		db:         db,
+		httpClient: &http.Client{Timeout: time.Second * 30},
+	}
+}
+
+func (s *Service) Enabled() bool {
+	return s.config.LinkPage.PublicUrl != ""
+}
+
+// Secure returns whether the page is served over HTTPS, in which case cookies are only sent over HTTPS
+func (s *Service) Secure() bool {
+	return strings.HasPrefix(s.config.LinkPage.PublicUrl, "https://")
+}
+
+// DiscordAuthorizeUrl returns the URL of Discord's consent page, which redirects to the Discord callback with a code for
+// IdentifyDiscord
+func (s *Service) DiscordAuthorizeUrl(state string) string {
+	query := url.Values{
+		"response_type": {"code"},
+		"client_id":     {fmt.Sprint(s.config.Discord.ApplicationId)},
+		"redirect_uri":  {s.redirectUri(DiscordCallbackPath)},
+		"scope":         {"identify"},
+		"state":         {state},
+		"prompt":        {"none"}, // Skip the consent page if the user has already consented
+	}
+
+	return fmt.Sprintf("%s?%s", discordAuthorizeUrl, query.Encode())
+}
+
+// IdentifyDiscord exchanges the code from Discord's consent page for the ID of the user who signed in
+func (s *Service) IdentifyDiscord(ctx context.Context, code string) (uint64, error) {
+	tokens, err := rest.ExchangeCode(ctx, nil, s.config.Discord.ApplicationId, s.config.LinkPage.DiscordClientSecret, s.redirectUri(DiscordCallbackPath), code)
+	if err != nil {
+		return 0, fmt.Errorf("failed to exchange Discord code: %w", err)
+	}
+
+	user, err := rest.GetCurrentUser(ctx, "Bearer "+tokens.AccessToken, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch Discord user: %w", err)
+	}
+
+	return user.Id, nil
+}
+
+// PatreonAuthorizeUrl returns the URL of Patreon's consent page, which redirects to the Patreon callback with a code
+// for IdentifyPatron
+func (s *Service) PatreonAuthorizeUrl(state string) string {
+	return patreon.IdentityAuthorizeUrl(s.config, s.redirectUri(PatreonCallbackPath), state)
+}
+
+// IdentifyPatron exchanges the code from Patreon's consent page for the Patreon user ID of the patron who signed in
+func (s *Service) IdentifyPatron(ctx context.Context, code string) (uint64, error) {
+	return patreon.Identify(ctx, s.httpClient, s.config, code, s.redirectUri(PatreonCallbackPath))
+}
+
+// Link stores the verified link, which is applied to the patron from the next sync
+func (s *Service) Link(ctx context.Context, patronId, discordId uint64) error {
+	return s.db.PatronLinks.Link(ctx, patronId, discordId)
+}
+
+func (s *Service) redirectUri(path string) string {
+	return strings.TrimSuffix(s.config.LinkPage.PublicUrl, "/") + path
+}
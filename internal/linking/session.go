@@ -0,0 +1,89 @@
+package linking
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// SessionDuration is how long a patron has to finish signing in to both accounts
+const SessionDuration = time.Minute * 10
+
+var ErrInvalidSession = errors.New("invalid or expired link session")
+
+// Session is the sign-in state, held in a signed cookie between the OAuth redirects, so that instances don't need to
+// share state
+type Session struct {
+	State     string    `json:"state"`                // Sent to the provider, which must return it unchanged
+	DiscordId uint64    `json:"discord_id,omitempty"` // Set once the patron has signed in with Discord
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// NewSession starts a session with a random state
+func NewSession(now time.Time) (Session, error) {
+	state, err := randomState()
+	if err != nil {
+		return Session{}, err
+	}
+
+	return Session{
+		State:     state,
+		ExpiresAt: now.Add(SessionDuration),
+	}, nil
+}
+
+// Encode returns the session as a cookie value, signed with the session secret
+func (s *Service) Encode(session Session) (string, error) {
+	encoded, err := json.Marshal(session)
+	if err != nil {
+		return "", err
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(encoded)
+	return payload + "." + s.sign(payload), nil
+}
+
+// Decode verifies the signature of a cookie value from Encode, and that the session hasn't expired
+func (s *Service) Decode(value string, now time.Time) (Session, error) {
+	payload, signature, ok := strings.Cut(value, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(s.sign(payload))) {
+		return Session{}, ErrInvalidSession
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return Session{}, ErrInvalidSession
+	}
+
+	var session Session
+	if err := json.Unmarshal(decoded, &session); err != nil {
+		return Session{}, ErrInvalidSession
+	}
+
+	if now.After(session.ExpiresAt) {
+		return Session{}, ErrInvalidSession
+	}
+
+	return session, nil
+}
+
+func (s *Service) sign(payload string) string {
+	mac := hmac.New(sha256.New, []byte(s.config.LinkPage.SessionSecret))
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func randomState() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,266 @@
+// Package logging masks sensitive values, such as emails, tokens and Discord IDs, before log entries are written
+package logging
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/TicketsBot/subscriptions-app/internal/config"
+	"go.uber.org/zap/zapcore"
+)
+
+const redacted = "REDACTED"
+
+var (
+	emailPattern = regexp.MustCompile(`([A-Za-z0-9._%+\-]+)@([A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)+)`)
+
+	// tokenParamPattern matches secrets passed as query parameters, such as in Patreon pledge URLs
+	tokenParamPattern = regexp.MustCompile(`(?i)\b(access_token|refresh_token|client_secret|token|api_key|key)=[^&\s"']+`)
+	bearerPattern     = regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9\-._~+/]+=*`)
+)
+
+// discordIdKeys are the log fields that hold Discord user IDs
+var discordIdKeys = map[string]struct{}{
+	"discord_id": {},
+	"user_id":    {},
+	"created_by": {},
+	"mapped_by":  {},
+}
+
+// Redactor masks the kinds of sensitive values enabled in the config. Emails and Discord IDs are replaced with a short
+// keyed hash rather than removed, so that the entries about the same patron can still be matched up, but the hashes
+// can't be reversed by hashing guessed values without the key.
+type Redactor struct {
+	emails     bool
+	tokens     bool
+	discordIds bool
+	key        []byte
+}
+
+// NewRedactor returns a redactor keyed with the configured key, or with a random key if none is set
+func NewRedactor(conf config.Config) *Redactor {
+	key := []byte(conf.LogRedaction.Key)
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			panic(err)
+		}
+	}
+
+	return &Redactor{
+		emails:     conf.LogRedaction.Emails,
+		tokens:     conf.LogRedaction.Tokens,
+		discordIds: conf.LogRedaction.DiscordIds,
+		key:        key,
+	}
+}
+
+// Enabled returns whether any kind of value is masked
+func (r *Redactor) Enabled() bool {
+	return r.emails || r.tokens || r.discordIds
+}
+
+// Wrap returns a core that masks the entries' messages and fields before passing them to core. The core is returned
+// unchanged if nothing is masked.
+func (r *Redactor) Wrap(core zapcore.Core) zapcore.Core {
+	if !r.Enabled() {
+		return core
+	}
+
+	return &redactingCore{Core: core, redactor: r}
+}
+
+// String masks the emails and tokens in a string
+func (r *Redactor) String(value string) string {
+	if r.tokens {
+		value = tokenParamPattern.ReplaceAllString(value, "$1="+redacted)
+		value = bearerPattern.ReplaceAllString(value, "Bearer "+redacted)
+	}
+
+	if r.emails {
+		value = emailPattern.ReplaceAllStringFunc(value, func(email string) string {
+			local, domain, _ := strings.Cut(email, "@")
+			return r.pseudonym(local) + "@" + domain
+		})
+	}
+
+	return value
+}
+
+// Field masks the value of a field. Strings, errors and stringers are rendered to strings, and Discord IDs are matched
+// by the field's key, as they can't be told apart from other IDs by their value. Arrays, objects and reflected values,
+// such as those logged with zap.Any, are rendered to JSON and masked throughout, including the Discord IDs held by
+// nested keys.
+func (r *Redactor) Field(field zapcore.Field) zapcore.Field {
+	if _, ok := discordIdKeys[field.Key]; ok && r.discordIds {
+		switch field.Type {
+		case zapcore.Uint64Type:
+			return zapcore.Field{Key: field.Key, Type: zapcore.StringType, String: r.pseudonym(strconv.FormatUint(uint64(field.Integer), 10))}
+		case zapcore.Int64Type:
+			return zapcore.Field{Key: field.Key, Type: zapcore.StringType, String: r.pseudonym(strconv.FormatInt(field.Integer, 10))}
+		case zapcore.StringType:
+			return zapcore.Field{Key: field.Key, Type: zapcore.StringType, String: r.pseudonym(field.String)}
+		case zapcore.ArrayMarshalerType, zapcore.ObjectMarshalerType, zapcore.ReflectType:
+			// Masked below, so that each ID in an array keeps its own hash
+		default:
+			return zapcore.Field{Key: field.Key, Type: zapcore.StringType, String: redacted}
+		}
+	}
+
+	switch field.Type {
+	case zapcore.StringType:
+		field.String = r.String(field.String)
+	case zapcore.ByteStringType:
+		if value, ok := field.Interface.([]byte); ok {
+			return zapcore.Field{Key: field.Key, Type: zapcore.StringType, String: r.String(string(value))}
+		}
+	case zapcore.ErrorType:
+		if err, ok := field.Interface.(error); ok && err != nil {
+			return zapcore.Field{Key: field.Key, Type: zapcore.StringType, String: r.String(err.Error())}
+		}
+	case zapcore.StringerType:
+		if stringer, ok := field.Interface.(fmt.Stringer); ok && stringer != nil {
+			return zapcore.Field{Key: field.Key, Type: zapcore.StringType, String: r.String(stringer.String())}
+		}
+	case zapcore.ArrayMarshalerType, zapcore.ObjectMarshalerType, zapcore.ReflectType:
+		value, err := r.structured(field)
+		if err != nil {
+			return zapcore.Field{Key: field.Key, Type: zapcore.StringType, String: redacted}
+		}
+
+		return zapcore.Field{Key: field.Key, Type: zapcore.ReflectType, Interface: value}
+	case zapcore.InlineMarshalerType:
+		value, err := r.structured(field)
+		if err != nil {
+			return zapcore.Field{Key: field.Key, Type: zapcore.StringType, String: redacted}
+		}
+
+		object, _ := value.(map[string]any)
+		return zapcore.Field{Type: zapcore.InlineMarshalerType, Interface: maskedObject(object)}
+	}
+
+	return field
+}
+
+// structured renders a structured field to JSON, and returns it decoded again with its values masked. Inline fields
+// are returned as an object of the keys that they add.
+func (r *Redactor) structured(field zapcore.Field) (any, error) {
+	enc := zapcore.NewMapObjectEncoder()
+	field.AddTo(enc)
+
+	var rendered any = enc.Fields
+	if field.Type != zapcore.InlineMarshalerType {
+		rendered = enc.Fields[field.Key]
+	}
+
+	encoded, err := json.Marshal(rendered)
+	if err != nil {
+		return nil, err
+	}
+
+	// Numbers are kept as they were written, as Discord IDs don't fit in a float64
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	return r.mask(field.Key, value), nil
+}
+
+// mask masks the strings in a value decoded from JSON, and the Discord IDs held by the keys in discordIdKeys, or by the
+// arrays under them
+func (r *Redactor) mask(key string, value any) any {
+	if _, ok := discordIdKeys[key]; ok && r.discordIds {
+		switch value := value.(type) {
+		case string:
+			return r.pseudonym(value)
+		case json.Number:
+			return r.pseudonym(value.String())
+		case []any, nil:
+			// Each element of an array is masked as an ID below
+		default:
+			return redacted
+		}
+	}
+
+	switch value := value.(type) {
+	case string:
+		return r.String(value)
+	case []any:
+		for i, elem := range value {
+			value[i] = r.mask(key, elem)
+		}
+	case map[string]any:
+		for elemKey, elem := range value {
+			value[elemKey] = r.mask(elemKey, elem)
+		}
+	}
+
+	return value
+}
+
+func (r *Redactor) fields(fields []zapcore.Field) []zapcore.Field {
+	masked := make([]zapcore.Field, len(fields))
+	for i, field := range fields {
+		masked[i] = r.Field(field)
+	}
+
+	return masked
+}
+
+// pseudonym replaces a value with a short hash of it, keyed with the redactor's key
+func (r *Redactor) pseudonym(value string) string {
+	mac := hmac.New(sha256.New, r.key)
+	mac.Write([]byte(value))
+	return "h:" + hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// maskedObject adds the masked keys of an inline field to the entry
+type maskedObject map[string]any
+
+func (o maskedObject) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	for key, value := range o {
+		if err := enc.AddReflected(key, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// redactingCore masks entries before passing them to the wrapped core. Each core of a tee should be wrapped separately,
+// so that their levels are still checked individually.
+type redactingCore struct {
+	zapcore.Core
+	redactor *Redactor
+}
+
+var _ zapcore.Core = (*redactingCore)(nil)
+
+func (c *redactingCore) With(fields []zapcore.Field) zapcore.Core {
+	return &redactingCore{Core: c.Core.With(c.redactor.fields(fields)), redactor: c.redactor}
+}
+
+func (c *redactingCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+
+	return checked
+}
+
+func (c *redactingCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	entry.Message = c.redactor.String(entry.Message)
+	return c.Core.Write(entry, c.redactor.fields(fields))
+}
@@ -0,0 +1,85 @@
+package logging
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/TicketsBot/subscriptions-app/internal/config"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func newTestRedactor(key string) *Redactor {
+	var conf config.Config
+	conf.LogRedaction.Emails = true
+	conf.LogRedaction.Tokens = true
+	conf.LogRedaction.DiscordIds = true
+	conf.LogRedaction.Key = key
+	return NewRedactor(conf)
+}
+
+// encoded returns the field as it would be written to the log
+func encoded(t *testing.T, field zapcore.Field) string {
+	t.Helper()
+
+	enc := zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig())
+	buf, err := enc.EncodeEntry(zapcore.Entry{}, []zapcore.Field{field})
+	if err != nil {
+		t.Fatalf("failed to encode field: %v", err)
+	}
+
+	return buf.String()
+}
+
+type patronObject struct {
+	email     string
+	discordId uint64
+}
+
+func (p patronObject) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("email", p.email)
+	enc.AddUint64("discord_id", p.discordId)
+	return nil
+}
+
+func TestFieldMasksStructuredValues(t *testing.T) {
+	r := newTestRedactor("0123456789abcdef")
+
+	fields := []zapcore.Field{
+		zap.String("email", "patron@example.com"),
+		zap.Error(errors.New("failed to fetch https://example.com/?access_token=secret")),
+		zap.Any("details", map[string]any{"email": "patron@example.com", "nested": []string{"Bearer secret"}}),
+		zap.Reflect("user_id", []uint64{100000000000000005}),
+		zap.Strings("emails", []string{"patron@example.com"}),
+		zap.Object("patron", patronObject{email: "patron@example.com", discordId: 100000000000000005}),
+		zap.Inline(patronObject{email: "patron@example.com", discordId: 100000000000000005}),
+		zap.ByteString("body", []byte(`{"email":"patron@example.com"}`)),
+	}
+
+	for _, field := range fields {
+		out := encoded(t, r.Field(field))
+		for _, secret := range []string{"patron@", "secret", "100000000000000005"} {
+			if strings.Contains(out, secret) {
+				t.Errorf("expected %s field to mask %q, got %s", field.Key, secret, out)
+			}
+		}
+	}
+}
+
+func TestPseudonymIsKeyed(t *testing.T) {
+	first := newTestRedactor("0123456789abcdef")
+	second := newTestRedactor("fedcba9876543210")
+
+	if first.String("patron@example.com") != first.String("patron@example.com") {
+		t.Error("expected the same email to have the same hash")
+	}
+
+	if first.String("patron@example.com") == second.String("patron@example.com") {
+		t.Error("expected hashes to differ between keys")
+	}
+
+	if newTestRedactor("").String("patron@example.com") == newTestRedactor("").String("patron@example.com") {
+		t.Error("expected a random key when none is configured")
+	}
+}
@@ -0,0 +1,123 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "subscriptions"
+
+var (
+	HttpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "The number of HTTP requests handled, by route and status code",
+	}, []string{"method", "route", "status"})
+
+	HttpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "The time taken to handle HTTP requests, by route",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	Commands = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "interaction_commands_total",
+		Help:      "The number of application commands handled, by command and subcommand",
+	}, []string{"command"})
+
+	CommandDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "interaction_command_duration_seconds",
+		Help:      "The time taken to respond to application commands, by command and subcommand",
+		// Discord fails the interaction if there is no response within 3 seconds
+		Buckets: []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2, 3},
+	}, []string{"command"})
+
+	CommandUsesDropped = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "command_uses_dropped_total",
+		Help:      "The number of command uses not recorded to the database, as too many were waiting to be written",
+	})
+
+	PatronEventsDropped = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "patron_events_dropped_total",
+		Help:      "The number of patron events not recorded to the patron history, as too many failed to be stored",
+	})
+
+	Pledges = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "pledges",
+		Help:      "The number of Patreon pledges currently held in memory",
+	})
+
+	LastSync = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_sync_timestamp_seconds",
+		Help:      "The Unix timestamp of the last successful Patreon sync",
+	})
+
+	SyncDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "sync_duration_seconds",
+		Help:      "The time taken to fetch all pledges from Patreon, by result",
+		// Syncing a large campaign can take tens of minutes
+		Buckets: []float64{5, 15, 30, 60, 120, 300, 600, 1200, 2400, 3600},
+	}, []string{"result"})
+
+	PatreonRequestsPerMinute = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "patreon_requests_per_minute",
+		Help:      "The rate that requests to Patreon are currently limited to, adjusted to its responses",
+	})
+
+	PatreonDuplicateEmails = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "patreon_duplicate_emails",
+		Help:      "The number of emails shared by more than one Patreon member in the last sync",
+	})
+
+	SyncPages = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "sync_pages",
+		Help:      "The number of pages of members fetched by the sync in progress, or the last sync",
+	})
+
+	SyncMembers = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "sync_members",
+		Help:      "The number of members fetched by the sync in progress, or the last sync",
+	})
+
+	SyncCampaignMembers = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "sync_campaign_members",
+		Help:      "The number of members Patreon reports the campaign has, as of the sync in progress or the last sync",
+	})
+
+	SyncsSkipped = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "syncs_skipped_total",
+		Help:      "The number of scheduled syncs skipped because the previous sync was still running",
+	})
+
+	Degraded = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "degraded",
+		Help:      "Whether the instance is degraded, serving stale data, by reason",
+	}, []string{"reason"})
+
+	RetentionRowsDeleted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "retention_rows_deleted_total",
+		Help:      "The number of rows deleted by the retention job, by table",
+	}, []string{"table"})
+
+	RetentionFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "retention_failures_total",
+		Help:      "The number of failed attempts to prune a table, by table",
+	}, []string{"table"})
+)
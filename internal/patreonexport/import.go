@@ -0,0 +1,442 @@
+// Package patreonexport imports the members CSV that Patreon exports from the creator dashboard, so that deployments
+// start with the history of patrons who pledged before the app was recording events
+package patreonexport
+
+import (
+	"cmp"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TicketsBot/subscriptions-app/internal/config"
+	"github.com/TicketsBot/subscriptions-app/internal/database"
+	"github.com/TicketsBot/subscriptions-app/internal/events"
+	"github.com/TicketsBot/subscriptions-app/internal/privacy"
+	"github.com/TicketsBot/subscriptions-app/pkg/patreon"
+	"github.com/pkg/errors"
+)
+
+// The columns of the export that are imported. Only the user ID is required, and columns may appear in any order.
+// Other columns, such as names and addresses, are ignored.
+const (
+	columnUserId           = "user id"
+	columnEmail            = "email"
+	columnPatronStatus     = "patron status"
+	columnTier             = "tier"
+	columnTierId           = "tier id"
+	columnPledgeAmount     = "pledge amount"
+	columnLifetimeAmount   = "lifetime amount"
+	columnPatronageSince   = "patronage since date"
+	columnLastChargeDate   = "last charge date"
+	columnLastChargeStatus = "last charge status"
+	columnAccessExpiration = "access expiration"
+)
+
+// Member is a row of the export
+type Member struct {
+	PatronId             uint64
+	Email                string
+	PatronStatus         string // In the form used by the API, such as active_patron
+	Tier                 string
+	TierId               uint64 // Unset if the export doesn't have a tier ID column
+	PledgeAmountCents    int
+	LifetimeSupportCents int
+	PatronageSince       *time.Time
+	LastChargeDate       *time.Time
+	LastChargeStatus     string
+	AccessExpiration     *time.Time
+}
+
+// TierRegistry resolves the tier names in the export to tier IDs
+type TierRegistry interface {
+	All() map[uint64]config.Tier
+}
+
+// ParseCSV reads a members export. The first row must be a header row.
+func ParseCSV(r io.Reader) ([]Member, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read header row")
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		// Excel adds a byte order mark to the first column when saving as CSV
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+
+	if _, ok := columns[columnUserId]; !ok {
+		return nil, fmt.Errorf("missing required column %q", columnUserId)
+	}
+
+	var members []Member
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.Wrapf(err, "failed to read line %d", line)
+		}
+
+		member, err := parseRecord(record, columns)
+		if err != nil {
+			return nil, errors.Wrapf(err, "line %d", line)
+		}
+
+		members = append(members, member)
+	}
+
+	return members, nil
+}
+
+func parseRecord(record []string, columns map[string]int) (Member, error) {
+	get := func(column string) string {
+		if i, ok := columns[column]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+
+		return ""
+	}
+
+	patronId, err := strconv.ParseUint(get(columnUserId), 10, 64)
+	if err != nil {
+		return Member{}, errors.Wrap(err, "invalid user ID")
+	}
+
+	member := Member{
+		PatronId:         patronId,
+		Email:            get(columnEmail),
+		PatronStatus:     strings.ReplaceAll(strings.ToLower(get(columnPatronStatus)), " ", "_"),
+		Tier:             get(columnTier),
+		LastChargeStatus: get(columnLastChargeStatus),
+	}
+
+	if raw := get(columnTierId); raw != "" {
+		if member.TierId, err = strconv.ParseUint(raw, 10, 64); err != nil {
+			return Member{}, errors.Wrap(err, "invalid tier ID")
+		}
+	}
+
+	if member.PledgeAmountCents, err = parseCents(get(columnPledgeAmount)); err != nil {
+		return Member{}, errors.Wrap(err, "invalid pledge amount")
+	}
+
+	if member.LifetimeSupportCents, err = parseCents(get(columnLifetimeAmount)); err != nil {
+		return Member{}, errors.Wrap(err, "invalid lifetime amount")
+	}
+
+	dates := map[string]**time.Time{
+		columnPatronageSince:   &member.PatronageSince,
+		columnLastChargeDate:   &member.LastChargeDate,
+		columnAccessExpiration: &member.AccessExpiration,
+	}
+
+	for column, field := range dates {
+		if raw := get(column); raw != "" {
+			date, err := parseTime(raw)
+			if err != nil {
+				return Member{}, errors.Wrapf(err, "invalid %s", column)
+			}
+
+			*field = &date
+		}
+	}
+
+	return member, nil
+}
+
+// parseCents parses an amount in the export's currency, such as 5.00, which may have a currency symbol. Spreadsheets
+// saved in some locales write amounts with a decimal comma, such as 5,00 or 1.234,56.
+func parseCents(raw string) (int, error) {
+	raw = strings.TrimSpace(strings.Trim(raw, "$€£ "))
+	if raw == "" {
+		return 0, nil
+	}
+
+	amount, err := strconv.ParseFloat(normalizeDecimal(raw), 64)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(math.Round(amount * 100)), nil
+}
+
+// normalizeDecimal rewrites an amount to use a decimal point, without thousands separators. If an amount has both
+// separators, the last is the decimal separator. A lone comma is only a decimal separator if it is followed by one or
+// two digits, as in 5,00, and otherwise separates thousands, as in 1,234.
+func normalizeDecimal(raw string) string {
+	lastComma, lastPoint := strings.LastIndex(raw, ","), strings.LastIndex(raw, ".")
+
+	switch {
+	case lastComma == -1:
+		return raw
+	case lastPoint > lastComma:
+		return strings.ReplaceAll(raw, ",", "")
+	case lastPoint != -1:
+		raw = strings.ReplaceAll(raw, ".", "")
+		return strings.Replace(raw, ",", ".", 1)
+	case strings.Count(raw, ",") == 1 && len(raw)-lastComma-1 <= 2:
+		return strings.Replace(raw, ",", ".", 1)
+	default:
+		return strings.ReplaceAll(raw, ",", "")
+	}
+}
+
+// timeLayouts are the date formats that Patreon has used in exports, and that spreadsheets save them as
+var timeLayouts = []string{
+	"2006-01-02 15:04:05.999999",
+	"2006-01-02 15:04:05",
+	time.RFC3339,
+	time.DateOnly,
+	"01/02/2006 15:04",
+	"01/02/2006",
+}
+
+func parseTime(raw string) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, raw); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("unrecognised date %q", raw)
+}
+
+// Result counts what an import did
+type Result struct {
+	Members      int // Rows in the export
+	Events       int // History events created
+	Skipped      int // Members skipped as they already have history
+	UnknownTiers int // Members whose tier could not be resolved to an ID
+}
+
+// Import creates the history events that the export implies for each member: when they started pledging, and, for
+// declined and former patrons, when their charge was declined or their pledge ended. Members that already have history
+// are skipped, so that events recorded by the app are never duplicated and the same export can be imported again. If
+// dryRun is set, nothing is stored.
+func Import(
+	ctx context.Context,
+	db *database.Database,
+	tiers TierRegistry,
+	emails *privacy.Emails,
+	members []Member,
+	dryRun bool,
+) (Result, error) {
+	result := Result{Members: len(members)}
+
+	existing, err := db.PatronHistory.PatronIds(ctx)
+	if err != nil {
+		return Result{}, errors.Wrap(err, "failed to fetch patrons with history")
+	}
+
+	tierIds := tierIdsByName(tiers)
+
+	var entries []database.PatronHistoryEntry
+	for _, member := range members {
+		if _, ok := existing[member.PatronId]; ok {
+			result.Skipped++
+			continue
+		}
+
+		memberTiers, ok := resolveTiers(member, tierIds)
+		if !ok {
+			result.UnknownTiers++
+		}
+
+		for _, event := range memberEvents(member, emails.Protect(member.Email), memberTiers) {
+			details, err := json.Marshal(event)
+			if err != nil {
+				return Result{}, errors.Wrap(err, "failed to encode event")
+			}
+
+			effectiveAt := event.EffectiveAt
+			entries = append(entries, database.PatronHistoryEntry{
+				PatronId:    event.PatronId,
+				Event:       string(event.Type),
+				Details:     details,
+				EffectiveAt: &effectiveAt,
+			})
+		}
+	}
+
+	result.Events = len(entries)
+	if dryRun || len(entries) == 0 {
+		return result, nil
+	}
+
+	if err := db.PatronHistory.InsertMany(ctx, entries); err != nil {
+		return Result{}, errors.Wrap(err, "failed to store events")
+	}
+
+	return result, nil
+}
+
+// memberEvents returns the events of a member, oldest first. Members who never pledged have none.
+func memberEvents(member Member, email string, tiers []uint64) []events.Event {
+	if member.PatronageSince == nil {
+		return nil
+	}
+
+	base := events.Event{
+		PatronId: member.PatronId,
+		Email:    email,
+	}
+
+	started := base
+	started.Type = events.TypeNew
+	started.Tiers = tiers
+	started.AmountCents = member.PledgeAmountCents
+	started.EffectiveAt = *member.PatronageSince
+
+	implied := []events.Event{started}
+
+	switch member.PatronStatus {
+	case "declined_patron":
+		if member.LastChargeDate != nil && member.LastChargeStatus == "Declined" {
+			declined := started
+			declined.Type = events.TypeDecline
+			declined.PreviousTiers = tiers
+			declined.PreviousAmountCents = member.PledgeAmountCents
+			declined.EffectiveAt = *member.LastChargeDate
+			implied = append(implied, declined)
+		}
+	case "former_patron":
+		// The export doesn't date when the pledge ended, so it is approximated by when access expired, or the last
+		// charge
+		endedAt := member.AccessExpiration
+		if endedAt == nil {
+			endedAt = member.LastChargeDate
+		}
+
+		if endedAt != nil {
+			cancelled := base
+			cancelled.Type = events.TypeCancel
+			cancelled.PreviousTiers = tiers
+			cancelled.PreviousAmountCents = member.PledgeAmountCents
+			cancelled.EffectiveAt = *endedAt
+			implied = append(implied, cancelled)
+		}
+	}
+
+	return implied
+}
+
+// tierIdsByName maps the lowercase names of the known tiers to their IDs
+func tierIdsByName(tiers TierRegistry) map[string]uint64 {
+	ids := make(map[string]uint64)
+	for tierId, tier := range tiers.All() {
+		ids[strings.ToLower(tier.Name)] = tierId
+	}
+
+	return ids
+}
+
+// resolveTiers returns the member's tier ID, from the tier ID column if the export has one, or otherwise by matching the
+// tier's name. It returns false if the member has a tier that can't be resolved.
+func resolveTiers(member Member, tierIds map[string]uint64) ([]uint64, bool) {
+	if member.TierId != 0 {
+		return []uint64{member.TierId}, true
+	}
+
+	if member.Tier == "" {
+		return []uint64{}, true
+	}
+
+	tierId, ok := tierIds[strings.ToLower(member.Tier)]
+	if !ok {
+		return []uint64{}, false
+	}
+
+	return []uint64{tierId}, true
+}
+
+// Snapshot converts the members to a Patreon snapshot, to store before the app has synced for the first time. As when
+// syncing, the snapshot has a patron for each normalized email: members without an email are skipped, and members that
+// share an email are merged, keeping the preferred member. Patrons are ordered by patron ID.
+func Snapshot(tiers TierRegistry, emails *privacy.Emails, members []Member, canonicalizeGmail bool) []database.SnapshotPatron {
+	tierIds := tierIdsByName(tiers)
+
+	// Normalized email -> patron
+	byEmail := make(map[string]patreon.Patron)
+	for _, member := range members {
+		email := patreon.NormalizeEmail(member.Email, canonicalizeGmail)
+		if email == "" {
+			continue
+		}
+
+		memberTiers, _ := resolveTiers(member, tierIds)
+
+		// Only active patrons are entitled to their tier
+		if member.PatronStatus != "active_patron" {
+			memberTiers = []uint64{}
+		}
+
+		patron := patreon.Patron{
+			Attributes: patreon.Attributes{
+				Email:                        email,
+				LastChargeDate:               valueOf(member.LastChargeDate),
+				LastChargeStatus:             member.LastChargeStatus,
+				PatronStatus:                 member.PatronStatus,
+				PledgeRelationshipStart:      valueOf(member.PatronageSince),
+				CurrentlyEntitledAmountCents: member.PledgeAmountCents,
+				LifetimeSupportCents:         member.LifetimeSupportCents,
+			},
+			Id:    member.PatronId,
+			Tiers: memberTiers,
+		}
+
+		if existing, ok := byEmail[email]; ok {
+			patron = patreon.MergeDuplicate(existing, patron)
+		}
+
+		byEmail[email] = patron
+	}
+
+	patrons := make([]database.SnapshotPatron, 0, len(byEmail))
+	for _, patron := range byEmail {
+		patrons = append(patrons, database.SnapshotPatron{
+			Email:                        emails.Protect(patron.Email),
+			PatronId:                     patron.Id,
+			Tiers:                        patron.Tiers,
+			PatronStatus:                 patron.PatronStatus,
+			LastChargeStatus:             patron.LastChargeStatus,
+			LastChargeDate:               nonZero(patron.LastChargeDate),
+			PledgeRelationshipStart:      nonZero(patron.PledgeRelationshipStart),
+			CurrentlyEntitledAmountCents: patron.CurrentlyEntitledAmountCents,
+			LifetimeSupportCents:         patron.LifetimeSupportCents,
+		})
+	}
+
+	slices.SortFunc(patrons, func(a, b database.SnapshotPatron) int {
+		return cmp.Compare(a.PatronId, b.PatronId)
+	})
+
+	return patrons
+}
+
+func valueOf(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+
+	return *t
+}
+
+func nonZero(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
@@ -0,0 +1,130 @@
+package patreonexport
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TicketsBot/subscriptions-app/internal/config"
+	"github.com/TicketsBot/subscriptions-app/internal/privacy"
+)
+
+// testTiers is a registry with a single tier
+type testTiers struct{}
+
+func (testTiers) All() map[uint64]config.Tier {
+	return map[uint64]config.Tier{1001: {Name: "Premium"}}
+}
+
+func TestParseCents(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want int
+	}{
+		{"", 0},
+		{"5", 500},
+		{"5.00", 500},
+		{"$5.00", 500},
+		{"5,00", 500},
+		{"5,5", 550},
+		{"€ 5,00", 500},
+		{"1,234", 123400},
+		{"1,234.56", 123456},
+		{"1.234,56", 123456},
+		{"1,234,567", 123456700},
+		{"£12.34", 1234},
+	}
+
+	for _, test := range tests {
+		got, err := parseCents(test.raw)
+		if err != nil {
+			t.Errorf("failed to parse %q: %v", test.raw, err)
+			continue
+		}
+
+		if got != test.want {
+			t.Errorf("expected %q to be %d cents, got %d", test.raw, test.want, got)
+		}
+	}
+
+	if _, err := parseCents("five"); err == nil {
+		t.Error("expected an invalid amount to fail to parse")
+	}
+}
+
+func TestParseCSV(t *testing.T) {
+	export := "\ufeffName,Email,User ID,Patron Status,Tier,Pledge Amount,Lifetime Amount,Patronage Since Date,Last Charge Date,Last Charge Status\n" +
+		"Alice,alice@example.com,1,Active patron,Premium,\"5,00\",\"$1,234.50\",2024-01-02 03:04:05,2024-06-02,Paid\n" +
+		"Bob,,2,Former patron,,,,,,\n"
+
+	members, err := ParseCSV(strings.NewReader(export))
+	if err != nil {
+		t.Fatalf("failed to parse export: %v", err)
+	}
+
+	if len(members) != 2 {
+		t.Fatalf("expected 2 members, got %d", len(members))
+	}
+
+	alice := members[0]
+	if alice.PatronId != 1 || alice.Email != "alice@example.com" || alice.PatronStatus != "active_patron" || alice.Tier != "Premium" {
+		t.Errorf("alice was parsed as %+v", alice)
+	}
+
+	if alice.PledgeAmountCents != 500 || alice.LifetimeSupportCents != 123450 {
+		t.Errorf("expected amounts of 500 and 123450 cents, got %d and %d", alice.PledgeAmountCents, alice.LifetimeSupportCents)
+	}
+
+	if want := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC); alice.PatronageSince == nil || !alice.PatronageSince.Equal(want) {
+		t.Errorf("expected patronage since %s, got %v", want, alice.PatronageSince)
+	}
+
+	if bob := members[1]; bob.PatronStatus != "former_patron" || bob.PatronageSince != nil || bob.PledgeAmountCents != 0 {
+		t.Errorf("bob was parsed as %+v", bob)
+	}
+
+	if _, err := ParseCSV(strings.NewReader("Name,Email\nAlice,alice@example.com\n")); err == nil {
+		t.Error("expected an export without a user ID column to fail to parse")
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	older := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := older.AddDate(0, 1, 0)
+
+	members := []Member{
+		{PatronId: 1, Email: "Shared@Example.com", PatronStatus: "former_patron", Tier: "Premium", LastChargeDate: &newer},
+		{PatronId: 2, Email: "shared@example.com", PatronStatus: "active_patron", Tier: "Premium", LastChargeDate: &older},
+		{PatronId: 3, Email: "", PatronStatus: "active_patron"},
+		{PatronId: 4, Email: "  ", PatronStatus: "active_patron"},
+		{PatronId: 5, Email: "f.o.o+patreon@gmail.com", PatronStatus: "declined_patron", Tier: "Premium"},
+		{PatronId: 6, Email: "foo@gmail.com", PatronStatus: "former_patron"},
+	}
+
+	patrons := Snapshot(testTiers{}, privacy.NewEmails(config.Config{}), members, true)
+
+	// One patron for each normalized email, in patron ID order
+	if len(patrons) != 2 {
+		t.Fatalf("expected 2 patrons, got %d: %+v", len(patrons), patrons)
+	}
+
+	// The active member is preferred, even though the former member was charged more recently
+	shared := patrons[0]
+	if shared.PatronId != 2 || shared.Email != "shared@example.com" || len(shared.Tiers) != 1 || shared.Tiers[0] != 1001 {
+		t.Errorf("expected the active member with a normalized email, got %+v", shared)
+	}
+
+	if shared.LastChargeDate == nil || !shared.LastChargeDate.Equal(older) {
+		t.Errorf("expected the last charge date of the active member, got %v", shared.LastChargeDate)
+	}
+
+	// Neither member is entitled to a tier, so the lowest patron ID is preferred
+	gmail := patrons[1]
+	if gmail.PatronId != 5 || gmail.Email != "foo@gmail.com" || len(gmail.Tiers) != 0 {
+		t.Errorf("expected the declined member with a canonicalized email and no tiers, got %+v", gmail)
+	}
+
+	if gmail.LastChargeDate != nil {
+		t.Errorf("expected no last charge date, got %v", gmail.LastChargeDate)
+	}
+}
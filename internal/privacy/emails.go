@@ -0,0 +1,105 @@
+// Package privacy minimises the personal data that the app holds. When emails are hashed, each email is replaced as it
+// is received with a salted hash of it followed by a masked form, such as h:<hash>#f***@gmail.com. Equal emails have
+// equal hashes, so emails can still be matched, and the domain is kept, so patrons can still be found by domain.
+package privacy
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+
+	"github.com/TicketsBot/subscriptions-app/internal/config"
+	"github.com/TicketsBot/subscriptions-app/pkg/patreon"
+)
+
+// hashLength is the number of bytes of the HMAC kept in protected emails
+const hashLength = 16
+
+var protectedPattern = regexp.MustCompile(`^h:[0-9a-f]{32}#`)
+
+// Emails protects emails with the configured salt. If hashing is disabled, emails are left unchanged.
+type Emails struct {
+	enabled           bool
+	salt              []byte
+	canonicalizeGmail bool
+}
+
+func NewEmails(conf config.Config) *Emails {
+	return &Emails{
+		enabled:           conf.Privacy.HashEmails,
+		salt:              []byte(conf.Privacy.EmailSalt),
+		canonicalizeGmail: conf.Patreon.CanonicalizeGmail,
+	}
+}
+
+func (e *Emails) Enabled() bool {
+	return e.enabled
+}
+
+// Protect returns the form that the email is stored and matched by. The email is normalized before it is hashed, so
+// that differently written forms of the same address have the same hash. Emails that are already protected are
+// returned unchanged.
+func (e *Emails) Protect(email string) string {
+	if !e.enabled || email == "" || IsProtected(email) {
+		return email
+	}
+
+	normalized := patreon.NormalizeEmail(email, e.canonicalizeGmail)
+
+	mac := hmac.New(sha256.New, e.salt)
+	mac.Write([]byte(normalized))
+
+	return "h:" + hex.EncodeToString(mac.Sum(nil)[:hashLength]) + "#" + Mask(normalized)
+}
+
+// ProtectPtr protects an optional email
+func (e *Emails) ProtectPtr(email *string) *string {
+	if email == nil {
+		return nil
+	}
+
+	protected := e.Protect(*email)
+	return &protected
+}
+
+// Display returns the form of the email to show to staff: the masked form of a protected email, or, if hashing is
+// enabled, of an email that was entered. Otherwise, the email is returned unchanged.
+func (e *Emails) Display(email string) string {
+	if IsProtected(email) {
+		return Masked(email)
+	}
+
+	if e.enabled {
+		return Mask(email)
+	}
+
+	return email
+}
+
+// Masked returns the masked part of a protected email, or the email unchanged if it isn't protected
+func Masked(email string) string {
+	if !IsProtected(email) {
+		return email
+	}
+
+	_, masked, _ := strings.Cut(email, "#")
+	return masked
+}
+
+// IsProtected returns whether the email has been replaced by Protect
+func IsProtected(email string) bool {
+	return protectedPattern.MatchString(email)
+}
+
+// Mask keeps the first character of the email and its domain, such as f***@gmail.com. Values without a local part,
+// such as part of a domain entered in a lookup, are returned unchanged.
+func Mask(email string) string {
+	local, domain, ok := strings.Cut(email, "@")
+	if !ok || local == "" {
+		return email
+	}
+
+	return string([]rune(local)[:1]) + "***@" + domain
+}
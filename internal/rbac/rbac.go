@@ -0,0 +1,73 @@
+// Package rbac defines the permissions that API keys and Discord staff roles can be granted, which are checked by both
+// the API middleware and the command dispatcher
+package rbac
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Permission string
+
+const (
+	Read   Permission = "read"   // Look up subscriptions and tiers
+	Grant  Permission = "grant"  // Create vouchers and import premium
+	Revoke Permission = "revoke" // Revoke vouchers that haven't been redeemed
+	Export Permission = "export" // Bulk data, such as analytics and patrons by domain
+	Admin  Permission = "admin"  // Change the app's behaviour, such as tier mappings and reloading config. Implies the others.
+)
+
+var Permissions = []Permission{Read, Grant, Revoke, Export, Admin}
+
+// Set is the permissions held by an API key or member. A set containing Admin has every permission.
+type Set []Permission
+
+// All is held by API keys without configured permissions, so that keys created before RBAC keep working
+var All = Set{Admin}
+
+func (s Set) Has(permission Permission) bool {
+	for _, held := range s {
+		if held == permission || held == Admin {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Union returns the permissions held by either set
+func (s Set) Union(other Set) Set {
+	union := append(Set{}, s...)
+	for _, permission := range other {
+		if !union.contains(permission) {
+			union = append(union, permission)
+		}
+	}
+
+	return union
+}
+
+func (s Set) contains(permission Permission) bool {
+	for _, held := range s {
+		if held == permission {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ParseSet parses permissions separated by "|", such as "read|export"
+func ParseSet(value string) (Set, error) {
+	var set Set
+	for _, name := range strings.Split(value, "|") {
+		permission := Permission(strings.ToLower(strings.TrimSpace(name)))
+		if !Set(Permissions).contains(permission) {
+			return nil, fmt.Errorf("unknown permission %q, must be one of read, grant, revoke, export or admin", name)
+		}
+
+		set = set.Union(Set{permission})
+	}
+
+	return set, nil
+}
@@ -0,0 +1,413 @@
+package reconciliation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TicketsBot-cloud/gdl/objects/channel/embed"
+	"github.com/TicketsBot-cloud/gdl/rest"
+	"github.com/TicketsBot/subscriptions-app/internal/allocations"
+	"github.com/TicketsBot/subscriptions-app/internal/config"
+	"github.com/TicketsBot/subscriptions-app/internal/database"
+	"github.com/TicketsBot/subscriptions-app/pkg/patreon"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+type Kind string
+
+const (
+	KindUnlinked         Kind = "unlinked"          // Entitled, but has no Discord account to receive premium
+	KindLapsedAllocation Kind = "lapsed_allocation" // A guild allocation from a user who is no longer entitled
+	KindMissingInBot     Kind = "missing_in_bot"    // A guild that is entitled to premium, but the bot doesn't treat as premium
+	KindLapsedInBot      Kind = "lapsed_in_bot"     // A guild that the bot treats as premium, but isn't entitled to it
+)
+
+// maxFieldLength is the longest an embed field value can be, leaving room for the count of discrepancies not listed
+const maxFieldLength = 1000
+
+type Discrepancy struct {
+	Kind      Kind    `json:"kind"`
+	GuildId   *uint64 `json:"guild_id,string,omitempty"`
+	DiscordId *uint64 `json:"discord_id,string,omitempty"`
+	PatronId  *uint64 `json:"patron_id,string,omitempty"`
+	Source    string  `json:"source,omitempty"`
+	Reference string  `json:"reference,omitempty"`
+}
+
+type Report struct {
+	GeneratedAt   time.Time     `json:"generated_at"`
+	Discrepancies []Discrepancy `json:"discrepancies"`
+	BotCompared   bool          `json:"bot_compared"` // Whether the bot's premium guilds were fetched and compared
+}
+
+// Subscriptions provides the subscriptions stored for sources other than Patreon
+type Subscriptions interface {
+	SubscriptionsBySource(ctx context.Context, source string) ([]database.ExternalSubscription, error)
+}
+
+// Patrons provides the current Patreon snapshot
+type Patrons interface {
+	Loaded() bool
+	ActivePledges() []patreon.Patron
+}
+
+// Job periodically compares the data from every source with the guild allocations, and with the premium guilds
+// reported by the bot if configured, and reports any discrepancies
+type Job struct {
+	config        config.Config
+	logger        *zap.Logger
+	db            *database.Database
+	subscriptions Subscriptions
+	allocations   *allocations.Service
+	patrons       Patrons
+	httpClient    *http.Client
+
+	latest   *Report
+	latestMu sync.RWMutex
+}
+
+func NewJob(
+	config config.Config,
+	logger *zap.Logger,
+	db *database.Database,
+	subscriptions Subscriptions,
+	allocations *allocations.Service,
+	patrons Patrons,
+) *Job {
+	return &Job{
+		config:        config,
+		logger:        logger,
+		db:            db,
+		subscriptions: subscriptions,
+		allocations:   allocations,
+		patrons:       patrons,
+		httpClient:    &http.Client{Timeout: time.Second * 30},
+	}
+}
+
+func (j *Job) Run(ctx context.Context) {
+	interval := time.Duration(j.config.Reconciliation.IntervalHours) * time.Hour
+	if interval <= 0 {
+		interval = time.Hour * 24
+	}
+
+	// Before the first sync, every allocation from a patron would be reported as lapsed
+	for !j.patrons.Loaded() {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Minute):
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		runCtx, cancel := context.WithTimeout(ctx, time.Minute*10)
+		if err := j.Reconcile(runCtx); err != nil {
+			j.logger.Error("Failed to reconcile sources", zap.Error(err))
+		}
+		cancel()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Latest returns the report from the most recent run, if any
+func (j *Job) Latest() (Report, bool) {
+	j.latestMu.RLock()
+	defer j.latestMu.RUnlock()
+
+	if j.latest == nil {
+		return Report{}, false
+	}
+
+	return *j.latest, true
+}
+
+// Reconcile builds a report, and posts it to the configured channel if there are discrepancies. The same
+// discrepancies are found on every run until they are fixed, so the report is only posted when the number of each kind
+// has changed since the last run, as stored in the database.
+func (j *Job) Reconcile(ctx context.Context) error {
+	report, err := j.buildReport(ctx)
+	if err != nil {
+		return err
+	}
+
+	j.latestMu.Lock()
+	j.latest = &report
+	j.latestMu.Unlock()
+
+	j.logger.Info("Reconciliation complete", zap.Int("discrepancies", len(report.Discrepancies)))
+
+	if j.config.Reconciliation.ChannelId == 0 {
+		return nil
+	}
+
+	previous, err := j.db.ReconciliationCounts.Get(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to fetch discrepancy counts of the last run")
+	}
+
+	counts := report.counts()
+	if maps.Equal(counts, previous) {
+		j.logger.Debug("Discrepancies unchanged since the last run, not posting report")
+		return nil
+	}
+
+	if len(report.Discrepancies) > 0 {
+		if _, err := rest.CreateMessage(ctx, j.config.Discord.BotToken, nil, j.config.Reconciliation.ChannelId, rest.CreateMessageData{
+			Embeds: []*embed.Embed{j.buildEmbed(report)},
+		}); err != nil {
+			return errors.Wrap(err, "failed to post reconciliation report")
+		}
+	}
+
+	// Stored once posted, so that a report that fails to post is tried again on the next run
+	if err := j.db.ReconciliationCounts.Set(ctx, counts); err != nil {
+		return errors.Wrap(err, "failed to store discrepancy counts")
+	}
+
+	return nil
+}
+
+// counts returns the number of discrepancies of each kind in the report, leaving out kinds without any
+func (r Report) counts() map[string]int {
+	counts := make(map[string]int)
+	for _, discrepancy := range r.Discrepancies {
+		counts[string(discrepancy.Kind)]++
+	}
+
+	return counts
+}
+
+func (j *Job) buildReport(ctx context.Context) (Report, error) {
+	report := Report{
+		GeneratedAt:   time.Now(),
+		Discrepancies: []Discrepancy{},
+	}
+
+	for _, patron := range j.patrons.ActivePledges() {
+		if patron.DiscordId == nil {
+			report.Discrepancies = append(report.Discrepancies, Discrepancy{
+				Kind:     KindUnlinked,
+				PatronId: ptr(patron.Id),
+				Source:   "Patreon",
+			})
+		}
+	}
+
+	overrides, err := j.subscriptions.SubscriptionsBySource(ctx, database.SourceManual)
+	if err != nil {
+		return Report{}, errors.Wrap(err, "failed to fetch manual overrides")
+	}
+
+	for _, override := range overrides {
+		if override.DiscordId == nil && override.Status == "active" && (override.ExpiresAt == nil || override.ExpiresAt.After(report.GeneratedAt)) {
+			report.Discrepancies = append(report.Discrepancies, Discrepancy{
+				Kind:      KindUnlinked,
+				Source:    "Manual",
+				Reference: override.Reference,
+			})
+		}
+	}
+
+	premiumGuilds, err := j.checkAllocations(ctx, &report)
+	if err != nil {
+		return Report{}, err
+	}
+
+	if j.config.Reconciliation.BotPremiumUrl != "" {
+		botGuilds, err := j.fetchBotPremiumGuilds(ctx)
+		if err != nil {
+			return Report{}, errors.Wrap(err, "failed to fetch premium guilds from the bot")
+		}
+
+		for _, guildId := range slices.Sorted(maps.Keys(premiumGuilds)) {
+			if _, ok := botGuilds[guildId]; !ok {
+				report.Discrepancies = append(report.Discrepancies, Discrepancy{Kind: KindMissingInBot, GuildId: ptr(guildId)})
+			}
+		}
+
+		for _, guildId := range slices.Sorted(maps.Keys(botGuilds)) {
+			if _, ok := premiumGuilds[guildId]; !ok {
+				report.Discrepancies = append(report.Discrepancies, Discrepancy{Kind: KindLapsedInBot, GuildId: ptr(guildId)})
+			}
+		}
+
+		report.BotCompared = true
+	}
+
+	return report, nil
+}
+
+// checkAllocations reports allocations from users who are no longer entitled, returning the guilds that have premium
+func (j *Job) checkAllocations(ctx context.Context, report *Report) (map[uint64]struct{}, error) {
+	all, err := j.db.GuildAllocations.GetAll(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch guild allocations")
+	}
+
+	limits := make(map[uint64]int)
+	checked := make(map[uint64]bool)
+	premiumGuilds := make(map[uint64]struct{})
+	for _, allocation := range all {
+		limit, ok := limits[allocation.DiscordId]
+		if !ok {
+			if limit, err = j.allocations.Limit(ctx, allocation.DiscordId); err != nil {
+				return nil, errors.Wrapf(err, "failed to fetch entitlements of %d", allocation.DiscordId)
+			}
+
+			limits[allocation.DiscordId] = limit
+		}
+
+		if limit == 0 {
+			report.Discrepancies = append(report.Discrepancies, Discrepancy{
+				Kind:      KindLapsedAllocation,
+				GuildId:   ptr(allocation.GuildId),
+				DiscordId: ptr(allocation.DiscordId),
+			})
+		}
+
+		if checked[allocation.GuildId] {
+			continue
+		}
+
+		checked[allocation.GuildId] = true
+
+		// Allocations beyond the user's limit don't count, which Status accounts for
+		status, err := j.allocations.Status(ctx, allocation.GuildId)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to fetch premium status of guild %d", allocation.GuildId)
+		}
+
+		if status.Premium {
+			premiumGuilds[allocation.GuildId] = struct{}{}
+		}
+	}
+
+	return premiumGuilds, nil
+}
+
+type botPremiumResponse struct {
+	GuildIds []string `json:"guild_ids"`
+}
+
+// fetchBotPremiumGuilds fetches the guilds that the bot treats as premium, which it returns as {"guild_ids": [...]}
+func (j *Job) fetchBotPremiumGuilds(ctx context.Context) (map[uint64]struct{}, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.config.Reconciliation.BotPremiumUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if j.config.Reconciliation.BotApiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+j.config.Reconciliation.BotApiKey)
+	}
+
+	res, err := j.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("bot premium response returned %d status code", res.StatusCode)
+	}
+
+	var body botPremiumResponse
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+
+	guilds := make(map[uint64]struct{}, len(body.GuildIds))
+	for _, idStr := range body.GuildIds {
+		guildId, err := strconv.ParseUint(idStr, 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid guild ID %q", idStr)
+		}
+
+		guilds[guildId] = struct{}{}
+	}
+
+	return guilds, nil
+}
+
+func (j *Job) buildEmbed(report Report) *embed.Embed {
+	byKind := make(map[Kind][]Discrepancy)
+	for _, discrepancy := range report.Discrepancies {
+		byKind[discrepancy.Kind] = append(byKind[discrepancy.Kind], discrepancy)
+	}
+
+	titles := map[Kind]string{
+		KindUnlinked:         "Entitled but Unlinked",
+		KindLapsedAllocation: "Allocations from Lapsed Users",
+		KindMissingInBot:     "Entitled but Not Premium in Bot",
+		KindLapsedInBot:      "Premium in Bot but Not Entitled",
+	}
+
+	e := &embed.Embed{
+		Title:       "Reconciliation Discrepancies",
+		Description: fmt.Sprintf("Found %d discrepancies. The full report is available from `GET /api/reconciliation`.", len(report.Discrepancies)),
+		Timestamp:   &report.GeneratedAt,
+		Color:       int(j.config.Branding.ErrorColor),
+	}
+
+	for _, kind := range []Kind{KindMissingInBot, KindLapsedInBot, KindLapsedAllocation, KindUnlinked} {
+		discrepancies := byKind[kind]
+		if len(discrepancies) == 0 {
+			continue
+		}
+
+		var lines []string
+		length := 0
+		for i, discrepancy := range discrepancies {
+			line := j.describe(discrepancy)
+			if length += len(line) + 1; length > maxFieldLength {
+				lines = append(lines, fmt.Sprintf("…and %d more", len(discrepancies)-i))
+				break
+			}
+
+			lines = append(lines, line)
+		}
+
+		e.Fields = append(e.Fields, &embed.EmbedField{
+			Name:   fmt.Sprintf("%s (%d)", titles[kind], len(discrepancies)),
+			Value:  strings.Join(lines, "\n"),
+			Inline: false,
+		})
+	}
+
+	return e
+}
+
+func (j *Job) describe(discrepancy Discrepancy) string {
+	switch {
+	case discrepancy.PatronId != nil:
+		return fmt.Sprintf("[Patron %d](%s)", *discrepancy.PatronId, fmt.Sprintf(j.config.Branding.PatronUrl, *discrepancy.PatronId))
+	case discrepancy.GuildId != nil && discrepancy.DiscordId != nil:
+		return fmt.Sprintf("Server `%d` from <@%d>", *discrepancy.GuildId, *discrepancy.DiscordId)
+	case discrepancy.GuildId != nil:
+		return fmt.Sprintf("Server `%d`", *discrepancy.GuildId)
+	default:
+		return fmt.Sprintf("%s `%s`", discrepancy.Source, discrepancy.Reference)
+	}
+}
+
+func ptr[T any](value T) *T {
+	return &value
+}
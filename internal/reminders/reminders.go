@@ -0,0 +1,153 @@
+// Package reminders DMs patrons whose Patreon charge was declined, asking them to update their payment details before
+// their premium lapses
+package reminders
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TicketsBot-cloud/gdl/rest"
+	"github.com/TicketsBot/subscriptions-app/internal/clock"
+	"github.com/TicketsBot/subscriptions-app/internal/config"
+	"github.com/TicketsBot/subscriptions-app/internal/currency"
+	"github.com/TicketsBot/subscriptions-app/internal/database"
+	"github.com/TicketsBot/subscriptions-app/internal/events"
+	"github.com/TicketsBot/subscriptions-app/internal/privacy"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// eventBuffer is the number of events that can wait while a reminder is being sent. Only decline events are acted on,
+// so events are dropped only after a sync that changes many patrons.
+const eventBuffer = 1000
+
+// TierNames provides the display names of tiers
+type TierNames interface {
+	Name(tierId uint64) (string, bool)
+}
+
+// Notifier sends a reminder when a linked patron's charge is declined, at most once per cooldown
+type Notifier struct {
+	config config.Config
+	logger *zap.Logger
+	db     *database.Database
+	bus    *events.Bus
+	tiers  TierNames
+	clock  clock.Clock
+}
+
+func NewNotifier(
+	config config.Config,
+	logger *zap.Logger,
+	db *database.Database,
+	bus *events.Bus,
+	tiers TierNames,
+	clk clock.Clock,
+) *Notifier {
+	return &Notifier{
+		config: config,
+		logger: logger,
+		db:     db,
+		bus:    bus,
+		tiers:  tiers,
+		clock:  clk,
+	}
+}
+
+func (n *Notifier) Enabled() bool {
+	return n.config.DeclineReminders.Enabled
+}
+
+// Run sends reminders for the decline events published to the bus until the context is cancelled
+func (n *Notifier) Run(ctx context.Context) {
+	if !n.Enabled() {
+		n.logger.Info("Decline reminders are disabled")
+		return
+	}
+
+	patronEvents := n.bus.Subscribe(eventBuffer)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-patronEvents:
+			if event.Type != events.TypeDecline {
+				continue
+			}
+
+			if err := n.Remind(ctx, event); err != nil {
+				n.logger.Warn("Failed to send decline reminder", zap.Uint64("patron_id", event.PatronId), zap.Error(err))
+			}
+		}
+	}
+}
+
+// Remind DMs the patron about the declined charge, unless their Discord account isn't linked, or they were already
+// reminded within the cooldown
+func (n *Notifier) Remind(ctx context.Context, event events.Event) error {
+	if event.DiscordId == nil {
+		n.logger.Debug("Patron is not linked, not sending decline reminder", zap.Uint64("patron_id", event.PatronId))
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*30)
+	defer cancel()
+
+	now := n.clock.Now()
+	cooldown := time.Duration(n.config.DeclineReminders.CooldownDays) * 24 * time.Hour
+
+	lastSent, ok, err := n.db.DeclineReminders.LastSent(ctx, event.PatronId)
+	if err != nil {
+		return errors.Wrap(err, "failed to fetch last reminder")
+	}
+
+	if ok && now.Before(lastSent.Add(cooldown)) {
+		n.logger.Debug("Patron was reminded recently, not sending decline reminder",
+			zap.Uint64("patron_id", event.PatronId), zap.Time("last_sent", lastSent))
+		return nil
+	}
+
+	// Patrons who don't share a server with the bot, or have closed their DMs, can't be reminded
+	channel, err := rest.CreateDM(ctx, n.config.Discord.BotToken, nil, *event.DiscordId)
+	if err != nil {
+		return errors.Wrap(err, "failed to open DM channel")
+	}
+
+	if _, err := rest.CreateMessage(ctx, n.config.Discord.BotToken, nil, channel.Id, rest.CreateMessageData{
+		Content: n.message(event),
+	}); err != nil {
+		return errors.Wrap(err, "failed to send message")
+	}
+
+	if err := n.db.DeclineReminders.Record(ctx, event.PatronId, now); err != nil {
+		return errors.Wrap(err, "failed to record reminder")
+	}
+
+	n.logger.Info("Sent decline reminder", zap.Uint64("patron_id", event.PatronId), zap.Uint64("discord_id", *event.DiscordId))
+	return nil
+}
+
+// message fills in the configured message template for the event
+func (n *Notifier) message(event events.Event) string {
+	tierNames := make([]string, len(event.Tiers))
+	for i, tierId := range event.Tiers {
+		if name, ok := n.tiers.Name(tierId); ok {
+			tierNames[i] = name
+		} else {
+			tierNames[i] = strconv.FormatUint(tierId, 10)
+		}
+	}
+
+	tiers := "no tiers"
+	if len(tierNames) > 0 {
+		tiers = strings.Join(tierNames, ", ")
+	}
+
+	return strings.NewReplacer(
+		"{tiers}", tiers,
+		"{amount}", currency.Format(event.AmountCents, event.CurrencyOr(n.config.Revenue.Currency)),
+		"{email}", privacy.Masked(event.Email),
+	).Replace(n.config.DeclineReminders.Message)
+}
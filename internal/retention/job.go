@@ -0,0 +1,93 @@
+package retention
+
+import (
+	"context"
+	"time"
+
+	"github.com/TicketsBot/subscriptions-app/internal/clock"
+	"github.com/TicketsBot/subscriptions-app/internal/config"
+	"github.com/TicketsBot/subscriptions-app/internal/database"
+	"github.com/TicketsBot/subscriptions-app/internal/metrics"
+	"go.uber.org/zap"
+)
+
+// Job periodically deletes rows older than the configured retention window
+type Job struct {
+	config config.Config
+	logger *zap.Logger
+	clock  clock.Clock
+	tables map[string]database.Prunable
+}
+
+func NewJob(config config.Config, logger *zap.Logger, clk clock.Clock, tables map[string]database.Prunable) *Job {
+	return &Job{
+		config: config,
+		logger: logger,
+		clock:  clk,
+		tables: tables,
+	}
+}
+
+func (j *Job) Enabled() bool {
+	return j.config.Retention.Days > 0
+}
+
+func (j *Job) Run(ctx context.Context) {
+	if !j.Enabled() {
+		j.logger.Info("Data retention window not configured, pruning is disabled")
+		return
+	}
+
+	interval := time.Duration(j.config.Retention.IntervalHours) * time.Hour
+	if interval <= 0 {
+		interval = time.Hour * 24
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		j.Prune(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Prune deletes rows older than the retention window from every registered table
+func (j *Job) Prune(ctx context.Context) {
+	before := j.clock.Now().Add(-time.Duration(j.config.Retention.Days) * time.Hour * 24)
+
+	var total int64
+	var failed []string
+	for name, table := range j.tables {
+		pruneCtx, cancel := context.WithTimeout(ctx, time.Minute*5)
+		count, err := table.Prune(pruneCtx, before)
+		cancel()
+
+		if err != nil {
+			j.logger.Error("Failed to prune table", zap.String("table", name), zap.Error(err))
+			failed = append(failed, name)
+			metrics.RetentionFailures.WithLabelValues(name).Inc()
+			continue
+		}
+
+		total += count
+		metrics.RetentionRowsDeleted.WithLabelValues(name).Add(float64(count))
+		j.logger.Info(
+			"Pruned table",
+			zap.String("table", name),
+			zap.Int64("rows_deleted", count),
+			zap.Time("before", before),
+		)
+	}
+
+	j.logger.Info(
+		"Retention run complete",
+		zap.Int64("rows_deleted", total),
+		zap.Strings("failed_tables", failed),
+	)
+}
@@ -0,0 +1,248 @@
+// Package roles grants the Discord role of each tier to its patrons, and removes it once they have been without the
+// tier for a grace window, so that a temporary payment failure doesn't revoke it
+package roles
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/TicketsBot-cloud/gdl/rest"
+	"github.com/TicketsBot-cloud/gdl/rest/request"
+	"github.com/TicketsBot/subscriptions-app/internal/clock"
+	"github.com/TicketsBot/subscriptions-app/internal/config"
+	"github.com/TicketsBot/subscriptions-app/internal/database"
+	"github.com/TicketsBot/subscriptions-app/internal/entitlements"
+	"github.com/TicketsBot/subscriptions-app/internal/events"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// eventBuffer is the number of events that can wait while roles are being updated
+const eventBuffer = 1000
+
+// TierRegistry provides the role of each tier
+type TierRegistry interface {
+	Tier(tierId uint64) (config.Tier, bool)
+}
+
+// EntitlementSource is checked before a role is removed, in case the member is still entitled to it, for example
+// through another source
+type EntitlementSource interface {
+	Loaded() bool
+	ByDiscordId(ctx context.Context, discordId uint64) ([]entitlements.Entitlement, error)
+}
+
+// Manager grants tier roles as patron events are published, and periodically runs the removals that are due
+type Manager struct {
+	config       config.Config
+	logger       *zap.Logger
+	db           *database.Database
+	bus          *events.Bus
+	tiers        TierRegistry
+	entitlements EntitlementSource
+	clock        clock.Clock
+}
+
+func NewManager(
+	config config.Config,
+	logger *zap.Logger,
+	db *database.Database,
+	bus *events.Bus,
+	tiers TierRegistry,
+	entitlements EntitlementSource,
+	clk clock.Clock,
+) *Manager {
+	return &Manager{
+		config:       config,
+		logger:       logger,
+		db:           db,
+		bus:          bus,
+		tiers:        tiers,
+		entitlements: entitlements,
+		clock:        clk,
+	}
+}
+
+func (m *Manager) Enabled() bool {
+	return m.config.Roles.GuildId != 0
+}
+
+// Run applies the role changes of the events published to the bus, and runs the removals that are due every interval,
+// until the context is cancelled
+func (m *Manager) Run(ctx context.Context) {
+	if !m.Enabled() {
+		m.logger.Info("Roles guild not configured, tier roles are not managed")
+		return
+	}
+
+	patronEvents := m.bus.Subscribe(eventBuffer)
+	interval := time.Duration(m.config.Roles.IntervalMinutes) * time.Minute
+
+	// Removals that became due while the process was not running are run shortly after starting, giving the first sync
+	// time to load. The timer isn't restarted by events, so that a busy bus doesn't delay removals.
+	next := m.clock.After(time.Minute)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-patronEvents:
+			m.Apply(ctx, event)
+		case <-next:
+			m.RemoveDue(ctx)
+			next = m.clock.After(interval)
+		}
+	}
+}
+
+// Apply grants the roles of the tiers the patron gained, cancelling any pending removal of them, and schedules the
+// removal of the roles of the tiers they lost. Patrons who haven't linked their Discord account are skipped.
+func (m *Manager) Apply(ctx context.Context, event events.Event) {
+	if event.DiscordId == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	discordId := *event.DiscordId
+	gained, lost := m.roleChanges(event.PreviousTiers, event.Tiers)
+	logger := m.logger.With(zap.Uint64("patron_id", event.PatronId), zap.Uint64("discord_id", discordId))
+
+	for _, roleId := range gained {
+		logger := logger.With(zap.Uint64("role_id", roleId))
+
+		if cancelled, err := m.db.RoleRemovals.Cancel(ctx, discordId, roleId); err != nil {
+			logger.Error("Failed to cancel role removal", zap.Error(err))
+		} else if cancelled {
+			logger.Info("Cancelled role removal, as the tier was regained")
+		}
+
+		if err := rest.AddGuildMemberRole(ctx, m.config.Discord.BotToken, nil, m.config.Roles.GuildId, discordId, roleId); err != nil {
+			logger.Warn("Failed to grant tier role", zap.Error(err))
+			continue
+		}
+
+		logger.Info("Granted tier role")
+	}
+
+	now := m.clock.Now()
+	removeAfter := now.Add(time.Duration(m.config.Roles.RemovalGraceHours) * time.Hour)
+	for _, roleId := range lost {
+		logger := logger.With(zap.Uint64("role_id", roleId))
+
+		if err := m.db.RoleRemovals.Schedule(ctx, database.RoleRemoval{
+			DiscordId:   discordId,
+			RoleId:      roleId,
+			PatronId:    event.PatronId,
+			ScheduledAt: now,
+			RemoveAfter: removeAfter,
+		}); err != nil {
+			logger.Error("Failed to schedule role removal", zap.Error(err))
+			continue
+		}
+
+		logger.Info("Scheduled role removal", zap.Time("remove_after", removeAfter))
+	}
+}
+
+// roleChanges returns the roles of the current tiers that the previous tiers didn't grant, and the reverse
+func (m *Manager) roleChanges(previousTiers, currentTiers []uint64) (gained, lost []uint64) {
+	previous, current := m.roles(previousTiers), m.roles(currentTiers)
+
+	for roleId := range current {
+		if _, ok := previous[roleId]; !ok {
+			gained = append(gained, roleId)
+		}
+	}
+
+	for roleId := range previous {
+		if _, ok := current[roleId]; !ok {
+			lost = append(lost, roleId)
+		}
+	}
+
+	return gained, lost
+}
+
+func (m *Manager) roles(tierIds []uint64) map[uint64]struct{} {
+	roles := make(map[uint64]struct{})
+	for _, tierId := range tierIds {
+		if tier, ok := m.tiers.Tier(tierId); ok && tier.RoleId != 0 {
+			roles[tier.RoleId] = struct{}{}
+		}
+	}
+
+	return roles
+}
+
+// RemoveDue removes the roles whose grace window has ended. Members who are entitled to the role again, such as
+// through a manual subscription, keep it. Removals that fail are retried on the next run.
+func (m *Manager) RemoveDue(ctx context.Context) {
+	// Before the first sync, every patron would appear not to be entitled
+	if !m.entitlements.Loaded() {
+		m.logger.Debug("Entitlements not loaded yet, not removing roles")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute*5)
+	defer cancel()
+
+	removals, err := m.db.RoleRemovals.Due(ctx, m.clock.Now())
+	if err != nil {
+		m.logger.Error("Failed to fetch due role removals", zap.Error(err))
+		return
+	}
+
+	for _, removal := range removals {
+		logger := m.logger.With(
+			zap.Uint64("patron_id", removal.PatronId),
+			zap.Uint64("discord_id", removal.DiscordId),
+			zap.Uint64("role_id", removal.RoleId),
+		)
+
+		entitled, err := m.entitledTo(ctx, removal.DiscordId, removal.RoleId)
+		if err != nil {
+			logger.Warn("Failed to check entitlements before removing role, retrying on the next run", zap.Error(err))
+			continue
+		}
+
+		action := "role_removed"
+		if entitled {
+			action = "role_removal_cancelled"
+		} else if err := rest.RemoveGuildMemberRole(ctx, m.config.Discord.BotToken, nil, m.config.Roles.GuildId, removal.DiscordId, removal.RoleId); err != nil && !isUnknownMember(err) {
+			logger.Warn("Failed to remove tier role, retrying on the next run", zap.Error(err))
+			continue
+		}
+
+		if err := m.db.RoleRemovals.Complete(ctx, removal, action); err != nil {
+			logger.Error("Failed to complete role removal", zap.Error(err))
+			continue
+		}
+
+		if entitled {
+			logger.Info("Kept tier role, as the member is entitled to it again")
+		} else {
+			logger.Info("Removed tier role after grace window", zap.Time("scheduled_at", removal.ScheduledAt))
+		}
+	}
+}
+
+// entitledTo returns whether any active entitlement of the member grants the role. Errors from any source are
+// returned, as the member may be entitled through that source.
+func (m *Manager) entitledTo(ctx context.Context, discordId, roleId uint64) (bool, error) {
+	found, err := m.entitlements.ByDiscordId(ctx, discordId)
+	for _, entitlement := range found {
+		if entitlement.Active && entitlement.RoleId == roleId {
+			return true, nil
+		}
+	}
+
+	return false, err
+}
+
+// isUnknownMember returns whether the request failed because the member has left the guild, so has no role to remove
+func isUnknownMember(err error) bool {
+	var restErr request.RestError
+	return errors.As(err, &restErr) && restErr.StatusCode == http.StatusNotFound
+}
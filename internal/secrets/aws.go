@@ -0,0 +1,66 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/pkg/errors"
+)
+
+// awsResolver reads secrets from AWS Secrets Manager, using the default credential chain. If a key is given, the secret
+// is parsed as a JSON object and the key's value is used, otherwise the whole secret string is used.
+type awsResolver struct {
+	client *secretsmanager.Client
+	cache  map[string]string
+}
+
+func newAwsResolver(ctx context.Context) (Resolver, error) {
+	cfg, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &awsResolver{
+		client: secretsmanager.NewFromConfig(cfg),
+		cache:  make(map[string]string),
+	}, nil
+}
+
+func (r *awsResolver) Resolve(ctx context.Context, path, key string) (string, error) {
+	// Several values are usually stored in the same secret, so only fetch it once
+	secret, ok := r.cache[path]
+	if !ok {
+		res, err := r.client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+			SecretId: aws.String(path),
+		})
+		if err != nil {
+			return "", err
+		}
+
+		if res.SecretString == nil {
+			return "", errors.Errorf("secret %s has no string value", path)
+		}
+
+		secret = *res.SecretString
+		r.cache[path] = secret
+	}
+
+	if key == "" {
+		return secret, nil
+	}
+
+	var values map[string]any
+	if err := json.Unmarshal([]byte(secret), &values); err != nil {
+		return "", errors.Wrapf(err, "secret %s is not a JSON object", path)
+	}
+
+	value, ok := values[key].(string)
+	if !ok {
+		return "", missingKey(path, key)
+	}
+
+	return value, nil
+}
@@ -0,0 +1,93 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/TicketsBot/subscriptions-app/internal/config"
+	"github.com/pkg/errors"
+)
+
+// Resolver fetches a secret from a backend. The reference is the part of the config value after the scheme, in the
+// format <path>#<key>, where the key is optional for backends that store plain strings.
+type Resolver interface {
+	Resolve(ctx context.Context, path, key string) (string, error)
+}
+
+// Resolvers are created on first use, so that backends that are not referenced by the config are never contacted
+var resolverFactories = map[string]func(ctx context.Context) (Resolver, error){
+	"vault": newVaultResolver,
+	"awssm": newAwsResolver,
+}
+
+// ResolveConfig replaces config values in the format <scheme>://<path>#<key>, such as
+// vault://secret/data/subscriptions#database_password, with the secret fetched from the backend. Other values are left
+// unchanged.
+func ResolveConfig(ctx context.Context, conf *config.Config) error {
+	resolvers := make(map[string]Resolver)
+
+	fields := []*string{
+		&conf.Database.Password,
+		&conf.Discord.PublicKey,
+		&conf.Discord.BotToken,
+		&conf.Patreon.ClientSecret,
+		&conf.Paddle.WebhookSecret,
+		&conf.Paddle.ApiKey,
+		&conf.LemonSqueezy.WebhookSecret,
+		&conf.LemonSqueezy.ApiKey,
+		&conf.MetricsToken,
+		&conf.Alerting.WebhookUrl,
+		&conf.Revenue.RatesUrl, // Rates APIs usually take their key in the query string
+		&conf.Reconciliation.BotApiKey,
+		&conf.LogRedaction.Key,
+		&conf.Privacy.EmailSalt,
+		&conf.Bridge.DatabaseUrl,
+		&conf.Broadcast.RedisPassword,
+		&conf.EventStream.Password,
+		&conf.LinkPage.DiscordClientSecret,
+		&conf.LinkPage.SessionSecret,
+		&conf.Whitelabel.ApiKey,
+	}
+
+	for i := range conf.ApiKeys {
+		fields = append(fields, &conf.ApiKeys[i])
+	}
+
+	for _, field := range fields {
+		scheme, ref, ok := strings.Cut(*field, "://")
+		if !ok {
+			continue
+		}
+
+		factory, ok := resolverFactories[scheme]
+		if !ok {
+			continue // e.g. a URL
+		}
+
+		resolver, ok := resolvers[scheme]
+		if !ok {
+			var err error
+			if resolver, err = factory(ctx); err != nil {
+				return errors.Wrapf(err, "failed to create %s secret resolver", scheme)
+			}
+
+			resolvers[scheme] = resolver
+		}
+
+		path, key, _ := strings.Cut(ref, "#")
+
+		value, err := resolver.Resolve(ctx, path, key)
+		if err != nil {
+			return errors.Wrapf(err, "failed to resolve secret %s", *field)
+		}
+
+		*field = value
+	}
+
+	return nil
+}
+
+func missingKey(path, key string) error {
+	return fmt.Errorf("secret %s has no key %s", path, key)
+}
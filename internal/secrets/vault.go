@@ -0,0 +1,52 @@
+package secrets
+
+import (
+	"context"
+
+	vault "github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+)
+
+// vaultResolver reads secrets from Vault. The address and token are read from the standard VAULT_ADDR and VAULT_TOKEN
+// environment variables. Both KV v1 and v2 paths are supported, e.g. secret/data/subscriptions for KV v2.
+type vaultResolver struct {
+	client *vault.Client
+}
+
+func newVaultResolver(context.Context) (Resolver, error) {
+	client, err := vault.NewClient(vault.DefaultConfig())
+	if err != nil {
+		return nil, err
+	}
+
+	return &vaultResolver{client: client}, nil
+}
+
+func (r *vaultResolver) Resolve(ctx context.Context, path, key string) (string, error) {
+	if key == "" {
+		return "", errors.New("vault secrets require a key")
+	}
+
+	secret, err := r.client.Logical().ReadWithContext(ctx, path)
+	if err != nil {
+		return "", err
+	}
+
+	if secret == nil || secret.Data == nil {
+		return "", errors.Errorf("secret %s not found", path)
+	}
+
+	data := secret.Data
+
+	// KV v2 nests the secret's values under "data"
+	if nested, ok := data["data"].(map[string]any); ok {
+		data = nested
+	}
+
+	value, ok := data[key].(string)
+	if !ok {
+		return "", missingKey(path, key)
+	}
+
+	return value, nil
+}
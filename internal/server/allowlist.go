@@ -0,0 +1,125 @@
+package server
+
+import (
+	"net/netip"
+	"strings"
+
+	"github.com/TicketsBot/subscriptions-app/internal/config"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// networks are the network settings of a config, parsed once when the config is loaded rather than on each request
+type networks struct {
+	interactionAllowlist []netip.Prefix
+	apiAllowlist         []netip.Prefix
+	trustedProxies       []netip.Prefix
+	err                  error // Set if any setting is invalid, which validation on load prevents
+}
+
+func parseNetworks(conf config.Config) *networks {
+	var n networks
+	var errs [3]error
+	n.interactionAllowlist, errs[0] = config.ParseNetworks(conf.Network.InteractionAllowlist)
+	n.apiAllowlist, errs[1] = config.ParseNetworks(conf.Network.ApiAllowlist)
+	n.trustedProxies, errs[2] = config.ParseNetworks(conf.Network.TrustedProxies)
+
+	for _, err := range errs {
+		if err != nil {
+			n.err = err
+			break
+		}
+	}
+
+	return &n
+}
+
+// AllowNetworks rejects requests from clients outside the networks that allowlist selects from the current config, so
+// that the allowlist can be changed by reloading the config. Every client is allowed if the allowlist is empty.
+func (s *Server) AllowNetworks(allowlist func(*networks) []netip.Prefix) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		current := s.currentNetworks()
+		if current.err != nil {
+			_ = ctx.AbortWithError(500, current.err)
+			return
+		}
+
+		allowed := allowlist(current)
+		if len(allowed) == 0 {
+			ctx.Next()
+			return
+		}
+
+		// ClientIP is resolved by ResolveClientIp, which only reads X-Forwarded-For if the request came from a trusted proxy
+		clientIp, err := netip.ParseAddr(ctx.ClientIP())
+		if err == nil {
+			clientIp = clientIp.Unmap()
+			for _, network := range allowed {
+				if network.Contains(clientIp) {
+					ctx.Next()
+					return
+				}
+			}
+		}
+
+		s.loggerFor(ctx.Request.Context()).Warn("Rejected request from client outside allowlist",
+			zap.String("client_ip", ctx.ClientIP()), zap.String("path", ctx.FullPath()))
+		ctx.AbortWithStatusJSON(403, errorJson("Forbidden"))
+	}
+}
+
+func interactionAllowlist(n *networks) []netip.Prefix {
+	return n.interactionAllowlist
+}
+
+func apiAllowlist(n *networks) []netip.Prefix {
+	return n.apiAllowlist
+}
+
+// clientIpHeader is the header that ResolveClientIp stores the client IP in, which the router is set to read as its
+// trusted platform header, so that ClientIP returns it everywhere, including in request logs
+const clientIpHeader = "X-Resolved-Client-Ip"
+
+// ResolveClientIp stores the client IP in clientIpHeader, replacing any value sent by the client. X-Forwarded-For is
+// only read if the request came from one of the current trusted proxies, which can be changed by reloading the config.
+// Gin's own trusted proxies are set once when the router is built, so are left empty.
+func (s *Server) ResolveClientIp(ctx *gin.Context) {
+	clientIp := resolveClientIp(ctx.RemoteIP(), ctx.GetHeader("X-Forwarded-For"), s.currentNetworks().trustedProxies)
+	ctx.Request.Header.Set(clientIpHeader, clientIp)
+	ctx.Next()
+}
+
+// resolveClientIp returns the remote IP, unless it is a trusted proxy, in which case X-Forwarded-For is read from the
+// right, returning the first address that isn't a trusted proxy, or the leftmost. As gin does, the remote IP is
+// returned if the header is missing or holds an invalid address.
+func resolveClientIp(remoteIp, forwardedFor string, trustedProxies []netip.Prefix) string {
+	remote, err := netip.ParseAddr(remoteIp)
+	if err != nil || forwardedFor == "" || !isTrustedProxy(remote, trustedProxies) {
+		return remoteIp
+	}
+
+	addrs := strings.Split(forwardedFor, ",")
+	for i := len(addrs) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(addrs[i]))
+		if err != nil {
+			return remoteIp
+		}
+
+		if i == 0 || !isTrustedProxy(addr, trustedProxies) {
+			return addr.String()
+		}
+	}
+
+	return remoteIp
+}
+
+func isTrustedProxy(addr netip.Addr, trustedProxies []netip.Prefix) bool {
+	addr = addr.Unmap()
+	for _, network := range trustedProxies {
+		if network.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
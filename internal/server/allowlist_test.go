@@ -0,0 +1,63 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAllowlistReload(t *testing.T) {
+	s := newTestServer(t, "")
+
+	conf := s.currentConfig()
+	conf.Network.InteractionAllowlist = []string{"203.0.113.0/24"}
+	s.UpdateConfig(conf)
+
+	router := s.Router()
+
+	// Requests inside the allowlist are passed on, and rejected for their missing signature instead
+	status := func(forwardedFor string, header http.Header) int {
+		t.Helper()
+
+		req := httptest.NewRequest(http.MethodPost, "/interaction", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header = header
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		return res.Code
+	}
+
+	if code := status("203.0.113.5", http.Header{}); code != http.StatusForbidden {
+		t.Errorf("expected X-Forwarded-For to be ignored from an untrusted proxy, got status %d", code)
+	}
+
+	if code := status("203.0.113.5", http.Header{clientIpHeader: {"203.0.113.5"}}); code != http.StatusForbidden {
+		t.Errorf("expected the resolved client IP header to be ignored from clients, got status %d", code)
+	}
+
+	// Trusted proxies apply to the router already built
+	conf.Network.TrustedProxies = []string{"10.0.0.0/8"}
+	s.UpdateConfig(conf)
+
+	if code := status("203.0.113.5, 10.0.0.2", http.Header{}); code != http.StatusUnauthorized {
+		t.Errorf("expected the client behind trusted proxies to be allowed, got status %d", code)
+	}
+
+	if code := status("198.51.100.1, 203.0.113.5", http.Header{}); code != http.StatusUnauthorized {
+		t.Errorf("expected the rightmost untrusted address to be the client, got status %d", code)
+	}
+
+	if code := status("203.0.113.5, 198.51.100.1", http.Header{}); code != http.StatusForbidden {
+		t.Errorf("expected addresses added by the client to be ignored, got status %d", code)
+	}
+
+	// A reloaded allowlist applies straight away
+	conf.Network.InteractionAllowlist = []string{"198.51.100.0/24"}
+	s.UpdateConfig(conf)
+
+	if code := status("203.0.113.5", http.Header{}); code != http.StatusForbidden {
+		t.Errorf("expected the client to be outside the reloaded allowlist, got status %d", code)
+	}
+}
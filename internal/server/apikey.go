@@ -0,0 +1,78 @@
+package server
+
+import (
+	"crypto/subtle"
+	"strings"
+	"time"
+
+	"github.com/TicketsBot/subscriptions-app/internal/config"
+	"github.com/TicketsBot/subscriptions-app/internal/servicetoken"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// serviceTokenSubjectKey is the context key holding the subject of the service token that authenticated the request
+const serviceTokenSubjectKey = "service_token_subject"
+
+// AuthenticateApiKey checks for a bearer token matching one of the configured API keys, or a service token signed by
+// one of the configured public keys
+func (s *Server) AuthenticateApiKey(ctx *gin.Context) {
+	key, ok := strings.CutPrefix(ctx.GetHeader("Authorization"), "Bearer ")
+	if !ok || key == "" {
+		ctx.AbortWithStatusJSON(401, errorJson("Missing API key"))
+		return
+	}
+
+	conf := s.currentConfig()
+	if len(conf.ServiceTokens.PublicKeys) > 0 && servicetoken.LooksLikeToken(key) {
+		s.authenticateServiceToken(ctx, key)
+		return
+	}
+
+	for _, allowed := range conf.ApiKeys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(allowed)) == 1 {
+			ctx.Set(apiKeyPermissionsKey, s.apiKeyPermissions(allowed))
+			ctx.Next()
+			return
+		}
+	}
+
+	ctx.AbortWithStatusJSON(401, errorJson("Invalid API key"))
+}
+
+// authenticateServiceToken verifies a service token, granting the request the permissions in its claims
+func (s *Server) authenticateServiceToken(ctx *gin.Context, token string) {
+	verifier := s.serviceTokenVerifier()
+	if verifier == nil {
+		_ = ctx.AbortWithError(500, errors.New("Service token public keys are invalid"))
+		return
+	}
+
+	claims, err := verifier.Verify(token, time.Now())
+	if err != nil {
+		s.loggerFor(ctx.Request.Context()).Warn("Rejected service token", zap.Error(err))
+		ctx.AbortWithStatusJSON(401, errorJson("Invalid service token"))
+		return
+	}
+
+	ctx.Set(apiKeyPermissionsKey, claims.Permissions)
+	ctx.Set(serviceTokenSubjectKey, claims.Subject)
+	ctx.Next()
+}
+
+// newServiceTokenVerifier builds the verifier for the configured public keys once, when the config is loaded, rather
+// than on every request. The keys are checked when the config is validated, so it is only nil if validation was skipped.
+func newServiceTokenVerifier(conf config.Config, logger *zap.Logger) *servicetoken.Verifier {
+	if len(conf.ServiceTokens.PublicKeys) == 0 {
+		return nil
+	}
+
+	verifier, err := servicetoken.NewVerifier(conf)
+	if err != nil {
+		logger.Error("Failed to load service token public keys", zap.Error(err))
+		return nil
+	}
+
+	return verifier
+}
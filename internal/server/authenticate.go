@@ -6,9 +6,15 @@ import (
 	"encoding/hex"
 	"github.com/gin-gonic/gin"
 	"github.com/pkg/errors"
+	"go.uber.org/zap"
 	"io/ioutil"
+	"strconv"
+	"sync"
+	"time"
 )
 
+// Authenticate verifies the signature of a request from Discord. If a max age is configured, requests signed outside
+// that window are rejected, as are signatures that were already seen if replays are rejected.
 func (s *Server) Authenticate(ctx *gin.Context) {
 	signature := ctx.GetHeader("X-Signature-Ed25519")
 	if signature == "" {
@@ -32,7 +38,7 @@ func (s *Server) Authenticate(ctx *gin.Context) {
 	ctx.Request.Body = ioutil.NopCloser(bytes.NewBuffer(body))
 
 	// Verify signature
-	pubKey, err := hex.DecodeString(s.config.Discord.PublicKey)
+	pubKey, err := hex.DecodeString(s.currentConfig().Discord.PublicKey)
 	if err != nil {
 		_ = ctx.AbortWithError(500, errors.Wrap(err, "Failed to decode public key"))
 		return
@@ -50,5 +56,71 @@ func (s *Server) Authenticate(ctx *gin.Context) {
 		return
 	}
 
+	// Checked after the signature, so that only requests signed by Discord are recorded as seen
+	conf := s.currentConfig().Discord
+	if conf.SignatureMaxAgeSeconds > 0 {
+		maxAge := time.Duration(conf.SignatureMaxAgeSeconds) * time.Second
+
+		signedAt, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			ctx.AbortWithStatusJSON(401, errorJson("Invalid signature timestamp"))
+			return
+		}
+
+		now := time.Now()
+		if age := now.Sub(time.Unix(signedAt, 0)); age > maxAge || age < -maxAge {
+			s.loggerFor(ctx.Request.Context()).Warn("Rejected request with expired signature timestamp", zap.Duration("age", age))
+			ctx.AbortWithStatusJSON(401, errorJson("Signature timestamp is outside the allowed window"))
+			return
+		}
+
+		// A signature is only valid until its timestamp leaves the window, so it only needs to be remembered until then.
+		// It is remembered by its bytes, as the header's hex can be re-cased without invalidating it.
+		if conf.RejectReplays && !s.seenSignatures.add(hex.EncodeToString(signatureDecoded), time.Unix(signedAt, 0).Add(maxAge), now) {
+			s.loggerFor(ctx.Request.Context()).Warn("Rejected replayed request")
+			ctx.AbortWithStatusJSON(401, errorJson("Signature has already been used"))
+			return
+		}
+	}
+
 	ctx.Next()
 }
+
+// signatureCache holds the signatures of recent requests until they expire, to detect replays
+type signatureCache struct {
+	expiries  map[string]time.Time
+	lastPrune time.Time
+	mu        sync.Mutex
+}
+
+// signaturePruneInterval is how often expired signatures are removed from the cache
+const signaturePruneInterval = time.Minute
+
+func newSignatureCache() *signatureCache {
+	return &signatureCache{
+		expiries: make(map[string]time.Time),
+	}
+}
+
+// add records the signature until it expires, returning false if it was already recorded and has not expired
+func (c *signatureCache) add(signature string, expiresAt, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now.Sub(c.lastPrune) >= signaturePruneInterval {
+		for seen, expiry := range c.expiries {
+			if !now.Before(expiry) {
+				delete(c.expiries, seen)
+			}
+		}
+
+		c.lastPrune = now
+	}
+
+	if expiry, ok := c.expiries[signature]; ok && now.Before(expiry) {
+		return false
+	}
+
+	c.expiries[signature] = expiresAt
+	return true
+}
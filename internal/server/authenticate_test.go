@@ -0,0 +1,47 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/TicketsBot/subscriptions-app/internal/server/interactiontest"
+)
+
+func TestAuthenticateRejectsReplays(t *testing.T) {
+	harness := interactiontest.New()
+	s := newTestServer(t, harness.PublicKey)
+
+	conf := s.currentConfig()
+	conf.Discord.SignatureMaxAgeSeconds = 300
+	conf.Discord.RejectReplays = true
+	s.UpdateConfig(conf)
+
+	harness.Handler = s.Router()
+
+	tests := []struct {
+		name   string
+		replay func(signature string) string
+	}{
+		{"same signature", func(signature string) string { return signature }},
+		{"upper case signature", strings.ToUpper},
+		{"mixed case signature", func(signature string) string {
+			return strings.ToUpper(signature[:len(signature)/2]) + signature[len(signature)/2:]
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body := harness.Encode(interactiontest.Ping())
+			timestamp, signature := harness.Sign(body)
+
+			if res := harness.SendSigned(body, timestamp, signature); res.Code != http.StatusOK {
+				t.Fatalf("expected first request to succeed, got %d: %s", res.Code, res.Body.String())
+			}
+
+			if res := harness.SendSigned(body, timestamp, test.replay(signature)); res.Code != http.StatusUnauthorized {
+				t.Errorf("expected replay to be rejected, got %d: %s", res.Code, res.Body.String())
+			}
+		})
+	}
+}
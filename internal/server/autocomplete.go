@@ -0,0 +1,102 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/TicketsBot-cloud/gdl/objects/interaction"
+)
+
+type autocompleteHandler func(s *Server, focused interaction.ApplicationCommandInteractionDataOption) []interaction.ApplicationCommandOptionChoice
+
+// maxAutocompleteChoices is the number of choices that Discord shows
+const maxAutocompleteChoices = 25
+
+// handleAutocomplete suggests values for the option being typed. Those who can't run the command get no suggestions, as
+// they would otherwise reveal the usernames of patrons.
+func handleAutocomplete(
+	ctx context.Context,
+	s *Server,
+	data interaction.ApplicationCommandAutoCompleteInteraction,
+) interaction.ApplicationCommandAutoCompleteResultResponse {
+	path, options := commandPath(&interaction.ApplicationCommandInteractionData{
+		Name:    data.Data.Name,
+		Options: data.Data.Options,
+	})
+
+	setSentryTag(ctx, "command", path)
+
+	noChoices := interaction.NewApplicationCommandAutoCompleteResultResponse([]interaction.ApplicationCommandOptionChoice{})
+
+	command, ok := commandsByPath[path]
+	if !ok {
+		return noChoices
+	}
+
+	if !s.isAllowedGuild(data.GuildId.Value) && !(command.userInstall && s.isTrustedUser(invokingUser(data.InteractionMetadata).Id)) {
+		return noChoices
+	}
+
+	if command.permission != "" && !s.memberPermissions(data.InteractionMetadata).Has(command.permission) {
+		return noChoices
+	}
+
+	if !s.guildSettings.Get(data.GuildId.Value).CommandEnabled(path) {
+		return noChoices
+	}
+
+	for _, option := range options {
+		if !option.Focused {
+			continue
+		}
+
+		handler, ok := command.autocomplete[option.Name]
+		if !ok {
+			return noChoices
+		}
+
+		return interaction.NewApplicationCommandAutoCompleteResultResponse(handler(s, option))
+	}
+
+	return noChoices
+}
+
+// usernameChoices suggests the linked patrons whose username or Discord ID starts with what has been typed. The value
+// of each choice is the Discord ID, so that it is looked up as though the user option had been used.
+func usernameChoices(s *Server, focused interaction.ApplicationCommandInteractionDataOption) []interaction.ApplicationCommandOptionChoice {
+	query, _ := stringValue(focused)
+
+	choices := []interaction.ApplicationCommandOptionChoice{}
+	for _, match := range s.usernames.Search(query, maxAutocompleteChoices) {
+		choices = append(choices, interaction.ApplicationCommandOptionChoice{
+			Name:  fmt.Sprintf("%s (%d)", match.Username, match.DiscordId),
+			Value: strconv.FormatUint(match.DiscordId, 10),
+		})
+	}
+
+	return choices
+}
+
+// usernameOption converts a username option into the user option of the Discord account it names. Suggestions carry
+// the Discord ID, but a username typed in full without picking a suggestion is accepted too.
+func usernameOption(
+	s *Server,
+	option interaction.ApplicationCommandInteractionDataOption,
+) (interaction.ApplicationCommandInteractionDataOption, error) {
+	value, ok := stringValue(option)
+	if !ok {
+		return option, newCommandError(failureInvalidOption, "Username was wrong type")
+	}
+
+	if _, err := strconv.ParseUint(value, 10, 64); err == nil {
+		return interaction.ApplicationCommandInteractionDataOption{Name: "user", Value: value}, nil
+	}
+
+	discordId, ok := s.usernames.DiscordId(value)
+	if !ok {
+		return option, newCommandError(failureNotLinked, "No linked patron with username `%s` found", value)
+	}
+
+	return interaction.ApplicationCommandInteractionDataOption{Name: "user", Value: strconv.FormatUint(discordId, 10)}, nil
+}
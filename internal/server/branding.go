@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/TicketsBot-cloud/gdl/objects/channel/embed"
+)
+
+func (s *Server) primaryColor(ctx context.Context) int {
+	return s.embedStyle(ctx).PrimaryColor
+}
+
+func (s *Server) errorColor(ctx context.Context) int {
+	return s.embedStyle(ctx).ErrorColor
+}
+
+func (s *Server) patronUrl(patronId uint64) string {
+	return fmt.Sprintf(s.currentConfig().Branding.PatronUrl, patronId)
+}
+
+// embedStyle is the branding that embeds are built with. It is passed to the functions that build embeds, so that they
+// don't depend on the server and can be rendered from fixtures.
+type embedStyle struct {
+	PrimaryColor int
+	ErrorColor   int
+	PatronUrl    string // With %d replaced by the patron's Patreon user ID
+}
+
+// embedStyle returns the branding of the guild that the interaction was made in, which is the configured branding
+// unless the guild's settings override it
+func (s *Server) embedStyle(ctx context.Context) embedStyle {
+	branding := s.currentConfig().Branding
+	style := embedStyle{
+		PrimaryColor: int(branding.PrimaryColor),
+		ErrorColor:   int(branding.ErrorColor),
+		PatronUrl:    branding.PatronUrl,
+	}
+
+	settings := s.guildSettingsFor(ctx)
+	if settings.PrimaryColor != nil {
+		style.PrimaryColor = *settings.PrimaryColor
+	}
+
+	if settings.ErrorColor != nil {
+		style.ErrorColor = *settings.ErrorColor
+	}
+
+	return style
+}
+
+func (st embedStyle) patronUrl(patronId uint64) string {
+	return fmt.Sprintf(st.PatronUrl, patronId)
+}
+
+// applyFooter adds the configured footer, or the footer set in the guild's settings, to the embeds of a response.
+// Embeds that already have a footer, such as the error ID on error embeds, only gain the footer icon.
+func (s *Server) applyFooter(ctx context.Context, embeds []*embed.Embed) {
+	branding := s.currentConfig().Branding
+
+	footerText := branding.FooterText
+	if settings := s.guildSettingsFor(ctx); settings.FooterText != nil {
+		footerText = *settings.FooterText
+	}
+
+	if footerText == "" {
+		return
+	}
+
+	for _, e := range embeds {
+		if e.Footer == nil {
+			e.Footer = &embed.EmbedFooter{Text: footerText}
+		}
+
+		if e.Footer.IconUrl == "" {
+			e.Footer.IconUrl = branding.FooterIconUrl
+		}
+	}
+}
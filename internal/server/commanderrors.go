@@ -0,0 +1,146 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/TicketsBot-cloud/gdl/objects/channel/embed"
+	"github.com/TicketsBot-cloud/gdl/objects/channel/message"
+	"github.com/TicketsBot-cloud/gdl/objects/interaction"
+	"github.com/TicketsBot/subscriptions-app/internal/rbac"
+	"github.com/pkg/errors"
+)
+
+// failureKind classifies why a command failed, which decides the title of its error embed and what staff are told to do
+// about it
+type failureKind uint8
+
+const (
+	failureInvalidOption failureKind = iota
+	failureUnknownCommand
+	failureNotFound
+	failureNotLinked
+	failureDataStale
+	failurePatreonDown
+	failurePermissionDenied
+)
+
+var failureTitles = map[failureKind]string{
+	failureInvalidOption:    "Invalid Option",
+	failureUnknownCommand:   "Unknown Command",
+	failureNotFound:         "Account Not Found",
+	failureNotLinked:        "Discord Account Not Linked",
+	failureDataStale:        "Data Not Loaded",
+	failurePatreonDown:      "Patreon Sync Failing",
+	failurePermissionDenied: "Permission Denied",
+}
+
+var failureHints = map[failureKind]string{
+	failureInvalidOption:  "Check the value of the option and run the command again.",
+	failureUnknownCommand: "The command is registered with Discord, but not handled by this version of the app. Re-run `go run ./cmd/createcommands` to update the registered commands.",
+	failureNotFound: "Check the value for typos, or look the patron up by another option. Patrons whose pledge ended more " +
+		"than `PATREON_FORMER_PATRON_DAYS` ago are no longer found.",
+	failureNotLinked: "The user may not have linked their Discord account on Patreon, or with `/link`. Look them up by " +
+		"email or patron ID instead.",
+	failureDataStale: "The first Patreon sync hasn't finished yet. Follow its progress with `/subscription sync`, and try " +
+		"again once it has.",
+	failurePatreonDown: "Syncs with Patreon are failing, so patrons who pledged since the last successful sync are " +
+		"missing. Check the error with `/subscription sync`, and try again once syncs recover.",
+	failurePermissionDenied: "Ask an admin for one of the roles in `RBAC_ROLES`, or for the Manage Server permission if " +
+		"no roles are set.",
+}
+
+// commandError is a failure that staff can act on. Lookups return it, rather than a message, so that the response can
+// describe the failure and suggest what to do next.
+type commandError struct {
+	kind    failureKind
+	message string
+	hint    string // Replaces the hint of the kind, if set
+}
+
+func newCommandError(kind failureKind, format string, args ...any) *commandError {
+	return &commandError{
+		kind:    kind,
+		message: fmt.Sprintf(format, args...),
+	}
+}
+
+func (e *commandError) Error() string {
+	return e.message
+}
+
+// withHint returns a copy of the error with a different hint
+func (e *commandError) withHint(hint string) *commandError {
+	copied := *e
+	copied.hint = hint
+	return &copied
+}
+
+func (e *commandError) title() string {
+	return failureTitles[e.kind]
+}
+
+func (e *commandError) remediation() string {
+	if e.hint != "" {
+		return e.hint
+	}
+
+	return failureHints[e.kind]
+}
+
+// errDataNotLoaded is returned by commands that need the Patreon snapshot until the first sync completes
+var errDataNotLoaded = newCommandError(failureDataStale, "Initial data not loaded yet, please try again in a few minutes")
+
+// errMissingPermission is returned when the member doesn't hold the permission that a command or component requires
+func errMissingPermission(permission rbac.Permission) *commandError {
+	return newCommandError(failurePermissionDenied, "You need the `%s` permission to use this", permission)
+}
+
+// errDemoMode is returned by commands that change the database in demo mode, where it is shared with production
+func errDemoMode(path string) *commandError {
+	return newCommandError(failurePermissionDenied, "`/%s` is not available in demo mode", path).
+		withHint("Demo mode shares the database with production, so commands that change it are disabled. Vouchers can " +
+			"still be created and redeemed, as they are only kept in memory.")
+}
+
+// errorEmbed describes the failure and what to do about it
+func errorEmbed(style embedStyle, err *commandError, now time.Time) *embed.Embed {
+	return &embed.Embed{
+		Title:       err.title(),
+		Description: err.message,
+		Timestamp:   ptr(now),
+		Color:       style.ErrorColor,
+		Fields: []*embed.EmbedField{
+			{
+				Name:   "What To Do",
+				Value:  err.remediation(),
+				Inline: false,
+			},
+		},
+	}
+}
+
+// commandErrorMessage responds with the embed of a commandError, shown only to the user who ran the command. Other
+// errors are unexpected, so are responded to in the same way as errorMessage, with the request ID.
+func (s *Server) commandErrorMessage(ctx context.Context, err error) interaction.ResponseChannelMessage {
+	var commandErr *commandError
+	if !errors.As(err, &commandErr) {
+		return s.errorMessage(ctx, err.Error())
+	}
+
+	return interaction.NewResponseChannelMessage(interaction.ApplicationCommandCallbackData{
+		Embeds: []*embed.Embed{errorEmbed(s.embedStyle(ctx), commandErr, time.Now())},
+		Flags:  uint(message.FlagEphemeral),
+	})
+}
+
+// notFoundError explains why no patron was found. While syncs are failing, patrons who pledged since the last
+// successful sync are missing, which is more likely to be the cause than a typo.
+func (s *Server) notFoundError(notFound *commandError) *commandError {
+	if s.syncStatus != nil && s.syncStatus.Status().ConsecutiveFailures > 0 {
+		return &commandError{kind: failurePatreonDown, message: notFound.message}
+	}
+
+	return notFound
+}
@@ -0,0 +1,198 @@
+package server
+
+import (
+	"context"
+	"strings"
+
+	"github.com/TicketsBot-cloud/gdl/objects/interaction"
+	"github.com/TicketsBot-cloud/gdl/rest"
+	"github.com/TicketsBot/subscriptions-app/internal/rbac"
+)
+
+// commandHandler responds to a command, given the options passed to the subcommand that was invoked
+type commandHandler func(
+	ctx context.Context,
+	s *Server,
+	data interaction.ApplicationCommandInteraction,
+	options []interaction.ApplicationCommandInteractionDataOption,
+) interaction.ResponseChannelMessage
+
+// modalOpener responds to a command by opening a modal
+type modalOpener func(ctx context.Context, s *Server, data interaction.ApplicationCommandInteraction) interaction.ModalResponse
+
+// command defines a subcommand, or a command without subcommands: how it is registered with Discord, who can run it and
+// how it is handled. Commands are defined alongside their handlers, and listed in commands.
+type command struct {
+	path        string // The command's name, followed by any subcommand group and subcommand, separated by spaces
+	description string
+	options     []interaction.ApplicationCommandOption
+	permission  rbac.Permission // Needed to run the command. Empty for commands run by customers.
+	handler     commandHandler
+	writes      bool // Changes state kept in the database, so is rejected in demo mode
+
+	// modal is set instead of handler for commands that open a modal, to take more input than options allow. The
+	// modal's submission is handled by modalRoutes.
+	modal modalOpener
+
+	// userInstall commands can be run by trusted users outside the allowed guilds, in DMs or other servers, through the
+	// user-installed app. Commands that act on the guild, or check the member's permissions, must not set it.
+	userInstall bool
+
+	// autocomplete maps the name of each option to the handler that suggests values for it as the user types
+	autocomplete map[string]autocompleteHandler
+}
+
+// commandGroups holds the descriptions of the commands and subcommand groups that hold subcommands, by path
+var commandGroups = map[string]string{
+	"subscription":       "Look up and manage subscriptions",
+	"subscription stats": "View subscription analytics",
+	"tiers":              "Manage Patreon tier mappings",
+	"voucher":            "Manage voucher codes",
+	"premium":            "Manage which servers your premium applies to",
+	"admin":              "Manage the app in this server",
+}
+
+// commands lists every command, in the order that cmd/createcommands registers them
+var commands = []command{
+	lookupCommand,
+	historyCommand,
+	syncCommand,
+	statsChurnCommand,
+	statsMrrCommand,
+	statsUsageCommand,
+	whoisCommand,
+	linkCommand,
+	tiersListCommand,
+	tiersUnknownCommand,
+	tiersMapCommand,
+	voucherCreateCommand,
+	voucherRevokeCommand,
+	redeemCommand,
+	premiumAssignCommand,
+	premiumRemoveCommand,
+	searchCommand,
+	adminSettingsCommand,
+}
+
+// commandsByPath indexes commands by their path. It is built in init, as /admin settings looks up commands, so
+// commands can't depend on it.
+var commandsByPath map[string]command
+
+func init() {
+	commandsByPath = indexCommands(commands)
+}
+
+func indexCommands(commands []command) map[string]command {
+	byPath := make(map[string]command, len(commands))
+	for _, command := range commands {
+		byPath[command.path] = command
+	}
+
+	return byPath
+}
+
+// RegisteredCommand is a top-level command, with its subcommands, as registered with Discord
+type RegisteredCommand struct {
+	rest.CreateCommandData
+
+	// StaffOnly is set if every subcommand needs a permission, so that the command can be hidden from members by
+	// default. Permissions can only be set per command, so commands run by customers must not share one with staff.
+	StaffOnly bool
+
+	// UserInstallable is set if any subcommand can be run through the user-installed app
+	UserInstallable bool
+}
+
+// RegisteredCommands builds the commands to register with Discord, nesting each subcommand under its command and any
+// subcommand group, in the order they are listed in commands
+func RegisteredCommands() []RegisteredCommand {
+	var registered []RegisteredCommand
+	indexes := make(map[string]int) // Top-level command name -> index in registered
+
+	for _, command := range commands {
+		names := strings.Split(command.path, " ")
+
+		i, ok := indexes[names[0]]
+		if !ok {
+			i = len(registered)
+			indexes[names[0]] = i
+			registered = append(registered, RegisteredCommand{
+				CreateCommandData: rest.CreateCommandData{
+					Name:        names[0],
+					Description: commandGroups[names[0]],
+					Type:        interaction.ApplicationCommandTypeChatInput,
+				},
+				StaffOnly: true,
+			})
+		}
+
+		parent := &registered[i]
+		parent.StaffOnly = parent.StaffOnly && command.permission != ""
+		parent.UserInstallable = parent.UserInstallable || command.userInstall
+
+		switch len(names) {
+		case 1:
+			parent.Description = command.description
+			parent.Options = command.commandOptions()
+		case 2:
+			parent.Options = append(parent.Options, command.subcommandOption(names[1]))
+		default:
+			group := groupOption(&parent.Options, names[1], commandGroups[names[0]+" "+names[1]])
+			group.Options = append(group.Options, command.subcommandOption(names[2]))
+		}
+	}
+
+	return registered
+}
+
+// commandOptions returns the options of the command, marking those with an autocomplete handler
+func (c command) commandOptions() []interaction.ApplicationCommandOption {
+	options := make([]interaction.ApplicationCommandOption, len(c.options))
+	for i, option := range c.options {
+		options[i] = option
+		_, options[i].Autocomplete = c.autocomplete[option.Name]
+	}
+
+	return options
+}
+
+func (c command) subcommandOption(name string) interaction.ApplicationCommandOption {
+	return interaction.ApplicationCommandOption{
+		Type:        interaction.OptionTypeSubCommand,
+		Name:        name,
+		Description: c.description,
+		Options:     c.commandOptions(),
+	}
+}
+
+// groupOption returns the subcommand group with the name, adding it to the options if it isn't there yet
+func groupOption(options *[]interaction.ApplicationCommandOption, name, description string) *interaction.ApplicationCommandOption {
+	for i := range *options {
+		if (*options)[i].Type == interaction.OptionTypeSubCommandGroup && (*options)[i].Name == name {
+			return &(*options)[i]
+		}
+	}
+
+	*options = append(*options, interaction.ApplicationCommandOption{
+		Type:        interaction.OptionTypeSubCommandGroup,
+		Name:        name,
+		Description: description,
+	})
+
+	return &(*options)[len(*options)-1]
+}
+
+// commandPath returns the path of the invoked command, and the options passed to the invoked subcommand
+func commandPath(command *interaction.ApplicationCommandInteractionData) (string, []interaction.ApplicationCommandInteractionDataOption) {
+	path := []string{command.Name}
+	options := command.Options
+
+	// Discord sends the invoked subcommand group or subcommand as the only option of its parent. The option type isn't
+	// decoded, but unlike other options, subcommands have no value.
+	for len(options) == 1 && options[0].Value == nil {
+		path = append(path, options[0].Name)
+		options = options[0].Options
+	}
+
+	return strings.Join(path, " "), options
+}
@@ -0,0 +1,284 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/TicketsBot-cloud/gdl/objects/channel/message"
+	"github.com/TicketsBot-cloud/gdl/objects/interaction"
+	"github.com/TicketsBot/subscriptions-app/internal/allocations"
+	"github.com/TicketsBot/subscriptions-app/internal/analytics"
+	"github.com/TicketsBot/subscriptions-app/internal/clock"
+	"github.com/TicketsBot/subscriptions-app/internal/config"
+	"github.com/TicketsBot/subscriptions-app/internal/currency"
+	"github.com/TicketsBot/subscriptions-app/internal/database"
+	"github.com/TicketsBot/subscriptions-app/internal/entitlements"
+	"github.com/TicketsBot/subscriptions-app/internal/guildsettings"
+	"github.com/TicketsBot/subscriptions-app/internal/reconciliation"
+	"github.com/TicketsBot/subscriptions-app/internal/server/interactiontest"
+	"github.com/TicketsBot/subscriptions-app/internal/store"
+	"github.com/TicketsBot/subscriptions-app/internal/tiers"
+	"github.com/TicketsBot/subscriptions-app/internal/usage"
+	"github.com/TicketsBot/subscriptions-app/internal/usernames"
+	"github.com/TicketsBot/subscriptions-app/internal/vouchers"
+	"github.com/TicketsBot/subscriptions-app/pkg/patreon"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"go.uber.org/zap"
+)
+
+// The patron that the test server is loaded with, whose Discord account is linked
+const (
+	testPatronEmail            = "patron@example.com"
+	testPatronDiscordId uint64 = 100000000000000005
+	testTierId          uint64 = 1001
+)
+
+// newTestServer builds a server loaded with a snapshot holding the test patron. Its database refuses connections, so
+// commands that query it fail as they would during an outage.
+func newTestServer(t testing.TB, publicKey string) *Server {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+
+	var conf config.Config
+	conf.Discord.PublicKey = publicKey
+	conf.Discord.AllowedGuilds = []uint64{interactiontest.DefaultGuildId}
+	conf.Tiers = map[uint64]config.Tier{testTierId: {Name: "Premium"}}
+
+	logger := zap.NewNop()
+	db := unreachableDatabase(t)
+	tierRegistry := tiers.NewRegistry(conf, db, logger)
+	converter := currency.NewConverter(conf, logger)
+
+	engine := entitlements.NewEngine(conf, tierRegistry, nil, clock.Real, converter)
+
+	discordId := testPatronDiscordId
+	engine.UpdatePatrons(map[string]patreon.Patron{
+		testPatronEmail: {
+			Attributes: patreon.Attributes{
+				Email:            testPatronEmail,
+				PatronStatus:     "active_patron",
+				LastChargeStatus: "Paid",
+			},
+			Id:        12345678,
+			Tiers:     []uint64{testTierId},
+			DiscordId: &discordId,
+		},
+	})
+
+	allocationService := allocations.NewService(db, engine)
+	memoryStore := store.NewMemory(clock.Real)
+
+	return NewServer(
+		conf,
+		logger,
+		db,
+		memoryStore,
+		tierRegistry,
+		vouchers.NewService(memoryStore, tierRegistry, logger),
+		allocationService,
+		analytics.NewService(db, engine, tierRegistry, converter),
+		converter,
+		usernames.NewDirectory(conf, logger, engine),
+		guildsettings.NewStore(db),
+		usage.NewRecorder(db, logger),
+		engine,
+		reconciliation.NewJob(conf, logger, db, memoryStore, allocationService, engine),
+		Providers{},
+	)
+}
+
+// unreachableDatabase returns a database whose pool connects lazily to a port that nothing listens on
+func unreachableDatabase(t testing.TB) *database.Database {
+	t.Helper()
+
+	poolConfig, err := pgxpool.ParseConfig("postgres://test@127.0.0.1:1/test?connect_timeout=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	poolConfig.LazyConnect = true
+
+	pool, err := pgxpool.ConnectConfig(context.Background(), poolConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(pool.Close)
+	return database.NewDatabase(pool)
+}
+
+func TestCommands(t *testing.T) {
+	harness := interactiontest.New()
+	harness.Handler = newTestServer(t, harness.PublicKey).Router()
+
+	lookup := func(options ...interactiontest.Option) interactiontest.Interaction {
+		return interactiontest.Command("subscription", interactiontest.Subcommand("lookup", options...)).
+			As(interactiontest.DefaultUserId, interactiontest.PermissionAdministrator)
+	}
+
+	tests := []struct {
+		name        string
+		interaction interactiontest.Interaction
+		typ         interaction.ResponseType
+		title       string // Of the first embed, if the response is a message
+		description string // Contained in the first embed's description
+		ephemeral   bool
+	}{
+		{
+			name:        "ping",
+			interaction: interactiontest.Ping(),
+			typ:         interaction.ResponseTypePong,
+		},
+		{
+			name:        "lookup by user",
+			interaction: lookup(interactiontest.User("user", testPatronDiscordId)),
+			typ:         interaction.ResponseTypeChannelMessageWithSource,
+			title:       "Account Found",
+		},
+		{
+			name:        "lookup by email",
+			interaction: lookup(interactiontest.String("email", testPatronEmail)),
+			typ:         interaction.ResponseTypeChannelMessageWithSource,
+			title:       "Account Found",
+		},
+		{
+			name:        "lookup by unlinked user",
+			interaction: lookup(interactiontest.User("user", 100000000000000009)),
+			typ:         interaction.ResponseTypeChannelMessageWithSource,
+			title:       failureTitles[failureNotLinked],
+			description: "No Patreon account with id `100000000000000009` found",
+		},
+		{
+			name:        "lookup missing option",
+			interaction: lookup(),
+			typ:         interaction.ResponseTypeChannelMessageWithSource,
+			title:       failureTitles[failureInvalidOption],
+			description: errMissingLookupOption.message,
+			ephemeral:   true,
+		},
+		{
+			name: "unknown command",
+			interaction: interactiontest.Command("subscription", interactiontest.Subcommand("unknown")).
+				As(interactiontest.DefaultUserId, interactiontest.PermissionAdministrator),
+			typ:         interaction.ResponseTypeChannelMessageWithSource,
+			title:       failureTitles[failureUnknownCommand],
+			description: "Unknown command `/subscription unknown`",
+			ephemeral:   true,
+		},
+		{
+			name:        "missing permission",
+			interaction: interactiontest.Command("tiers", interactiontest.Subcommand("map")),
+			typ:         interaction.ResponseTypeChannelMessageWithSource,
+			title:       failureTitles[failurePermissionDenied],
+			description: "You need the `admin` permission to use this",
+			ephemeral:   true,
+		},
+		{
+			name:        "outside allowed guilds",
+			interaction: lookup(interactiontest.User("user", testPatronDiscordId)).InGuild(100000000000000010),
+			typ:         interaction.ResponseTypeChannelMessageWithSource,
+			title:       failureTitles[failurePermissionDenied],
+			description: "This guild is not in the allowed guilds list",
+			ephemeral:   true,
+		},
+		{
+			// The staff member's message is left intact, as the error is sent as a new message
+			name:        "component missing permission",
+			interaction: interactiontest.Button(syncNowId),
+			typ:         interaction.ResponseTypeChannelMessageWithSource,
+			title:       failureTitles[failurePermissionDenied],
+			description: "You need the `admin` permission to use this",
+			ephemeral:   true,
+		},
+		{
+			name:        "component outside allowed guilds",
+			interaction: interactiontest.SelectMenu(lookupSelectId, "12345678").InGuild(100000000000000010),
+			typ:         interaction.ResponseTypeChannelMessageWithSource,
+			title:       failureTitles[failurePermissionDenied],
+			description: "You are not allowed to use this outside of the allowed guilds",
+			ephemeral:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res, err := harness.Respond(test.interaction)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if res.Type != test.typ {
+				t.Fatalf("expected response type %d, got %d", test.typ, res.Type)
+			}
+
+			if test.title == "" {
+				return
+			}
+
+			if len(res.Data.Embeds) == 0 {
+				t.Fatalf("expected an embed, got %+v", res.Data)
+			}
+
+			e := res.Data.Embeds[0]
+			if e.Title != test.title {
+				t.Errorf("expected title %q, got %q", test.title, e.Title)
+			}
+
+			if !strings.Contains(e.Description, test.description) {
+				t.Errorf("expected description to contain %q, got %q", test.description, e.Description)
+			}
+
+			if ephemeral := res.Data.Flags&uint(message.FlagEphemeral) != 0; ephemeral != test.ephemeral {
+				t.Errorf("expected ephemeral to be %t, got %t", test.ephemeral, ephemeral)
+			}
+		})
+	}
+}
+
+func TestDemoModeRejectsWrites(t *testing.T) {
+	harness := interactiontest.New()
+	s := newTestServer(t, harness.PublicKey)
+	s.SetDemo()
+	harness.Handler = s.Router()
+
+	tests := []struct {
+		name        string
+		interaction interactiontest.Interaction
+	}{
+		{
+			name: "tiers map",
+			interaction: interactiontest.Command("tiers", interactiontest.Subcommand("map",
+				interactiontest.Integer("tier_id", 2002), interactiontest.String("name", "Ultimate"))),
+		},
+		{
+			name: "admin settings",
+			interaction: interactiontest.Command("admin", interactiontest.Subcommand("settings",
+				interactiontest.String("primary_color", "#ff0000"))),
+		},
+		{
+			name: "premium assign",
+			interaction: interactiontest.Command("premium", interactiontest.Subcommand("assign",
+				interactiontest.String("server_id", "100000000000000010"))),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res, err := harness.Respond(test.interaction.As(interactiontest.DefaultUserId, interactiontest.PermissionAdministrator))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(res.Data.Embeds) == 0 {
+				t.Fatalf("expected an embed, got %+v", res.Data)
+			}
+
+			if e := res.Data.Embeds[0]; !strings.Contains(e.Description, "is not available in demo mode") {
+				t.Errorf("expected the command to be rejected in demo mode, got %q: %q", e.Title, e.Description)
+			}
+		})
+	}
+}
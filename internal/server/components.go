@@ -0,0 +1,53 @@
+package server
+
+import (
+	"context"
+	"strings"
+
+	"github.com/TicketsBot-cloud/gdl/objects/channel/embed"
+	"github.com/TicketsBot-cloud/gdl/objects/interaction"
+	"github.com/TicketsBot-cloud/gdl/objects/interaction/component"
+)
+
+// componentHandler responds to the use of a message component, such as a choice from a select menu, by updating the
+// message that the component is attached to
+type componentHandler func(
+	ctx context.Context,
+	s *Server,
+	data interaction.MessageComponentInteraction,
+) interaction.ResponseUpdateMessage
+
+// componentRoutes maps the custom ID of each component to its handler
+var componentRoutes = map[string]componentHandler{
+	lookupSelectId:  handleLookupSelect,
+	lookupPageView:  paginated(lookupPageView, renderLookupPage),
+	historyPageView: paginated(historyPageView, renderHistoryPage),
+	tiersPageView:   paginated(tiersPageView, renderTiersPage),
+	syncRefreshId:   handleSyncRefresh,
+	syncNowId:       handleSyncNow,
+	searchPageView:  paginated(searchPageView, renderSearchPage),
+}
+
+// userInstallComponents can be used by trusted users outside the allowed guilds, as they are attached to the responses
+// of commands with userInstall set
+var userInstallComponents = []string{
+	lookupSelectId,
+	lookupPageView,
+	historyPageView,
+}
+
+// componentName returns the part of the custom ID that components are routed by. Components that carry state, such as
+// page buttons, append it after a colon.
+func componentName(customId string) string {
+	name, _, _ := strings.Cut(customId, ":")
+	return name
+}
+
+// updateMessage replaces the message, and removes its components, so that they can't be used again
+func updateMessage(content string) interaction.ResponseUpdateMessage {
+	return interaction.NewResponseUpdateMessage(interaction.ResponseUpdateMessageData{
+		Content:    &content,
+		Embeds:     []*embed.Embed{},
+		Components: []component.Component{},
+	})
+}
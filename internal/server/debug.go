@@ -0,0 +1,67 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+
+	"github.com/TicketsBot/subscriptions-app/internal/rbac"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// RunDebug serves pprof and runtime statistics on the debug address, separately from the public router. The endpoints
+// require an API key or service token, so the debug server will not start unless at least one key is configured. The
+// server is shut down once the context is cancelled.
+func (s *Server) RunDebug(ctx context.Context) error {
+	conf := s.currentConfig()
+	if !conf.HasApiCredentials() {
+		return errors.New("debug server requires API_KEYS or SERVICE_TOKEN_PUBLIC_KEYS to be set")
+	}
+
+	router := gin.New()
+	router.Use(gin.Recovery())
+
+	debug := router.Group("/debug", s.AuthenticateApiKey, s.RequirePermission(rbac.Admin))
+	debug.GET("/runtime", s.HandleRuntimeStats)
+
+	// Profiles such as goroutine and heap dumps are served by pprof.Index, e.g. /debug/pprof/goroutine?debug=2
+	debug.GET("/pprof/", gin.WrapF(pprof.Index))
+	debug.GET("/pprof/:profile", gin.WrapF(pprof.Index))
+	debug.GET("/pprof/cmdline", gin.WrapF(pprof.Cmdline))
+	debug.GET("/pprof/profile", gin.WrapF(pprof.Profile))
+	debug.GET("/pprof/symbol", gin.WrapF(pprof.Symbol))
+	debug.POST("/pprof/symbol", gin.WrapF(pprof.Symbol))
+	debug.GET("/pprof/trace", gin.WrapF(pprof.Trace))
+
+	server := &http.Server{
+		Addr:    conf.DebugAddr,
+		Handler: router,
+	}
+
+	return serveUntilDone(ctx, server, server.ListenAndServe)
+}
+
+// HandleRuntimeStats returns memory statistics alongside the size of the pledge maps, which dominate the heap
+func (s *Server) HandleRuntimeStats(ctx *gin.Context) {
+	if ctx.Query("gc") == "true" {
+		runtime.GC()
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	pledges, pledgesByDiscordId := s.entitlements.PatronCounts()
+
+	ctx.JSON(200, gin.H{
+		"goroutines":            runtime.NumGoroutine(),
+		"heap_alloc_bytes":      mem.HeapAlloc,
+		"heap_inuse_bytes":      mem.HeapInuse,
+		"heap_objects":          mem.HeapObjects,
+		"sys_bytes":             mem.Sys,
+		"num_gc":                mem.NumGC,
+		"pledges":               pledges,
+		"pledges_by_discord_id": pledgesByDiscordId,
+	})
+}
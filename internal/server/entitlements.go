@@ -0,0 +1,59 @@
+package server
+
+import (
+	"strconv"
+
+	"github.com/TicketsBot/subscriptions-app/internal/entitlements"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// HandleGetEntitlements returns the entitlements from every provider for the email or discord_id query parameter, or
+// the Patreon entitlements for the patron_id query parameter
+func (s *Server) HandleGetEntitlements(ctx *gin.Context) {
+	if !s.entitlements.Loaded() {
+		ctx.JSON(503, errorJson("Initial data not loaded yet"))
+		return
+	}
+
+	var found []entitlements.Entitlement
+	var err error
+	if email := ctx.Query("email"); email != "" {
+		found, err = s.entitlements.ByEmail(ctx.Request.Context(), email)
+	} else if discordIdStr := ctx.Query("discord_id"); discordIdStr != "" {
+		discordId, parseErr := strconv.ParseUint(discordIdStr, 10, 64)
+		if parseErr != nil {
+			ctx.JSON(400, errorJson("Invalid discord_id"))
+			return
+		}
+
+		found, err = s.entitlements.ByDiscordId(ctx.Request.Context(), discordId)
+	} else if patronIdStr := ctx.Query("patron_id"); patronIdStr != "" {
+		patronId, parseErr := strconv.ParseUint(patronIdStr, 10, 64)
+		if parseErr != nil {
+			ctx.JSON(400, errorJson("Invalid patron_id"))
+			return
+		}
+
+		found = s.entitlements.ByPatronId(patronId)
+	} else {
+		ctx.JSON(400, errorJson("One of email, discord_id or patron_id must be set"))
+		return
+	}
+
+	// A source being unavailable would make the result incomplete, which consumers could mistake for a lapsed
+	// subscription
+	if err != nil {
+		s.loggerFor(ctx.Request.Context()).Error("Failed to look up entitlements", zap.Error(err))
+		ctx.JSON(503, errorJson("Failed to look up entitlements from every source"))
+		return
+	}
+
+	if found == nil {
+		found = []entitlements.Entitlement{}
+	}
+
+	ctx.JSON(200, gin.H{
+		"entitlements": found,
+	})
+}
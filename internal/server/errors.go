@@ -9,7 +9,7 @@ func (s *Server) ErrorHandler(ctx *gin.Context) {
 	ctx.Next()
 
 	for _, err := range ctx.Errors {
-		s.logger.Error(
+		s.loggerFor(ctx.Request.Context()).Error(
 			err.Error(),
 			zap.Any("meta", err.Meta),
 			zap.Any("stack", err.Err),
@@ -20,6 +20,8 @@ func (s *Server) ErrorHandler(ctx *gin.Context) {
 	}
 
 	if len(ctx.Errors) > 0 {
-		ctx.JSON(500, errorJson("Internal server error"))
+		res := errorJson("Internal server error")
+		res["request_id"] = requestIdFromContext(ctx.Request.Context())
+		ctx.JSON(500, res)
 	}
 }
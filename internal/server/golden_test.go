@@ -0,0 +1,501 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TicketsBot-cloud/gdl/objects/channel/embed"
+	"github.com/TicketsBot-cloud/gdl/objects/user"
+	"github.com/TicketsBot/subscriptions-app/internal/analytics"
+	"github.com/TicketsBot/subscriptions-app/internal/config"
+	"github.com/TicketsBot/subscriptions-app/internal/database"
+	"github.com/TicketsBot/subscriptions-app/internal/entitlements"
+	"github.com/TicketsBot/subscriptions-app/internal/events"
+	"github.com/TicketsBot/subscriptions-app/internal/rbac"
+	"github.com/TicketsBot/subscriptions-app/internal/syncstatus"
+	"github.com/TicketsBot/subscriptions-app/pkg/patreon"
+)
+
+// update rewrites the golden files from the rendered embeds, after a deliberate formatting change:
+//
+//	go test ./internal/server -run Golden -update
+var update = flag.Bool("update", false, "Rewrite the golden files instead of comparing against them")
+
+// goldenDir holds a golden file for each embed, named after it
+const goldenDir = "testdata/golden"
+
+// maxDiffLines is the number of differing lines reported per embed
+const maxDiffLines = 20
+
+// TestGoldenEmbeds compares the embeds rendered by goldenEmbeds against the files in testdata/golden, so that formatting
+// changes show up in review as a diff of those files
+func TestGoldenEmbeds(t *testing.T) {
+	embeds := goldenEmbeds()
+
+	if *update {
+		if err := os.MkdirAll(goldenDir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for name, e := range embeds {
+		t.Run(name, func(t *testing.T) {
+			rendered, err := renderGolden(e)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			path := filepath.Join(goldenDir, name+".json")
+			if *update {
+				if err := os.WriteFile(path, rendered, 0o644); err != nil {
+					t.Fatal(err)
+				}
+
+				return
+			}
+
+			golden, err := os.ReadFile(path)
+			if errors.Is(err, fs.ErrNotExist) {
+				t.Fatalf("no golden file, run with -update to create %s", path)
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(golden, rendered) {
+				t.Errorf("differs from %s:\n%s", path, diffLines(string(golden), string(rendered)))
+			}
+		})
+	}
+
+	// Golden files for embeds that are no longer rendered would otherwise go unnoticed
+	paths, err := filepath.Glob(filepath.Join(goldenDir, "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), ".json")
+		if _, ok := embeds[name]; ok {
+			continue
+		}
+
+		if *update {
+			if err := os.Remove(path); err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			t.Errorf("%s has no matching embed, run with -update to remove it", path)
+		}
+	}
+}
+
+// renderGolden encodes the embed as indented JSON. Mentions and timestamps are not escaped, so that the golden files
+// read like the message would.
+func renderGolden(e *embed.Embed) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+
+	if err := encoder.Encode(e); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// diffLines describes the lines that differ between the golden and rendered embeds, compared line by line
+func diffLines(golden, rendered string) string {
+	goldenLines := strings.Split(golden, "\n")
+	renderedLines := strings.Split(rendered, "\n")
+
+	var b strings.Builder
+	printed := 0
+	for i := range max(len(goldenLines), len(renderedLines)) {
+		var want, got string
+		if i < len(goldenLines) {
+			want = goldenLines[i]
+		}
+
+		if i < len(renderedLines) {
+			got = renderedLines[i]
+		}
+
+		if want == got {
+			continue
+		}
+
+		if printed == maxDiffLines {
+			b.WriteString("  ...\n")
+			break
+		}
+
+		fmt.Fprintf(&b, "  line %d:\n  - %s\n  + %s\n", i+1, want, got)
+		printed++
+	}
+
+	return b.String()
+}
+
+// goldenEmbeds renders the lookup, history, tiers, whois, search, settings, stats, sync and error embeds from fixed
+// fixtures, keyed by name
+func goldenEmbeds() map[string]*embed.Embed {
+	now := time.Date(2024, time.November, 29, 12, 0, 0, 0, time.UTC)
+	style := embedStyle{
+		PrimaryColor: 0x4287f5,
+		ErrorColor:   0xeb4034,
+		PatronUrl:    "https://www.patreon.com/user?u=%d",
+	}
+
+	author := user.User{Id: 100000000000000004, Username: "staff"}
+
+	email := "patron@example.com"
+	discordId := uint64(100000000000000005)
+	started := now.AddDate(-1, -2, 0)
+	charged := now.AddDate(0, 0, -3)
+	expires := now.AddDate(0, 1, 4)
+	graceEnds := now.AddDate(0, 0, 2)
+	nextCharge := charged.AddDate(0, 1, 0)
+
+	patron := entitlements.Entitlement{
+		Source:           entitlements.PatreonSource,
+		Reference:        "12345678",
+		Email:            &email,
+		DiscordId:        &discordId,
+		TierId:           1001,
+		Tier:             "Premium",
+		RoleId:           100000000000000006,
+		Status:           "active_patron",
+		Active:           true,
+		StartsAt:         &started,
+		PremiumExpiresAt: &expires,
+		LastChargeAt:     &charged,
+		LastChargeStatus: "Paid",
+		CadenceMonths:    1,
+		NextChargeAt:     &nextCharge,
+	}
+
+	secondTier := patron
+	secondTier.TierId = 1002
+	secondTier.Tier = "Whitelabel"
+	secondTier.RoleId = 0
+
+	duplicated := patron
+	duplicated.DuplicateReferences = []string{"23456789", "34567890"}
+
+	unlinked := patron
+	unlinked.DiscordId = nil
+	unlinked.Status = "declined_patron"
+	unlinked.LastChargeStatus = "Declined"
+	unlinked.PremiumExpiresAt = nil
+	unlinked.NextChargeAt = nil
+
+	annual := patron
+	annual.CadenceMonths = 12
+	annual.NextChargeAt = ptr(charged.AddDate(1, 0, 0))
+	annual.PremiumExpiresAt = ptr(annual.NextChargeAt.AddDate(0, 0, 3))
+
+	gifted := patron
+	gifted.Gifted = true
+	gifted.NextChargeAt = nil
+
+	ended := now.AddDate(0, 0, -12)
+	former := entitlements.Entitlement{
+		Source:           entitlements.PatreonSource,
+		Reference:        "12345678",
+		Email:            &email,
+		DiscordId:        &discordId,
+		Status:           "former_patron",
+		EndsAt:           &ended,
+		PremiumExpiresAt: &ended,
+		Former:           &entitlements.FormerPledge{LastTiers: []string{"Premium"}, EndedAt: ended},
+	}
+
+	others := []entitlements.Entitlement{
+		{Source: "Paddle", Reference: "sub_01", Email: &email, Tier: "Premium", Status: "active", Active: true, EndsAt: &expires},
+		{Source: "Manual", Reference: "voucher", Email: &email, Tier: "Whitelabel", Status: "past_due", Active: true, GraceEndsAt: &graceEnds},
+	}
+
+	// Avatars are only decoded from JSON
+	var profile user.User
+	_ = json.Unmarshal([]byte(`{"id":"100000000000000005","username":"patron","avatar":"0123456789abcdef0123456789abcdef"}`), &profile)
+
+	lifetime := 143.25
+	synced := now.Add(-time.Minute * 3)
+
+	return map[string]*embed.Embed{
+		"lookup_not_found":           errorEmbed(style, newCommandError(failureNotFound, "No Patreon account with email `nobody@example.com` found"), now),
+		"error_not_linked":           errorEmbed(style, newCommandError(failureNotLinked, "No Patreon account with id `%d` found", discordId), now),
+		"error_data_not_loaded":      errorEmbed(style, errDataNotLoaded, now),
+		"error_patreon_down":         errorEmbed(style, newCommandError(failurePatreonDown, "No Patreon account with email `nobody@example.com` found"), now),
+		"error_permission_denied":    errorEmbed(style, errMissingPermission(rbac.Grant), now),
+		"lookup_patron":              lookupEmbed(style, author, nil, []entitlements.Entitlement{patron, secondTier}, "", now),
+		"lookup_duplicates":          lookupEmbed(style, author, nil, []entitlements.Entitlement{duplicated}, "", now),
+		"lookup_annual":              lookupEmbed(style, author, nil, []entitlements.Entitlement{annual}, "", now),
+		"lookup_unlinked":            lookupEmbed(style, author, nil, []entitlements.Entitlement{unlinked}, "", now),
+		"lookup_former":              lookupEmbed(style, author, nil, []entitlements.Entitlement{former}, "", now),
+		"lookup_profile":             lookupEmbed(style, author, &profile, []entitlements.Entitlement{patron}, "", now),
+		"lookup_gifted":              lookupEmbed(style, author, nil, []entitlements.Entitlement{gifted}, "", now),
+		"lookup_with_others":         lookupEmbed(style, author, nil, append([]entitlements.Entitlement{patron}, others...), "", now),
+		"lookup_data_as_of":          withDataAsOf(lookupEmbed(style, author, nil, []entitlements.Entitlement{patron}, "", now), &synced),
+		"lookup_only_others":         lookupEmbed(style, author, nil, others, "No Patreon account with email `patron@example.com` found", now),
+		"subscription_history":       historyEmbed(style, 12345678, goldenHistory(now), goldenTierName, goldenToBase, "USD", now),
+		"subscription_history_empty": historyEmbed(style, 12345678, nil, goldenTierName, goldenToBase, "USD", now),
+		"tiers_list":                 tiersEmbed(style, goldenTierSummaries(), "USD", now),
+		"tiers_list_empty":           tiersEmbed(style, nil, "USD", now),
+		"whois":                      whoisEmbed(style, "example.com", goldenDomainPatrons(), now),
+		"whois_empty":                whoisEmbed(style, "example.org", nil, now),
+		"search_results":             searchEmbed(style, goldenSearchCriteria(now), goldenSearchPatrons(now), 42, goldenTierName, now),
+		"search_no_results":          searchEmbed(style, describeSearch(entitlements.PatronSearch{}, goldenTierName), nil, 0, goldenTierName, now),
+		"settings_default":           settingsEmbed(style, "Server Settings", database.GuildSettings{}, goldenTierName, now),
+		"settings_custom":            settingsEmbed(style, "Settings Updated", goldenGuildSettings(now), goldenTierName, now),
+		"stats_churn":                churnEmbed(style, goldenChurnReport(now, &lifetime), now),
+		"stats_churn_empty":          churnEmbed(style, analytics.ChurnReport{GeneratedAt: now}, now),
+		"stats_mrr":                  mrrEmbed(style, goldenRevenueReport(now), now),
+		"stats_mrr_no_tiers":         mrrEmbed(style, analytics.RevenueReport{GeneratedAt: now, Currency: "USD"}, now),
+		"stats_usage":                usageEmbed(style, 30, goldenCommandUsage(), goldenUserUsage(), now),
+		"stats_usage_empty":          usageEmbed(style, 7, nil, nil, now),
+		"sync_in_progress":           syncEmbed(style, goldenSyncStatus(now, true, 0), now),
+		"sync_in_progress_no_total":  syncEmbed(style, withoutTotal(goldenSyncStatus(now, true, 0)), now),
+		"sync_idle":                  syncEmbed(style, goldenSyncStatus(now, false, 0), now),
+		"sync_failing":               syncEmbed(style, goldenSyncStatus(now, false, 2), now),
+	}
+}
+
+// goldenSyncStatus is the status after a successful sync, followed by the given number of failures, with a sync in
+// progress if running is set
+func goldenSyncStatus(now time.Time, running bool, failures int) syncstatus.Status {
+	lastSuccess := now.Add(-time.Minute * 42)
+	duration := (time.Minute * 24).Seconds()
+	patrons := 4812
+
+	status := syncstatus.Status{
+		LastSuccessAt:       &lastSuccess,
+		LastDurationSeconds: &duration,
+		Patrons:             &patrons,
+		ConsecutiveFailures: failures,
+	}
+
+	if failures > 0 {
+		failedAt := now.Add(-time.Minute * 2)
+		status.LastError = ptr("page timeout of 1m0s exceeded (set by PATREON_PAGE_TIMEOUT_SECONDS): context deadline exceeded")
+		status.LastErrorAt = &failedAt
+	}
+
+	if running {
+		started := now.Add(-time.Minute * 9)
+		finishAt := now.Add(time.Minute * 11)
+		status.InProgress = &patreon.Progress{
+			StartedAt:         started,
+			UpdatedAt:         now.Add(-time.Second * 5),
+			Pages:             19,
+			Members:           1900,
+			Total:             4850,
+			EstimatedFinishAt: &finishAt,
+		}
+	}
+
+	return status
+}
+
+func withoutTotal(status syncstatus.Status) syncstatus.Status {
+	progress := *status.InProgress
+	progress.Total = 0
+	progress.EstimatedFinishAt = nil
+	status.InProgress = &progress
+	return status
+}
+
+func goldenChurnReport(now time.Time, lifetime *float64) analytics.ChurnReport {
+	return analytics.ChurnReport{
+		GeneratedAt:   now,
+		ActivePatrons: 412,
+		Months: []analytics.MonthlyChurn{
+			{Month: "2024-09", ActiveAtStart: 380, New: 41, Cancelled: 12, ChurnRate: 12.0 / 380},
+			{Month: "2024-10", ActiveAtStart: 409, New: 33, Cancelled: 19, ChurnRate: 19.0 / 409},
+			{Month: "2024-11", ActiveAtStart: 423, New: 8, Cancelled: 19, ChurnRate: 19.0 / 423},
+		},
+		Cohorts: []analytics.Cohort{
+			{Month: "2024-01", Size: 52, Retention: []float64{1, 0.9, 0.85, 0.8, 0.78, 0.75, 0.74, 0.7}},
+			{Month: "2024-09", Size: 41, Retention: []float64{0.95, 0.9}},
+			{Month: "2024-10", Size: 0},
+		},
+		AverageLifetimeDays: lifetime,
+	}
+}
+
+func goldenRevenueReport(now time.Time) analytics.RevenueReport {
+	return analytics.RevenueReport{
+		GeneratedAt: now,
+		Currency:    "USD",
+		MrrCents:    248575,
+		ByTier: []analytics.TierRevenue{
+			{TierId: 1001, Name: "Premium", Patrons: 380, MrrCents: 189620},
+			{TierId: 1002, Name: "Whitelabel", Patrons: 32, MrrCents: 58955},
+			{TierId: 1003, Patrons: 0, MrrCents: 0},
+		},
+		Months: []analytics.MonthlyRevenue{
+			{
+				Month:            "2024-10",
+				StartMrrCents:    240000,
+				NewCents:         16000,
+				ExpansionCents:   2500,
+				ContractionCents: 1000,
+				ChurnedCents:     9000,
+				EndMrrCents:      248500,
+				ChangeRate:       8500.0 / 240000,
+			},
+			{
+				Month:            "2024-11",
+				StartMrrCents:    248500,
+				NewCents:         4000,
+				ContractionCents: 425,
+				ChurnedCents:     3500,
+				EndMrrCents:      248575,
+				ChangeRate:       75.0 / 248500,
+			},
+		},
+	}
+}
+
+func goldenDomainPatrons() []patreon.Patron {
+	patron := func(id uint64, email, status string, discordId *uint64) patreon.Patron {
+		p := patreon.Patron{Id: id, DiscordId: discordId}
+		p.Email = email
+		p.PatronStatus = status
+		return p
+	}
+
+	first, second := uint64(100000000000000005), uint64(100000000000000007)
+	return []patreon.Patron{
+		patron(12345678, "alice@example.com", "active_patron", &first),
+		patron(23456789, "billing@example.com", "active_patron", nil),
+		patron(34567890, "bob@eu.example.com", "declined_patron", &second),
+		patron(45678901, "carol@example.com", "", nil),
+	}
+}
+
+func goldenSearchCriteria(now time.Time) string {
+	return describeSearch(entitlements.PatronSearch{
+		Status:       "declined_patron",
+		TierId:       1001,
+		JoinedAfter:  ptr(now.AddDate(-1, 0, 0)),
+		ChargeStatus: "Declined",
+	}, goldenTierName)
+}
+
+func goldenSearchPatrons(now time.Time) []patreon.Patron {
+	patrons := goldenDomainPatrons()
+	for i := range patrons {
+		patrons[i].Tiers = []uint64{1001}
+		patrons[i].PledgeRelationshipStart = now.AddDate(0, -i-1, 0)
+		patrons[i].PatronStatus = "declined_patron"
+		patrons[i].LastChargeStatus = "Declined"
+	}
+
+	patrons[1].Tiers = []uint64{1001, 1002}
+	patrons[3].Tiers = nil
+	patrons[3].PledgeRelationshipStart = time.Time{}
+	patrons[3].PatronStatus = ""
+	patrons[3].LastChargeStatus = ""
+	return patrons
+}
+
+func goldenGuildSettings(now time.Time) database.GuildSettings {
+	return database.GuildSettings{
+		GuildId:          100000000000000008,
+		DisabledCommands: []string{"subscription stats mrr", "whois"},
+		HiddenTiers:      []uint64{1002},
+		PrimaryColor:     ptr(0x2ecc71),
+		FooterText:       ptr("Support team"),
+		Ephemeral:        true,
+		UpdatedBy:        100000000000000004,
+		UpdatedAt:        now.Add(-time.Hour),
+	}
+}
+
+func goldenCommandUsage() []database.CommandUsage {
+	return []database.CommandUsage{
+		{Command: "subscription lookup", Uses: 1240, Users: 9, MedianMs: 84, P95Ms: 412},
+		{Command: "search", Uses: 212, Users: 4, MedianMs: 131, P95Ms: 640},
+		{Command: "subscription stats mrr", Uses: 18, Users: 2, MedianMs: 920, P95Ms: 2450},
+		{Command: "voucher create", Uses: 3, Users: 1, MedianMs: 57, P95Ms: 61},
+	}
+}
+
+func goldenUserUsage() []database.UserUsage {
+	return []database.UserUsage{
+		{UserId: 100000000000000004, Uses: 640, MostUsed: "subscription lookup"},
+		{UserId: 100000000000000009, Uses: 402, MostUsed: "search"},
+		{UserId: 100000000000000010, Uses: 17, MostUsed: "subscription stats mrr"},
+	}
+}
+
+func goldenTierSummaries() []tierSummary {
+	return tierSummaries(map[uint64]config.Tier{
+		1001: {Name: "Premium", PriceCents: 500},
+		1002: {Name: "Whitelabel", PriceCents: 1000},
+		1004: {Name: "Legacy"},
+	}, map[uint64]int{1001: 380, 1002: 32, 1003: 4})
+}
+
+func goldenTierName(tierId uint64) string {
+	switch tierId {
+	case 1001:
+		return "Premium"
+	case 1002:
+		return "Whitelabel"
+	default:
+		return strconv.FormatUint(tierId, 10)
+	}
+}
+
+// goldenToBase converts euros to dollars at a fixed rate, and has no rate for other currencies
+func goldenToBase(cents int, currency string) (int, bool) {
+	if currency != "EUR" {
+		return cents, false
+	}
+
+	return int(math.Round(float64(cents) / 0.92)), true
+}
+
+func goldenHistory(now time.Time) []database.PatronHistoryEntry {
+	entry := func(daysAgo int, event events.Event, details string) database.PatronHistoryEntry {
+		at := now.AddDate(0, 0, -daysAgo)
+		event.PatronId = 12345678
+		event.EffectiveAt = at
+
+		encoded, _ := json.Marshal(event)
+		if details != "" {
+			encoded = json.RawMessage(details)
+		}
+
+		return database.PatronHistoryEntry{
+			PatronId:    12345678,
+			Event:       string(event.Type),
+			Details:     encoded,
+			EffectiveAt: &at,
+			CreatedAt:   at,
+		}
+	}
+
+	return []database.PatronHistoryEntry{
+		entry(2, events.Event{Type: events.TypeCancel, PreviousTiers: []uint64{1002}, PreviousAmountCents: 1000}, ""),
+		entry(15, events.Event{Type: events.TypeRenew, Tiers: []uint64{1002}, AmountCents: 920, Currency: "EUR"}, ""),
+		entry(30, events.Event{Type: events.TypeRenew, Tiers: []uint64{1002}, AmountCents: 1000}, ""),
+		entry(45, events.Event{Type: events.TypeUpgrade, PreviousTiers: []uint64{1001}, Tiers: []uint64{1002}, PreviousAmountCents: 500, AmountCents: 1000}, ""),
+		entry(60, events.Event{Type: events.TypeChange, PreviousTiers: []uint64{1003}, Tiers: []uint64{1001}, PreviousAmountCents: 500, AmountCents: 500}, ""),
+		entry(90, events.Event{Type: events.TypeNew, Tiers: []uint64{1003}, AmountCents: 500}, "not json"),
+	}
+}
@@ -1,217 +1,229 @@
 package server
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"strconv"
-	"strings"
 	"time"
 
-	"github.com/TicketsBot-cloud/gdl/objects/channel/embed"
 	"github.com/TicketsBot-cloud/gdl/objects/channel/message"
 	"github.com/TicketsBot-cloud/gdl/objects/interaction"
-	"github.com/TicketsBot-cloud/gdl/objects/user"
-	"github.com/TicketsBot/subscriptions-app/pkg/patreon"
+	"github.com/TicketsBot/subscriptions-app/internal/database"
+	"github.com/TicketsBot/subscriptions-app/internal/metrics"
 	"github.com/gin-gonic/gin"
-	"github.com/gin-gonic/gin/binding"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 )
 
 func (s *Server) HandleInteraction(ctx *gin.Context) {
-	var body interaction.Interaction
-	if err := ctx.ShouldBindBodyWith(&body, binding.JSON); err != nil {
-		ctx.JSON(400, errorJson("Failed to parse body"))
+	body, err := ctx.GetRawData()
+	if err != nil {
+		_ = ctx.Error(errors.Wrap(err, "Failed to read body"))
 		return
 	}
 
-	switch body.Type {
-	case interaction.InteractionTypePing:
-		ctx.JSON(200, interaction.NewResponsePong())
-	case interaction.InteractionTypeApplicationCommand:
-		var commandData interaction.ApplicationCommandInteraction
-		if err := ctx.ShouldBindBodyWith(&commandData, binding.JSON); err != nil {
-			_ = ctx.Error(errors.Wrap(err, "Failed to parse application command payload"))
-			return
+	res, err := s.dispatchInteraction(ctx.Request.Context(), body)
+	if err != nil {
+		if errors.Is(err, errInvalidInteraction) {
+			ctx.JSON(400, errorJson("Failed to parse body"))
+		} else {
+			_ = ctx.Error(err)
 		}
 
-		res := handleCommand(s, commandData)
-		ctx.JSON(http.StatusOK, res)
-	default:
-		_ = ctx.Error(fmt.Errorf("interaction type %d not implemented", body.Type))
+		return
 	}
-}
 
-const (
-	red  = 0xeb4034
-	blue = 0x4287f5
-)
+	ctx.JSON(http.StatusOK, res)
+}
 
-func handleCommand(s *Server, data interaction.ApplicationCommandInteraction) interaction.ResponseChannelMessage {
-	command := data.Data
+// errInvalidInteraction is returned for bodies that are not a valid interaction payload
+var errInvalidInteraction = errors.New("invalid interaction payload")
 
-	if !contains(s.config.Discord.AllowedGuilds, data.GuildId.Value) {
-		return interaction.NewResponseChannelMessage(interaction.ApplicationCommandCallbackData{
-			Content: "This guild is not in the allowed guilds list",
-			Flags:   uint(message.FlagEphemeral),
-		})
+// dispatchInteraction parses an authenticated interaction body and builds the response to it. It is independent of
+// gin, so that it can be driven directly by fuzz tests: any body must produce a response or an error, never a panic.
+func (s *Server) dispatchInteraction(ctx context.Context, body []byte) (any, error) {
+	var base interaction.Interaction
+	if err := json.Unmarshal(body, &base); err != nil {
+		return nil, errInvalidInteraction
 	}
 
-	switch command.Name {
-	case "lookup":
-		if len(command.Options) == 0 || (command.Options[0].Name != "email" && command.Options[0].Name != "user") {
-			return interaction.NewResponseChannelMessage(interaction.ApplicationCommandCallbackData{
-				Content: "Missing email",
-				Flags:   uint(message.FlagEphemeral),
-			})
+	switch base.Type {
+	case interaction.InteractionTypePing:
+		return interaction.NewResponsePong(), nil
+	case interaction.InteractionTypeApplicationCommand:
+		var commandData interaction.ApplicationCommandInteraction
+		if err := json.Unmarshal(body, &commandData); err != nil {
+			return nil, errors.Wrap(err, "Failed to parse application command payload")
+		}
+
+		if commandData.Data == nil {
+			return nil, errInvalidInteraction
+		}
+
+		setSentryTag(ctx, "interaction_id", strconv.FormatUint(commandData.Id, 10))
+		ctx = withGuildId(ctx, commandData.GuildId.Value)
+
+		res := handleCommand(ctx, s, commandData)
+		if message, ok := res.(interaction.ResponseChannelMessage); ok {
+			s.applyFooter(ctx, message.Data.Embeds)
 		}
 
-		s.logger.Info("Checking initial data state", zap.Bool("pledgesLoaded", s.pledges != nil), zap.Bool("discordIdMappingLoaded", s.pledgesByDiscordId != nil))
-		hasInitialData := s.pledges != nil || s.pledgesByDiscordId != nil
-		if !hasInitialData {
-			return interaction.NewResponseChannelMessage(interaction.ApplicationCommandCallbackData{
-				Content: "Initial data not loaded yet, please try again in a few minutes",
-				Flags:   uint(message.FlagEphemeral),
-			})
+		return res, nil
+	case interaction.InteractionTypeApplicationCommandAutoComplete:
+		var autocompleteData interaction.ApplicationCommandAutoCompleteInteraction
+		if err := json.Unmarshal(body, &autocompleteData); err != nil {
+			return nil, errInvalidInteraction
 		}
 
-		argType := command.Options[0].Name
-
-		var patron patreon.Patron
-
-		switch argType {
-		case "user":
-			userStr, ok := command.Options[0].Value.(string)
-			if !ok {
-				return interaction.NewResponseChannelMessage(interaction.ApplicationCommandCallbackData{
-					Content: "User was wrong type",
-					Flags:   uint(message.FlagEphemeral),
-				})
-			}
-
-			// Convert userStr to a user
-			userId, err := strconv.ParseUint(userStr, 10, 64)
-			if err != nil {
-				return interaction.NewResponseChannelMessage(interaction.ApplicationCommandCallbackData{
-					Content: "Invalid user ID",
-					Flags:   uint(message.FlagEphemeral),
-				})
-			}
-
-			s.mu.RLock()
-			patron, ok = s.pledgesByDiscordId[userId]
-			s.mu.RUnlock()
-			if !ok {
-				return interaction.NewResponseChannelMessage(interaction.ApplicationCommandCallbackData{
-					Embeds: []*embed.Embed{
-						{
-							Title:       "Account Not Found",
-							Description: fmt.Sprintf("No Patreon account with id `%d` found", userId),
-							Timestamp:   ptr(time.Now()),
-							Color:       red,
-						},
-					},
-				})
-			}
-		case "email":
-			email, ok := command.Options[0].Value.(string)
-			if !ok {
-				return interaction.NewResponseChannelMessage(interaction.ApplicationCommandCallbackData{
-					Content: "Email was wrong type",
-					Flags:   uint(message.FlagEphemeral),
-				})
-			}
-
-			s.mu.RLock()
-			patron, ok = s.pledges[email]
-			s.mu.RUnlock()
-			if !ok {
-				return interaction.NewResponseChannelMessage(interaction.ApplicationCommandCallbackData{
-					Embeds: []*embed.Embed{
-						{
-							Title:       "Account Not Found",
-							Description: fmt.Sprintf("No Patreon account with email `%s` found", email),
-							Timestamp:   ptr(time.Now()),
-							Color:       red,
-						},
-					},
-				})
-			}
+		setSentryTag(ctx, "interaction_id", strconv.FormatUint(autocompleteData.Id, 10))
+
+		return handleAutocomplete(ctx, s, autocompleteData), nil
+	case interaction.InteractionTypeMessageComponent:
+		var componentData interaction.MessageComponentInteraction
+		if err := json.Unmarshal(body, &componentData); err != nil {
+			return nil, errInvalidInteraction
 		}
 
-		var user user.User
-		if data.Member != nil {
-			user = data.Member.User
-		} else if data.User != nil {
-			user = *data.User
-		} // Other should be infallible
-
-		tiers := make([]string, len(patron.Tiers))
-		for i, tier := range patron.Tiers {
-			tierName, ok := s.config.Tiers[tier]
-			if !ok {
-				tierName = fmt.Sprintf("Unknown (ID: %d)", tier)
-			}
-
-			tiers[i] = tierName
+		setSentryTag(ctx, "interaction_id", strconv.FormatUint(componentData.Id, 10))
+		ctx = withGuildId(ctx, componentData.GuildId.Value)
+
+		// Responding with a new ephemeral message, rather than an update, leaves the message intact for those who can use
+		// the component
+		if err := s.componentDenied(componentData); err != nil {
+			return s.commandErrorMessage(ctx, err), nil
 		}
 
-		discord := "Not linked"
-		if patron.DiscordId != nil {
-			discord = fmt.Sprintf("<@%d> (%d)", *patron.DiscordId, *patron.DiscordId)
+		res := handleComponent(ctx, s, componentData)
+		s.applyFooter(ctx, res.Data.Embeds)
+		return res, nil
+	case interaction.InteractionTypeModalSubmit:
+		var modalData interaction.ModalSubmitInteraction
+		if err := json.Unmarshal(body, &modalData); err != nil {
+			return nil, errInvalidInteraction
 		}
 
-		return interaction.NewResponseChannelMessage(interaction.ApplicationCommandCallbackData{
-			Embeds: []*embed.Embed{
-				{
-					Title:     "Account Found",
-					Url:       fmt.Sprintf("https://www.patreon.com/user?u=%d", patron.Id),
-					Timestamp: ptr(time.Now()),
-					Color:     blue,
-					Author: &embed.EmbedAuthor{
-						Name:    user.Username,
-						IconUrl: user.AvatarUrl(256),
-					},
-					Fields: []*embed.EmbedField{
-						{
-							Name:   "Status",
-							Value:  patron.Attributes.PatronStatus,
-							Inline: true,
-						},
-						{
-							Name:   "Last Charge Status",
-							Value:  patron.Attributes.LastChargeStatus,
-							Inline: true,
-						},
-						{
-							Name:   "Last Charge Date",
-							Value:  fmt.Sprintf("<t:%d>", patron.Attributes.LastChargeDate.Unix()),
-							Inline: true,
-						},
-						{
-							Name:   "Join Date",
-							Value:  fmt.Sprintf("<t:%d>", patron.Attributes.PledgeRelationshipStart.Unix()),
-							Inline: true,
-						},
-						{
-							Name:   "Active Tiers",
-							Value:  strings.Join(tiers, ", "),
-							Inline: true,
-						},
-						{
-							Name:   "Discord Account",
-							Value:  discord,
-							Inline: true,
-						},
-					},
-				},
-			},
-		})
+		setSentryTag(ctx, "interaction_id", strconv.FormatUint(modalData.Id, 10))
+		ctx = withGuildId(ctx, modalData.GuildId.Value)
+
+		res := handleModal(ctx, s, modalData)
+		s.applyFooter(ctx, res.Data.Embeds)
+		return res, nil
 	default:
-		s.logger.Warn("Unknown command", zap.String("command", command.Name))
-		return interaction.NewResponseChannelMessage(interaction.ApplicationCommandCallbackData{
-			Content: "Unknown command",
-			Flags:   uint(message.FlagEphemeral),
-		})
+		return nil, fmt.Errorf("interaction type %d not implemented", base.Type)
+	}
+}
+
+// handleCommand responds to a command with a message, or with a modal for commands that open one
+func handleCommand(ctx context.Context, s *Server, data interaction.ApplicationCommandInteraction) any {
+	path, options := commandPath(data.Data)
+	setSentryTag(ctx, "command", path)
+
+	// Interactions through the user-installed app arrive without a guild in DMs, or from guilds that aren't allowed
+	command, known := commandsByPath[path]
+
+	allowedGuild := s.isAllowedGuild(data.GuildId.Value)
+	if !allowedGuild && !(command.userInstall && s.isTrustedUser(invokingUser(data.InteractionMetadata).Id)) {
+		err := newCommandError(failurePermissionDenied, "This guild is not in the allowed guilds list")
+		if data.GuildId.Value == 0 {
+			err = newCommandError(failurePermissionDenied, "You are not allowed to use this command outside of the allowed guilds")
+		}
+
+		return s.commandErrorMessage(ctx, err.withHint(
+			"Run the command in one of the guilds in `DISCORD_ALLOWED_GUILDS`. Only users in `DISCORD_TRUSTED_USERS` can look up patrons elsewhere, through the user-installed app.",
+		))
+	}
+
+	if !known {
+		s.loggerFor(ctx).Warn("Unknown command", zap.String("command", path))
+		return s.commandErrorMessage(ctx, newCommandError(failureUnknownCommand, "Unknown command `/%s`", path))
+	}
+
+	if command.permission != "" && !s.memberPermissions(data.InteractionMetadata).Has(command.permission) {
+		return s.commandErrorMessage(ctx, errMissingPermission(command.permission))
 	}
+
+	if command.writes && s.demo {
+		return s.commandErrorMessage(ctx, errDemoMode(path))
+	}
+
+	settings := s.guildSettingsFor(ctx)
+	if !settings.CommandEnabled(path) {
+		return s.commandErrorMessage(ctx, newCommandError(failurePermissionDenied, "`/%s` is disabled in this server", path).
+			withHint("An admin can enable it again with `/admin settings enable_command`."))
+	}
+
+	metrics.Commands.WithLabelValues(path).Inc()
+	defer s.recordCommandUse(path, data.InteractionMetadata, time.Now())
+
+	if command.modal != nil {
+		return command.modal(ctx, s, data)
+	}
+
+	res := command.handler(ctx, s, data, options)
+
+	// Others in the channel, such as members of another server, must not see the patron's details. Guilds can also
+	// choose to keep every response private.
+	if !allowedGuild || settings.Ephemeral {
+		res.Data.Flags |= uint(message.FlagEphemeral)
+	}
+
+	return res
+}
+
+func handleComponent(ctx context.Context, s *Server, data interaction.MessageComponentInteraction) interaction.ResponseUpdateMessage {
+	customId := componentCustomId(data.Data)
+	setSentryTag(ctx, "component", customId)
+
+	handler, ok := componentRoutes[componentName(customId)]
+	if !ok {
+		s.loggerFor(ctx).Warn("Unknown component", zap.String("custom_id", customId))
+		return updateMessage("Unknown component")
+	}
+
+	return handler(ctx, s, data)
+}
+
+// componentDenied returns the error explaining why the member can't use the component, or nil if they can. Outside
+// the allowed guilds, only trusted users can use the components of the user-installed app's responses.
+func (s *Server) componentDenied(data interaction.MessageComponentInteraction) *commandError {
+	name := componentName(componentCustomId(data.Data))
+
+	if !s.isAllowedGuild(data.GuildId.Value) &&
+		!(contains(userInstallComponents, name) && s.isTrustedUser(invokingUser(data.InteractionMetadata).Id)) {
+		return newCommandError(failurePermissionDenied, "You are not allowed to use this outside of the allowed guilds")
+	}
+
+	if permission, ok := componentPermissions[name]; ok && !s.memberPermissions(data.InteractionMetadata).Has(permission) {
+		return errMissingPermission(permission)
+	}
+
+	return nil
+}
+
+// componentCustomId returns the custom ID of the component that was used, or an empty string for unsupported types
+func componentCustomId(data interaction.MessageComponentInteractionData) string {
+	switch data := data.IMessageComponentInteractionData.(type) {
+	case interaction.ButtonInteractionData:
+		return data.CustomId
+	case interaction.SelectMenuInteractionData:
+		return data.CustomId
+	default:
+		return ""
+	}
+}
+
+// recordCommandUse records the time taken to respond to a command started at start, and who ran it
+func (s *Server) recordCommandUse(path string, data interaction.InteractionMetadata, start time.Time) {
+	duration := time.Since(start)
+	metrics.CommandDuration.WithLabelValues(path).Observe(duration.Seconds())
+
+	s.usage.Record(database.CommandUse{
+		Command:  path,
+		UserId:   invokingUser(data).Id,
+		GuildId:  data.GuildId.Value,
+		Duration: duration,
+		UsedAt:   start,
+	})
 }
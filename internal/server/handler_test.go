@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/TicketsBot/subscriptions-app/internal/server/interactiontest"
+)
+
+// FuzzDispatchInteraction checks that any authenticated body is either rejected or answered with a response that can
+// be encoded, without panicking. The corpus is seeded with each type of interaction, options of the wrong type, and
+// payloads missing the fields that handlers read.
+func FuzzDispatchInteraction(f *testing.F) {
+	harness := interactiontest.New()
+	admin := func(i interactiontest.Interaction) []byte {
+		return harness.Encode(i.As(interactiontest.DefaultUserId, interactiontest.PermissionAdministrator))
+	}
+
+	lookup := func(options ...interactiontest.Option) []byte {
+		return admin(interactiontest.Command("subscription", interactiontest.Subcommand("lookup", options...)))
+	}
+
+	seeds := [][]byte{
+		harness.Encode(interactiontest.Ping()),
+		lookup(interactiontest.User("user", testPatronDiscordId)),
+		lookup(interactiontest.String("email", testPatronEmail)),
+		lookup(interactiontest.String("email", "patron")),
+		lookup(interactiontest.String("patron_id", "12345678")),
+		lookup(interactiontest.Integer("email", 1)),
+		lookup(interactiontest.Boolean("user", true)),
+		lookup(interactiontest.String("user", "not a snowflake")),
+		lookup(),
+		admin(interactiontest.Command("subscription",
+			interactiontest.SubcommandGroup("stats", interactiontest.Subcommand("usage", interactiontest.Integer("days", 7))))),
+		admin(interactiontest.Command("subscription",
+			interactiontest.SubcommandGroup("stats", interactiontest.Subcommand("usage", interactiontest.String("days", "7"))))),
+		admin(interactiontest.Command("tiers", interactiontest.Subcommand("list"))),
+		admin(interactiontest.Command("whois", interactiontest.String("domain", "example.com"))),
+		admin(interactiontest.Command("search")),
+		harness.Encode(interactiontest.Command("subscription", interactiontest.Subcommand("lookup")).InDM()),
+		admin(interactiontest.Button("lookup_page:1:email:patron")),
+		admin(interactiontest.Button("search_page:x:")),
+		admin(interactiontest.SelectMenu("lookup_select", "12345678")),
+		admin(interactiontest.SelectMenu("lookup_select")),
+		[]byte(`{"type":4,"guild_id":"100000000000000003","member":{"user":{"id":"100000000000000004"},"permissions":"8"},` +
+			`"data":{"name":"subscription","options":[{"name":"lookup","type":1,"options":[{"name":"username","type":3,"value":"pat","focused":true}]}]}}`),
+		[]byte(`{"type":5,"guild_id":"100000000000000003","member":{"user":{"id":"100000000000000004"},"permissions":"8"},` +
+			`"data":{"custom_id":"search","components":[{"type":1,"components":[{"type":4,"custom_id":"status","value":"active"}]}]}}`),
+		[]byte(`{"type":2}`),
+		[]byte(`{"type":2,"data":null}`),
+		[]byte(`{"type":3,"data":{}}`),
+		[]byte(`{"type":5}`),
+		[]byte(`{"type":99}`),
+		[]byte(`{}`),
+		[]byte(`not json`),
+	}
+
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	s := newTestServer(f, harness.PublicKey)
+
+	f.Fuzz(func(t *testing.T, body []byte) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		res, err := s.dispatchInteraction(ctx, body)
+		if err != nil {
+			return
+		}
+
+		if res == nil {
+			t.Fatal("no response or error")
+		}
+
+		if _, err := json.Marshal(res); err != nil {
+			t.Fatalf("failed to encode response: %v", err)
+		}
+	})
+}
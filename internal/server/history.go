@@ -0,0 +1,255 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TicketsBot-cloud/gdl/objects/channel/embed"
+	"github.com/TicketsBot-cloud/gdl/objects/interaction"
+	"github.com/TicketsBot/subscriptions-app/internal/currency"
+	"github.com/TicketsBot/subscriptions-app/internal/database"
+	"github.com/TicketsBot/subscriptions-app/internal/entitlements"
+	"github.com/TicketsBot/subscriptions-app/internal/events"
+	"github.com/TicketsBot/subscriptions-app/internal/rbac"
+	"go.uber.org/zap"
+)
+
+// historyPageSize is the number of events shown on each page of /subscription history
+const historyPageSize = 15
+
+// historyPageView routes the page buttons of /subscription history, whose state is the patron ID
+const historyPageView = "history_page"
+
+var historyCommand = command{
+	path:        "subscription history",
+	description: "List the latest changes to a patron's pledge",
+	options: []interaction.ApplicationCommandOption{
+		{
+			Type:        interaction.OptionTypeString,
+			Name:        "email",
+			Description: "The Patreon email address of the patron",
+			Required:    false,
+		},
+		{
+			Type:        interaction.OptionTypeUser,
+			Name:        "user",
+			Description: "The Discord account of the patron",
+			Required:    false,
+		},
+		{
+			Type:        interaction.OptionTypeString,
+			Name:        "patron_id",
+			Description: "The Patreon user ID of the patron, required for former patrons",
+			Required:    false,
+		},
+		{
+			Type:        interaction.OptionTypeString,
+			Name:        "username",
+			Description: "A linked patron's Discord username, suggested as you type",
+			Required:    false,
+		},
+	},
+	permission:  rbac.Read,
+	userInstall: true,
+	handler:     handleHistoryCommand,
+	autocomplete: map[string]autocompleteHandler{
+		"username": usernameChoices,
+	},
+}
+
+// handleHistoryCommand lists the latest events recorded for a patron. Former patrons no longer have entitlements, so
+// can only be found by patron ID.
+func handleHistoryCommand(
+	ctx context.Context,
+	s *Server,
+	data interaction.ApplicationCommandInteraction,
+	options []interaction.ApplicationCommandInteractionDataOption,
+) interaction.ResponseChannelMessage {
+	if len(options) == 0 {
+		return s.commandErrorMessage(ctx, errMissingLookupOption)
+	}
+
+	option := options[0]
+	if option.Name == "username" {
+		var err error
+		if option, err = usernameOption(s, option); err != nil {
+			return s.commandErrorMessage(ctx, err)
+		}
+	}
+
+	var patronId uint64
+	if option.Name == "patron_id" {
+		var err error
+		if patronId, err = patronIdOption(option); err != nil {
+			return s.commandErrorMessage(ctx, err)
+		}
+	} else {
+		if !s.entitlements.Loaded() {
+			return s.commandErrorMessage(ctx, errDataNotLoaded)
+		}
+
+		found, notFound, err := findEntitlements(ctx, s, option)
+		if err != nil {
+			return s.commandErrorMessage(ctx, err)
+		}
+
+		var ok bool
+		if patronId, ok = patreonPatronId(found); !ok {
+			return s.commandErrorMessage(ctx, s.notFoundError(notFound).withHint(
+				"Former patrons can only be found by patron ID, which is the number at the end of their Patreon profile URL, after `?u=`.",
+			))
+		}
+	}
+
+	// The state is built from a valid patron ID, so rendering only fails if the history can't be fetched
+	p, errorMessage := renderHistoryPage(ctx, s, strconv.FormatUint(patronId, 10), 0)
+	if errorMessage != "" {
+		return s.errorMessage(ctx, errorMessage)
+	}
+
+	return paginatedMessage(historyPageView, strconv.FormatUint(patronId, 10), p)
+}
+
+// renderHistoryPage renders a page of the events recorded for the patron whose ID is the state
+func renderHistoryPage(ctx context.Context, s *Server, state string, index int) (page, string) {
+	patronId, err := strconv.ParseUint(state, 10, 64)
+	if err != nil {
+		return page{}, "Invalid patron ID"
+	}
+
+	total, err := s.db.PatronHistory.CountByPatron(ctx, patronId)
+	if err != nil {
+		s.loggerFor(ctx).Error("Failed to count patron history", zap.Uint64("patron_id", patronId), zap.Error(err))
+		return page{}, "Failed to fetch patron history, please try again later"
+	}
+
+	start, _, shown, count := pageBounds(total, historyPageSize, index)
+	entries, err := s.db.PatronHistory.ByPatron(ctx, patronId, historyPageSize, start)
+	if err != nil {
+		s.loggerFor(ctx).Error("Failed to fetch patron history", zap.Uint64("patron_id", patronId), zap.Error(err))
+		return page{}, "Failed to fetch patron history, please try again later"
+	}
+
+	return page{
+		Embed: historyEmbed(s.embedStyle(ctx), patronId, entries, s.tierName, s.converter.Convert, s.converter.Base(), time.Now()),
+		Index: shown,
+		Count: count,
+	}, ""
+}
+
+// patreonPatronId returns the patron ID of the Patreon entitlement among found, if any
+func patreonPatronId(found []entitlements.Entitlement) (uint64, bool) {
+	for _, entitlement := range found {
+		if entitlement.Source != entitlements.PatreonSource {
+			continue
+		}
+
+		if patronId, err := strconv.ParseUint(entitlement.Reference, 10, 64); err == nil {
+			return patronId, true
+		}
+	}
+
+	return 0, false
+}
+
+// historyEmbed lists the patron's events, newest first, with tiers named by tierName and amounts in baseCurrency. Amounts
+// pledged in other currencies are also shown converted by toBase, if there is a rate for them.
+func historyEmbed(
+	style embedStyle,
+	patronId uint64,
+	entries []database.PatronHistoryEntry,
+	tierName func(tierId uint64) string,
+	toBase func(cents int, currency string) (int, bool),
+	baseCurrency string,
+	now time.Time,
+) *embed.Embed {
+	e := &embed.Embed{
+		Title:     fmt.Sprintf("History of Patron %d", patronId),
+		Url:       style.patronUrl(patronId),
+		Timestamp: ptr(now),
+		Color:     style.PrimaryColor,
+	}
+
+	if len(entries) == 0 {
+		e.Description = "No events have been recorded for this patron"
+		return e
+	}
+
+	lines := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		line := formatHistoryEntry(entry, tierName, toBase, baseCurrency)
+		if len(strings.Join(append(lines, line), "\n")) > maxFieldLength {
+			break
+		}
+
+		lines = append(lines, line)
+	}
+
+	e.Description = strings.Join(lines, "\n")
+	return e
+}
+
+func formatHistoryEntry(
+	entry database.PatronHistoryEntry,
+	tierName func(tierId uint64) string,
+	toBase func(cents int, currency string) (int, bool),
+	baseCurrency string,
+) string {
+	at := entry.CreatedAt
+	if entry.EffectiveAt != nil {
+		at = *entry.EffectiveAt
+	}
+
+	line := fmt.Sprintf("<t:%d:d> **%s**", at.Unix(), entry.Event)
+
+	// Entries are recorded from events, but show the event type alone if the details can't be read
+	var event events.Event
+	if err := json.Unmarshal(entry.Details, &event); err != nil {
+		return line
+	}
+
+	tierNames := func(tierIds []uint64) string {
+		if len(tierIds) == 0 {
+			return "None"
+		}
+
+		names := make([]string, len(tierIds))
+		for i, tierId := range tierIds {
+			names[i] = tierName(tierId)
+		}
+
+		return strings.Join(names, ", ")
+	}
+
+	amount := func(cents int) string {
+		if event.Currency == "" || strings.EqualFold(event.Currency, baseCurrency) {
+			return currency.Format(cents, baseCurrency)
+		}
+
+		formatted := currency.Format(cents, event.Currency)
+		if converted, ok := toBase(cents, event.Currency); ok {
+			formatted += fmt.Sprintf(" ≈ %s", currency.Format(converted, baseCurrency))
+		}
+
+		return formatted
+	}
+
+	switch events.Type(entry.Event) {
+	case events.TypeNew, events.TypeRenew, events.TypeDecline:
+		line += fmt.Sprintf(": %s (%s)", tierNames(event.Tiers), amount(event.AmountCents))
+	case events.TypeCancel:
+		line += fmt.Sprintf(": %s (%s)", tierNames(event.PreviousTiers), amount(event.PreviousAmountCents))
+	default:
+		line += fmt.Sprintf(
+			": %s → %s (%s → %s)",
+			tierNames(event.PreviousTiers), tierNames(event.Tiers),
+			amount(event.PreviousAmountCents), amount(event.AmountCents),
+		)
+	}
+
+	return line
+}
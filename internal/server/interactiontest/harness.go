@@ -0,0 +1,179 @@
+// Package interactiontest drives Discord interactions through the server's router without a live Discord app. It
+// builds interaction payloads, signs them with a key generated for the test, and decodes the responses.
+//
+//	harness := interactiontest.New()
+//	conf.Discord.PublicKey = harness.PublicKey
+//	harness.Handler = server.NewServer(conf, ...).Router()
+//
+//	res, err := harness.Respond(interactiontest.Command("subscription",
+//		interactiontest.Subcommand("lookup", interactiontest.String("email", "a@example.com"))))
+package interactiontest
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/TicketsBot-cloud/gdl/objects/interaction"
+)
+
+// Harness signs interactions and sends them to Handler, at the /interaction route
+type Harness struct {
+	Handler   http.Handler
+	PublicKey string // Hex encoded, for config.Discord.PublicKey
+
+	privateKey ed25519.PrivateKey
+	nextId     atomic.Uint64
+}
+
+// Response is the response to an application command or component interaction
+type Response struct {
+	Type interaction.ResponseType                   `json:"type"`
+	Data interaction.ApplicationCommandCallbackData `json:"data"`
+}
+
+func New() *Harness {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		panic(fmt.Sprintf("failed to generate key: %v", err))
+	}
+
+	return NewWithKey(privateKey)
+}
+
+// NewWithKey creates a harness that signs with an existing key, such as one matching the public key configured on a
+// running instance
+func NewWithKey(privateKey ed25519.PrivateKey) *Harness {
+	return &Harness{
+		PublicKey:  hex.EncodeToString(privateKey.Public().(ed25519.PublicKey)),
+		privateKey: privateKey,
+	}
+}
+
+// Send signs and sends the interaction, returning the raw response
+func (h *Harness) Send(i Interaction) *httptest.ResponseRecorder {
+	return h.SendBody(h.Encode(i))
+}
+
+// SendBody signs and sends a raw payload, which may be malformed
+func (h *Harness) SendBody(body []byte) *httptest.ResponseRecorder {
+	timestamp, signature := h.Sign(body)
+	return h.SendSigned(body, timestamp, signature)
+}
+
+// Sign returns the X-Signature-Timestamp and X-Signature-Ed25519 headers for a payload sent now
+func (h *Harness) Sign(body []byte) (timestamp, signature string) {
+	timestamp = strconv.FormatInt(time.Now().Unix(), 10)
+	return timestamp, hex.EncodeToString(ed25519.Sign(h.privateKey, append([]byte(timestamp), body...)))
+}
+
+// SendSigned sends a payload with the given signature headers, which are omitted if empty, to test authentication
+func (h *Harness) SendSigned(body []byte, timestamp, signature string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/interaction", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	if timestamp != "" {
+		req.Header.Set("X-Signature-Timestamp", timestamp)
+	}
+
+	if signature != "" {
+		req.Header.Set("X-Signature-Ed25519", signature)
+	}
+
+	recorder := httptest.NewRecorder()
+	h.Handler.ServeHTTP(recorder, req)
+	return recorder
+}
+
+// Respond sends the interaction and decodes the response, which must be successful
+func (h *Harness) Respond(i Interaction) (Response, error) {
+	recorder := h.Send(i)
+	if recorder.Code != http.StatusOK {
+		return Response{}, fmt.Errorf("interaction returned %d status code: %s", recorder.Code, recorder.Body.String())
+	}
+
+	var res Response
+	if err := json.Unmarshal(recorder.Body.Bytes(), &res); err != nil {
+		return Response{}, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return res, nil
+}
+
+// Encode returns the payload that Discord would send for the interaction. Each payload has a new interaction ID.
+func (h *Harness) Encode(i Interaction) []byte {
+	payload := payload{
+		Type:          i.Type,
+		Version:       1,
+		Id:            strconv.FormatUint(h.nextId.Add(1), 10),
+		ApplicationId: strconv.FormatUint(DefaultApplicationId, 10),
+		ChannelId:     strconv.FormatUint(DefaultChannelId, 10),
+		Token:         "interactiontest",
+		Data:          i.data,
+	}
+
+	invoker := &user{
+		Id:       strconv.FormatUint(i.UserId, 10),
+		Username: i.Username,
+	}
+
+	if i.GuildId != 0 {
+		payload.GuildId = ptr(strconv.FormatUint(i.GuildId, 10))
+		payload.Member = &member{
+			User:        invoker,
+			Permissions: strconv.FormatUint(i.Permissions, 10),
+			Roles:       make([]string, len(i.Roles)),
+		}
+
+		for j, roleId := range i.Roles {
+			payload.Member.Roles[j] = strconv.FormatUint(roleId, 10)
+		}
+	} else {
+		payload.User = invoker
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		panic(fmt.Sprintf("failed to encode interaction: %v", err))
+	}
+
+	return body
+}
+
+type (
+	payload struct {
+		Type          interaction.InteractionType `json:"type"`
+		Version       uint8                       `json:"version"`
+		Id            string                      `json:"id"`
+		ApplicationId string                      `json:"application_id"`
+		GuildId       *string                     `json:"guild_id"`
+		ChannelId     string                      `json:"channel_id"`
+		Member        *member                     `json:"member,omitempty"`
+		User          *user                       `json:"user,omitempty"`
+		Token         string                      `json:"token"`
+		Data          any                         `json:"data,omitempty"`
+	}
+
+	member struct {
+		User        *user    `json:"user"`
+		Permissions string   `json:"permissions"`
+		Roles       []string `json:"roles"`
+	}
+
+	user struct {
+		Id       string `json:"id"`
+		Username string `json:"username"`
+	}
+)
+
+func ptr[T any](value T) *T {
+	return &value
+}
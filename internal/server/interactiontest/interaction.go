@@ -0,0 +1,161 @@
+package interactiontest
+
+import (
+	"strconv"
+
+	"github.com/TicketsBot-cloud/gdl/objects/interaction"
+	"github.com/TicketsBot-cloud/gdl/objects/interaction/component"
+)
+
+// The IDs that interactions are sent with, unless overridden
+const (
+	DefaultApplicationId uint64 = 100000000000000001
+	DefaultChannelId     uint64 = 100000000000000002
+	DefaultGuildId       uint64 = 100000000000000003
+	DefaultUserId        uint64 = 100000000000000004
+)
+
+// PermissionAdministrator can be passed to As, to invoke commands with every permission
+const PermissionAdministrator uint64 = 1 << 3
+
+// Interaction is an interaction to send. By default, it is sent from DefaultGuildId by DefaultUserId, without any
+// permissions.
+type Interaction struct {
+	Type        interaction.InteractionType
+	GuildId     uint64 // Unset for interactions in DMs, which have a user rather than a member
+	UserId      uint64
+	Username    string
+	Permissions uint64   // The member's permissions in the guild
+	Roles       []uint64 // The IDs of the member's roles in the guild
+
+	data any
+}
+
+// Option is an application command option, which may be a subcommand with options of its own
+type Option struct {
+	Name    string                                   `json:"name"`
+	Type    interaction.ApplicationCommandOptionType `json:"type"`
+	Value   any                                      `json:"value,omitempty"`
+	Options []Option                                 `json:"options,omitempty"`
+}
+
+func Ping() Interaction {
+	return Interaction{Type: interaction.InteractionTypePing}
+}
+
+// Command is a slash command invocation
+func Command(name string, options ...Option) Interaction {
+	return newInteraction(interaction.InteractionTypeApplicationCommand, commandData{
+		Id:      strconv.FormatUint(commandId(name), 10),
+		Name:    name,
+		Type:    interaction.ApplicationCommandTypeChatInput,
+		Options: options,
+	})
+}
+
+// Button is a click of the button with the custom ID
+func Button(customId string) Interaction {
+	return newInteraction(interaction.InteractionTypeMessageComponent, componentData{
+		ComponentType: component.ComponentButton,
+		CustomId:      customId,
+	})
+}
+
+// SelectMenu is a selection of values from the select menu with the custom ID
+func SelectMenu(customId string, values ...string) Interaction {
+	if values == nil {
+		values = []string{}
+	}
+
+	return newInteraction(interaction.InteractionTypeMessageComponent, componentData{
+		ComponentType: component.ComponentSelectMenu,
+		CustomId:      customId,
+		Values:        values,
+	})
+}
+
+func newInteraction(interactionType interaction.InteractionType, data any) Interaction {
+	return Interaction{
+		Type:     interactionType,
+		GuildId:  DefaultGuildId,
+		UserId:   DefaultUserId,
+		Username: "interactiontest",
+		data:     data,
+	}
+}
+
+// InGuild returns the interaction sent from the guild
+func (i Interaction) InGuild(guildId uint64) Interaction {
+	i.GuildId = guildId
+	return i
+}
+
+// InDM returns the interaction sent from a DM
+func (i Interaction) InDM() Interaction {
+	i.GuildId = 0
+	return i
+}
+
+// As returns the interaction sent by the user, with the permissions
+func (i Interaction) As(userId uint64, permissions uint64) Interaction {
+	i.UserId = userId
+	i.Permissions = permissions
+	return i
+}
+
+// WithRoles returns the interaction sent by a member with the roles
+func (i Interaction) WithRoles(roleIds ...uint64) Interaction {
+	i.Roles = roleIds
+	return i
+}
+
+func String(name, value string) Option {
+	return Option{Name: name, Type: interaction.OptionTypeString, Value: value}
+}
+
+// Integer options are sent as JSON numbers, so are decoded as float64 like those sent by Discord
+func Integer(name string, value int) Option {
+	return Option{Name: name, Type: interaction.OptionTypeInteger, Value: value}
+}
+
+func Boolean(name string, value bool) Option {
+	return Option{Name: name, Type: interaction.OptionTypeBoolean, Value: value}
+}
+
+// User options are sent as the user's ID
+func User(name string, userId uint64) Option {
+	return Option{Name: name, Type: interaction.OptionTypeUser, Value: strconv.FormatUint(userId, 10)}
+}
+
+func Subcommand(name string, options ...Option) Option {
+	return Option{Name: name, Type: interaction.OptionTypeSubCommand, Options: options}
+}
+
+func SubcommandGroup(name string, subcommands ...Option) Option {
+	return Option{Name: name, Type: interaction.OptionTypeSubCommandGroup, Options: subcommands}
+}
+
+type (
+	commandData struct {
+		Id      string                             `json:"id"`
+		Name    string                             `json:"name"`
+		Type    interaction.ApplicationCommandType `json:"type"`
+		Options []Option                           `json:"options,omitempty"`
+	}
+
+	componentData struct {
+		ComponentType component.ComponentType `json:"component_type"`
+		CustomId      string                  `json:"custom_id"`
+		Values        []string                `json:"values,omitempty"`
+	}
+)
+
+// commandId derives a stable ID for the command from its name
+func commandId(name string) uint64 {
+	id := uint64(1469598103934665603)
+	for _, c := range []byte(name) {
+		id = (id ^ uint64(c)) * 1099511628211
+	}
+
+	return id >> 1
+}
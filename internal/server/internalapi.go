@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// RunInternalApi serves the API routes on the internal listener, over TLS, only accepting clients that present a
+// certificate signed by the configured CA. API keys are also required if any are set. The listener is shut down once
+// the context is cancelled.
+func (s *Server) RunInternalApi(ctx context.Context) error {
+	conf := s.currentConfig().InternalApi
+
+	caPem, err := os.ReadFile(conf.ClientCaFile)
+	if err != nil {
+		return errors.Wrap(err, "failed to read client CA file")
+	}
+
+	clientCas := x509.NewCertPool()
+	if !clientCas.AppendCertsFromPEM(caPem) {
+		return errors.New("client CA file contains no PEM encoded certificates")
+	}
+
+	server := &http.Server{
+		Addr:    conf.Addr,
+		Handler: s.InternalApiRouter(),
+		TLSConfig: &tls.Config{
+			ClientAuth: tls.RequireAndVerifyClientCert,
+			ClientCAs:  clientCas,
+			MinVersion: tls.VersionTLS12,
+		},
+		ReadHeaderTimeout: time.Second * 10,
+	}
+
+	s.logger.Info("Serving internal API", zap.String("address", conf.Addr))
+	return serveUntilDone(ctx, server, func() error {
+		return server.ListenAndServeTLS(conf.CertFile, conf.KeyFile)
+	})
+}
+
+// InternalApiRouter builds the router for the internal listener, which serves only the API routes
+func (s *Server) InternalApiRouter() *gin.Engine {
+	router := s.newRouter()
+
+	handlers := []gin.HandlerFunc{s.AllowNetworks(apiAllowlist)}
+	if s.currentConfig().HasApiCredentials() {
+		handlers = append(handlers, s.AuthenticateApiKey)
+	}
+
+	s.registerApi(router.Group("/api", handlers...))
+	return router
+}
+
+// clientCertificateSubject returns the subject of the verified client certificate of an internal API request, so that
+// calls can be traced to the service that made them
+func clientCertificateSubject(ctx *gin.Context) (string, bool) {
+	state := ctx.Request.TLS
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return "", false
+	}
+
+	return state.VerifiedChains[0][0].Subject.String(), true
+}
@@ -0,0 +1,29 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/TicketsBot/subscriptions-app/internal/legacy"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const maxImportSize = 32 << 20 // 32 MiB
+
+// HandleImportLegacyKeys imports a legacy premium key dump, sent as the CSV request body
+func (s *Server) HandleImportLegacyKeys(ctx *gin.Context) {
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, maxImportSize)
+
+	imported, err := legacy.Import(ctx.Request.Context(), s.store, s.emails, ctx.Request.Body)
+	if err != nil {
+		s.loggerFor(ctx.Request.Context()).Warn("Failed to import legacy keys", zap.Error(err))
+		ctx.JSON(400, errorJson(err.Error()))
+		return
+	}
+
+	s.loggerFor(ctx.Request.Context()).Info("Imported legacy keys", zap.Int("count", imported))
+
+	ctx.JSON(200, gin.H{
+		"imported": imported,
+	})
+}
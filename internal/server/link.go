@@ -0,0 +1,76 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/TicketsBot-cloud/gdl/objects/channel/embed"
+	"github.com/TicketsBot-cloud/gdl/objects/channel/message"
+	"github.com/TicketsBot-cloud/gdl/objects/interaction"
+	"github.com/TicketsBot/subscriptions-app/internal/sources"
+	"go.uber.org/zap"
+)
+
+var linkCommand = command{
+	path:        "link",
+	description: "Link a purchase to your Discord account using its license key",
+	options: []interaction.ApplicationCommandOption{
+		{
+			Type:        interaction.OptionTypeString,
+			Name:        "license_key",
+			Description: "The license key sent to you after purchasing",
+			Required:    true,
+		},
+	},
+	handler: handleLinkCommand,
+}
+
+// handleLinkCommand links the invoking user's Discord account to a purchase, by proving ownership of its license key
+func handleLinkCommand(
+	ctx context.Context,
+	s *Server,
+	data interaction.ApplicationCommandInteraction,
+	options []interaction.ApplicationCommandInteractionDataOption,
+) interaction.ResponseChannelMessage {
+	if s.providers.LemonSqueezy == nil {
+		return ephemeralMessage("Account linking is not enabled")
+	}
+
+	keyOption, ok := findOption(options, "license_key")
+	if !ok {
+		return ephemeralMessage("Missing license key")
+	}
+
+	key, ok := stringValue(keyOption)
+	if !ok {
+		return ephemeralMessage("License key was wrong type")
+	}
+
+	user := invokingUser(data.InteractionMetadata)
+
+	email, err := s.providers.LemonSqueezy.LinkLicense(ctx, key, user.Id)
+	if err != nil {
+		if errors.Is(err, sources.ErrLicenseInvalid) {
+			return ephemeralMessage("That license key is not valid")
+		}
+
+		s.loggerFor(ctx).Error("Failed to link license key", zap.Uint64("user_id", user.Id), zap.Error(err))
+		return s.errorMessage(ctx, "Failed to link your account, please try again later")
+	}
+
+	s.loggerFor(ctx).Info("Account linked", zap.Uint64("user_id", user.Id))
+
+	return interaction.NewResponseChannelMessage(interaction.ApplicationCommandCallbackData{
+		Embeds: []*embed.Embed{
+			{
+				Title:       "Account Linked",
+				Description: fmt.Sprintf("Purchases made with `%s` are now linked to your Discord account.", s.emails.Display(email)),
+				Timestamp:   ptr(time.Now()),
+				Color:       s.primaryColor(ctx),
+			},
+		},
+		Flags: uint(message.FlagEphemeral),
+	})
+}
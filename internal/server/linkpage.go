@@ -0,0 +1,216 @@
+package server
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/TicketsBot/subscriptions-app/internal/linking"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const linkSessionCookie = "link_session"
+
+var linkPageTemplate = template.Must(template.New("link").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body { font-family: system-ui, sans-serif; background: #f4f5f7; color: #1f2328; margin: 0; }
+main { max-width: 480px; margin: 12vh auto; background: #fff; border-radius: 8px; padding: 32px; box-shadow: 0 1px 3px rgba(0, 0, 0, .1); }
+h1 { font-size: 1.4em; margin-top: 0; }
+a.button { display: inline-block; background: {{.Color}}; color: #fff; padding: 10px 18px; border-radius: 4px; text-decoration: none; }
+footer { margin-top: 24px; font-size: .85em; color: #656d76; }
+</style>
+</head>
+<body>
+<main>
+<h1>{{.Title}}</h1>
+<p>{{.Message}}</p>
+{{if .ButtonUrl}}<a class="button" href="{{.ButtonUrl}}">{{.ButtonText}}</a>{{end}}
+{{if .Footer}}<footer>{{.Footer}}</footer>{{end}}
+</main>
+</body>
+</html>
+`))
+
+type linkPage struct {
+	Title, Message        string
+	ButtonUrl, ButtonText string
+	Color                 template.CSS
+	Footer                string
+}
+
+// registerLinkPage adds the routes of the link page, where patrons link their Patreon account to their Discord account
+// by signing in to both
+func (s *Server) registerLinkPage(router *gin.Engine) {
+	router.GET("/link", s.HandleLinkPage)
+	router.GET("/link/discord", s.HandleLinkDiscord)
+	router.GET(linking.DiscordCallbackPath, s.HandleLinkDiscordCallback)
+	router.GET(linking.PatreonCallbackPath, s.HandleLinkPatreonCallback)
+}
+
+// HandleLinkPage explains the page, with a button to sign in with Discord
+func (s *Server) HandleLinkPage(ctx *gin.Context) {
+	s.renderLinkPage(ctx, 200, linkPage{
+		Title:      "Link your Patreon membership",
+		Message:    "Sign in with Discord, then with Patreon, to receive the premium of your Patreon membership on your Discord account.",
+		ButtonUrl:  "/link/discord",
+		ButtonText: "Sign in with Discord",
+	})
+}
+
+// HandleLinkDiscord starts a session and redirects to Discord's consent page
+func (s *Server) HandleLinkDiscord(ctx *gin.Context) {
+	session, err := linking.NewSession(time.Now())
+	if err != nil {
+		s.linkPageError(ctx, 500, "Failed to start signing in, please try again later.", err)
+		return
+	}
+
+	if !s.setLinkSession(ctx, session) {
+		return
+	}
+
+	ctx.Redirect(http.StatusFound, s.linking.DiscordAuthorizeUrl(session.State))
+}
+
+// HandleLinkDiscordCallback records the Discord account the patron signed in to, then redirects to Patreon's consent
+// page
+func (s *Server) HandleLinkDiscordCallback(ctx *gin.Context) {
+	session, ok := s.linkCallbackSession(ctx)
+	if !ok {
+		return
+	}
+
+	discordId, err := s.linking.IdentifyDiscord(ctx.Request.Context(), ctx.Query("code"))
+	if err != nil {
+		s.linkPageError(ctx, 502, "Failed to sign in with Discord, please try again.", err)
+		return
+	}
+
+	// The state is replaced, so that the Discord callback's state can't be reused for Patreon
+	next, err := linking.NewSession(time.Now())
+	if err != nil {
+		s.linkPageError(ctx, 500, "Failed to continue signing in, please try again later.", err)
+		return
+	}
+
+	next.DiscordId = discordId
+	next.ExpiresAt = session.ExpiresAt
+
+	if !s.setLinkSession(ctx, next) {
+		return
+	}
+
+	ctx.Redirect(http.StatusFound, s.linking.PatreonAuthorizeUrl(next.State))
+}
+
+// HandleLinkPatreonCallback links the Patreon account the patron signed in to with their Discord account
+func (s *Server) HandleLinkPatreonCallback(ctx *gin.Context) {
+	session, ok := s.linkCallbackSession(ctx)
+	if !ok {
+		return
+	}
+
+	if session.DiscordId == 0 {
+		s.renderLinkPageRetry(ctx, 400, "Please sign in with Discord first.")
+		return
+	}
+
+	patronId, err := s.linking.IdentifyPatron(ctx.Request.Context(), ctx.Query("code"))
+	if err != nil {
+		s.linkPageError(ctx, 502, "Failed to sign in with Patreon, please try again.", err)
+		return
+	}
+
+	if err := s.linking.Link(ctx.Request.Context(), patronId, session.DiscordId); err != nil {
+		s.linkPageError(ctx, 500, "Failed to link your accounts, please try again later.", err)
+		return
+	}
+
+	s.loggerFor(ctx.Request.Context()).Info("Patron linked through the link page",
+		zap.Uint64("patron_id", patronId),
+		zap.Uint64("discord_id", session.DiscordId),
+	)
+
+	s.clearLinkSession(ctx)
+	s.renderLinkPage(ctx, 200, linkPage{
+		Title:   "Accounts linked",
+		Message: "Your Patreon account is now linked to your Discord account. Your premium will be applied within a few minutes.",
+	})
+}
+
+// linkCallbackSession returns the session of a provider's callback, after checking that the state matches, or renders
+// an error page
+func (s *Server) linkCallbackSession(ctx *gin.Context) (linking.Session, bool) {
+	if ctx.Query("error") != "" {
+		s.clearLinkSession(ctx)
+		s.renderLinkPageRetry(ctx, 400, "Signing in was cancelled.")
+		return linking.Session{}, false
+	}
+
+	value, err := ctx.Cookie(linkSessionCookie)
+	if err != nil {
+		s.renderLinkPageRetry(ctx, 400, "Your session has expired, please start again.")
+		return linking.Session{}, false
+	}
+
+	session, err := s.linking.Decode(value, time.Now())
+	if err != nil || session.State != ctx.Query("state") {
+		s.clearLinkSession(ctx)
+		s.renderLinkPageRetry(ctx, 400, "Your session has expired, please start again.")
+		return linking.Session{}, false
+	}
+
+	return session, true
+}
+
+func (s *Server) setLinkSession(ctx *gin.Context, session linking.Session) bool {
+	value, err := s.linking.Encode(session)
+	if err != nil {
+		s.linkPageError(ctx, 500, "Failed to start signing in, please try again later.", err)
+		return false
+	}
+
+	ctx.SetSameSite(http.SameSiteLaxMode) // Lax, so that the cookie is sent when the provider redirects back
+	ctx.SetCookie(linkSessionCookie, value, int(time.Until(session.ExpiresAt).Seconds()), "/link", "", s.linking.Secure(), true)
+	return true
+}
+
+func (s *Server) clearLinkSession(ctx *gin.Context) {
+	ctx.SetSameSite(http.SameSiteLaxMode)
+	ctx.SetCookie(linkSessionCookie, "", -1, "/link", "", s.linking.Secure(), true)
+}
+
+func (s *Server) linkPageError(ctx *gin.Context, status int, message string, err error) {
+	s.loggerFor(ctx.Request.Context()).Error("Link page error", zap.Int("status", status), zap.Error(err))
+	s.renderLinkPageRetry(ctx, status, message)
+}
+
+func (s *Server) renderLinkPageRetry(ctx *gin.Context, status int, message string) {
+	s.renderLinkPage(ctx, status, linkPage{
+		Title:      "Something went wrong",
+		Message:    message,
+		ButtonUrl:  "/link",
+		ButtonText: "Start again",
+	})
+}
+
+func (s *Server) renderLinkPage(ctx *gin.Context, status int, page linkPage) {
+	branding := s.currentConfig().Branding
+	page.Color = template.CSS(fmt.Sprintf("#%06x", int(branding.PrimaryColor)))
+	page.Footer = branding.FooterText
+
+	ctx.Header("Content-Type", "text/html; charset=utf-8")
+	ctx.Header("Cache-Control", "no-store")
+	ctx.Status(status)
+
+	if err := linkPageTemplate.Execute(ctx.Writer, page); err != nil {
+		s.loggerFor(ctx.Request.Context()).Error("Failed to render link page", zap.Error(err))
+	}
+}
@@ -0,0 +1,644 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TicketsBot-cloud/gdl/objects/channel/embed"
+	"github.com/TicketsBot-cloud/gdl/objects/interaction"
+	"github.com/TicketsBot-cloud/gdl/objects/interaction/component"
+	"github.com/TicketsBot-cloud/gdl/objects/user"
+	"github.com/TicketsBot/subscriptions-app/internal/entitlements"
+	"github.com/TicketsBot/subscriptions-app/internal/privacy"
+	"github.com/TicketsBot/subscriptions-app/internal/rbac"
+	"github.com/TicketsBot/subscriptions-app/pkg/patreon"
+	"go.uber.org/zap"
+)
+
+var lookupCommand = command{
+	path:        "subscription lookup",
+	description: "Look up information about a user's subscription",
+	options: []interaction.ApplicationCommandOption{
+		{
+			Type:        interaction.OptionTypeString,
+			Name:        "email",
+			Description: "The Patreon email address of the user to lookup",
+			Required:    false,
+		},
+		{
+			Type:        interaction.OptionTypeUser,
+			Name:        "user",
+			Description: "The Discord Id of the user to lookup",
+			Required:    false,
+		},
+		{
+			Type:        interaction.OptionTypeString,
+			Name:        "patron_id",
+			Description: "The Patreon user ID of the patron to lookup",
+			Required:    false,
+		},
+		{
+			Type:        interaction.OptionTypeString,
+			Name:        "username",
+			Description: "A linked patron's Discord username, suggested as you type",
+			Required:    false,
+		},
+	},
+	permission:  rbac.Read,
+	userInstall: true,
+	handler:     handleLookupCommand,
+	autocomplete: map[string]autocompleteHandler{
+		"username": usernameChoices,
+	},
+}
+
+func handleLookupCommand(
+	ctx context.Context,
+	s *Server,
+	data interaction.ApplicationCommandInteraction,
+	options []interaction.ApplicationCommandInteractionDataOption,
+) interaction.ResponseChannelMessage {
+	if len(options) == 0 || (options[0].Name != "email" && options[0].Name != "user" && options[0].Name != "patron_id" && options[0].Name != "username") {
+		return s.commandErrorMessage(ctx, errMissingLookupOption)
+	}
+
+	option := options[0]
+	if option.Name == "username" {
+		var err error
+		if option, err = usernameOption(s, option); err != nil {
+			return s.commandErrorMessage(ctx, err)
+		}
+	}
+
+	if !s.entitlements.Loaded() {
+		return s.commandErrorMessage(ctx, errDataNotLoaded)
+	}
+
+	candidates, query := lookupCandidates(s, option)
+	if len(candidates) > 1 {
+		state := lookupPageState(option)
+		return paginatedMessage(lookupPageView, state, candidatesPage(query, candidates, state, 0))
+	} else if len(candidates) == 1 && option.Name == "email" {
+		// A single partial match is looked up as though its full email had been entered
+		option.Value = candidates[0].Email
+	}
+
+	found, notFound, err := findEntitlements(ctx, s, option)
+	if err != nil {
+		return s.commandErrorMessage(ctx, err)
+	}
+
+	found = s.visibleEntitlements(ctx, found)
+
+	// Unlike other errors, the result is shown to the channel, as it answers the lookup
+	var e *embed.Embed
+	if len(found) == 0 {
+		e = errorEmbed(s.embedStyle(ctx), s.notFoundError(notFound), time.Now())
+	} else {
+		e = lookupEmbed(s.embedStyle(ctx), invokingUser(data.InteractionMetadata), s.patronProfile(ctx, found), found, notFound.message, time.Now())
+	}
+
+	return interaction.NewResponseChannelMessage(interaction.ApplicationCommandCallbackData{
+		Embeds: []*embed.Embed{withDataAsOf(e, s.lastSyncedAt())},
+	})
+}
+
+// lookupSelectId is the custom ID of the select menu offered when a lookup matches several patrons
+const lookupSelectId = "lookup_select"
+
+// lookupMenuSize is the number of options that a select menu can hold, so the number of candidates on each page
+const lookupMenuSize = 25
+
+// maxLookupCandidates is the number of patrons matching part of an email that are offered
+const maxLookupCandidates = 100
+
+// lookupPageView routes the page buttons of the candidates menu, whose state is the option name and value, separated by
+// a colon
+const lookupPageView = "lookup_page"
+
+// lookupCandidates returns the patrons that an email or user option may refer to, and a description of the option to
+// show alongside them. Emails that no patron has exactly are matched against part of each email.
+func lookupCandidates(
+	s *Server,
+	option interaction.ApplicationCommandInteractionDataOption,
+) ([]patreon.Patron, string) {
+	value, ok := stringValue(option)
+	if !ok {
+		return nil, ""
+	}
+
+	switch option.Name {
+	case "email":
+		// One more than is offered is fetched, to tell whether any were left out
+		return s.entitlements.PatronsByEmail(value, maxLookupCandidates+1), fmt.Sprintf("`%s`", s.emails.Display(value))
+	case "user":
+		userId, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return nil, ""
+		}
+
+		return s.entitlements.PatronsByDiscordId(userId), fmt.Sprintf("<@%d>", userId)
+	default:
+		return nil, ""
+	}
+}
+
+// lookupPageState encodes the option that the candidates were found by in the state of the page buttons
+func lookupPageState(option interaction.ApplicationCommandInteractionDataOption) string {
+	value, _ := stringValue(option)
+	return option.Name + ":" + value
+}
+
+// renderLookupPage finds the candidates again from the option encoded by lookupPageState, and renders a page of them
+func renderLookupPage(_ context.Context, s *Server, state string, index int) (page, string) {
+	name, value, ok := strings.Cut(state, ":")
+	if !ok {
+		return page{}, "Invalid lookup"
+	}
+
+	if !s.entitlements.Loaded() {
+		return page{}, "Initial data not loaded yet, please try again in a few minutes"
+	}
+
+	candidates, query := lookupCandidates(s, interaction.ApplicationCommandInteractionDataOption{Name: name, Value: value})
+	if len(candidates) == 0 {
+		return page{}, "No patrons match the lookup anymore"
+	}
+
+	return candidatesPage(query, candidates, state, index), ""
+}
+
+// candidatesPage asks which of the patrons matching the query to look up, with a select menu of the page's patrons
+// handled by handleLookupSelect. If the state is too long for the page buttons, only the first page is offered.
+func candidatesPage(query string, candidates []patreon.Patron, state string, index int) page {
+	content := fmt.Sprintf("%d patrons match %s, choose one to look up", len(candidates), query)
+	if len(candidates) > maxLookupCandidates {
+		content = fmt.Sprintf("More than %d patrons match %s, choose one to look up", maxLookupCandidates, query)
+		candidates = candidates[:maxLookupCandidates]
+	}
+
+	if pages := (len(candidates) + lookupMenuSize - 1) / lookupMenuSize; !pageStateFits(lookupPageView, state, pages) {
+		content += fmt.Sprintf(" (showing the first %d)", lookupMenuSize)
+		candidates = candidates[:min(len(candidates), lookupMenuSize)]
+	}
+
+	start, end, shown, count := pageBounds(len(candidates), lookupMenuSize, index)
+
+	options := make([]component.SelectOption, 0, end-start)
+	for _, patron := range candidates[start:end] {
+		label := privacy.Masked(patron.Email)
+		if label == "" {
+			label = fmt.Sprintf("Patron %d", patron.Id)
+		}
+
+		status := patron.PatronStatus
+		if status == "" {
+			status = "never pledged"
+		}
+
+		description := fmt.Sprintf("ID %d, %s", patron.Id, status)
+		if patron.DiscordId != nil {
+			description += ", Discord linked"
+		}
+
+		options = append(options, component.SelectOption{
+			Label:       truncate(label, selectOptionLimit),
+			Value:       strconv.FormatUint(patron.Id, 10),
+			Description: truncate(description, selectOptionLimit),
+		})
+	}
+
+	return page{
+		Content: content,
+		Components: []component.Component{
+			component.BuildActionRow(component.BuildSelectMenu(component.SelectMenu{
+				CustomId:    lookupSelectId,
+				Options:     options,
+				Placeholder: "Choose a patron",
+			})),
+		},
+		Index: shown,
+		Count: count,
+	}
+}
+
+// selectOptionLimit is the maximum length of the label and description of a select menu option
+const selectOptionLimit = 100
+
+// handleLookupSelect replaces the menu offered by candidatesPage with the lookup of the chosen patron
+func handleLookupSelect(
+	ctx context.Context,
+	s *Server,
+	data interaction.MessageComponentInteraction,
+) interaction.ResponseUpdateMessage {
+	selectMenu, ok := data.Data.IMessageComponentInteractionData.(interaction.SelectMenuInteractionData)
+	if !ok || len(selectMenu.Values) != 1 {
+		return updateMessage("No patron was chosen")
+	}
+
+	patronId, err := strconv.ParseUint(selectMenu.Values[0], 10, 64)
+	if err != nil {
+		return updateMessage("Invalid patron ID")
+	}
+
+	found := s.visibleEntitlements(ctx, s.entitlements.ByPatronId(patronId))
+	if len(found) == 0 {
+		return updateMessage(fmt.Sprintf("Patron `%d` is no longer a member", patronId))
+	}
+
+	e := lookupEmbed(s.embedStyle(ctx), invokingUser(data.InteractionMetadata), s.patronProfile(ctx, found), found, "", time.Now())
+	return interaction.NewResponseUpdateMessage(interaction.ResponseUpdateMessageData{
+		Content:    ptr(""),
+		Embeds:     []*embed.Embed{withDataAsOf(e, s.lastSyncedAt())},
+		Components: []component.Component{},
+	})
+}
+
+// visibleEntitlements leaves out the entitlements to tiers hidden in the guild's settings
+func (s *Server) visibleEntitlements(ctx context.Context, found []entitlements.Entitlement) []entitlements.Entitlement {
+	settings := s.guildSettingsFor(ctx)
+	return slices.DeleteFunc(slices.Clone(found), func(entitlement entitlements.Entitlement) bool {
+		return !settings.TierVisible(entitlement.TierId)
+	})
+}
+
+// errMissingLookupOption is returned when a lookup is run without any of its options
+var errMissingLookupOption = newCommandError(failureInvalidOption, "Missing email").
+	withHint("Look the patron up by one of the options: `email`, `user`, `username` or `patron_id`.")
+
+// findEntitlements finds the entitlements of the user described by an email, user or patron_id option, and the error
+// that describes there being none. If the option is invalid, a *commandError is returned instead. Entitlements must
+// have been loaded.
+func findEntitlements(
+	ctx context.Context,
+	s *Server,
+	option interaction.ApplicationCommandInteractionDataOption,
+) (found []entitlements.Entitlement, notFound *commandError, err error) {
+	var sourceErr error
+
+	switch option.Name {
+	case "user":
+		userStr, ok := stringValue(option)
+		if !ok {
+			return nil, nil, newCommandError(failureInvalidOption, "User was wrong type")
+		}
+
+		// Convert userStr to a user
+		userId, parseErr := strconv.ParseUint(userStr, 10, 64)
+		if parseErr != nil {
+			return nil, nil, newCommandError(failureInvalidOption, "Invalid user ID")
+		}
+
+		found, sourceErr = s.entitlements.ByDiscordId(ctx, userId)
+		notFound = newCommandError(failureNotLinked, "No Patreon account with id `%d` found", userId)
+	case "email":
+		email, ok := stringValue(option)
+		if !ok {
+			return nil, nil, newCommandError(failureInvalidOption, "Email was wrong type")
+		}
+
+		found, sourceErr = s.entitlements.ByEmail(ctx, email)
+		notFound = newCommandError(failureNotFound, "No Patreon account with email `%s` found", s.emails.Display(email))
+	case "patron_id":
+		patronId, err := patronIdOption(option)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		found = s.entitlements.ByPatronId(patronId)
+		notFound = newCommandError(failureNotFound, "No Patreon account with patron ID `%d` found", patronId)
+	default:
+		return nil, nil, errMissingLookupOption
+	}
+
+	// Results from the sources that succeeded are still shown
+	if sourceErr != nil {
+		s.loggerFor(ctx).Error("Failed to look up entitlements", zap.Error(sourceErr))
+	}
+
+	return found, notFound, nil
+}
+
+// patronIdOption parses a patron_id option, returning a *commandError if it is invalid
+func patronIdOption(option interaction.ApplicationCommandInteractionDataOption) (uint64, error) {
+	patronIdStr, ok := stringValue(option)
+	if !ok {
+		return 0, newCommandError(failureInvalidOption, "Patron ID was wrong type")
+	}
+
+	patronId, err := strconv.ParseUint(strings.TrimSpace(patronIdStr), 10, 64)
+	if err != nil {
+		return 0, newCommandError(failureInvalidOption, "Invalid patron ID").
+			withHint("Patron IDs are the number at the end of the patron's Patreon profile URL, after `?u=`.")
+	}
+
+	return patronId, nil
+}
+
+// lookupEmbed describes the patron's Patreon membership, if any, and lists their subscriptions from other sources.
+// found must not be empty.
+func lookupEmbed(
+	style embedStyle,
+	author user.User,
+	profile *user.User,
+	found []entitlements.Entitlement,
+	notFoundMessage string,
+	now time.Time,
+) *embed.Embed {
+	var patreon, others []entitlements.Entitlement
+	for _, entitlement := range found {
+		if entitlement.Source == entitlements.PatreonSource {
+			patreon = append(patreon, entitlement)
+		} else {
+			others = append(others, entitlement)
+		}
+	}
+
+	e := &embed.Embed{
+		Title:     "Account Found",
+		Timestamp: ptr(now),
+		Color:     style.PrimaryColor,
+		Author: &embed.EmbedAuthor{
+			Name:    author.Username,
+			IconUrl: author.AvatarUrl(256),
+		},
+	}
+
+	if len(patreon) > 0 {
+		if patronId, err := strconv.ParseUint(patreon[0].Reference, 10, 64); err == nil {
+			e.Url = style.patronUrl(patronId)
+		}
+
+		e.Fields = patronFields(patreon, profile)
+
+		if profile != nil {
+			if avatarUrl := profile.AvatarUrl(256); avatarUrl != "" {
+				e.Thumbnail = &embed.EmbedThumbnail{Url: avatarUrl}
+			}
+		}
+
+		if duplicates := patreon[0].DuplicateReferences; len(duplicates) > 0 {
+			e.Fields = append(e.Fields, &embed.EmbedField{
+				Name:   "Other Members With This Email",
+				Value:  formatPatronReferences(style, duplicates),
+				Inline: false,
+			})
+		}
+	} else {
+		e.Description = notFoundMessage
+	}
+
+	if len(others) > 0 {
+		e.Fields = append(e.Fields, &embed.EmbedField{
+			Name:   "Other Subscriptions",
+			Value:  formatEntitlements(others),
+			Inline: false,
+		})
+	}
+
+	return e
+}
+
+// profileTimeout bounds how long a lookup waits for the patron's Discord profile, as the response must be sent within
+// Discord's 3 second deadline
+const profileTimeout = time.Second
+
+// patronProfile returns the Discord profile of the account linked to the patron, or nil if the patron hasn't linked
+// one or its profile can't be fetched in time. Profiles are cached, so most lookups don't wait on Discord.
+func (s *Server) patronProfile(ctx context.Context, found []entitlements.Entitlement) *user.User {
+	for _, entitlement := range found {
+		if entitlement.Source != entitlements.PatreonSource || entitlement.DiscordId == nil {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, profileTimeout)
+		defer cancel()
+
+		profile, ok := s.usernames.Profile(ctx, *entitlement.DiscordId)
+		if !ok {
+			return nil
+		}
+
+		return &profile
+	}
+
+	return nil
+}
+
+// withDataAsOf shows when the Patreon data was last synced in the footer, so that staff know how fresh the answer is.
+// Footers don't render timestamp markup, so the embed's timestamp is set to the sync time instead, which Discord shows
+// after the footer text in the viewer's timezone. The embed is unchanged if the sync time is unknown.
+func withDataAsOf(e *embed.Embed, syncedAt *time.Time) *embed.Embed {
+	if syncedAt == nil {
+		return e
+	}
+
+	e.Footer = &embed.EmbedFooter{Text: "Data as of"}
+	e.Timestamp = syncedAt
+	return e
+}
+
+// formatPatronReferences links to each patron, by their ID
+func formatPatronReferences(style embedStyle, references []string) string {
+	links := make([]string, 0, len(references))
+	for _, reference := range references {
+		patronId, err := strconv.ParseUint(reference, 10, 64)
+		if err != nil {
+			continue
+		}
+
+		links = append(links, fmt.Sprintf("[%d](%s)", patronId, style.patronUrl(patronId)))
+	}
+
+	return strings.Join(links, ", ")
+}
+
+// patronFields describes a patron from their Patreon entitlements, which share the patron's details and differ only by
+// tier, naming their Discord account if its profile is known
+func patronFields(patron []entitlements.Entitlement, profile *user.User) []*embed.EmbedField {
+	var tiers []string
+	for _, entitlement := range patron {
+		if entitlement.TierId == 0 {
+			continue
+		}
+
+		tier := entitlement.Tier
+		if entitlement.RoleId != 0 {
+			tier += fmt.Sprintf(" (<@&%d>)", entitlement.RoleId)
+		}
+
+		tiers = append(tiers, tier)
+	}
+
+	activeTiers := "None"
+	if len(tiers) > 0 {
+		activeTiers = strings.Join(tiers, ", ")
+	}
+
+	details := patron[0]
+
+	// Tiers may have different grace periods, so access lasts until the latest expiry
+	var expiresAt *time.Time
+	for _, entitlement := range patron {
+		if entitlement.PremiumExpiresAt != nil && (expiresAt == nil || entitlement.PremiumExpiresAt.After(*expiresAt)) {
+			expiresAt = entitlement.PremiumExpiresAt
+		}
+	}
+
+	premiumExpires := "Unknown"
+	if expiresAt != nil {
+		premiumExpires = fmt.Sprintf("<t:%d:R>", expiresAt.Unix())
+	}
+
+	discord := "Not linked"
+	if details.DiscordId != nil {
+		discord = fmt.Sprintf("<@%d> (%d)", *details.DiscordId, *details.DiscordId)
+		if profile != nil && profile.Id == *details.DiscordId {
+			discord = fmt.Sprintf("<@%d> (`%s`, %d)", *details.DiscordId, profile.Username, *details.DiscordId)
+		}
+	}
+
+	// Gifted memberships were paid for by someone else, so the patron can't be refunded for them
+	billing := formatCadence(details.CadenceMonths)
+	if details.Gifted {
+		billing = "Gifted, paid for by someone else"
+	}
+
+	// Former patrons who are no longer listed by Patreon have never been charged, as far as the app knows
+	lastChargeStatus := details.LastChargeStatus
+	if lastChargeStatus == "" {
+		lastChargeStatus = "Unknown"
+	}
+
+	fields := []*embed.EmbedField{
+		{
+			Name:   "Status",
+			Value:  details.Status,
+			Inline: true,
+		},
+		{
+			Name:   "Last Charge Status",
+			Value:  lastChargeStatus,
+			Inline: true,
+		},
+		{
+			Name:   "Last Charge Date",
+			Value:  formatTimestamp(details.LastChargeAt),
+			Inline: true,
+		},
+		{
+			Name:   "Join Date",
+			Value:  formatTimestamp(details.StartsAt),
+			Inline: true,
+		},
+		{
+			Name:   "Active Tiers",
+			Value:  activeTiers,
+			Inline: true,
+		},
+		{
+			Name:   "Premium Expires",
+			Value:  premiumExpires,
+			Inline: true,
+		},
+		{
+			Name:   "Discord Account",
+			Value:  discord,
+			Inline: true,
+		},
+		{
+			Name:   "Billing",
+			Value:  billing,
+			Inline: true,
+		},
+		{
+			Name:   "Next Charge Date",
+			Value:  formatNextCharge(details.NextChargeAt),
+			Inline: true,
+		},
+	}
+
+	if details.Former != nil {
+		fields = append(fields, &embed.EmbedField{
+			Name:   "Pledge Ended",
+			Value:  formatFormerPledge(details.Former),
+			Inline: false,
+		})
+	}
+
+	return fields
+}
+
+// formatFormerPledge says when a former patron's pledge ended, and which tiers they last pledged to
+func formatFormerPledge(former *entitlements.FormerPledge) string {
+	value := fmt.Sprintf("<t:%d:D>", former.EndedAt.Unix())
+	if len(former.LastTiers) > 0 {
+		value += fmt.Sprintf(", last pledged to %s", strings.Join(former.LastTiers, ", "))
+	}
+
+	return value
+}
+
+// formatCadence describes how often the patron is charged, from the months paid for by each charge
+func formatCadence(months int) string {
+	switch months {
+	case 0:
+		return "Unknown"
+	case 1:
+		return "Monthly"
+	case 12:
+		return "Annual"
+	default:
+		return fmt.Sprintf("Every %d months", months)
+	}
+}
+
+func formatNextCharge(t *time.Time) string {
+	if t == nil {
+		return "None"
+	}
+
+	return fmt.Sprintf("<t:%d:D>", t.Unix())
+}
+
+func formatTimestamp(t *time.Time) string {
+	if t == nil {
+		return "Never"
+	}
+
+	return fmt.Sprintf("<t:%d>", t.Unix())
+}
+
+// embedFieldLimit is the maximum length of an embed field value
+const embedFieldLimit = 1024
+
+func formatEntitlements(entitlements []entitlements.Entitlement) string {
+	var b strings.Builder
+	for i, entitlement := range entitlements {
+		line := fmt.Sprintf("**%s**: %s (%s", entitlement.Source, entitlement.Tier, entitlement.Status)
+		if entitlement.GraceEndsAt != nil && entitlement.Active {
+			line += fmt.Sprintf(", grace period until <t:%d:D>", entitlement.GraceEndsAt.Unix())
+		} else if entitlement.EndsAt != nil {
+			line += fmt.Sprintf(", until <t:%d:D>", entitlement.EndsAt.Unix())
+		}
+
+		line += ")\n"
+
+		if b.Len()+len(line) > embedFieldLimit {
+			remaining := fmt.Sprintf("... and %d more", len(entitlements)-i)
+			if b.Len()+len(remaining) <= embedFieldLimit {
+				b.WriteString(remaining)
+			}
+
+			break
+		}
+
+		b.WriteString(line)
+	}
+
+	return strings.TrimSuffix(b.String(), "\n")
+}
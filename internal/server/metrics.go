@@ -0,0 +1,41 @@
+package server
+
+import (
+	"crypto/subtle"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TicketsBot/subscriptions-app/internal/metrics"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// RecordMetrics records the count and duration of each request, labelled by the matched route rather than the raw
+// path, to keep cardinality bounded
+func (s *Server) RecordMetrics(ctx *gin.Context) {
+	start := time.Now()
+	ctx.Next()
+
+	route := ctx.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+
+	method := ctx.Request.Method
+	metrics.HttpRequests.WithLabelValues(method, route, strconv.Itoa(ctx.Writer.Status())).Inc()
+	metrics.HttpRequestDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+}
+
+// HandleMetrics serves the Prometheus metrics, requiring a bearer token if one is configured
+func (s *Server) HandleMetrics(ctx *gin.Context) {
+	if metricsToken := s.currentConfig().MetricsToken; metricsToken != "" {
+		token, _ := strings.CutPrefix(ctx.GetHeader("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(metricsToken)) != 1 {
+			ctx.AbortWithStatusJSON(401, errorJson("Invalid token"))
+			return
+		}
+	}
+
+	promhttp.Handler().ServeHTTP(ctx.Writer, ctx.Request)
+}
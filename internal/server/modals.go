@@ -0,0 +1,60 @@
+package server
+
+import (
+	"context"
+
+	"github.com/TicketsBot-cloud/gdl/objects/channel/message"
+	"github.com/TicketsBot-cloud/gdl/objects/interaction"
+	"go.uber.org/zap"
+)
+
+// modalHandler responds to the submission of a modal opened by a command
+type modalHandler func(
+	ctx context.Context,
+	s *Server,
+	data interaction.ModalSubmitInteraction,
+) interaction.ResponseChannelMessage
+
+// modalRoutes maps the custom ID of each modal to the handler of its submissions
+var modalRoutes = map[string]modalHandler{
+	searchModalId: handleSearchModal,
+}
+
+func handleModal(ctx context.Context, s *Server, data interaction.ModalSubmitInteraction) interaction.ResponseChannelMessage {
+	customId := data.Data.CustomId
+	setSentryTag(ctx, "modal", customId)
+
+	if !s.isAllowedGuild(data.GuildId.Value) {
+		return s.commandErrorMessage(ctx, newCommandError(failurePermissionDenied, "This guild is not in the allowed guilds list"))
+	}
+
+	handler, ok := modalRoutes[customId]
+	if !ok {
+		s.loggerFor(ctx).Warn("Unknown modal", zap.String("custom_id", customId))
+		return s.commandErrorMessage(ctx, newCommandError(failureUnknownCommand, "Unknown modal"))
+	}
+
+	if permission, ok := modalPermissions[customId]; ok && !s.memberPermissions(data.InteractionMetadata).Has(permission) {
+		return s.commandErrorMessage(ctx, errMissingPermission(permission))
+	}
+
+	res := handler(ctx, s, data)
+	if s.guildSettingsFor(ctx).Ephemeral {
+		res.Data.Flags |= uint(message.FlagEphemeral)
+	}
+
+	return res
+}
+
+// modalValues returns the values of the modal's text inputs, by custom ID. Inputs left empty are included as empty
+// strings.
+func modalValues(data interaction.ModalSubmitInteractionData) map[string]string {
+	values := make(map[string]string)
+	for _, row := range data.Components {
+		for _, input := range row.Components {
+			values[input.CustomId] = input.Value
+		}
+	}
+
+	return values
+}
@@ -0,0 +1,33 @@
+package server
+
+import (
+	"math"
+
+	"github.com/TicketsBot-cloud/gdl/objects/interaction"
+)
+
+// maxIntegerOption is the largest magnitude that Discord allows for integer options
+const maxIntegerOption = 1 << 53
+
+// stringValue returns the value of an option sent as a string, which includes user and snowflake options
+func stringValue(option interaction.ApplicationCommandInteractionDataOption) (string, bool) {
+	value, ok := option.Value.(string)
+	return value, ok
+}
+
+// integerValue returns the value of an integer option. Integer options are decoded as float64, so values that are not
+// whole numbers or are out of range are rejected, rather than converted to an arbitrary int.
+func integerValue(option interaction.ApplicationCommandInteractionDataOption) (int, bool) {
+	value, ok := option.Value.(float64)
+	if !ok || value != math.Trunc(value) || math.Abs(value) > maxIntegerOption {
+		return 0, false
+	}
+
+	return int(value), true
+}
+
+// booleanValue returns the value of a boolean option
+func booleanValue(option interaction.ApplicationCommandInteractionDataOption) (bool, bool) {
+	value, ok := option.Value.(bool)
+	return value, ok
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/TicketsBot-cloud/gdl/objects/channel/embed"
+	"github.com/TicketsBot-cloud/gdl/objects/interaction"
+	"github.com/TicketsBot-cloud/gdl/objects/interaction/component"
+)
+
+// customIdLimit is the maximum length of a component's custom ID
+const customIdLimit = 100
+
+// pageIndicatorId is the custom ID of the disabled button between the previous and next buttons, which shows the page
+const pageIndicatorId = "page_indicator"
+
+// page is one page of a paginated response
+type page struct {
+	Content    string
+	Embed      *embed.Embed
+	Components []component.Component // Shown above the page buttons, such as a select menu of the results on the page
+	Index      int
+	Count      int
+}
+
+// pageRenderer renders a page of a paginated response from the state encoded in its buttons. Indexes past the last
+// page render the last page. If the page can't be rendered, a message to replace the response with is returned.
+type pageRenderer func(ctx context.Context, s *Server, state string, index int) (page, string)
+
+// paginated returns the component handler for the previous and next buttons of a paginated response. The buttons'
+// custom IDs hold the page to show and the state to render it from, so that no state is kept between interactions.
+func paginated(view string, render pageRenderer) componentHandler {
+	return func(ctx context.Context, s *Server, data interaction.MessageComponentInteraction) interaction.ResponseUpdateMessage {
+		index, state, ok := parsePageButtonId(view, componentCustomId(data.Data))
+		if !ok {
+			return updateMessage("Invalid page")
+		}
+
+		p, errorMessage := render(ctx, s, state, index)
+		if errorMessage != "" {
+			return updateMessage(errorMessage)
+		}
+
+		embeds := []*embed.Embed{}
+		if p.Embed != nil {
+			embeds = append(embeds, p.Embed)
+		}
+
+		return interaction.NewResponseUpdateMessage(interaction.ResponseUpdateMessageData{
+			Content:    &p.Content,
+			Embeds:     embeds,
+			Components: p.components(view, state),
+		})
+	}
+}
+
+// paginatedMessage responds to a command with the first page of a paginated response
+func paginatedMessage(view, state string, p page) interaction.ResponseChannelMessage {
+	data := interaction.ApplicationCommandCallbackData{
+		Content:    p.Content,
+		Components: p.components(view, state),
+	}
+
+	if p.Embed != nil {
+		data.Embeds = []*embed.Embed{p.Embed}
+	}
+
+	return interaction.NewResponseChannelMessage(data)
+}
+
+// components returns the page's own components, followed by the previous and next buttons if there are other pages.
+// The buttons are left out if the state is too long to fit in their custom IDs, so only the first page can be shown.
+func (p page) components(view, state string) []component.Component {
+	components := append([]component.Component{}, p.Components...)
+	if p.Count <= 1 || !pageStateFits(view, state, p.Count) {
+		return components
+	}
+
+	return append(components, component.BuildActionRow(
+		component.BuildButton(component.Button{
+			Label:    "Previous",
+			CustomId: pageButtonId(view, max(p.Index-1, 0), state),
+			Style:    component.ButtonStyleSecondary,
+			Disabled: p.Index == 0,
+		}),
+		component.BuildButton(component.Button{
+			Label:    fmt.Sprintf("%d / %d", p.Index+1, p.Count),
+			CustomId: pageIndicatorId,
+			Style:    component.ButtonStyleSecondary,
+			Disabled: true,
+		}),
+		component.BuildButton(component.Button{
+			Label:    "Next",
+			CustomId: pageButtonId(view, min(p.Index+1, p.Count-1), state),
+			Style:    component.ButtonStyleSecondary,
+			Disabled: p.Index == p.Count-1,
+		}),
+	))
+}
+
+// pageStateFits returns whether the state fits in the custom IDs of the buttons of every page
+func pageStateFits(view, state string, pages int) bool {
+	return len(pageButtonId(view, max(pages-1, 0), state)) <= customIdLimit
+}
+
+// pageButtonId encodes the page and state in a custom ID routed to the view's handler. The state is last, so that it
+// may contain colons.
+func pageButtonId(view string, index int, state string) string {
+	return fmt.Sprintf("%s:%d:%s", view, index, state)
+}
+
+// parsePageButtonId returns the page and state encoded in a custom ID by pageButtonId
+func parsePageButtonId(view, customId string) (int, string, bool) {
+	rest, ok := strings.CutPrefix(customId, view+":")
+	if !ok {
+		return 0, "", false
+	}
+
+	indexStr, state, ok := strings.Cut(rest, ":")
+	if !ok {
+		return 0, "", false
+	}
+
+	index, err := strconv.Atoi(indexStr)
+	if err != nil || index < 0 {
+		return 0, "", false
+	}
+
+	return index, state, true
+}
+
+// pageBounds returns the start and end of the items on a page, and the page shown, which is the last page if the index
+// is past it. There is always at least one page, even if there are no items.
+func pageBounds(items, perPage, index int) (start, end, shown, count int) {
+	count = max((items+perPage-1)/perPage, 1)
+	shown = min(index, count-1)
+	start = shown * perPage
+	end = min(start+perPage, items)
+	return start, end, shown, count
+}
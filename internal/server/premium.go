@@ -0,0 +1,166 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/TicketsBot-cloud/gdl/objects/channel/embed"
+	"github.com/TicketsBot-cloud/gdl/objects/channel/message"
+	"github.com/TicketsBot-cloud/gdl/objects/interaction"
+	"github.com/TicketsBot/subscriptions-app/internal/allocations"
+	"github.com/TicketsBot/subscriptions-app/internal/database"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// serverIdOption returns the server_id option of a premium subcommand, or an error message to respond with
+func serverIdOption(options []interaction.ApplicationCommandInteractionDataOption) (uint64, string) {
+	serverOption, ok := findOption(options, "server_id")
+	if !ok {
+		return 0, "Missing server ID"
+	}
+
+	serverIdStr, ok := stringValue(serverOption)
+	if !ok {
+		return 0, "Server ID was wrong type"
+	}
+
+	guildId, err := strconv.ParseUint(serverIdStr, 10, 64)
+	if err != nil {
+		return 0, "Invalid server ID"
+	}
+
+	return guildId, ""
+}
+
+var premiumAssignCommand = command{
+	path:        "premium assign",
+	description: "Assign your premium to a server",
+	options: []interaction.ApplicationCommandOption{
+		{
+			Type:        interaction.OptionTypeString,
+			Name:        "server_id",
+			Description: "The ID of the server to assign premium to",
+			Required:    true,
+		},
+	},
+	handler: handlePremiumAssign,
+	writes:  true,
+}
+
+func handlePremiumAssign(
+	ctx context.Context,
+	s *Server,
+	data interaction.ApplicationCommandInteraction,
+	options []interaction.ApplicationCommandInteractionDataOption,
+) interaction.ResponseChannelMessage {
+	guildId, errorMessage := serverIdOption(options)
+	if errorMessage != "" {
+		return ephemeralMessage(errorMessage)
+	}
+
+	user := invokingUser(data.InteractionMetadata)
+
+	limit, err := s.allocations.Assign(ctx, user.Id, guildId)
+	if err != nil {
+		switch {
+		case errors.Is(err, allocations.ErrNotEntitled):
+			return ephemeralMessage("You don't have an active subscription")
+		case errors.Is(err, database.ErrAlreadyAllocated):
+			return ephemeralMessage("You have already assigned premium to that server")
+		case errors.Is(err, database.ErrAllocationLimit):
+			return ephemeralMessage(fmt.Sprintf("You have already assigned premium to %d server(s), the most your tier allows. Use `/premium remove` to free one up.", limit))
+		}
+
+		s.loggerFor(ctx).Error("Failed to assign premium", zap.Uint64("user_id", user.Id), zap.Uint64("guild_id", guildId), zap.Error(err))
+		return s.errorMessage(ctx, "Failed to assign premium, please try again later")
+	}
+
+	return interaction.NewResponseChannelMessage(interaction.ApplicationCommandCallbackData{
+		Embeds: []*embed.Embed{
+			{
+				Title:       "Premium Assigned",
+				Description: fmt.Sprintf("Server `%d` now has premium. Your tier allows up to %d server(s).", guildId, limit),
+				Timestamp:   ptr(time.Now()),
+				Color:       s.primaryColor(ctx),
+			},
+		},
+		Flags: uint(message.FlagEphemeral),
+	})
+}
+
+var premiumRemoveCommand = command{
+	path:        "premium remove",
+	description: "Remove your premium from a server",
+	options: []interaction.ApplicationCommandOption{
+		{
+			Type:        interaction.OptionTypeString,
+			Name:        "server_id",
+			Description: "The ID of the server to remove premium from",
+			Required:    true,
+		},
+	},
+	handler: handlePremiumRemove,
+	writes:  true,
+}
+
+func handlePremiumRemove(
+	ctx context.Context,
+	s *Server,
+	data interaction.ApplicationCommandInteraction,
+	options []interaction.ApplicationCommandInteractionDataOption,
+) interaction.ResponseChannelMessage {
+	guildId, errorMessage := serverIdOption(options)
+	if errorMessage != "" {
+		return ephemeralMessage(errorMessage)
+	}
+
+	user := invokingUser(data.InteractionMetadata)
+
+	removed, err := s.allocations.Remove(ctx, user.Id, guildId)
+	if err != nil {
+		s.loggerFor(ctx).Error("Failed to remove premium", zap.Uint64("user_id", user.Id), zap.Uint64("guild_id", guildId), zap.Error(err))
+		return s.errorMessage(ctx, "Failed to remove premium, please try again later")
+	}
+
+	if !removed {
+		return ephemeralMessage("You haven't assigned premium to that server")
+	}
+
+	return interaction.NewResponseChannelMessage(interaction.ApplicationCommandCallbackData{
+		Embeds: []*embed.Embed{
+			{
+				Title:       "Premium Removed",
+				Description: fmt.Sprintf("Your premium is no longer assigned to server `%d`.", guildId),
+				Timestamp:   ptr(time.Now()),
+				Color:       s.primaryColor(ctx),
+			},
+		},
+		Flags: uint(message.FlagEphemeral),
+	})
+}
+
+// HandleGetGuildPremium returns whether a guild has premium, for the bot to check
+func (s *Server) HandleGetGuildPremium(ctx *gin.Context) {
+	guildId, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(400, errorJson("Invalid guild ID"))
+		return
+	}
+
+	if !s.entitlements.Loaded() {
+		ctx.JSON(503, errorJson("Initial data not loaded yet"))
+		return
+	}
+
+	status, err := s.allocations.Status(ctx.Request.Context(), guildId)
+	if err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(200, status)
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/TicketsBot-cloud/gdl/objects/interaction"
+	"github.com/TicketsBot/subscriptions-app/internal/rbac"
+	"github.com/gin-gonic/gin"
+)
+
+// componentPermissions are the permissions needed to use the components attached to staff commands' responses
+var componentPermissions = map[string]rbac.Permission{
+	lookupSelectId:  rbac.Read,
+	lookupPageView:  rbac.Read,
+	historyPageView: rbac.Read,
+	tiersPageView:   rbac.Read,
+	syncRefreshId:   rbac.Read,
+	syncNowId:       rbac.Admin,
+	searchPageView:  rbac.Export,
+}
+
+// modalPermissions are the permissions needed to submit the modals opened by staff commands. Members who lose the
+// permission while the modal is open can't submit it.
+var modalPermissions = map[string]rbac.Permission{
+	searchModalId: rbac.Export,
+}
+
+// memberPermissions returns the permissions of the member who triggered the interaction. Members hold the permissions
+// of each of their roles, and administrators hold every permission. If no roles are configured, members with the
+// Manage Server permission hold every permission, and others can only read, leaving Discord's command permissions to
+// decide who can run the read commands. Outside the allowed guilds, trusted users can only read.
+func (s *Server) memberPermissions(data interaction.InteractionMetadata) rbac.Set {
+	if !s.isAllowedGuild(data.GuildId.Value) {
+		if s.isTrustedUser(invokingUser(data).Id) {
+			return rbac.Set{rbac.Read}
+		}
+
+		return nil
+	}
+
+	if data.Member == nil {
+		return nil
+	}
+
+	if data.Member.Permissions&permissionAdministrator == permissionAdministrator {
+		return rbac.All
+	}
+
+	roles := s.currentConfig().Rbac.Roles
+	if len(roles) == 0 {
+		if hasPermission(data.Member.Permissions, permissionManageGuild) {
+			return rbac.All
+		}
+
+		return rbac.Set{rbac.Read}
+	}
+
+	var held rbac.Set
+	for _, roleId := range data.Member.Roles {
+		value, ok := roles[roleId]
+		if !ok {
+			continue
+		}
+
+		// Permissions are validated when the config is loaded
+		if permissions, err := rbac.ParseSet(value); err == nil {
+			held = held.Union(permissions)
+		}
+	}
+
+	return held
+}
+
+// apiKeyPermissionsKey is the context key holding the permissions of the API key that authenticated the request
+const apiKeyPermissionsKey = "api_key_permissions"
+
+// apiKeyPermissions returns the permissions of an API key. Keys without configured permissions hold every permission.
+func (s *Server) apiKeyPermissions(key string) rbac.Set {
+	permissions, ok := s.currentConfig().Rbac.ApiKeys[key]
+	if !ok {
+		return rbac.All
+	}
+
+	set, err := rbac.ParseSet(permissions)
+	if err != nil {
+		return nil
+	}
+
+	return set
+}
+
+// RequirePermission rejects API requests whose key doesn't hold the permission. Requests to a listener that doesn't
+// require API keys, such as the internal listener authenticated by client certificates, hold every permission.
+func (s *Server) RequirePermission(permission rbac.Permission) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		held := rbac.All
+		if value, ok := ctx.Get(apiKeyPermissionsKey); ok {
+			held, _ = value.(rbac.Set)
+		}
+
+		if !held.Has(permission) {
+			ctx.AbortWithStatusJSON(403, errorJson(fmt.Sprintf("API key or service token does not have the %s permission", permission)))
+			return
+		}
+
+		ctx.Next()
+	}
+}
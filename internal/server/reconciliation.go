@@ -0,0 +1,16 @@
+package server
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// HandleGetReconciliation returns the report from the most recent reconciliation run
+func (s *Server) HandleGetReconciliation(ctx *gin.Context) {
+	report, ok := s.reconciliation.Latest()
+	if !ok {
+		ctx.JSON(503, errorJson("Reconciliation has not run yet"))
+		return
+	}
+
+	ctx.JSON(200, report)
+}
@@ -0,0 +1,23 @@
+package server
+
+import (
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// HandleReload re-reads the config from disk and env vars, and applies it without a restart. Invalid config is rejected
+// and the current config is kept. The reason is only logged, as validation errors can quote config values.
+func (s *Server) HandleReload(ctx *gin.Context) {
+	conf, err := s.reload()
+	if err != nil {
+		s.loggerFor(ctx.Request.Context()).Warn("Failed to reload config", zap.Error(err))
+		ctx.JSON(400, errorJson("Config is invalid and was not reloaded, see the logs for the reason"))
+		return
+	}
+
+	ctx.JSON(200, gin.H{
+		"tiers":               len(conf.Tiers),
+		"allowed_guilds":      len(conf.Discord.AllowedGuilds),
+		"requests_per_minute": conf.Patreon.RequestsPerMinute,
+	})
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const requestIdHeader = "X-Request-Id"
+
+type requestIdKey struct{}
+
+// Incoming IDs are only trusted if they look like an ID, as they are written to logs and shown to users
+var requestIdPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// RequestId assigns each request a correlation ID, reusing one supplied by the caller if present. The ID is returned in
+// the response headers, attached to log lines and Sentry events, and shown in error messages so that support can find
+// the corresponding logs.
+func (s *Server) RequestId(ctx *gin.Context) {
+	id := ctx.GetHeader(requestIdHeader)
+	if !requestIdPattern.MatchString(id) {
+		id = newRequestId()
+	}
+
+	ctx.Set("request_id", id)
+	ctx.Header(requestIdHeader, id)
+	ctx.Request = ctx.Request.WithContext(context.WithValue(ctx.Request.Context(), requestIdKey{}, id))
+
+	ctx.Next()
+}
+
+func newRequestId() string {
+	buf := make([]byte, 6)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+func requestIdFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIdKey{}).(string)
+	return id
+}
+
+// loggerFor returns the server logger, annotated with the request ID if ctx belongs to a request
+func (s *Server) loggerFor(ctx context.Context) *zap.Logger {
+	if id := requestIdFromContext(ctx); id != "" {
+		return s.logger.With(zap.String("request_id", id))
+	}
+
+	return s.logger
+}
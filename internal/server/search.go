@@ -0,0 +1,352 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TicketsBot-cloud/gdl/objects/channel/embed"
+	"github.com/TicketsBot-cloud/gdl/objects/interaction"
+	"github.com/TicketsBot-cloud/gdl/objects/interaction/component"
+	"github.com/TicketsBot/subscriptions-app/internal/entitlements"
+	"github.com/TicketsBot/subscriptions-app/internal/privacy"
+	"github.com/TicketsBot/subscriptions-app/internal/rbac"
+	"github.com/TicketsBot/subscriptions-app/pkg/patreon"
+)
+
+// searchPageSize is the number of patrons shown on each page of /search
+const searchPageSize = 15
+
+const (
+	// searchModalId routes submissions of the modal opened by /search
+	searchModalId = "search"
+
+	// searchPageView routes the page buttons of /search, whose state is the criteria, encoded by searchState
+	searchPageView = "search_page"
+)
+
+// searchDateLayout is the format of the joined after and joined before criteria
+const searchDateLayout = "2006-01-02"
+
+// patronStatuses are the statuses that Patreon reports for members who have pledged
+var patronStatuses = []string{"active_patron", "declined_patron", "former_patron"}
+
+// chargeStatuses are the statuses that Patreon reports for a member's last charge
+var chargeStatuses = []string{
+	"Paid", "Declined", "Deleted", "Pending", "Refunded", "Refunded by Patreon", "Partially Refunded", "Fraud", "Other",
+}
+
+var searchCommand = command{
+	path:        "search",
+	description: "Find patrons by status, tier, join date and charge status",
+	permission:  rbac.Export,
+	modal:       openSearchModal,
+}
+
+// openSearchModal asks for the criteria of the search. Every criterion is optional, and those left empty match every
+// patron.
+func openSearchModal(_ context.Context, _ *Server, _ interaction.ApplicationCommandInteraction) interaction.ModalResponse {
+	input := func(customId, label, placeholder string, maxLength uint32) component.Component {
+		return component.BuildActionRow(component.BuildInputText(component.InputText{
+			Style:       component.TextStyleShort,
+			CustomId:    customId,
+			Label:       label,
+			Placeholder: &placeholder,
+			MaxLength:   &maxLength,
+			Required:    ptr(false),
+		}))
+	}
+
+	return interaction.NewModalResponse(searchModalId, "Search Patrons", []component.Component{
+		input("status", "Status", "active, declined or former", 20),
+		input("tier", "Tier", "Tier name or ID, such as Premium", 100),
+		input("joined_after", "Joined After", "YYYY-MM-DD", 10),
+		input("joined_before", "Joined Before", "YYYY-MM-DD", 10),
+		input("charge_status", "Last Charge Status", "Paid, Declined, Pending, Refunded, Fraud...", 20),
+	})
+}
+
+// handleSearchModal lists the patrons matching the submitted criteria, so that staff can pick out patrons for a
+// campaign, such as those whose last charge was declined, without querying the database
+func handleSearchModal(ctx context.Context, s *Server, data interaction.ModalSubmitInteraction) interaction.ResponseChannelMessage {
+	search, err := parseSearch(s, modalValues(data.Data))
+	if err != nil {
+		return s.commandErrorMessage(ctx, err)
+	}
+
+	if !s.entitlements.Loaded() {
+		return s.commandErrorMessage(ctx, errDataNotLoaded)
+	}
+
+	state := searchState(search)
+	p, errorMessage := renderSearchPage(ctx, s, state, 0)
+	if errorMessage != "" {
+		return ephemeralMessage(errorMessage)
+	}
+
+	return paginatedMessage(searchPageView, state, p)
+}
+
+// parseSearch builds a search from the values of the modal's inputs. Statuses are accepted with or without the
+// _patron suffix, and tiers by name or ID.
+func parseSearch(s *Server, values map[string]string) (entitlements.PatronSearch, error) {
+	var search entitlements.PatronSearch
+
+	if status := strings.ToLower(strings.TrimSpace(values["status"])); status != "" {
+		if !strings.HasSuffix(status, "_patron") {
+			status += "_patron"
+		}
+
+		if !contains(patronStatuses, status) {
+			return search, newCommandError(failureInvalidOption, "Unknown status `%s`", values["status"]).
+				withHint("Use one of `active`, `declined` or `former`, or leave the status empty to match every patron.")
+		}
+
+		search.Status = status
+	}
+
+	if tier := strings.TrimSpace(values["tier"]); tier != "" {
+		tierId, ok := s.tierId(tier)
+		if !ok {
+			return search, newCommandError(failureInvalidOption, "Unknown tier `%s`", tier).
+				withHint("Use the name or ID of a tier listed by `/tiers list`.")
+		}
+
+		search.TierId = tierId
+	}
+
+	for _, date := range []struct {
+		input string
+		to    **time.Time
+	}{
+		{"joined_after", &search.JoinedAfter},
+		{"joined_before", &search.JoinedBefore},
+	} {
+		value := strings.TrimSpace(values[date.input])
+		if value == "" {
+			continue
+		}
+
+		parsed, err := time.Parse(searchDateLayout, value)
+		if err != nil {
+			return search, newCommandError(failureInvalidOption, "Invalid date `%s`", value).
+				withHint("Dates should look like `2024-01-31`.")
+		}
+
+		*date.to = &parsed
+	}
+
+	if search.JoinedAfter != nil && search.JoinedBefore != nil && !search.JoinedAfter.Before(*search.JoinedBefore) {
+		return search, newCommandError(failureInvalidOption, "Joined after must be earlier than joined before")
+	}
+
+	if chargeStatus := strings.TrimSpace(values["charge_status"]); chargeStatus != "" {
+		for _, known := range chargeStatuses {
+			if strings.EqualFold(known, chargeStatus) {
+				search.ChargeStatus = known
+			}
+		}
+
+		if search.ChargeStatus == "" {
+			return search, newCommandError(failureInvalidOption, "Unknown charge status `%s`", chargeStatus).
+				withHint(fmt.Sprintf("Use one of %s.", strings.Join(chargeStatuses, ", ")))
+		}
+	}
+
+	return search, nil
+}
+
+// tierId returns the ID of the tier with the name, ignoring case, or the ID itself if a number is given
+func (s *Server) tierId(nameOrId string) (uint64, bool) {
+	if tierId, err := strconv.ParseUint(nameOrId, 10, 64); err == nil {
+		return tierId, true
+	}
+
+	for tierId, tier := range s.tiers.All() {
+		if strings.EqualFold(tier.Name, nameOrId) {
+			return tierId, true
+		}
+	}
+
+	return 0, false
+}
+
+// searchState encodes the search in the state of the page buttons, as its criteria separated by pipes
+func searchState(search entitlements.PatronSearch) string {
+	date := func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+
+		return t.Format(searchDateLayout)
+	}
+
+	var tierId string
+	if search.TierId != 0 {
+		tierId = strconv.FormatUint(search.TierId, 10)
+	}
+
+	return strings.Join([]string{search.Status, tierId, date(search.JoinedAfter), date(search.JoinedBefore), search.ChargeStatus}, "|")
+}
+
+// parseSearchState decodes a search encoded by searchState
+func parseSearchState(state string) (entitlements.PatronSearch, bool) {
+	parts := strings.Split(state, "|")
+	if len(parts) != 5 {
+		return entitlements.PatronSearch{}, false
+	}
+
+	search := entitlements.PatronSearch{Status: parts[0], ChargeStatus: parts[4]}
+	if parts[1] != "" {
+		tierId, err := strconv.ParseUint(parts[1], 10, 64)
+		if err != nil {
+			return search, false
+		}
+
+		search.TierId = tierId
+	}
+
+	for i, to := range []**time.Time{&search.JoinedAfter, &search.JoinedBefore} {
+		if parts[2+i] == "" {
+			continue
+		}
+
+		parsed, err := time.Parse(searchDateLayout, parts[2+i])
+		if err != nil {
+			return search, false
+		}
+
+		*to = &parsed
+	}
+
+	return search, true
+}
+
+// renderSearchPage renders a page of the patrons matching the search encoded in the state, from the latest snapshot
+func renderSearchPage(ctx context.Context, s *Server, state string, index int) (page, string) {
+	search, ok := parseSearchState(state)
+	if !ok {
+		return page{}, "Invalid search"
+	}
+
+	if !s.entitlements.Loaded() {
+		return page{}, "Initial data not loaded yet, please try again in a few minutes"
+	}
+
+	patrons := s.entitlements.SearchPatrons(search)
+	start, end, shown, count := pageBounds(len(patrons), searchPageSize, index)
+
+	return page{
+		Embed: searchEmbed(s.embedStyle(ctx), describeSearch(search, s.tierName), patrons[start:end], len(patrons), s.tierName, time.Now()),
+		Index: shown,
+		Count: count,
+	}, ""
+}
+
+// describeSearch lists the criteria of the search, one per line
+func describeSearch(search entitlements.PatronSearch, tierName func(tierId uint64) string) string {
+	var criteria []string
+	if search.Status != "" {
+		criteria = append(criteria, fmt.Sprintf("Status: `%s`", search.Status))
+	}
+
+	if search.TierId != 0 {
+		criteria = append(criteria, fmt.Sprintf("Tier: %s", tierName(search.TierId)))
+	}
+
+	if search.JoinedAfter != nil {
+		criteria = append(criteria, fmt.Sprintf("Joined after <t:%d:D>", search.JoinedAfter.Unix()))
+	}
+
+	if search.JoinedBefore != nil {
+		criteria = append(criteria, fmt.Sprintf("Joined before <t:%d:D>", search.JoinedBefore.Unix()))
+	}
+
+	if search.ChargeStatus != "" {
+		criteria = append(criteria, fmt.Sprintf("Last charge: `%s`", search.ChargeStatus))
+	}
+
+	if len(criteria) == 0 {
+		return "Every patron"
+	}
+
+	return strings.Join(criteria, "\n")
+}
+
+// searchEmbed lists a page of the patrons matching the search, one per line, with their Discord account if linked,
+// their tiers, when they joined and the status of their last charge. total is the number of matches across every page.
+func searchEmbed(
+	style embedStyle,
+	criteria string,
+	patrons []patreon.Patron,
+	total int,
+	tierName func(tierId uint64) string,
+	now time.Time,
+) *embed.Embed {
+	e := &embed.Embed{
+		Title:     "Patron Search",
+		Timestamp: ptr(now),
+		Color:     style.PrimaryColor,
+		Fields: []*embed.EmbedField{
+			{Name: "Criteria", Value: criteria, Inline: true},
+			{Name: "Matches", Value: fmt.Sprint(total), Inline: true},
+		},
+	}
+
+	if total == 0 {
+		e.Description = "No patrons match the search"
+		e.Color = style.ErrorColor
+		return e
+	}
+
+	var b strings.Builder
+	for i, patron := range patrons {
+		line := fmt.Sprintf("`%s` [%d](%s): ", privacy.Masked(patron.Email), patron.Id, style.patronUrl(patron.Id))
+		if patron.DiscordId != nil {
+			line += fmt.Sprintf("<@%d>", *patron.DiscordId)
+		} else {
+			line += "Not linked"
+		}
+
+		if len(patron.Tiers) > 0 {
+			names := make([]string, len(patron.Tiers))
+			for j, tierId := range patron.Tiers {
+				names[j] = tierName(tierId)
+			}
+
+			line += ", " + strings.Join(names, ", ")
+		}
+
+		if !patron.PledgeRelationshipStart.IsZero() {
+			line += fmt.Sprintf(", joined <t:%d:D>", patron.PledgeRelationshipStart.Unix())
+		}
+
+		status := patron.PatronStatus
+		if status == "" {
+			status = "never pledged"
+		}
+
+		line += ", " + status
+		if patron.LastChargeStatus != "" {
+			line += fmt.Sprintf(" (%s)", patron.LastChargeStatus)
+		}
+
+		line += "\n"
+
+		if b.Len()+len(line) > embedDescriptionLimit {
+			remaining := fmt.Sprintf("... and %d more on this page", len(patrons)-i)
+			if b.Len()+len(remaining) <= embedDescriptionLimit {
+				b.WriteString(remaining)
+			}
+
+			break
+		}
+
+		b.WriteString(line)
+	}
+
+	e.Description = strings.TrimSuffix(b.String(), "\n")
+	return e
+}
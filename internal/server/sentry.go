@@ -0,0 +1,55 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/gin-gonic/gin"
+)
+
+// SentryTransaction starts a Sentry transaction for each request, continuing any trace propagated by the caller, and
+// reports panics before passing them on to the recovery middleware. Each request gets its own hub, so that tags set
+// while handling it are attached only to its events.
+func (s *Server) SentryTransaction(ctx *gin.Context) {
+	hub := sentry.CurrentHub().Clone()
+	hub.Scope().SetRequest(ctx.Request)
+	hub.Scope().SetTag("request_id", requestIdFromContext(ctx.Request.Context()))
+
+	route := ctx.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+
+	transaction := sentry.StartTransaction(
+		sentry.SetHubOnContext(ctx.Request.Context(), hub),
+		fmt.Sprintf("%s %s", ctx.Request.Method, route),
+		sentry.ContinueTrace(hub, ctx.GetHeader(sentry.SentryTraceHeader), ctx.GetHeader(sentry.SentryBaggageHeader)),
+		sentry.WithOpName("http.server"),
+		sentry.WithTransactionSource(sentry.SourceRoute),
+	)
+
+	defer func() {
+		status := ctx.Writer.Status()
+		transaction.Status = sentry.HTTPtoSpanStatus(status)
+		transaction.SetData("http.response.status_code", status)
+		transaction.Finish()
+	}()
+
+	defer func() {
+		if err := recover(); err != nil {
+			hub.RecoverWithContext(context.WithValue(ctx.Request.Context(), sentry.RequestContextKey, ctx.Request), err)
+			panic(err)
+		}
+	}()
+
+	ctx.Request = ctx.Request.WithContext(transaction.Context())
+	ctx.Next()
+}
+
+// setSentryTag tags any events reported while handling the request
+func setSentryTag(ctx context.Context, key, value string) {
+	if hub := sentry.GetHubFromContext(ctx); hub != nil {
+		hub.Scope().SetTag(key, value)
+	}
+}
@@ -1,58 +1,381 @@
 package server
 
 import (
+	"context"
+	"net/http"
 	"sync"
 	"time"
 
+	"github.com/TicketsBot/subscriptions-app/internal/allocations"
+	"github.com/TicketsBot/subscriptions-app/internal/analytics"
 	"github.com/TicketsBot/subscriptions-app/internal/config"
-	"github.com/TicketsBot/subscriptions-app/pkg/patreon"
+	"github.com/TicketsBot/subscriptions-app/internal/currency"
+	"github.com/TicketsBot/subscriptions-app/internal/database"
+	"github.com/TicketsBot/subscriptions-app/internal/entitlements"
+	"github.com/TicketsBot/subscriptions-app/internal/guildsettings"
+	"github.com/TicketsBot/subscriptions-app/internal/linking"
+	"github.com/TicketsBot/subscriptions-app/internal/privacy"
+	"github.com/TicketsBot/subscriptions-app/internal/rbac"
+	"github.com/TicketsBot/subscriptions-app/internal/reconciliation"
+	"github.com/TicketsBot/subscriptions-app/internal/servicetoken"
+	"github.com/TicketsBot/subscriptions-app/internal/sources"
+	"github.com/TicketsBot/subscriptions-app/internal/store"
+	"github.com/TicketsBot/subscriptions-app/internal/syncstatus"
+	"github.com/TicketsBot/subscriptions-app/internal/tiers"
+	"github.com/TicketsBot/subscriptions-app/internal/usage"
+	"github.com/TicketsBot/subscriptions-app/internal/usernames"
+	"github.com/TicketsBot/subscriptions-app/internal/vouchers"
+	"github.com/TicketsBot/subscriptions-app/internal/whitelabel"
 	ginzap "github.com/gin-contrib/zap"
 	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 type Server struct {
-	config config.Config
+	config   config.Config // Replaced when config is reloaded, read with currentConfig
+	configMu sync.RWMutex
+	reload   ReloadFunc
+	degraded DegradedFunc
+
+	syncStatus  *syncstatus.Tracker // May be nil
+	triggerSync SyncTriggerFunc     // May be nil
+	demo        bool                // Rejects changes to the database, which demo mode shares with production
+
 	logger *zap.Logger
+	db     *database.Database
+	store  store.Store
+	tiers  *tiers.Registry
+
+	vouchers    *vouchers.Service
+	allocations *allocations.Service
+	analytics   *analytics.Service
+	converter   *currency.Converter
+	usernames   *usernames.Directory
+
+	guildSettings *guildsettings.Store
+	usage         *usage.Recorder
+
+	entitlements   *entitlements.Engine
+	reconciliation *reconciliation.Job
+	providers      Providers
+	owners         *whitelabel.Owners
+	linking        *linking.Service
+
+	seenSignatures *signatureCache
+	emails         *privacy.Emails // Hashing emails requires a restart, so it is not read from the reloaded config
 
-	pledges            map[string]patreon.Patron
-	pledgesByDiscordId map[uint64]patreon.Patron
-	mu                 sync.RWMutex
+	// serviceTokens verifies service tokens against the configured public keys. It is rebuilt under configMu when config
+	// is reloaded, and is nil if no keys are set.
+	serviceTokens *servicetoken.Verifier
+
+	// networks are the parsed allowlists and trusted proxies, which are also rebuilt under configMu on reload
+	networks *networks
+}
+
+// Providers holds the pledge sources that receive webhooks. Providers that are not configured are left nil.
+type Providers struct {
+	Paddle       *sources.PaddleSource
+	LemonSqueezy *sources.LemonSqueezySource
+	Discord      *sources.DiscordSource
 }
 
-func NewServer(config config.Config, logger *zap.Logger) *Server {
+func NewServer(
+	config config.Config,
+	logger *zap.Logger,
+	db *database.Database,
+	store store.Store,
+	tiers *tiers.Registry,
+	vouchers *vouchers.Service,
+	allocations *allocations.Service,
+	analytics *analytics.Service,
+	converter *currency.Converter,
+	usernames *usernames.Directory,
+	guildSettings *guildsettings.Store,
+	usage *usage.Recorder,
+	entitlements *entitlements.Engine,
+	reconciliation *reconciliation.Job,
+	providers Providers,
+) *Server {
 	return &Server{
-		config: config,
-		logger: logger,
+		config:      config,
+		logger:      logger,
+		db:          db,
+		store:       store,
+		tiers:       tiers,
+		vouchers:    vouchers,
+		allocations: allocations,
+		analytics:   analytics,
+		converter:   converter,
+		usernames:   usernames,
+
+		guildSettings: guildSettings,
+		usage:         usage,
+
+		entitlements:   entitlements,
+		reconciliation: reconciliation,
+		providers:      providers,
+		owners:         whitelabel.NewOwners(),
+		linking:        linking.NewService(config, db),
+		seenSignatures: newSignatureCache(),
+		serviceTokens:  newServiceTokenVerifier(config, logger),
+		networks:       parseNetworks(config),
+		emails:         privacy.NewEmails(config),
+	}
+}
+
+// Run serves the public router, and the internal API listener if one is configured, until either stops or the context
+// is cancelled, when both are shut down gracefully
+func (s *Server) Run(ctx context.Context) error {
+	conf := s.currentConfig()
+	public := &http.Server{
+		Addr:    conf.ServerAddr,
+		Handler: s.Router(),
+	}
+
+	if conf.InternalApi.Addr == "" {
+		return serveUntilDone(ctx, public, public.ListenAndServe)
+	}
+
+	errs := make(chan error, 2)
+	go func() {
+		errs <- serveUntilDone(ctx, public, public.ListenAndServe)
+	}()
+	go func() {
+		errs <- errors.Wrap(s.RunInternalApi(ctx), "internal API listener stopped")
+	}()
+
+	// A listener only stops without an error once shut down, in which case the other is shutting down too
+	err := <-errs
+	if err == nil {
+		err = <-errs
+	}
+
+	return err
+}
+
+// shutdownTimeout bounds how long in-flight requests are given to complete when shutting down
+const shutdownTimeout = time.Second * 10
+
+// serveUntilDone runs listen until it fails, or until the context is cancelled, when the server is shut down, waiting
+// for in-flight requests to complete
+func serveUntilDone(ctx context.Context, server *http.Server, listen func() error) error {
+	errs := make(chan error, 1)
+	go func() {
+		errs <- listen()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	// The context is already cancelled, so shutting down is given its own deadline
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return errors.Wrap(err, "failed to shut down server")
+	}
+
+	if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+// Router builds the router serving every route, which is also used to drive the server in tests. If an internal API
+// listener is configured, the API routes are served there instead.
+func (s *Server) Router() *gin.Engine {
+	router := s.newRouter()
+
+	router.GET("/metrics", s.HandleMetrics)
+	router.GET("/ready", s.HandleReady)
+
+	router.POST("/interaction", s.AllowNetworks(interactionAllowlist), s.Authenticate, s.HandleInteraction)
+
+	if s.providers.Paddle != nil {
+		router.POST("/webhook/paddle", s.HandlePaddleWebhook)
+	}
+
+	if s.providers.LemonSqueezy != nil {
+		router.POST("/webhook/lemonsqueezy", s.HandleLemonSqueezyWebhook)
+	}
+
+	if s.providers.Discord != nil {
+		router.POST("/webhook/discord", s.AllowNetworks(interactionAllowlist), s.Authenticate, s.HandleDiscordWebhook)
+	}
+
+	if s.linking.Enabled() && !s.demo {
+		s.registerLinkPage(router)
 	}
+
+	conf := s.currentConfig()
+
+	// Routes are registered once, so enabling the API requires a restart
+	if conf.HasApiCredentials() && conf.InternalApi.Addr == "" {
+		s.registerApi(router.Group("/api", s.AllowNetworks(apiAllowlist), s.AuthenticateApiKey))
+	}
+
+	return router
 }
 
-func (s *Server) Run() error {
+// newRouter creates a router with the middleware shared by every listener
+func (s *Server) newRouter() *gin.Engine {
 	router := gin.New()
 
-	router.Use(ginzap.Ginzap(s.logger, time.RFC3339, true))
+	// The client IP is resolved by ResolveClientIp, against the trusted proxies of the current config, so that clients
+	// can't choose the IP the allowlists check
+	_ = router.SetTrustedProxies(nil)
+	router.TrustedPlatform = clientIpHeader
+
+	router.Use(s.ResolveClientIp)
+	router.Use(s.RequestId)
+	router.Use(s.Trace)
+	router.Use(ginzap.GinzapWithConfig(s.logger, &ginzap.Config{
+		TimeFormat: time.RFC3339,
+		UTC:        true,
+		Context: func(ctx *gin.Context) []zapcore.Field {
+			fields := []zapcore.Field{zap.String("request_id", ctx.GetString("request_id"))}
+			if subject, ok := clientCertificateSubject(ctx); ok {
+				fields = append(fields, zap.String("client_certificate", subject))
+			}
+
+			if subject := ctx.GetString(serviceTokenSubjectKey); subject != "" {
+				fields = append(fields, zap.String("service", subject))
+			}
+
+			return fields
+		},
+	}))
 	router.Use(ginzap.RecoveryWithZap(s.logger, true))
+	router.Use(s.SentryTransaction)
 	router.Use(s.ErrorHandler)
+	router.Use(s.RecordMetrics)
+
+	return router
+}
+
+// registerApi adds the API routes, each requiring the permission of the same kind as the command it mirrors
+func (s *Server) registerApi(api *gin.RouterGroup) {
+	api.GET("/entitlements", s.RequirePermission(rbac.Read), s.HandleGetEntitlements)
+	api.GET("/guilds/:id/premium", s.RequirePermission(rbac.Read), s.HandleGetGuildPremium)
+	api.GET("/whitelabel/:botId/entitlement", s.RequirePermission(rbac.Read), s.HandleGetWhitelabelEntitlement)
+	api.GET("/analytics/churn", s.RequirePermission(rbac.Export), s.HandleGetChurn)
+	api.GET("/analytics/revenue", s.RequirePermission(rbac.Export), s.HandleGetRevenue)
+	api.GET("/reconciliation", s.RequirePermission(rbac.Read), s.HandleGetReconciliation)
+	api.GET("/status", s.RequirePermission(rbac.Read), s.HandleGetStatus)
+	api.POST("/vouchers", s.RequirePermission(rbac.Grant), s.HandleCreateVouchers)
+	api.DELETE("/vouchers/:code", s.RequirePermission(rbac.Revoke), s.HandleRevokeVoucher)
+	api.POST("/legacy-keys/import", s.RequirePermission(rbac.Grant), s.HandleImportLegacyKeys)
+
+	if s.reload != nil {
+		api.POST("/admin/reload", s.RequirePermission(rbac.Admin), s.HandleReload)
+	}
+}
+
+// ReloadFunc re-reads the config and applies it to every component that supports reloading
+type ReloadFunc func() (config.Config, error)
 
-	router.POST("/interaction", s.Authenticate, s.HandleInteraction)
+// SetReloadFunc enables the reload endpoint. It must be called before Run.
+func (s *Server) SetReloadFunc(reload ReloadFunc) {
+	s.reload = reload
+}
 
-	return router.Run(s.config.ServerAddr)
+// SetSyncStatus sets the tracker of the Patreon syncs, reported by /api/status and shown on lookups. It must be called
+// before Run.
+func (s *Server) SetSyncStatus(status *syncstatus.Tracker) {
+	s.syncStatus = status
 }
 
-func (s *Server) UpdatePledges(pledges map[string]patreon.Patron) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// SetDemo rejects commands that change the tier mappings, guild settings or premium servers, and disables the link
+// page, as they are kept in the database, which demo mode shares with production. It must be called before Run.
+func (s *Server) SetDemo() {
+	s.demo = true
+}
 
-	s.pledges = pledges
+// SyncTriggerFunc starts a Patreon sync without waiting for the interval, returning false if one is already running
+type SyncTriggerFunc func() bool
 
-	// Group pledges by Discord ID
-	x := make(map[uint64]patreon.Patron, len(pledges))
+// SetSyncTrigger lets staff start a sync from /subscription sync. It must be called before Run.
+func (s *Server) SetSyncTrigger(trigger SyncTriggerFunc) {
+	s.triggerSync = trigger
+}
 
-	for _, pledge := range pledges {
-		if pledge.DiscordId != nil {
-			x[*pledge.DiscordId] = pledge
-		}
+// lastSyncedAt returns when the data being served was last synced, if known
+func (s *Server) lastSyncedAt() *time.Time {
+	if s.syncStatus == nil {
+		return nil
 	}
 
-	s.pledgesByDiscordId = x
+	return s.syncStatus.LastSuccessAt()
+}
+
+// DegradedFunc returns why the instance is degraded, such as the Patreon refresh token having expired, or nothing if it
+// isn't
+type DegradedFunc func() []string
+
+// SetDegradedFunc reports the degraded state in /ready and /api/status. It must be called before Run.
+func (s *Server) SetDegradedFunc(degraded DegradedFunc) {
+	s.degraded = degraded
+}
+
+// degradedReasons returns why the instance is degraded, which is never nil so that it is encoded as an empty list
+func (s *Server) degradedReasons() []string {
+	if s.degraded == nil {
+		return []string{}
+	}
+
+	reasons := s.degraded()
+	if reasons == nil {
+		return []string{}
+	}
+
+	return reasons
+}
+
+// UpdateConfig swaps in reloaded config. Handlers read the config once per request with currentConfig, so each request
+// sees either the old or the new config in full.
+func (s *Server) UpdateConfig(config config.Config) {
+	verifier := newServiceTokenVerifier(config, s.logger)
+	networks := parseNetworks(config)
+
+	s.configMu.Lock()
+	defer s.configMu.Unlock()
+
+	s.config = config
+	s.serviceTokens = verifier
+	s.networks = networks
+}
+
+func (s *Server) currentConfig() config.Config {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+
+	return s.config
+}
+
+func (s *Server) currentNetworks() *networks {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+
+	return s.networks
+}
+
+func (s *Server) serviceTokenVerifier() *servicetoken.Verifier {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+
+	return s.serviceTokens
+}
+
+func (s *Server) isAllowedGuild(guildId uint64) bool {
+	return contains(s.currentConfig().Discord.AllowedGuilds, guildId)
+}
+
+func (s *Server) isTrustedUser(userId uint64) bool {
+	return contains(s.currentConfig().Discord.TrustedUsers, userId)
 }
@@ -0,0 +1,34 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRunShutsDownWhenCancelled(t *testing.T) {
+	s := newTestServer(t, "")
+
+	conf := s.currentConfig()
+	conf.ServerAddr = "127.0.0.1:0"
+	s.UpdateConfig(conf)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() {
+		errs <- s.Run(ctx)
+	}()
+
+	// Give the listener time to start, so that it is shut down rather than never started
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Errorf("expected a clean shutdown, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run didn't return after the context was cancelled")
+	}
+}
@@ -0,0 +1,354 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TicketsBot-cloud/gdl/objects/channel/embed"
+	"github.com/TicketsBot-cloud/gdl/objects/interaction"
+	"github.com/TicketsBot/subscriptions-app/internal/config"
+	"github.com/TicketsBot/subscriptions-app/internal/database"
+	"github.com/TicketsBot/subscriptions-app/internal/rbac"
+	"go.uber.org/zap"
+)
+
+// footerTextLimit is the maximum length of an embed footer
+const footerTextLimit = 2048
+
+type guildIdKey struct{}
+
+// withGuildId records the guild that an interaction was made in, so that its response follows the guild's settings
+func withGuildId(ctx context.Context, guildId uint64) context.Context {
+	return context.WithValue(ctx, guildIdKey{}, guildId)
+}
+
+// guildSettingsFor returns the settings of the guild that the interaction was made in. Outside the allowed guilds, such
+// as in DMs through the user-installed app, no settings apply.
+func (s *Server) guildSettingsFor(ctx context.Context) database.GuildSettings {
+	guildId, _ := ctx.Value(guildIdKey{}).(uint64)
+	if guildId == 0 || !s.isAllowedGuild(guildId) {
+		return database.GuildSettings{}
+	}
+
+	return s.guildSettings.Get(guildId)
+}
+
+// adminSettingsPath is the path of /admin settings, which can't be disabled, as it is needed to enable commands again
+const adminSettingsPath = "admin settings"
+
+var adminSettingsCommand = command{
+	path:        adminSettingsPath,
+	description: "View or change the settings of this server, which override the global config",
+	options: []interaction.ApplicationCommandOption{
+		{
+			Type:        interaction.OptionTypeString,
+			Name:        "disable_command",
+			Description: "A command that can't be run in this server",
+			Required:    false,
+		},
+		{
+			Type:        interaction.OptionTypeString,
+			Name:        "enable_command",
+			Description: "A disabled command to allow again",
+			Required:    false,
+		},
+		{
+			Type:        interaction.OptionTypeString,
+			Name:        "hide_tier",
+			Description: "A tier to leave out of lookups and /tiers list in this server",
+			Required:    false,
+		},
+		{
+			Type:        interaction.OptionTypeString,
+			Name:        "show_tier",
+			Description: "A hidden tier to show again",
+			Required:    false,
+		},
+		{
+			Type:        interaction.OptionTypeString,
+			Name:        "primary_color",
+			Description: "The color of embeds, such as #4287f5",
+			Required:    false,
+		},
+		{
+			Type:        interaction.OptionTypeString,
+			Name:        "error_color",
+			Description: "The color of error embeds, such as #eb4034",
+			Required:    false,
+		},
+		{
+			Type:        interaction.OptionTypeString,
+			Name:        "footer_text",
+			Description: "The footer added to embeds",
+			Required:    false,
+		},
+		{
+			Type:        interaction.OptionTypeBoolean,
+			Name:        "reset_branding",
+			Description: "Use the global colors and footer again",
+			Required:    false,
+		},
+		{
+			Type:        interaction.OptionTypeBoolean,
+			Name:        "ephemeral",
+			Description: "Whether responses to commands are only shown to the member who ran the command",
+			Required:    false,
+		},
+	},
+	permission: rbac.Admin,
+	handler:    handleAdminSettings,
+	autocomplete: map[string]autocompleteHandler{
+		"disable_command": commandChoices,
+		"enable_command":  commandChoices,
+		"hide_tier":       tierChoices,
+		"show_tier":       tierChoices,
+	},
+}
+
+// handleAdminSettings shows the settings of the guild, after applying any changes passed as options. Settings are
+// stored per guild, so that each allowed guild can be set up for the staff using it.
+func handleAdminSettings(
+	ctx context.Context,
+	s *Server,
+	data interaction.ApplicationCommandInteraction,
+	options []interaction.ApplicationCommandInteractionDataOption,
+) interaction.ResponseChannelMessage {
+	settings := s.guildSettings.Get(data.GuildId.Value)
+	if len(options) == 0 {
+		return interaction.NewResponseChannelMessage(interaction.ApplicationCommandCallbackData{
+			Embeds: []*embed.Embed{settingsEmbed(s.embedStyle(ctx), "Server Settings", settings, s.tierName, time.Now())},
+		})
+	}
+
+	if s.demo {
+		return s.commandErrorMessage(ctx, errDemoMode("admin settings"))
+	}
+
+	for _, option := range options {
+		if err := applySetting(s, &settings, option); err != nil {
+			return s.commandErrorMessage(ctx, err)
+		}
+	}
+
+	user := invokingUser(data.InteractionMetadata)
+	settings.UpdatedBy = user.Id
+	settings.UpdatedAt = time.Now()
+
+	if err := s.guildSettings.Set(ctx, settings); err != nil {
+		s.loggerFor(ctx).Error("Failed to store guild settings", zap.Uint64("guild_id", settings.GuildId), zap.Error(err))
+		return s.errorMessage(ctx, "Failed to save settings")
+	}
+
+	s.loggerFor(ctx).Info("Guild settings updated", zap.Uint64("guild_id", settings.GuildId), zap.Uint64("user_id", user.Id))
+
+	// The embed is built after the settings are stored, so that it shows any new branding
+	return interaction.NewResponseChannelMessage(interaction.ApplicationCommandCallbackData{
+		Embeds: []*embed.Embed{settingsEmbed(s.embedStyle(ctx), "Settings Updated", settings, s.tierName, time.Now())},
+	})
+}
+
+// applySetting changes the setting named by the option. Commands and tiers are given by the values that their
+// suggestions carry, but typing them in full is accepted too.
+func applySetting(s *Server, settings *database.GuildSettings, option interaction.ApplicationCommandInteractionDataOption) error {
+	if option.Name == "reset_branding" || option.Name == "ephemeral" {
+		value, ok := booleanValue(option)
+		if !ok {
+			return newCommandError(failureInvalidOption, "%s was wrong type", option.Name)
+		}
+
+		if option.Name == "ephemeral" {
+			settings.Ephemeral = value
+		} else if value {
+			settings.PrimaryColor, settings.ErrorColor, settings.FooterText = nil, nil, nil
+		}
+
+		return nil
+	}
+
+	value, ok := stringValue(option)
+	if !ok {
+		return newCommandError(failureInvalidOption, "%s was wrong type", option.Name)
+	}
+
+	value = strings.TrimSpace(value)
+
+	switch option.Name {
+	case "disable_command", "enable_command":
+		path := strings.TrimPrefix(value, "/")
+		if _, ok := commandsByPath[path]; !ok {
+			return newCommandError(failureInvalidOption, "Unknown command `/%s`", path).
+				withHint("Pick a command from the suggestions shown as you type.")
+		}
+
+		if path == adminSettingsPath {
+			return newCommandError(failureInvalidOption, "`/%s` can't be disabled, as it is needed to enable commands again", path)
+		}
+
+		settings.DisabledCommands = slices.DeleteFunc(settings.DisabledCommands, func(disabled string) bool {
+			return disabled == path
+		})
+
+		if option.Name == "disable_command" {
+			settings.DisabledCommands = append(settings.DisabledCommands, path)
+		}
+	case "hide_tier", "show_tier":
+		tierId, ok := s.tierId(value)
+		if !ok {
+			return newCommandError(failureInvalidOption, "Unknown tier `%s`", value).
+				withHint("Use the name or ID of a tier listed by `/tiers list`.")
+		}
+
+		settings.HiddenTiers = slices.DeleteFunc(settings.HiddenTiers, func(hidden uint64) bool {
+			return hidden == tierId
+		})
+
+		if option.Name == "hide_tier" {
+			settings.HiddenTiers = append(settings.HiddenTiers, tierId)
+		}
+	case "primary_color", "error_color":
+		var color config.Color
+		if err := color.UnmarshalText([]byte(value)); err != nil {
+			return newCommandError(failureInvalidOption, "Invalid color `%s`", value).
+				withHint("Colors should be hex codes, such as `#4287f5`.")
+		}
+
+		if option.Name == "primary_color" {
+			settings.PrimaryColor = ptr(int(color))
+		} else {
+			settings.ErrorColor = ptr(int(color))
+		}
+	case "footer_text":
+		if value == "" {
+			return newCommandError(failureInvalidOption, "Footer text cannot be empty").
+				withHint("Use `reset_branding` to go back to the global footer.")
+		}
+
+		settings.FooterText = ptr(truncate(value, footerTextLimit))
+	default:
+		return newCommandError(failureInvalidOption, "Unknown setting `%s`", option.Name)
+	}
+
+	return nil
+}
+
+// commandChoices suggests the commands whose path contains what has been typed, other than /admin settings itself
+func commandChoices(_ *Server, focused interaction.ApplicationCommandInteractionDataOption) []interaction.ApplicationCommandOptionChoice {
+	query, _ := stringValue(focused)
+	query = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(query), "/"))
+
+	var paths []string
+	for path := range commandsByPath {
+		if path != adminSettingsPath && strings.Contains(path, query) {
+			paths = append(paths, path)
+		}
+	}
+
+	slices.Sort(paths)
+
+	choices := []interaction.ApplicationCommandOptionChoice{}
+	for _, path := range paths[:min(len(paths), maxAutocompleteChoices)] {
+		choices = append(choices, interaction.ApplicationCommandOptionChoice{Name: "/" + path, Value: path})
+	}
+
+	return choices
+}
+
+// tierChoices suggests the tiers whose name or ID starts with what has been typed, ordered by name. The value of each
+// choice is the tier ID.
+func tierChoices(s *Server, focused interaction.ApplicationCommandInteractionDataOption) []interaction.ApplicationCommandOptionChoice {
+	query, _ := stringValue(focused)
+	query = strings.ToLower(strings.TrimSpace(query))
+
+	tiers := s.tiers.All()
+
+	var tierIds []uint64
+	for tierId, tier := range tiers {
+		if strings.HasPrefix(strings.ToLower(tier.Name), query) || strings.HasPrefix(strconv.FormatUint(tierId, 10), query) {
+			tierIds = append(tierIds, tierId)
+		}
+	}
+
+	slices.SortFunc(tierIds, func(a, b uint64) int {
+		return cmp.Or(cmp.Compare(strings.ToLower(tiers[a].Name), strings.ToLower(tiers[b].Name)), cmp.Compare(a, b))
+	})
+
+	choices := []interaction.ApplicationCommandOptionChoice{}
+	for _, tierId := range tierIds[:min(len(tierIds), maxAutocompleteChoices)] {
+		choices = append(choices, interaction.ApplicationCommandOptionChoice{
+			Name:  fmt.Sprintf("%s (%d)", tiers[tierId].Name, tierId),
+			Value: strconv.FormatUint(tierId, 10),
+		})
+	}
+
+	return choices
+}
+
+// settingsEmbed shows the settings of a guild, with those left unset shown as following the global config
+func settingsEmbed(
+	style embedStyle,
+	title string,
+	settings database.GuildSettings,
+	tierName func(tierId uint64) string,
+	now time.Time,
+) *embed.Embed {
+	orDefault := func(values []string) string {
+		if len(values) == 0 {
+			return "None"
+		}
+
+		return strings.Join(values, "\n")
+	}
+
+	disabled := make([]string, len(settings.DisabledCommands))
+	for i, path := range settings.DisabledCommands {
+		disabled[i] = fmt.Sprintf("`/%s`", path)
+	}
+
+	hidden := make([]string, len(settings.HiddenTiers))
+	for i, tierId := range settings.HiddenTiers {
+		hidden[i] = fmt.Sprintf("%s (`%d`)", tierName(tierId), tierId)
+	}
+
+	color := func(color *int) string {
+		if color == nil {
+			return "Global"
+		}
+
+		return fmt.Sprintf("`#%06x`", *color)
+	}
+
+	footer := "Global"
+	if settings.FooterText != nil {
+		footer = *settings.FooterText
+	}
+
+	ephemeral := "No"
+	if settings.Ephemeral {
+		ephemeral = "Yes"
+	}
+
+	e := &embed.Embed{
+		Title:     title,
+		Timestamp: ptr(now),
+		Color:     style.PrimaryColor,
+		Fields: []*embed.EmbedField{
+			{Name: "Disabled Commands", Value: orDefault(disabled), Inline: true},
+			{Name: "Hidden Tiers", Value: orDefault(hidden), Inline: true},
+			{Name: "Ephemeral Responses", Value: ephemeral, Inline: true},
+			{Name: "Primary Color", Value: color(settings.PrimaryColor), Inline: true},
+			{Name: "Error Color", Value: color(settings.ErrorColor), Inline: true},
+			{Name: "Footer", Value: truncate(footer, embedFieldLimit), Inline: true},
+		},
+	}
+
+	if settings.UpdatedBy != 0 {
+		e.Description = fmt.Sprintf("Last changed by <@%d> <t:%d:R>", settings.UpdatedBy, settings.UpdatedAt.Unix())
+	}
+
+	return e
+}
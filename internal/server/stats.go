@@ -0,0 +1,352 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TicketsBot-cloud/gdl/objects/channel/embed"
+	"github.com/TicketsBot-cloud/gdl/objects/channel/message"
+	"github.com/TicketsBot-cloud/gdl/objects/interaction"
+	"github.com/TicketsBot/subscriptions-app/internal/analytics"
+	"github.com/TicketsBot/subscriptions-app/internal/currency"
+	"github.com/TicketsBot/subscriptions-app/internal/rbac"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultStatsMonths = 6
+	maxStatsMonths     = 24
+
+	maxRetentionMonths = 6 // Retention shown per cohort in the embed, the API returns every month
+	maxFieldLength     = 1024
+)
+
+// monthsOption returns the months option of a stats subcommand, or an error message to respond with
+func monthsOption(options []interaction.ApplicationCommandInteractionDataOption) (int, string) {
+	months := defaultStatsMonths
+	if monthsOption, ok := findOption(options, "months"); ok {
+		if months, ok = integerValue(monthsOption); !ok {
+			return 0, "Months was wrong type"
+		}
+	}
+
+	if months < 1 || months > maxStatsMonths {
+		return 0, fmt.Sprintf("Months must be between 1 and %d", maxStatsMonths)
+	}
+
+	return months, ""
+}
+
+var statsChurnCommand = command{
+	path:        "subscription stats churn",
+	description: "View monthly churn, retention by cohort and average patron lifetime",
+	options: []interaction.ApplicationCommandOption{
+		{
+			Type:        interaction.OptionTypeInteger,
+			Name:        "months",
+			Description: "How many months to report on (default 6)",
+			Required:    false,
+		},
+	},
+	permission: rbac.Export,
+	handler:    handleStatsChurn,
+}
+
+func handleStatsChurn(
+	ctx context.Context,
+	s *Server,
+	data interaction.ApplicationCommandInteraction,
+	options []interaction.ApplicationCommandInteractionDataOption,
+) interaction.ResponseChannelMessage {
+	months, errorMessage := monthsOption(options)
+	if errorMessage != "" {
+		return ephemeralMessage(errorMessage)
+	}
+
+	if !s.entitlements.Loaded() {
+		return s.commandErrorMessage(ctx, errDataNotLoaded)
+	}
+
+	report, err := s.analytics.Churn(ctx, months)
+	if err != nil {
+		s.loggerFor(ctx).Error("Failed to build churn report", zap.Error(err))
+		return s.errorMessage(ctx, "Failed to build churn report, please try again later")
+	}
+
+	return interaction.NewResponseChannelMessage(interaction.ApplicationCommandCallbackData{
+		Embeds: []*embed.Embed{churnEmbed(s.embedStyle(ctx), report, time.Now())},
+		Flags:  uint(message.FlagEphemeral),
+	})
+}
+
+func churnEmbed(style embedStyle, report analytics.ChurnReport, now time.Time) *embed.Embed {
+	var monthLines []string
+	for _, month := range report.Months {
+		monthLines = append(monthLines, fmt.Sprintf("`%s` %d active, %d new, %d cancelled (%s)",
+			month.Month, month.ActiveAtStart, month.New, month.Cancelled, formatPercent(month.ChurnRate)))
+	}
+
+	var cohortLines []string
+	for _, cohort := range report.Cohorts {
+		if cohort.Size == 0 || len(cohort.Retention) == 0 {
+			continue
+		}
+
+		var retention []string
+		for _, fraction := range cohort.Retention[:min(len(cohort.Retention), maxRetentionMonths)] {
+			retention = append(retention, formatPercent(fraction))
+		}
+
+		line := fmt.Sprintf("`%s` %d patrons: %s", cohort.Month, cohort.Size, strings.Join(retention, " → "))
+		if len(strings.Join(append(cohortLines, line), "\n")) > maxFieldLength {
+			break
+		}
+
+		cohortLines = append(cohortLines, line)
+	}
+
+	if len(cohortLines) == 0 {
+		cohortLines = append(cohortLines, "No complete months yet")
+	}
+
+	lifetime := "No cancellations yet"
+	if report.AverageLifetimeDays != nil {
+		lifetime = fmt.Sprintf("%.1f days", *report.AverageLifetimeDays)
+	}
+
+	return &embed.Embed{
+		Title:       "Churn",
+		Description: strings.Join(monthLines, "\n"),
+		Fields: []*embed.EmbedField{
+			{
+				Name:   "Active Patrons",
+				Value:  strconv.Itoa(report.ActivePatrons),
+				Inline: true,
+			},
+			{
+				Name:   "Average Lifetime",
+				Value:  lifetime,
+				Inline: true,
+			},
+			{
+				Name:   "Retention by Cohort",
+				Value:  strings.Join(cohortLines, "\n"),
+				Inline: false,
+			},
+		},
+		Timestamp: ptr(now),
+		Color:     style.PrimaryColor,
+	}
+}
+
+func formatPercent(fraction float64) string {
+	return fmt.Sprintf("%.1f%%", fraction*100)
+}
+
+// monthsQuery returns the months query parameter of the analytics routes, defaulting to 12 months. If it is invalid,
+// an error response is written.
+func monthsQuery(ctx *gin.Context) (int, bool) {
+	monthsStr := ctx.Query("months")
+	if monthsStr == "" {
+		return 12, true
+	}
+
+	months, err := strconv.Atoi(monthsStr)
+	if err != nil || months < 1 || months > maxStatsMonths {
+		ctx.JSON(400, errorJson(fmt.Sprintf("months must be between 1 and %d", maxStatsMonths)))
+		return 0, false
+	}
+
+	return months, true
+}
+
+// HandleGetChurn returns the churn report for the months query parameter
+func (s *Server) HandleGetChurn(ctx *gin.Context) {
+	months, ok := monthsQuery(ctx)
+	if !ok {
+		return
+	}
+
+	// The report works backwards from the current patron count
+	if !s.entitlements.Loaded() {
+		ctx.JSON(503, errorJson("Initial data not loaded yet"))
+		return
+	}
+
+	report, err := s.analytics.Churn(ctx.Request.Context(), months)
+	if err != nil {
+		_ = ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(200, report)
+}
+
+var statsMrrCommand = command{
+	path:        "subscription stats mrr",
+	description: "View monthly recurring revenue, revenue by tier and how it changed each month",
+	options: []interaction.ApplicationCommandOption{
+		{
+			Type:        interaction.OptionTypeInteger,
+			Name:        "months",
+			Description: "How many months to report on (default 6)",
+			Required:    false,
+		},
+		{
+			Type:        interaction.OptionTypeString,
+			Name:        "currency",
+			Description: "The currency to convert amounts to, which must have a configured exchange rate",
+			Required:    false,
+		},
+	},
+	permission: rbac.Export,
+	handler:    handleStatsMrr,
+}
+
+func handleStatsMrr(
+	ctx context.Context,
+	s *Server,
+	data interaction.ApplicationCommandInteraction,
+	options []interaction.ApplicationCommandInteractionDataOption,
+) interaction.ResponseChannelMessage {
+	months, errorMessage := monthsOption(options)
+	if errorMessage != "" {
+		return ephemeralMessage(errorMessage)
+	}
+
+	var target string
+	if currencyOption, ok := findOption(options, "currency"); ok {
+		if target, ok = stringValue(currencyOption); !ok {
+			return ephemeralMessage("Currency was wrong type")
+		}
+	}
+
+	if !s.entitlements.Loaded() {
+		return s.commandErrorMessage(ctx, errDataNotLoaded)
+	}
+
+	report, err := s.revenueReport(ctx, months, target)
+	if err != nil {
+		if errors.Is(err, errUnknownCurrency) {
+			return ephemeralMessage(fmt.Sprintf("No exchange rate is configured for %s", strings.ToUpper(target)))
+		}
+
+		s.loggerFor(ctx).Error("Failed to build revenue report", zap.Error(err))
+		return s.errorMessage(ctx, "Failed to build revenue report, please try again later")
+	}
+
+	return interaction.NewResponseChannelMessage(interaction.ApplicationCommandCallbackData{
+		Embeds: []*embed.Embed{mrrEmbed(s.embedStyle(ctx), report, time.Now())},
+		Flags:  uint(message.FlagEphemeral),
+	})
+}
+
+func mrrEmbed(style embedStyle, report analytics.RevenueReport, now time.Time) *embed.Embed {
+	var monthLines []string
+	for _, month := range report.Months {
+		monthLines = append(monthLines, fmt.Sprintf("`%s` %s → %s (%+.1f%%): +%s new, +%s expansion, -%s contraction, -%s churned",
+			month.Month,
+			currency.Format(month.StartMrrCents, report.Currency),
+			currency.Format(month.EndMrrCents, report.Currency),
+			month.ChangeRate*100,
+			currency.Format(month.NewCents, report.Currency),
+			currency.Format(month.ExpansionCents, report.Currency),
+			currency.Format(month.ContractionCents, report.Currency),
+			currency.Format(month.ChurnedCents, report.Currency),
+		))
+	}
+
+	var tierLines []string
+	for _, tier := range report.ByTier {
+		name := tier.Name
+		if name == "" {
+			name = fmt.Sprintf("Unknown (%d)", tier.TierId)
+		}
+
+		line := fmt.Sprintf("%s: %s from %d patrons", name, currency.Format(tier.MrrCents, report.Currency), tier.Patrons)
+		if len(strings.Join(append(tierLines, line), "\n")) > maxFieldLength {
+			break
+		}
+
+		tierLines = append(tierLines, line)
+	}
+
+	if len(tierLines) == 0 {
+		tierLines = append(tierLines, "No active patrons")
+	}
+
+	return &embed.Embed{
+		Title:       "Monthly Recurring Revenue",
+		Description: strings.Join(monthLines, "\n"),
+		Fields: []*embed.EmbedField{
+			{
+				Name:   "MRR",
+				Value:  currency.Format(report.MrrCents, report.Currency),
+				Inline: false,
+			},
+			{
+				Name:   "Revenue by Tier",
+				Value:  strings.Join(tierLines, "\n"),
+				Inline: false,
+			},
+		},
+		Timestamp: ptr(now),
+		Color:     style.PrimaryColor,
+	}
+}
+
+var errUnknownCurrency = errors.New("no exchange rate configured for currency")
+
+// revenueReport builds a revenue report, converted to the currency if it is set and differs from the campaign currency
+func (s *Server) revenueReport(ctx context.Context, months int, currency string) (analytics.RevenueReport, error) {
+	base := s.converter.Base()
+
+	report, err := s.analytics.Revenue(ctx, months, base)
+	if err != nil {
+		return analytics.RevenueReport{}, err
+	}
+
+	currency = strings.ToUpper(currency)
+	if currency == "" || currency == base {
+		return report, nil
+	}
+
+	rate, ok := s.converter.Rate(currency)
+	if !ok {
+		return analytics.RevenueReport{}, errUnknownCurrency
+	}
+
+	return report.Convert(currency, rate), nil
+}
+
+// HandleGetRevenue returns the revenue report for the months query parameter, converted to the currency query
+// parameter if set
+func (s *Server) HandleGetRevenue(ctx *gin.Context) {
+	months, ok := monthsQuery(ctx)
+	if !ok {
+		return
+	}
+
+	if !s.entitlements.Loaded() {
+		ctx.JSON(503, errorJson("Initial data not loaded yet"))
+		return
+	}
+
+	report, err := s.revenueReport(ctx.Request.Context(), months, ctx.Query("currency"))
+	if err != nil {
+		if errors.Is(err, errUnknownCurrency) {
+			ctx.JSON(400, errorJson("No exchange rate is configured for that currency"))
+			return
+		}
+
+		_ = ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(200, report)
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"github.com/TicketsBot/subscriptions-app/internal/syncstatus"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// HandleGetStatus returns whether the initial data has loaded, why the instance is degraded, if it is, the outcome of
+// this instance's Patreon syncs, and the latest Patreon token refreshes recorded by any instance, to diagnose refresh
+// tokens expiring
+func (s *Server) HandleGetStatus(ctx *gin.Context) {
+	refreshes, err := s.db.TokenRefreshes.Status(ctx.Request.Context())
+	if err != nil {
+		_ = ctx.AbortWithError(500, errors.Wrap(err, "Failed to load token refreshes"))
+		return
+	}
+
+	ctx.JSON(200, gin.H{
+		"loaded":          s.entitlements.Loaded(),
+		"degraded":        s.degradedReasons(),
+		"sync":            s.syncStatusOrNil(),
+		"token_refreshes": refreshes,
+	})
+}
+
+// syncStatusOrNil returns the sync status, or nil if syncs aren't tracked
+func (s *Server) syncStatusOrNil() *syncstatus.Status {
+	if s.syncStatus == nil {
+		return nil
+	}
+
+	status := s.syncStatus.Status()
+	return &status
+}
+
+// HandleReady is the readiness probe, failing until the initial data has loaded. A degraded instance is still ready, as
+// it serves the last synced data, which is better than taking lookups down with it.
+func (s *Server) HandleReady(ctx *gin.Context) {
+	if !s.entitlements.Loaded() {
+		ctx.JSON(503, gin.H{
+			"ready":    false,
+			"degraded": s.degradedReasons(),
+		})
+		return
+	}
+
+	ctx.JSON(200, gin.H{
+		"ready":    true,
+		"degraded": s.degradedReasons(),
+	})
+}
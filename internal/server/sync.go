@@ -0,0 +1,215 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/TicketsBot-cloud/gdl/objects/channel/embed"
+	"github.com/TicketsBot-cloud/gdl/objects/interaction"
+	"github.com/TicketsBot-cloud/gdl/objects/interaction/component"
+	"github.com/TicketsBot/subscriptions-app/internal/rbac"
+	"github.com/TicketsBot/subscriptions-app/internal/syncstatus"
+	"go.uber.org/zap"
+)
+
+// syncRefreshId is the custom ID of the button that re-renders the progress of the sync, as syncs of a large campaign
+// take tens of minutes
+const syncRefreshId = "sync_refresh"
+
+// syncNowId is the custom ID of the button that starts a sync without waiting for the interval
+const syncNowId = "sync_now"
+
+// progressBarWidth is the number of blocks in the progress bar of a sync
+const progressBarWidth = 20
+
+var syncCommand = command{
+	path:        "subscription sync",
+	description: "Show the progress of the Patreon sync",
+	permission:  rbac.Read,
+	handler:     handleSyncCommand,
+}
+
+func handleSyncCommand(
+	ctx context.Context,
+	s *Server,
+	data interaction.ApplicationCommandInteraction,
+	options []interaction.ApplicationCommandInteractionDataOption,
+) interaction.ResponseChannelMessage {
+	if s.syncStatus == nil {
+		return ephemeralMessage("Syncs are not tracked by this instance")
+	}
+
+	status := s.syncStatus.Status()
+	return interaction.NewResponseChannelMessage(interaction.ApplicationCommandCallbackData{
+		Embeds:     []*embed.Embed{syncEmbed(s.embedStyle(ctx), status, time.Now())},
+		Components: s.syncComponents(status),
+	})
+}
+
+// handleSyncRefresh replaces the sync progress with the latest, keeping the buttons
+func handleSyncRefresh(ctx context.Context, s *Server, data interaction.MessageComponentInteraction) interaction.ResponseUpdateMessage {
+	return s.updateSyncMessage(ctx, "")
+}
+
+// handleSyncNow starts a sync, if one isn't already running. The sync is started in the background, so its progress
+// is followed with the refresh button.
+func handleSyncNow(ctx context.Context, s *Server, data interaction.MessageComponentInteraction) interaction.ResponseUpdateMessage {
+	if s.triggerSync == nil {
+		return s.updateSyncMessage(ctx, "Syncs can't be started from this instance")
+	}
+
+	if !s.triggerSync() {
+		return s.updateSyncMessage(ctx, "A sync is already running")
+	}
+
+	user := invokingUser(data.InteractionMetadata)
+	s.loggerFor(ctx).Info("Sync started on demand", zap.Uint64("user_id", user.Id))
+
+	return s.updateSyncMessage(ctx, "Sync started, press Refresh to follow its progress")
+}
+
+// updateSyncMessage replaces the sync progress with the latest, with the content above it
+func (s *Server) updateSyncMessage(ctx context.Context, content string) interaction.ResponseUpdateMessage {
+	if s.syncStatus == nil {
+		return updateMessage("Syncs are not tracked by this instance")
+	}
+
+	status := s.syncStatus.Status()
+	return interaction.NewResponseUpdateMessage(interaction.ResponseUpdateMessageData{
+		Content:    &content,
+		Embeds:     []*embed.Embed{syncEmbed(s.embedStyle(ctx), status, time.Now())},
+		Components: s.syncComponents(status),
+	})
+}
+
+// syncComponents returns the refresh button, and the button to start a sync if syncs can be triggered and none is
+// running
+func (s *Server) syncComponents(status syncstatus.Status) []component.Component {
+	buttons := []component.Component{
+		component.BuildButton(component.Button{
+			Label:    "Refresh",
+			CustomId: syncRefreshId,
+			Style:    component.ButtonStyleSecondary,
+		}),
+	}
+
+	if s.triggerSync != nil && status.InProgress == nil {
+		buttons = append(buttons, component.BuildButton(component.Button{
+			Label:    "Sync Now",
+			CustomId: syncNowId,
+			Style:    component.ButtonStylePrimary,
+		}))
+	}
+
+	return []component.Component{component.BuildActionRow(buttons...)}
+}
+
+// syncEmbed shows the progress of the running sync, or the outcome of the last sync if none is running. Syncs are
+// tracked per instance, so this describes the syncs of the instance that handled the interaction.
+func syncEmbed(style embedStyle, status syncstatus.Status, now time.Time) *embed.Embed {
+	if progress := status.InProgress; progress != nil {
+		description := fmt.Sprintf("Fetched %d members so far", progress.Members)
+		members := fmt.Sprintf("%d", progress.Members)
+		if fraction, ok := progress.Fraction(); ok {
+			description = fmt.Sprintf("`%s` %s", progressBar(fraction, progressBarWidth), formatPercent(fraction))
+			members = fmt.Sprintf("%d of %d", progress.Members, progress.Total)
+		}
+
+		estimatedFinish := "Unknown"
+		if progress.EstimatedFinishAt != nil {
+			estimatedFinish = fmt.Sprintf("<t:%d:R>", progress.EstimatedFinishAt.Unix())
+		}
+
+		return &embed.Embed{
+			Title:       "Sync In Progress",
+			Description: description,
+			Fields: []*embed.EmbedField{
+				{
+					Name:   "Pages",
+					Value:  fmt.Sprintf("%d", progress.Pages),
+					Inline: true,
+				},
+				{
+					Name:   "Members",
+					Value:  members,
+					Inline: true,
+				},
+				{
+					Name:   "Started",
+					Value:  fmt.Sprintf("<t:%d:R>", progress.StartedAt.Unix()),
+					Inline: true,
+				},
+				{
+					Name:   "Estimated Finish",
+					Value:  estimatedFinish,
+					Inline: true,
+				},
+				{
+					Name:   "Last Page",
+					Value:  fmt.Sprintf("<t:%d:R>", progress.UpdatedAt.Unix()),
+					Inline: true,
+				},
+			},
+			Timestamp: ptr(now),
+			Color:     style.PrimaryColor,
+		}
+	}
+
+	e := &embed.Embed{
+		Title:       "No Sync In Progress",
+		Description: "The next sync starts on schedule.",
+		Timestamp:   ptr(now),
+		Color:       style.PrimaryColor,
+	}
+
+	lastSuccess, patrons, duration := "Never", "Unknown", "Unknown"
+	if status.LastSuccessAt != nil {
+		lastSuccess = fmt.Sprintf("<t:%d:R>", status.LastSuccessAt.Unix())
+	}
+
+	if status.Patrons != nil {
+		patrons = fmt.Sprintf("%d", *status.Patrons)
+	}
+
+	if status.LastDurationSeconds != nil {
+		duration = (time.Duration(*status.LastDurationSeconds) * time.Second).String()
+	}
+
+	e.Fields = []*embed.EmbedField{
+		{
+			Name:   "Last Success",
+			Value:  lastSuccess,
+			Inline: true,
+		},
+		{
+			Name:   "Patrons",
+			Value:  patrons,
+			Inline: true,
+		},
+		{
+			Name:   "Duration",
+			Value:  duration,
+			Inline: true,
+		},
+	}
+
+	// The last error is kept after later syncs succeed, but is only of interest while syncs are failing
+	if status.ConsecutiveFailures > 0 && status.LastError != nil && status.LastErrorAt != nil {
+		e.Color = style.ErrorColor
+		e.Fields = append(e.Fields, &embed.EmbedField{
+			Name:   fmt.Sprintf("Failing (%d in a row)", status.ConsecutiveFailures),
+			Value:  fmt.Sprintf("<t:%d:R>\n```%s```", status.LastErrorAt.Unix(), truncate(*status.LastError, embedFieldLimit-32)),
+			Inline: false,
+		})
+	}
+
+	return e
+}
+
+// progressBar draws the fraction as a bar of blocks
+func progressBar(fraction float64, width int) string {
+	filled := min(max(int(fraction*float64(width)), 0), width)
+	return strings.Repeat("█", filled) + strings.Repeat("░", width-filled)
+}
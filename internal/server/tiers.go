@@ -0,0 +1,287 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/TicketsBot-cloud/gdl/objects/channel/embed"
+	"github.com/TicketsBot-cloud/gdl/objects/interaction"
+	"github.com/TicketsBot/subscriptions-app/internal/config"
+	"github.com/TicketsBot/subscriptions-app/internal/currency"
+	"github.com/TicketsBot/subscriptions-app/internal/rbac"
+	"go.uber.org/zap"
+)
+
+var tiersUnknownCommand = command{
+	path:        "tiers unknown",
+	description: "List Patreon tiers that have not been assigned a name",
+	permission:  rbac.Read,
+	handler:     handleTiersUnknown,
+}
+
+func handleTiersUnknown(
+	ctx context.Context,
+	s *Server,
+	data interaction.ApplicationCommandInteraction,
+	options []interaction.ApplicationCommandInteractionDataOption,
+) interaction.ResponseChannelMessage {
+	unknown, err := s.tiers.Unknown(ctx)
+	if err != nil {
+		s.loggerFor(ctx).Error("Failed to fetch unknown tiers", zap.Error(err))
+		return s.errorMessage(ctx, "Failed to fetch unknown tiers")
+	}
+
+	if len(unknown) == 0 {
+		return interaction.NewResponseChannelMessage(interaction.ApplicationCommandCallbackData{
+			Embeds: []*embed.Embed{
+				{
+					Title:       "Unknown Tiers",
+					Description: "There are no unknown tiers",
+					Timestamp:   ptr(time.Now()),
+					Color:       s.primaryColor(ctx),
+				},
+			},
+		})
+	}
+
+	lines := make([]string, len(unknown))
+	for i, tier := range unknown {
+		lines[i] = fmt.Sprintf(
+			"`%d` - first seen <t:%d:R> ([sample patron](%s))",
+			tier.TierId, tier.FirstSeen.Unix(), s.patronUrl(tier.SamplePatronId),
+		)
+	}
+
+	return interaction.NewResponseChannelMessage(interaction.ApplicationCommandCallbackData{
+		Embeds: []*embed.Embed{
+			{
+				Title:       "Unknown Tiers",
+				Description: strings.Join(lines, "\n") + "\n\nUse `/tiers map` to assign a name to a tier.",
+				Timestamp:   ptr(time.Now()),
+				Color:       s.errorColor(ctx),
+			},
+		},
+	})
+}
+
+var tiersMapCommand = command{
+	path:        "tiers map",
+	description: "Assign a name to a Patreon tier",
+	options: []interaction.ApplicationCommandOption{
+		{
+			Type:        interaction.OptionTypeInteger,
+			Name:        "tier_id",
+			Description: "The Patreon ID of the tier",
+			Required:    true,
+		},
+		{
+			Type:        interaction.OptionTypeString,
+			Name:        "name",
+			Description: "The name to display for the tier",
+			Required:    true,
+		},
+	},
+	permission: rbac.Admin,
+	handler:    handleTiersMap,
+	writes:     true,
+}
+
+func handleTiersMap(
+	ctx context.Context,
+	s *Server,
+	data interaction.ApplicationCommandInteraction,
+	options []interaction.ApplicationCommandInteractionDataOption,
+) interaction.ResponseChannelMessage {
+	tierIdOption, ok := findOption(options, "tier_id")
+	if !ok {
+		return ephemeralMessage("Missing tier ID")
+	}
+
+	tierIdRaw, ok := integerValue(tierIdOption)
+	if !ok {
+		return ephemeralMessage("Tier ID was wrong type")
+	}
+
+	if tierIdRaw < 0 {
+		return ephemeralMessage("Tier ID cannot be negative")
+	}
+
+	nameOption, ok := findOption(options, "name")
+	if !ok {
+		return ephemeralMessage("Missing name")
+	}
+
+	name, ok := stringValue(nameOption)
+	if !ok {
+		return ephemeralMessage("Name was wrong type")
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return ephemeralMessage("Name cannot be empty")
+	}
+
+	tierId := uint64(tierIdRaw)
+
+	user := invokingUser(data.InteractionMetadata)
+	if err := s.tiers.Map(ctx, tierId, name, user.Id); err != nil {
+		s.loggerFor(ctx).Error("Failed to map tier", zap.Uint64("tier_id", tierId), zap.Error(err))
+		return s.errorMessage(ctx, "Failed to map tier")
+	}
+
+	s.loggerFor(ctx).Info("Tier mapped", zap.Uint64("tier_id", tierId), zap.String("name", name), zap.Uint64("user_id", user.Id))
+
+	return interaction.NewResponseChannelMessage(interaction.ApplicationCommandCallbackData{
+		Embeds: []*embed.Embed{
+			{
+				Title:       "Tier Mapped",
+				Description: fmt.Sprintf("Tier `%d` is now mapped to **%s**. Patrons will be updated on the next sync.", tierId, name),
+				Timestamp:   ptr(time.Now()),
+				Color:       s.primaryColor(ctx),
+			},
+		},
+	})
+}
+
+// tierSummary is a row of the /tiers list embed. Tiers that patrons are entitled to without being discovered, configured
+// or mapped are not Known, and have a zero Tier.
+type tierSummary struct {
+	TierId  uint64
+	Tier    config.Tier
+	Known   bool
+	Patrons int
+}
+
+// tiersPageSize is the number of tiers shown on each page of /tiers list
+const tiersPageSize = 20
+
+// tiersPageView routes the page buttons of /tiers list, which have no state
+const tiersPageView = "tiers_page"
+
+var tiersListCommand = command{
+	path:        "tiers list",
+	description: "List the tiers with their prices and active patron counts",
+	permission:  rbac.Read,
+	handler:     handleTiersList,
+}
+
+// handleTiersList shows every known tier alongside the number of active patrons entitled to it, so that mappings can be
+// checked after tiers are changed on Patreon
+func handleTiersList(
+	ctx context.Context,
+	s *Server,
+	_ interaction.ApplicationCommandInteraction,
+	_ []interaction.ApplicationCommandInteractionDataOption,
+) interaction.ResponseChannelMessage {
+	p, errorMessage := renderTiersPage(ctx, s, "", 0)
+	if errorMessage != "" {
+		return ephemeralMessage(errorMessage)
+	}
+
+	return paginatedMessage(tiersPageView, "", p)
+}
+
+// renderTiersPage renders a page of the tiers, from the latest snapshot
+func renderTiersPage(ctx context.Context, s *Server, _ string, index int) (page, string) {
+	if !s.entitlements.Loaded() {
+		return page{}, "Initial data not loaded yet, please try again in a few minutes"
+	}
+
+	settings := s.guildSettingsFor(ctx)
+	summaries := slices.DeleteFunc(tierSummaries(s.tiers.All(), s.entitlements.TierCounts()), func(summary tierSummary) bool {
+		return !settings.TierVisible(summary.TierId)
+	})
+	start, end, shown, count := pageBounds(len(summaries), tiersPageSize, index)
+
+	return page{
+		Embed: tiersEmbed(s.embedStyle(ctx), summaries[start:end], s.currentConfig().Revenue.Currency, time.Now()),
+		Index: shown,
+		Count: count,
+	}, ""
+}
+
+// tierSummaries joins the known tiers with the patron counts, including tiers that have patrons but no name. Tiers are
+// ordered by price, then ID, with unknown tiers last.
+func tierSummaries(known map[uint64]config.Tier, counts map[uint64]int) []tierSummary {
+	summaries := make([]tierSummary, 0, len(known))
+	for tierId, tier := range known {
+		summaries = append(summaries, tierSummary{TierId: tierId, Tier: tier, Known: true, Patrons: counts[tierId]})
+	}
+
+	for tierId, patrons := range counts {
+		if _, ok := known[tierId]; !ok {
+			summaries = append(summaries, tierSummary{TierId: tierId, Patrons: patrons})
+		}
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		a, b := summaries[i], summaries[j]
+		if a.Known != b.Known {
+			return a.Known
+		}
+
+		if a.Tier.PriceCents != b.Tier.PriceCents {
+			return a.Tier.PriceCents < b.Tier.PriceCents
+		}
+
+		return a.TierId < b.TierId
+	})
+
+	return summaries
+}
+
+// tiersEmbed lists a page of tiers one per line, with their ID, name, price and active patron count
+func tiersEmbed(style embedStyle, summaries []tierSummary, baseCurrency string, now time.Time) *embed.Embed {
+	e := &embed.Embed{
+		Title:     "Tiers",
+		Timestamp: ptr(now),
+		Color:     style.PrimaryColor,
+	}
+
+	if len(summaries) == 0 {
+		e.Description = "No tiers are configured, and no patrons are entitled to any tiers"
+		e.Color = style.ErrorColor
+		return e
+	}
+
+	// Unknown tiers are sorted last, and leave room for a hint on mapping them
+	var hint string
+	limit := embedDescriptionLimit
+	if !summaries[len(summaries)-1].Known {
+		hint = "\n\nUse `/tiers map` to assign a name to unknown tiers."
+		limit -= len(hint)
+		e.Color = style.ErrorColor
+	}
+
+	var b strings.Builder
+	for i, summary := range summaries {
+		name := summary.Tier.Name
+		if !summary.Known {
+			name = "Unknown"
+		}
+
+		price := "no price set"
+		if summary.Tier.PriceCents > 0 {
+			price = currency.Format(summary.Tier.PriceCents, baseCurrency)
+		}
+
+		line := fmt.Sprintf("`%d` **%s**: %s, %d active patrons\n", summary.TierId, name, price, summary.Patrons)
+		if b.Len()+len(line) > limit {
+			remaining := fmt.Sprintf("... and %d more", len(summaries)-i)
+			if b.Len()+len(remaining) <= limit {
+				b.WriteString(remaining)
+			}
+
+			break
+		}
+
+		b.WriteString(line)
+	}
+
+	e.Description = strings.TrimSuffix(b.String(), "\n") + hint
+	return e
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/TicketsBot/subscriptions-app/internal/tracing"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Trace starts a span for each request, continuing any trace propagated by the caller
+func (s *Server) Trace(ctx *gin.Context) {
+	reqCtx := otel.GetTextMapPropagator().Extract(ctx.Request.Context(), propagation.HeaderCarrier(ctx.Request.Header))
+
+	route := ctx.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+
+	reqCtx, span := tracing.Tracer().Start(
+		reqCtx,
+		fmt.Sprintf("%s %s", ctx.Request.Method, route),
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("http.request.method", ctx.Request.Method),
+			attribute.String("http.route", route),
+		),
+	)
+	defer span.End()
+
+	ctx.Request = ctx.Request.WithContext(reqCtx)
+	ctx.Next()
+
+	status := ctx.Writer.Status()
+	span.SetAttributes(attribute.Int("http.response.status_code", status))
+	if status >= 500 {
+		span.SetStatus(codes.Error, "")
+	}
+
+	for _, err := range ctx.Errors {
+		span.RecordError(err.Err)
+	}
+}
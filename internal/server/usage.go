@@ -0,0 +1,135 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/TicketsBot-cloud/gdl/objects/channel/embed"
+	"github.com/TicketsBot-cloud/gdl/objects/channel/message"
+	"github.com/TicketsBot-cloud/gdl/objects/interaction"
+	"github.com/TicketsBot/subscriptions-app/internal/database"
+	"github.com/TicketsBot/subscriptions-app/internal/rbac"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultUsageDays = 30
+	maxUsageDays     = 365
+
+	usageLeaderboardSize = 10
+)
+
+var statsUsageCommand = command{
+	path:        "subscription stats usage",
+	description: "View how often each command is run, how fast it responds, and who runs the most",
+	options: []interaction.ApplicationCommandOption{
+		{
+			Type:        interaction.OptionTypeInteger,
+			Name:        "days",
+			Description: fmt.Sprintf("How many days to report on (default %d)", defaultUsageDays),
+			Required:    false,
+		},
+	},
+	permission: rbac.Export,
+	handler:    handleStatsUsage,
+}
+
+// handleStatsUsage reports the uses of each command and the staff who ran the most, so that unused support tools can
+// be found, and slow ones sped up
+func handleStatsUsage(
+	ctx context.Context,
+	s *Server,
+	_ interaction.ApplicationCommandInteraction,
+	options []interaction.ApplicationCommandInteractionDataOption,
+) interaction.ResponseChannelMessage {
+	days := defaultUsageDays
+	if daysOption, ok := findOption(options, "days"); ok {
+		if days, ok = integerValue(daysOption); !ok {
+			return ephemeralMessage("Days was wrong type")
+		}
+	}
+
+	if days < 1 || days > maxUsageDays {
+		return ephemeralMessage(fmt.Sprintf("Days must be between 1 and %d", maxUsageDays))
+	}
+
+	since := time.Now().AddDate(0, 0, -days)
+
+	commands, err := s.db.CommandUsage.ByCommand(ctx, since)
+	if err != nil {
+		s.loggerFor(ctx).Error("Failed to fetch command usage", zap.Error(err))
+		return s.errorMessage(ctx, "Failed to fetch command usage, please try again later")
+	}
+
+	users, err := s.db.CommandUsage.ByUser(ctx, since, usageLeaderboardSize)
+	if err != nil {
+		s.loggerFor(ctx).Error("Failed to fetch command usage by user", zap.Error(err))
+		return s.errorMessage(ctx, "Failed to fetch command usage, please try again later")
+	}
+
+	return interaction.NewResponseChannelMessage(interaction.ApplicationCommandCallbackData{
+		Embeds: []*embed.Embed{usageEmbed(s.embedStyle(ctx), days, commands, users, time.Now())},
+		Flags:  uint(message.FlagEphemeral),
+	})
+}
+
+// usageEmbed lists each command with its uses and response times, most used first, and the staff who ran the most
+// commands
+func usageEmbed(style embedStyle, days int, commands []database.CommandUsage, users []database.UserUsage, now time.Time) *embed.Embed {
+	e := &embed.Embed{
+		Title:     fmt.Sprintf("Command Usage (last %d days)", days),
+		Timestamp: ptr(now),
+		Color:     style.PrimaryColor,
+	}
+
+	if len(commands) == 0 {
+		e.Description = "No commands have been run in this period"
+		e.Color = style.ErrorColor
+		return e
+	}
+
+	var total int
+	var b strings.Builder
+	for i, command := range commands {
+		total += command.Uses
+
+		line := fmt.Sprintf("`/%s` %d uses by %d staff, %s median, %s p95\n",
+			command.Command, command.Uses, command.Users, formatMs(command.MedianMs), formatMs(command.P95Ms))
+
+		if b.Len()+len(line) > embedDescriptionLimit {
+			remaining := fmt.Sprintf("... and %d more", len(commands)-i)
+			if b.Len()+len(remaining) <= embedDescriptionLimit {
+				b.WriteString(remaining)
+			}
+
+			break
+		}
+
+		b.WriteString(line)
+	}
+
+	e.Description = strings.TrimSuffix(b.String(), "\n")
+
+	var userLines []string
+	for i, user := range users {
+		userLines = append(userLines, fmt.Sprintf("%d. <@%d> %d uses, mostly `/%s`", i+1, user.UserId, user.Uses, user.MostUsed))
+	}
+
+	e.Fields = []*embed.EmbedField{
+		{Name: "Commands Run", Value: fmt.Sprint(total), Inline: true},
+		{Name: "Top Staff", Value: truncate(strings.Join(userLines, "\n"), maxFieldLength)},
+	}
+
+	return e
+}
+
+// formatMs formats a duration in milliseconds, switching to seconds for slow responses
+func formatMs(ms float64) string {
+	if ms >= 1000 {
+		return fmt.Sprintf("%.1fs", ms/1000)
+	}
+
+	return fmt.Sprintf("%.0fms", ms)
+}
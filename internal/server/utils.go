@@ -1,6 +1,16 @@
 package server
 
-import "github.com/gin-gonic/gin"
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/TicketsBot-cloud/gdl/objects/channel/embed"
+	"github.com/TicketsBot-cloud/gdl/objects/channel/message"
+	"github.com/TicketsBot-cloud/gdl/objects/interaction"
+	"github.com/TicketsBot-cloud/gdl/objects/user"
+	"github.com/gin-gonic/gin"
+)
 
 func errorJson(message string) gin.H {
 	return gin.H{
@@ -21,3 +31,85 @@ func contains[T comparable](slice []T, item T) bool {
 func ptr[T any](value T) *T {
 	return &value
 }
+
+const (
+	permissionAdministrator uint64 = 1 << 3
+	permissionManageGuild   uint64 = 1 << 5
+)
+
+// hasPermission checks a member's computed permissions, as sent in the interaction payload. Administrators are
+// implicitly granted every permission.
+func hasPermission(permissions, permission uint64) bool {
+	return permissions&permissionAdministrator == permissionAdministrator || permissions&permission == permission
+}
+
+func ephemeralMessage(content string) interaction.ResponseChannelMessage {
+	return interaction.NewResponseChannelMessage(interaction.ApplicationCommandCallbackData{
+		Content: content,
+		Flags:   uint(message.FlagEphemeral),
+	})
+}
+
+// errorMessage responds with an error that staff may need to report, including the request ID so that the failure
+// can be traced to the logs
+func (s *Server) errorMessage(ctx context.Context, content string) interaction.ResponseChannelMessage {
+	e := &embed.Embed{
+		Title:       "Error",
+		Description: content,
+		Color:       s.errorColor(ctx),
+		Timestamp:   ptr(time.Now()),
+	}
+
+	if id := requestIdFromContext(ctx); id != "" {
+		e.Footer = &embed.EmbedFooter{
+			Text: "Error ID: " + id,
+		}
+	}
+
+	return interaction.NewResponseChannelMessage(interaction.ApplicationCommandCallbackData{
+		Embeds: []*embed.Embed{e},
+		Flags:  uint(message.FlagEphemeral),
+	})
+}
+
+func invokingUser(data interaction.InteractionMetadata) user.User {
+	if data.Member != nil {
+		return data.Member.User
+	} else if data.User != nil {
+		return *data.User
+	} // Other should be infallible
+
+	return user.User{}
+}
+
+func findOption(
+	options []interaction.ApplicationCommandInteractionDataOption,
+	name string,
+) (interaction.ApplicationCommandInteractionDataOption, bool) {
+	for _, option := range options {
+		if option.Name == name {
+			return option, true
+		}
+	}
+
+	return interaction.ApplicationCommandInteractionDataOption{}, false
+}
+
+// truncate shortens the string to at most limit characters, ending it with an ellipsis if it was cut
+func truncate(str string, limit int) string {
+	runes := []rune(str)
+	if len(runes) <= limit {
+		return str
+	}
+
+	return string(runes[:limit-1]) + "…"
+}
+
+// tierName returns the name of the tier, or its ID if it has no name
+func (s *Server) tierName(tierId uint64) string {
+	if name, ok := s.tiers.Name(tierId); ok {
+		return name
+	}
+
+	return strconv.FormatUint(tierId, 10)
+}
@@ -0,0 +1,297 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/TicketsBot-cloud/gdl/objects/channel/embed"
+	"github.com/TicketsBot-cloud/gdl/objects/channel/message"
+	"github.com/TicketsBot-cloud/gdl/objects/interaction"
+	"github.com/TicketsBot/subscriptions-app/internal/database"
+	"github.com/TicketsBot/subscriptions-app/internal/rbac"
+	"github.com/TicketsBot/subscriptions-app/internal/vouchers"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+var voucherCreateCommand = command{
+	path:        "voucher create",
+	description: "Generate single-use codes that grant a tier for a fixed duration",
+	options: []interaction.ApplicationCommandOption{
+		{
+			Type:        interaction.OptionTypeString,
+			Name:        "tier",
+			Description: "The name of the tier to grant",
+			Required:    true,
+		},
+		{
+			Type:        interaction.OptionTypeInteger,
+			Name:        "duration_days",
+			Description: "How many days the tier is granted for once redeemed",
+			Required:    true,
+		},
+		{
+			Type:        interaction.OptionTypeInteger,
+			Name:        "count",
+			Description: "How many codes to generate (default 1)",
+			Required:    false,
+		},
+	},
+	permission: rbac.Grant,
+	handler:    handleVoucherCreate,
+}
+
+func handleVoucherCreate(
+	ctx context.Context,
+	s *Server,
+	data interaction.ApplicationCommandInteraction,
+	options []interaction.ApplicationCommandInteractionDataOption,
+) interaction.ResponseChannelMessage {
+	tierOption, ok := findOption(options, "tier")
+	if !ok {
+		return ephemeralMessage("Missing tier")
+	}
+
+	tier, ok := stringValue(tierOption)
+	if !ok {
+		return ephemeralMessage("Tier was wrong type")
+	}
+
+	durationOption, ok := findOption(options, "duration_days")
+	if !ok {
+		return ephemeralMessage("Missing duration")
+	}
+
+	duration, ok := integerValue(durationOption)
+	if !ok {
+		return ephemeralMessage("Duration was wrong type")
+	}
+
+	count := 1
+	if countOption, ok := findOption(options, "count"); ok {
+		count, ok = integerValue(countOption)
+		if !ok {
+			return ephemeralMessage("Count was wrong type")
+		}
+	}
+
+	user := invokingUser(data.InteractionMetadata)
+
+	created, err := s.vouchers.Create(ctx, tier, duration, count, user.Id, "command")
+	if err != nil {
+		if msg, ok := voucherErrorMessage(err); ok {
+			return ephemeralMessage(msg)
+		}
+
+		s.loggerFor(ctx).Error("Failed to create vouchers", zap.Uint64("user_id", user.Id), zap.Error(err))
+		return s.errorMessage(ctx, "Failed to create vouchers")
+	}
+
+	codes := make([]string, len(created))
+	for i, voucher := range created {
+		codes[i] = fmt.Sprintf("`%s`", voucher.Code)
+	}
+
+	return interaction.NewResponseChannelMessage(interaction.ApplicationCommandCallbackData{
+		Embeds: []*embed.Embed{
+			{
+				Title: "Vouchers Created",
+				Description: fmt.Sprintf(
+					"Each code grants **%s** for %d days once redeemed with `/redeem`.\n\n%s",
+					created[0].Tier, created[0].DurationDays, strings.Join(codes, "\n"),
+				),
+				Timestamp: ptr(time.Now()),
+				Color:     s.primaryColor(ctx),
+			},
+		},
+		Flags: uint(message.FlagEphemeral),
+	})
+}
+
+var voucherRevokeCommand = command{
+	path:        "voucher revoke",
+	description: "Revoke a voucher code that hasn't been redeemed",
+	options: []interaction.ApplicationCommandOption{
+		{
+			Type:        interaction.OptionTypeString,
+			Name:        "code",
+			Description: "The voucher code to revoke",
+			Required:    true,
+		},
+	},
+	permission: rbac.Revoke,
+	handler:    handleVoucherRevoke,
+}
+
+func handleVoucherRevoke(
+	ctx context.Context,
+	s *Server,
+	data interaction.ApplicationCommandInteraction,
+	options []interaction.ApplicationCommandInteractionDataOption,
+) interaction.ResponseChannelMessage {
+	codeOption, ok := findOption(options, "code")
+	if !ok {
+		return ephemeralMessage("Missing code")
+	}
+
+	code, ok := stringValue(codeOption)
+	if !ok {
+		return ephemeralMessage("Code was wrong type")
+	}
+
+	user := invokingUser(data.InteractionMetadata)
+
+	voucher, err := s.vouchers.Revoke(ctx, code, user.Id, "command")
+	if err != nil {
+		if errors.Is(err, database.ErrVoucherUnavailable) {
+			return ephemeralMessage("That code does not exist or has already been redeemed")
+		}
+
+		s.loggerFor(ctx).Error("Failed to revoke voucher", zap.Uint64("user_id", user.Id), zap.Error(err))
+		return s.errorMessage(ctx, "Failed to revoke voucher")
+	}
+
+	return interaction.NewResponseChannelMessage(interaction.ApplicationCommandCallbackData{
+		Embeds: []*embed.Embed{
+			{
+				Title:       "Voucher Revoked",
+				Description: fmt.Sprintf("`%s` can no longer be redeemed for **%s**.", voucher.Code, voucher.Tier),
+				Timestamp:   ptr(time.Now()),
+				Color:       s.primaryColor(ctx),
+			},
+		},
+		Flags: uint(message.FlagEphemeral),
+	})
+}
+
+var redeemCommand = command{
+	path:        "redeem",
+	description: "Redeem a voucher code",
+	options: []interaction.ApplicationCommandOption{
+		{
+			Type:        interaction.OptionTypeString,
+			Name:        "code",
+			Description: "The voucher code to redeem",
+			Required:    true,
+		},
+	},
+	handler: handleRedeemCommand,
+}
+
+func handleRedeemCommand(
+	ctx context.Context,
+	s *Server,
+	data interaction.ApplicationCommandInteraction,
+	options []interaction.ApplicationCommandInteractionDataOption,
+) interaction.ResponseChannelMessage {
+	codeOption, ok := findOption(options, "code")
+	if !ok {
+		return ephemeralMessage("Missing code")
+	}
+
+	code, ok := stringValue(codeOption)
+	if !ok {
+		return ephemeralMessage("Code was wrong type")
+	}
+
+	user := invokingUser(data.InteractionMetadata)
+
+	voucher, expiresAt, err := s.vouchers.Redeem(ctx, code, user.Id)
+	if err != nil {
+		if errors.Is(err, database.ErrVoucherUnavailable) {
+			return ephemeralMessage("That code is not valid or has already been redeemed")
+		}
+
+		s.loggerFor(ctx).Error("Failed to redeem voucher", zap.Uint64("user_id", user.Id), zap.Error(err))
+		return s.errorMessage(ctx, "Failed to redeem your code, please try again later")
+	}
+
+	return interaction.NewResponseChannelMessage(interaction.ApplicationCommandCallbackData{
+		Embeds: []*embed.Embed{
+			{
+				Title:       "Code Redeemed",
+				Description: fmt.Sprintf("You now have **%s** until <t:%d:D>.", voucher.Tier, expiresAt.Unix()),
+				Timestamp:   ptr(time.Now()),
+				Color:       s.primaryColor(ctx),
+			},
+		},
+		Flags: uint(message.FlagEphemeral),
+	})
+}
+
+type createVouchersBody struct {
+	Tier         string `json:"tier"`
+	DurationDays int    `json:"duration_days"`
+	Count        int    `json:"count"`
+}
+
+func (s *Server) HandleCreateVouchers(ctx *gin.Context) {
+	var body createVouchersBody
+	if err := ctx.ShouldBindJSON(&body); err != nil {
+		ctx.JSON(400, errorJson("Failed to parse body"))
+		return
+	}
+
+	if body.Count == 0 {
+		body.Count = 1
+	}
+
+	created, err := s.vouchers.Create(ctx.Request.Context(), body.Tier, body.DurationDays, body.Count, 0, "api")
+	if err != nil {
+		if msg, ok := voucherErrorMessage(err); ok {
+			ctx.JSON(400, errorJson(msg))
+			return
+		}
+
+		_ = ctx.Error(err)
+		return
+	}
+
+	codes := make([]string, len(created))
+	for i, voucher := range created {
+		codes[i] = voucher.Code
+	}
+
+	ctx.JSON(200, gin.H{
+		"tier":          created[0].Tier,
+		"duration_days": created[0].DurationDays,
+		"codes":         codes,
+	})
+}
+
+// HandleRevokeVoucher deletes a voucher that hasn't been redeemed, responding with 404 if there is none with the code
+func (s *Server) HandleRevokeVoucher(ctx *gin.Context) {
+	voucher, err := s.vouchers.Revoke(ctx.Request.Context(), ctx.Param("code"), 0, "api")
+	if err != nil {
+		if errors.Is(err, database.ErrVoucherUnavailable) {
+			ctx.JSON(404, errorJson("Voucher does not exist or has already been redeemed"))
+			return
+		}
+
+		_ = ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(200, gin.H{
+		"code":          voucher.Code,
+		"tier":          voucher.Tier,
+		"duration_days": voucher.DurationDays,
+	})
+}
+
+// voucherErrorMessage returns a user-facing message for validation errors
+func voucherErrorMessage(err error) (string, bool) {
+	switch {
+	case errors.Is(err, vouchers.ErrInvalidDuration):
+		return fmt.Sprintf("Duration must be between 1 and %d days", vouchers.MaxDurationDays), true
+	case errors.Is(err, vouchers.ErrInvalidBatchSize):
+		return fmt.Sprintf("Count must be between 1 and %d", vouchers.MaxBatchSize), true
+	case errors.Is(err, vouchers.ErrUnknownTier):
+		return "Unknown tier", true
+	default:
+		return "", false
+	}
+}
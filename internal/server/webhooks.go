@@ -0,0 +1,102 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/TicketsBot-cloud/gdl/objects/entitlement"
+	"github.com/TicketsBot/subscriptions-app/pkg/discord"
+	"github.com/TicketsBot/subscriptions-app/pkg/lemonsqueezy"
+	"github.com/TicketsBot/subscriptions-app/pkg/paddle"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+func (s *Server) HandlePaddleWebhook(ctx *gin.Context) {
+	body, err := io.ReadAll(ctx.Request.Body)
+	if err != nil {
+		_ = ctx.AbortWithError(500, errors.Wrap(err, "Failed to read body"))
+		return
+	}
+
+	if err := paddle.VerifySignature(s.currentConfig().Paddle.WebhookSecret, ctx.GetHeader("Paddle-Signature"), body); err != nil {
+		s.loggerFor(ctx.Request.Context()).Warn("Rejected Paddle webhook", zap.Error(err))
+		ctx.AbortWithStatusJSON(401, errorJson("Invalid signature"))
+		return
+	}
+
+	var event paddle.Event
+	if err := json.Unmarshal(body, &event); err != nil {
+		ctx.JSON(400, errorJson("Failed to parse body"))
+		return
+	}
+
+	if err := s.providers.Paddle.HandleEvent(ctx.Request.Context(), event); err != nil {
+		_ = ctx.Error(errors.Wrapf(err, "Failed to handle Paddle event %s", event.EventId))
+		return
+	}
+
+	ctx.Status(200)
+}
+
+func (s *Server) HandleLemonSqueezyWebhook(ctx *gin.Context) {
+	body, err := io.ReadAll(ctx.Request.Body)
+	if err != nil {
+		_ = ctx.AbortWithError(500, errors.Wrap(err, "Failed to read body"))
+		return
+	}
+
+	if err := lemonsqueezy.VerifySignature(s.currentConfig().LemonSqueezy.WebhookSecret, ctx.GetHeader("X-Signature"), body); err != nil {
+		s.loggerFor(ctx.Request.Context()).Warn("Rejected Lemon Squeezy webhook", zap.Error(err))
+		ctx.AbortWithStatusJSON(401, errorJson("Invalid signature"))
+		return
+	}
+
+	var event lemonsqueezy.Event
+	if err := json.Unmarshal(body, &event); err != nil {
+		ctx.JSON(400, errorJson("Failed to parse body"))
+		return
+	}
+
+	if err := s.providers.LemonSqueezy.HandleEvent(ctx.Request.Context(), event); err != nil {
+		_ = ctx.Error(errors.Wrapf(err, "Failed to handle Lemon Squeezy event %s", event.Meta.EventName))
+		return
+	}
+
+	ctx.Status(200)
+}
+
+// HandleDiscordWebhook receives webhook events for the application. The signature is verified by the Authenticate
+// middleware, as with interactions.
+func (s *Server) HandleDiscordWebhook(ctx *gin.Context) {
+	var payload discord.WebhookPayload
+	if err := ctx.ShouldBindJSON(&payload); err != nil {
+		ctx.JSON(400, errorJson("Failed to parse body"))
+		return
+	}
+
+	if payload.Type == discord.WebhookTypePing || payload.Event == nil {
+		ctx.Status(http.StatusNoContent)
+		return
+	}
+
+	switch payload.Event.Type {
+	case discord.EventTypeEntitlementCreate:
+		var ent entitlement.Entitlement
+		if err := json.Unmarshal(payload.Event.Data, &ent); err != nil {
+			ctx.JSON(400, errorJson("Failed to parse entitlement"))
+			return
+		}
+
+		if err := s.providers.Discord.HandleEntitlement(ctx.Request.Context(), ent, payload.Event.Timestamp); err != nil {
+			_ = ctx.Error(errors.Wrapf(err, "Failed to handle entitlement %d", ent.Id))
+			return
+		}
+	default:
+		s.loggerFor(ctx.Request.Context()).Debug("Ignoring Discord webhook event", zap.String("event_type", string(payload.Event.Type)))
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
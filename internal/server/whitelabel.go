@@ -0,0 +1,99 @@
+package server
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/TicketsBot/subscriptions-app/internal/entitlements"
+	"github.com/TicketsBot/subscriptions-app/internal/whitelabel"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type whitelabelEntitlementResponse struct {
+	BotId    uint64 `json:"bot_id,string"`
+	OwnerId  uint64 `json:"owner_id,string"`
+	Entitled bool   `json:"entitled"`
+	Tier     string `json:"tier,omitempty"` // The tier granting the whitelabel perk, if entitled
+	Source   string `json:"source,omitempty"`
+
+	// ExpiresAt is when the whitelabel perk expires if nothing changes, so the bot can cache the result until then.
+	// Unset if it doesn't expire, or if the owner isn't entitled.
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// HandleGetWhitelabelEntitlement returns whether the owner of a whitelabel bot has an active subscription with the
+// whitelabel perk
+func (s *Server) HandleGetWhitelabelEntitlement(ctx *gin.Context) {
+	botId, err := strconv.ParseUint(ctx.Param("botId"), 10, 64)
+	if err != nil {
+		ctx.JSON(400, errorJson("Invalid bot ID"))
+		return
+	}
+
+	if !s.entitlements.Loaded() {
+		ctx.JSON(503, errorJson("Initial data not loaded yet"))
+		return
+	}
+
+	conf := s.currentConfig()
+	logger := s.loggerFor(ctx.Request.Context())
+
+	ownerId, err := s.owners.Owner(ctx.Request.Context(), conf, botId)
+	if err != nil {
+		if errors.Is(err, whitelabel.ErrUnknownBot) {
+			ctx.JSON(404, errorJson("Unknown whitelabel bot"))
+			return
+		}
+
+		logger.Error("Failed to look up whitelabel bot owner", zap.Uint64("bot_id", botId), zap.Error(err))
+		ctx.JSON(503, errorJson("Failed to look up the bot's owner"))
+		return
+	}
+
+	found, err := s.entitlements.ByDiscordId(ctx.Request.Context(), ownerId)
+	if err != nil {
+		// An incomplete result could revoke whitelabel from an owner who is entitled through the failed source
+		logger.Error("Failed to look up entitlements", zap.Error(err))
+		ctx.JSON(503, errorJson("Failed to look up entitlements from every source"))
+		return
+	}
+
+	res := whitelabelEntitlementResponse{
+		BotId:   botId,
+		OwnerId: ownerId,
+	}
+
+	if entitlement, ok := s.whitelabelEntitlement(found, conf.Whitelabel.Perk); ok {
+		res.Entitled = true
+		res.Tier = entitlement.Tier
+		res.Source = entitlement.Source
+		res.ExpiresAt = entitlement.PremiumExpiresAt
+	}
+
+	ctx.JSON(200, res)
+}
+
+// whitelabelEntitlement returns the active entitlement granting the perk that expires last, preferring one that never
+// expires
+func (s *Server) whitelabelEntitlement(found []entitlements.Entitlement, perk string) (entitlements.Entitlement, bool) {
+	var best entitlements.Entitlement
+	ok := false
+	for _, entitlement := range found {
+		if !entitlement.Active {
+			continue
+		}
+
+		tier, known := s.tiers.ByName(entitlement.Tier)
+		if !known || !tier.HasPerk(perk) {
+			continue
+		}
+
+		if !ok || (best.PremiumExpiresAt != nil && (entitlement.PremiumExpiresAt == nil || entitlement.PremiumExpiresAt.After(*best.PremiumExpiresAt))) {
+			best, ok = entitlement, true
+		}
+	}
+
+	return best, ok
+}
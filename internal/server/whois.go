@@ -0,0 +1,127 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/TicketsBot-cloud/gdl/objects/channel/embed"
+	"github.com/TicketsBot-cloud/gdl/objects/interaction"
+	"github.com/TicketsBot/subscriptions-app/internal/privacy"
+	"github.com/TicketsBot/subscriptions-app/internal/rbac"
+	"github.com/TicketsBot/subscriptions-app/pkg/patreon"
+)
+
+// embedDescriptionLimit is the maximum length of an embed description
+const embedDescriptionLimit = 4096
+
+var whoisCommand = command{
+	path:        "whois",
+	description: "List patrons with an email at a domain, and whether their Discord is linked",
+	options: []interaction.ApplicationCommandOption{
+		{
+			Type:        interaction.OptionTypeString,
+			Name:        "domain",
+			Description: "The email domain to search for, such as example.com",
+			Required:    true,
+		},
+	},
+	permission: rbac.Export,
+	handler:    handleWhoisCommand,
+}
+
+// handleWhoisCommand lists the patrons with an email at a domain, and whether they have linked their Discord account,
+// so that subscriptions paid for with company addresses can be matched to the staff using them
+func handleWhoisCommand(
+	ctx context.Context,
+	s *Server,
+	data interaction.ApplicationCommandInteraction,
+	options []interaction.ApplicationCommandInteractionDataOption,
+) interaction.ResponseChannelMessage {
+	option, ok := findOption(options, "domain")
+	if !ok {
+		return ephemeralMessage("Missing domain")
+	}
+
+	domain, ok := stringValue(option)
+	if !ok {
+		return ephemeralMessage("Domain was wrong type")
+	}
+
+	domain = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(domain), "@"))
+	if domain == "" || strings.ContainsAny(domain, "@ ") {
+		return ephemeralMessage("Invalid domain, it should look like `example.com`")
+	}
+
+	if !s.entitlements.Loaded() {
+		return s.commandErrorMessage(ctx, errDataNotLoaded)
+	}
+
+	e := whoisEmbed(s.embedStyle(ctx), domain, s.entitlements.PatronsByDomain(domain), time.Now())
+	return interaction.NewResponseChannelMessage(interaction.ApplicationCommandCallbackData{
+		Embeds: []*embed.Embed{e},
+	})
+}
+
+// whoisEmbed lists the patrons found at the domain, one per line, with their Discord account if linked
+func whoisEmbed(style embedStyle, domain string, patrons []patreon.Patron, now time.Time) *embed.Embed {
+	e := &embed.Embed{
+		Title:     fmt.Sprintf("Patrons at %s", domain),
+		Timestamp: ptr(now),
+		Color:     style.PrimaryColor,
+	}
+
+	if len(patrons) == 0 {
+		e.Description = fmt.Sprintf("No patrons have an email at `%s`", domain)
+		e.Color = style.ErrorColor
+		return e
+	}
+
+	var linked int
+	for _, patron := range patrons {
+		if patron.DiscordId != nil {
+			linked++
+		}
+	}
+
+	e.Fields = []*embed.EmbedField{
+		{Name: "Patrons", Value: fmt.Sprint(len(patrons)), Inline: true},
+		{Name: "Linked", Value: fmt.Sprint(linked), Inline: true},
+	}
+
+	var b strings.Builder
+	for i, patron := range patrons {
+		line := fmt.Sprintf("`%s` [%d](%s): ", privacy.Masked(patron.Email), patron.Id, style.patronUrl(patron.Id))
+		if patron.DiscordId != nil {
+			line += fmt.Sprintf("<@%d> (%d)", *patron.DiscordId, *patron.DiscordId)
+		} else {
+			line += "Not linked"
+		}
+
+		if patron.PatronStatus != "active_patron" {
+			status := patron.PatronStatus
+			if status == "" {
+				status = "never pledged"
+			}
+
+			line += fmt.Sprintf(", %s", status)
+		}
+
+		line += "\n"
+
+		if b.Len()+len(line) > embedDescriptionLimit {
+			remaining := fmt.Sprintf("... and %d more", len(patrons)-i)
+			if b.Len()+len(remaining) <= embedDescriptionLimit {
+				b.WriteString(remaining)
+			}
+
+			break
+		}
+
+		b.WriteString(line)
+	}
+
+	e.Description = strings.TrimSuffix(b.String(), "\n")
+	return e
+}
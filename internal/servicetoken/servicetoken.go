@@ -0,0 +1,223 @@
+// Package servicetoken verifies the short-lived service tokens issued by the auth service, which other services use to
+// call the API instead of static API keys. Tokens are JWTs signed with ed25519 (the EdDSA algorithm), so that keys can
+// be rotated by the auth service without redeploying the services that call the API.
+package servicetoken
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/TicketsBot/subscriptions-app/internal/config"
+	"github.com/TicketsBot/subscriptions-app/internal/rbac"
+	"github.com/pkg/errors"
+)
+
+// Claims are the verified contents of a service token
+type Claims struct {
+	Subject     string // The service the token was issued to
+	Issuer      string
+	ExpiresAt   time.Time
+	Permissions rbac.Set
+}
+
+// Verifier checks the signature, audience and expiry of service tokens against the configured public keys
+type Verifier struct {
+	publicKeys  []ed25519.PublicKey
+	issuer      string
+	audience    string
+	leeway      time.Duration
+	maxLifetime time.Duration
+}
+
+// NewVerifier returns a verifier for the configured public keys. It returns an error if any of the keys are invalid.
+func NewVerifier(conf config.Config) (*Verifier, error) {
+	keys := make([]ed25519.PublicKey, len(conf.ServiceTokens.PublicKeys))
+	for i, encoded := range conf.ServiceTokens.PublicKeys {
+		key, err := ParsePublicKey(encoded)
+		if err != nil {
+			return nil, err
+		}
+
+		keys[i] = key
+	}
+
+	return &Verifier{
+		publicKeys:  keys,
+		issuer:      conf.ServiceTokens.Issuer,
+		audience:    conf.ServiceTokens.Audience,
+		leeway:      time.Duration(conf.ServiceTokens.LeewaySeconds) * time.Second,
+		maxLifetime: time.Duration(conf.ServiceTokens.MaxLifetimeSeconds) * time.Second,
+	}, nil
+}
+
+// ParsePublicKey decodes a hex encoded ed25519 public key
+func ParsePublicKey(encoded string) (ed25519.PublicKey, error) {
+	key, err := hex.DecodeString(encoded)
+	if err != nil {
+		return nil, errors.Wrap(err, "service token public key must be hex encoded")
+	}
+
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("service token public key must be %d bytes, got %d", ed25519.PublicKeySize, len(key))
+	}
+
+	return key, nil
+}
+
+// LooksLikeToken returns whether a bearer credential has the shape of a JWT, rather than being an API key
+func LooksLikeToken(credential string) bool {
+	return strings.Count(credential, ".") == 2
+}
+
+type header struct {
+	Algorithm string `json:"alg"`
+}
+
+type payload struct {
+	Subject     string   `json:"sub"`
+	Issuer      string   `json:"iss"`
+	Audience    audience `json:"aud"`
+	ExpiresAt   *int64   `json:"exp"`
+	IssuedAt    *int64   `json:"iat"`
+	NotBefore   *int64   `json:"nbf"`
+	Permissions []string `json:"permissions"`
+}
+
+// audience is the aud claim, which may be a single string or a list
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		return json.Unmarshal(data, (*[]string)(a))
+	}
+
+	var single string
+	if err := json.Unmarshal(data, &single); err != nil {
+		return err
+	}
+
+	*a = audience{single}
+	return nil
+}
+
+// Verify returns the claims of the token if it was signed by one of the public keys, is meant for this app and is
+// valid at the given time. Tokens must expire, must not be issued in the future, and must not be valid for longer than
+// the max lifetime.
+func (v *Verifier) Verify(token string, now time.Time) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Claims{}, errors.New("token is not a JWT")
+	}
+
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return Claims{}, errors.Wrap(err, "invalid header")
+	}
+
+	// The algorithm is fixed, rather than chosen by the token, so that tokens can't downgrade to "none" or HMAC
+	if h.Algorithm != "EdDSA" {
+		return Claims{}, fmt.Errorf("unsupported algorithm %q", h.Algorithm)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Claims{}, errors.Wrap(err, "invalid signature encoding")
+	}
+
+	if !v.verifySignature([]byte(parts[0]+"."+parts[1]), signature) {
+		return Claims{}, errors.New("invalid signature")
+	}
+
+	var p payload
+	if err := decodeSegment(parts[1], &p); err != nil {
+		return Claims{}, errors.Wrap(err, "invalid payload")
+	}
+
+	if err := v.validate(p, now); err != nil {
+		return Claims{}, err
+	}
+
+	var permissions rbac.Set
+	if len(p.Permissions) > 0 {
+		permissions, err = rbac.ParseSet(strings.Join(p.Permissions, "|"))
+		if err != nil {
+			return Claims{}, errors.Wrap(err, "invalid permissions")
+		}
+	}
+
+	return Claims{
+		Subject:     p.Subject,
+		Issuer:      p.Issuer,
+		ExpiresAt:   time.Unix(*p.ExpiresAt, 0),
+		Permissions: permissions,
+	}, nil
+}
+
+// verifySignature checks the signature against each public key, so that the auth service can sign with a new key while
+// tokens signed with the old one are still valid
+func (v *Verifier) verifySignature(signed, signature []byte) bool {
+	for _, key := range v.publicKeys {
+		if ed25519.Verify(key, signed, signature) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (v *Verifier) validate(p payload, now time.Time) error {
+	if p.ExpiresAt == nil {
+		return errors.New("token has no expiry")
+	}
+
+	expiresAt := time.Unix(*p.ExpiresAt, 0)
+	if !now.Before(expiresAt.Add(v.leeway)) {
+		return errors.New("token has expired")
+	}
+
+	if p.NotBefore != nil && now.Add(v.leeway).Before(time.Unix(*p.NotBefore, 0)) {
+		return errors.New("token is not valid yet")
+	}
+
+	// A token issued in the future would otherwise pass the max lifetime check while being valid for longer
+	if p.IssuedAt != nil && now.Add(v.leeway).Before(time.Unix(*p.IssuedAt, 0)) {
+		return errors.New("token was issued in the future")
+	}
+
+	if v.maxLifetime > 0 {
+		if p.IssuedAt == nil {
+			return errors.New("token has no issue time")
+		}
+
+		if lifetime := expiresAt.Sub(time.Unix(*p.IssuedAt, 0)); lifetime > v.maxLifetime {
+			return fmt.Errorf("token is valid for %s, longer than the max of %s", lifetime, v.maxLifetime)
+		}
+	}
+
+	if v.issuer != "" && p.Issuer != v.issuer {
+		return fmt.Errorf("token was issued by %q", p.Issuer)
+	}
+
+	for _, aud := range p.Audience {
+		if aud == v.audience {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("token is not meant for audience %q", v.audience)
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,72 @@
+package servicetoken
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func signToken(t *testing.T, key ed25519.PrivateKey, claims map[string]any) string {
+	t.Helper()
+
+	encode := func(v any) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+
+	signed := encode(map[string]string{"alg": "EdDSA", "typ": "JWT"}) + "." + encode(claims)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(ed25519.Sign(key, []byte(signed)))
+}
+
+func TestVerify(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2024, 11, 29, 12, 0, 0, 0, time.UTC)
+	verifier := &Verifier{
+		publicKeys:  []ed25519.PublicKey{publicKey},
+		audience:    "subscriptions",
+		leeway:      30 * time.Second,
+		maxLifetime: 15 * time.Minute,
+	}
+
+	tests := []struct {
+		name     string
+		issuedAt time.Time
+		expires  time.Time
+		valid    bool
+	}{
+		{"valid", now.Add(-time.Minute), now.Add(10 * time.Minute), true},
+		{"issued within leeway", now.Add(20 * time.Second), now.Add(10 * time.Minute), true},
+		{"expired", now.Add(-time.Hour), now.Add(-time.Minute), false},
+		{"lifetime too long", now.Add(-time.Minute), now.Add(time.Hour), false},
+		// exp - iat is within the max lifetime, but the token is valid from now until well past it
+		{"issued in the future", now.Add(time.Hour), now.Add(time.Hour + 10*time.Minute), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			token := signToken(t, privateKey, map[string]any{
+				"sub": "bot",
+				"aud": "subscriptions",
+				"iat": test.issuedAt.Unix(),
+				"exp": test.expires.Unix(),
+			})
+
+			_, err := verifier.Verify(token, now)
+			if test.valid && err != nil {
+				t.Errorf("expected token to be valid, got %v", err)
+			} else if !test.valid && err == nil {
+				t.Error("expected token to be rejected")
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package sources
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/TicketsBot-cloud/gdl/objects/entitlement"
+	"github.com/TicketsBot-cloud/gdl/rest"
+	"github.com/TicketsBot/subscriptions-app/internal/config"
+	"github.com/TicketsBot/subscriptions-app/internal/database"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// DiscordSource provides purchases made through Discord's premium apps monetisation
+type DiscordSource struct {
+	storedSource
+	config config.Config
+	logger *zap.Logger
+}
+
+var _ PledgeSource = (*DiscordSource)(nil)
+
+func NewDiscordSource(config config.Config, logger *zap.Logger, db *database.Database, subscriptions SubscriptionStore) *DiscordSource {
+	return &DiscordSource{
+		storedSource: storedSource{
+			db:            db,
+			subscriptions: subscriptions,
+			name:          "Discord",
+			key:           "discord",
+		},
+		config: config,
+		logger: logger,
+	}
+}
+
+// HandleEntitlement stores an entitlement received from a webhook event or the REST API
+func (d *DiscordSource) HandleEntitlement(ctx context.Context, ent entitlement.Entitlement, observedAt time.Time) error {
+	if ent.ApplicationId != d.config.Discord.ApplicationId {
+		d.logger.Debug("Ignoring entitlement for another application", zap.Uint64("entitlement_id", ent.Id))
+		return nil
+	}
+
+	tier, ok := d.config.TierNameBySku(ent.SkuId)
+	if !ok {
+		d.logger.Warn("unknown Discord SKU", zap.Uint64("sku_id", ent.SkuId), zap.Uint64("entitlement_id", ent.Id))
+		tier = fmt.Sprintf("Unknown (SKU: %d)", ent.SkuId)
+	}
+
+	return d.subscriptions.UpsertSubscription(ctx, database.ExternalSubscription{
+		Source:    d.key,
+		Reference: strconv.FormatUint(ent.Id, 10),
+		DiscordId: ent.UserId,
+		Tier:      tier,
+		Status:    entitlementStatus(ent, observedAt),
+		StartedAt: ent.StartsAt,
+		ExpiresAt: ent.EndsAt,
+		UpdatedAt: observedAt,
+	})
+}
+
+// Reconcile fetches every entitlement from the API. Discord only sends webhook events for new entitlements, so this is
+// how renewals, cancellations and refunds are picked up.
+func (d *DiscordSource) Reconcile(ctx context.Context) error {
+	const pageSize = 100
+
+	var after *uint64
+	var count int
+	for {
+		entitlements, err := rest.ListEntitlements(ctx, d.config.Discord.BotToken, nil, d.config.Discord.ApplicationId, rest.EntitlementQueryOptions{
+			After: after,
+			Limit: ptr(pageSize),
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to list entitlements")
+		}
+
+		now := time.Now()
+		for _, ent := range entitlements {
+			if err := d.HandleEntitlement(ctx, ent, now); err != nil {
+				return errors.Wrapf(err, "failed to store entitlement %d", ent.Id)
+			}
+
+			if after == nil || ent.Id > *after {
+				after = ptr(ent.Id)
+			}
+		}
+
+		count += len(entitlements)
+
+		if len(entitlements) < pageSize {
+			break
+		}
+	}
+
+	d.logger.Info("Reconciled Discord entitlements", zap.Int("count", count))
+	return nil
+}
+
+// StartReconcileLoop runs Reconcile on the configured interval until ctx is cancelled
+func (d *DiscordSource) StartReconcileLoop(ctx context.Context) {
+	interval := time.Duration(d.config.Discord.ReconcileIntervalMinutes) * time.Minute
+	if interval <= 0 {
+		interval = time.Hour
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		reconcileCtx, cancel := context.WithTimeout(ctx, time.Minute*10)
+		if err := d.Reconcile(reconcileCtx); err != nil {
+			d.logger.Error("Failed to reconcile Discord entitlements", zap.Error(err))
+		}
+		cancel()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func entitlementStatus(ent entitlement.Entitlement, now time.Time) string {
+	switch {
+	case ent.Deleted:
+		return "deleted"
+	case ent.Consumed != nil && *ent.Consumed:
+		return "consumed"
+	case ent.EndsAt != nil && ent.EndsAt.Before(now):
+		return "ended"
+	default:
+		return "active"
+	}
+}
+
+func ptr[T any](value T) *T {
+	return &value
+}
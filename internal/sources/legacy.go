@@ -0,0 +1,47 @@
+package sources
+
+import (
+	"context"
+	"time"
+
+	"github.com/TicketsBot/subscriptions-app/internal/database"
+)
+
+// LegacySource provides premium keys imported from the legacy key system
+type LegacySource struct {
+	storedSource
+}
+
+var _ PledgeSource = (*LegacySource)(nil)
+
+func NewLegacySource(subscriptions SubscriptionStore) *LegacySource {
+	return &LegacySource{
+		storedSource: storedSource{
+			subscriptions: subscriptions,
+			name:          "Legacy Key",
+			key:           database.SourceLegacy,
+		},
+	}
+}
+
+func (l *LegacySource) ByEmail(ctx context.Context, email string) ([]Entitlement, error) {
+	entitlements, err := l.storedSource.ByEmail(ctx, email)
+	return markExpired(entitlements), err
+}
+
+func (l *LegacySource) ByDiscordId(ctx context.Context, discordId uint64) ([]Entitlement, error) {
+	entitlements, err := l.storedSource.ByDiscordId(ctx, discordId)
+	return markExpired(entitlements), err
+}
+
+// markExpired updates the status of keys that have expired since they were imported, as nothing else updates them
+func markExpired(entitlements []Entitlement) []Entitlement {
+	now := time.Now()
+	for i, entitlement := range entitlements {
+		if entitlement.ExpiresAt != nil && entitlement.ExpiresAt.Before(now) {
+			entitlements[i].Status = "expired"
+		}
+	}
+
+	return entitlements
+}
@@ -0,0 +1,194 @@
+package sources
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/TicketsBot/subscriptions-app/internal/config"
+	"github.com/TicketsBot/subscriptions-app/internal/database"
+	"github.com/TicketsBot/subscriptions-app/internal/privacy"
+	"github.com/TicketsBot/subscriptions-app/pkg/lemonsqueezy"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+type LemonSqueezySource struct {
+	storedSource
+	config config.Config
+	logger *zap.Logger
+	client *lemonsqueezy.Client
+}
+
+var _ PledgeSource = (*LemonSqueezySource)(nil)
+
+var ErrLicenseInvalid = errors.New("license key is not valid")
+
+func NewLemonSqueezySource(config config.Config, logger *zap.Logger, db *database.Database, subscriptions SubscriptionStore) *LemonSqueezySource {
+	return &LemonSqueezySource{
+		storedSource: storedSource{
+			db:            db,
+			subscriptions: subscriptions,
+			emails:        privacy.NewEmails(config),
+			name:          "Lemon Squeezy",
+			key:           "lemonsqueezy",
+		},
+		config: config,
+		logger: logger,
+		client: lemonsqueezy.NewClient(config.LemonSqueezy.ApiKey),
+	}
+}
+
+// HandleEvent applies a verified webhook event
+func (l *LemonSqueezySource) HandleEvent(ctx context.Context, event lemonsqueezy.Event) error {
+	switch event.Data.Type {
+	case lemonsqueezy.ResourceSubscriptions:
+		var sub lemonsqueezy.Subscription
+		if err := json.Unmarshal(event.Data.Attributes, &sub); err != nil {
+			return errors.Wrap(err, "failed to decode subscription")
+		}
+
+		return l.storeSubscription(ctx, event.Data.Id, sub)
+	case lemonsqueezy.ResourceLicenseKeys:
+		var key lemonsqueezy.LicenseKey
+		if err := json.Unmarshal(event.Data.Attributes, &key); err != nil {
+			return errors.Wrap(err, "failed to decode license key")
+		}
+
+		return l.storeLicenseKey(ctx, event.Data.Id, key)
+	default:
+		l.logger.Debug("Ignoring Lemon Squeezy event", zap.String("event_name", string(event.Meta.EventName)))
+		return nil
+	}
+}
+
+// Reconcile fetches every subscription from the API, to correct for any missed webhooks
+func (l *LemonSqueezySource) Reconcile(ctx context.Context) error {
+	subscriptions, err := l.client.ListSubscriptions(ctx, l.config.LemonSqueezy.StoreId)
+	if err != nil {
+		return errors.Wrap(err, "failed to list subscriptions")
+	}
+
+	for _, resource := range subscriptions {
+		if err := l.storeSubscription(ctx, resource.Id, resource.Subscription); err != nil {
+			return err
+		}
+	}
+
+	l.logger.Info("Reconciled Lemon Squeezy subscriptions", zap.Int("count", len(subscriptions)))
+	return nil
+}
+
+// StartReconcileLoop runs Reconcile on the configured interval until ctx is cancelled
+func (l *LemonSqueezySource) StartReconcileLoop(ctx context.Context) {
+	interval := time.Duration(l.config.LemonSqueezy.ReconcileIntervalMinutes) * time.Minute
+	if interval <= 0 {
+		interval = time.Hour
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		reconcileCtx, cancel := context.WithTimeout(ctx, time.Minute*10)
+		if err := l.Reconcile(reconcileCtx); err != nil {
+			l.logger.Error("Failed to reconcile Lemon Squeezy subscriptions", zap.Error(err))
+		}
+		cancel()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// LinkLicense verifies ownership of a license key, and links the purchaser's email to the Discord account. The email is
+// returned in the form it was stored, which is hashed if emails are.
+func (l *LemonSqueezySource) LinkLicense(ctx context.Context, key string, discordId uint64) (string, error) {
+	res, err := l.client.ValidateLicense(ctx, strings.TrimSpace(key))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to validate license key")
+	}
+
+	if !res.Valid || res.Meta.StoreId != l.config.LemonSqueezy.StoreId || res.Meta.CustomerEmail == "" {
+		return "", ErrLicenseInvalid
+	}
+
+	email := l.emails.Protect(res.Meta.CustomerEmail)
+	if err := l.db.AccountLinks.Link(ctx, email, discordId); err != nil {
+		return "", errors.Wrap(err, "failed to store account link")
+	}
+
+	return email, nil
+}
+
+func (l *LemonSqueezySource) storeSubscription(ctx context.Context, id string, sub lemonsqueezy.Subscription) error {
+	if sub.StoreId != l.config.LemonSqueezy.StoreId {
+		l.logger.Debug("Ignoring subscription from another store", zap.String("subscription_id", id))
+		return nil
+	}
+
+	email := l.emails.ProtectPtr(&sub.UserEmail)
+	discordId, err := l.resolveDiscordId(ctx, nil, email)
+	if err != nil {
+		return errors.Wrap(err, "failed to resolve linked Discord account")
+	}
+
+	tier, ok := l.config.LemonSqueezy.Variants[sub.VariantId]
+	if !ok {
+		l.logger.Warn("unknown Lemon Squeezy variant", zap.Uint64("variant_id", sub.VariantId), zap.String("subscription_id", id))
+		tier = fmt.Sprintf("%s - %s", sub.ProductName, sub.VariantName)
+	}
+
+	expiresAt := sub.EndsAt
+	if expiresAt == nil {
+		expiresAt = sub.RenewsAt
+	}
+
+	return l.subscriptions.UpsertSubscription(ctx, database.ExternalSubscription{
+		Source:    l.key,
+		Reference: "subscription:" + id,
+		Email:     email,
+		DiscordId: discordId,
+		Tier:      tier,
+		Status:    sub.Status,
+		StartedAt: &sub.CreatedAt,
+		ExpiresAt: expiresAt,
+		UpdatedAt: sub.UpdatedAt,
+	})
+}
+
+func (l *LemonSqueezySource) storeLicenseKey(ctx context.Context, id string, key lemonsqueezy.LicenseKey) error {
+	if key.StoreId != l.config.LemonSqueezy.StoreId {
+		l.logger.Debug("Ignoring license key from another store", zap.String("license_key_id", id))
+		return nil
+	}
+
+	email := l.emails.ProtectPtr(&key.UserEmail)
+	discordId, err := l.resolveDiscordId(ctx, nil, email)
+	if err != nil {
+		return errors.Wrap(err, "failed to resolve linked Discord account")
+	}
+
+	tier, ok := l.config.LemonSqueezy.Products[key.ProductId]
+	if !ok {
+		l.logger.Warn("unknown Lemon Squeezy product", zap.Uint64("product_id", key.ProductId), zap.String("license_key_id", id))
+		tier = fmt.Sprintf("License (Product: %d)", key.ProductId)
+	}
+
+	return l.subscriptions.UpsertSubscription(ctx, database.ExternalSubscription{
+		Source:    l.key,
+		Reference: "license:" + id,
+		Email:     email,
+		DiscordId: discordId,
+		Tier:      tier,
+		Status:    key.Status,
+		StartedAt: &key.CreatedAt,
+		ExpiresAt: key.ExpiresAt,
+		UpdatedAt: key.UpdatedAt,
+	})
+}
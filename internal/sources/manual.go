@@ -0,0 +1,20 @@
+package sources
+
+import "github.com/TicketsBot/subscriptions-app/internal/database"
+
+// ManualSource provides entitlements granted by staff, such as redeemed vouchers
+type ManualSource struct {
+	storedSource
+}
+
+var _ PledgeSource = (*ManualSource)(nil)
+
+func NewManualSource(subscriptions SubscriptionStore) *ManualSource {
+	return &ManualSource{
+		storedSource: storedSource{
+			subscriptions: subscriptions,
+			name:          "Manual",
+			key:           database.SourceManual,
+		},
+	}
+}
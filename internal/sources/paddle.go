@@ -0,0 +1,117 @@
+package sources
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/TicketsBot/subscriptions-app/internal/config"
+	"github.com/TicketsBot/subscriptions-app/internal/database"
+	"github.com/TicketsBot/subscriptions-app/internal/privacy"
+	"github.com/TicketsBot/subscriptions-app/pkg/paddle"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+type PaddleSource struct {
+	storedSource
+	config config.Config
+	logger *zap.Logger
+	client *paddle.Client
+}
+
+var _ PledgeSource = (*PaddleSource)(nil)
+
+func NewPaddleSource(config config.Config, logger *zap.Logger, db *database.Database, subscriptions SubscriptionStore) *PaddleSource {
+	var client *paddle.Client
+	if config.Paddle.ApiKey != "" {
+		client = paddle.NewClient(config.Paddle.ApiKey, config.Paddle.Sandbox)
+	}
+
+	return &PaddleSource{
+		storedSource: storedSource{
+			db:            db,
+			subscriptions: subscriptions,
+			emails:        privacy.NewEmails(config),
+			name:          "Paddle",
+			key:           "paddle",
+		},
+		config: config,
+		logger: logger,
+		client: client,
+	}
+}
+
+// HandleEvent applies a verified webhook event. Errors are returned for transient failures, so that Paddle retries
+// delivery.
+func (p *PaddleSource) HandleEvent(ctx context.Context, event paddle.Event) error {
+	if !event.EventType.IsSubscriptionEvent() {
+		p.logger.Debug("Ignoring Paddle event", zap.String("event_id", event.EventId), zap.String("event_type", string(event.EventType)))
+		return nil
+	}
+
+	var sub paddle.Subscription
+	if err := json.Unmarshal(event.Data, &sub); err != nil {
+		return errors.Wrap(err, "failed to decode subscription")
+	}
+
+	var email *string
+	if p.client != nil && sub.CustomerId != "" {
+		customer, err := p.client.GetCustomer(ctx, sub.CustomerId)
+		if err != nil {
+			return errors.Wrap(err, "failed to fetch Paddle customer")
+		}
+
+		email = p.emails.ProtectPtr(&customer.Email)
+	}
+
+	discordId, err := p.resolveDiscordId(ctx, sub.CustomData.DiscordId, email)
+	if err != nil {
+		return errors.Wrap(err, "failed to resolve linked Discord account")
+	}
+
+	expiresAt := sub.CanceledAt
+	if expiresAt == nil && sub.CurrentBillingPeriod != nil {
+		expiresAt = &sub.CurrentBillingPeriod.EndsAt
+	}
+
+	if err := p.subscriptions.UpsertSubscription(ctx, database.ExternalSubscription{
+		Source:    p.key,
+		Reference: sub.Id,
+		Email:     email,
+		DiscordId: discordId,
+		Tier:      p.tierName(sub),
+		Status:    sub.Status,
+		StartedAt: sub.StartedAt,
+		ExpiresAt: expiresAt,
+		UpdatedAt: event.OccurredAt,
+	}); err != nil {
+		return errors.Wrap(err, "failed to store Paddle subscription")
+	}
+
+	p.logger.Info(
+		"Processed Paddle subscription event",
+		zap.String("event_id", event.EventId),
+		zap.String("event_type", string(event.EventType)),
+		zap.String("subscription_id", sub.Id),
+		zap.String("status", sub.Status),
+	)
+
+	return nil
+}
+
+// tierName maps the subscription's price to a tier, using the first item with a known price
+func (p *PaddleSource) tierName(sub paddle.Subscription) string {
+	for _, item := range sub.Items {
+		if name, ok := p.config.Paddle.Plans[item.Price.Id]; ok {
+			return name
+		}
+	}
+
+	if len(sub.Items) > 0 {
+		p.logger.Warn("unknown Paddle price", zap.String("price_id", sub.Items[0].Price.Id), zap.String("subscription_id", sub.Id))
+		return fmt.Sprintf("Unknown (Price: %s)", sub.Items[0].Price.Id)
+	}
+
+	return "Unknown"
+}
@@ -0,0 +1,96 @@
+package sources
+
+import (
+	"context"
+	"time"
+
+	"github.com/TicketsBot/subscriptions-app/internal/database"
+	"github.com/TicketsBot/subscriptions-app/internal/privacy"
+)
+
+// Entitlement is a provider-agnostic view of a single subscription
+type Entitlement struct {
+	Source    string
+	Reference string
+	Email     *string
+	DiscordId *uint64
+	Tier      string
+	Status    string
+	StartedAt *time.Time
+	ExpiresAt *time.Time
+}
+
+// PledgeSource is a provider of subscriptions that can be looked up alongside the Patreon campaign
+type PledgeSource interface {
+	Name() string
+	ByEmail(ctx context.Context, email string) ([]Entitlement, error)
+	ByDiscordId(ctx context.Context, discordId uint64) ([]Entitlement, error)
+}
+
+// SubscriptionStore persists the subscriptions of each source, which may be stored elsewhere than the
+// external_subscriptions table
+type SubscriptionStore interface {
+	SubscriptionsByEmail(ctx context.Context, source, email string) ([]database.ExternalSubscription, error)
+	SubscriptionsByDiscordId(ctx context.Context, source string, discordId uint64) ([]database.ExternalSubscription, error)
+	UpsertSubscription(ctx context.Context, sub database.ExternalSubscription) error
+}
+
+// storedSource implements the lookup half of PledgeSource for providers whose subscriptions are persisted in the
+// SubscriptionStore
+type storedSource struct {
+	db            *database.Database // Unset for sources that only look up subscriptions
+	subscriptions SubscriptionStore
+	emails        *privacy.Emails // Protects the emails of received subscriptions
+	name          string
+	key           string
+}
+
+func (s storedSource) Name() string {
+	return s.name
+}
+
+func (s storedSource) ByEmail(ctx context.Context, email string) ([]Entitlement, error) {
+	subscriptions, err := s.subscriptions.SubscriptionsByEmail(ctx, s.key, email)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.toEntitlements(subscriptions), nil
+}
+
+func (s storedSource) ByDiscordId(ctx context.Context, discordId uint64) ([]Entitlement, error) {
+	subscriptions, err := s.subscriptions.SubscriptionsByDiscordId(ctx, s.key, discordId)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.toEntitlements(subscriptions), nil
+}
+
+func (s storedSource) toEntitlements(subscriptions []database.ExternalSubscription) []Entitlement {
+	entitlements := make([]Entitlement, len(subscriptions))
+	for i, sub := range subscriptions {
+		entitlements[i] = Entitlement{
+			Source:    s.name,
+			Reference: sub.Reference,
+			Email:     sub.Email,
+			DiscordId: sub.DiscordId,
+			Tier:      sub.Tier,
+			Status:    sub.Status,
+			StartedAt: sub.StartedAt,
+			ExpiresAt: sub.ExpiresAt,
+		}
+	}
+
+	return entitlements
+}
+
+// resolveDiscordId returns the Discord ID supplied by the provider, falling back to an account linked to the email
+// through the /link flow
+func (s storedSource) resolveDiscordId(ctx context.Context, discordId *uint64, email *string) (*uint64, error) {
+	if discordId != nil || email == nil {
+		return discordId, nil
+	}
+
+	return s.db.AccountLinks.GetDiscordId(ctx, *email)
+}
@@ -0,0 +1,301 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TicketsBot/subscriptions-app/internal/clock"
+	"github.com/TicketsBot/subscriptions-app/internal/database"
+	"github.com/TicketsBot/subscriptions-app/pkg/patreon"
+)
+
+// ErrDuplicateVoucher is returned by Memory.CreateVouchers if a code is already in use, where Postgres would reject the
+// duplicate primary key
+var ErrDuplicateVoucher = errors.New("voucher code already exists")
+
+// Memory is a Store that holds everything in memory, for tests and demo mode, where nothing is kept after a restart.
+// It is safe for concurrent use.
+type Memory struct {
+	clock clock.Clock
+
+	mu            sync.RWMutex
+	tokens        map[string]patreon.Tokens
+	snapshot      []database.SnapshotPatron
+	subscriptions map[subscriptionKey]database.ExternalSubscription
+	vouchers      map[string]database.Voucher
+	auditLog      []database.AuditLogEntry
+}
+
+type subscriptionKey struct {
+	source, reference string
+}
+
+var _ Store = (*Memory)(nil)
+
+func NewMemory(clk clock.Clock) *Memory {
+	return &Memory{
+		clock:         clk,
+		tokens:        make(map[string]patreon.Tokens),
+		subscriptions: make(map[subscriptionKey]database.ExternalSubscription),
+		vouchers:      make(map[string]database.Voucher),
+	}
+}
+
+func (m *Memory) Tokens(_ context.Context, clientId string) (patreon.Tokens, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	tokens, ok := m.tokens[clientId]
+	return tokens, ok, nil
+}
+
+func (m *Memory) SetTokens(_ context.Context, clientId string, tokens patreon.Tokens) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.tokens[clientId] = tokens
+	return nil
+}
+
+func (m *Memory) ReplaceSnapshot(_ context.Context, patrons []database.SnapshotPatron) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.snapshot = slices.Clone(patrons)
+	return nil
+}
+
+// Snapshot returns the last snapshot passed to ReplaceSnapshot
+func (m *Memory) Snapshot() []database.SnapshotPatron {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return slices.Clone(m.snapshot)
+}
+
+func (m *Memory) SubscriptionsByEmail(_ context.Context, source, email string) ([]database.ExternalSubscription, error) {
+	return m.filterSubscriptions(func(sub database.ExternalSubscription) bool {
+		return sub.Source == source && sub.Email != nil && strings.EqualFold(*sub.Email, email)
+	}), nil
+}
+
+func (m *Memory) SubscriptionsByDiscordId(_ context.Context, source string, discordId uint64) ([]database.ExternalSubscription, error) {
+	return m.filterSubscriptions(func(sub database.ExternalSubscription) bool {
+		return sub.Source == source && sub.DiscordId != nil && *sub.DiscordId == discordId
+	}), nil
+}
+
+func (m *Memory) SubscriptionsBySource(_ context.Context, source string) ([]database.ExternalSubscription, error) {
+	return m.filterSubscriptions(func(sub database.ExternalSubscription) bool {
+		return sub.Source == source
+	}), nil
+}
+
+func (m *Memory) filterSubscriptions(match func(sub database.ExternalSubscription) bool) []database.ExternalSubscription {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var subscriptions []database.ExternalSubscription
+	for _, sub := range m.subscriptions {
+		if match(sub) {
+			subscriptions = append(subscriptions, sub)
+		}
+	}
+
+	return subscriptions
+}
+
+func (m *Memory) UpsertSubscription(_ context.Context, sub database.ExternalSubscription) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.upsertSubscription(sub)
+	return nil
+}
+
+func (m *Memory) UpsertSubscriptions(_ context.Context, subs []database.ExternalSubscription) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, sub := range subs {
+		m.upsertSubscription(sub)
+	}
+
+	return nil
+}
+
+// upsertSubscription matches ExternalSubscriptionsTable.Upsert. m.mu must be held for writing.
+func (m *Memory) upsertSubscription(sub database.ExternalSubscription) {
+	key := subscriptionKey{source: sub.Source, reference: sub.Reference}
+	if existing, ok := m.subscriptions[key]; ok {
+		if existing.UpdatedAt.After(sub.UpdatedAt) {
+			return
+		}
+
+		if sub.Email == nil {
+			sub.Email = existing.Email
+		}
+
+		if sub.DiscordId == nil {
+			sub.DiscordId = existing.DiscordId
+		}
+	}
+
+	m.subscriptions[key] = sub
+}
+
+// CreateVouchers stores every voucher, or none of them if a code is already in use
+func (m *Memory) CreateVouchers(_ context.Context, vouchers []database.Voucher, details map[string]any) error {
+	entries := make([][]byte, len(vouchers))
+	for i, voucher := range vouchers {
+		entry := map[string]any{
+			"code":          voucher.Code,
+			"tier":          voucher.Tier,
+			"duration_days": voucher.DurationDays,
+		}
+
+		for k, v := range details {
+			entry[k] = v
+		}
+
+		encoded, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+
+		entries[i] = encoded
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	codes := make(map[string]bool, len(vouchers))
+	for _, voucher := range vouchers {
+		if _, ok := m.vouchers[voucher.Code]; ok || codes[voucher.Code] {
+			return ErrDuplicateVoucher
+		}
+
+		codes[voucher.Code] = true
+	}
+
+	for i, voucher := range vouchers {
+		m.vouchers[voucher.Code] = voucher
+		m.appendAuditLogEntry(voucher.CreatedBy, "voucher_created", entries[i])
+	}
+
+	return nil
+}
+
+func (m *Memory) RedeemVoucher(_ context.Context, code string, discordId uint64) (database.Voucher, time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	voucher, ok := m.vouchers[code]
+	if !ok || voucher.RedeemedBy != nil {
+		return database.Voucher{}, time.Time{}, database.ErrVoucherUnavailable
+	}
+
+	startedAt := m.clock.Now()
+	expiresAt := startedAt.Add(time.Duration(voucher.DurationDays) * time.Hour * 24)
+
+	details, err := json.Marshal(map[string]any{
+		"code":       voucher.Code,
+		"tier":       voucher.Tier,
+		"expires_at": expiresAt,
+	})
+	if err != nil {
+		return database.Voucher{}, time.Time{}, err
+	}
+
+	voucher.RedeemedBy = &discordId
+	voucher.RedeemedAt = &startedAt
+	m.vouchers[code] = voucher
+
+	m.upsertSubscription(database.ExternalSubscription{
+		Source:    database.SourceManual,
+		Reference: "voucher:" + voucher.Code,
+		DiscordId: &discordId,
+		Tier:      voucher.Tier,
+		Status:    "active",
+		StartedAt: &startedAt,
+		ExpiresAt: &expiresAt,
+		UpdatedAt: startedAt,
+	})
+
+	m.appendAuditLogEntry(discordId, "voucher_redeemed", details)
+
+	return voucher, expiresAt, nil
+}
+
+func (m *Memory) RevokeVoucher(_ context.Context, code string, revokedBy uint64, details map[string]any) (database.Voucher, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	voucher, ok := m.vouchers[code]
+	if !ok || voucher.RedeemedBy != nil {
+		return database.Voucher{}, database.ErrVoucherUnavailable
+	}
+
+	entry := map[string]any{
+		"code":          voucher.Code,
+		"tier":          voucher.Tier,
+		"duration_days": voucher.DurationDays,
+	}
+
+	for k, v := range details {
+		entry[k] = v
+	}
+
+	encoded, err := json.Marshal(entry)
+	if err != nil {
+		return database.Voucher{}, err
+	}
+
+	delete(m.vouchers, code)
+	m.appendAuditLogEntry(revokedBy, "voucher_revoked", encoded)
+
+	return voucher, nil
+}
+
+func (m *Memory) CreateAuditLogEntry(_ context.Context, actorId uint64, action string, details any) error {
+	encoded, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.appendAuditLogEntry(actorId, action, encoded)
+	return nil
+}
+
+// appendAuditLogEntry records an action with details that are already marshalled. m.mu must be held for writing.
+func (m *Memory) appendAuditLogEntry(actorId uint64, action string, details json.RawMessage) {
+	m.auditLog = append(m.auditLog, database.AuditLogEntry{
+		Id:        int64(len(m.auditLog) + 1),
+		ActorId:   actorId,
+		Action:    action,
+		Details:   details,
+		CreatedAt: m.clock.Now(),
+	})
+}
+
+func (m *Memory) RecentAuditLogEntries(_ context.Context, limit int) ([]database.AuditLogEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	limit = max(limit, 0)
+
+	entries := make([]database.AuditLogEntry, 0, min(limit, len(m.auditLog)))
+	for i := len(m.auditLog) - 1; i >= 0 && len(entries) < limit; i-- {
+		entries = append(entries, m.auditLog[i])
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,243 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/TicketsBot/subscriptions-app/internal/clock"
+	"github.com/TicketsBot/subscriptions-app/internal/database"
+	"github.com/TicketsBot/subscriptions-app/pkg/patreon"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestMemoryTokens(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemory(clock.Real)
+
+	if _, ok, err := store.Tokens(ctx, "client"); err != nil || ok {
+		t.Fatalf("expected no tokens before they are set, got ok=%t err=%v", ok, err)
+	}
+
+	tokens := patreon.Tokens{AccessToken: "access", RefreshToken: "refresh", ExpiresAt: time.Unix(1700000000, 0)}
+	if err := store.SetTokens(ctx, "client", tokens); err != nil {
+		t.Fatal(err)
+	}
+
+	got, ok, err := store.Tokens(ctx, "client")
+	if err != nil || !ok || got != tokens {
+		t.Errorf("expected the tokens that were set, got %+v ok=%t err=%v", got, ok, err)
+	}
+}
+
+func TestMemoryUpsertSubscription(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemory(clock.Real)
+
+	updatedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := store.UpsertSubscription(ctx, database.ExternalSubscription{
+		Source:    "paddle",
+		Reference: "sub_1",
+		Email:     ptr("Patron@Example.com"),
+		DiscordId: ptr(uint64(1234)),
+		Tier:      "Premium",
+		Status:    "active",
+		UpdatedAt: updatedAt,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// An older update, delivered out of order, is ignored
+	if err := store.UpsertSubscription(ctx, database.ExternalSubscription{
+		Source:    "paddle",
+		Reference: "sub_1",
+		Tier:      "Premium",
+		Status:    "past_due",
+		UpdatedAt: updatedAt.Add(-time.Hour),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A newer update without an email or Discord ID keeps the stored ones
+	if err := store.UpsertSubscription(ctx, database.ExternalSubscription{
+		Source:    "paddle",
+		Reference: "sub_1",
+		Tier:      "Premium",
+		Status:    "canceled",
+		UpdatedAt: updatedAt.Add(time.Hour),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	subs, err := store.SubscriptionsByEmail(ctx, "paddle", "patron@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(subs) != 1 {
+		t.Fatalf("expected 1 subscription, matching the email case-insensitively, got %d", len(subs))
+	}
+
+	if subs[0].Status != "canceled" {
+		t.Errorf("expected the newest status, got %q", subs[0].Status)
+	}
+
+	if subs[0].DiscordId == nil || *subs[0].DiscordId != 1234 {
+		t.Errorf("expected the stored Discord ID to be kept, got %v", subs[0].DiscordId)
+	}
+
+	if subs, _ := store.SubscriptionsByDiscordId(ctx, "lemonsqueezy", 1234); len(subs) != 0 {
+		t.Errorf("expected no subscriptions from another source, got %d", len(subs))
+	}
+}
+
+func TestMemoryUpsertSubscriptions(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemory(clock.Real)
+
+	now := time.Now()
+	if err := store.UpsertSubscriptions(ctx, []database.ExternalSubscription{
+		{Source: database.SourceLegacy, Reference: "KEY-1", Tier: "Premium", Status: "active", UpdatedAt: now},
+		{Source: database.SourceLegacy, Reference: "KEY-2", Tier: "Premium", Status: "active", UpdatedAt: now},
+		{Source: database.SourceManual, Reference: "override", Tier: "Premium", Status: "active", UpdatedAt: now},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	subs, err := store.SubscriptionsBySource(ctx, database.SourceLegacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(subs) != 2 {
+		t.Errorf("expected 2 legacy keys, got %d", len(subs))
+	}
+}
+
+func TestMemoryRedeemVoucher(t *testing.T) {
+	ctx := context.Background()
+	clk := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	store := NewMemory(clk)
+
+	voucher := database.Voucher{Code: "ABCD-EFGH-JKMN", Tier: "Premium", DurationDays: 30, CreatedBy: 1, CreatedAt: clk.Now()}
+	if err := store.CreateVouchers(ctx, []database.Voucher{voucher}, map[string]any{"via": "test"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.CreateVouchers(ctx, []database.Voucher{voucher}, nil); !errors.Is(err, ErrDuplicateVoucher) {
+		t.Errorf("expected a duplicate code to be rejected, got %v", err)
+	}
+
+	clk.Advance(time.Hour)
+
+	redeemed, expiresAt, err := store.RedeemVoucher(ctx, voucher.Code, 5678)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if redeemed.RedeemedBy == nil || *redeemed.RedeemedBy != 5678 {
+		t.Errorf("expected the voucher to be redeemed by the user, got %v", redeemed.RedeemedBy)
+	}
+
+	if want := clk.Now().AddDate(0, 0, 30); !expiresAt.Equal(want) {
+		t.Errorf("expected the entitlement to expire at %s, got %s", want, expiresAt)
+	}
+
+	subs, err := store.SubscriptionsByDiscordId(ctx, database.SourceManual, 5678)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(subs) != 1 || subs[0].Reference != "voucher:"+voucher.Code || subs[0].ExpiresAt == nil || !subs[0].ExpiresAt.Equal(expiresAt) {
+		t.Errorf("expected a manual subscription for the voucher, got %+v", subs)
+	}
+
+	if _, _, err := store.RedeemVoucher(ctx, voucher.Code, 9999); !errors.Is(err, database.ErrVoucherUnavailable) {
+		t.Errorf("expected a redeemed voucher to be unavailable, got %v", err)
+	}
+
+	if _, _, err := store.RedeemVoucher(ctx, "MISSING", 9999); !errors.Is(err, database.ErrVoucherUnavailable) {
+		t.Errorf("expected an unknown code to be unavailable, got %v", err)
+	}
+
+	entries, err := store.RecentAuditLogEntries(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 2 || entries[0].Action != "voucher_redeemed" || entries[1].Action != "voucher_created" {
+		t.Errorf("expected the redemption and then the creation in the audit log, got %+v", entries)
+	}
+}
+
+func TestMemoryRevokeVoucher(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemory(clock.Real)
+
+	vouchers := []database.Voucher{
+		{Code: "ABCD-EFGH-JKMN", Tier: "Premium", DurationDays: 30, CreatedBy: 1, CreatedAt: time.Now()},
+		{Code: "PQRS-TUVW-XYZ2", Tier: "Premium", DurationDays: 30, CreatedBy: 1, CreatedAt: time.Now()},
+	}
+
+	if err := store.CreateVouchers(ctx, vouchers, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := store.RedeemVoucher(ctx, vouchers[1].Code, 5678); err != nil {
+		t.Fatal(err)
+	}
+
+	revoked, err := store.RevokeVoucher(ctx, vouchers[0].Code, 2, map[string]any{"via": "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if revoked.Code != vouchers[0].Code {
+		t.Errorf("expected the revoked voucher to be returned, got %+v", revoked)
+	}
+
+	if _, _, err := store.RedeemVoucher(ctx, vouchers[0].Code, 5678); !errors.Is(err, database.ErrVoucherUnavailable) {
+		t.Errorf("expected a revoked voucher to be unavailable, got %v", err)
+	}
+
+	if _, err := store.RevokeVoucher(ctx, vouchers[1].Code, 2, nil); !errors.Is(err, database.ErrVoucherUnavailable) {
+		t.Errorf("expected a redeemed voucher not to be revocable, got %v", err)
+	}
+
+	entries, err := store.RecentAuditLogEntries(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 || entries[0].Action != "voucher_revoked" || entries[0].ActorId != 2 {
+		t.Errorf("expected the revocation in the audit log, got %+v", entries)
+	}
+}
+
+func TestMemoryRecentAuditLogEntries(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemory(clock.Real)
+
+	for _, action := range []string{"first", "second", "third"} {
+		if err := store.CreateAuditLogEntry(ctx, 1, action, map[string]any{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := store.RecentAuditLogEntries(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 2 || entries[0].Action != "third" || entries[1].Action != "second" {
+		t.Errorf("expected the 2 newest entries, newest first, got %+v", entries)
+	}
+
+	if entries, err := store.RecentAuditLogEntries(ctx, -1); err != nil || len(entries) != 0 {
+		t.Errorf("expected a negative limit to return no entries, got %d entries and %v", len(entries), err)
+	}
+}
@@ -0,0 +1,87 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/TicketsBot/subscriptions-app/internal/database"
+	"github.com/TicketsBot/subscriptions-app/pkg/patreon"
+)
+
+// Postgres is a Store backed by the database tables
+type Postgres struct {
+	db *database.Database
+}
+
+var _ Store = (*Postgres)(nil)
+
+func NewPostgres(db *database.Database) *Postgres {
+	return &Postgres{
+		db: db,
+	}
+}
+
+func (p *Postgres) Tokens(ctx context.Context, clientId string) (patreon.Tokens, bool, error) {
+	keys, ok, err := p.db.PatreonKeys.Get(ctx, clientId)
+	if err != nil || !ok {
+		return patreon.Tokens{}, ok, err
+	}
+
+	return patreon.Tokens{
+		AccessToken:  keys.AccessToken,
+		RefreshToken: keys.RefreshToken,
+		ExpiresAt:    keys.ExpiresAt,
+	}, true, nil
+}
+
+func (p *Postgres) SetTokens(ctx context.Context, clientId string, tokens patreon.Tokens) error {
+	return p.db.PatreonKeys.Set(ctx, clientId, database.PatreonKeys{
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresAt:    tokens.ExpiresAt,
+	})
+}
+
+func (p *Postgres) ReplaceSnapshot(ctx context.Context, patrons []database.SnapshotPatron) error {
+	return p.db.PatronSnapshot.Replace(ctx, patrons)
+}
+
+func (p *Postgres) SubscriptionsByEmail(ctx context.Context, source, email string) ([]database.ExternalSubscription, error) {
+	return p.db.ExternalSubscriptions.GetByEmail(ctx, source, email)
+}
+
+func (p *Postgres) SubscriptionsByDiscordId(ctx context.Context, source string, discordId uint64) ([]database.ExternalSubscription, error) {
+	return p.db.ExternalSubscriptions.GetByDiscordId(ctx, source, discordId)
+}
+
+func (p *Postgres) SubscriptionsBySource(ctx context.Context, source string) ([]database.ExternalSubscription, error) {
+	return p.db.ExternalSubscriptions.GetBySource(ctx, source)
+}
+
+func (p *Postgres) UpsertSubscription(ctx context.Context, sub database.ExternalSubscription) error {
+	return p.db.ExternalSubscriptions.Upsert(ctx, sub)
+}
+
+func (p *Postgres) UpsertSubscriptions(ctx context.Context, subs []database.ExternalSubscription) error {
+	return p.db.ExternalSubscriptions.UpsertMany(ctx, subs)
+}
+
+func (p *Postgres) CreateVouchers(ctx context.Context, vouchers []database.Voucher, details map[string]any) error {
+	return p.db.Vouchers.Create(ctx, vouchers, details)
+}
+
+func (p *Postgres) RedeemVoucher(ctx context.Context, code string, discordId uint64) (database.Voucher, time.Time, error) {
+	return p.db.Vouchers.Redeem(ctx, code, discordId)
+}
+
+func (p *Postgres) RevokeVoucher(ctx context.Context, code string, revokedBy uint64, details map[string]any) (database.Voucher, error) {
+	return p.db.Vouchers.Revoke(ctx, code, revokedBy, details)
+}
+
+func (p *Postgres) CreateAuditLogEntry(ctx context.Context, actorId uint64, action string, details any) error {
+	return p.db.AuditLog.Create(ctx, actorId, action, details)
+}
+
+func (p *Postgres) RecentAuditLogEntries(ctx context.Context, limit int) ([]database.AuditLogEntry, error) {
+	return p.db.AuditLog.Recent(ctx, limit)
+}
@@ -0,0 +1,49 @@
+// Package store abstracts the Patreon tokens, snapshot, subscriptions, vouchers and audit log that the app persists, so
+// that tests and demo mode can keep them in memory instead. Everything else, such as tier mappings, patron history and
+// guild settings, is still kept in Postgres, so the app can't run without a database.
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/TicketsBot/subscriptions-app/internal/database"
+	"github.com/TicketsBot/subscriptions-app/pkg/patreon"
+)
+
+// Store persists Patreon tokens, the last synced snapshot of patrons, subscriptions from other sources, including
+// overrides granted by staff and through vouchers, and the audit log
+type Store interface {
+	patreon.TokenStore
+
+	// ReplaceSnapshot replaces the last synced snapshot of patrons
+	ReplaceSnapshot(ctx context.Context, patrons []database.SnapshotPatron) error
+
+	// SubscriptionsByEmail returns the subscriptions from a source with the email, compared case-insensitively
+	SubscriptionsByEmail(ctx context.Context, source, email string) ([]database.ExternalSubscription, error)
+	SubscriptionsByDiscordId(ctx context.Context, source string, discordId uint64) ([]database.ExternalSubscription, error)
+	SubscriptionsBySource(ctx context.Context, source string) ([]database.ExternalSubscription, error)
+
+	// UpsertSubscription stores the subscription, unless a newer update for the same subscription has already been
+	// stored. The stored email and Discord ID are kept if the update doesn't have them.
+	UpsertSubscription(ctx context.Context, sub database.ExternalSubscription) error
+
+	// UpsertSubscriptions stores every subscription as UpsertSubscription would, either all or none of them
+	UpsertSubscriptions(ctx context.Context, subs []database.ExternalSubscription) error
+
+	// CreateVouchers stores new vouchers and records their creation, with the details, in the audit log
+	CreateVouchers(ctx context.Context, vouchers []database.Voucher, details map[string]any) error
+
+	// RedeemVoucher marks the voucher as redeemed, grants the corresponding time-limited manual subscription and records
+	// the redemption in the audit log, returning the voucher and the expiry of the subscription.
+	// database.ErrVoucherUnavailable is returned if the code does not exist or has already been used.
+	RedeemVoucher(ctx context.Context, code string, discordId uint64) (database.Voucher, time.Time, error)
+
+	// RevokeVoucher deletes a voucher that hasn't been redeemed and records the revocation, with the details, in the
+	// audit log. database.ErrVoucherUnavailable is returned if the code does not exist or has already been used.
+	RevokeVoucher(ctx context.Context, code string, revokedBy uint64, details map[string]any) (database.Voucher, error)
+
+	// CreateAuditLogEntry records an action. details is marshalled to JSON.
+	CreateAuditLogEntry(ctx context.Context, actorId uint64, action string, details any) error
+	RecentAuditLogEntries(ctx context.Context, limit int) ([]database.AuditLogEntry, error)
+}
@@ -0,0 +1,84 @@
+// Package syncstatus tracks the outcome of the Patreon syncs, so that staff can tell how fresh the data being served is
+package syncstatus
+
+import (
+	"sync"
+	"time"
+
+	"github.com/TicketsBot/subscriptions-app/pkg/patreon"
+)
+
+// Status describes the latest Patreon syncs. Fields are unset until a sync has succeeded or failed.
+type Status struct {
+	LastSuccessAt       *time.Time `json:"last_success_at"`
+	LastDurationSeconds *float64   `json:"last_duration_seconds"` // Of the last successful sync
+	Patrons             *int       `json:"patrons"`               // In the last successful sync
+	LastError           *string    `json:"last_error"`
+	LastErrorAt         *time.Time `json:"last_error_at"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+
+	// InProgress is the progress of the sync that is running, unset between syncs
+	InProgress *patreon.Progress `json:"in_progress"`
+}
+
+// Tracker records the outcome of each sync. It is safe for concurrent use.
+type Tracker struct {
+	mu     sync.RWMutex
+	status Status
+}
+
+func NewTracker() *Tracker {
+	return &Tracker{}
+}
+
+// Succeeded records a sync that finished at the given time, fetching the given number of patrons
+func (t *Tracker) Succeeded(finishedAt time.Time, duration time.Duration, patrons int) {
+	seconds := duration.Seconds()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.status.LastSuccessAt = &finishedAt
+	t.status.LastDurationSeconds = &seconds
+	t.status.Patrons = &patrons
+	t.status.ConsecutiveFailures = 0
+	t.status.InProgress = nil
+}
+
+// Failed records a sync that failed at the given time. The error is kept after later syncs succeed, for diagnosing
+// intermittent failures.
+func (t *Tracker) Failed(failedAt time.Time, err error) {
+	message := err.Error()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.status.LastError = &message
+	t.status.LastErrorAt = &failedAt
+	t.status.ConsecutiveFailures++
+	t.status.InProgress = nil
+}
+
+// Progressed records the progress of the running sync, after each page of members. It is a patreon.ProgressFunc.
+func (t *Tracker) Progressed(progress patreon.Progress) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.status.InProgress = &progress
+}
+
+// Status returns the status at the time of the call
+func (t *Tracker) Status() Status {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.status
+}
+
+// LastSuccessAt returns when the data being served was last synced, if it has been
+func (t *Tracker) LastSuccessAt() *time.Time {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.status.LastSuccessAt
+}
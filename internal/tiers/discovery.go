@@ -0,0 +1,77 @@
+package tiers
+
+import (
+	"context"
+	"time"
+
+	"github.com/TicketsBot/subscriptions-app/internal/config"
+	"github.com/TicketsBot/subscriptions-app/pkg/patreon"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// CampaignTiers lists the tiers of the Patreon campaign, such as patreon.Client
+type CampaignTiers interface {
+	FetchTiers(ctx context.Context) ([]patreon.CampaignTier, error)
+}
+
+// Discover fetches the names and prices of the campaign's tiers, replacing those discovered before, and removes them
+// from the unknown tiers list. The previously discovered tiers are kept if fetching fails.
+func (r *Registry) Discover(ctx context.Context, source CampaignTiers) error {
+	campaignTiers, err := source.FetchTiers(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to fetch campaign tiers")
+	}
+
+	discovered := make(map[uint64]config.Tier, len(campaignTiers))
+	for _, campaignTier := range campaignTiers {
+		discovered[campaignTier.Id] = config.Tier{
+			Name:       campaignTier.Title,
+			PriceCents: campaignTier.AmountCents,
+		}
+	}
+
+	r.mu.Lock()
+	r.discovered = discovered
+	r.mu.Unlock()
+
+	r.logger.Info("Discovered campaign tiers", zap.Int("tiers", len(discovered)))
+
+	unknown, err := r.db.UnknownTiers.GetAll(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to load unknown tiers")
+	}
+
+	for _, tier := range unknown {
+		if _, ok := discovered[tier.TierId]; !ok {
+			continue
+		}
+
+		if err := r.db.UnknownTiers.Delete(ctx, tier.TierId); err != nil {
+			return errors.Wrap(err, "failed to remove discovered tier from unknown tiers")
+		}
+	}
+
+	return nil
+}
+
+// RunDiscovery discovers the campaign's tiers every interval until the context is cancelled, so that tiers created on
+// Patreon are picked up without a restart. The first discovery happens on startup, before the first sync.
+func (r *Registry) RunDiscovery(ctx context.Context, source CampaignTiers, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		discoverCtx, cancel := context.WithTimeout(ctx, time.Minute)
+		if err := r.Discover(discoverCtx, source); err != nil {
+			r.logger.Error("Failed to discover campaign tiers", zap.Error(err))
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,197 @@
+package tiers
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/TicketsBot/subscriptions-app/internal/config"
+	"github.com/TicketsBot/subscriptions-app/internal/database"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// Registry resolves Patreon tier IDs to names. Names and prices are discovered from the Patreon campaign, with the static
+// config overriding them, and mappings created at runtime (stored in the database) taking precedence over both.
+type Registry struct {
+	db     *database.Database
+	logger *zap.Logger
+
+	discovered map[uint64]config.Tier // From the Patreon campaign, replaced by each discovery
+	configured map[uint64]config.Tier // From config, replaced when config is reloaded
+	mappings   map[uint64]string
+	reported   map[uint64]struct{}
+	mu         sync.RWMutex
+}
+
+func NewRegistry(conf config.Config, db *database.Database, logger *zap.Logger) *Registry {
+	return &Registry{
+		db:         db,
+		logger:     logger,
+		discovered: make(map[uint64]config.Tier),
+		configured: conf.Tiers,
+		mappings:   make(map[uint64]string),
+		reported:   make(map[uint64]struct{}),
+	}
+}
+
+// UpdateConfig replaces the tiers defined in config, so that tiers can be added without restarting
+func (r *Registry) UpdateConfig(config config.Config) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.configured = config.Tiers
+
+	// Allow tiers that are no longer configured to be reported again
+	r.reported = make(map[uint64]struct{})
+}
+
+// Load fetches the runtime tier mappings from the database
+func (r *Registry) Load(ctx context.Context) error {
+	mappings, err := r.db.TierMappings.GetAll(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to load tier mappings")
+	}
+
+	r.mu.Lock()
+	r.mappings = mappings
+	r.mu.Unlock()
+
+	return nil
+}
+
+func (r *Registry) Name(tierId uint64) (string, bool) {
+	tier, ok := r.Tier(tierId)
+	return tier.Name, ok
+}
+
+// Tier returns the metadata for the tier. Tiers mapped at runtime only have a name, unless the tier is also discovered
+// or configured, in which case the runtime name replaces the other names.
+func (r *Registry) Tier(tierId uint64) (config.Tier, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.tier(tierId)
+}
+
+// tier resolves the tier. Must be called with the lock held.
+func (r *Registry) tier(tierId uint64) (config.Tier, bool) {
+	discovered, isDiscovered := r.discovered[tierId]
+	configured, isConfigured := r.configured[tierId]
+	tier := withOverrides(discovered, configured)
+
+	if name, ok := r.mappings[tierId]; ok {
+		tier.Name = name
+		return tier, true
+	}
+
+	return tier, isDiscovered || isConfigured
+}
+
+// withOverrides returns the configured tier, with the name and price discovered from Patreon if they aren't configured
+func withOverrides(discovered, configured config.Tier) config.Tier {
+	tier := configured
+	if strings.TrimSpace(tier.Name) == "" {
+		tier.Name = discovered.Name
+	}
+
+	if tier.PriceCents == 0 {
+		tier.PriceCents = discovered.PriceCents
+	}
+
+	return tier
+}
+
+// ByName returns the metadata for the tier with the given name, ignoring case. Other sources only record tier names.
+func (r *Registry) ByName(name string) (config.Tier, bool) {
+	for _, tier := range r.All() {
+		if strings.EqualFold(tier.Name, name) {
+			return tier, true
+		}
+	}
+
+	return config.Tier{}, false
+}
+
+func (r *Registry) IsKnown(tierId uint64) bool {
+	_, ok := r.Name(tierId)
+	return ok
+}
+
+// ReportUnknown records a tier that has no name mapping. Each tier is only written to the database once per process.
+func (r *Registry) ReportUnknown(ctx context.Context, tierId, patronId uint64) error {
+	r.mu.Lock()
+	if _, ok := r.reported[tierId]; ok {
+		r.mu.Unlock()
+		return nil
+	}
+
+	r.reported[tierId] = struct{}{}
+	r.mu.Unlock()
+
+	r.logger.Warn("unknown tier", zap.Uint64("tier_id", tierId), zap.Uint64("patron_id", patronId))
+
+	if err := r.db.UnknownTiers.Record(ctx, tierId, patronId); err != nil {
+		// Allow the report to be retried on the next sync
+		r.mu.Lock()
+		delete(r.reported, tierId)
+		r.mu.Unlock()
+
+		return errors.Wrap(err, "failed to record unknown tier")
+	}
+
+	return nil
+}
+
+func (r *Registry) Unknown(ctx context.Context) ([]database.UnknownTier, error) {
+	return r.db.UnknownTiers.GetAll(ctx)
+}
+
+// Map assigns a name to a tier, removing it from the unknown tiers list. The mapping takes effect on the next sync.
+func (r *Registry) Map(ctx context.Context, tierId uint64, name string, mappedBy uint64) error {
+	if err := r.db.MapTier(ctx, tierId, name, mappedBy); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.mappings[tierId] = name
+	delete(r.reported, tierId)
+	r.mu.Unlock()
+
+	return nil
+}
+
+// All returns the metadata of every discovered, configured or mapped tier by ID, resolved as by Tier
+func (r *Registry) All() map[uint64]config.Tier {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tiers := make(map[uint64]config.Tier, len(r.discovered)+len(r.configured)+len(r.mappings))
+	for _, ids := range []map[uint64]config.Tier{r.discovered, r.configured} {
+		for tierId := range ids {
+			tiers[tierId], _ = r.tier(tierId)
+		}
+	}
+
+	for tierId := range r.mappings {
+		tiers[tierId], _ = r.tier(tierId)
+	}
+
+	return tiers
+}
+
+// Names returns the names of every known tier, including discovered tiers and runtime mappings
+func (r *Registry) Names() []string {
+	seen := make(map[string]struct{})
+	var names []string
+	for _, tier := range r.All() {
+		if _, ok := seen[tier.Name]; !ok && tier.Name != "" {
+			seen[tier.Name] = struct{}{}
+			names = append(names, tier.Name)
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,47 @@
+package tracing
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// PgxLogger creates a span for each query. pgx v4 has no tracing hooks, but it logs every query once it completes,
+// along with its duration, so the span is created retroactively. Query arguments are never recorded, as they may
+// contain emails.
+type PgxLogger struct{}
+
+var _ pgx.Logger = PgxLogger{}
+
+func (PgxLogger) Log(ctx context.Context, level pgx.LogLevel, msg string, data map[string]interface{}) {
+	duration, ok := data["time"].(time.Duration)
+	if !ok {
+		return
+	}
+
+	end := time.Now()
+
+	attributes := []attribute.KeyValue{attribute.String("db.system", "postgresql")}
+	if sql, ok := data["sql"].(string); ok {
+		attributes = append(attributes, attribute.String("db.statement", sql))
+	}
+
+	_, span := Tracer().Start(
+		ctx,
+		"pgx."+msg,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithTimestamp(end.Add(-duration)),
+		trace.WithAttributes(attributes...),
+	)
+
+	if err, ok := data["err"].(error); ok {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End(trace.WithTimestamp(end))
+}
@@ -0,0 +1,60 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/TicketsBot/subscriptions-app/internal/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/TicketsBot/subscriptions-app"
+
+// Tracer returns the tracer used across the app. Until Setup is called, or if tracing is disabled, spans are no-ops.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Enabled reports whether spans are being exported
+func Enabled(conf config.Config) bool {
+	return conf.Tracing.Endpoint != ""
+}
+
+// Setup registers the global tracer provider, exporting spans via OTLP over HTTP. The returned function flushes any
+// buffered spans, and should be called before exiting.
+func Setup(ctx context.Context, conf config.Config) (func(context.Context) error, error) {
+	if !Enabled(conf) {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(conf.Tracing.Endpoint))
+	if err != nil {
+		return nil, err
+	}
+
+	serviceName := conf.Tracing.ServiceName
+	if serviceName == "" {
+		serviceName = "subscriptions-app"
+	}
+
+	sampleRatio := conf.Tracing.SampleRatio
+	if sampleRatio <= 0 {
+		sampleRatio = 1
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", serviceName))),
+	)
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return provider.Shutdown, nil
+}
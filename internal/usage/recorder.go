@@ -0,0 +1,88 @@
+// Package usage records the commands run through the app to the database, in batches, so that recording a use doesn't
+// slow down the response to it
+package usage
+
+import (
+	"context"
+	"time"
+
+	"github.com/TicketsBot/subscriptions-app/internal/database"
+	"github.com/TicketsBot/subscriptions-app/internal/metrics"
+	"go.uber.org/zap"
+)
+
+const (
+	queueSize     = 1000 // Uses waiting to be written, beyond which further uses are dropped
+	batchSize     = 100
+	flushInterval = 10 * time.Second
+)
+
+// Recorder queues command uses, and writes them to the database while running
+type Recorder struct {
+	db     *database.Database
+	logger *zap.Logger
+	uses   chan database.CommandUse
+}
+
+func NewRecorder(db *database.Database, logger *zap.Logger) *Recorder {
+	return &Recorder{
+		db:     db,
+		logger: logger,
+		uses:   make(chan database.CommandUse, queueSize),
+	}
+}
+
+// Record queues the use to be written. Uses are dropped if the queue is full, such as while the database is
+// unreachable, or if the recorder isn't running.
+func (r *Recorder) Record(use database.CommandUse) {
+	select {
+	case r.uses <- use:
+	default:
+		metrics.CommandUsesDropped.Inc()
+	}
+}
+
+// Run writes the queued uses every flush interval, or as soon as a batch fills up, until the context is cancelled. Uses
+// still queued when it is cancelled are written before returning.
+func (r *Recorder) Run(ctx context.Context) {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]database.CommandUse, 0, batchSize)
+	for {
+		select {
+		case <-ctx.Done():
+			for len(r.uses) > 0 && len(batch) < queueSize {
+				batch = append(batch, <-r.uses)
+			}
+
+			// The context is already cancelled, so the last batch is given its own deadline
+			flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			r.flush(flushCtx, batch)
+			cancel()
+			return
+		case use := <-r.uses:
+			batch = append(batch, use)
+			if len(batch) < batchSize {
+				continue
+			}
+		case <-ticker.C:
+		}
+
+		r.flush(ctx, batch)
+		batch = batch[:0]
+	}
+}
+
+// flush writes the batch. Uses that fail to be written are dropped, so that a database outage doesn't hold them in
+// memory.
+func (r *Recorder) flush(ctx context.Context, batch []database.CommandUse) {
+	if len(batch) == 0 {
+		return
+	}
+
+	if err := r.db.CommandUsage.CreateMany(ctx, batch); err != nil {
+		r.logger.Error("Failed to record command usage", zap.Int("uses", len(batch)), zap.Error(err))
+		metrics.CommandUsesDropped.Add(float64(len(batch)))
+	}
+}
@@ -0,0 +1,223 @@
+// Package usernames keeps the Discord profiles of linked patrons, so that staff can find a patron by typing part of
+// their username, and see who the patron is when looking them up
+package usernames
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TicketsBot-cloud/gdl/objects/user"
+	"github.com/TicketsBot-cloud/gdl/rest"
+	"github.com/TicketsBot/subscriptions-app/internal/config"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+)
+
+// LinkedPatrons lists the Discord accounts linked to patrons
+type LinkedPatrons interface {
+	LinkedDiscordIds() []uint64
+}
+
+// Directory maps the Discord IDs of linked patrons to their profiles. Profiles are fetched with the bot token, so
+// usernames and avatars are only as fresh as the last refresh.
+type Directory struct {
+	token    string        // From config on startup
+	interval time.Duration // From config on startup. Profiles fetched longer ago are fetched again.
+	logger   *zap.Logger
+	patrons  LinkedPatrons
+	limiter  *rate.Limiter // Leaves most of the bot's global rate limit to the other components using the token
+
+	mu       sync.RWMutex
+	profiles map[uint64]profile // Discord ID -> profile
+}
+
+type profile struct {
+	user      user.User
+	found     bool // False if the user couldn't be fetched
+	fetchedAt time.Time
+}
+
+// Match is a linked patron whose username or Discord ID matches a search
+type Match struct {
+	DiscordId uint64
+	Username  string
+}
+
+func NewDirectory(config config.Config, logger *zap.Logger, patrons LinkedPatrons) *Directory {
+	return &Directory{
+		token:    config.Discord.BotToken,
+		interval: time.Duration(config.Discord.UsernameRefreshMinutes) * time.Minute,
+		logger:   logger,
+		patrons:  patrons,
+		limiter:  rate.NewLimiter(rate.Limit(10), 1),
+		profiles: make(map[uint64]profile),
+	}
+}
+
+// Refresh fetches the profiles of the linked patrons that haven't been fetched within the refresh interval, and
+// forgets those of patrons who are no longer linked. Users that can't be fetched, such as deleted accounts, are tried
+// again after the interval.
+func (d *Directory) Refresh(ctx context.Context) error {
+	linked := d.patrons.LinkedDiscordIds()
+	staleBefore := time.Now().Add(-d.interval)
+
+	d.mu.Lock()
+	current := make(map[uint64]profile, len(linked))
+	var stale []uint64
+	for _, discordId := range linked {
+		if existing, ok := d.profiles[discordId]; ok {
+			current[discordId] = existing
+			if existing.fetchedAt.After(staleBefore) {
+				continue
+			}
+		}
+
+		stale = append(stale, discordId)
+	}
+
+	d.profiles = current
+	d.mu.Unlock()
+
+	fetched, failed := 0, 0
+	for _, discordId := range stale {
+		if _, err := d.fetch(ctx, discordId); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			failed++
+		} else {
+			fetched++
+		}
+	}
+
+	if fetched > 0 || failed > 0 {
+		d.logger.Info("Refreshed profiles of linked patrons", zap.Int("linked", len(linked)), zap.Int("fetched", fetched), zap.Int("failed", failed))
+	}
+
+	return nil
+}
+
+// fetch fetches the profile of the user and caches it. Users that can't be fetched are cached as not found, so that
+// they aren't fetched again until the refresh interval has passed.
+func (d *Directory) fetch(ctx context.Context, discordId uint64) (profile, error) {
+	if err := d.limiter.Wait(ctx); err != nil {
+		return profile{}, err
+	}
+
+	user, err := rest.GetUser(ctx, d.token, nil, discordId)
+	if err != nil && ctx.Err() != nil {
+		return profile{}, err
+	}
+
+	if err != nil {
+		d.logger.Debug("Failed to fetch Discord user", zap.Uint64("discord_id", discordId), zap.Error(err))
+	}
+
+	fetched := profile{user: user, found: err == nil, fetchedAt: time.Now()}
+
+	d.mu.Lock()
+	d.profiles[discordId] = fetched
+	d.mu.Unlock()
+
+	return fetched, err
+}
+
+// Profile returns the Discord profile of the user, fetching it if it hasn't been fetched within the refresh interval.
+// It returns false if the user can't be fetched, or if the bot token isn't set.
+func (d *Directory) Profile(ctx context.Context, discordId uint64) (user.User, bool) {
+	if d.token == "" {
+		return user.User{}, false
+	}
+
+	d.mu.RLock()
+	cached, ok := d.profiles[discordId]
+	d.mu.RUnlock()
+
+	if !ok || cached.fetchedAt.Before(time.Now().Add(-d.interval)) {
+		var err error
+		if cached, err = d.fetch(ctx, discordId); err != nil {
+			return user.User{}, false
+		}
+	}
+
+	return cached.user, cached.found
+}
+
+// Run refreshes the profiles every minute until the context is cancelled, so that patrons who link their account, or
+// are synced for the first time, can be found soon after. Each profile is only fetched again once it is older than
+// the refresh interval. Nothing is fetched if the bot token isn't set.
+func (d *Directory) Run(ctx context.Context) {
+	if d.token == "" {
+		return
+	}
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		if err := d.Refresh(ctx); err != nil && ctx.Err() == nil {
+			d.logger.Error("Failed to refresh profiles of linked patrons", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Search returns up to limit linked patrons whose username, or Discord ID, starts with the query, ignoring case and a
+// leading @. Username matches come first, ordered by username.
+func (d *Directory) Search(query string, limit int) []Match {
+	query = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(query), "@"))
+
+	d.mu.RLock()
+	var byName, byId []Match
+	for discordId, profile := range d.profiles {
+		if !profile.found {
+			continue
+		}
+
+		match := Match{DiscordId: discordId, Username: profile.user.Username}
+		if strings.HasPrefix(strings.ToLower(match.Username), query) {
+			byName = append(byName, match)
+		} else if strings.HasPrefix(strconv.FormatUint(discordId, 10), query) {
+			byId = append(byId, match)
+		}
+	}
+	d.mu.RUnlock()
+
+	slices.SortFunc(byName, func(a, b Match) int {
+		return cmp.Or(cmp.Compare(strings.ToLower(a.Username), strings.ToLower(b.Username)), cmp.Compare(a.DiscordId, b.DiscordId))
+	})
+
+	slices.SortFunc(byId, func(a, b Match) int {
+		return cmp.Compare(a.DiscordId, b.DiscordId)
+	})
+
+	matches := append(byName, byId...)
+	return matches[:min(len(matches), limit)]
+}
+
+// DiscordId returns the Discord ID of the linked patron with the username, ignoring case and a leading @
+func (d *Directory) DiscordId(name string) (uint64, bool) {
+	name = strings.TrimPrefix(strings.TrimSpace(name), "@")
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	for discordId, profile := range d.profiles {
+		if profile.found && strings.EqualFold(profile.user.Username, name) {
+			return discordId, true
+		}
+	}
+
+	return 0, false
+}
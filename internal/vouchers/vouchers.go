@@ -0,0 +1,162 @@
+package vouchers
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/TicketsBot/subscriptions-app/internal/database"
+	"go.uber.org/zap"
+)
+
+const (
+	MaxBatchSize    = 50
+	MaxDurationDays = 366
+)
+
+var (
+	ErrInvalidDuration  = errors.New("duration must be between 1 and 366 days")
+	ErrInvalidBatchSize = errors.New("count must be between 1 and 50")
+	ErrUnknownTier      = errors.New("unknown tier")
+)
+
+type TierRegistry interface {
+	Names() []string
+}
+
+// Store persists vouchers and the entitlements granted by redeeming them
+type Store interface {
+	CreateVouchers(ctx context.Context, vouchers []database.Voucher, details map[string]any) error
+	RedeemVoucher(ctx context.Context, code string, discordId uint64) (database.Voucher, time.Time, error)
+	RevokeVoucher(ctx context.Context, code string, revokedBy uint64, details map[string]any) (database.Voucher, error)
+}
+
+// Service issues single-use voucher codes, which grant a manual entitlement to the tier for a fixed duration once
+// redeemed
+type Service struct {
+	store  Store
+	tiers  TierRegistry
+	logger *zap.Logger
+}
+
+func NewService(store Store, tiers TierRegistry, logger *zap.Logger) *Service {
+	return &Service{
+		store:  store,
+		tiers:  tiers,
+		logger: logger,
+	}
+}
+
+// Create generates count vouchers. createdBy is the Discord ID of the staff member, or 0 if created via the API.
+func (s *Service) Create(ctx context.Context, tier string, durationDays, count int, createdBy uint64, via string) ([]database.Voucher, error) {
+	if durationDays < 1 || durationDays > MaxDurationDays {
+		return nil, ErrInvalidDuration
+	}
+
+	if count < 1 || count > MaxBatchSize {
+		return nil, ErrInvalidBatchSize
+	}
+
+	tier, ok := s.canonicalTier(tier)
+	if !ok {
+		return nil, ErrUnknownTier
+	}
+
+	now := time.Now()
+	vouchers := make([]database.Voucher, count)
+	for i := range vouchers {
+		code, err := generateCode()
+		if err != nil {
+			return nil, err
+		}
+
+		vouchers[i] = database.Voucher{
+			Code:         code,
+			Tier:         tier,
+			DurationDays: durationDays,
+			CreatedBy:    createdBy,
+			CreatedAt:    now,
+		}
+	}
+
+	if err := s.store.CreateVouchers(ctx, vouchers, map[string]any{"via": via}); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info(
+		"Vouchers created",
+		zap.String("tier", tier),
+		zap.Int("duration_days", durationDays),
+		zap.Int("count", count),
+		zap.Uint64("created_by", createdBy),
+		zap.String("via", via),
+	)
+
+	return vouchers, nil
+}
+
+// Redeem redeems the code for the Discord user, returning the voucher and the expiry of the granted entitlement
+func (s *Service) Redeem(ctx context.Context, code string, discordId uint64) (database.Voucher, time.Time, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+
+	voucher, expiresAt, err := s.store.RedeemVoucher(ctx, code, discordId)
+	if err != nil {
+		return database.Voucher{}, time.Time{}, err
+	}
+
+	s.logger.Info("Voucher redeemed", zap.String("tier", voucher.Tier), zap.Uint64("user_id", discordId), zap.Time("expires_at", expiresAt))
+	return voucher, expiresAt, nil
+}
+
+// Revoke deletes a voucher that hasn't been redeemed, so that it can't be. revokedBy is the Discord ID of the staff
+// member, or 0 if revoked via the API.
+func (s *Service) Revoke(ctx context.Context, code string, revokedBy uint64, via string) (database.Voucher, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+
+	voucher, err := s.store.RevokeVoucher(ctx, code, revokedBy, map[string]any{"via": via})
+	if err != nil {
+		return database.Voucher{}, err
+	}
+
+	s.logger.Info("Voucher revoked", zap.String("tier", voucher.Tier), zap.Uint64("revoked_by", revokedBy), zap.String("via", via))
+	return voucher, nil
+}
+
+// canonicalTier matches the tier name case-insensitively against the configured tiers
+func (s *Service) canonicalTier(tier string) (string, bool) {
+	for _, name := range s.tiers.Names() {
+		if strings.EqualFold(name, strings.TrimSpace(tier)) {
+			return name, true
+		}
+	}
+
+	return "", false
+}
+
+// Codes use an alphabet without easily confused characters (0/O, 1/I/L)
+const codeAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+
+// generateCode returns a code in the format XXXX-XXXX-XXXX. Each character is chosen uniformly from the alphabet, as
+// rand.Int rejects values that would otherwise favour some characters.
+func generateCode() (string, error) {
+	alphabetSize := big.NewInt(int64(len(codeAlphabet)))
+
+	var b strings.Builder
+	for i := 0; i < 12; i++ {
+		if i > 0 && i%4 == 0 {
+			b.WriteByte('-')
+		}
+
+		n, err := rand.Int(rand.Reader, alphabetSize)
+		if err != nil {
+			return "", err
+		}
+
+		b.WriteByte(codeAlphabet[n.Int64()])
+	}
+
+	return b.String(), nil
+}
@@ -0,0 +1,34 @@
+package vouchers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerateCode(t *testing.T) {
+	seen := make(map[rune]int)
+	for i := 0; i < 1000; i++ {
+		code, err := generateCode()
+		if err != nil {
+			t.Fatalf("failed to generate code: %v", err)
+		}
+
+		groups := strings.Split(code, "-")
+		if len(groups) != 3 || len(groups[0]) != 4 || len(groups[1]) != 4 || len(groups[2]) != 4 {
+			t.Fatalf("expected a code in the format XXXX-XXXX-XXXX, got %q", code)
+		}
+
+		for _, c := range strings.Join(groups, "") {
+			if !strings.ContainsRune(codeAlphabet, c) {
+				t.Fatalf("expected only characters from the alphabet, got %q in %q", c, code)
+			}
+
+			seen[c]++
+		}
+	}
+
+	// 12,000 characters are expected to include every character of the alphabet many times over
+	if len(seen) != len(codeAlphabet) {
+		t.Errorf("expected every character of the alphabet to be used, got %d of %d", len(seen), len(codeAlphabet))
+	}
+}
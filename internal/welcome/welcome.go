@@ -0,0 +1,159 @@
+// Package welcome greets new patrons who have linked their Discord account, by DM and optionally in a channel
+package welcome
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TicketsBot-cloud/gdl/rest"
+	"github.com/TicketsBot/subscriptions-app/internal/config"
+	"github.com/TicketsBot/subscriptions-app/internal/currency"
+	"github.com/TicketsBot/subscriptions-app/internal/events"
+	"github.com/TicketsBot/subscriptions-app/internal/privacy"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// eventBuffer is the number of events that can wait while a patron is being welcomed
+const eventBuffer = 1000
+
+// TierRegistry provides the metadata of tiers, including their welcome messages
+type TierRegistry interface {
+	Tier(tierId uint64) (config.Tier, bool)
+}
+
+// Greeter welcomes each new patron published to the bus
+type Greeter struct {
+	config config.Config
+	logger *zap.Logger
+	bus    *events.Bus
+	tiers  TierRegistry
+}
+
+func NewGreeter(config config.Config, logger *zap.Logger, bus *events.Bus, tiers TierRegistry) *Greeter {
+	return &Greeter{
+		config: config,
+		logger: logger,
+		bus:    bus,
+		tiers:  tiers,
+	}
+}
+
+func (g *Greeter) Enabled() bool {
+	return g.config.Welcome.Enabled
+}
+
+// Run welcomes the patrons of the new pledge events published to the bus until the context is cancelled
+func (g *Greeter) Run(ctx context.Context) {
+	if !g.Enabled() {
+		g.logger.Info("Welcome messages are disabled")
+		return
+	}
+
+	patronEvents := g.bus.Subscribe(eventBuffer)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-patronEvents:
+			if event.Type != events.TypeNew {
+				continue
+			}
+
+			if err := g.Welcome(ctx, event); err != nil {
+				g.logger.Warn("Failed to welcome patron", zap.Uint64("patron_id", event.PatronId), zap.Error(err))
+			}
+		}
+	}
+}
+
+// Welcome DMs the patron, and posts in the welcome channel if one is set. Patrons who haven't linked their Discord
+// account are skipped, as they can't be messaged or mentioned.
+func (g *Greeter) Welcome(ctx context.Context, event events.Event) error {
+	if event.DiscordId == nil {
+		g.logger.Debug("Patron is not linked, not sending welcome message", zap.Uint64("patron_id", event.PatronId))
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*30)
+	defer cancel()
+
+	dmTemplate, channelTemplate := g.templates(event.Tiers)
+
+	// The channel post doesn't depend on the DM, which fails if the patron doesn't accept DMs from the bot
+	var dmErr error
+	if channel, err := rest.CreateDM(ctx, g.config.Discord.BotToken, nil, *event.DiscordId); err != nil {
+		dmErr = errors.Wrap(err, "failed to open DM channel")
+	} else if _, err := rest.CreateMessage(ctx, g.config.Discord.BotToken, nil, channel.Id, rest.CreateMessageData{
+		Content: g.fill(dmTemplate, event, true),
+	}); err != nil {
+		dmErr = errors.Wrap(err, "failed to send DM")
+	}
+
+	if g.config.Welcome.ChannelId != 0 {
+		if _, err := rest.CreateMessage(ctx, g.config.Discord.BotToken, nil, g.config.Welcome.ChannelId, rest.CreateMessageData{
+			Content: g.fill(channelTemplate, event, false),
+		}); err != nil {
+			return errors.Wrap(err, "failed to post in welcome channel")
+		}
+	}
+
+	if dmErr != nil {
+		return dmErr
+	}
+
+	g.logger.Info("Welcomed patron", zap.Uint64("patron_id", event.PatronId), zap.Uint64("discord_id", *event.DiscordId))
+	return nil
+}
+
+// templates returns the DM and channel templates for a patron of the tiers. The first tier with its own template
+// overrides the default from the config.
+func (g *Greeter) templates(tierIds []uint64) (dm, channel string) {
+	dm, channel = g.config.Welcome.Message, g.config.Welcome.ChannelMessage
+
+	var dmOverridden, channelOverridden bool
+	for _, tierId := range tierIds {
+		tier, ok := g.tiers.Tier(tierId)
+		if !ok {
+			continue
+		}
+
+		if tier.WelcomeMessage != "" && !dmOverridden {
+			dm, dmOverridden = tier.WelcomeMessage, true
+		}
+
+		if tier.WelcomeChannelMessage != "" && !channelOverridden {
+			channel, channelOverridden = tier.WelcomeChannelMessage, true
+		}
+	}
+
+	return dm, channel
+}
+
+// fill replaces the placeholders in the template with the details of the patron's pledge. The email is only filled in
+// private messages, so that it isn't posted in the welcome channel.
+func (g *Greeter) fill(template string, event events.Event, private bool) string {
+	tierNames := make([]string, len(event.Tiers))
+	for i, tierId := range event.Tiers {
+		if tier, ok := g.tiers.Tier(tierId); ok && tier.Name != "" {
+			tierNames[i] = tier.Name
+		} else {
+			tierNames[i] = strconv.FormatUint(tierId, 10)
+		}
+	}
+
+	email := ""
+	if private {
+		email = privacy.Masked(event.Email)
+	}
+
+	return strings.NewReplacer(
+		"{user}", fmt.Sprintf("<@%d>", *event.DiscordId),
+		"{tiers}", strings.Join(tierNames, ", "),
+		"{amount}", currency.Format(event.AmountCents, event.CurrencyOr(g.config.Revenue.Currency)),
+		"{email}", email,
+	).Replace(template)
+}
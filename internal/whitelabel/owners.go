@@ -0,0 +1,133 @@
+// Package whitelabel resolves whitelabel bots to the users who own them, so that the whitelabel entitlement check can be
+// made here rather than by each service that needs it
+package whitelabel
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/TicketsBot/subscriptions-app/internal/config"
+)
+
+// ErrUnknownBot is returned if no source knows the owner of the bot
+var ErrUnknownBot = errors.New("unknown whitelabel bot")
+
+type ownerResponse struct {
+	OwnerId string `json:"owner_id"`
+}
+
+type cachedOwner struct {
+	ownerId   uint64 // 0 if the bot is unknown
+	expiresAt time.Time
+}
+
+// Owners looks up the owners of whitelabel bots, caching the owners fetched from the owner URL
+type Owners struct {
+	httpClient *http.Client
+
+	mu    sync.Mutex
+	cache map[uint64]cachedOwner
+}
+
+func NewOwners() *Owners {
+	return &Owners{
+		httpClient: &http.Client{Timeout: time.Second * 10},
+		cache:      make(map[uint64]cachedOwner),
+	}
+}
+
+// Owner returns the Discord ID of the bot's owner, from the static mapping, or otherwise the owner URL. The config is
+// passed in, so that reloaded mappings apply straight away.
+func (o *Owners) Owner(ctx context.Context, conf config.Config, botId uint64) (uint64, error) {
+	if ownerId, ok := conf.Whitelabel.Bots[botId]; ok {
+		return ownerId, nil
+	}
+
+	if conf.Whitelabel.OwnerUrl == "" {
+		return 0, ErrUnknownBot
+	}
+
+	if ownerId, ok := o.cached(botId); ok {
+		if ownerId == 0 {
+			return 0, ErrUnknownBot
+		}
+
+		return ownerId, nil
+	}
+
+	ownerId, err := o.fetch(ctx, conf, botId)
+	if err != nil && !errors.Is(err, ErrUnknownBot) {
+		return 0, err
+	}
+
+	// Unknown bots are cached too, so that repeated checks for a deleted bot don't each reach the owner URL
+	o.mu.Lock()
+	o.cache[botId] = cachedOwner{
+		ownerId:   ownerId,
+		expiresAt: time.Now().Add(time.Duration(conf.Whitelabel.CacheSeconds) * time.Second),
+	}
+	o.mu.Unlock()
+
+	return ownerId, err
+}
+
+func (o *Owners) cached(botId uint64) (uint64, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	cached, ok := o.cache[botId]
+	if !ok {
+		return 0, false
+	}
+
+	if time.Now().After(cached.expiresAt) {
+		delete(o.cache, botId)
+		return 0, false
+	}
+
+	return cached.ownerId, true
+}
+
+func (o *Owners) fetch(ctx context.Context, conf config.Config, botId uint64) (uint64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf(conf.Whitelabel.OwnerUrl, botId), nil)
+	if err != nil {
+		return 0, err
+	}
+
+	if conf.Whitelabel.ApiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+conf.Whitelabel.ApiKey)
+	}
+
+	res, err := o.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return 0, ErrUnknownBot
+	default:
+		return 0, fmt.Errorf("whitelabel owner lookup returned %d status code", res.StatusCode)
+	}
+
+	var body ownerResponse
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return 0, err
+	}
+
+	ownerId, err := strconv.ParseUint(body.OwnerId, 10, 64)
+	if err != nil || ownerId == 0 {
+		return 0, fmt.Errorf("invalid owner ID %q", body.OwnerId)
+	}
+
+	return ownerId, nil
+}
@@ -0,0 +1,33 @@
+package discord
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// WebhookType is the type of a webhook event payload, sent to the application's webhook events URL
+type WebhookType uint8
+
+const (
+	WebhookTypePing  WebhookType = 0
+	WebhookTypeEvent WebhookType = 1
+)
+
+type EventType string
+
+const (
+	EventTypeEntitlementCreate EventType = "ENTITLEMENT_CREATE"
+)
+
+type WebhookPayload struct {
+	Version       int           `json:"version"`
+	ApplicationId uint64        `json:"application_id,string"`
+	Type          WebhookType   `json:"type"`
+	Event         *WebhookEvent `json:"event,omitempty"`
+}
+
+type WebhookEvent struct {
+	Type      EventType       `json:"type"`
+	Timestamp time.Time       `json:"timestamp"`
+	Data      json.RawMessage `json:"data"`
+}
@@ -0,0 +1,126 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// cache holds responses until they expire, and shares a single request between concurrent callers. Errors are never
+// cached.
+type cache struct {
+	duration time.Duration // Caching is disabled if negative
+
+	mu         sync.Mutex
+	entries    map[string]cacheEntry
+	inFlight   map[string]*call
+	generation int       // Incremented when the cache is cleared, so that responses requested before aren't cached
+	lastSwept  time.Time // When expired entries were last removed
+}
+
+type cacheEntry struct {
+	value     any
+	expiresAt time.Time
+}
+
+// call is a request that callers for the same key wait on
+type call struct {
+	done  chan struct{}
+	value any
+	err   error
+}
+
+func newCache(duration time.Duration) *cache {
+	return &cache{
+		duration: duration,
+		entries:  make(map[string]cacheEntry),
+		inFlight: make(map[string]*call),
+	}
+}
+
+func (c *cache) get(key string) (any, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	if !time.Now().Before(entry.expiresAt) {
+		delete(c.entries, key)
+		return nil, false
+	}
+
+	return entry.value, true
+}
+
+// do runs fetch, unless a call for the key is already running, in which case its result is waited for. The request
+// isn't cancelled if the caller that started it gives up, as other callers may be waiting on it. fetch returns when the
+// value stops being valid, if ever, and the value is cached until then at the latest.
+func (c *cache) do(ctx context.Context, key string, fetch func(ctx context.Context) (any, *time.Time, error)) (any, error) {
+	c.mu.Lock()
+	pending, ok := c.inFlight[key]
+	if !ok {
+		pending = &call{done: make(chan struct{})}
+		c.inFlight[key] = pending
+		go c.run(context.WithoutCancel(ctx), key, c.generation, pending, fetch)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-pending.done:
+		return pending.value, pending.err
+	}
+}
+
+func (c *cache) run(ctx context.Context, key string, generation int, pending *call, fetch func(ctx context.Context) (any, *time.Time, error)) {
+	value, validUntil, err := fetch(ctx)
+
+	c.mu.Lock()
+	if c.inFlight[key] == pending {
+		delete(c.inFlight, key)
+	}
+
+	if err == nil && c.duration > 0 && generation == c.generation {
+		expiresAt := time.Now().Add(c.duration)
+		if validUntil != nil && validUntil.Before(expiresAt) {
+			expiresAt = *validUntil
+		}
+
+		c.removeExpired()
+		c.entries[key] = cacheEntry{value: value, expiresAt: expiresAt}
+	}
+	c.mu.Unlock()
+
+	pending.value, pending.err = value, err
+	close(pending.done)
+}
+
+// removeExpired removes expired entries at most once per cache duration, so that the cache doesn't grow with keys that
+// aren't requested again. Must be called with the lock held.
+func (c *cache) removeExpired() {
+	now := time.Now()
+	if now.Sub(c.lastSwept) < c.duration {
+		return
+	}
+
+	c.lastSwept = now
+	for key, entry := range c.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+func (c *cache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Requests already running aren't shared with later callers, as they may return what was invalidated
+	c.entries = make(map[string]cacheEntry)
+	c.inFlight = make(map[string]*call)
+	c.generation++
+}
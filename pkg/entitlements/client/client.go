@@ -0,0 +1,183 @@
+// Package client is a client for the entitlements API of the subscriptions app, for the bot, dashboard and other
+// services to check premium in the same way. Responses are cached, and concurrent requests for the same resource share
+// a single API request, so that a burst of checks for a popular guild reaches the app once.
+//
+//	c := client.NewClient("http://subscriptions-app:8080", client.Options{ApiKey: key})
+//	status, err := c.GuildPremium(ctx, guildId)
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultCacheDuration is how long responses are cached if Options.CacheDuration is unset
+const DefaultCacheDuration = time.Minute
+
+// ErrNotFound is returned if the app doesn't know the resource, such as an unknown whitelabel bot
+var ErrNotFound = errors.New("not found")
+
+// ApiError is returned for responses with an unexpected status code, such as a 503 while the app is starting
+type ApiError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *ApiError) Error() string {
+	return fmt.Sprintf("entitlements API returned %d status code: %s", e.StatusCode, e.Message)
+}
+
+type Options struct {
+	// ApiKey is an API key, or a service token, with the read permission
+	ApiKey string
+
+	// CacheDuration is how long responses are cached, defaulting to DefaultCacheDuration. Responses are never cached
+	// past when the premium they describe expires. Caching is disabled if negative.
+	CacheDuration time.Duration
+
+	// HttpClient defaults to a client with a 10 second timeout
+	HttpClient *http.Client
+}
+
+type Client struct {
+	baseUrl    string
+	apiKey     string
+	httpClient *http.Client
+	cache      *cache
+}
+
+// NewClient creates a client for the app at baseUrl, such as http://subscriptions-app:8080
+func NewClient(baseUrl string, opts Options) *Client {
+	httpClient := opts.HttpClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: time.Second * 10}
+	}
+
+	cacheDuration := opts.CacheDuration
+	if cacheDuration == 0 {
+		cacheDuration = DefaultCacheDuration
+	}
+
+	return &Client{
+		baseUrl:    strings.TrimSuffix(baseUrl, "/"),
+		apiKey:     opts.ApiKey,
+		httpClient: httpClient,
+		cache:      newCache(cacheDuration),
+	}
+}
+
+// EntitlementsByDiscordId returns the entitlements of the Discord user from every provider, including inactive ones
+func (c *Client) EntitlementsByDiscordId(ctx context.Context, discordId uint64) ([]Entitlement, error) {
+	return c.entitlements(ctx, url.Values{"discord_id": {strconv.FormatUint(discordId, 10)}})
+}
+
+// EntitlementsByEmail returns the entitlements of the email from every provider, including inactive ones
+func (c *Client) EntitlementsByEmail(ctx context.Context, email string) ([]Entitlement, error) {
+	return c.entitlements(ctx, url.Values{"email": {strings.ToLower(email)}})
+}
+
+func (c *Client) entitlements(ctx context.Context, query url.Values) ([]Entitlement, error) {
+	return fetchCached(ctx, c, "/api/entitlements?"+query.Encode(), func(body struct {
+		Entitlements []Entitlement `json:"entitlements"`
+	}) ([]Entitlement, *time.Time) {
+		var expiresAt *time.Time
+		for _, entitlement := range body.Entitlements {
+			if entitlement.Active && entitlement.PremiumExpiresAt != nil && (expiresAt == nil || entitlement.PremiumExpiresAt.Before(*expiresAt)) {
+				expiresAt = entitlement.PremiumExpiresAt
+			}
+		}
+
+		return body.Entitlements, expiresAt
+	})
+}
+
+// GuildPremium returns whether the guild has premium, through the users who assigned premium to it
+func (c *Client) GuildPremium(ctx context.Context, guildId uint64) (GuildPremium, error) {
+	return fetchCached(ctx, c, fmt.Sprintf("/api/guilds/%d/premium", guildId), func(status GuildPremium) (GuildPremium, *time.Time) {
+		return status, status.ExpiresAt
+	})
+}
+
+// WhitelabelEntitlement returns whether the owner of the whitelabel bot is entitled to whitelabel. ErrNotFound is
+// returned if the app doesn't know the bot's owner.
+func (c *Client) WhitelabelEntitlement(ctx context.Context, botId uint64) (WhitelabelEntitlement, error) {
+	return fetchCached(ctx, c, fmt.Sprintf("/api/whitelabel/%d/entitlement", botId), func(entitlement WhitelabelEntitlement) (WhitelabelEntitlement, *time.Time) {
+		return entitlement, entitlement.ExpiresAt
+	})
+}
+
+// Invalidate removes every cached response, such as after being told that premium has changed
+func (c *Client) Invalidate() {
+	c.cache.clear()
+}
+
+// fetchCached returns the cached response for the path, or requests it, sharing the request with any concurrent calls
+// for the same path. convert returns the result, and when the premium it describes expires, if ever.
+func fetchCached[B, T any](ctx context.Context, c *Client, path string, convert func(B) (T, *time.Time)) (T, error) {
+	if value, ok := c.cache.get(path); ok {
+		return value.(T), nil
+	}
+
+	value, err := c.cache.do(ctx, path, func(ctx context.Context) (any, *time.Time, error) {
+		var body B
+		if err := c.get(ctx, path, &body); err != nil {
+			return nil, nil, err
+		}
+
+		result, expiresAt := convert(body)
+		return result, expiresAt, nil
+	})
+
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+
+	return value.(T), nil
+}
+
+func (c *Client) get(ctx context.Context, path string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseUrl+path, nil)
+	if err != nil {
+		return err
+	}
+
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		return json.NewDecoder(res.Body).Decode(out)
+	case http.StatusNotFound:
+		return ErrNotFound
+	default:
+		content, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+
+		var body struct {
+			Error string `json:"error"`
+		}
+
+		message := strings.TrimSpace(string(content))
+		if json.Unmarshal(content, &body) == nil && body.Error != "" {
+			message = body.Error
+		}
+
+		return &ApiError{StatusCode: res.StatusCode, Message: message}
+	}
+}
@@ -0,0 +1,43 @@
+package client
+
+import "time"
+
+// Entitlement is an entitlement returned by GET /api/entitlements, which the app converts from every provider's data
+type Entitlement struct {
+	Source    string  `json:"source"`
+	Reference string  `json:"reference"` // The provider's ID for the subscription, or the patron ID for Patreon
+	Email     *string `json:"email"`
+	DiscordId *uint64 `json:"discord_id,string"`
+
+	Tier      string `json:"tier"`
+	Sku       uint64 `json:"sku,string,omitempty"`
+	RoleId    uint64 `json:"role_id,string,omitempty"`
+	MaxGuilds int    `json:"max_guilds"`
+
+	Status      string     `json:"status"`
+	Active      bool       `json:"active"`
+	StartsAt    *time.Time `json:"starts_at"`
+	EndsAt      *time.Time `json:"ends_at"`
+	GraceEndsAt *time.Time `json:"grace_ends_at"`
+
+	// PremiumExpiresAt is when access ends if nothing changes. Unset if it doesn't expire.
+	PremiumExpiresAt *time.Time `json:"premium_expires_at"`
+}
+
+// GuildPremium is returned by GET /api/guilds/:id/premium
+type GuildPremium struct {
+	GuildId   uint64     `json:"guild_id,string"`
+	Premium   bool       `json:"premium"`
+	Tiers     []string   `json:"tiers"`
+	ExpiresAt *time.Time `json:"expires_at"` // Unset if one of the tiers doesn't expire
+}
+
+// WhitelabelEntitlement is returned by GET /api/whitelabel/:botId/entitlement
+type WhitelabelEntitlement struct {
+	BotId     uint64     `json:"bot_id,string"`
+	OwnerId   uint64     `json:"owner_id,string"`
+	Entitled  bool       `json:"entitled"`
+	Tier      string     `json:"tier,omitempty"`
+	Source    string     `json:"source,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
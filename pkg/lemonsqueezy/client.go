@@ -0,0 +1,114 @@
+package lemonsqueezy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const BaseUrl = "https://api.lemonsqueezy.com/v1"
+
+type Client struct {
+	httpClient *http.Client
+	apiKey     string
+}
+
+func NewClient(apiKey string) *Client {
+	return &Client{
+		httpClient: http.DefaultClient,
+		apiKey:     apiKey,
+	}
+}
+
+type SubscriptionResource struct {
+	Id           string
+	Subscription Subscription
+}
+
+// ListSubscriptions fetches every subscription belonging to the store, following pagination
+func (c *Client) ListSubscriptions(ctx context.Context, storeId uint64) ([]SubscriptionResource, error) {
+	var subscriptions []SubscriptionResource
+	for page := 1; ; page++ {
+		query := url.Values{}
+		query.Set("filter[store_id]", fmt.Sprintf("%d", storeId))
+		query.Set("page[number]", fmt.Sprintf("%d", page))
+		query.Set("page[size]", "100")
+
+		var body struct {
+			Data []struct {
+				Id         string       `json:"id"`
+				Attributes Subscription `json:"attributes"`
+			} `json:"data"`
+			Meta struct {
+				Page struct {
+					LastPage int `json:"lastPage"`
+				} `json:"page"`
+			} `json:"meta"`
+		}
+
+		if err := c.do(ctx, http.MethodGet, "/subscriptions?"+query.Encode(), nil, &body); err != nil {
+			return nil, err
+		}
+
+		for _, resource := range body.Data {
+			subscriptions = append(subscriptions, SubscriptionResource{
+				Id:           resource.Id,
+				Subscription: resource.Attributes,
+			})
+		}
+
+		if page >= body.Meta.Page.LastPage {
+			break
+		}
+	}
+
+	return subscriptions, nil
+}
+
+// ValidateLicense checks a license key using the public license API, which does not require an API key
+func (c *Client) ValidateLicense(ctx context.Context, key string) (LicenseValidation, error) {
+	form := url.Values{}
+	form.Set("license_key", key)
+
+	var res LicenseValidation
+	if err := c.do(ctx, http.MethodPost, "/licenses/validate", strings.NewReader(form.Encode()), &res); err != nil {
+		return LicenseValidation{}, err
+	}
+
+	return res, nil
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body io.Reader, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, BaseUrl+path, body)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", "application/vnd.api+json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	// The license API returns 400 or 404 for invalid keys, with an error message in the body
+	if res.StatusCode != http.StatusOK && !(strings.HasPrefix(path, "/licenses/") && res.StatusCode < 500) {
+		resBody, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("lemon squeezy request returned %d status code: %s", res.StatusCode, string(resBody))
+	}
+
+	return json.NewDecoder(res.Body).Decode(out)
+}
@@ -0,0 +1,86 @@
+package lemonsqueezy
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type EventName string
+
+const (
+	EventSubscriptionCreated        EventName = "subscription_created"
+	EventSubscriptionUpdated        EventName = "subscription_updated"
+	EventSubscriptionCancelled      EventName = "subscription_cancelled"
+	EventSubscriptionResumed        EventName = "subscription_resumed"
+	EventSubscriptionExpired        EventName = "subscription_expired"
+	EventSubscriptionPaused         EventName = "subscription_paused"
+	EventSubscriptionUnpaused       EventName = "subscription_unpaused"
+	EventSubscriptionPaymentFailed  EventName = "subscription_payment_failed"
+	EventSubscriptionPaymentSuccess EventName = "subscription_payment_success"
+	EventLicenseKeyCreated          EventName = "license_key_created"
+	EventLicenseKeyUpdated          EventName = "license_key_updated"
+)
+
+const (
+	ResourceSubscriptions = "subscriptions"
+	ResourceLicenseKeys   = "license-keys"
+)
+
+type (
+	// Event is the body of a webhook request. Data is a JSON:API resource object, with attributes depending on its type.
+	Event struct {
+		Meta struct {
+			EventName  EventName       `json:"event_name"`
+			CustomData json.RawMessage `json:"custom_data"`
+		} `json:"meta"`
+		Data Resource `json:"data"`
+	}
+
+	Resource struct {
+		Type       string          `json:"type"`
+		Id         string          `json:"id"`
+		Attributes json.RawMessage `json:"attributes"`
+	}
+
+	Subscription struct {
+		StoreId     uint64     `json:"store_id"`
+		CustomerId  uint64     `json:"customer_id"`
+		ProductId   uint64     `json:"product_id"`
+		VariantId   uint64     `json:"variant_id"`
+		ProductName string     `json:"product_name"`
+		VariantName string     `json:"variant_name"`
+		UserEmail   string     `json:"user_email"`
+		Status      string     `json:"status"`
+		RenewsAt    *time.Time `json:"renews_at"`
+		EndsAt      *time.Time `json:"ends_at"`
+		CreatedAt   time.Time  `json:"created_at"`
+		UpdatedAt   time.Time  `json:"updated_at"`
+	}
+
+	LicenseKey struct {
+		StoreId   uint64     `json:"store_id"`
+		ProductId uint64     `json:"product_id"`
+		UserEmail string     `json:"user_email"`
+		KeyShort  string     `json:"key_short"`
+		Status    string     `json:"status"`
+		ExpiresAt *time.Time `json:"expires_at"`
+		CreatedAt time.Time  `json:"created_at"`
+		UpdatedAt time.Time  `json:"updated_at"`
+	}
+
+	LicenseValidation struct {
+		Valid      bool   `json:"valid"`
+		Error      string `json:"error"`
+		LicenseKey struct {
+			Id        uint64     `json:"id"`
+			Status    string     `json:"status"`
+			ExpiresAt *time.Time `json:"expires_at"`
+		} `json:"license_key"`
+		Meta struct {
+			StoreId       uint64 `json:"store_id"`
+			ProductId     uint64 `json:"product_id"`
+			VariantId     uint64 `json:"variant_id"`
+			CustomerEmail string `json:"customer_email"`
+		} `json:"meta"`
+	}
+)
@@ -0,0 +1,35 @@
+package lemonsqueezy
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+)
+
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// VerifySignature verifies the X-Signature header, which is a hex encoded HMAC-SHA256 of the raw request body
+func VerifySignature(secret, signature string, body []byte) error {
+	decoded, err := hex.DecodeString(signature)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	if !hmac.Equal(decoded, digest(secret, body)) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// Sign returns an X-Signature header for the body, as Lemon Squeezy would send it
+func Sign(secret string, body []byte) string {
+	return hex.EncodeToString(digest(secret, body))
+}
+
+func digest(secret string, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
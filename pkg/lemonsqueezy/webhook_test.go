@@ -0,0 +1,56 @@
+package lemonsqueezy
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestVerifySignature(t *testing.T) {
+	const secret = "webhook_secret"
+	body := []byte(`{"meta":{"event_name":"subscription_created"},"data":{"id":"1"}}`)
+
+	tests := []struct {
+		name      string
+		signature string
+		body      []byte
+		want      error
+	}{
+		{
+			name:      "valid signature",
+			signature: Sign(secret, body),
+			body:      body,
+		},
+		{
+			name:      "tampered body",
+			signature: Sign(secret, body),
+			body:      []byte(`{"meta":{"event_name":"subscription_expired"},"data":{"id":"1"}}`),
+			want:      ErrInvalidSignature,
+		},
+		{
+			name:      "wrong secret",
+			signature: Sign("another_secret", body),
+			body:      body,
+			want:      ErrInvalidSignature,
+		},
+		{
+			name:      "signature that isn't hex",
+			signature: "not-a-signature",
+			body:      body,
+			want:      ErrInvalidSignature,
+		},
+		{
+			name:      "missing signature",
+			signature: "",
+			body:      body,
+			want:      ErrInvalidSignature,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := VerifySignature(secret, tt.signature, tt.body); !errors.Is(err, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
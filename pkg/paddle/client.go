@@ -0,0 +1,65 @@
+package paddle
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+const (
+	BaseUrl        = "https://api.paddle.com"
+	SandboxBaseUrl = "https://sandbox-api.paddle.com"
+)
+
+type Client struct {
+	httpClient *http.Client
+	baseUrl    string
+	apiKey     string
+}
+
+func NewClient(apiKey string, sandbox bool) *Client {
+	baseUrl := BaseUrl
+	if sandbox {
+		baseUrl = SandboxBaseUrl
+	}
+
+	return &Client{
+		httpClient: http.DefaultClient,
+		baseUrl:    baseUrl,
+		apiKey:     apiKey,
+	}
+}
+
+func (c *Client) GetCustomer(ctx context.Context, customerId string) (Customer, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseUrl+"/customers/"+url.PathEscape(customerId), nil)
+	if err != nil {
+		return Customer{}, err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return Customer{}, err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(res.Body)
+		return Customer{}, fmt.Errorf("customer request returned %d status code: %s", res.StatusCode, string(body))
+	}
+
+	var body struct {
+		Data Customer `json:"data"`
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return Customer{}, err
+	}
+
+	return body.Data, nil
+}
@@ -0,0 +1,71 @@
+package paddle
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type EventType string
+
+const (
+	EventSubscriptionCreated   EventType = "subscription.created"
+	EventSubscriptionUpdated   EventType = "subscription.updated"
+	EventSubscriptionActivated EventType = "subscription.activated"
+	EventSubscriptionCanceled  EventType = "subscription.canceled"
+	EventSubscriptionPastDue   EventType = "subscription.past_due"
+	EventSubscriptionPaused    EventType = "subscription.paused"
+	EventSubscriptionResumed   EventType = "subscription.resumed"
+	EventSubscriptionTrialing  EventType = "subscription.trialing"
+)
+
+func (t EventType) IsSubscriptionEvent() bool {
+	switch t {
+	case EventSubscriptionCreated, EventSubscriptionUpdated, EventSubscriptionActivated, EventSubscriptionCanceled,
+		EventSubscriptionPastDue, EventSubscriptionPaused, EventSubscriptionResumed, EventSubscriptionTrialing:
+		return true
+	default:
+		return false
+	}
+}
+
+type (
+	Event struct {
+		EventId    string          `json:"event_id"`
+		EventType  EventType       `json:"event_type"`
+		OccurredAt time.Time       `json:"occurred_at"`
+		Data       json.RawMessage `json:"data"`
+	}
+
+	Subscription struct {
+		Id                   string             `json:"id"`
+		Status               string             `json:"status"`
+		CustomerId           string             `json:"customer_id"`
+		StartedAt            *time.Time         `json:"started_at"`
+		CanceledAt           *time.Time         `json:"canceled_at"`
+		CurrentBillingPeriod *BillingPeriod     `json:"current_billing_period"`
+		Items                []SubscriptionItem `json:"items"`
+		CustomData           CustomData         `json:"custom_data"`
+	}
+
+	BillingPeriod struct {
+		StartsAt time.Time `json:"starts_at"`
+		EndsAt   time.Time `json:"ends_at"`
+	}
+
+	SubscriptionItem struct {
+		Status string `json:"status"`
+		Price  struct {
+			Id string `json:"id"`
+		} `json:"price"`
+	}
+
+	// CustomData is passed through checkout by our storefront
+	CustomData struct {
+		DiscordId *uint64 `json:"discord_id,string,omitempty"`
+	}
+
+	Customer struct {
+		Id    string `json:"id"`
+		Email string `json:"email"`
+	}
+)
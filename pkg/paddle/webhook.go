@@ -0,0 +1,82 @@
+package paddle
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMalformedSignature = errors.New("malformed Paddle-Signature header")
+	ErrInvalidSignature   = errors.New("invalid webhook signature")
+	ErrSignatureExpired   = errors.New("webhook signature timestamp outside of tolerance")
+)
+
+// SignatureTolerance is the maximum age of a webhook signature that will be accepted
+const SignatureTolerance = time.Minute * 5
+
+// VerifySignature verifies the Paddle-Signature header (in the format ts=...;h1=...) against the raw request body
+func VerifySignature(secret, header string, body []byte) error {
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return ErrMalformedSignature
+		}
+
+		switch key {
+		case "ts":
+			timestamp = value
+		case "h1":
+			signatures = append(signatures, value)
+		}
+	}
+
+	if timestamp == "" || len(signatures) == 0 {
+		return ErrMalformedSignature
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrMalformedSignature
+	}
+
+	if age := time.Since(time.Unix(unix, 0)); age > SignatureTolerance || age < -SignatureTolerance {
+		return ErrSignatureExpired
+	}
+
+	expected := digest(secret, timestamp, body)
+
+	// Multiple h1 values are sent while a secret is being rotated
+	for _, signature := range signatures {
+		decoded, err := hex.DecodeString(signature)
+		if err != nil {
+			continue
+		}
+
+		if hmac.Equal(decoded, expected) {
+			return nil
+		}
+	}
+
+	return ErrInvalidSignature
+}
+
+// Sign returns a Paddle-Signature header for the body, signed at the given time, as Paddle would send it
+func Sign(secret string, at time.Time, body []byte) string {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	return fmt.Sprintf("ts=%s;h1=%s", timestamp, hex.EncodeToString(digest(secret, timestamp, body)))
+}
+
+func digest(secret, timestamp string, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + ":"))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
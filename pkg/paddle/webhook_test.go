@@ -0,0 +1,100 @@
+package paddle
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// signature returns the h1 value of a Paddle-Signature header
+func signature(header string) string {
+	_, h1, _ := strings.Cut(header, ";h1=")
+	return h1
+}
+
+func TestVerifySignature(t *testing.T) {
+	const secret = "pdl_ntfset_secret"
+	body := []byte(`{"event_id":"evt_01","event_type":"subscription.activated"}`)
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		header string
+		body   []byte
+		want   error
+	}{
+		{
+			name:   "valid signature",
+			header: Sign(secret, now, body),
+			body:   body,
+		},
+		{
+			name:   "one of several signatures during rotation",
+			header: Sign("old_secret", now, body) + ";h1=" + signature(Sign(secret, now, body)),
+			body:   body,
+		},
+		{
+			name:   "tampered body",
+			header: Sign(secret, now, body),
+			body:   []byte(`{"event_id":"evt_01","event_type":"subscription.canceled"}`),
+			want:   ErrInvalidSignature,
+		},
+		{
+			name:   "wrong secret",
+			header: Sign("another_secret", now, body),
+			body:   body,
+			want:   ErrInvalidSignature,
+		},
+		{
+			name:   "timestamp too old",
+			header: Sign(secret, now.Add(-SignatureTolerance-time.Minute), body),
+			body:   body,
+			want:   ErrSignatureExpired,
+		},
+		{
+			name:   "timestamp in the future",
+			header: Sign(secret, now.Add(SignatureTolerance+time.Minute), body),
+			body:   body,
+			want:   ErrSignatureExpired,
+		},
+		{
+			name:   "empty header",
+			header: "",
+			body:   body,
+			want:   ErrMalformedSignature,
+		},
+		{
+			name:   "missing timestamp",
+			header: "h1=abcdef",
+			body:   body,
+			want:   ErrMalformedSignature,
+		},
+		{
+			name:   "missing signature",
+			header: "ts=1234567890",
+			body:   body,
+			want:   ErrMalformedSignature,
+		},
+		{
+			name:   "non-numeric timestamp",
+			header: "ts=yesterday;h1=abcdef",
+			body:   body,
+			want:   ErrMalformedSignature,
+		},
+		{
+			name:   "part without a value",
+			header: "ts=1234567890;h1",
+			body:   body,
+			want:   ErrMalformedSignature,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := VerifySignature(secret, tt.header, tt.body); !errors.Is(err, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
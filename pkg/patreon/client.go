@@ -2,88 +2,248 @@ package patreon
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/TicketsBot/subscriptions-app/internal/clock"
 	"github.com/TicketsBot/subscriptions-app/internal/config"
-	"github.com/jackc/pgx"
-	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/TicketsBot/subscriptions-app/internal/metrics"
+	"github.com/TicketsBot/subscriptions-app/internal/tracing"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
-	"golang.org/x/time/rate"
 )
 
 type Client struct {
 	httpClient  *http.Client
 	config      config.Config
 	logger      *zap.Logger
-	ratelimiter *rate.Limiter
-	db          *pgxpool.Pool
+	ratelimiter *adaptiveLimiter
+	configMu    sync.RWMutex // Guards config and ratelimiter, which are replaced when config is reloaded
+	tokenStore  TokenStore
+	tiers       TierRegistry
+	clock       clock.Clock
+	progress    ProgressFunc // May be nil
+
+	tokens   Tokens
+	tokensMu sync.RWMutex // Guards tokens, which are replaced when they are refreshed or reloaded from the store
+}
+
+// TierRegistry is used to determine which tiers are known, and to report any that are not
+type TierRegistry interface {
+	IsKnown(tierId uint64) bool
+	ReportUnknown(ctx context.Context, tierId, patronId uint64) error
+}
 
-	Tokens Tokens
+// TokenStore persists the tokens of each client, as refresh tokens can only be used once
+type TokenStore interface {
+	// Tokens returns the stored tokens of the client, and whether any are stored
+	Tokens(ctx context.Context, clientId string) (Tokens, bool, error)
+	SetTokens(ctx context.Context, clientId string, tokens Tokens) error
 }
 
 const UserAgent = "tickets.bot/subscriptions-app (https://github.com/TicketsBot/subscriptions-app)"
 
-func NewClient(config config.Config, logger *zap.Logger, pool *pgxpool.Pool) *Client {
-	// Get initial tokens from the database
+// NewClient creates a client, loading its tokens from the store. If tokenStore is nil, as when testing against
+// patreontest, tokens are neither loaded nor stored, and should be set on the client. When replaying recorded
+// responses, placeholder tokens are used, as requests never reach Patreon. Token expiry is checked against clk.
+func NewClient(config config.Config, logger *zap.Logger, tokenStore TokenStore, tiers TierRegistry, clk clock.Clock) *Client {
+	// Get initial tokens from the store
 	var tokens Tokens
-	if err := pool.QueryRow(context.Background(), "SELECT access_token, refresh_token, expires FROM patreon_keys WHERE client_id = $1", config.Patreon.ClientId).Scan(&tokens.AccessToken, &tokens.RefreshToken, &tokens.ExpiresAt); err != nil {
-		if err != pgx.ErrNoRows {
+	if config.Patreon.ReplayDir != "" {
+		tokens = Tokens{
+			AccessToken:  redacted,
+			RefreshToken: redacted,
+			ExpiresAt:    clk.Now().AddDate(10, 0, 0),
+		}
+		tokenStore = nil
+	} else if tokenStore != nil {
+		stored, ok, err := tokenStore.Tokens(context.Background(), config.Patreon.ClientId)
+		if err != nil {
 			logger.Error("Failed to get Patreon keys from database", zap.Error(err))
 			return nil
 		}
-		logger.Info("No Patreon keys found in database, will need to refresh them")
+
+		if ok {
+			tokens = stored
+		} else {
+			logger.Info("No Patreon keys found in database, will need to refresh them")
+		}
 	}
 
 	return &Client{
-		httpClient: http.DefaultClient,
-		config:     config,
-		logger:     logger,
-		ratelimiter: rate.NewLimiter(
-			rate.Every(time.Minute/time.Duration(config.Patreon.RequestsPerMinute)),
-			config.Patreon.RequestsPerMinute,
-		),
-		db: pool,
-		Tokens: Tokens{
-			AccessToken:  tokens.AccessToken,
-			RefreshToken: tokens.RefreshToken,
-			ExpiresAt:    tokens.ExpiresAt,
-		},
+		httpClient:  newHttpClient(config, logger),
+		config:      config,
+		logger:      logger,
+		ratelimiter: newAdaptiveLimiter(config.Patreon.RequestsPerMinute),
+		tokenStore:  tokenStore,
+		tiers:       tiers,
+		clock:       clk,
+		tokens:      tokens,
+	}
+}
+
+// newHttpClient creates a client that keeps connections to Patreon open between requests, so that the pages of a sync
+// reuse them. Responses are recorded or replayed if configured.
+func newHttpClient(config config.Config, logger *zap.Logger) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = config.Patreon.MaxIdleConns
+	transport.MaxIdleConnsPerHost = config.Patreon.MaxIdleConns // Every request is to the same host
+	transport.IdleConnTimeout = time.Duration(config.Patreon.IdleConnTimeoutSeconds) * time.Second
+	transport.DisableKeepAlives = config.Patreon.DisableKeepAlives
+
+	if config.Patreon.DisableHttp2 {
+		transport.ForceAttemptHTTP2 = false
+		transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+
+	var roundTripper http.RoundTripper = transport
+	if config.Patreon.ReplayDir != "" {
+		logger.Warn("Replaying recorded Patreon responses", zap.String("dir", config.Patreon.ReplayDir))
+		roundTripper = NewReplayTransport(config.Patreon.ReplayDir)
+	} else if config.Patreon.RecordDir != "" {
+		recording, err := NewRecordingTransport(transport, config.Patreon.RecordDir, config.Patreon.CanonicalizeGmail, logger)
+		if err != nil {
+			logger.Error("Failed to start recording Patreon responses", zap.Error(err))
+		} else {
+			logger.Warn("Recording Patreon responses", zap.String("dir", recording.Dir()))
+			roundTripper = recording
+		}
+	}
+
+	return &http.Client{
+		Transport: otelhttp.NewTransport(roundTripper),
+		Timeout:   time.Duration(config.Patreon.RequestTimeoutSeconds) * time.Second,
 	}
 }
 
+// UpdateConfig swaps in reloaded config. If RequestsPerMinute has changed, the rate limiter is replaced with one that
+// starts at the new maximum. Requests already waiting on the old limiter are not affected.
+func (c *Client) UpdateConfig(config config.Config) {
+	c.configMu.Lock()
+	defer c.configMu.Unlock()
+
+	if config.Patreon.RequestsPerMinute != c.config.Patreon.RequestsPerMinute {
+		c.ratelimiter = newAdaptiveLimiter(config.Patreon.RequestsPerMinute)
+	}
+
+	c.config = config
+}
+
+// Tokens returns the client's current tokens. They may be replaced by another goroutine at any time, so callers that
+// need several fields should read them from a single call.
+func (c *Client) Tokens() Tokens {
+	c.tokensMu.RLock()
+	defer c.tokensMu.RUnlock()
+
+	return c.tokens
+}
+
+// SetTokens replaces the client's tokens, without storing them
+func (c *Client) SetTokens(tokens Tokens) {
+	c.tokensMu.Lock()
+	defer c.tokensMu.Unlock()
+
+	c.tokens = tokens
+}
+
+// TokenExpired returns whether the refresh token has expired, after which it can only be replaced manually
+func (c *Client) TokenExpired() bool {
+	return c.Tokens().ExpiresAt.Before(c.clock.Now())
+}
+
+// TokenExpiresIn returns how long remains until the refresh token expires
+func (c *Client) TokenExpiresIn() time.Duration {
+	return clock.Until(c.clock, c.Tokens().ExpiresAt)
+}
+
+// ReloadTokens replaces the client's tokens with the stored tokens, if they expire later, returning whether they were
+// replaced. This picks up tokens stored by `tokens bootstrap` after the refresh token has expired, without a restart.
+func (c *Client) ReloadTokens(ctx context.Context) (bool, error) {
+	if c.tokenStore == nil {
+		return false, nil
+	}
+
+	conf, _ := c.currentConfig()
+
+	stored, ok, err := c.tokenStore.Tokens(ctx, conf.Patreon.ClientId)
+	if err != nil {
+		return false, err
+	}
+
+	// Compared and replaced under the lock, so that tokens refreshed in the meantime aren't replaced by older ones
+	c.tokensMu.Lock()
+	defer c.tokensMu.Unlock()
+
+	if !ok || !stored.ExpiresAt.After(c.tokens.ExpiresAt) {
+		return false, nil
+	}
+
+	c.tokens = stored
+	return true, nil
+}
+
+// currentConfig returns the config and rate limiter at the time of the call
+func (c *Client) currentConfig() (config.Config, *adaptiveLimiter) {
+	c.configMu.RLock()
+	defer c.configMu.RUnlock()
+
+	return c.config, c.ratelimiter
+}
+
 func (c *Client) RefreshCredentials(ctx context.Context) error {
+	conf, _ := c.currentConfig()
+
+	return c.requestTokens(ctx, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {c.Tokens().RefreshToken},
+		"client_id":     {conf.Patreon.ClientId},
+		"client_secret": {conf.Patreon.ClientSecret},
+	})
+}
+
+// requestTokens requests new tokens from the token endpoint, then replaces the client's tokens with them and stores
+// them. The secrets are sent in the body rather than the query, as the URL of every request is exported with its span.
+func (c *Client) requestTokens(ctx context.Context, form url.Values) error {
+	conf, ratelimiter := c.currentConfig()
+
 	req, err := http.NewRequestWithContext(
 		ctx,
 		http.MethodPost,
-		fmt.Sprintf(
-			"https://www.patreon.com/api/oauth2/token?grant_type=refresh_token&refresh_token=%s&client_id=%s&client_secret=%s",
-			c.Tokens.RefreshToken,
-			c.config.Patreon.ClientId,
-			c.config.Patreon.ClientSecret,
-		), nil)
+		fmt.Sprintf("%s/api/oauth2/token", conf.Patreon.BaseUrl),
+		strings.NewReader(form.Encode()),
+	)
 
 	if err != nil {
-		c.logger.Error("Failed to create request for refreshing Patreon credentials", zap.Error(err))
+		c.logger.Error("Failed to create request for Patreon credentials", zap.Error(err))
 		return err
 	}
 
 	req.Header.Set("User-Agent", UserAgent)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
-	if err := c.ratelimiter.Wait(ctx); err != nil {
+	if err := ratelimiter.Wait(ctx); err != nil {
 		return err
 	}
 
 	res, err := c.httpClient.Do(req)
 	if err != nil {
-		c.logger.Error("Failed to refresh Patreon credentials", zap.Error(err))
+		c.logger.Error("Failed to request Patreon credentials", zap.Error(err))
 		return err
 	}
 
 	defer res.Body.Close()
+	ratelimiter.Observe(res)
+
 	if res.StatusCode != http.StatusOK {
 		body, err := ioutil.ReadAll(res.Body)
 		if err != nil {
@@ -101,23 +261,29 @@ func (c *Client) RefreshCredentials(ctx context.Context) error {
 			zap.String("body", string(body)),
 		)
 
-		return fmt.Errorf("pledge response returned %d status code", res.StatusCode)
+		return fmt.Errorf("oauth response returned %d status code", res.StatusCode)
 	}
 
 	var body RefreshResponse
 	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
-		c.logger.Error("Failed to decode Patreon refresh response", zap.Error(err))
+		c.logger.Error("Failed to decode Patreon token response", zap.Error(err))
 		return err
 	}
 
-	c.Tokens = Tokens{
+	tokens := Tokens{
 		AccessToken:  body.AccessToken,
 		RefreshToken: body.RefreshToken,
-		ExpiresAt:    time.Now().Add(time.Duration(body.ExpiresIn) * time.Second),
+		ExpiresAt:    c.clock.Now().Add(time.Duration(body.ExpiresIn) * time.Second),
+	}
+
+	c.SetTokens(tokens)
+
+	if c.tokenStore == nil {
+		return nil
 	}
 
 	// Update db
-	if _, err := c.db.Exec(ctx, "UPDATE patreon_keys SET access_token = $1, refresh_token = $2, expires = $3 WHERE client_id = $4", c.Tokens.AccessToken, c.Tokens.RefreshToken, c.Tokens.ExpiresAt, c.config.Patreon.ClientId); err != nil {
+	if err := c.tokenStore.SetTokens(ctx, conf.Patreon.ClientId, tokens); err != nil {
 		c.logger.Error("Failed to update Patreon keys in database", zap.Error(err))
 		return fmt.Errorf("failed to update Patreon keys in database: %w", err)
 	}
@@ -126,70 +292,133 @@ func (c *Client) RefreshCredentials(ctx context.Context) error {
 }
 
 func (c *Client) FetchPledges(ctx context.Context) (map[string]Patron, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "patreon.FetchPledges")
+	defer span.End()
+
+	conf, _ := c.currentConfig()
+	include, pledgeEventFields := "currently_entitled_tiers,user", ""
+	if conf.Patreon.FetchPledgeCurrency {
+		// The currency patrons pledge in is only reported on their pledge events
+		include += ",pledge_history"
+		pledgeEventFields = "&fields%5Bpledge-event%5D=currency_code,date"
+	}
+
 	url := fmt.Sprintf(
-		"https://www.patreon.com/api/oauth2/v2/campaigns/%d/members?include=currently_entitled_tiers,user&fields%%5Bmember%%5D=last_charge_date,last_charge_status,patron_status,email,pledge_relationship_start&fields%%5Buser%%5D=social_connections",
-		c.config.Patreon.CampaignId,
+		"%s/api/oauth2/v2/campaigns/%d/members?include=%s&fields%%5Bmember%%5D=last_charge_date,last_charge_status,patron_status,email,pledge_relationship_start,currently_entitled_amount_cents,campaign_lifetime_support_cents,pledge_cadence,next_charge_date,is_gifted&fields%%5Buser%%5D=social_connections%s&page%%5Bcount%%5D=%d",
+		conf.Patreon.BaseUrl,
+		conf.Patreon.CampaignId,
+		include,
+		pledgeEventFields,
+		conf.Patreon.PageSize,
 	)
 
-	// Email -> Data
+	// Stops fetching pages if we return before the last page
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	pageTimeout := time.Duration(conf.Patreon.PageTimeoutSeconds) * time.Second
+	budget := newRetryBudget(time.Duration(conf.Patreon.RetryBudgetSeconds) * time.Second)
+
+	progress := Progress{StartedAt: c.clock.Now()}
+	metrics.SyncPages.Set(0)
+	metrics.SyncMembers.Set(0)
+	metrics.SyncCampaignMembers.Set(0)
+
+	// Normalized email -> Data
 	data := make(map[string]Patron)
-	for {
-		res, err := c.FetchPageWithTimeout(ctx, 10*time.Minute, url)
-		if err != nil {
-			return nil, err
+	for result := range c.fetchPages(ctx, url, pageTimeout, budget) {
+		if result.err != nil {
+			return nil, result.err
 		}
 
-		for _, member := range res.Data {
-			id := member.Relationships.User.Data.Id
-
-			if member.Attributes.Email == "" {
-				c.logger.Debug("member has no email", zap.Uint64("patron_id", id))
+		for _, patron := range result.page.patrons {
+			if patron.Email == "" {
+				c.logger.Debug("member has no email", zap.Uint64("patron_id", patron.Id))
 				continue
 			}
 
-			// Parse tiers
-			var tiers []uint64
-			for _, tier := range member.Relationships.CurrentlyEntitledTiers.Data {
-				// Check if tier is known
-				if _, ok := c.config.Tiers[tier.TierId]; !ok {
-					c.logger.Warn("unknown tier", zap.Uint64("tier_id", tier.TierId))
-					continue
+			// Report unknown tiers, but keep them so that they can be displayed as unknown
+			for _, tierId := range patron.Tiers {
+				if !c.tiers.IsKnown(tierId) {
+					if err := c.tiers.ReportUnknown(ctx, tierId, patron.Id); err != nil {
+						c.logger.Error("failed to report unknown tier", zap.Uint64("tier_id", tierId), zap.Error(err))
+					}
 				}
+			}
 
-				tiers = append(tiers, tier.TierId)
+			// Members often share an email after migrating accounts
+			key := NormalizeEmail(patron.Email, conf.Patreon.CanonicalizeGmail)
+			if existing, ok := data[key]; ok {
+				patron = MergeDuplicate(existing, patron)
 			}
 
-			// Parse "included" metadata
-			var discordId *uint64
-			for _, included := range res.Included {
-				if id == included.Id {
-					if tmp := included.Attributes.SocialConnections.Discord.Id; tmp != nil {
-						discordId = tmp
-					}
+			data[key] = patron
+		}
 
-					break
-				}
-			}
+		c.reportProgress(&progress, len(result.page.patrons), result.page.total)
+	}
+
+	// fetchPages stops without an error if the context ends between pages, which would otherwise look like a complete,
+	// but truncated, snapshot
+	if err := ctx.Err(); err != nil {
+		return nil, WithDeadlineCause(ctx, err)
+	}
 
-			data[member.Attributes.Email] = Patron{
-				Attributes: member.Attributes,
-				Id:         id,
-				Tiers:      tiers,
-				DiscordId:  discordId,
+	duplicates := 0
+	for _, patron := range data {
+		if len(patron.Duplicates) > 0 {
+			duplicates++
+
+			patronIds := make([]uint64, len(patron.Duplicates))
+			for i, duplicate := range patron.Duplicates {
+				patronIds[i] = duplicate.Id
 			}
 
+			c.logger.Debug("members share an email", zap.Uint64("preferred_patron_id", patron.Id), zap.Uint64s("duplicate_patron_ids", patronIds))
 		}
+	}
 
-		if res.Links == nil || res.Links.Next == nil {
-			break
-		}
+	metrics.PatreonDuplicateEmails.Set(float64(duplicates))
 
-		url = *res.Links.Next
-	}
+	span.SetAttributes(attribute.Int("patreon.pledges", len(data)), attribute.Int("patreon.duplicate_emails", duplicates))
 
 	return data, nil
 }
 
+type pageResult struct {
+	page memberPage
+	err  error
+}
+
+// fetchPages fetches each page of results in order, starting from url. Patreon paginates with cursors, so a page's
+// URL is only known once the previous page has been fetched. Instead, the next page is fetched while the current one
+// is being processed. The channel is closed after the last page, an error or the context being cancelled.
+func (c *Client) fetchPages(ctx context.Context, url string, timeout time.Duration, budget *retryBudget) <-chan pageResult {
+	results := make(chan pageResult)
+
+	go func() {
+		defer close(results)
+
+		for {
+			page, err := c.streamPage(ctx, timeout, url, budget)
+
+			select {
+			case results <- pageResult{page: page, err: err}:
+			case <-ctx.Done():
+				return
+			}
+
+			if err != nil || page.next == nil {
+				return
+			}
+
+			url = *page.next
+		}
+	}()
+
+	return results
+}
+
 func (c *Client) FetchPageWithTimeout(ctx context.Context, timeout time.Duration, url string) (PledgeResponse, error) {
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
@@ -198,30 +427,91 @@ func (c *Client) FetchPageWithTimeout(ctx context.Context, timeout time.Duration
 }
 
 func (c *Client) FetchPage(ctx context.Context, url string) (PledgeResponse, error) {
+	var body PledgeResponse
+	if err := c.requestPage(ctx, url, nil, func(r io.Reader) error {
+		return json.NewDecoder(r).Decode(&body)
+	}); err != nil {
+		return PledgeResponse{}, err
+	}
+
+	return body, nil
+}
+
+// streamPage fetches a page of members, converting them to patrons as they are decoded. Errors caused by a deadline
+// name it, whether it is the page timeout, or the deadline of the whole sync.
+func (c *Client) streamPage(ctx context.Context, timeout time.Duration, url string, budget *retryBudget) (page memberPage, err error) {
+	ctx, cancel := context.WithTimeoutCause(ctx, timeout, pageTimeout(timeout))
+	defer cancel()
+
+	err = c.requestPage(ctx, url, budget, func(r io.Reader) error {
+		page, err = decodeMemberPage(r)
+		return err
+	})
+
+	return page, WithDeadlineCause(ctx, err)
+}
+
+// requestPage requests a page of members, passing the body to decode if the request succeeds. Requests that are rate
+// limited are retried once the limiter has backed off, with the retries bounded by the budget, if set.
+func (c *Client) requestPage(ctx context.Context, url string, budget *retryBudget, decode func(r io.Reader) error) error {
+	ctx, span := tracing.Tracer().Start(ctx, "patreon.FetchPage")
+	defer span.End()
+
 	c.logger.Debug("Fetching page", zap.String("url", url))
 
-	if c.Tokens.ExpiresAt.Before(time.Now()) {
-		return PledgeResponse{}, fmt.Errorf("can't refresh: refresh token has already expired (expired at %s)", c.Tokens.ExpiresAt.String())
+	for attempt := 1; ; attempt++ {
+		var err error
+		if attempt > 1 && budget != nil {
+			err = budget.retry(ctx, func(ctx context.Context) error {
+				return c.attemptPage(ctx, url, decode)
+			})
+		} else {
+			err = c.attemptPage(ctx, url, decode)
+		}
+
+		if !errors.Is(err, errRateLimited) || attempt >= maxRateLimitAttempts {
+			return err
+		}
+
+		c.logger.Warn("Rate limited by Patreon, retrying", zap.String("url", url), zap.Int("attempt", attempt))
+	}
+}
+
+// maxRateLimitAttempts is how many times a page is requested before giving up on being rate limited
+const maxRateLimitAttempts = 5
+
+var errRateLimited = errors.New("rate limited by Patreon")
+
+func (c *Client) attemptPage(ctx context.Context, url string, decode func(r io.Reader) error) error {
+	tokens := c.Tokens()
+	if tokens.ExpiresAt.Before(c.clock.Now()) {
+		return fmt.Errorf("can't refresh: refresh token has already expired (expired at %s)", tokens.ExpiresAt.String())
 	}
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		return PledgeResponse{}, err
+		return err
 	}
 
-	req.Header.Set("Authorization", "Bearer "+c.Tokens.AccessToken)
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
 	req.Header.Set("User-Agent", UserAgent)
 
-	if err := c.ratelimiter.Wait(ctx); err != nil {
-		return PledgeResponse{}, err
+	_, ratelimiter := c.currentConfig()
+	if err := ratelimiter.Wait(ctx); err != nil {
+		return err
 	}
 
 	res, err := c.httpClient.Do(req)
 	if err != nil {
-		return PledgeResponse{}, err
+		return err
 	}
 
 	defer res.Body.Close()
+	ratelimiter.Observe(res)
+
+	if res.StatusCode == http.StatusTooManyRequests {
+		return errRateLimited
+	}
 
 	if res.StatusCode != http.StatusOK {
 		body, err := ioutil.ReadAll(res.Body)
@@ -231,7 +521,7 @@ func (c *Client) FetchPage(ctx context.Context, url string) (PledgeResponse, err
 				zap.Int("status_code", res.StatusCode),
 				zap.Error(err),
 			)
-			return PledgeResponse{}, err
+			return err
 		}
 
 		c.logger.Error(
@@ -240,15 +530,61 @@ func (c *Client) FetchPage(ctx context.Context, url string) (PledgeResponse, err
 			zap.String("body", string(body)),
 		)
 
-		return PledgeResponse{}, fmt.Errorf("pledge response returned %d status code", res.StatusCode)
+		return fmt.Errorf("pledge response returned %d status code", res.StatusCode)
 	}
 
-	var body PledgeResponse
-	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
-		return PledgeResponse{}, err
+	if err := decode(res.Body); err != nil {
+		return err
 	}
 
 	c.logger.Debug("Page fetched successfully", zap.String("url", url))
 
-	return body, nil
+	return nil
+}
+
+// VerifyCampaign checks that the stored access token is valid and can read the configured campaign
+func (c *Client) VerifyCampaign(ctx context.Context) error {
+	conf, ratelimiter := c.currentConfig()
+
+	tokens := c.Tokens()
+	if tokens.AccessToken == "" {
+		return fmt.Errorf("no Patreon tokens are stored for client %s", conf.Patreon.ClientId)
+	}
+
+	if tokens.ExpiresAt.Before(c.clock.Now()) {
+		return fmt.Errorf("refresh token has already expired (expired at %s)", tokens.ExpiresAt.String())
+	}
+
+	url := fmt.Sprintf("%s/api/oauth2/v2/campaigns/%d", conf.Patreon.BaseUrl, conf.Patreon.CampaignId)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	req.Header.Set("User-Agent", UserAgent)
+
+	if err := ratelimiter.Wait(ctx); err != nil {
+		return err
+	}
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+	ratelimiter.Observe(res)
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusUnauthorized:
+		return fmt.Errorf("Patreon rejected the access token")
+	case http.StatusForbidden, http.StatusNotFound:
+		return fmt.Errorf("campaign %d was not found, or the access token cannot read it", conf.Patreon.CampaignId)
+	default:
+		return fmt.Errorf("campaign request returned %d status code", res.StatusCode)
+	}
 }
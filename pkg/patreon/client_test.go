@@ -0,0 +1,213 @@
+package patreon_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/TicketsBot/subscriptions-app/internal/clock"
+	"github.com/TicketsBot/subscriptions-app/internal/config"
+	"github.com/TicketsBot/subscriptions-app/pkg/patreon"
+	"github.com/TicketsBot/subscriptions-app/pkg/patreon/patreontest"
+	"go.uber.org/zap"
+)
+
+// knownTiers treats every tier as known
+type knownTiers struct{}
+
+func (knownTiers) IsKnown(uint64) bool { return true }
+
+func (knownTiers) ReportUnknown(context.Context, uint64, uint64) error { return nil }
+
+// newTestClient returns a client for a fake campaign with the members, which fetches pageSize members per request and
+// holds the fake's current tokens
+func newTestClient(t *testing.T, members []patreon.Patron, pageSize int) (*patreon.Client, *patreontest.Server) {
+	t.Helper()
+
+	server := patreontest.NewServer(1234)
+	t.Cleanup(server.Close)
+	server.SetMembers(members)
+
+	var conf config.Config
+	conf.Patreon.RequestsPerMinute = 6000
+	conf.Patreon.PageSize = pageSize
+	conf.Patreon.PageTimeoutSeconds = 10
+	conf.Patreon.RetryBudgetSeconds = 10
+
+	client := patreon.NewClient(server.Config(conf), zap.NewNop(), nil, knownTiers{}, clock.Real)
+	client.SetTokens(server.Tokens())
+	return client, server
+}
+
+func testMembers(count int) []patreon.Patron {
+	members := make([]patreon.Patron, count)
+	for i := range members {
+		discordId := uint64(100000000000000000 + i)
+		members[i] = patreon.Patron{
+			Attributes: patreon.Attributes{
+				Email:        fmt.Sprintf("patron%d@example.com", i),
+				PatronStatus: "active_patron",
+			},
+			Id:        uint64(i + 1),
+			Tiers:     []uint64{1001},
+			DiscordId: &discordId,
+		}
+	}
+
+	return members
+}
+
+func TestFetchPledgesPagination(t *testing.T) {
+	tests := []struct {
+		name     string
+		members  int
+		pageSize int
+		requests int
+	}{
+		{"empty campaign", 0, 3, 1},
+		{"single page", 2, 3, 1},
+		{"exactly one page", 3, 3, 1},
+		{"several pages", 7, 3, 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			members := testMembers(test.members)
+			client, server := newTestClient(t, members, test.pageSize)
+
+			patrons, err := client.FetchPledges(context.Background())
+			if err != nil {
+				t.Fatalf("failed to fetch pledges: %v", err)
+			}
+
+			if len(patrons) != test.members {
+				t.Errorf("expected %d patrons, got %d", test.members, len(patrons))
+			}
+
+			for _, member := range members {
+				patron, ok := patrons[member.Email]
+				if !ok {
+					t.Errorf("patron %s is missing", member.Email)
+					continue
+				}
+
+				if patron.Id != member.Id || patron.DiscordId == nil || *patron.DiscordId != *member.DiscordId {
+					t.Errorf("patron %s was decoded as %+v", member.Email, patron)
+				}
+			}
+
+			if count := server.RequestCount(); count != test.requests {
+				t.Errorf("expected %d requests, got %d", test.requests, count)
+			}
+		})
+	}
+}
+
+func TestRefreshAfterUnauthorized(t *testing.T) {
+	client, server := newTestClient(t, testMembers(2), 10)
+
+	// The access token has been revoked, but the refresh token is still valid
+	tokens := server.Tokens()
+	tokens.AccessToken = "revoked"
+	client.SetTokens(tokens)
+
+	if _, err := client.FetchPledges(context.Background()); err == nil {
+		t.Fatal("expected fetching with a revoked access token to fail")
+	}
+
+	// Unauthorized requests aren't retried
+	if count := server.RequestCount(); count != 1 {
+		t.Errorf("expected 1 request, got %d", count)
+	}
+
+	if err := client.RefreshCredentials(context.Background()); err != nil {
+		t.Fatalf("failed to refresh credentials: %v", err)
+	}
+
+	if got, want := client.Tokens().AccessToken, server.Tokens().AccessToken; got != want {
+		t.Errorf("expected access token %q after refreshing, got %q", want, got)
+	}
+
+	patrons, err := client.FetchPledges(context.Background())
+	if err != nil {
+		t.Fatalf("failed to fetch pledges after refreshing: %v", err)
+	}
+
+	if len(patrons) != 2 {
+		t.Errorf("expected 2 patrons, got %d", len(patrons))
+	}
+}
+
+func TestFetchPledgesRateLimited(t *testing.T) {
+	tests := []struct {
+		name        string
+		rateLimited int
+		requests    int
+		fails       bool
+	}{
+		{"retried", 2, 3, false},
+		{"gives up", 5, 5, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, server := newTestClient(t, testMembers(2), 10)
+			server.RateLimit(test.rateLimited, 0)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			patrons, err := client.FetchPledges(ctx)
+			if test.fails {
+				if err == nil {
+					t.Error("expected fetching to fail once the retries ran out")
+				}
+			} else if err != nil {
+				t.Errorf("failed to fetch pledges: %v", err)
+			} else if len(patrons) != 2 {
+				t.Errorf("expected 2 patrons, got %d", len(patrons))
+			}
+
+			if count := server.RequestCount(); count != test.requests {
+				t.Errorf("expected %d requests, got %d", test.requests, count)
+			}
+		})
+	}
+}
+
+func TestTokenExpiry(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(now)
+
+	var conf config.Config
+	conf.Patreon.RequestsPerMinute = 6000
+
+	client := patreon.NewClient(conf, zap.NewNop(), nil, knownTiers{}, clk)
+	client.SetTokens(patreon.Tokens{ExpiresAt: now.Add(time.Hour)})
+
+	if client.TokenExpired() {
+		t.Error("expected the token not to have expired yet")
+	}
+
+	if got := client.TokenExpiresIn(); got != time.Hour {
+		t.Errorf("expected the token to expire in 1h, got %s", got)
+	}
+
+	clk.Advance(time.Hour)
+
+	// The token expires after, not at, its expiry time
+	if client.TokenExpired() {
+		t.Error("expected the token not to have expired at its expiry time")
+	}
+
+	clk.Advance(time.Second)
+
+	if !client.TokenExpired() {
+		t.Error("expected the token to have expired")
+	}
+
+	if got := client.TokenExpiresIn(); got != -time.Second {
+		t.Errorf("expected the token to have expired 1s ago, got %s", got)
+	}
+}
@@ -0,0 +1,77 @@
+package patreon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DeadlineError is the cause of a sync being cut short by one of its deadlines, naming the deadline and the setting
+// that controls it, as the underlying error is only a context deadline or a rate limiter refusing to wait past it
+type DeadlineError struct {
+	Deadline string // Such as "page timeout"
+	Limit    time.Duration
+	Setting  string // The env var that sets the limit
+}
+
+func (e *DeadlineError) Error() string {
+	return fmt.Sprintf("%s of %s exceeded (set by %s)", e.Deadline, e.Limit, e.Setting)
+}
+
+func SyncTimeout(limit time.Duration) *DeadlineError {
+	return &DeadlineError{Deadline: "sync timeout", Limit: limit, Setting: "PATREON_SYNC_TIMEOUT_SECONDS"}
+}
+
+func pageTimeout(limit time.Duration) *DeadlineError {
+	return &DeadlineError{Deadline: "page timeout", Limit: limit, Setting: "PATREON_PAGE_TIMEOUT_SECONDS"}
+}
+
+func retryBudgetExhausted(limit time.Duration) *DeadlineError {
+	return &DeadlineError{Deadline: "rate limit retry budget", Limit: limit, Setting: "PATREON_RETRY_BUDGET_SECONDS"}
+}
+
+// WithDeadlineCause returns err prefixed with the deadline that cancelled the context, if the context was cancelled by
+// one. Errors that already name their deadline are returned unchanged.
+func WithDeadlineCause(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var existing *DeadlineError
+	if errors.As(err, &existing) {
+		return err
+	}
+
+	var deadline *DeadlineError
+	if errors.As(context.Cause(ctx), &deadline) {
+		return fmt.Errorf("%w: %w", deadline, err)
+	}
+
+	return err
+}
+
+// retryBudget is the time left for retrying rate limited pages during a sync
+type retryBudget struct {
+	limit, remaining time.Duration
+}
+
+func newRetryBudget(limit time.Duration) *retryBudget {
+	return &retryBudget{limit: limit, remaining: limit}
+}
+
+// retry runs a retry, bounded by the time left in the budget, and deducts the time it took
+func (b *retryBudget) retry(ctx context.Context, attempt func(ctx context.Context) error) error {
+	if b.remaining <= 0 {
+		return retryBudgetExhausted(b.limit)
+	}
+
+	ctx, cancel := context.WithTimeoutCause(ctx, b.remaining, retryBudgetExhausted(b.limit))
+	defer cancel()
+
+	start := time.Now()
+	err := attempt(ctx)
+	b.remaining -= time.Since(start)
+
+	return WithDeadlineCause(ctx, err)
+}
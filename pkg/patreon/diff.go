@@ -0,0 +1,40 @@
+package patreon
+
+import (
+	"slices"
+)
+
+// SnapshotDiff is the difference between two snapshots of the patrons returned by FetchPledges
+type SnapshotDiff struct {
+	Added   []Patron
+	Removed []Patron
+	Changed []PatronChange
+}
+
+type PatronChange struct {
+	Previous Patron
+	Current  Patron
+}
+
+func (d SnapshotDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// Equal returns whether every field of the patrons is equal
+func (a Patron) Equal(b Patron) bool {
+	return a.Id == b.Id &&
+		a.Email == b.Email &&
+		a.LastChargeDate.Equal(b.LastChargeDate) &&
+		a.LastChargeStatus == b.LastChargeStatus &&
+		a.PatronStatus == b.PatronStatus &&
+		a.PledgeRelationshipStart.Equal(b.PledgeRelationshipStart) &&
+		a.CurrentlyEntitledAmountCents == b.CurrentlyEntitledAmountCents &&
+		a.LifetimeSupportCents == b.LifetimeSupportCents &&
+		a.PledgeCadence == b.PledgeCadence &&
+		a.NextChargeDate.Equal(b.NextChargeDate.Time) &&
+		a.IsGifted == b.IsGifted &&
+		a.Currency == b.Currency &&
+		slices.Equal(a.Tiers, b.Tiers) &&
+		((a.DiscordId == nil && b.DiscordId == nil) || (a.DiscordId != nil && b.DiscordId != nil && *a.DiscordId == *b.DiscordId)) &&
+		slices.EqualFunc(a.Duplicates, b.Duplicates, Patron.Equal)
+}
@@ -0,0 +1,54 @@
+package patreon
+
+import (
+	"cmp"
+	"slices"
+)
+
+// MergeDuplicate combines members with the same normalized email into a single patron. The preferred member is kept
+// for display, with the others attached to it as duplicates. The result doesn't depend on the order that the members
+// were fetched in.
+func MergeDuplicate(existing, patron Patron) Patron {
+	all := append([]Patron{existing}, existing.Duplicates...)
+	all = append(all, patron)
+
+	for i := range all {
+		all[i].Duplicates = nil
+	}
+
+	slices.SortFunc(all, comparePreference)
+
+	preferred := all[0]
+	preferred.Duplicates = all[1:]
+	return preferred
+}
+
+// comparePreference orders members sharing an email: those entitled to tiers first, then active patrons, then the
+// most recently charged. The patron ID breaks any tie.
+func comparePreference(a, b Patron) int {
+	if c := cmpBool(len(a.Tiers) > 0, len(b.Tiers) > 0); c != 0 {
+		return c
+	}
+
+	if c := cmpBool(a.PatronStatus == "active_patron", b.PatronStatus == "active_patron"); c != 0 {
+		return c
+	}
+
+	if c := b.LastChargeDate.Compare(a.LastChargeDate); c != 0 {
+		return c
+	}
+
+	return cmp.Compare(a.Id, b.Id)
+}
+
+// cmpBool orders true before false
+func cmpBool(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return -1
+	default:
+		return 1
+	}
+}
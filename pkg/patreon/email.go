@@ -0,0 +1,21 @@
+package patreon
+
+import "strings"
+
+// NormalizeEmail returns the key that an email is stored and looked up by, so that differently written forms of the
+// same address match. Emails are trimmed and lowercased. If canonicalizeGmail is set, dots and +tags are also removed
+// from Gmail addresses, which Gmail ignores when delivering.
+func NormalizeEmail(email string, canonicalizeGmail bool) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if !canonicalizeGmail {
+		return email
+	}
+
+	local, domain, ok := strings.Cut(email, "@")
+	if !ok || (domain != "gmail.com" && domain != "googlemail.com") {
+		return email
+	}
+
+	local, _, _ = strings.Cut(local, "+")
+	return strings.ReplaceAll(local, ".", "") + "@gmail.com"
+}
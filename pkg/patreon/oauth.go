@@ -0,0 +1,124 @@
+package patreon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/TicketsBot/subscriptions-app/internal/config"
+)
+
+// Scopes are the OAuth scopes that the tokens need to read the members of the campaign, including their emails
+const Scopes = "identity campaigns campaigns.members campaigns.members[email]"
+
+// AuthorizeUrl returns the URL of the consent page for the creator to grant the client access to their campaign. After
+// consenting, Patreon redirects to redirectUri with a code for ExchangeCode, and the given state.
+func AuthorizeUrl(conf config.Config, redirectUri, state string) string {
+	return authorizeUrl(conf, redirectUri, state, Scopes)
+}
+
+// IdentityAuthorizeUrl returns the URL of the consent page for a patron to prove which Patreon account is theirs,
+// granting only the identity scope. After consenting, Patreon redirects to redirectUri with a code for Identify.
+func IdentityAuthorizeUrl(conf config.Config, redirectUri, state string) string {
+	return authorizeUrl(conf, redirectUri, state, "identity")
+}
+
+func authorizeUrl(conf config.Config, redirectUri, state, scope string) string {
+	query := url.Values{
+		"response_type": {"code"},
+		"client_id":     {conf.Patreon.ClientId},
+		"redirect_uri":  {redirectUri},
+		"scope":         {scope},
+		"state":         {state},
+	}
+
+	return fmt.Sprintf("%s/oauth2/authorize?%s", conf.Patreon.BaseUrl, query.Encode())
+}
+
+// ExchangeCode exchanges the code from the consent page for tokens, which replace the client's tokens and are stored.
+// redirectUri must be the same as was passed to AuthorizeUrl.
+func (c *Client) ExchangeCode(ctx context.Context, code, redirectUri string) error {
+	conf, _ := c.currentConfig()
+
+	return c.requestTokens(ctx, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"client_id":     {conf.Patreon.ClientId},
+		"client_secret": {conf.Patreon.ClientSecret},
+		"redirect_uri":  {redirectUri},
+	})
+}
+
+type identityResponse struct {
+	Data struct {
+		Id uint64 `json:"id,string"`
+	} `json:"data"`
+}
+
+// Identify exchanges the code from the IdentityAuthorizeUrl consent page for the patron's tokens, and returns their
+// Patreon user ID. The patron's tokens are only used for this request, so the client's tokens are untouched.
+func Identify(ctx context.Context, httpClient *http.Client, conf config.Config, code, redirectUri string) (uint64, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"client_id":     {conf.Patreon.ClientId},
+		"client_secret": {conf.Patreon.ClientSecret},
+		"redirect_uri":  {redirectUri},
+	}
+
+	var tokens RefreshResponse
+	if err := doJson(ctx, httpClient, http.MethodPost, fmt.Sprintf("%s/api/oauth2/token", conf.Patreon.BaseUrl), "", form, &tokens); err != nil {
+		return 0, fmt.Errorf("failed to exchange code: %w", err)
+	}
+
+	var identity identityResponse
+	if err := doJson(ctx, httpClient, http.MethodGet, fmt.Sprintf("%s/api/oauth2/v2/identity", conf.Patreon.BaseUrl), tokens.AccessToken, nil, &identity); err != nil {
+		return 0, fmt.Errorf("failed to fetch identity: %w", err)
+	}
+
+	if identity.Data.Id == 0 {
+		return 0, errors.New("identity response has no user ID")
+	}
+
+	return identity.Data.Id, nil
+}
+
+// doJson makes a request, decoding the response into body. If form is set, it is sent as the request body, which keeps
+// secrets out of the URL.
+func doJson(ctx context.Context, httpClient *http.Client, method, endpoint, accessToken string, form url.Values, body any) error {
+	var reqBody io.Reader
+	if form != nil {
+		reqBody = strings.NewReader(form.Encode())
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reqBody)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("User-Agent", UserAgent)
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("returned %d status code", res.StatusCode)
+	}
+
+	return json.NewDecoder(res.Body).Decode(body)
+}
@@ -0,0 +1,537 @@
+// Package patreontest provides a fake of the Patreon API for integration tests, in the style of net/http/httptest. It
+// implements the endpoints used by patreon.Client: the campaign members endpoint with cursor pagination, the campaign
+// endpoint used by pre-flight checks and tier discovery, and issuing tokens, both by refreshing them and through the consent page, which
+// redirects straight back with AuthorizationCode. Rate limiting can be simulated, to test backing off.
+//
+//	server := patreontest.NewServer(1234)
+//	defer server.Close()
+//
+//	server.SetMembers(patrons)
+//	client := patreon.NewClient(server.Config(conf), logger, nil, tiers, clock.Real)
+//	client.SetTokens(server.Tokens())
+package patreontest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TicketsBot/subscriptions-app/internal/config"
+	"github.com/TicketsBot/subscriptions-app/pkg/patreon"
+)
+
+const (
+	ClientId     = "patreontest-client"
+	ClientSecret = "patreontest-secret"
+
+	// AuthorizationCode is the code that the consent page redirects with, which can be exchanged for the tokens once
+	AuthorizationCode = "patreontest-code"
+
+	// defaultPageSize is the page size used by Patreon when none is requested
+	defaultPageSize = 20
+)
+
+type Server struct {
+	*httptest.Server
+	CampaignId int
+
+	members      []patreon.Patron
+	tiers        []patreon.CampaignTier
+	tokens       patreon.Tokens
+	generation   int // Incremented each time the tokens are refreshed
+	codeUsed     bool
+	rateLimited  int // The number of requests still to be rejected
+	retryAfter   int // Seconds, sent with rejected requests
+	requestCount int
+	mu           sync.Mutex
+}
+
+// NewServer starts a fake serving the campaign, which has no members until SetMembers is called
+func NewServer(campaignId int) *Server {
+	s := &Server{
+		CampaignId: campaignId,
+	}
+
+	s.rotateTokens()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /oauth2/authorize", s.handleAuthorize)
+	mux.HandleFunc("POST /api/oauth2/token", s.handleToken)
+	mux.HandleFunc("GET /api/oauth2/v2/campaigns/{campaignId}", s.authenticated(s.handleCampaign))
+	mux.HandleFunc("GET /api/oauth2/v2/campaigns/{campaignId}/members", s.authenticated(s.handleMembers))
+
+	s.Server = httptest.NewServer(s.countRequests(mux))
+	return s
+}
+
+// Config returns conf with the Patreon settings pointed at the fake
+func (s *Server) Config(conf config.Config) config.Config {
+	conf.Patreon.BaseUrl = s.URL
+	conf.Patreon.CampaignId = s.CampaignId
+	conf.Patreon.ClientId = ClientId
+	conf.Patreon.ClientSecret = ClientSecret
+	return conf
+}
+
+// SetMembers replaces the members of the campaign. Members are returned in the order given.
+func (s *Server) SetMembers(members []patreon.Patron) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.members = members
+}
+
+// SetTiers replaces the tiers of the campaign, which are included in the campaign endpoint when requested
+func (s *Server) SetTiers(tiers []patreon.CampaignTier) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tiers = tiers
+}
+
+// Tokens returns the tokens that the fake currently accepts
+func (s *Server) Tokens() patreon.Tokens {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.tokens
+}
+
+// RateLimit rejects the next count requests with a 429, asking clients to retry after retryAfter
+func (s *Server) RateLimit(count int, retryAfter time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rateLimited = count
+	s.retryAfter = int(retryAfter / time.Second)
+}
+
+// RequestCount returns the number of requests received, including rejected requests
+func (s *Server) RequestCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requestCount
+}
+
+// rotateTokens issues new tokens. Must be called with the lock held, or before the server is started.
+func (s *Server) rotateTokens() {
+	s.generation++
+	s.tokens = patreon.Tokens{
+		AccessToken:  fmt.Sprintf("access-%d", s.generation),
+		RefreshToken: fmt.Sprintf("refresh-%d", s.generation),
+		ExpiresAt:    time.Now().Add(time.Hour * 24 * 30),
+	}
+}
+
+func (s *Server) countRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requestCount++
+
+		rejected := s.rateLimited > 0
+		if rejected {
+			s.rateLimited--
+		}
+
+		retryAfter := s.retryAfter
+		s.mu.Unlock()
+
+		if rejected {
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			writeError(w, http.StatusTooManyRequests, "Too many requests")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) authenticated(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		accessToken := s.tokens.AccessToken
+		s.mu.Unlock()
+
+		if r.Header.Get("Authorization") != "Bearer "+accessToken {
+			writeError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		if r.PathValue("campaignId") != strconv.Itoa(s.CampaignId) {
+			writeError(w, http.StatusNotFound, "Campaign not found")
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	// Patreon accepts the parameters in the query too, but the client keeps its secrets out of URLs
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+
+	query := r.PostForm
+
+	s.mu.Lock()
+	valid := query.Get("client_id") == ClientId && query.Get("client_secret") == ClientSecret
+	switch query.Get("grant_type") {
+	case "refresh_token":
+		valid = valid && query.Get("refresh_token") == s.tokens.RefreshToken
+	case "authorization_code":
+		valid = valid && query.Get("code") == AuthorizationCode && !s.codeUsed
+		s.codeUsed = s.codeUsed || valid
+	default:
+		valid = false
+	}
+
+	if valid {
+		s.rotateTokens()
+	}
+
+	tokens := s.tokens
+	s.mu.Unlock()
+
+	if !valid {
+		writeError(w, http.StatusUnauthorized, "invalid_grant")
+		return
+	}
+
+	writeJson(w, http.StatusOK, patreon.RefreshResponse{
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    int64(time.Until(tokens.ExpiresAt) / time.Second),
+		Scope:        "campaigns.members campaigns.members[email]",
+		TokenType:    "Bearer",
+	})
+}
+
+// handleAuthorize stands in for the consent page, redirecting straight back as if the creator had consented
+func (s *Server) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("client_id") != ClientId || query.Get("response_type") != "code" {
+		writeError(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+
+	redirectUri, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || !redirectUri.IsAbs() {
+		writeError(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+
+	redirectQuery := redirectUri.Query()
+	redirectQuery.Set("code", AuthorizationCode)
+	redirectQuery.Set("state", query.Get("state"))
+	redirectUri.RawQuery = redirectQuery.Encode()
+
+	http.Redirect(w, r, redirectUri.String(), http.StatusFound)
+}
+
+func (s *Server) handleCampaign(w http.ResponseWriter, r *http.Request) {
+	body := map[string]any{
+		"data": resource{
+			Id:   strconv.Itoa(s.CampaignId),
+			Type: "campaign",
+		},
+	}
+
+	if r.URL.Query().Get("include") == "tiers" {
+		s.mu.Lock()
+		included := make([]tier, len(s.tiers))
+		for i, campaignTier := range s.tiers {
+			included[i] = newTier(campaignTier)
+		}
+		s.mu.Unlock()
+
+		body["included"] = included
+	}
+
+	writeJson(w, http.StatusOK, body)
+}
+
+// handleMembers returns a page of members. The cursor is the offset of the page.
+func (s *Server) handleMembers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	pageSize := defaultPageSize
+	if countStr := query.Get("page[count]"); countStr != "" {
+		count, err := strconv.Atoi(countStr)
+		if err != nil || count < 1 {
+			writeError(w, http.StatusBadRequest, "Invalid page[count]")
+			return
+		}
+
+		pageSize = count
+	}
+
+	offset := 0
+	if cursor := query.Get("page[cursor]"); cursor != "" {
+		var err error
+		if offset, err = strconv.Atoi(cursor); err != nil || offset < 0 {
+			writeError(w, http.StatusBadRequest, "Invalid page[cursor]")
+			return
+		}
+	}
+
+	s.mu.Lock()
+	members := s.members
+	s.mu.Unlock()
+
+	end := min(offset+pageSize, len(members))
+	if offset > end {
+		offset = end
+	}
+
+	body := membersResponse{
+		Data:     make([]member, 0, end-offset),
+		Included: make([]any, 0, end-offset),
+	}
+
+	// Patrons' currencies are reported on a pledge event each, if pledge history is requested
+	includePledgeHistory := slices.Contains(strings.Split(query.Get("include"), ","), "pledge_history")
+
+	for _, patron := range members[offset:end] {
+		m := newMember(patron)
+		body.Included = append(body.Included, newUser(patron))
+
+		if includePledgeHistory && patron.Currency != "" {
+			event := newPledgeEvent(patron)
+			m.Relationships.PledgeHistory = &struct {
+				Data []resource `json:"data"`
+			}{Data: []resource{event.resource}}
+			body.Included = append(body.Included, event)
+		}
+
+		body.Data = append(body.Data, m)
+	}
+
+	if end < len(members) {
+		next := *r.URL
+		next.Scheme, next.Host = "http", r.Host
+
+		nextQuery := next.Query()
+		nextQuery.Set("page[cursor]", strconv.Itoa(end))
+		next.RawQuery = nextQuery.Encode()
+
+		body.Links = &links{Next: ptr(next.String())}
+	}
+
+	body.Meta.Pagination.Total = len(members)
+
+	writeJson(w, http.StatusOK, body)
+}
+
+type (
+	membersResponse struct {
+		Data     []member `json:"data"`
+		Included []any    `json:"included"` // Users, and pledge events if requested
+		Links    *links   `json:"links,omitempty"`
+		Meta     meta     `json:"meta"`
+	}
+
+	meta struct {
+		Pagination struct {
+			Total int `json:"total"`
+		} `json:"pagination"`
+	}
+
+	links struct {
+		Next *string `json:"next"`
+	}
+
+	resource struct {
+		Id   string `json:"id"`
+		Type string `json:"type"`
+	}
+
+	member struct {
+		resource
+		Attributes    memberAttributes    `json:"attributes"`
+		Relationships memberRelationships `json:"relationships"`
+	}
+
+	// memberAttributes mirrors patreon.Attributes, with dates that Patreon leaves unset encoded as null
+	memberAttributes struct {
+		Email                        string     `json:"email"`
+		LastChargeDate               *time.Time `json:"last_charge_date"`
+		LastChargeStatus             *string    `json:"last_charge_status"`
+		PatronStatus                 *string    `json:"patron_status"`
+		PledgeRelationshipStart      *time.Time `json:"pledge_relationship_start"`
+		CurrentlyEntitledAmountCents int        `json:"currently_entitled_amount_cents"`
+		LifetimeSupportCents         int        `json:"campaign_lifetime_support_cents"`
+		PledgeCadence                *int       `json:"pledge_cadence"`
+		NextChargeDate               *time.Time `json:"next_charge_date"`
+		IsGifted                     bool       `json:"is_gifted"`
+	}
+
+	memberRelationships struct {
+		User struct {
+			Data resource `json:"data"`
+		} `json:"user"`
+		CurrentlyEntitledTiers struct {
+			Data []resource `json:"data"`
+		} `json:"currently_entitled_tiers"`
+		PledgeHistory *struct {
+			Data []resource `json:"data"`
+		} `json:"pledge_history,omitempty"`
+	}
+
+	user struct {
+		resource
+		Attributes struct {
+			SocialConnections struct {
+				Discord *discordConnection `json:"discord"`
+			} `json:"social_connections"`
+		} `json:"attributes"`
+	}
+
+	discordConnection struct {
+		UserId string `json:"user_id"`
+	}
+
+	pledgeEvent struct {
+		resource
+		Attributes struct {
+			CurrencyCode string    `json:"currency_code"`
+			Date         time.Time `json:"date"`
+		} `json:"attributes"`
+	}
+
+	tier struct {
+		resource
+		Attributes struct {
+			Title       string `json:"title"`
+			AmountCents int    `json:"amount_cents"`
+			Published   bool   `json:"published"`
+		} `json:"attributes"`
+	}
+)
+
+func newMember(patron patreon.Patron) member {
+	m := member{
+		resource: resource{
+			Id:   fmt.Sprintf("member-%d", patron.Id),
+			Type: "member",
+		},
+		Attributes: memberAttributes{
+			Email:                        patron.Email,
+			LastChargeDate:               nonZero(patron.LastChargeDate),
+			LastChargeStatus:             nonEmpty(patron.LastChargeStatus),
+			PatronStatus:                 nonEmpty(patron.PatronStatus),
+			PledgeRelationshipStart:      nonZero(patron.PledgeRelationshipStart),
+			CurrentlyEntitledAmountCents: patron.CurrentlyEntitledAmountCents,
+			LifetimeSupportCents:         patron.LifetimeSupportCents,
+			PledgeCadence:                nonZeroInt(patron.PledgeCadence),
+			NextChargeDate:               nonZero(patron.NextChargeDate.Time),
+			IsGifted:                     patron.IsGifted,
+		},
+	}
+
+	m.Relationships.User.Data = resource{Id: strconv.FormatUint(patron.Id, 10), Type: "user"}
+
+	m.Relationships.CurrentlyEntitledTiers.Data = make([]resource, len(patron.Tiers))
+	for i, tierId := range patron.Tiers {
+		m.Relationships.CurrentlyEntitledTiers.Data[i] = resource{Id: strconv.FormatUint(tierId, 10), Type: "tier"}
+	}
+
+	return m
+}
+
+func newUser(patron patreon.Patron) user {
+	u := user{
+		resource: resource{
+			Id:   strconv.FormatUint(patron.Id, 10),
+			Type: "user",
+		},
+	}
+
+	if patron.DiscordId != nil {
+		u.Attributes.SocialConnections.Discord = &discordConnection{UserId: strconv.FormatUint(*patron.DiscordId, 10)}
+	}
+
+	return u
+}
+
+// newPledgeEvent returns the patron's latest pledge event, dated by their last charge, which carries their currency
+func newPledgeEvent(patron patreon.Patron) pledgeEvent {
+	e := pledgeEvent{
+		resource: resource{
+			Id:   fmt.Sprintf("pledge-%d", patron.Id),
+			Type: "pledge-event",
+		},
+	}
+
+	e.Attributes.CurrencyCode = patron.Currency
+	e.Attributes.Date = patron.LastChargeDate
+	return e
+}
+
+func newTier(campaignTier patreon.CampaignTier) tier {
+	t := tier{
+		resource: resource{
+			Id:   strconv.FormatUint(campaignTier.Id, 10),
+			Type: "tier",
+		},
+	}
+
+	t.Attributes.Title = campaignTier.Title
+	t.Attributes.AmountCents = campaignTier.AmountCents
+	t.Attributes.Published = campaignTier.Published
+	return t
+}
+
+func writeJson(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/vnd.api+json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, detail string) {
+	writeJson(w, status, map[string]any{
+		"errors": []map[string]any{
+			{
+				"status": strconv.Itoa(status),
+				"detail": detail,
+			},
+		},
+	})
+}
+
+func nonZero(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
+
+func nonZeroInt(i int) *int {
+	if i == 0 {
+		return nil
+	}
+
+	return &i
+}
+
+func nonEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+
+	return &s
+}
+
+func ptr[T any](value T) *T {
+	return &value
+}
@@ -0,0 +1,63 @@
+package patreon
+
+import (
+	"time"
+
+	"github.com/TicketsBot/subscriptions-app/internal/metrics"
+)
+
+// Progress describes a sync in progress, as of the last page of members fetched
+type Progress struct {
+	StartedAt time.Time `json:"started_at"`
+	UpdatedAt time.Time `json:"updated_at"` // When the last page was processed
+	Pages     int       `json:"pages"`
+	Members   int       `json:"members"` // Members processed so far, including those without an email, who are skipped
+	Total     int       `json:"total"`   // The number of members Patreon reports the campaign has, 0 if it didn't
+
+	// EstimatedFinishAt assumes the remaining members are fetched at the rate of those so far. Unset until the total
+	// is known.
+	EstimatedFinishAt *time.Time `json:"estimated_finish_at"`
+}
+
+// ProgressFunc is told the progress of each sync after every page of members
+type ProgressFunc func(progress Progress)
+
+// Fraction returns the fraction of members fetched, and false if the total is unknown
+func (p Progress) Fraction() (float64, bool) {
+	if p.Total <= 0 {
+		return 0, false
+	}
+
+	return min(float64(p.Members)/float64(p.Total), 1), true
+}
+
+// SetProgressFunc sets the function told the progress of each sync. It must be set before syncing starts.
+func (c *Client) SetProgressFunc(progress ProgressFunc) {
+	c.progress = progress
+}
+
+// reportProgress records a page of members, updating the metrics and telling the progress func
+func (c *Client) reportProgress(progress *Progress, members, total int) {
+	progress.UpdatedAt = c.clock.Now()
+	progress.Pages++
+	progress.Members += members
+	if total > 0 {
+		progress.Total = total
+	}
+
+	progress.EstimatedFinishAt = nil
+	if progress.Total > 0 && progress.Members > 0 {
+		elapsed := progress.UpdatedAt.Sub(progress.StartedAt)
+		remaining := max(progress.Total-progress.Members, 0)
+		finishAt := progress.UpdatedAt.Add(time.Duration(float64(elapsed) * float64(remaining) / float64(progress.Members)))
+		progress.EstimatedFinishAt = &finishAt
+	}
+
+	metrics.SyncPages.Set(float64(progress.Pages))
+	metrics.SyncMembers.Set(float64(progress.Members))
+	metrics.SyncCampaignMembers.Set(float64(progress.Total))
+
+	if c.progress != nil {
+		c.progress(*progress)
+	}
+}
@@ -0,0 +1,129 @@
+package patreon
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/TicketsBot/subscriptions-app/internal/metrics"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// minRequestsPerMinute is the slowest the limiter backs off to
+	minRequestsPerMinute = 1
+
+	// increaseSteps is how many successful requests it takes to recover from a backoff to the configured maximum
+	increaseSteps = 20
+
+	// unixTimestampThreshold tells a reset given as a Unix timestamp apart from one given in seconds
+	unixTimestampThreshold = 1_000_000_000
+)
+
+// adaptiveLimiter limits requests to Patreon, adjusting the rate to the rate limit headers of its responses. The rate
+// starts at the configured maximum. It is halved when Patreon responds with a 429, and climbs back up with each
+// successful response. If Patreon reports how many requests remain in the current window, the rate is set so that they
+// last until the window resets.
+type adaptiveLimiter struct {
+	limiter    *rate.Limiter
+	maxPerMin  float64
+	perMinute  float64
+	retryAfter time.Time // Requests are held until this time after a 429
+	mu         sync.Mutex
+}
+
+func newAdaptiveLimiter(requestsPerMinute int) *adaptiveLimiter {
+	l := &adaptiveLimiter{
+		limiter:   rate.NewLimiter(perMinute(float64(requestsPerMinute)), requestsPerMinute),
+		maxPerMin: float64(requestsPerMinute),
+		perMinute: float64(requestsPerMinute),
+	}
+
+	metrics.PatreonRequestsPerMinute.Set(l.perMinute)
+	return l
+}
+
+func perMinute(requests float64) rate.Limit {
+	return rate.Limit(requests / 60)
+}
+
+// Wait blocks until a request can be made, or the context is cancelled
+func (l *adaptiveLimiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	retryAfter := l.retryAfter
+	l.mu.Unlock()
+
+	if wait := time.Until(retryAfter); wait > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+
+	return l.limiter.Wait(ctx)
+}
+
+// Observe adjusts the rate to a response from Patreon
+func (l *adaptiveLimiter) Observe(res *http.Response) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+
+	if res.StatusCode == http.StatusTooManyRequests {
+		l.setRate(l.perMinute / 2)
+
+		// Without a Retry-After header, wait as long as the new rate would between requests
+		wait := time.Duration(float64(time.Minute) / l.perMinute)
+		if seconds, ok := headerInt(res.Header, "Retry-After"); ok {
+			wait = time.Duration(seconds) * time.Second
+		}
+
+		// Drain the burst, so that requests don't resume all at once
+		l.limiter.SetBurstAt(now, 1)
+		l.retryAfter = now.Add(wait)
+		return
+	}
+
+	remaining, hasRemaining := headerInt(res.Header, "X-RateLimit-Remaining")
+	reset, hasReset := headerInt(res.Header, "X-RateLimit-Reset")
+	if hasRemaining && hasReset {
+		// The reset is either a number of seconds, or a Unix timestamp
+		window := time.Duration(reset) * time.Second
+		if reset > unixTimestampThreshold {
+			window = time.Unix(reset, 0).Sub(now)
+		}
+
+		if window > 0 {
+			l.setRate(float64(remaining) / window.Minutes())
+			return
+		}
+	}
+
+	l.setRate(l.perMinute + l.maxPerMin/increaseSteps)
+}
+
+// setRate sets the rate, within the configured maximum. Must be called with the lock held.
+func (l *adaptiveLimiter) setRate(requestsPerMinute float64) {
+	l.perMinute = min(max(requestsPerMinute, minRequestsPerMinute), l.maxPerMin)
+	l.limiter.SetLimit(perMinute(l.perMinute))
+
+	// Restore the burst after a 429 once the rate has fully recovered
+	if l.perMinute == l.maxPerMin {
+		l.limiter.SetBurst(int(l.maxPerMin))
+	}
+
+	metrics.PatreonRequestsPerMinute.Set(l.perMinute)
+}
+
+func headerInt(header http.Header, key string) (int64, bool) {
+	value, err := strconv.ParseInt(header.Get(key), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return value, true
+}
@@ -0,0 +1,395 @@
+package patreon
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// recordedResponse is a response saved by RecordingTransport, with personal data and secrets scrubbed
+type recordedResponse struct {
+	Method     string          `json:"method"`
+	Url        string          `json:"url"` // Secrets in the query are redacted
+	StatusCode int             `json:"status_code"`
+	Header     http.Header     `json:"header"`
+	Body       json.RawMessage `json:"body,omitempty"`
+	Text       string          `json:"text,omitempty"` // The body, if it is not JSON
+	RecordedAt time.Time       `json:"recorded_at"`
+}
+
+const redacted = "REDACTED"
+
+// secretParams are query parameters that are redacted from recorded URLs
+var secretParams = []string{"access_token", "refresh_token", "client_id", "client_secret"}
+
+// runDirLayout names the directory of each recording, so that runs sort in the order they were started
+const runDirLayout = "20060102T150405.000000000Z"
+
+// RecordingTransport saves every response from Patreon to its own directory within dir, one numbered file per
+// response, so that a sync can be replayed later with ReplayTransport. Each recording is saved to a new directory, so
+// that recordings from earlier runs are never overwritten or mixed in. Emails and Discord IDs are replaced with
+// pseudonyms, keyed with a secret that is discarded after the recording, so they can't be reversed. Pseudonyms are
+// derived from the normalized email, so that members sharing an email still do. Tokens and other personal fields are
+// redacted.
+type RecordingTransport struct {
+	next              http.RoundTripper
+	dir               string // Of this recording
+	key               []byte // Keys the pseudonyms of this recording
+	canonicalizeGmail bool
+	logger            *zap.Logger
+	seq               atomic.Uint64
+}
+
+func NewRecordingTransport(next http.RoundTripper, dir string, canonicalizeGmail bool, logger *zap.Logger) (*RecordingTransport, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	return &RecordingTransport{
+		next:              next,
+		dir:               filepath.Join(dir, time.Now().UTC().Format(runDirLayout)),
+		key:               key,
+		canonicalizeGmail: canonicalizeGmail,
+		logger:            logger,
+	}, nil
+}
+
+// Dir returns the directory that this recording is saved to
+func (t *RecordingTransport) Dir() string {
+	return t.dir
+}
+
+func (t *RecordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	res.Body = io.NopCloser(bytes.NewReader(body))
+
+	// Failing to record must not fail the sync
+	if err := t.save(req, res, body); err != nil {
+		t.logger.Error("Failed to record Patreon response", zap.String("dir", t.dir), zap.Error(err))
+	}
+
+	return res, nil
+}
+
+func (t *RecordingTransport) save(req *http.Request, res *http.Response, body []byte) error {
+	recorded := recordedResponse{
+		Method:     req.Method,
+		Url:        scrubUrl(req.URL),
+		StatusCode: res.StatusCode,
+		Header:     res.Header.Clone(),
+		RecordedAt: time.Now(),
+	}
+
+	recorded.Header.Del("Set-Cookie")
+
+	if scrubbed, err := t.scrubJson(body); err == nil {
+		recorded.Body = scrubbed
+	} else {
+		recorded.Text = string(body)
+	}
+
+	encoded, err := json.MarshalIndent(recorded, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(t.dir, 0o700); err != nil {
+		return err
+	}
+
+	// Never replace a response, even if another process is recording to the same directory
+	path := filepath.Join(t.dir, fmt.Sprintf("%06d.json", t.seq.Add(1)))
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(encoded); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// ReplayTransport serves responses saved by RecordingTransport instead of contacting Patreon. dir may be the directory
+// of a single recording, or the directory recordings were saved within, in which case the latest is replayed. Requests
+// are matched to responses by method, path and query, ignoring the host. Responses to the same request are served in
+// the order they were recorded, and the last is repeated once they run out.
+type ReplayTransport struct {
+	dir string
+
+	loadOnce  sync.Once
+	loadErr   error
+	responses map[string][]recordedResponse
+	mu        sync.Mutex
+}
+
+func NewReplayTransport(dir string) *ReplayTransport {
+	return &ReplayTransport{
+		dir: dir,
+	}
+}
+
+func (t *ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.loadOnce.Do(func() {
+		t.loadErr = t.load()
+	})
+
+	if t.loadErr != nil {
+		return nil, fmt.Errorf("failed to load recorded Patreon responses from %s: %w", t.dir, t.loadErr)
+	}
+
+	key := replayKey(req.Method, scrubUrl(req.URL))
+
+	t.mu.Lock()
+	queue := t.responses[key]
+	if len(queue) == 0 {
+		t.mu.Unlock()
+		return nil, fmt.Errorf("no recorded Patreon response for %s", key)
+	}
+
+	recorded := queue[0]
+	if len(queue) > 1 {
+		t.responses[key] = queue[1:]
+	}
+	t.mu.Unlock()
+
+	body := []byte(recorded.Text)
+	if recorded.Body != nil {
+		body = recorded.Body
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.StatusCode, http.StatusText(recorded.StatusCode)),
+		StatusCode:    recorded.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        recorded.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+func (t *ReplayTransport) load() error {
+	dir, err := latestRecording(t.dir)
+	if err != nil {
+		return err
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+
+	if len(paths) == 0 {
+		return errors.New("no recorded responses found")
+	}
+
+	// Files are numbered with leading zeros, so sort in the order they were recorded
+	slices.Sort(paths)
+
+	t.responses = make(map[string][]recordedResponse)
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		var recorded recordedResponse
+		if err := json.Unmarshal(data, &recorded); err != nil {
+			return fmt.Errorf("failed to decode %s: %w", filepath.Base(path), err)
+		}
+
+		parsed, err := url.Parse(recorded.Url)
+		if err != nil {
+			return fmt.Errorf("failed to parse URL in %s: %w", filepath.Base(path), err)
+		}
+
+		key := replayKey(recorded.Method, scrubUrl(parsed))
+		t.responses[key] = append(t.responses[key], recorded)
+	}
+
+	return nil
+}
+
+// latestRecording returns dir if it holds recorded responses, or otherwise the latest recording within it
+func latestRecording(dir string) (string, error) {
+	if paths, err := filepath.Glob(filepath.Join(dir, "*.json")); err != nil || len(paths) > 0 {
+		return dir, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+
+	latest := ""
+	for _, entry := range entries {
+		if _, err := time.Parse(runDirLayout, entry.Name()); entry.IsDir() && err == nil && entry.Name() > latest {
+			latest = entry.Name()
+		}
+	}
+
+	if latest == "" {
+		return dir, nil
+	}
+
+	return filepath.Join(dir, latest), nil
+}
+
+func replayKey(method, scrubbedUrl string) string {
+	// The host is ignored, so that responses recorded from Patreon can be replayed with any base URL
+	if parsed, err := url.Parse(scrubbedUrl); err == nil {
+		parsed.Scheme, parsed.Host = "", ""
+		scrubbedUrl = parsed.String()
+	}
+
+	return method + " " + scrubbedUrl
+}
+
+// scrubUrl returns the URL with secret query parameters redacted. The query is re-encoded in a canonical order.
+func scrubUrl(u *url.URL) string {
+	scrubbed := *u
+	query := scrubbed.Query()
+	for _, param := range secretParams {
+		if query.Has(param) {
+			query.Set(param, redacted)
+		}
+	}
+
+	scrubbed.RawQuery = query.Encode()
+	return scrubbed.String()
+}
+
+// personalFields are redacted wherever they appear in a response, in case they are ever requested. url is the link to
+// a user's profile, which identifies them.
+var personalFields = []string{
+	"access_token", "refresh_token", "full_name", "first_name", "last_name", "vanity", "note", "image_url",
+	"thumb_url", "about", "address", "url",
+}
+
+// scrubJson replaces personal data in a JSON response, returning an error if the body is not JSON
+func (t *RecordingTransport) scrubJson(body []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber() // Keeps large IDs exact
+
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(t.scrubValue(value, ""))
+}
+
+func (t *RecordingTransport) scrubValue(value any, key string) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for childKey, child := range v {
+			if key == "social_connections" {
+				v[childKey] = t.scrubSocialConnection(childKey, child)
+			} else {
+				v[childKey] = t.scrubValue(child, childKey)
+			}
+		}
+
+		return v
+	case []any:
+		for i, child := range v {
+			v[i] = t.scrubValue(child, key)
+		}
+
+		return v
+	case string:
+		if key == "email" {
+			return t.pseudonymousEmail(v)
+		}
+
+		if slices.Contains(personalFields, key) {
+			return redacted
+		}
+
+		return v
+	default:
+		return v
+	}
+}
+
+// scrubSocialConnection keeps the Discord user ID as a pseudonym, as it is used to link accounts, and redacts every
+// other connection
+func (t *RecordingTransport) scrubSocialConnection(name string, connection any) any {
+	fields, ok := connection.(map[string]any)
+	if !ok {
+		return connection
+	}
+
+	if name != "discord" {
+		return redacted
+	}
+
+	for key, value := range fields {
+		if key == "user_id" {
+			if userId, ok := value.(string); ok {
+				fields[key] = t.pseudonymousId(userId)
+				continue
+			}
+		}
+
+		fields[key] = redacted
+	}
+
+	return fields
+}
+
+// pseudonymousEmail replaces an email with one derived from its normalized form, as the client normalizes it, so that
+// emails which matched before scrubbing still match
+func (t *RecordingTransport) pseudonymousEmail(email string) string {
+	normalized := NormalizeEmail(email, t.canonicalizeGmail)
+	if normalized == "" {
+		return ""
+	}
+
+	return "patron-" + hex.EncodeToString(t.mac("email:" + normalized)[:16]) + "@example.com"
+}
+
+// pseudonymousId replaces a Discord ID with another snowflake derived from it
+func (t *RecordingTransport) pseudonymousId(id string) string {
+	return strconv.FormatUint(binary.BigEndian.Uint64(t.mac("discord:" + id)[:8])>>2, 10)
+}
+
+func (t *RecordingTransport) mac(value string) []byte {
+	mac := hmac.New(sha256.New, t.key)
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
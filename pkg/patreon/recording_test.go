@@ -0,0 +1,190 @@
+package patreon_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/TicketsBot/subscriptions-app/pkg/patreon"
+	"go.uber.org/zap"
+)
+
+// staticTransport responds to every request with the same JSON body
+type staticTransport string
+
+func (body staticTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(string(body))),
+		Request:    req,
+	}, nil
+}
+
+const recordedMembers = `{
+	"data": [
+		{"id": "a", "attributes": {"email": "Patron@Example.com", "full_name": "Alice Patron"}},
+		{"id": "b", "attributes": {"email": "patron@example.com "}},
+		{"id": "c", "attributes": {"email": "f.o.o+patreon@gmail.com"}},
+		{"id": "d", "attributes": {"email": "foo@gmail.com"}}
+	],
+	"included": [
+		{"id": "1", "type": "user", "attributes": {
+			"url": "https://www.patreon.com/alice",
+			"social_connections": {
+				"discord": {"user_id": "123456789012345678", "url": "https://discord.com/users/123456789012345678"},
+				"twitter": {"user_id": "alice"}
+			}
+		}}
+	]
+}`
+
+// record records a single response through a new recording transport, returning the scrubbed body and the transport
+func record(t *testing.T, dir string, canonicalizeGmail bool) (map[string]any, *patreon.RecordingTransport) {
+	t.Helper()
+
+	transport, err := patreon.NewRecordingTransport(staticTransport(recordedMembers), dir, canonicalizeGmail, zap.NewNop())
+	if err != nil {
+		t.Fatalf("failed to create recording transport: %v", err)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "https://www.patreon.com/api/oauth2/v2/campaigns/1/members?access_token=secret", nil)
+	res, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("failed to record response: %v", err)
+	}
+
+	// The response passed on is untouched
+	if body, _ := io.ReadAll(res.Body); string(body) != recordedMembers {
+		t.Errorf("expected the response to be passed on unchanged, got %s", body)
+	}
+
+	data, err := os.ReadFile(filepath.Join(transport.Dir(), "000001.json"))
+	if err != nil {
+		t.Fatalf("failed to read recorded response: %v", err)
+	}
+
+	if strings.Contains(string(data), "secret") {
+		t.Errorf("recorded response contains the access token: %s", data)
+	}
+
+	var recorded struct {
+		Body map[string]any `json:"body"`
+	}
+
+	if err := json.Unmarshal(data, &recorded); err != nil {
+		t.Fatalf("failed to decode recorded response: %v", err)
+	}
+
+	return recorded.Body, transport
+}
+
+func recordedEmails(body map[string]any) []string {
+	var emails []string
+	for _, member := range body["data"].([]any) {
+		emails = append(emails, member.(map[string]any)["attributes"].(map[string]any)["email"].(string))
+	}
+
+	return emails
+}
+
+func recordedUser(body map[string]any) map[string]any {
+	return body["included"].([]any)[0].(map[string]any)["attributes"].(map[string]any)
+}
+
+func TestRecordingScrubsPersonalData(t *testing.T) {
+	body, _ := record(t, t.TempDir(), true)
+
+	emails := recordedEmails(body)
+	for _, email := range emails {
+		if !strings.HasPrefix(email, "patron-") || !strings.HasSuffix(email, "@example.com") {
+			t.Errorf("expected a pseudonymous email, got %q", email)
+		}
+	}
+
+	if emails[0] != emails[1] {
+		t.Errorf("expected emails differing in case and whitespace to share a pseudonym, got %q and %q", emails[0], emails[1])
+	}
+
+	if emails[2] != emails[3] {
+		t.Errorf("expected canonically equal Gmail addresses to share a pseudonym, got %q and %q", emails[2], emails[3])
+	}
+
+	if emails[0] == emails[2] {
+		t.Errorf("expected different emails to have different pseudonyms, got %q", emails[0])
+	}
+
+	name := body["data"].([]any)[0].(map[string]any)["attributes"].(map[string]any)["full_name"]
+	if name != "REDACTED" {
+		t.Errorf("expected the name to be redacted, got %v", name)
+	}
+
+	user := recordedUser(body)
+	if user["url"] != "REDACTED" {
+		t.Errorf("expected the profile URL to be redacted, got %v", user["url"])
+	}
+
+	connections := user["social_connections"].(map[string]any)
+	if connections["twitter"] != "REDACTED" {
+		t.Errorf("expected other social connections to be redacted, got %v", connections["twitter"])
+	}
+
+	discord := connections["discord"].(map[string]any)
+	if id, ok := discord["user_id"].(string); !ok || id == "123456789012345678" || strings.Trim(id, "0123456789") != "" {
+		t.Errorf("expected a pseudonymous snowflake, got %v", discord["user_id"])
+	}
+
+	if discord["url"] != "REDACTED" {
+		t.Errorf("expected the Discord profile URL to be redacted, got %v", discord["url"])
+	}
+}
+
+func TestRecordingWithoutGmailCanonicalization(t *testing.T) {
+	body, _ := record(t, t.TempDir(), false)
+
+	if emails := recordedEmails(body); emails[2] == emails[3] {
+		t.Errorf("expected Gmail addresses to only match when canonicalized, got %q for both", emails[2])
+	}
+}
+
+func TestRecordingsAreSeparate(t *testing.T) {
+	dir := t.TempDir()
+
+	first, firstTransport := record(t, dir, true)
+	second, secondTransport := record(t, dir, true)
+
+	if firstTransport.Dir() == secondTransport.Dir() {
+		t.Fatalf("expected each recording to have its own directory, got %s for both", firstTransport.Dir())
+	}
+
+	// The first recording is still intact
+	if _, err := os.Stat(filepath.Join(firstTransport.Dir(), "000001.json")); err != nil {
+		t.Errorf("expected the first recording to be kept: %v", err)
+	}
+
+	// Pseudonyms are keyed per recording, so can't be matched across recordings, or reversed with a dictionary
+	if recordedEmails(first)[0] == recordedEmails(second)[0] {
+		t.Error("expected pseudonyms to differ between recordings")
+	}
+
+	// Replaying the parent directory serves the latest recording
+	replay := patreon.NewReplayTransport(dir)
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost/api/oauth2/v2/campaigns/1/members?access_token=other", nil)
+	res, err := replay.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("failed to replay recording: %v", err)
+	}
+
+	var replayed map[string]any
+	if err := json.NewDecoder(res.Body).Decode(&replayed); err != nil {
+		t.Fatalf("failed to decode replayed response: %v", err)
+	}
+
+	if recordedEmails(replayed)[0] != recordedEmails(second)[0] {
+		t.Error("expected the latest recording to be replayed")
+	}
+}
@@ -0,0 +1,222 @@
+package patreon
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// memberPage is a page of members, converted to patrons
+type memberPage struct {
+	patrons []Patron
+	next    *string // The URL of the next page, unset on the last page
+	total   int     // The number of members in the campaign, 0 if Patreon didn't report it
+}
+
+// decodeMemberPage decodes a page of members as a stream, converting each member to a patron as it is decoded. This
+// avoids holding the full response, with its nested relationships, in memory at once. Users are included after the
+// members, so Discord IDs, and currencies from pledge events, are filled in once the whole page has been read.
+func decodeMemberPage(r io.Reader) (memberPage, error) {
+	decoder := json.NewDecoder(r)
+
+	if err := expectDelim(decoder, '{'); err != nil {
+		return memberPage{}, err
+	}
+
+	var page memberPage
+	discordIds := make(map[uint64]*uint64)
+	pledgeEvents := make(map[string]pledgeEvent)
+	pledgeHistories := make(map[int][]string) // Index of the patron in the page -> pledge event IDs
+
+	// Reused for every element, so that only the fields that are kept are allocated per member
+	var member Member
+	var included includedResource
+
+	for decoder.More() {
+		key, err := decoder.Token()
+		if err != nil {
+			return memberPage{}, err
+		}
+
+		switch key {
+		case "data":
+			err = decodeArray(decoder, func() error {
+				tiers := member.Relationships.CurrentlyEntitledTiers.Data[:0]
+				member = Member{}
+				member.Relationships.CurrentlyEntitledTiers.Data = tiers
+
+				if err := decoder.Decode(&member); err != nil {
+					return err
+				}
+
+				if history := member.Relationships.PledgeHistory.Data; len(history) > 0 {
+					eventIds := make([]string, len(history))
+					for i, event := range history {
+						eventIds[i] = event.Id
+					}
+
+					pledgeHistories[len(page.patrons)] = eventIds
+				}
+
+				page.patrons = append(page.patrons, toPatron(member))
+				return nil
+			})
+		case "included":
+			err = decodeArray(decoder, func() error {
+				included = includedResource{}
+				if err := decoder.Decode(&included); err != nil {
+					return err
+				}
+
+				if included.Type == "pledge-event" {
+					pledgeEvents[included.Id] = pledgeEvent{currency: included.Attributes.CurrencyCode, date: included.Attributes.Date.Time}
+					return nil
+				}
+
+				// Tiers are included alongside users, and their IDs may collide with user IDs
+				if included.Type != "user" {
+					return nil
+				}
+
+				userId, err := strconv.ParseUint(included.Id, 10, 64)
+				if err != nil {
+					return fmt.Errorf("invalid user ID %q: %w", included.Id, err)
+				}
+
+				discordIds[userId] = included.Attributes.SocialConnections.Discord.Id
+				return nil
+			})
+		case "links":
+			var links struct {
+				Next *string `json:"next"`
+			}
+
+			err = decoder.Decode(&links)
+			page.next = links.Next
+		case "meta":
+			var meta struct {
+				Pagination struct {
+					Total int `json:"total"`
+				} `json:"pagination"`
+			}
+
+			err = decoder.Decode(&meta)
+			page.total = meta.Pagination.Total
+		default:
+			var skipped json.RawMessage
+			err = decoder.Decode(&skipped)
+		}
+
+		if err != nil {
+			return memberPage{}, fmt.Errorf("failed to decode %v: %w", key, err)
+		}
+	}
+
+	if err := expectDelim(decoder, '}'); err != nil {
+		return memberPage{}, err
+	}
+
+	for i := range page.patrons {
+		page.patrons[i].DiscordId = discordIds[page.patrons[i].Id]
+	}
+
+	for i, eventIds := range pledgeHistories {
+		page.patrons[i].Currency = latestCurrency(eventIds, pledgeEvents)
+	}
+
+	return page, nil
+}
+
+// includedResource is a user, a tier, or a pledge event if pledge history is included, decoded into a single struct so that
+// each element is only decoded once
+type includedResource struct {
+	Id         string `json:"id"`
+	Type       string `json:"type"`
+	Attributes struct {
+		SocialConnections struct {
+			Discord struct {
+				Id *uint64 `json:"user_id,string"`
+			} `json:"discord"`
+		} `json:"social_connections"`
+
+		// Pledge events only
+		CurrencyCode string `json:"currency_code"`
+		Date         Date   `json:"date"`
+	} `json:"attributes"`
+}
+
+type pledgeEvent struct {
+	currency string
+	date     time.Time
+}
+
+// latestCurrency returns the currency of the most recent of the pledge events, or an empty string if none of them
+// name one
+func latestCurrency(eventIds []string, pledgeEvents map[string]pledgeEvent) string {
+	var latest pledgeEvent
+	for _, eventId := range eventIds {
+		event, ok := pledgeEvents[eventId]
+		if ok && event.currency != "" && (latest.currency == "" || event.date.After(latest.date)) {
+			latest = event
+		}
+	}
+
+	return strings.ToUpper(latest.currency)
+}
+
+func toPatron(member Member) Patron {
+	tiers := make([]uint64, len(member.Relationships.CurrentlyEntitledTiers.Data))
+	for i, tier := range member.Relationships.CurrentlyEntitledTiers.Data {
+		tiers[i] = tier.TierId
+	}
+
+	if len(tiers) == 0 {
+		tiers = nil
+	}
+
+	return Patron{
+		Attributes: member.Attributes,
+		Id:         member.Relationships.User.Data.Id,
+		Tiers:      tiers,
+	}
+}
+
+// decodeArray calls decodeElement for each element of the array at the decoder's position. null is treated as empty.
+func decodeArray(decoder *json.Decoder, decodeElement func() error) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+
+	if token == nil {
+		return nil
+	}
+
+	if token != json.Delim('[') {
+		return fmt.Errorf("expected array, got %v", token)
+	}
+
+	for decoder.More() {
+		if err := decodeElement(); err != nil {
+			return err
+		}
+	}
+
+	return expectDelim(decoder, ']')
+}
+
+func expectDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+
+	if token != delim {
+		return fmt.Errorf("expected %v, got %v", delim, token)
+	}
+
+	return nil
+}
@@ -0,0 +1,47 @@
+package patreon
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecodeMemberPageIgnoresIncludedTiers(t *testing.T) {
+	// Tier 1001 shares its ID with the user, and is included after them, so it would replace their Discord ID if it
+	// were read as a user
+	page := `{
+	"data": [
+		{
+			"id": "member-1",
+			"type": "member",
+			"attributes": {"email": "patron@example.com", "patron_status": "active_patron"},
+			"relationships": {
+				"user": {"data": {"id": "1001", "type": "user"}},
+				"currently_entitled_tiers": {"data": [{"id": "1001", "type": "tier"}]}
+			}
+		}
+	],
+	"included": [
+		{"id": "1001", "type": "user", "attributes": {"social_connections": {"discord": {"user_id": "100000000000000005"}}}},
+		{"id": "1001", "type": "tier", "attributes": {"title": "Premium", "amount_cents": 500}}
+	],
+	"meta": {"pagination": {"total": 1}}
+}`
+
+	decoded, err := decodeMemberPage(strings.NewReader(page))
+	if err != nil {
+		t.Fatalf("failed to decode page: %v", err)
+	}
+
+	if len(decoded.patrons) != 1 {
+		t.Fatalf("expected 1 patron, got %d", len(decoded.patrons))
+	}
+
+	patron := decoded.patrons[0]
+	if patron.DiscordId == nil || *patron.DiscordId != 100000000000000005 {
+		t.Errorf("expected the user's Discord ID, got %v", patron.DiscordId)
+	}
+
+	if len(patron.Tiers) != 1 || patron.Tiers[0] != 1001 {
+		t.Errorf("expected the patron to be entitled to tier 1001, got %v", patron.Tiers)
+	}
+}
@@ -0,0 +1,91 @@
+package patreon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// CampaignTier is a tier of the campaign, as listed by Patreon
+type CampaignTier struct {
+	Id          uint64
+	Title       string
+	AmountCents int
+	Published   bool // Unpublished tiers can't be joined, but existing patrons may still be entitled to them
+}
+
+type campaignTiersResponse struct {
+	Included []struct {
+		Id         uint64 `json:"id,string"`
+		Type       string `json:"type"`
+		Attributes struct {
+			Title       string `json:"title"`
+			AmountCents int    `json:"amount_cents"`
+			Published   bool   `json:"published"`
+		} `json:"attributes"`
+	} `json:"included"`
+}
+
+// FetchTiers lists every tier of the campaign, including unpublished tiers
+func (c *Client) FetchTiers(ctx context.Context) ([]CampaignTier, error) {
+	conf, ratelimiter := c.currentConfig()
+
+	tokens := c.Tokens()
+	if tokens.ExpiresAt.Before(c.clock.Now()) {
+		return nil, fmt.Errorf("refresh token has already expired (expired at %s)", tokens.ExpiresAt.String())
+	}
+
+	query := url.Values{
+		"include":      {"tiers"},
+		"fields[tier]": {"title,amount_cents,published"},
+	}
+
+	endpoint := fmt.Sprintf("%s/api/oauth2/v2/campaigns/%d?%s", conf.Patreon.BaseUrl, conf.Patreon.CampaignId, query.Encode())
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	req.Header.Set("User-Agent", UserAgent)
+
+	if err := ratelimiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+	ratelimiter.Observe(res)
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("campaign tiers request returned %d status code", res.StatusCode)
+	}
+
+	var body campaignTiersResponse
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode campaign tiers: %w", err)
+	}
+
+	tiers := make([]CampaignTier, 0, len(body.Included))
+	for _, included := range body.Included {
+		if included.Type != "tier" {
+			continue
+		}
+
+		tiers = append(tiers, CampaignTier{
+			Id:          included.Id,
+			Title:       included.Attributes.Title,
+			AmountCents: included.Attributes.AmountCents,
+			Published:   included.Attributes.Published,
+		})
+	}
+
+	return tiers, nil
+}
@@ -1,6 +1,10 @@
 package patreon
 
-import "time"
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+)
 
 type (
 	Patron struct {
@@ -8,6 +12,13 @@ type (
 		Id        uint64
 		Tiers     []uint64
 		DiscordId *uint64
+
+		// Currency is the currency the patron pledges in, from their latest pledge event, which amounts are reported in.
+		// Unset if pledge currencies aren't fetched, in which case amounts are in the campaign currency.
+		Currency string
+
+		// Duplicates are the other members with the same normalized email, which weren't preferred for display
+		Duplicates []Patron
 	}
 
 	PledgeResponse struct {
@@ -32,6 +43,11 @@ type (
 					TierId uint64 `json:"id,string"`
 				} `json:"data"`
 			} `json:"currently_entitled_tiers"`
+			PledgeHistory struct {
+				Data []struct {
+					Id string `json:"id"`
+				} `json:"data"`
+			} `json:"pledge_history"`
 		} `json:"relationships"`
 	}
 
@@ -41,6 +57,17 @@ type (
 		LastChargeStatus        string    `json:"last_charge_status"`
 		PatronStatus            string    `json:"patron_status"`
 		PledgeRelationshipStart time.Time `json:"pledge_relationship_start"`
+
+		CurrentlyEntitledAmountCents int `json:"currently_entitled_amount_cents"`
+		LifetimeSupportCents         int `json:"campaign_lifetime_support_cents"`
+
+		// PledgeCadence is the number of months paid for by each charge, 12 for annual pledges. Unset for members who
+		// have never pledged.
+		PledgeCadence  int  `json:"pledge_cadence"`
+		NextChargeDate Date `json:"next_charge_date"`
+
+		// IsGifted is set for members whose membership was gifted by someone else, so they haven't paid for it
+		IsGifted bool `json:"is_gifted"`
 	}
 
 	PatronMetadata struct {
@@ -68,3 +95,40 @@ type (
 		ExpiresAt    time.Time `json:"expires_at"`
 	}
 )
+
+// CadenceMonths returns the number of months paid for by each charge, assuming monthly billing if Patreon didn't say
+func (a Attributes) CadenceMonths() int {
+	if a.PledgeCadence <= 0 {
+		return 1
+	}
+
+	return a.PledgeCadence
+}
+
+// Date is a date that Patreon may send either as a timestamp or as a calendar date, which is parsed as midnight UTC
+type Date struct {
+	time.Time
+}
+
+func (d *Date) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+
+	if err := d.Time.UnmarshalJSON(data); err == nil {
+		return nil
+	}
+
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	parsed, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return err
+	}
+
+	d.Time = parsed
+	return nil
+}